@@ -0,0 +1,136 @@
+package gmailalert
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ActionTrash is the mailbox action moving the emails matching an alert to
+// the trash, from which Gmail deletes them for good after 30 days.
+const ActionTrash = "trash"
+
+// ActionUnsubscribe is the action unsubscribing from the senders of the
+// emails matching an alert that offer the one-click unsubscribe of RFC 8058,
+// and adding the unsubscribe link of the other senders to the notification.
+const ActionUnsubscribe = "unsubscribe"
+
+// ActionUnsubscribeLink is the action adding the unsubscribe link of the
+// senders of the emails matching an alert to the notification.
+const ActionUnsubscribeLink = "unsubscribelink"
+
+// actions are the known actions, mapped to whether they modify the mailbox.
+var actions = map[string]bool{
+	ActionTrash:           true,
+	ActionUnsubscribe:     false,
+	ActionUnsubscribeLink: false,
+}
+
+// dangerousActions are the actions that can make emails disappear from the
+// mailbox or act on behalf of its owner, which are only run if the alerts
+// configuration explicitly allows dangerous actions.
+var dangerousActions = map[string]bool{ActionTrash: true, ActionUnsubscribe: true}
+
+// Trasher is the interface that wraps the Trash method used by any types
+// implementing moving an email message to the trash.
+type Trasher interface {
+	Trash(id string) error
+}
+
+// WithAlerterTrasher accepts a Trasher and returns a functional option for
+// wiring the Trasher to an Alerter, which runs the "trash" action of alerts
+// with it.
+func WithAlerterTrasher(t Trasher) AlerterOption {
+	return func(a *Alerter) {
+		a.Trasher = t
+	}
+}
+
+// actionsOK returns an error if any action of the Alert receiver a is
+// unknown or given more than once, or if a counts unread emails, since its
+// matches do not stand for individual emails.
+func (a Alert) actionsOK() error {
+	seen := map[string]bool{}
+	for _, action := range a.Actions {
+		if _, ok := actions[action]; !ok {
+			return fmt.Errorf("action must be one of %q, %q, or %q, got %q",
+				ActionTrash, ActionUnsubscribe, ActionUnsubscribeLink, action)
+		}
+		if seen[action] {
+			return fmt.Errorf("action %q must only be given once", action)
+		}
+		seen[action] = true
+	}
+	if len(a.Actions) > 0 && a.UnreadAbove > 0 {
+		return fmt.Errorf("unread alert must not have actions, got %q", a.Actions)
+	}
+
+	return nil
+}
+
+// mailboxActions returns the names of the alerts of the AlertConfig
+// receiver c that define mailbox actions, which need a Gmail client
+// allowed to modify the mailbox.
+func (c AlertConfig) mailboxActions() []string {
+	var names []string
+	for _, alt := range c.Alerts {
+		for _, action := range alt.Actions {
+			if actions[action] {
+				names = append(names, alt.key())
+				break
+			}
+		}
+	}
+
+	return names
+}
+
+// actionsAllowed returns an error naming the alerts of the AlertConfig
+// receiver c with dangerous actions unless c explicitly allows them.
+func (c AlertConfig) actionsAllowed() error {
+	if c.DangerousActions {
+		return nil
+	}
+	var names []string
+	for _, alt := range c.Alerts {
+		for _, action := range alt.Actions {
+			if dangerousActions[action] {
+				names = append(names, alt.key())
+				break
+			}
+		}
+	}
+	if len(names) > 0 {
+		return fmt.Errorf(`alerts %q have dangerous actions, which must be allowed with "dangerousactions": true in the alerts config`, names)
+	}
+
+	return nil
+}
+
+// runActions runs the actions of the given Alert on the given messages
+// matching it, recording what they did in the Alert's state with the given
+// StoreTx, which is nil if the Alerter has no State. Actions surfacing
+// unsubscribe links add them to the Alert's notification message. An error
+// is returned if an action cannot be run, like when the Alerter has no
+// Trasher, or fails for any message.
+func (a Alerter) runActions(alt *Alert, matches []Message, tx StoreTx) error {
+	for _, action := range alt.Actions {
+		switch action {
+		case ActionTrash:
+			if a.Trasher == nil {
+				return errors.New("alerter must have a trasher to move emails to the trash")
+			}
+			for _, m := range matches {
+				if err := a.Trasher.Trash(m.ID); err != nil {
+					return fmt.Errorf("got error moving email %s to the trash: %w", m.ID, err)
+				}
+			}
+			a.Logger.Printf("moved %d emails matching alert %q to the trash", len(matches), alt.key())
+		case ActionUnsubscribe, ActionUnsubscribeLink:
+			if err := a.unsubscribe(alt, matches, tx, action == ActionUnsubscribe); err != nil {
+				return fmt.Errorf("got error unsubscribing from emails matching alert %q: %w", alt.key(), err)
+			}
+		}
+	}
+
+	return nil
+}
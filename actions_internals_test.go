@@ -0,0 +1,142 @@
+package gmailalert
+
+import (
+	"errors"
+	"io"
+	"log"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// recordingTrasher represents a Trasher recording the IDs of the messages
+// it moves to the trash, or failing with its err field if it is set.
+type recordingTrasher struct {
+	ids []string
+	err error
+}
+
+// Trash records the given message ID, or returns the err field of the
+// receiver t if it is set.
+func (t *recordingTrasher) Trash(id string) error {
+	if t.err != nil {
+		return t.err
+	}
+	t.ids = append(t.ids, id)
+	return nil
+}
+
+func TestAlertActionsOK(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		alert       Alert
+		errExpected bool
+	}{
+		"Trash action": {
+			alert: Alert{GmailQuery: "from:junk", Actions: []string{"trash"}},
+		},
+		"Unsubscribe actions": {
+			alert: Alert{GmailQuery: "from:news", Actions: []string{"unsubscribe", "unsubscribelink"}},
+		},
+		"Unknown action": {
+			alert:       Alert{GmailQuery: "from:junk", Actions: []string{"delete"}},
+			errExpected: true,
+		},
+		"Action given twice": {
+			alert:       Alert{GmailQuery: "from:junk", Actions: []string{"trash", "trash"}},
+			errExpected: true,
+		},
+		"Unread alert with action": {
+			alert:       Alert{UnreadAbove: 10, Actions: []string{"trash"}},
+			errExpected: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := tc.alert.actionsOK()
+			errReceived := err != nil
+
+			if tc.errExpected != errReceived {
+				t.Fatalf("actionsOK returned unexpected error status: %v", err)
+			}
+		})
+	}
+}
+
+func TestAlertConfigActionsAllowed(t *testing.T) {
+	t.Parallel()
+
+	cfg := AlertConfig{Alerts: []Alert{
+		{Name: "newsletters", GmailQuery: "from:news"},
+		{Name: "junk", GmailQuery: "from:junk", Actions: []string{"trash"}},
+		{Name: "promotions", GmailQuery: "from:shop", Actions: []string{"unsubscribelink"}},
+	}}
+
+	if got := cfg.mailboxActions(); !cmp.Equal([]string{"junk"}, got) {
+		t.Errorf("want only alert \"junk\" to have mailbox actions, got %q", got)
+	}
+	if err := cfg.actionsAllowed(); err == nil {
+		t.Error("expected an error for a dangerous action that is not allowed but did not get one")
+	}
+	cfg.DangerousActions = true
+	if err := cfg.actionsAllowed(); err != nil {
+		t.Errorf("got unexpected error for an allowed dangerous action: %v", err)
+	}
+}
+
+func TestAlerterRunsTrashAction(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		trasher     *recordingTrasher
+		want        []string
+		errExpected bool
+	}{
+		"Matching emails are trashed": {
+			trasher: &recordingTrasher{},
+			want:    []string{"1", "2"},
+		},
+		"Failing trasher fails evaluation": {
+			trasher:     &recordingTrasher{err: errors.New("insufficient permission")},
+			errExpected: true,
+		},
+		"Missing trasher fails evaluation": {
+			errExpected: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			notifier := &recordingTestNotifier{}
+			opts := []AlerterOption{WithAlerterLogger(log.New(io.Discard, "", 0))}
+			if tc.trasher != nil {
+				opts = append(opts, WithAlerterTrasher(tc.trasher))
+			}
+			a, err := NewAlerter(fakePreviewFetcher{matches: []Message{{ID: "1"}, {ID: "2"}}}, notifier, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res := a.process(Alert{Name: "junk", GmailQuery: "from:junk", Actions: []string{"trash"}}, nil)
+			errReceived := res.Err != nil
+
+			if tc.errExpected != errReceived {
+				t.Fatalf("process returned unexpected error status: %v", res.Err)
+			}
+			if errReceived {
+				if len(notifier.alerts) != 0 {
+					t.Errorf("want no notification after a failed action, got %+v", notifier.alerts)
+				}
+				return
+			}
+			if !cmp.Equal(tc.want, tc.trasher.ids) {
+				t.Errorf("want != got\ndiff=%s", cmp.Diff(tc.want, tc.trasher.ids))
+			}
+			if !res.Notified {
+				t.Errorf("want alert notified after trashing its emails, got %+v", res)
+			}
+		})
+	}
+}
@@ -5,6 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"time"
+
+	"github.com/gregdel/pushover"
 )
 
 // AlertConfig represents a configuration containing a Pushover application to
@@ -12,28 +15,275 @@ import (
 type AlertConfig struct {
 	PushoverApp string  `json:"pushoverapp"`
 	Alerts      []Alert `json:"alerts"`
+	// The number of characters longer Pushover notification messages are
+	// truncated to. If zero, Pushover's maximum of 1024 is used.
+	PushoverMaxLength int `json:"pushovermaxlength"`
+	// The optional templates overriding the title and message of
+	// notifications, by the kind of notifier they are formatted for, like
+	// "pushover" or "slack".
+	Formats map[string]FormatTemplate `json:"formats"`
+	// What Pushover is sent about matches, either "full" for the whole
+	// notification message or "hashed" for only the number of matching
+	// emails and a hash of the message. If empty, "full" is used.
+	PushoverPrivacy string `json:"pushoverprivacy"`
+	// The optional independent groups of alerts, each for its own Gmail
+	// account and Pushover app, used instead of PushoverApp and Alerts.
+	Profiles []Profile `json:"profiles"`
+	// The optional StatsD or Graphite server to push run metrics to.
+	Metrics *MetricsConfig `json:"metrics"`
+	// The optional dead man's switch URLs to ping after every run.
+	Heartbeat *HeartbeatConfig `json:"heartbeat"`
+	// The optional webhook to post a summary of every run to.
+	Webhook *WebhookConfig `json:"webhook"`
+	// The optional IFTTT or Zapier webhook to post every notified alert to.
+	Automation *AutomationConfig `json:"automation"`
+	// The optional Atom feed of fired alerts, written to a file or served
+	// by the HTTP API.
+	Feed *FeedConfig `json:"feed"`
+	// The optional circuit breaker skipping alerts while the Gmail API
+	// keeps failing.
+	GmailBreaker *BreakerConfig `json:"gmailbreaker"`
+	// The optional notifications about the operation of gmailalert itself.
+	Monitor *MonitorConfig `json:"monitor"`
+	// The optional backend to store the notification history in. If nil,
+	// it is stored in the file given by the -state-file flag.
+	State *StateConfig `json:"state"`
+	// How long after a notification an identical one, for the same alert
+	// and the same matching emails, is suppressed, as a duration like "1h",
+	// even across restarts. Requires a state file. If empty, identical
+	// notifications are only limited by each alert's repeat interval.
+	DedupWindow string `json:"dedupwindow"`
+	// How long the evaluation of an alert may take, as a duration like
+	// "10s", before a warning is logged, unless the alert has a latency
+	// budget of its own. If empty, no warnings are logged.
+	LatencyBudget string `json:"latencybudget"`
+	// The IANA name of the time zone, like "Europe/Berlin", that alerts
+	// without a time zone of their own are evaluated in. If empty, the
+	// system's local time zone is used.
+	TimeZone string `json:"timezone"`
+	// Whether each alert's evaluation ID is appended to its notification.
+	TraceNotifications bool `json:"tracenotifications"`
+	// The maximum number of alerts evaluated at the same time. If zero, all
+	// alerts are evaluated at the same time.
+	Concurrency int `json:"concurrency"`
+	// The number of times a notification that could not be sent is sent
+	// again within the same evaluation.
+	NotifyRetries int `json:"notifyretries"`
+	// The number of emails whose details are fetched from Gmail with a
+	// single batch request, at most 100. If zero or one, the details of
+	// every email are fetched with a request of their own.
+	FetchBatch int `json:"fetchbatch"`
+	// Which lines are logged while evaluating alerts, either "all" or
+	// "errors" for only those about errors and warnings. If empty, every
+	// line is logged.
+	Logging string `json:"logging"`
+	// The optional audit log to record every sent notification in.
+	Audit *AuditConfig `json:"audit"`
+	// The optional proxies to send requests to the Gmail and Pushover APIs
+	// through.
+	Proxy *ProxyConfig `json:"proxy"`
+	// The optional timeouts and connection pooling of the HTTP clients
+	// sending requests to the Gmail and Pushover APIs.
+	HTTP *HTTPConfig `json:"http"`
+	// The optional routing rules adding recipients to alerts by their
+	// labels, in every profile.
+	Routes []Route `json:"routes"`
+	// The optional SMTP server the notifications of alerts with "email"
+	// failover steps are sent through.
+	Email *EmailConfig `json:"email"`
+	// Whether alerts may have dangerous mailbox actions, like moving their
+	// matching emails to the trash.
+	DangerousActions bool `json:"dangerousactions"`
 }
 
 // Alert represents a Gmail filtering query to find matches against and the
 // corresponding configuration to use in the Pushover notification.
 type Alert struct {
+	// The name identifying the alert. If empty, the GmailQuery, or the
+	// watched label, is used to identify the alert.
+	Name string `json:"name"`
+	// The optional free-form labels of the alert, like {"team": "billing"},
+	// added to its metrics, webhook payloads, events, and log lines and
+	// matched by routing rules. Unrelated to Gmail labels.
+	Labels map[string]string `json:"labels"`
 	// The Gmail query expression to match emails against.
 	// See https://support.google.com/mail/answer/7190?hl=en
 	GmailQuery string `json:"gmailquery"`
+	// The Gmail queries to match emails against, combined with "and",
+	// "or", and "not" by the IDs of their matching emails, used instead of
+	// the GmailQuery for conditions it cannot express.
+	Queries *QueryExpr `json:"queries"`
+	// The sender that matching emails must be from, like "bank.com" or
+	// "alice@example.com". Like the other structured search fields, it is
+	// composed into the GmailQuery when the configuration is decoded, so
+	// common alerts need no Gmail search syntax.
+	From string `json:"from"`
+	// The recipient that matching emails must be sent to.
+	To string `json:"to"`
+	// The words or phrase that the subject of matching emails must contain.
+	Subject string `json:"subject"`
+	// How recent matching emails must be, as a number of days, months, or
+	// years like "2d", "3m", or "1y".
+	NewerThan string `json:"newerthan"`
+	// The name of a label that matching emails must have.
+	Label string `json:"label"`
+	// Whether matching emails must have an attachment.
+	HasAttachment bool `json:"hasattachment"`
+	// The Gmail inbox category, like "primary", "social", "promotions",
+	// "updates", or "forums", that emails matching the GmailQuery must be
+	// in. If empty, the category is ignored.
+	Category string `json:"category"`
+	// Whether emails matching the GmailQuery must be marked important by
+	// Gmail, or must not be if false. If unset, importance is ignored.
+	Important *bool `json:"important"`
+	// The Gmail system folder, one of "inbox", "sent", "draft", "spam", or
+	// "trash", that emails matching the GmailQuery must be in. Emails in
+	// spam or trash only match if it is "spam" or "trash". If empty, the
+	// folder is ignored.
+	Folder string `json:"folder"`
+	// Whether emails in spam or trash match the GmailQuery too. Gmail does
+	// not search spam and trash unless asked to.
+	IncludeSpamTrash bool `json:"includespamtrash"`
+	// The name of a label, like "Banking", whose addition to an email
+	// triggers the alert. A label alert has no GmailQuery; it is driven by
+	// the changes to the mailbox since the alert was last evaluated.
+	LabelAdded string `json:"labeladded"`
+	// The name of a label, like "INBOX", whose removal from an email
+	// triggers the alert. A label alert has no GmailQuery.
+	LabelRemoved string `json:"labelremoved"`
+	// The number of unread emails with the UnreadLabel above which the alert
+	// is triggered, like an "inbox overflowing" reminder. An unread alert
+	// has no GmailQuery.
+	UnreadAbove int `json:"unreadabove"`
+	// The name of the label whose unread emails an unread alert counts.
+	// Defaults to "INBOX".
+	UnreadLabel string `json:"unreadlabel"`
+	// Whether the notification breaks the matching emails down by sender
+	// domain, like "12 from amazon.com, 3 from chase.com".
+	GroupByDomain bool `json:"groupbydomain"`
+	// The optional sanitization of the snippet of the most recent matching
+	// email, which is appended to the notification if set.
+	Snippet *SnippetConfig `json:"snippet"`
+	// The optional handling of the calendar events attached to matching
+	// emails, like meeting invitations, which are appended to the
+	// notification if set.
+	Calendar *CalendarConfig `json:"calendar"`
+	// The optional extraction of verification codes from matching emails,
+	// which makes the notification hold only the code of the most recent
+	// email with one, sent with high priority.
+	OTP *OTPConfig `json:"otp"`
+	// Whether the notification links the parcel tracking numbers of the
+	// UPS, USPS, FedEx, and DHL shipments found in matching emails to their
+	// carrier's tracking page.
+	Tracking bool `json:"tracking"`
+	// The ISO 639-1 codes of the languages, like "en" or "de", that the
+	// body of a matching email must be written in. Emails whose language
+	// cannot be detected match. If empty, emails of any language match.
+	Languages []string `json:"languages"`
+	// The evaluation priority of the alert. Alerts with a higher priority
+	// are queried and notified before the others of each run. Defaults to
+	// 0, and negative priorities come after alerts without one.
+	Priority int `json:"priority"`
 	// The pushover notification recipient.
 	PushoverTarget string `json:"pushovertarget"`
+	// Additional pushover notification recipients.
+	PushoverTargets []string `json:"pushovertargets"`
 	// The title of the pushover notification.
 	PushoverTitle string `json:"pushovertitle"`
 	// The pushover sound to use for the notification.
 	PushoverSound string `json:"pushoversound"`
+	// The optional emergency priority of the pushover notification, which
+	// repeats until a recipient acknowledges it.
+	PushoverEmergency *EmergencyConfig `json:"pushoveremergency"`
+	// The optional ordered channels the notification is sent with, like
+	// Pushover, then email, then a webhook, where each is only tried if
+	// the ones before it failed. If empty, the notification is only sent
+	// with Pushover.
+	Failover []FailoverStep `json:"failover"`
 	// The message to put in the pushover notification.
 	PushoverMsg string
+	// The ID of the current evaluation of the alert, in the form
+	// "<run ID>.<alert index>". It is set by the Alerter.
+	EvalID string `json:"-"`
+	// The key shared by every notification of the alert for the same
+	// matching emails, made of the alert's name and a hash of the emails'
+	// IDs, which notifiers can include in their payloads so that receivers
+	// can drop duplicates. It is set by the Alerter.
+	DedupKey string `json:"-"`
+	// The number of emails found for the alert. It is set by the Alerter.
+	Matches int `json:"-"`
+	// How often an alert that keeps matching the same messages is notified
+	// again. Valid values are "always" (the default, notify on every run),
+	// "once" (notify only when new messages match), or a duration like "6h"
+	// (notify again once the duration has elapsed since the last notification).
+	RepeatInterval string `json:"repeatinterval"`
+	// The maximum age of a matching message, as a duration like "72h".
+	// Older messages are ignored even if they match the GmailQuery. If
+	// empty, messages of any age are notified on.
+	MaxAge string `json:"maxage"`
+	// Whether the first image found in the most recent matching message is
+	// attached to the pushover notification.
+	AttachImage bool `json:"attachimage"`
+	// The maximum size in bytes of an attached image. Larger images are
+	// skipped. If zero, Pushover's limit of 2.5MB is used.
+	AttachImageMaxBytes int64 `json:"attachimagemaxbytes"`
+	// The maximum size in bytes of a matching message held in memory
+	// while reading its body or attachments, like for AttachImage,
+	// Languages, or Tracking. The bodies of the attachments of larger
+	// messages that do not fit are left out. If zero, 10MB is used.
+	MaxMessageBytes int64 `json:"maxmessagebytes"`
+	// The names of other alerts that suppress the notification of this
+	// alert while they were notified within the SuppressWindow, like a
+	// "daily summary" alert suppressing alerts on individual emails.
+	SuppressedBy []string `json:"suppressedby"`
+	// How long after being notified the alerts in SuppressedBy suppress this
+	// alert, as a duration like "24h". It is required if SuppressedBy is set.
+	SuppressWindow string `json:"suppresswindow"`
+	// How long the evaluation of the alert may take, as a duration like
+	// "5s", before a warning is logged. If empty, the "latencybudget" of the
+	// alert configuration is used.
+	LatencyBudget string `json:"latencybudget"`
+	// The IANA name of the time zone, like "America/New_York", that the
+	// alert is evaluated in: the hour and weekday of its Condition, the
+	// days of "after:today"-like operators in its queries, and the times of
+	// its notification. If empty, the "timezone" of the alert configuration
+	// is used.
+	TimeZone string `json:"timezone"`
+	// An expression that must hold for the alert to be notified, like
+	// "matches > 3 && newestAgeMinutes < 60", in addition to the alert having
+	// matches. The variables it can use are described in the README. If
+	// empty, the alert is notified whenever it has matches.
+	Condition string `json:"condition"`
+	// The optional locale and currencies of the money amounts read from
+	// matching emails for the "amount" and "totalAmount" variables of the
+	// Condition. If nil, amounts of any currency are read, guessing their
+	// decimal separator.
+	Money *MoneyConfig `json:"money"`
+	// The optional script deciding whether the alert is notified and
+	// changing the title, message, or recipients of its notification.
+	Script *ScriptConfig `json:"script"`
+	// The optional mailbox actions run on the matching emails once the
+	// alert's threshold, condition, and script pass, like "trash".
+	// Dangerous actions must be allowed by the alerts configuration.
+	Actions []string `json:"actions"`
+	// The image attached to the notification. It is set by the Alerter.
+	Attachment *Attachment `json:"-"`
+}
+
+// Attachment represents an image attached to a notification.
+type Attachment struct {
+	// The media type of the image, like "image/png".
+	MediaType string
+	// The contents of the image.
+	Data []byte
 }
 
 // DecodeAlerts accepts an io.Reader containing JSON-formatted alert configuration,
-// decodes the JSON object into an AlertConfig value and returns the AlertConfig. An
-// error is returned if the io.Reader argument is nil or if there is a problem
-// JSON-decoding the io.Reader.
+// decodes the JSON object into an AlertConfig value and returns the AlertConfig.
+// The structured search fields of each alert are composed into its GmailQuery,
+// and the recipients of the routing rules matching its labels are added to it.
+// An error is returned if the io.Reader argument is nil, if there is a problem
+// JSON-decoding the io.Reader, or if the routing rules or labels are invalid.
 func DecodeAlerts(rdr io.Reader) (AlertConfig, error) {
 	if rdr == nil {
 		return AlertConfig{}, errors.New("io.Reader argument must be non-nil")
@@ -43,15 +293,267 @@ func DecodeAlerts(rdr io.Reader) (AlertConfig, error) {
 	if err := json.NewDecoder(rdr).Decode(&a); err != nil {
 		return AlertConfig{}, fmt.Errorf("got an error decoding JSON: %v", err)
 	}
+	for i := range a.Alerts {
+		a.Alerts[i] = a.Alerts[i].composeQuery()
+	}
+	var err error
+	if a.Alerts, err = applyRoutes(a.Alerts, a.Routes); err != nil {
+		return AlertConfig{}, err
+	}
+	for i := range a.Profiles {
+		if a.Profiles[i].Alerts, err = applyRoutes(a.Profiles[i].Alerts, a.Routes); err != nil {
+			return AlertConfig{}, err
+		}
+	}
 
 	return a, nil
 }
 
-// OK validates a given Alert and returns an error if any of its fields are empty.
+// OK validates a given Alert and returns an error if any of its required fields
+// are empty, if it has more than one of a Gmail query, a watched label, or an
+// unread threshold, if its unread threshold is negative or is combined with
+// conditions on individual emails, if it has an unknown category or a
+// category or importance condition on a watched label, if it has a language
+// that is not an ISO 639-1 code, if its repeat interval, max age,
+// suppression window, condition, script, actions, or failover steps are
+// invalid, or if its image attachment size limit exceeds Pushover's limit.
 func (a Alert) OK() error {
-	if a.GmailQuery == "" || a.PushoverMsg == "" || a.PushoverSound == "" || a.PushoverTarget == "" || a.PushoverTitle == "" {
-		return fmt.Errorf("all fields in the alert must be non-empty, got %+q", a)
+	_, _, watchesLabel := a.labelWatch()
+	countsUnread := a.UnreadAbove > 0
+	if (a.GmailQuery == "" && a.Queries == nil && !watchesLabel && !countsUnread) || a.PushoverMsg == "" || a.PushoverSound == "" || len(a.Recipients()) == 0 || a.PushoverTitle == "" {
+		return fmt.Errorf("all fields in the alert must be non-empty, got %+v", a)
+	}
+
+	if (watchesLabel && (a.GmailQuery != "" || (a.LabelAdded != "" && a.LabelRemoved != ""))) ||
+		(countsUnread && (a.GmailQuery != "" || watchesLabel)) ||
+		(a.Queries != nil && (a.GmailQuery != "" || watchesLabel || countsUnread)) {
+		return fmt.Errorf("alert must have exactly one of a gmail query, queries, an added label, a removed label, or an unread threshold, got %+v", a)
+	}
+	if a.Queries != nil {
+		if err := a.Queries.ok(); err != nil {
+			return err
+		}
+	}
+	if err := a.structuredOK(); err != nil {
+		return err
+	}
+	if a.UnreadAbove < 0 {
+		return fmt.Errorf("unread threshold must not be negative, got %d", a.UnreadAbove)
+	}
+	if countsUnread && (!a.signals().empty() || a.MaxAge != "" || a.AttachImage || a.GroupByDomain || len(a.Languages) > 0 || a.Snippet != nil || a.Calendar != nil || a.OTP != nil || a.Tracking || a.Money != nil) {
+		return fmt.Errorf("unread alert must not have a category, importance, folder, spam and trash inclusion, max age, image attachment, domain breakdown, languages, snippet, calendar, otp, tracking, or money, got %+v", a)
+	}
+	if a.Snippet != nil {
+		if err := a.Snippet.ok(); err != nil {
+			return err
+		}
+	}
+	if a.Calendar != nil {
+		if err := a.Calendar.ok(); err != nil {
+			return err
+		}
+	}
+	if a.Money != nil {
+		if err := a.Money.ok(); err != nil {
+			return err
+		}
+	}
+	if a.OTP != nil {
+		if a.AttachImage || a.GroupByDomain || a.Snippet != nil || a.Calendar != nil || a.Tracking {
+			return fmt.Errorf("otp alert must not have an image attachment, domain breakdown, snippet, calendar, or tracking, got %+v", a)
+		}
+		if err := a.OTP.ok(); err != nil {
+			return err
+		}
+	}
+	if a.PushoverEmergency != nil {
+		if _, _, _, err := a.PushoverEmergency.durations(); err != nil {
+			return err
+		}
+	}
+	for _, lang := range a.Languages {
+		if !languageCode.MatchString(lang) {
+			return fmt.Errorf("language must be a lowercase ISO 639-1 code like \"en\", got %q", lang)
+		}
+	}
+
+	if watchesLabel && !a.signals().empty() {
+		return fmt.Errorf("alert watching a label must not have a category, importance, folder, or spam and trash inclusion, got %+v", a)
+	}
+	if err := a.signals().ok(); err != nil {
+		return err
+	}
+
+	if _, err := parseRepeatInterval(a.RepeatInterval); err != nil {
+		return err
+	}
+
+	if a.MaxAge != "" {
+		if d, err := time.ParseDuration(a.MaxAge); err != nil || d <= 0 {
+			return fmt.Errorf("max age must be a positive duration, got %q", a.MaxAge)
+		}
+	}
+
+	if len(a.SuppressedBy) > 0 {
+		if d, err := time.ParseDuration(a.SuppressWindow); err != nil || d <= 0 {
+			return fmt.Errorf("suppression window must be a positive duration, got %q", a.SuppressWindow)
+		}
+	}
+
+	if a.LatencyBudget != "" {
+		if d, err := time.ParseDuration(a.LatencyBudget); err != nil || d <= 0 {
+			return fmt.Errorf("latency budget must be a positive duration, got %q", a.LatencyBudget)
+		}
+	}
+	if _, err := loadTimeZone(a.TimeZone); err != nil {
+		return err
+	}
+
+	if a.Script != nil {
+		if err := a.Script.ok(); err != nil {
+			return err
+		}
+	}
+
+	if a.Condition != "" {
+		cond, err := parseCondition(a.Condition)
+		if err != nil {
+			return err
+		}
+		for name := range cond.vars(map[string]bool{}) {
+			if countsUnread && (messageConditionVars[name] || bodyConditionVars[name]) {
+				return fmt.Errorf("condition of unread alert must not use variable %q, got %q", name, a.Condition)
+			}
+		}
+	}
+
+	if err := a.actionsOK(); err != nil {
+		return err
+	}
+	if err := a.failoverOK(); err != nil {
+		return err
+	}
+
+	if a.AttachImageMaxBytes < 0 || a.AttachImageMaxBytes > pushover.MessageMaxAttachmentByte {
+		return fmt.Errorf("attachment size limit must be between 0 and %d bytes, got %d",
+			pushover.MessageMaxAttachmentByte, a.AttachImageMaxBytes)
+	}
+	if a.MaxMessageBytes < 0 {
+		return fmt.Errorf("message size limit must not be negative, got %d", a.MaxMessageBytes)
 	}
 
 	return nil
 }
+
+// Recipients returns the distinct, non-empty Pushover recipient keys of the
+// Alert, starting with its PushoverTarget followed by its PushoverTargets.
+func (a Alert) Recipients() []string {
+	seen := map[string]bool{}
+	var recipients []string
+	for _, r := range append([]string{a.PushoverTarget}, a.PushoverTargets...) {
+		if r == "" || seen[r] {
+			continue
+		}
+		seen[r] = true
+		recipients = append(recipients, r)
+	}
+
+	return recipients
+}
+
+// attachmentMaxBytes returns the maximum size in bytes of an image attached
+// to the Alert's notification.
+func (a Alert) attachmentMaxBytes() int64 {
+	if a.AttachImageMaxBytes > 0 {
+		return a.AttachImageMaxBytes
+	}
+
+	return pushover.MessageMaxAttachmentByte
+}
+
+// messageMaxBytes returns the maximum size in bytes of a message matching
+// the Alert that is held in memory.
+func (a Alert) messageMaxBytes() int64 {
+	if a.MaxMessageBytes > 0 {
+		return a.MaxMessageBytes
+	}
+
+	return defaultMaxMessageBytes
+}
+
+// labelWatch returns the name of the label watched by the Alert and whether
+// the Alert is triggered by the label being added or removed. ok is false if
+// the Alert does not watch a label.
+func (a Alert) labelWatch() (label string, added bool, ok bool) {
+	switch {
+	case a.LabelAdded != "":
+		return a.LabelAdded, true, true
+	case a.LabelRemoved != "":
+		return a.LabelRemoved, false, true
+	}
+
+	return "", false, false
+}
+
+// criteria returns a description of the emails the Alert is triggered by.
+func (a Alert) criteria() string {
+	label, added, ok := a.labelWatch()
+	switch {
+	case ok && added:
+		return fmt.Sprintf(`that gained label "%s"`, label)
+	case ok:
+		return fmt.Sprintf(`that lost label "%s"`, label)
+	case a.UnreadAbove > 0:
+		return fmt.Sprintf(`unread with label "%s", more than %d`, a.unreadLabel(), a.UnreadAbove)
+	case a.Queries != nil:
+		return "matching queries " + a.Queries.describe() + a.signals().describe()
+	}
+
+	return fmt.Sprintf(`matching query "%s"`, a.GmailQuery) + a.signals().describe()
+}
+
+// gmailQueries returns the GmailQuery of the Alert, or every query of its
+// Queries. No queries are returned for an Alert watching a label or
+// counting unread emails.
+func (a Alert) gmailQueries() []string {
+	if a.Queries != nil {
+		return a.Queries.queries()
+	}
+	if a.GmailQuery == "" {
+		return nil
+	}
+
+	return []string{a.GmailQuery}
+}
+
+// signals returns the Signals narrowing down the emails matching the Alert's
+// GmailQuery.
+func (a Alert) signals() Signals {
+	return Signals{Category: a.Category, Important: a.Important, Folder: a.Folder, IncludeSpamTrash: a.IncludeSpamTrash}
+}
+
+// key returns the value identifying the Alert in persisted state, which is
+// its Name if set, its GmailQuery otherwise, or its watched label or its
+// Queries if it has no GmailQuery.
+func (a Alert) key() string {
+	if a.Name != "" {
+		return a.Name
+	}
+
+	if label, added, ok := a.labelWatch(); ok {
+		if added {
+			return "label added: " + label
+		}
+		return "label removed: " + label
+	}
+
+	if a.UnreadAbove > 0 {
+		return fmt.Sprintf("unread above %d: %s", a.UnreadAbove, a.unreadLabel())
+	}
+
+	if a.Queries != nil {
+		return a.Queries.describe()
+	}
+
+	return a.GmailQuery
+}
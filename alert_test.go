@@ -121,3 +121,39 @@ func TestDecodeAlerts(t *testing.T) {
 	}
 
 }
+
+func TestAlertRecipients(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		input gmailalert.Alert
+		want  []string
+	}{
+		"Single target is returned": {
+			input: gmailalert.Alert{PushoverTarget: "user1"},
+			want:  []string{"user1"},
+		},
+		"Target and additional targets are returned in order": {
+			input: gmailalert.Alert{PushoverTarget: "user1", PushoverTargets: []string{"user2", "group1"}},
+			want:  []string{"user1", "user2", "group1"},
+		},
+		"Empty and duplicate targets are dropped": {
+			input: gmailalert.Alert{PushoverTargets: []string{"user2", "", "user2"}},
+			want:  []string{"user2"},
+		},
+		"No targets returns nil": {
+			input: gmailalert.Alert{},
+			want:  nil,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got := tc.input.Recipients()
+
+			if !cmp.Equal(tc.want, got) {
+				t.Errorf("want != got\ndiff=%s", cmp.Diff(tc.want, got))
+			}
+		})
+	}
+}
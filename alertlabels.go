@@ -0,0 +1,106 @@
+package gmailalert
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// alertLabelKey matches the key of an alert's label, which must be usable as
+// a metric tag and a log field name.
+var alertLabelKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Route represents a routing rule adding Pushover recipients to every alert
+// whose labels match, so that, for example, every alert labeled with
+// "team": "billing" also notifies the billing team.
+type Route struct {
+	// The labels an alert must all have, with the same values, for the
+	// route to apply to it.
+	Match map[string]string `json:"match"`
+	// The Pushover recipients added to the alerts the route applies to.
+	PushoverTargets []string `json:"pushovertargets"`
+}
+
+// ok returns an error if the Route receiver matches no labels, has an
+// invalid label key, or has no recipients.
+func (r Route) ok() error {
+	if len(r.Match) == 0 || len(r.PushoverTargets) == 0 {
+		return fmt.Errorf("route must have non-empty match and pushovertargets, got %+v", r)
+	}
+
+	return checkLabelKeys(r.Match)
+}
+
+// matches reports whether the given Alert has every label of the Route
+// receiver.
+func (r Route) matches(alt Alert) bool {
+	for k, v := range r.Match {
+		if got, ok := alt.Labels[k]; !ok || got != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+// applyRoutes returns the given alerts with the recipients of every given
+// Route matching their labels added to their PushoverTargets. An error is
+// returned if any Route or the labels of any alert are invalid.
+func applyRoutes(alerts []Alert, routes []Route) ([]Alert, error) {
+	for _, r := range routes {
+		if err := r.ok(); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, alt := range alerts {
+		if err := checkLabelKeys(alt.Labels); err != nil {
+			return nil, fmt.Errorf("alert %q has invalid labels: %v", alt.key(), err)
+		}
+		for _, r := range routes {
+			if r.matches(alt) {
+				alt.PushoverTargets = append(append([]string(nil), alt.PushoverTargets...), r.PushoverTargets...)
+			}
+		}
+		alerts[i] = alt
+	}
+
+	return alerts, nil
+}
+
+// checkLabelKeys returns an error if any key of the given labels is not made
+// of letters, digits, and underscores, starting with a letter or underscore.
+func checkLabelKeys(labels map[string]string) error {
+	for k := range labels {
+		if !alertLabelKey.MatchString(k) {
+			return fmt.Errorf("label key must be made of letters, digits, and underscores, got %q", k)
+		}
+	}
+
+	return nil
+}
+
+// sortedLabelKeys returns the keys of the given labels in sorted order.
+func sortedLabelKeys(labels map[string]string) []string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// formatLabels returns the given labels as pairs of a key, the given
+// separator, and a value, sorted by key and joined by the given string, like
+// "team=billing,tier=1". An empty string is returned if there are no labels.
+func formatLabels(labels map[string]string, sep, join string) string {
+	keys := sortedLabelKeys(labels)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k+sep+labels[k])
+	}
+
+	return strings.Join(pairs, join)
+}
@@ -0,0 +1,104 @@
+package gmailalert
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestApplyRoutes(t *testing.T) {
+	t.Parallel()
+
+	routes := []Route{
+		{Match: map[string]string{"team": "billing"}, PushoverTargets: []string{"billing-group"}},
+		{Match: map[string]string{"team": "billing", "tier": "1"}, PushoverTargets: []string{"pager"}},
+	}
+
+	testCases := map[string]struct {
+		alerts      []Alert
+		routes      []Route
+		want        [][]string
+		errExpected bool
+	}{
+		"Recipients of every matching route are added": {
+			alerts: []Alert{
+				{Name: "a", PushoverTarget: "me", Labels: map[string]string{"team": "billing", "tier": "1"}},
+				{Name: "b", PushoverTarget: "me", Labels: map[string]string{"team": "billing"}},
+				{Name: "c", PushoverTarget: "me", Labels: map[string]string{"team": "ops"}},
+				{Name: "d", PushoverTarget: "me"},
+			},
+			routes: routes,
+			want:   [][]string{{"me", "billing-group", "pager"}, {"me", "billing-group"}, {"me"}, {"me"}},
+		},
+		"Route without match returns error": {
+			alerts:      []Alert{{Name: "a"}},
+			routes:      []Route{{PushoverTargets: []string{"pager"}}},
+			errExpected: true,
+		},
+		"Route without recipients returns error": {
+			alerts:      []Alert{{Name: "a"}},
+			routes:      []Route{{Match: map[string]string{"team": "billing"}}},
+			errExpected: true,
+		},
+		"Invalid label key returns error": {
+			alerts:      []Alert{{Name: "a", Labels: map[string]string{"team name": "billing"}}},
+			errExpected: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got, err := applyRoutes(tc.alerts, tc.routes)
+			errReceived := err != nil
+			if tc.errExpected != errReceived {
+				t.Fatalf("applyRoutes returned unexpected error status: %v", err)
+			}
+			if tc.errExpected {
+				return
+			}
+			var recipients [][]string
+			for _, alt := range got {
+				recipients = append(recipients, alt.Recipients())
+			}
+			if !cmp.Equal(tc.want, recipients) {
+				t.Error(cmp.Diff(tc.want, recipients))
+			}
+		})
+	}
+}
+
+func TestDecodeAlertsAppliesRoutes(t *testing.T) {
+	t.Parallel()
+
+	cfg := `{
+		"routes": [{"match": {"team": "billing"}, "pushovertargets": ["billing-group"]}],
+		"alerts": [{"name": "bills", "labels": {"team": "billing"}, "pushovertarget": "me"}],
+		"profiles": [{"name": "alice", "alerts": [{"name": "invoices", "labels": {"team": "billing"}}]}]
+	}`
+
+	got, err := DecodeAlerts(strings.NewReader(cfg))
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+
+	if want := []string{"billing-group"}; !cmp.Equal(want, got.Alerts[0].PushoverTargets) {
+		t.Error(cmp.Diff(want, got.Alerts[0].PushoverTargets))
+	}
+	if want := []string{"billing-group"}; !cmp.Equal(want, got.Profiles[0].Alerts[0].PushoverTargets) {
+		t.Error(cmp.Diff(want, got.Profiles[0].Alerts[0].PushoverTargets))
+	}
+}
+
+func TestFormatLabels(t *testing.T) {
+	t.Parallel()
+
+	labels := map[string]string{"tier": "1", "team": "billing"}
+
+	if got, want := formatLabels(labels, "=", ","), "team=billing,tier=1"; want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+	if got := formatLabels(nil, "=", ","); got != "" {
+		t.Errorf("want empty string for no labels, got %q", got)
+	}
+}
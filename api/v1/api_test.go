@@ -0,0 +1,138 @@
+package v1_test
+
+import (
+	"flag"
+	"fmt"
+	"go/importer"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "record the exported API of the package in testdata/api.golden")
+
+// goldenAPI is the file recording the exported API of version 1.
+var goldenAPI = filepath.Join("testdata", "api.golden")
+
+func TestExportedAPIIsCompatible(t *testing.T) {
+	t.Parallel()
+	if testing.Short() {
+		t.Skip("type-checking the package and its dependencies from source is slow")
+	}
+
+	got, err := exportedAPI("github.com/aculclasure/gmailalert/api/v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *update {
+		if err := os.WriteFile(goldenAPI, []byte(strings.Join(got, "\n")+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(goldenAPI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	current := make(map[string]bool, len(got))
+	for _, line := range got {
+		current[line] = true
+	}
+	recorded := make(map[string]bool, len(want))
+	for _, line := range want {
+		recorded[line] = true
+		if !current[line] {
+			t.Errorf("incompatible change to the v1 API, %q was removed or changed", line)
+		}
+	}
+	for _, line := range got {
+		if !recorded[line] {
+			t.Errorf("%q was added to the v1 API; record it with go test -update", line)
+		}
+	}
+}
+
+// exportedAPI type-checks the package with the given import path from
+// source and returns its exported API, one sorted line per function,
+// variable, constant, and type, and per exported field and method of its
+// types. Since the types of the package are aliases, the fields and methods
+// of the aliased types are part of its API. An error is returned if the
+// package cannot be type-checked.
+func exportedAPI(path string) ([]string, error) {
+	pkg, err := importer.ForCompiler(token.NewFileSet(), "source", nil).Import(path)
+	if err != nil {
+		return nil, fmt.Errorf("got error importing %s: %v", path, err)
+	}
+	qualifier := func(p *types.Package) string { return p.Name() }
+	typeString := func(t types.Type) string { return types.TypeString(t, qualifier) }
+
+	var lines []string
+	scope := pkg.Scope()
+	for _, name := range scope.Names() {
+		obj := scope.Lookup(name)
+		if !obj.Exported() {
+			continue
+		}
+		switch obj := obj.(type) {
+		case *types.Func:
+			lines = append(lines, "func "+name+strings.TrimPrefix(typeString(obj.Type()), "func"))
+		case *types.Var:
+			lines = append(lines, "var "+name+" "+typeString(obj.Type()))
+		case *types.Const:
+			lines = append(lines, "const "+name+" "+typeString(obj.Type()))
+		case *types.TypeName:
+			lines = append(lines, typeAPI(name, obj.Type(), typeString)...)
+		}
+	}
+	sort.Strings(lines)
+
+	return lines, nil
+}
+
+// typeAPI returns the lines of the exported API of the type with the given
+// name, as described by exportedAPI, formatting types with typeString.
+func typeAPI(name string, t types.Type, typeString func(types.Type) string) []string {
+	var lines []string
+	switch u := t.Underlying().(type) {
+	case *types.Struct:
+		lines = append(lines, "type "+name+" struct")
+		for i := 0; i < u.NumFields(); i++ {
+			if f := u.Field(i); f.Exported() {
+				lines = append(lines, fmt.Sprintf("type %s struct, field %s %s", name, f.Name(), typeString(f.Type())))
+			}
+		}
+	case *types.Interface:
+		lines = append(lines, "type "+name+" interface")
+		for i := 0; i < u.NumMethods(); i++ {
+			if m := u.Method(i); m.Exported() {
+				lines = append(lines, fmt.Sprintf("type %s interface, method %s%s", name, m.Name(), strings.TrimPrefix(typeString(m.Type()), "func")))
+			}
+		}
+		return lines
+	default:
+		lines = append(lines, "type "+name+" "+typeString(u))
+	}
+
+	// Methods promoted from embedded fields are included, and the methods
+	// of the pointer type only are marked as such.
+	values := types.NewMethodSet(t)
+	pointers := types.NewMethodSet(types.NewPointer(t))
+	for i := 0; i < pointers.Len(); i++ {
+		m := pointers.At(i).Obj()
+		if !m.Exported() {
+			continue
+		}
+		recv := name
+		if values.Lookup(m.Pkg(), m.Name()) == nil {
+			recv = "*" + name
+		}
+		lines = append(lines, fmt.Sprintf("method (%s) %s%s", recv, m.Name(), strings.TrimPrefix(typeString(m.Type()), "func")))
+	}
+
+	return lines
+}
@@ -0,0 +1,201 @@
+// Package v1 provides the stable version 1 API of gmailalert for programs
+// using it as a library: the interfaces for searching emails and sending
+// notifications, and the Alerter processing alerts with its options.
+//
+// The types of the package are aliases of those of the gmailalert package,
+// so values can be passed freely between the two. Unlike the rest of the
+// gmailalert package, which also backs the command line tool and whose
+// aliased types are deprecated in favor of this package, the API of this
+// package only changes in backwards-compatible ways within version 1.
+// Because of the aliases, the fields and methods of the aliased types are
+// part of that API, and the exported API, recorded in testdata/api.golden,
+// is checked by the tests of the package so that incompatible changes to
+// either package fail them.
+//
+// The alert configuration, gmailalert.Alert and gmailalert.AlertConfig,
+// gains fields with most features of the command line tool, so it is not
+// aliased and only its type names are part of version 1. Programs should
+// decode it with DecodeAlerts or set only the fields they need, and should
+// not rely on its other fields staying the same.
+package v1
+
+import (
+	"io"
+	"time"
+
+	"github.com/aculclasure/gmailalert"
+)
+
+// Message represents an email message matching a Gmail query.
+type Message = gmailalert.Message
+
+// Summary represents the outcome of a single Alerter run over a set of
+// alerts.
+type Summary = gmailalert.Summary
+
+// AlertResult represents the outcome of processing a single alert in an
+// Alerter run.
+type AlertResult = gmailalert.AlertResult
+
+// NotifyResult represents the details of a sent notification reported by
+// the notification provider.
+type NotifyResult = gmailalert.NotifyResult
+
+// NotifyQuota represents the message quota of a notification provider.
+type NotifyQuota = gmailalert.NotifyQuota
+
+// Matcher is the interface that wraps the Match method used by any types
+// implementing email searching behavior.
+type Matcher = gmailalert.Matcher
+
+// MessageMatcher is the interface that wraps the MatchMessages method used
+// by any Matchers that can return the matching emails as Messages rather
+// than only their IDs.
+type MessageMatcher = gmailalert.MessageMatcher
+
+// Fetcher is the interface that wraps the Fetch method used by any types
+// implementing retrieval of an email message's details.
+type Fetcher = gmailalert.Fetcher
+
+// RawFetcher is the interface that wraps the FetchRaw method used by any
+// types implementing retrieval of an email message in its raw form.
+type RawFetcher = gmailalert.RawFetcher
+
+// Notifier is the interface that wraps the Notify method used by any types
+// implementing notification behavior.
+type Notifier = gmailalert.Notifier
+
+// ResultNotifier is the interface that wraps the NotifyResult method used
+// by any types implementing notification behavior that can report the
+// details of a sent notification.
+type ResultNotifier = gmailalert.ResultNotifier
+
+// Reporter is the interface that wraps the Report method used by any types
+// consuming the Summary of an Alerter run.
+type Reporter = gmailalert.Reporter
+
+// Logger represents logger behavior that can be used by the Alerter.
+type Logger = gmailalert.Logger
+
+// Store is the interface that groups the methods used by the Alerter to
+// keep the notification history of alerts.
+type Store = gmailalert.Store
+
+// StoreTx represents the changes made to a Store by the evaluation of an
+// alert.
+type StoreTx = gmailalert.StoreTx
+
+// Hook represents functions called around the stages of the evaluation of
+// every alert.
+type Hook = gmailalert.Hook
+
+// Alerter processes alerts, searching for matching emails with its Matcher
+// and notifying them with its Notifier.
+type Alerter = gmailalert.Alerter
+
+// Option represents a functional option that can be passed to NewAlerter.
+type Option = gmailalert.AlerterOption
+
+// GmailClientConfig represents the configuration of a GmailClient.
+type GmailClientConfig = gmailalert.GmailClientConfig
+
+// GmailClient represents a Matcher, Fetcher, and RawFetcher searching a
+// Gmail mailbox.
+type GmailClient = gmailalert.GmailClient
+
+// PushoverClient represents a Notifier sending Pushover notifications.
+type PushoverClient = gmailalert.PushoverClient
+
+// PushoverClientOpt represents a functional option that can be passed to
+// NewPushoverClient.
+type PushoverClientOpt = gmailalert.PushoverClientOpt
+
+// State represents a Store persisting the notification history of alerts
+// as JSON in a local file.
+type State = gmailalert.State
+
+// Compile-time checks that the implementations provided by the package
+// satisfy its interfaces.
+var (
+	_ Matcher        = GmailClient{}
+	_ Fetcher        = GmailClient{}
+	_ RawFetcher     = GmailClient{}
+	_ Notifier       = PushoverClient{}
+	_ ResultNotifier = PushoverClient{}
+	_ Store          = (*State)(nil)
+)
+
+// NewAlerter accepts a Matcher, a Notifier, and a slice of Options and
+// returns a new Alerter. An error is returned if the Matcher or Notifier
+// are nil or the options are invalid.
+func NewAlerter(m Matcher, n Notifier, opts ...Option) (Alerter, error) {
+	return gmailalert.NewAlerter(m, n, opts...)
+}
+
+// DecodeAlerts decodes a JSON alerts configuration from the given
+// io.Reader and returns it. An error is returned if the configuration
+// cannot be decoded or is invalid.
+func DecodeAlerts(r io.Reader) (gmailalert.AlertConfig, error) {
+	return gmailalert.DecodeAlerts(r)
+}
+
+// NewGmailClient accepts a GmailClientConfig and returns a new GmailClient.
+// An error is returned if the configuration is invalid.
+func NewGmailClient(cfg GmailClientConfig) (*GmailClient, error) {
+	return gmailalert.NewGmailClient(cfg)
+}
+
+// NewPushoverClient accepts a Pushover app token and a slice of
+// PushoverClientOpts and returns a new PushoverClient. An error is returned
+// if the token is empty.
+func NewPushoverClient(token string, opts ...PushoverClientOpt) (PushoverClient, error) {
+	return gmailalert.NewPushoverClient(token, opts...)
+}
+
+// LoadState accepts the name of a JSON state file and returns a State
+// populated from it. An error is returned if the file exists but cannot be
+// read or decoded.
+func LoadState(file string) (*State, error) {
+	return gmailalert.LoadState(file)
+}
+
+// WithLogger returns an Option wiring the given Logger to an Alerter.
+func WithLogger(l Logger) Option {
+	return gmailalert.WithAlerterLogger(l)
+}
+
+// WithState returns an Option wiring the given Store to an Alerter, which
+// enforces the repeat interval of alerts with it.
+func WithState(s Store) Option {
+	return gmailalert.WithAlerterState(s)
+}
+
+// WithReporter returns an Option adding the given Reporter to the Reporters
+// an Alerter passes the Summary of every run to.
+func WithReporter(r Reporter) Option {
+	return gmailalert.WithAlerterReporter(r)
+}
+
+// WithHook returns an Option adding the given Hook to the Hooks an Alerter
+// calls around the stages of the evaluation of every alert.
+func WithHook(h Hook) Option {
+	return gmailalert.WithAlerterHook(h)
+}
+
+// WithConcurrency returns an Option setting the maximum number of alerts an
+// Alerter evaluates at the same time.
+func WithConcurrency(n int) Option {
+	return gmailalert.WithAlerterConcurrency(n)
+}
+
+// WithRetries returns an Option setting the number of times an Alerter
+// sends a notification again when it could not be sent.
+func WithRetries(n int) Option {
+	return gmailalert.WithAlerterRetries(n)
+}
+
+// WithClock returns an Option making an Alerter evaluate alerts against the
+// time returned by the given function.
+func WithClock(now func() time.Time) Option {
+	return gmailalert.WithAlerterClock(now)
+}
@@ -0,0 +1,56 @@
+package v1_test
+
+import (
+	"io"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/aculclasure/gmailalert"
+	v1 "github.com/aculclasure/gmailalert/api/v1"
+)
+
+// fakeMatcher represents a v1.Matcher returning the same messages for every
+// query.
+type fakeMatcher []string
+
+// Match returns the message IDs of the receiver f.
+func (f fakeMatcher) Match(string) ([]string, error) {
+	return f, nil
+}
+
+// fakeNotifier represents a v1.Notifier recording the alerts it notifies.
+type fakeNotifier struct {
+	alerts []gmailalert.Alert
+}
+
+// Notify records the given Alert.
+func (f *fakeNotifier) Notify(alt gmailalert.Alert) error {
+	f.alerts = append(f.alerts, alt)
+	return nil
+}
+
+func TestAlerterRunsAlertsThroughStableAPI(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := v1.DecodeAlerts(strings.NewReader(`{"alerts": [{"name": "bills", "gmailquery": "from:bank", "pushovertarget": "u1", "pushovertitle": "Bill due"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifier := &fakeNotifier{}
+	a, err := v1.NewAlerter(fakeMatcher{"1"}, notifier, v1.WithLogger(log.New(io.Discard, "", 0)), v1.WithConcurrency(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	summary, err := a.Run(cfg.Alerts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if summary.Notified() != 1 || len(notifier.alerts) != 1 || notifier.alerts[0].PushoverTitle != "Bill due" {
+		t.Errorf("want alert \"bills\" notified, got summary %+v and notified alerts %+v", summary, notifier.alerts)
+	}
+	// Values of the stable API are values of the gmailalert package.
+	var _ gmailalert.Summary = summary
+}
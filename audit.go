@@ -0,0 +1,153 @@
+package gmailalert
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuditConfig represents the configuration of the audit log of sent
+// notifications.
+type AuditConfig struct {
+	// The file to append audit records to.
+	File string `json:"file"`
+	// The size in bytes the audit log may grow to before it is rotated. If
+	// zero, the audit log is never rotated.
+	MaxBytes int64 `json:"maxbytes"`
+	// The number of rotated audit logs to keep. Rotated logs are named by
+	// appending ".1", ".2", etc. to the file name, with ".1" the most recent.
+	MaxBackups int `json:"maxbackups"`
+}
+
+// AuditRecord represents a single notification recorded in the audit log. A
+// notification sent to several recipients is recorded once, with the
+// recipients and the provider's request IDs comma-separated.
+type AuditRecord struct {
+	Time       time.Time `json:"time"`
+	EvalID     string    `json:"evalid"`
+	Alert      string    `json:"alert"`
+	Target     string    `json:"target"`
+	Title      string    `json:"title"`
+	Message    string    `json:"message"`
+	ResponseID string    `json:"responseid,omitempty"`
+	DedupKey   string    `json:"dedupkey,omitempty"`
+	Channel    string    `json:"channel,omitempty"`
+}
+
+// AuditLog is an append-only log of sent notifications written as one JSON
+// object per line, separate from the debug logs. It is safe for concurrent
+// use by multiple goroutines.
+type AuditLog struct {
+	cfg AuditConfig
+	mtx sync.Mutex
+}
+
+// NewAuditLog accepts an AuditConfig and returns a new AuditLog. An error is
+// returned if the file name is empty or the rotation settings are negative.
+func NewAuditLog(cfg AuditConfig) (*AuditLog, error) {
+	if cfg.File == "" {
+		return nil, errors.New("audit log file name must not be empty")
+	}
+	if cfg.MaxBytes < 0 || cfg.MaxBackups < 0 {
+		return nil, errors.New("audit log max bytes and max backups must not be negative")
+	}
+
+	return &AuditLog{cfg: cfg}, nil
+}
+
+// Write appends the given AuditRecord to the audit log, rotating the log
+// first if the record would grow it beyond its maximum size. An error is
+// returned if the record cannot be encoded or written.
+func (l *AuditLog) Write(rec AuditRecord) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("got error json-encoding audit record: %v", err)
+	}
+	line = append(line, '\n')
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if err := l.rotate(int64(len(line))); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(l.cfg.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("got error opening audit log %s: %v", l.cfg.File, err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(line); err != nil {
+		return fmt.Errorf("got error writing audit log %s: %v", l.cfg.File, err)
+	}
+
+	return nil
+}
+
+// Hook returns a Hook that writes an AuditRecord to the audit log for every
+// notification successfully sent by an Alerter.
+func (l *AuditLog) Hook() Hook {
+	return Hook{
+		AfterNotify: func(alt Alert, res NotifyResult, err error) error {
+			if err != nil {
+				return nil
+			}
+			if err := l.Write(AuditRecord{
+				Time:       time.Now(),
+				EvalID:     alt.EvalID,
+				Alert:      alt.key(),
+				Target:     strings.Join(alt.Recipients(), ","),
+				Title:      alt.PushoverTitle,
+				Message:    alt.PushoverMsg,
+				ResponseID: res.RequestID,
+				DedupKey:   alt.DedupKey,
+				Channel:    res.Channel,
+			}); err != nil {
+				return fmt.Errorf("got error writing audit record: %v", err)
+			}
+			return nil
+		},
+	}
+}
+
+// rotate renames the audit log to its first backup, shifting older backups
+// along and removing the oldest, if appending n bytes would grow the audit
+// log beyond its maximum size.
+func (l *AuditLog) rotate(n int64) error {
+	if l.cfg.MaxBytes == 0 {
+		return nil
+	}
+
+	fi, err := os.Stat(l.cfg.File)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("got error checking audit log %s: %v", l.cfg.File, err)
+	}
+	if fi.Size()+n <= l.cfg.MaxBytes {
+		return nil
+	}
+
+	if l.cfg.MaxBackups == 0 {
+		return os.Remove(l.cfg.File)
+	}
+
+	oldest := fmt.Sprintf("%s.%d", l.cfg.File, l.cfg.MaxBackups)
+	if err := os.Remove(oldest); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("got error removing rotated audit log %s: %v", oldest, err)
+	}
+	for i := l.cfg.MaxBackups - 1; i > 0; i-- {
+		from, to := fmt.Sprintf("%s.%d", l.cfg.File, i), fmt.Sprintf("%s.%d", l.cfg.File, i+1)
+		if err := os.Rename(from, to); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("got error rotating audit log %s: %v", from, err)
+		}
+	}
+
+	return os.Rename(l.cfg.File, l.cfg.File+".1")
+}
@@ -0,0 +1,126 @@
+package gmailalert_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aculclasure/gmailalert"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewAuditLog(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		input       gmailalert.AuditConfig
+		errExpected bool
+	}{
+		"Empty file name returns an error": {
+			input:       gmailalert.AuditConfig{},
+			errExpected: true,
+		},
+		"Negative max bytes returns an error": {
+			input:       gmailalert.AuditConfig{File: "audit.jsonl", MaxBytes: -1},
+			errExpected: true,
+		},
+		"Valid config returns no error": {
+			input:       gmailalert.AuditConfig{File: "audit.jsonl", MaxBytes: 1024, MaxBackups: 2},
+			errExpected: false,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := gmailalert.NewAuditLog(tc.input)
+			errReceived := err != nil
+
+			if tc.errExpected != errReceived {
+				t.Errorf("got unexpected error status %t", errReceived)
+			}
+		})
+	}
+}
+
+func TestAuditLogAppendsRecords(t *testing.T) {
+	t.Parallel()
+
+	file := filepath.Join(t.TempDir(), "audit.jsonl")
+	auditLog, err := gmailalert.NewAuditLog(gmailalert.AuditConfig{File: file})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []gmailalert.AuditRecord{
+		{Alert: "bills", Target: "user1", Title: "Bill Due!", Message: "Found 1 emails", ResponseID: "req-1"},
+		{Alert: "zoom", Target: "user2", Title: "Zoom!", Message: "Found 2 emails"},
+	}
+	for _, rec := range want {
+		if err := auditLog.Write(rec); err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+	}
+
+	got := readAuditRecords(t, file)
+	if !cmp.Equal(want, got) {
+		t.Errorf("want != got\ndiff=%s", cmp.Diff(want, got))
+	}
+}
+
+func TestAuditLogRotatesWhenFull(t *testing.T) {
+	t.Parallel()
+
+	file := filepath.Join(t.TempDir(), "audit.jsonl")
+	auditLog, err := gmailalert.NewAuditLog(gmailalert.AuditConfig{File: file, MaxBytes: 150, MaxBackups: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, alert := range []string{"first", "second", "third"} {
+		if err := auditLog.Write(gmailalert.AuditRecord{Alert: alert}); err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+	}
+
+	current := readAuditRecords(t, file)
+	if len(current) != 1 || current[0].Alert != "third" {
+		t.Errorf("want current audit log to hold the third record, got %+v", current)
+	}
+	backup := readAuditRecords(t, file+".1")
+	if len(backup) != 1 || backup[0].Alert != "second" {
+		t.Errorf("want rotated audit log to hold the second record, got %+v", backup)
+	}
+	if _, err := os.Stat(file + ".2"); err == nil {
+		t.Errorf("want at most 1 rotated audit log, found %s", file+".2")
+	}
+}
+
+// readAuditRecords decodes every line of the given audit log file into an
+// AuditRecord and returns them. It crashes the calling test if the file
+// cannot be read or decoded.
+func readAuditRecords(t *testing.T, file string) []gmailalert.AuditRecord {
+	t.Helper()
+
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var recs []gmailalert.AuditRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec gmailalert.AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatal(err)
+		}
+		recs = append(recs, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	return recs
+}
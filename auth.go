@@ -0,0 +1,95 @@
+package gmailalert
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/gmail/v1"
+)
+
+// authCLI accepts the command line flags of the "auth" subcommand, which
+// creates the Gmail OAuth2 token file without needing a browser, a terminal,
+// or a redirect server on the machine running gmailalert, like in a
+// container. Without the "-code" flag, it prints the URL for authorizing
+// gmailalert to the logs. Once gmailalert is authorized, the browser is
+// redirected to a URL containing a "code" query parameter, whose value is
+// passed with the "-code" flag to exchange it for a token, which is saved
+// into the token file. An error is returned if the flags are invalid, the
+// credentials file cannot be read, or the code cannot be exchanged or saved.
+// With the "-profile" flag, the credentials and token files of the named
+// profile in the alert configuration are used. With the "-modify" flag, the
+// token is authorized to modify the mailbox and saved into the modify token
+// file instead, so that the token file stays read-only.
+func authCLI(args []string) error {
+	var app cliEnv
+	var code string
+	var modify bool
+
+	fs := app.flagSet("auth")
+	fs.StringVar(
+		&code,
+		"code",
+		"",
+		"the authorization code to exchange for a token (prints the authorization url if empty)")
+	fs.BoolVar(
+		&modify,
+		"modify",
+		false,
+		"authorize modifying the mailbox, for mailbox actions, and save the token into -modify-token-file")
+	if err := app.parse(fs, args); err != nil {
+		return err
+	}
+	if app.profile != "" {
+		var err error
+		if app, _, err = app.profileConfig(); err != nil {
+			return err
+		}
+	}
+
+	tokenFile, scope := app.tokenFile, ""
+	if modify {
+		tokenFile, scope = app.modifyTokenFile, gmail.GmailModifyScope
+	}
+	oauth := &gmailOAuth2{
+		GmailClientConfig: GmailClientConfig{
+			CredentialsFile: app.credsFile,
+			TokenFile:       tokenFile,
+			Scope:           scope,
+			Logger:          app.debugLogger(),
+		},
+	}
+	if err := oauth.initializeConfig(); err != nil {
+		return fmt.Errorf("got error initializing gmail oauth: %s", err)
+	}
+
+	return authorize(oauth.oauthCfg, code, tokenFile, os.Stderr)
+}
+
+// authorize accepts an oauth2.Config, an authorization code, a token file
+// name, and an io.Writer. If the code is empty, the URL for authorizing
+// gmailalert is written to the io.Writer. Otherwise, the code is exchanged
+// for a token, which is saved into the token file. An error is returned if
+// the code cannot be exchanged or the token cannot be saved.
+func authorize(cfg *oauth2.Config, code, tokenFile string, w io.Writer) error {
+	if code == "" {
+		authURL := cfg.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
+		fmt.Fprintf(w, "Go to the following link in your browser, authorize gmailalert, "+
+			"and run \"gmailalert auth -code <code>\" with the code query parameter of the page you are redirected to:\n%s\n", authURL)
+		return nil
+	}
+
+	tok, err := cfg.Exchange(context.Background(), code)
+	if err != nil {
+		return fmt.Errorf("got error exchanging authorization code for a gmail oauth2 token: %v", err)
+	}
+
+	if err := saveToken(tokenFile, tok, cfg.ClientID); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Saved gmail oauth2 token into %s\n", tokenFile)
+
+	return nil
+}
@@ -0,0 +1,29 @@
+package gmailalert
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestAuthorizeWithoutCodePrintsAuthURL(t *testing.T) {
+	t.Parallel()
+
+	cfg := &oauth2.Config{
+		ClientID:    "gopher-client",
+		Endpoint:    oauth2.Endpoint{AuthURL: "https://accounts.example.com/auth"},
+		RedirectURL: "http://localhost:9999",
+		Scopes:      []string{"gmail.readonly"},
+	}
+	out := &bytes.Buffer{}
+
+	if err := authorize(cfg, "", "token.json", out); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+
+	if !strings.Contains(out.String(), "https://accounts.example.com/auth?access_type=offline&client_id=gopher-client") {
+		t.Errorf("want output to contain the authorization url, got:\n%s", out.String())
+	}
+}
@@ -0,0 +1,193 @@
+package gmailalert
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// The formats of the requests an Automation posts.
+const (
+	// AutomationFlat posts a flat JSON object per alert, as expected by
+	// Zapier catch hooks and similar no-code tools.
+	AutomationFlat = "flat"
+	// AutomationIFTTT posts the "value1", "value2", and "value3" fields
+	// expected by IFTTT Webhooks.
+	AutomationIFTTT = "ifttt"
+)
+
+// AutomationConfig represents the configuration of the requests posted to a
+// no-code automation service, like IFTTT Webhooks or a Zapier catch hook,
+// for every notified alert.
+type AutomationConfig struct {
+	// The URL to post to, like
+	// "https://maker.ifttt.com/trigger/gmail_alert/with/key/<key>" or
+	// "https://hooks.zapier.com/hooks/catch/<id>/<hook>/".
+	URL string `json:"url"`
+	// The format of the posted JSON, either "ifttt" or "flat". If empty,
+	// "flat" is used.
+	Format string `json:"format"`
+	// The timeout for each request, as a duration like "10s". Defaults to
+	// 10s.
+	Timeout string `json:"timeout"`
+	// The number of times a failed request is retried. Defaults to 0.
+	Retries int `json:"retries"`
+	// What is posted about alerts, either "full" for their names and
+	// senders or "hashed" for hashes of their names and no senders. If
+	// empty, "full" is used.
+	Privacy string `json:"privacy"`
+	// The optional URL of the proxy or SSH tunnel the requests are sent
+	// through. If empty, the proxy named by the environment is used, if any.
+	Proxy string `json:"proxy"`
+}
+
+// automationEvent represents the flat JSON body posted for a notified
+// alert.
+type automationEvent struct {
+	Event     string            `json:"event"`
+	Alert     string            `json:"alert"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Matches   int               `json:"matches"`
+	Estimated int               `json:"estimated,omitempty"`
+	Senders   string            `json:"senders,omitempty"`
+	EvalID    string            `json:"evalid"`
+	RunID     string            `json:"runid"`
+	Time      time.Time         `json:"time"`
+}
+
+// iftttEvent represents the JSON body posted for a notified alert to IFTTT
+// Webhooks, which only passes on three values.
+type iftttEvent struct {
+	Value1 string `json:"value1"`
+	Value2 string `json:"value2"`
+	Value3 string `json:"value3"`
+}
+
+// Automation is a Reporter that posts every notified alert of a run to a
+// no-code automation service, like IFTTT Webhooks or a Zapier catch hook, so
+// that alerts can start other automations without writing code.
+type Automation struct {
+	cfg     AutomationConfig
+	client  *http.Client
+	backoff time.Duration
+}
+
+// NewAutomation accepts an AutomationConfig and returns a new Automation. An
+// error is returned if the URL is empty, the format, privacy mode, timeout,
+// or proxy is invalid, or the number of retries is negative.
+func NewAutomation(cfg AutomationConfig) (*Automation, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("automation url must not be empty")
+	}
+	if cfg.Format != "" && cfg.Format != AutomationFlat && cfg.Format != AutomationIFTTT {
+		return nil, fmt.Errorf("automation format must be %q or %q, got %q", AutomationFlat, AutomationIFTTT, cfg.Format)
+	}
+	if cfg.Retries < 0 {
+		return nil, fmt.Errorf("automation retries must not be negative, got %d", cfg.Retries)
+	}
+	if err := privacyOK("automation", cfg.Privacy); err != nil {
+		return nil, err
+	}
+	timeout, err := parsePositiveDuration("automation timeout", cfg.Timeout, 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	client, err := adapterHTTPClient(cfg.Proxy, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("got error configuring automation proxy: %v", err)
+	}
+
+	return &Automation{cfg: cfg, client: client, backoff: time.Second}, nil
+}
+
+// Report accepts the Summary of a run and posts every notified alert in it,
+// retrying each post with a linear backoff if the request fails or the
+// response status is not 2xx. An error is returned for the first alert whose
+// posts all failed, after every alert was posted.
+func (a *Automation) Report(s Summary) error {
+	var firstErr error
+	for _, r := range s.Results {
+		if !r.Notified {
+			continue
+		}
+		body, err := json.Marshal(a.event(s, r))
+		if err != nil {
+			return fmt.Errorf("got error json-encoding automation body: %v", err)
+		}
+		if err := a.postWithRetries(body); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("got error posting alert %q to automation url after %d attempts: %v",
+				r.Alert, a.cfg.Retries+1, err)
+		}
+	}
+
+	return firstErr
+}
+
+// event returns the JSON body posted for the given notified AlertResult of
+// the given Summary, in the format of the Automation receiver a.
+func (a *Automation) event(s Summary, r AlertResult) interface{} {
+	name, senders := r.Alert, strings.Join(r.Senders, ", ")
+	if a.cfg.Privacy == PrivacyHashed {
+		name, senders = contentHash(r.Alert), ""
+	}
+	if a.cfg.Format == AutomationIFTTT {
+		found := r.Matches
+		if r.Estimated > 0 {
+			found = r.Estimated
+		}
+		return iftttEvent{
+			Value1: name,
+			Value2: foundText(found, r.Estimated > 0),
+			Value3: senders,
+		}
+	}
+
+	return automationEvent{
+		Event:     "notified",
+		Alert:     name,
+		Labels:    r.Labels,
+		Matches:   r.Matches,
+		Estimated: r.Estimated,
+		Senders:   senders,
+		EvalID:    r.EvalID,
+		RunID:     s.RunID,
+		Time:      s.Started,
+	}
+}
+
+// postWithRetries posts the given JSON body to the automation URL, retrying
+// with a linear backoff. The error of the last attempt is returned if every
+// attempt fails.
+func (a *Automation) postWithRetries(body []byte) error {
+	var err error
+	for attempt := 0; attempt <= a.cfg.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * a.backoff)
+		}
+		if err = a.post(body); err == nil {
+			return nil
+		}
+	}
+
+	return err
+}
+
+// post sends a single HTTP POST request with the given JSON body to the
+// automation URL. An error is returned if the request fails or the response
+// status is not 2xx.
+func (a *Automation) post(body []byte) error {
+	resp, err := a.client.Post(a.cfg.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("got unexpected response status %s", resp.Status)
+	}
+
+	return nil
+}
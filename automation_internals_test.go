@@ -0,0 +1,157 @@
+package gmailalert
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewAutomation(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		input       AutomationConfig
+		errExpected bool
+	}{
+		"Empty url returns an error": {
+			input:       AutomationConfig{},
+			errExpected: true,
+		},
+		"Unknown format returns an error": {
+			input:       AutomationConfig{URL: "http://localhost", Format: "zapier"},
+			errExpected: true,
+		},
+		"Negative retries returns an error": {
+			input:       AutomationConfig{URL: "http://localhost", Retries: -1},
+			errExpected: true,
+		},
+		"Invalid timeout returns an error": {
+			input:       AutomationConfig{URL: "http://localhost", Timeout: "soon"},
+			errExpected: true,
+		},
+		"Valid config returns no error": {
+			input: AutomationConfig{URL: "http://localhost", Format: AutomationIFTTT, Timeout: "5s", Retries: 2},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewAutomation(tc.input)
+			errReceived := err != nil
+
+			if tc.errExpected != errReceived {
+				t.Errorf("NewAutomation(%+v) returned unexpected error status: %v", tc.input, err)
+			}
+		})
+	}
+}
+
+func TestAutomationReportPostsNotifiedAlerts(t *testing.T) {
+	t.Parallel()
+
+	started := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	summary := Summary{
+		RunID:   "run1",
+		Started: started,
+		Results: []AlertResult{
+			{Alert: "bills", EvalID: "run1.0", Matches: 2, Senders: []string{"bank@example.com", "card@example.com"}, Notified: true},
+			{Alert: "newsletters", EvalID: "run1.1", Matches: 100, Estimated: 1240, Notified: true},
+			{Alert: "orders", EvalID: "run1.2", Err: errors.New("quota exceeded")},
+			{Alert: "boss", EvalID: "run1.3", Matches: 1, Suppressed: true},
+		},
+	}
+	testCases := map[string]struct {
+		cfg  AutomationConfig
+		want []map[string]interface{}
+	}{
+		"IFTTT values": {
+			cfg: AutomationConfig{Format: AutomationIFTTT},
+			want: []map[string]interface{}{
+				{"value1": "bills", "value2": "2", "value3": "bank@example.com, card@example.com"},
+				{"value1": "newsletters", "value2": "about 1,240", "value3": ""},
+			},
+		},
+		"Flat JSON": {
+			cfg: AutomationConfig{},
+			want: []map[string]interface{}{
+				{"event": "notified", "alert": "bills", "matches": 2.0, "senders": "bank@example.com, card@example.com",
+					"evalid": "run1.0", "runid": "run1", "time": "2023-03-01T12:00:00Z"},
+				{"event": "notified", "alert": "newsletters", "matches": 100.0, "estimated": 1240.0,
+					"evalid": "run1.1", "runid": "run1", "time": "2023-03-01T12:00:00Z"},
+			},
+		},
+		"Hashed IFTTT values": {
+			cfg: AutomationConfig{Format: AutomationIFTTT, Privacy: PrivacyHashed},
+			want: []map[string]interface{}{
+				{"value1": contentHash("bills"), "value2": "2", "value3": ""},
+				{"value1": contentHash("newsletters"), "value2": "about 1,240", "value3": ""},
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var mtx sync.Mutex
+			var got []map[string]interface{}
+			svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body map[string]interface{}
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				mtx.Lock()
+				got = append(got, body)
+				mtx.Unlock()
+			}))
+			defer svr.Close()
+			tc.cfg.URL = svr.URL
+			a, err := NewAutomation(tc.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := a.Report(summary); err != nil {
+				t.Fatal(err)
+			}
+
+			if !cmp.Equal(tc.want, got) {
+				t.Errorf("want != got\ndiff=%s", cmp.Diff(tc.want, got))
+			}
+		})
+	}
+}
+
+func TestAutomationReportRetriesFailedPosts(t *testing.T) {
+	t.Parallel()
+
+	var mtx sync.Mutex
+	posts := 0
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		posts++
+		if posts == 1 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+		}
+	}))
+	defer svr.Close()
+	a, err := NewAutomation(AutomationConfig{URL: svr.URL, Retries: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.backoff = time.Millisecond
+
+	if err := a.Report(Summary{Results: []AlertResult{{Alert: "bills", Notified: true}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if posts != 2 {
+		t.Errorf("want the failed post retried once, got %d posts", posts)
+	}
+}
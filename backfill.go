@@ -0,0 +1,197 @@
+package gmailalert
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// backfillOptions represents the settings for backfilling the history of an
+// alert.
+type backfillOptions struct {
+	// The start of the backfilled period.
+	since time.Time
+	// The end of the backfilled period.
+	until time.Time
+	// The length of the periods searched one at a time.
+	chunk time.Duration
+	// Whether the sender of every matching email is fetched.
+	senders bool
+}
+
+// backfillCLI accepts the command line flags of the "backfill" subcommand,
+// which searches the mailbox for the emails matching the alert named by the
+// "-alert" flag since the date given by the "-since" flag, one chunk of time
+// at a time, and records what it finds in the history file and as the
+// baseline of the alert in the state file, without sending any
+// notifications. An error is returned if the flags are invalid, the alert
+// configuration, history, or state cannot be loaded, or the backfill fails.
+func backfillCLI(args []string) error {
+	var app cliEnv
+	var alertName, since string
+	opts := backfillOptions{until: time.Now()}
+
+	fs := app.flagSet("backfill")
+	fs.StringVar(
+		&alertName,
+		"alert",
+		"",
+		"the name (or gmail query) of the alert to backfill the history of")
+	fs.StringVar(
+		&since,
+		"since",
+		"",
+		"the date to backfill the history from, like 2023-01-01")
+	fs.DurationVar(
+		&opts.chunk,
+		"chunk",
+		30*24*time.Hour,
+		"the length of the periods of time searched one at a time")
+	fs.BoolVar(
+		&opts.senders,
+		"senders",
+		false,
+		"fetch the sender of every matching email for statistics, with one gmail api request per email")
+	if err := app.parse(fs, args); err != nil {
+		return err
+	}
+	if alertName == "" || since == "" || app.historyFile == "" {
+		fs.Usage()
+		return errors.New(`command line flags "-alert" "-since" "-history-file" must be non-empty`)
+	}
+	app, alertCfg, err := app.profileConfig()
+	if err != nil {
+		return err
+	}
+	selected, err := selectAlerts(alertCfg.Alerts, alertName)
+	if err != nil {
+		return err
+	}
+	loc, err := loadTimeZone(alertCfg.TimeZone)
+	if err != nil {
+		return err
+	}
+	alerter := Alerter{Location: loc}
+	opts.since, err = time.ParseInLocation("2006-01-02", since, alerter.location(selected[0]))
+	if err != nil {
+		return fmt.Errorf("got error parsing -since date %q: %v", since, err)
+	}
+	history, err := NewHistory(app.historyFile)
+	if err != nil {
+		return err
+	}
+	state, err := app.openState(alertCfg.State)
+	if err != nil {
+		return err
+	}
+
+	debugLogger := app.debugLogger()
+	gmailClient, err := app.gmailClient(debugLogger, alertCfg)
+	if err != nil {
+		return err
+	}
+	alerter.Matcher, alerter.Logger = gmailClient, debugLogger
+	if state != nil {
+		alerter.State = state
+	}
+
+	if err := backfill(alerter, selected[0], opts, history, os.Stdout); err != nil {
+		return err
+	}
+	if state != nil {
+		return state.Save()
+	}
+
+	return nil
+}
+
+// backfill accepts an Alerter, an Alert, backfillOptions, a History, and an
+// io.Writer, and searches for the emails matching the Alert's query in
+// consecutive chunks of the backfilled period, appending a HistoryRecord
+// for each chunk to the History and reporting each chunk to the io.Writer.
+// If the Alerter has a State and no emails are recorded for the Alert yet,
+// the emails found are recorded as the Alert's baseline, without changing
+// when it was last notified. An error is returned if the backfillOptions are
+// invalid, the Alert has no query, like when it watches a label, or any
+// search fails.
+func backfill(a Alerter, alt Alert, opts backfillOptions, h *History, w io.Writer) error {
+	if len(alt.gmailQueries()) == 0 {
+		return fmt.Errorf("alert %q has no gmail query to backfill", alt.key())
+	}
+	if opts.chunk <= 0 {
+		return fmt.Errorf("backfill chunk must be a positive duration, got %s", opts.chunk)
+	}
+	if !opts.since.Before(opts.until) {
+		return fmt.Errorf("backfill start %s must be in the past", opts.since.Format("2006-01-02"))
+	}
+	fetcher, ok := a.Matcher.(Fetcher)
+	if opts.senders && !ok {
+		return fmt.Errorf("matcher %T must implement Fetcher to fetch senders", a.Matcher)
+	}
+
+	var ids []string
+	seen := map[string]bool{}
+	for start := opts.since; start.Before(opts.until); start = start.Add(opts.chunk) {
+		end := start.Add(opts.chunk)
+		if end.After(opts.until) {
+			end = opts.until
+		}
+
+		matches, err := matchAlert(a.Matcher, chunkAlert(alt, start, end))
+		if err != nil {
+			return fmt.Errorf("got error searching for emails from %s to %s: %w",
+				start.Format(time.RFC3339), end.Format(time.RFC3339), err)
+		}
+		rec := HistoryRecord{Time: end, Alert: alt.key(), Matches: len(matches), Backfill: true}
+		for _, m := range matches {
+			if opts.senders {
+				msg, err := fetcher.Fetch(m.ID)
+				if err != nil {
+					return fmt.Errorf("got error fetching email %s: %w", m.ID, err)
+				}
+				rec.Senders = append(rec.Senders, msg.From)
+			}
+			if !seen[m.ID] {
+				seen[m.ID] = true
+				ids = append(ids, m.ID)
+			}
+		}
+		if err := h.Append(rec); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s to %s: %d emails\n", start.Format("2006-01-02"), end.Format("2006-01-02"), len(matches))
+	}
+
+	if a.State == nil {
+		return nil
+	}
+	tx := a.State.Begin()
+	st := tx.Get(alt.key())
+	if len(st.MessageIDs) > 0 {
+		tx.Rollback()
+		fmt.Fprintf(w, "kept the emails already recorded for alert %q\n", alt.key())
+		return nil
+	}
+	st.MessageIDs = ids
+	tx.Set(alt.key(), st)
+
+	return tx.Commit()
+}
+
+// chunkAlert returns the given Alert with its queries restricted to the
+// emails received from start until end.
+func chunkAlert(alt Alert, start, end time.Time) Alert {
+	bound := func(query string) string {
+		return fmt.Sprintf("(%s) after:%d before:%d", query, start.Unix(), end.Unix())
+	}
+	if alt.Queries != nil {
+		q := alt.Queries.mapQueries(bound)
+		alt.Queries = &q
+		return alt
+	}
+	alt.GmailQuery = bound(alt.GmailQuery)
+
+	return alt
+}
@@ -0,0 +1,139 @@
+package gmailalert
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBackfill(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	history, err := NewHistory(filepath.Join(dir, "history.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := LoadState(filepath.Join(dir, "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := fakePreviewFetcher{
+		matches: []Message{{ID: "id0"}, {ID: "id1"}},
+		msgs: map[string]Message{
+			"id0": {ID: "id0", From: "billing@bank.com"},
+			"id1": {ID: "id1", From: "alerts@bank.com"},
+		},
+	}
+	a := Alerter{Matcher: f, State: state}
+	since := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	opts := backfillOptions{since: since, until: since.Add(45 * 24 * time.Hour), chunk: 30 * 24 * time.Hour, senders: true}
+
+	if err := backfill(a, Alert{Name: "Bill Due", GmailQuery: "from:bank"}, opts, history, &bytes.Buffer{}); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+
+	recs, err := history.Records()
+	if err != nil {
+		t.Fatal(err)
+	}
+	senders := []string{"billing@bank.com", "alerts@bank.com"}
+	want := []HistoryRecord{
+		{Time: since.Add(30 * 24 * time.Hour), Alert: "Bill Due", Matches: 2, Senders: senders, Backfill: true},
+		{Time: since.Add(45 * 24 * time.Hour), Alert: "Bill Due", Matches: 2, Senders: senders, Backfill: true},
+	}
+	if !cmp.Equal(want, recs) {
+		t.Errorf("want != got\ndiff=%s", cmp.Diff(want, recs))
+	}
+	if got := state.Get("Bill Due"); !cmp.Equal([]string{"id0", "id1"}, got.MessageIDs) || !got.Notified.IsZero() {
+		t.Errorf("wanted the emails found as the baseline without a notification time, got %+v", got)
+	}
+}
+
+func TestBackfillKeepsRecordedEmails(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	history, err := NewHistory(filepath.Join(dir, "history.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := LoadState(filepath.Join(dir, "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.Set("Bill Due", AlertState{MessageIDs: []string{"id9"}})
+	a := Alerter{Matcher: fakePreviewFetcher{matches: []Message{{ID: "id0"}}}, State: state}
+	opts := backfillOptions{since: time.Now().Add(-time.Hour), until: time.Now(), chunk: time.Hour}
+
+	if err := backfill(a, Alert{Name: "Bill Due", GmailQuery: "from:bank"}, opts, history, &bytes.Buffer{}); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+
+	if got := state.Get("Bill Due").MessageIDs; !cmp.Equal([]string{"id9"}, got) {
+		t.Errorf("wanted the recorded emails to be kept, got %v", got)
+	}
+}
+
+func TestBackfillWithInvalidInputReturnsError(t *testing.T) {
+	t.Parallel()
+
+	history, err := NewHistory(filepath.Join(t.TempDir(), "history.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	testCases := map[string]struct {
+		alt  Alert
+		opts backfillOptions
+	}{
+		"Alert watching a label returns an error": {
+			alt:  Alert{LabelAdded: "Banking"},
+			opts: backfillOptions{since: now.Add(-time.Hour), until: now, chunk: time.Hour},
+		},
+		"Non-positive chunk returns an error": {
+			alt:  Alert{GmailQuery: "from:bank"},
+			opts: backfillOptions{since: now.Add(-time.Hour), until: now},
+		},
+		"Start in the future returns an error": {
+			alt:  Alert{GmailQuery: "from:bank"},
+			opts: backfillOptions{since: now.Add(time.Hour), until: now, chunk: time.Hour},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			a := Alerter{Matcher: fakePreviewFetcher{}}
+			if err := backfill(a, tc.alt, tc.opts, history, &bytes.Buffer{}); err == nil {
+				t.Error("expected an error but did not get one")
+			}
+		})
+	}
+}
+
+func TestChunkAlertBoundsEveryQuery(t *testing.T) {
+	t.Parallel()
+
+	start := time.Unix(1672531200, 0)
+	end := time.Unix(1675123200, 0)
+	alt := Alert{Queries: &QueryExpr{And: []QueryExpr{
+		{Query: "from:bank"},
+		{Not: &QueryExpr{Query: "label:paid"}},
+	}}}
+
+	got := chunkAlert(alt, start, end).gmailQueries()
+
+	want := []string{
+		"(from:bank) after:1672531200 before:1675123200",
+		"(label:paid) after:1672531200 before:1675123200",
+	}
+	if !cmp.Equal(want, got) {
+		t.Errorf("want != got\ndiff=%s", cmp.Diff(want, got))
+	}
+	if alt.Queries.And[0].Query != "from:bank" {
+		t.Errorf("wanted the original alert to be unchanged, got %+v", alt.Queries)
+	}
+}
@@ -0,0 +1,198 @@
+package gmailalert
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// The sizes of the benchmark fixtures, like those of a large mailbox watched
+// by many alerts.
+const (
+	benchAlerts   = 1000
+	benchMessages = 10000
+)
+
+// discardNotifier represents a Notifier dropping every notification, so that
+// benchmarks do not measure recording them.
+type discardNotifier struct{}
+
+// Notify returns nil.
+func (discardNotifier) Notify(_ Alert) error {
+	return nil
+}
+
+// benchMatches returns the given number of messages with distinct IDs.
+func benchMatches(n int) []Message {
+	msgs := make([]Message, n)
+	for i := range msgs {
+		msgs[i] = Message{ID: strconv.Itoa(i), ThreadID: strconv.Itoa(i / 3)}
+	}
+
+	return msgs
+}
+
+// benchEmail returns a raw multipart email with a text and an HTML body of
+// about the size of a newsletter.
+func benchEmail(i int) []byte {
+	var text, html bytes.Buffer
+	for line := 0; line < 50; line++ {
+		fmt.Fprintf(&text, "Line %d of order %d: your package ships tomorrow.\r\n", line, i)
+		fmt.Fprintf(&html, "<p>Line %d of order <b>%d</b>: your package ships tomorrow.</p>\r\n", line, i)
+	}
+
+	return []byte(fmt.Sprintf("From: shop@example.com\r\nSubject: Order %d\r\n"+
+		"Content-Type: multipart/alternative; boundary=b\r\n\r\n"+
+		"--b\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s"+
+		"--b\r\nContent-Type: text/html; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n%s"+
+		"--b--\r\n", i, text.String(), html.String()))
+}
+
+func BenchmarkAlerterRun(b *testing.B) {
+	alerts := make([]Alert, benchAlerts)
+	for i := range alerts {
+		alerts[i] = Alert{Name: fmt.Sprintf("alert-%d", i), GmailQuery: fmt.Sprintf("from:sender-%d", i)}
+	}
+	fetcher := fakePreviewFetcher{matches: benchMatches(benchMessages / benchAlerts)}
+	for _, concurrency := range []int{0, 8} {
+		b.Run(fmt.Sprintf("concurrency=%d", concurrency), func(b *testing.B) {
+			a, err := NewAlerter(fetcher, discardNotifier{},
+				WithAlerterLogger(log.New(io.Discard, "", 0)),
+				WithAlerterConcurrency(concurrency))
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				s, err := a.Run(alerts)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if s.Failed() > 0 {
+					b.Fatalf("want no failed alerts, got %d", s.Failed())
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkPrepareFetchResp(b *testing.B) {
+	msgs := make([]*gmail.Message, benchMessages)
+	for i := range msgs {
+		msgs[i] = &gmail.Message{
+			Id:       strconv.Itoa(i),
+			ThreadId: strconv.Itoa(i / 3),
+			Snippet:  "Your package ships tomorrow",
+			Payload: &gmail.MessagePart{Headers: []*gmail.MessagePartHeader{
+				{Name: "From", Value: "Shop <shop@example.com>"},
+				{Name: "To", Value: "me@example.com"},
+				{Name: "Subject", Value: fmt.Sprintf("Order %d", i)},
+				{Name: "Date", Value: "Thu, 15 Oct 2026 14:25:01 +0200"},
+			}},
+		}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, m := range msgs {
+			prepareFetchResp(m)
+		}
+	}
+}
+
+func BenchmarkBodyText(b *testing.B) {
+	raw := make([][]byte, benchMessages)
+	var size int64
+	for i := range raw {
+		raw[i] = benchEmail(i)
+		size += int64(len(raw[i]))
+	}
+	b.SetBytes(size)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, r := range raw {
+			if _, err := bodyText(bytes.NewReader(r), maxMoneyBodyBytes); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkFormatTemplateApply(b *testing.B) {
+	tmpls, err := FormatTemplate{
+		Title:   "{{.Alert}}: {{.Matches}} new",
+		Message: `{{.Message}}{{range $k, $v := .Labels}} #{{$k}}={{$v}}{{end}}{{if .Emergency}} (urgent){{end}}`,
+	}.parse()
+	if err != nil {
+		b.Fatal(err)
+	}
+	notifications := make([]Notification, benchAlerts)
+	for i := range notifications {
+		notifications[i] = Notification{
+			Alert:   fmt.Sprintf("alert-%d", i),
+			Title:   "New emails",
+			Message: fmt.Sprintf("Found %d emails matching query \"from:sender-%d\"", i%10+1, i),
+			Matches: i%10 + 1,
+			Labels:  map[string]string{"team": "ops", "severity": "low"},
+		}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, n := range notifications {
+			if _, err := tmpls.apply(n); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkAlerterDedup(b *testing.B) {
+	state, err := LoadState(filepath.Join(b.TempDir(), "state.json"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	// Every alert has sent notifications with benchMessages/benchAlerts
+	// dedup keys within the window.
+	perAlert := benchMessages / benchAlerts
+	alerts := make([]Alert, benchAlerts)
+	for i := range alerts {
+		alerts[i] = Alert{Name: fmt.Sprintf("alert-%d", i), DedupKey: fmt.Sprintf("key-%d", perAlert-1)}
+		sent := make(map[string]time.Time, perAlert)
+		for k := 0; k < perAlert; k++ {
+			sent[fmt.Sprintf("key-%d", k)] = now.Add(-time.Duration(k) * time.Minute)
+		}
+		state.Set(alerts[i].key(), AlertState{Sent: sent})
+	}
+	a, err := NewAlerter(fakePreviewFetcher{}, discardNotifier{},
+		WithAlerterLogger(log.New(io.Discard, "", 0)),
+		WithAlerterState(state),
+		WithAlerterDedupWindow(time.Hour))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, alt := range alerts {
+			if !a.duplicate(alt, now) {
+				b.Fatalf("want alert %q deduplicated", alt.key())
+			}
+			tx := state.Begin()
+			tx.Set(alt.key(), a.recordSent(tx.Get(alt.key()), alt.DedupKey, now))
+			if err := tx.Commit(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
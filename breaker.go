@@ -0,0 +1,161 @@
+package gmailalert
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// The defaults of a BreakerConfig.
+const (
+	defaultBreakerFailures = 5
+	defaultBreakerCooldown = 5 * time.Minute
+)
+
+// ErrBreakerOpen is the error of the evaluations of alerts skipped because
+// the Alerter's Breaker is open.
+var ErrBreakerOpen = errors.New("gmail circuit breaker is open, skipped evaluation")
+
+// BreakerConfig represents the configuration of a circuit breaker around the
+// Gmail API, which stops evaluating alerts for a cool-down period once the
+// Gmail API fails too many times in a row, instead of failing every alert
+// on its own.
+type BreakerConfig struct {
+	// The number of evaluations failing in a row that open the breaker.
+	// Defaults to 5.
+	Failures int `json:"failures"`
+	// How long the breaker stays open before an evaluation checks whether
+	// Gmail is reachable again, as a duration like "10m". Defaults to 5m.
+	Cooldown string `json:"cooldown"`
+	// The Pushover recipient notified once when the breaker opens. If
+	// empty, the breaker only logs that it opened.
+	PushoverTarget string `json:"pushovertarget"`
+	// The Pushover sound of the notification sent when the breaker opens.
+	PushoverSound string `json:"pushoversound"`
+}
+
+// Breaker is a circuit breaker around the Gmail API. It opens once the
+// configured number of evaluations failed in a row, and then rejects the
+// evaluations of alerts until its cool-down period elapsed. After that, a
+// single evaluation is let through, which closes the breaker if it succeeds
+// and opens it for another cool-down period if it fails. It is safe to be
+// used concurrently by multiple goroutines.
+type Breaker struct {
+	cfg      BreakerConfig
+	failures int
+	cooldown time.Duration
+	mtx      sync.Mutex
+	failed   int
+	open     bool
+	until    time.Time
+}
+
+// NewBreaker accepts a BreakerConfig and returns a new, closed Breaker. An
+// error is returned if the number of failures is negative or the cool-down
+// period is invalid.
+func NewBreaker(cfg BreakerConfig) (*Breaker, error) {
+	if cfg.Failures < 0 {
+		return nil, fmt.Errorf("circuit breaker failures must not be negative, got %d", cfg.Failures)
+	}
+	cooldown, err := parsePositiveDuration("circuit breaker cooldown", cfg.Cooldown, defaultBreakerCooldown)
+	if err != nil {
+		return nil, err
+	}
+	failures := cfg.Failures
+	if failures == 0 {
+		failures = defaultBreakerFailures
+	}
+
+	return &Breaker{cfg: cfg, failures: failures, cooldown: cooldown}, nil
+}
+
+// WithAlerterBreaker accepts a Breaker and returns a functional option for
+// wiring the Breaker around the Matcher of an Alerter.
+func WithAlerterBreaker(b *Breaker) AlerterOption {
+	return func(a *Alerter) {
+		a.Breaker = b
+	}
+}
+
+// allow reports whether an evaluation may query Gmail at the given time. Once
+// the cool-down period of an open Breaker elapsed, only the first evaluation
+// is allowed, and the others are rejected for another cool-down period
+// unless it succeeds.
+func (b *Breaker) allow(now time.Time) bool {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if !b.open {
+		return true
+	}
+	if now.Before(b.until) {
+		return false
+	}
+	b.until = now.Add(b.cooldown)
+
+	return true
+}
+
+// fail records an evaluation that failed at the given time and reports
+// whether it opened the Breaker, which is only the case for the failure
+// opening a closed Breaker.
+func (b *Breaker) fail(now time.Time) bool {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.failed++
+	if b.failed < b.failures {
+		return false
+	}
+	b.until = now.Add(b.cooldown)
+	opened := !b.open
+	b.open = true
+
+	return opened
+}
+
+// succeed records an evaluation that succeeded and reports whether it closed
+// an open Breaker.
+func (b *Breaker) succeed() bool {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	closed := b.open
+	b.failed, b.open = 0, false
+
+	return closed
+}
+
+// observeGmail records the outcome of querying Gmail for an evaluation, given
+// as the error it returned, with the Alerter's Breaker, if any. When the
+// Breaker opens, it is logged once and the Breaker's recipient, if any, is
+// notified that Gmail is unreachable.
+func (a Alerter) observeGmail(err error) {
+	if a.Breaker == nil {
+		return
+	}
+	if err == nil {
+		if a.Breaker.succeed() {
+			a.Logger.Printf("gmail is reachable again, closed circuit breaker")
+		}
+		return
+	}
+	if !a.Breaker.fail(a.now()) {
+		return
+	}
+
+	a.errorLog().Printf("gmail failed %d evaluations in a row, opened circuit breaker for %s, skipping alerts until then: %v",
+		a.Breaker.failures, a.Breaker.cooldown, err)
+	if a.Breaker.cfg.PushoverTarget == "" {
+		return
+	}
+	alt := Alert{
+		Name:           "gmail circuit breaker",
+		PushoverTitle:  "Gmail unreachable",
+		PushoverTarget: a.Breaker.cfg.PushoverTarget,
+		PushoverSound:  a.Breaker.cfg.PushoverSound,
+		PushoverMsg: fmt.Sprintf("gmailalert skips every alert for %s after %d failed evaluations in a row: %v",
+			a.Breaker.cooldown, a.Breaker.failures, err),
+	}
+	if _, err := a.notify(alt); err != nil {
+		a.errorLog().Printf("got error sending circuit breaker notification: %v", err)
+	}
+}
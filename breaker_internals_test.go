@@ -0,0 +1,151 @@
+package gmailalert
+
+import (
+	"errors"
+	"io"
+	"log"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewBreaker(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		cfg          BreakerConfig
+		wantFailures int
+		wantCooldown time.Duration
+		errExpected  bool
+	}{
+		"Defaults": {
+			wantFailures: defaultBreakerFailures,
+			wantCooldown: defaultBreakerCooldown,
+		},
+		"Configured failures and cooldown": {
+			cfg:          BreakerConfig{Failures: 2, Cooldown: "1m"},
+			wantFailures: 2,
+			wantCooldown: time.Minute,
+		},
+		"Negative failures returns error": {
+			cfg:         BreakerConfig{Failures: -1},
+			errExpected: true,
+		},
+		"Invalid cooldown returns error": {
+			cfg:         BreakerConfig{Cooldown: "soon"},
+			errExpected: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			b, err := NewBreaker(tc.cfg)
+			errReceived := err != nil
+
+			if tc.errExpected != errReceived {
+				t.Fatalf("NewBreaker(%+v) returned unexpected error status: %v", tc.cfg, err)
+			}
+			if tc.errExpected {
+				return
+			}
+			if b.failures != tc.wantFailures || b.cooldown != tc.wantCooldown {
+				t.Errorf("want %d failures and cooldown %s, got %d and %s",
+					tc.wantFailures, tc.wantCooldown, b.failures, b.cooldown)
+			}
+		})
+	}
+}
+
+func TestBreakerOpensAndRecovers(t *testing.T) {
+	t.Parallel()
+
+	b, err := NewBreaker(BreakerConfig{Failures: 2, Cooldown: "1m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	if b.fail(now) {
+		t.Fatal("want breaker closed after a single failure")
+	}
+	if !b.fail(now) {
+		t.Fatal("want breaker opened by the second failure in a row")
+	}
+	if b.allow(now.Add(30 * time.Second)) {
+		t.Error("want evaluations rejected during the cooldown")
+	}
+	if !b.allow(now.Add(time.Minute)) {
+		t.Fatal("want an evaluation let through once the cooldown elapsed")
+	}
+	if b.allow(now.Add(time.Minute)) {
+		t.Error("want other evaluations rejected while the first one checks gmail")
+	}
+	if b.fail(now.Add(time.Minute)) {
+		t.Error("want a failure of an open breaker not to open it again")
+	}
+	if b.allow(now.Add(90 * time.Second)) {
+		t.Error("want the failed check to start another cooldown")
+	}
+	if !b.allow(now.Add(2 * time.Minute)) {
+		t.Fatal("want an evaluation let through once the second cooldown elapsed")
+	}
+	if !b.succeed() {
+		t.Error("want a success to close the open breaker")
+	}
+	if !b.allow(now.Add(2 * time.Minute)) {
+		t.Error("want evaluations allowed once the breaker closed")
+	}
+}
+
+func TestAlerterSendsSingleBreakerNotification(t *testing.T) {
+	t.Parallel()
+
+	b, err := NewBreaker(BreakerConfig{Failures: 2, Cooldown: "1h", PushoverTarget: "ops"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &failingMatcher{err: errors.New("connection refused")}
+	n := &recordingTestNotifier{}
+	a := Alerter{
+		Matcher:     m,
+		Notifier:    n,
+		Logger:      log.New(io.Discard, "", 0),
+		Breaker:     b,
+		Concurrency: 1,
+	}
+	alerts := []Alert{
+		{GmailQuery: "from:bank", PushoverTitle: "t", PushoverSound: "s", PushoverTarget: "u"},
+		{GmailQuery: "from:shop", PushoverTitle: "t", PushoverSound: "s", PushoverTarget: "u"},
+		{GmailQuery: "from:boss", PushoverTitle: "t", PushoverSound: "s", PushoverTarget: "u"},
+	}
+
+	a.run(alerts)
+	summary := a.run(alerts)
+
+	if len(n.alerts) != 1 || n.alerts[0].PushoverTitle != "Gmail unreachable" || n.alerts[0].PushoverTarget != "ops" {
+		t.Fatalf("want a single notification that gmail is unreachable, got %+v", n.alerts)
+	}
+	for _, res := range summary.Results {
+		if !errors.Is(res.Err, ErrBreakerOpen) {
+			t.Errorf("want alert %q skipped while the breaker is open, got error %v", res.Alert, res.Err)
+		}
+	}
+	if m.queries != 2 {
+		t.Errorf("want gmail queried until the breaker opened, got %d queries", m.queries)
+	}
+}
+
+// failingMatcher is a Matcher counting the queries it runs and failing
+// every one of them with its err field.
+type failingMatcher struct {
+	mtx     sync.Mutex
+	queries int
+	err     error
+}
+
+func (f *failingMatcher) Match(query string) ([]string, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.queries++
+	return nil, f.err
+}
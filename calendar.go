@@ -0,0 +1,351 @@
+package gmailalert
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// maxCalendarBytes is the number of bytes of a calendar part of an email
+// that are read to find its events.
+const maxCalendarBytes = 1 << 20
+
+// maxCalendarEvents is the number of calendar events of the matching emails
+// listed in a notification.
+const maxCalendarEvents = 3
+
+// CalendarEvent represents an event of a calendar attached to an email, like
+// a meeting invitation.
+type CalendarEvent struct {
+	// The unique ID of the event.
+	UID string
+	// The title of the event.
+	Summary string
+	// The location of the event.
+	Location string
+	// When the event starts and ends. End is zero if the event has no end.
+	Start, End time.Time
+	// Whether the event lasts whole days, in which case Start and End are
+	// midnights.
+	AllDay bool
+}
+
+// String returns the title, start, and location of the CalendarEvent
+// receiver e, like "Team sync, Mon Oct 19 15:00 UTC at Room 1".
+func (e CalendarEvent) String() string {
+	title := e.Summary
+	if title == "" {
+		title = "Untitled event"
+	}
+	start := e.Start.Format("Mon Jan 2 15:04 MST")
+	if e.AllDay {
+		start = e.Start.Format("Mon Jan 2") + " (all day)"
+	}
+	s := title + ", " + start
+	if e.Location != "" {
+		s += " at " + e.Location
+	}
+
+	return s
+}
+
+// CalendarParser is the interface that wraps the ParseCalendar method used
+// by any types implementing parsing of an iCalendar (RFC 5545) file.
+// ParseCalendar returns the events of the calendar read from the given
+// io.Reader, or an error if it cannot be parsed.
+type CalendarParser interface {
+	ParseCalendar(r io.Reader) ([]CalendarEvent, error)
+}
+
+// WithAlerterCalendarParser accepts a CalendarParser and returns a
+// functional option for wiring the CalendarParser to an Alerter, in place
+// of the built-in one.
+func WithAlerterCalendarParser(p CalendarParser) AlerterOption {
+	return func(a *Alerter) {
+		a.CalendarParser = p
+	}
+}
+
+// CalendarConfig represents how the calendar events attached to the emails
+// matching an alert, like meeting invitations, are notified.
+type CalendarConfig struct {
+	// How soon an event must start, as a duration like "24h", for the
+	// email it is attached to to match. If empty, emails match whether or
+	// not they have events.
+	Within string `json:"within"`
+}
+
+// ok returns an error if the Within duration of the CalendarConfig is set
+// but is not a positive duration.
+func (c CalendarConfig) ok() error {
+	_, err := parsePositiveDuration("calendar within", c.Within, 0)
+	return err
+}
+
+// calendarEvents accepts an Alert with a CalendarConfig and one of the
+// messages matching the Alert and returns the events of the calendars
+// attached to the message, or only those starting within the CalendarConfig's
+// Within duration if it is set. A calendar that cannot be parsed is logged
+// and skipped. An error is returned if the Alerter's Matcher does not
+// implement RawFetcher or if there is a problem fetching the message.
+func (a Alerter) calendarEvents(alt Alert, m Message) ([]CalendarEvent, error) {
+	fetcher, ok := a.Matcher.(RawFetcher)
+	if !ok {
+		return nil, fmt.Errorf("matcher %T must implement RawFetcher to read calendar events", a.Matcher)
+	}
+	within, err := parsePositiveDuration("calendar within", alt.Calendar.Within, 0)
+	if err != nil {
+		return nil, err
+	}
+	var parser CalendarParser = icsParser{}
+	if a.CalendarParser != nil {
+		parser = a.CalendarParser
+	}
+
+	raw, err := fetchRaw(fetcher, alt, m.ID)
+	if err != nil {
+		return nil, err
+	}
+	var events []CalendarEvent
+	seen := map[string]bool{}
+	err = walkMIME(bytes.NewReader(raw), func(p mimePart) error {
+		if p.mediaType != "text/calendar" && p.mediaType != "application/ics" &&
+			!strings.HasSuffix(strings.ToLower(p.filename), ".ics") {
+			return nil
+		}
+		parsed, err := parser.ParseCalendar(io.LimitReader(p.body, maxCalendarBytes))
+		if err != nil {
+			a.errorLog().Printf("got error parsing calendar of email %s, skipping it: %v", m.ID, err)
+			return nil
+		}
+		// Invitations often carry the same calendar both inline and as an
+		// attachment.
+		for _, e := range parsed {
+			key := e.UID + "@" + e.Start.String()
+			if e.UID != "" && seen[key] {
+				continue
+			}
+			seen[key] = true
+			if within > 0 && (e.Start.Before(a.now()) || e.Start.After(a.now().Add(within))) {
+				continue
+			}
+			events = append(events, e)
+		}
+		return nil
+	})
+	if err != nil {
+		a.errorLog().Printf("got error reading parts of email %s, skipping its calendar events: %v", m.ID, err)
+		return nil, nil
+	}
+
+	return events, nil
+}
+
+// withUpcomingEvents accepts an Alert with a CalendarConfig having a Within
+// duration and the messages matching the Alert and returns the messages
+// with a calendar event starting within the duration. An error is returned
+// if the events of a message cannot be read.
+func (a Alerter) withUpcomingEvents(alt Alert, matches []Message) ([]Message, error) {
+	kept := make([]Message, 0, len(matches))
+	for _, m := range matches {
+		events, err := a.calendarEvents(alt, m)
+		if err != nil {
+			return nil, err
+		}
+		if len(events) > 0 {
+			kept = append(kept, m)
+		}
+	}
+
+	if ignored := len(matches) - len(kept); ignored > 0 {
+		a.Logger.Printf("ignored %d emails without calendar events starting within %s matching alert %q",
+			ignored, alt.Calendar.Within, alt.key())
+	}
+
+	return kept, nil
+}
+
+// calendarText accepts an Alert with a CalendarConfig and the messages
+// matching the Alert and returns a line for each of the first calendar
+// events found in the messages, from the most recent message on, with their
+// start in the Alert's time zone. An empty string is returned if the
+// messages have no events, and an error is returned if the events of a
+// message cannot be read.
+func (a Alerter) calendarText(alt Alert, matches []Message) (string, error) {
+	var lines []string
+	for _, m := range matches {
+		events, err := a.calendarEvents(alt, m)
+		if err != nil {
+			return "", err
+		}
+		for _, e := range events {
+			if len(lines) == maxCalendarEvents {
+				return strings.Join(lines, "\n"), nil
+			}
+			// All-day events fall on the same date everywhere.
+			if !e.AllDay {
+				e.Start = e.Start.In(a.location(alt))
+			}
+			lines = append(lines, "Event: "+e.String())
+		}
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// icsParser represents the built-in CalendarParser, which reads the title,
+// location, and times of the VEVENT components of an iCalendar file.
+type icsParser struct{}
+
+// ParseCalendar returns the events of the iCalendar file read from the given
+// io.Reader. Events without a start are skipped. An error is returned if
+// the file cannot be read, is not a calendar, or has an event with an
+// invalid start or end.
+func (icsParser) ParseCalendar(r io.Reader) ([]CalendarEvent, error) {
+	lines, err := unfoldICS(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 || !strings.EqualFold(lines[0], "BEGIN:VCALENDAR") {
+		return nil, fmt.Errorf("calendar must begin with BEGIN:VCALENDAR")
+	}
+
+	var events []CalendarEvent
+	var event *CalendarEvent
+	// The depth of the components nested in the current event, like the
+	// VALARM of a reminder, whose properties are not the event's.
+	var nested int
+	for _, line := range lines {
+		name, params, value, ok := parseICSProperty(line)
+		if !ok {
+			continue
+		}
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VEVENT"):
+			event, nested = &CalendarEvent{}, 0
+		case event == nil:
+		case name == "BEGIN":
+			nested++
+		case name == "END" && nested > 0:
+			nested--
+		case name == "END" && strings.EqualFold(value, "VEVENT"):
+			if !event.Start.IsZero() {
+				events = append(events, *event)
+			}
+			event = nil
+		case nested > 0:
+		case name == "UID":
+			event.UID = value
+		case name == "SUMMARY":
+			event.Summary = unescapeICS(value)
+		case name == "LOCATION":
+			event.Location = unescapeICS(value)
+		case name == "DTSTART":
+			event.Start, event.AllDay, err = parseICSTime(params, value)
+			if err != nil {
+				return nil, fmt.Errorf("got error parsing start of event %q: %v", event.Summary, err)
+			}
+		case name == "DTEND":
+			event.End, _, err = parseICSTime(params, value)
+			if err != nil {
+				return nil, fmt.Errorf("got error parsing end of event %q: %v", event.Summary, err)
+			}
+		}
+	}
+
+	return events, nil
+}
+
+// unfoldICS reads the lines of an iCalendar file from the given io.Reader,
+// joining the lines folded onto several ones, which continue with a space
+// or a tab. An error is returned if the file cannot be read.
+func unfoldICS(r io.Reader) ([]string, error) {
+	var lines []string
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64<<10), maxCalendarBytes)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("got error reading calendar: %v", err)
+	}
+
+	return lines, nil
+}
+
+// parseICSProperty splits the given unfolded iCalendar content line, like
+// `DTSTART;TZID="Europe/Berlin":20261019T150000`, into its uppercased name,
+// its parameters with uppercased names, and its value. It reports whether
+// the line is a valid content line.
+func parseICSProperty(line string) (string, map[string]string, string, bool) {
+	// The value starts at the first colon outside of a quoted parameter
+	// value.
+	quoted := false
+	colon := -1
+	for i, r := range line {
+		if r == '"' {
+			quoted = !quoted
+		}
+		if r == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return "", nil, "", false
+	}
+
+	fields := strings.Split(line[:colon], ";")
+	params := map[string]string{}
+	for _, f := range fields[1:] {
+		k, v, _ := strings.Cut(f, "=")
+		params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+	}
+
+	return strings.ToUpper(fields[0]), params, line[colon+1:], true
+}
+
+// parseICSTime parses the given iCalendar DATE or DATE-TIME value with the
+// given parameters and reports whether it is a DATE, which is an all-day
+// time. DATE-TIME values are in UTC if they end in "Z", in the time zone of
+// their TZID parameter if it is known, and in the local time zone
+// otherwise. An error is returned if the value is invalid.
+func parseICSTime(params map[string]string, value string) (time.Time, bool, error) {
+	loc := time.Local
+	if tzid := params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		}
+	}
+
+	if strings.EqualFold(params["VALUE"], "DATE") || len(value) == len("20060102") {
+		t, err := time.ParseInLocation("20060102", value, loc)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		return t, false, err
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+
+	return t, false, err
+}
+
+// icsEscapes replaces the escaped characters of an iCalendar text value.
+var icsEscapes = strings.NewReplacer(`\n`, " ", `\N`, " ", `\,`, ",", `\;`, ";", `\\`, `\`)
+
+// unescapeICS returns the given iCalendar text value unescaped, with its
+// line breaks replaced by spaces.
+func unescapeICS(value string) string {
+	return strings.TrimSpace(icsEscapes.Replace(value))
+}
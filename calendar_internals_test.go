@@ -0,0 +1,180 @@
+package gmailalert
+
+import (
+	"io"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// invitation returns a raw multipart email inviting to an event with the
+// given summary and UTC start, carrying its calendar both inline and as an
+// attachment like calendar clients do.
+func invitation(summary, start string) []byte {
+	ics := "BEGIN:VCALENDAR\r\nMETHOD:REQUEST\r\nBEGIN:VEVENT\r\nUID:" + summary + "@example.com\r\n" +
+		"SUMMARY:" + summary + "\r\nDTSTART:" + start + "\r\nLOCATION:Room 1\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+	return []byte("Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nYou are invited.\r\n" +
+		"--b\r\nContent-Type: text/calendar; method=REQUEST\r\n\r\n" + ics +
+		"--b\r\nContent-Type: application/ics; name=invite.ics\r\n\r\n" + ics +
+		"--b--\r\n")
+}
+
+func TestICSParserParseCalendar(t *testing.T) {
+	t.Parallel()
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := map[string]struct {
+		input       string
+		want        []CalendarEvent
+		errExpected bool
+	}{
+		"UTC event": {
+			input: "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:1\r\nSUMMARY:Team sync\r\nLOCATION:Room 1\r\n" +
+				"DTSTART:20261019T150000Z\r\nDTEND:20261019T153000Z\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n",
+			want: []CalendarEvent{{
+				UID: "1", Summary: "Team sync", Location: "Room 1",
+				Start: time.Date(2026, 10, 19, 15, 0, 0, 0, time.UTC),
+				End:   time.Date(2026, 10, 19, 15, 30, 0, 0, time.UTC),
+			}},
+		},
+		"Event in time zone with folded and escaped summary": {
+			input: "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nSUMMARY:Budget\\, plans \r\n and goals\r\n" +
+				"DTSTART;TZID=\"Europe/Berlin\":20261019T090000\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n",
+			want: []CalendarEvent{{
+				Summary: "Budget, plans and goals",
+				Start:   time.Date(2026, 10, 19, 9, 0, 0, 0, berlin),
+			}},
+		},
+		"All-day event with reminder": {
+			input: "BEGIN:VCALENDAR\nBEGIN:VEVENT\nSUMMARY:Offsite\nDTSTART;VALUE=DATE:20261020\n" +
+				"BEGIN:VALARM\nSUMMARY:Reminder\nEND:VALARM\nEND:VEVENT\nEND:VCALENDAR\n",
+			want: []CalendarEvent{{
+				Summary: "Offsite",
+				Start:   time.Date(2026, 10, 20, 0, 0, 0, 0, time.Local),
+				AllDay:  true,
+			}},
+		},
+		"Event without start is skipped": {
+			input: "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nSUMMARY:Someday\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n",
+		},
+		"Invalid start": {
+			input:       "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nDTSTART:tomorrow\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n",
+			errExpected: true,
+		},
+		"Not a calendar": {
+			input:       "Hello there",
+			errExpected: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got, err := icsParser{}.ParseCalendar(strings.NewReader(tc.input))
+			errReceived := err != nil
+
+			if tc.errExpected != errReceived {
+				t.Fatalf("ParseCalendar returned unexpected error status: %v", err)
+			}
+			if !cmp.Equal(tc.want, got) {
+				t.Errorf("want != got\ndiff=%s", cmp.Diff(tc.want, got))
+			}
+		})
+	}
+}
+
+func TestCalendarConfigOK(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		input       CalendarConfig
+		errExpected bool
+	}{
+		"No window": {},
+		"Valid window": {
+			input: CalendarConfig{Within: "24h"},
+		},
+		"Negative window": {
+			input:       CalendarConfig{Within: "-1h"},
+			errExpected: true,
+		},
+		"Invalid window": {
+			input:       CalendarConfig{Within: "a day"},
+			errExpected: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := tc.input.ok()
+			errReceived := err != nil
+
+			if tc.errExpected != errReceived {
+				t.Fatalf("ok returned unexpected error status: %v", err)
+			}
+		})
+	}
+}
+
+func TestAlerterNotifiesCalendarEvents(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)
+	fetcher := fakeExportFetcher{
+		fakePreviewFetcher: fakePreviewFetcher{matches: []Message{{ID: "1"}, {ID: "2"}, {ID: "3"}}},
+		raw: map[string][]byte{
+			"1": invitation("Team sync", "20261019T150000Z"),
+			"2": invitation("Quarterly review", "20261102T100000Z"),
+			"3": []byte("Subject: lunch?\r\n\r\nNo invitation here."),
+		},
+	}
+	testCases := map[string]struct {
+		calendar    CalendarConfig
+		wantMatches int
+		wantEvents  string
+	}{
+		"All events of matching emails": {
+			wantMatches: 3,
+			wantEvents: "Event: Team sync, Mon Oct 19 15:00 UTC at Room 1\n" +
+				"Event: Quarterly review, Mon Nov 2 10:00 UTC at Room 1",
+		},
+		"Only emails with events within window": {
+			calendar:    CalendarConfig{Within: "24h"},
+			wantMatches: 1,
+			wantEvents:  "Event: Team sync, Mon Oct 19 15:00 UTC at Room 1",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			notifier := &recordingTestNotifier{}
+			a, err := NewAlerter(fetcher, notifier,
+				WithAlerterLogger(log.New(io.Discard, "", 0)),
+				WithAlerterClock(func() time.Time { return now }))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res := a.process(Alert{Name: "invites", GmailQuery: "has:attachment", TimeZone: "UTC", Calendar: &tc.calendar}, nil)
+			if res.Err != nil {
+				t.Fatal(res.Err)
+			}
+			if len(notifier.alerts) != 1 {
+				t.Fatalf("want one notification, got %+v", notifier.alerts)
+			}
+			if res.Matches != tc.wantMatches {
+				t.Errorf("want %d matches, got %d", tc.wantMatches, res.Matches)
+			}
+			_, got, _ := strings.Cut(notifier.alerts[0].PushoverMsg, "\n")
+			if tc.wantEvents != got {
+				t.Errorf("want events %q in notification message, got %q", tc.wantEvents, got)
+			}
+		})
+	}
+}
@@ -1,84 +1,484 @@
 package gmailalert
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"flag"
+	"fmt"
 	"io"
 	"log"
+	"net"
 	"os"
+	"os/signal"
+	"runtime/debug"
+	"strings"
+	"syscall"
+	"time"
+
+	"google.golang.org/api/gmail/v1"
 )
 
 // CLI accepts a slice of command-line flags for a user's Google Developers
-// Console file ("-credentials-file"), a user's local Google OAuth2 token JSON file
-// ("-token-file"), an alert configuration JSON file ("-alerts-cfg-file") which
-// provides the email criteria to alert on, a TCP port for the local HTTP server
-// to listen on for redirect requests from the Google OAuth2 resource provider
-// ("-port"), and a debug flag ("-debug") which indicates if debug-level output
-// will be written.
+// Console file ("-credentials-file"), a user's local Google OAuth2 token JSON
+// file ("-token-file"), an alert configuration JSON file ("-alerts-cfg-file")
+// which provides the email criteria to alert on, and the flags configuring
+// how the alerts are processed, like "-daemon" for processing them
+// continuously. The flags are registered by cliEnv.fromArgs and described
+// by their help, which "-h" prints.
 //
 // The command line flags are parsed, validated, and then used to create an
-// Alerter struct to process alerts with. An error is returned if any of the
-// command-line flags are invalid or if there is a problem during the processing
-// of alerts.
+// Alerter struct to process alerts with. In daemon mode, the Alerter is
+// recreated whenever the alerts config, credentials, or token file changes,
+// while its Gmail client is kept unless the credentials, token, or Gmail
+// HTTP settings changed or it fails a health check. An error is returned if
+// any of the command-line flags are invalid, if the files they name are
+// missing, or if there is a problem during the processing of alerts.
+//
+// If the first argument names a subcommand, like "test-notify" or "validate",
+// the remaining arguments are handled by that subcommand instead, as
+// described by rootCommand. The "-h" flag prints the help of gmailalert or of
+// the subcommand without returning an error.
 func CLI(args []string) error {
-	var app cliEnv
+	if ok, err := runCommand(args); ok {
+		return err
+	}
+
+	app := cliEnv{passphrase: new(string)}
+	defer closeSSHTunnels()
+
+	if err := app.fromArgs(args); errors.Is(err, flag.ErrHelp) {
+		return nil
+	} else if err != nil {
+		return err
+	}
 
-	if err := app.fromArgs(args); err != nil {
+	if err := app.checkMounts(); err != nil {
 		return err
 	}
 
-	f, err := os.Open(app.alertsConfigFile)
+	if app.daemon && (app.controlAddr != "" || app.httpAddr != "") {
+		app.control = NewControl()
+	}
+	if app.daemon {
+		app.gmailClients = newGmailClientPool()
+	}
+	if app.daemon || app.alertLogsFile != "" {
+		logs, err := NewAlertLogs(app.alertLogsFile)
+		if err != nil {
+			return err
+		}
+		app.alertLogs = logs
+	}
+	if app.control != nil {
+		app.control.logs = app.alertLogs
+	}
+
+	for {
+		err := app.start()
+		if !errors.Is(err, errConfigChanged) {
+			return err
+		}
+		app.reloaded = true
+	}
+}
+
+// start loads the alert configuration file named in the cliEnv receiver and
+// processes the configured alerts, pinging the configured heartbeat's failure
+// URL if processing fails. An error is returned if the configuration cannot
+// be loaded or if there is a problem processing alerts, and errConfigChanged
+// is returned if the configuration needs to be reloaded in daemon mode.
+func (app cliEnv) start() error {
+	alertCfg, err := app.alertConfig()
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-	alertCfg, err := DecodeAlerts(f)
+
+	var reporters []Reporter
+	var heartbeat *Heartbeat
+	if alertCfg.Heartbeat != nil {
+		heartbeat, err = NewHeartbeat(*alertCfg.Heartbeat)
+		if err != nil {
+			return err
+		}
+		reporters = append(reporters, heartbeat)
+	}
+	if alertCfg.Webhook != nil {
+		webhook, err := NewWebhook(*alertCfg.Webhook)
+		if err != nil {
+			return err
+		}
+		reporters = append(reporters, webhook)
+	}
+	if alertCfg.Automation != nil {
+		automation, err := NewAutomation(*alertCfg.Automation)
+		if err != nil {
+			return err
+		}
+		reporters = append(reporters, automation)
+	}
+	if alertCfg.Feed != nil && alertCfg.Feed.File != "" {
+		feed, err := NewFeed(*alertCfg.Feed)
+		if err != nil {
+			return err
+		}
+		reporters = append(reporters, feed)
+	}
+
+	runs, err := app.profiles(alertCfg)
 	if err != nil {
 		return err
 	}
 
-	debugLogger := log.New(io.Discard, "", log.LstdFlags)
-	if app.debug {
-		debugLogger = log.New(os.Stdout, "DEBUG: ", log.LstdFlags|log.Lshortfile)
+	if err := runProfiles(runs, reporters); err != nil {
+		if heartbeat != nil && !errors.Is(err, errConfigChanged) {
+			if pingErr := heartbeat.Fail(); pingErr != nil {
+				return fmt.Errorf("%v (got error sending failure heartbeat: %v)", err, pingErr)
+			}
+		}
+		return err
 	}
 
-	gmailClient, err := NewGmailClient(
-		GmailClientConfig{
-			CredentialsFile: app.credsFile,
-			TokenFile:       app.tokenFile,
-			UserInput:       os.Stdin,
-			RedirectSvrPort: app.redirectSvrPort,
-			Logger:          debugLogger,
-		},
-	)
+	return nil
+}
+
+// run accepts a context, an AlertConfig, and a slice of Reporters, creates
+// the Gmail and Pushover clients described by the cliEnv receiver and the
+// AlertConfig, and processes the configured alerts with them, either once
+// or, in daemon mode, until the process is interrupted or the context is
+// cancelled. An error is returned if any of the
+// clients cannot be created or if there is a problem processing alerts.
+func (app cliEnv) run(ctx context.Context, alertCfg AlertConfig, reporters []Reporter) error {
+	alertCfg, err := alertCfg.tuned(app.tuning)
 	if err != nil {
 		return err
 	}
+	debugLogger := app.debugLogger()
 
-	pushoverClient, err := NewPushoverClient(alertCfg.PushoverApp, WithPushoverClientLogger(debugLogger))
+	pushoverClient, err := app.pushoverClient(alertCfg, debugLogger)
 	if err != nil {
 		return err
 	}
 
-	alerter, err := NewAlerter(gmailClient, pushoverClient)
+	if alertCfg.Monitor != nil {
+		if app.monitor, err = NewMonitor(*alertCfg.Monitor, pushoverClient, newInfoLogger()); err != nil {
+			return err
+		}
+	}
+
+	gmailClient, err := app.gmailClient(debugLogger, alertCfg)
 	if err != nil {
+		if app.monitor != nil {
+			app.monitor.AuthFailed(err)
+		}
 		return err
 	}
 
-	if err := alerter.Process(alertCfg.Alerts); err != nil {
+	if app.validatePushover {
+		if err := validatePushover(pushoverClient, alertCfg.Alerts, io.Discard); err != nil {
+			return err
+		}
+	}
+
+	logger, errorLogger, err := alertCfg.alerterLoggers()
+	if err != nil {
+		return err
+	}
+	opts := []AlerterOption{
+		WithAlerterLogger(logger),
+		WithAlerterErrorLogger(errorLogger),
+		WithAlerterSpread(Spread(app.spread)),
+		WithAlerterShards(app.shards),
+		WithAlerterConcurrency(alertCfg.Concurrency),
+		WithAlerterFetchBatch(alertCfg.FetchBatch),
+		WithAlerterRetries(alertCfg.NotifyRetries),
+	}
+	if err := alertCfg.actionsAllowed(); err != nil {
+		return err
+	}
+	if len(alertCfg.mailboxActions()) > 0 {
+		modifyClient, err := app.modifyClient(debugLogger, alertCfg)
+		if err != nil {
+			return fmt.Errorf("got error creating gmail client for mailbox actions, authorize one with \"gmailalert auth -modify\": %v", err)
+		}
+		opts = append(opts, WithAlerterTrasher(modifyClient))
+	}
+	for _, r := range reporters {
+		opts = append(opts, WithAlerterReporter(r))
+	}
+	if app.monitor != nil {
+		opts = append(opts, WithAlerterReporter(app.monitor))
+	}
+	if app.daemon {
+		opts = append(opts, WithAlerterPanicHandler(func(v any, stack []byte) {
+			app.reportCrash(v, stack, alertCfg.Alerts)
+		}))
+	}
+	if app.daemon && app.skipUnchanged {
+		opts = append(opts, WithAlerterChangeTracker(NewChangeTracker()))
+	}
+	if alertCfg.TraceNotifications {
+		opts = append(opts, WithAlerterTraceNotifications())
+	}
+	if app.explain {
+		opts = append(opts, WithAlerterExplain(), WithAlerterReporter(explainReporter{w: os.Stdout}))
+	}
+	if alertCfg.DedupWindow != "" {
+		d, err := time.ParseDuration(alertCfg.DedupWindow)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("dedup window must be a positive duration, got %q", alertCfg.DedupWindow)
+		}
+		opts = append(opts, WithAlerterDedupWindow(d))
+	}
+	if alertCfg.LatencyBudget != "" {
+		d, err := time.ParseDuration(alertCfg.LatencyBudget)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("latency budget must be a positive duration, got %q", alertCfg.LatencyBudget)
+		}
+		opts = append(opts, WithAlerterLatencyBudget(d))
+	}
+	loc, err := loadTimeZone(alertCfg.TimeZone)
+	if err != nil {
+		return err
+	}
+	opts = append(opts, WithAlerterLocation(loc))
+	if alertCfg.GmailBreaker != nil {
+		breaker, err := NewBreaker(*alertCfg.GmailBreaker)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, WithAlerterBreaker(breaker))
+	}
+	if alertCfg.Audit != nil {
+		auditLog, err := NewAuditLog(*alertCfg.Audit)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, WithAlerterAuditLog(auditLog))
+	}
+	state, err := app.openState(alertCfg.State)
+	if err != nil {
+		return err
+	}
+	if state != nil {
+		opts = append(opts, WithAlerterState(state))
+		if app.daemon {
+			opts = append(opts, WithAlerterReporter(stateSaver{state: state}))
+		}
+	}
+	if app.historyFile != "" {
+		history, err := NewHistory(app.historyFile)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, WithAlerterReporter(history))
+	}
+	if app.outboxFile != "" {
+		outbox, err := LoadOutbox(app.outboxFile)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, WithAlerterOutbox(outbox))
+	}
+	if app.alertLogs != nil {
+		opts = append(opts, WithAlerterLogs(app.alertLogs))
+	}
+	control := app.control
+	if app.daemon && control == nil {
+		control = NewControl()
+	}
+	if control != nil {
+		opts = append(opts, WithAlerterControl(control))
+	}
+	var lease *Lease
+	if app.leaseFile != "" {
+		lease, err = NewLease(app.leaseFile, leaseHolder(), app.leaseTTL)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, WithAlerterLease(lease))
+	}
+
+	if alertCfg.Metrics != nil {
+		metrics, err := NewMetricsReporter(*alertCfg.Metrics)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, WithAlerterReporter(metrics))
+	}
+	if app.desktopNotify {
+		opts = append(opts, WithAlerterReporter(NewToaster()))
+	}
+
+	if err := privacyOK("pushover", alertCfg.PushoverPrivacy); err != nil {
+		return err
+	}
+	var notifier Notifier = pushoverClient
+	if alertCfg.PushoverPrivacy == PrivacyHashed {
+		notifier = HashingNotifier{Notifier: pushoverClient, Logger: newInfoLogger()}
+	}
+	if notifier, err = alertCfg.failoverNotifier(notifier, logger); err != nil {
+		return err
+	}
+
+	alerter, err := NewAlerter(gmailClient, notifier, opts...)
+	if err != nil {
 		return err
 	}
 
+	for _, alt := range alertCfg.Alerts {
+		for _, query := range alt.gmailQueries() {
+			for _, issue := range LintQuery(query) {
+				alerter.errorLog().Printf("warning: gmail query of alert %q may be invalid: %s", alt.key(), issue)
+			}
+		}
+	}
+
+	if app.daemon {
+		defer func() {
+			if v := recover(); v != nil {
+				app.reportCrash(v, debug.Stack(), alertCfg.Alerts)
+				panic(v)
+			}
+		}()
+		ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if app.control != nil && app.controlAddr != "" {
+			token, err := readControlToken(app.controlTokenFile)
+			if err != nil {
+				return err
+			}
+			l, err := net.Listen(controlNetwork(app.controlAddr))
+			if err != nil {
+				return fmt.Errorf("got error listening for control api connections: %v", err)
+			}
+			defer l.Close()
+			ctx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			go func() {
+				if err := ServeControl(ctx, l, app.control, token); err != nil {
+					alerter.errorLog().Printf("control api stopped: %v", err)
+				}
+			}()
+		}
+		if app.httpAddr != "" {
+			var auth httpAPIAuth
+			if auth.secret, err = readHTTPAPISecret(app.httpSecretFile); err != nil {
+				return err
+			}
+			if auth.readToken, err = readHTTPAPISecret(app.httpReadTokenFile); err != nil {
+				return err
+			}
+			l, err := net.Listen("tcp", app.httpAddr)
+			if err != nil {
+				return fmt.Errorf("got error listening for http api connections: %v", err)
+			}
+			defer l.Close()
+			if err := auth.checkAddr(l.Addr()); err != nil {
+				return fmt.Errorf("%v, set -http-secret-file or serve it on a loopback address like localhost:8080", err)
+			}
+			ctx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			go func() {
+				if err := serveHTTPAPI(ctx, l, control, auth, alertCfg.feed()); err != nil {
+					alerter.errorLog().Printf("http api stopped: %v", err)
+				}
+			}()
+		}
+		if len(evaluateSignals) > 0 {
+			evaluate := make(chan os.Signal, 1)
+			signal.Notify(evaluate, evaluateSignals...)
+			defer signal.Stop(evaluate)
+			go func() {
+				for {
+					select {
+					case <-ctx.Done():
+						return
+					case sig := <-evaluate:
+						alerter.Logger.Printf("got %v signal, evaluating every alert now", sig)
+						control.EvaluateNow("")
+					}
+				}
+			}()
+		}
+		if lease != nil {
+			ctx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			go lease.Keep(ctx, alerter.errorLog())
+		}
+		if app.monitor != nil && !app.reloaded {
+			app.monitor.Started()
+		}
+		err := app.poll(ctx, alerter, alertCfg.Alerts)
+		if app.monitor != nil && !errors.Is(err, errConfigChanged) {
+			app.monitor.Stopped(err)
+		}
+		if lease != nil && !errors.Is(err, errConfigChanged) {
+			if releaseErr := lease.Release(); releaseErr != nil {
+				alerter.errorLog().Printf("got error releasing lease: %v", releaseErr)
+			}
+		}
+		return err
+	}
+
+	if _, err := alerter.Run(alertCfg.Alerts); err != nil {
+		return err
+	}
+
+	if state != nil {
+		return state.Save()
+	}
+
 	return nil
 }
 
 // cliEnv is a type representing the CLI application environment.
 type cliEnv struct {
-	alertsConfigFile string
-	credsFile        string
-	tokenFile        string
-	redirectSvrPort  int
-	debug            bool
+	alertsConfigFile  string
+	alertsCfgHeader   string
+	alertsCfgCache    string
+	alertsCfgKey      string
+	alertsCfgRefresh  time.Duration
+	alertsCfgJitter   time.Duration
+	alertsSource      *configSource
+	credsFile         string
+	tokenFile         string
+	modifyTokenFile   string
+	gmailScope        string
+	redirectSvrPort   int
+	configDir         string
+	profile           string
+	stateFile         string
+	historyFile       string
+	outboxFile        string
+	alertLogsFile     string
+	alertLogs         *AlertLogs
+	validatePushover  bool
+	daemon            bool
+	desktopNotify     bool
+	minInterval       time.Duration
+	maxInterval       time.Duration
+	spread            string
+	shards            int
+	skipUnchanged     bool
+	reloadInterval    time.Duration
+	controlAddr       string
+	controlTokenFile  string
+	httpAddr          string
+	httpSecretFile    string
+	httpReadTokenFile string
+	leaseFile         string
+	leaseTTL          time.Duration
+	crashDir          string
+	tuning            string
+	control           *Control
+	gmailClients      *gmailClientPool
+	monitor           *Monitor
+	reloaded          bool
+	configAgentSocket string
+	passphrase        *string
+	explain           bool
+	debug             bool
 }
 
 // fromArgs accepts a slice of command line flags, parses them, and encodes
@@ -86,42 +486,416 @@ type cliEnv struct {
 // is encountered during parsing or if any of the given command line flags
 // has an empty value.
 func (c *cliEnv) fromArgs(args []string) error {
-	fs := flag.NewFlagSet("gmailalert", flag.ContinueOnError)
-	fs.SetOutput(os.Stderr)
+	fs := c.flagSet("gmailalert")
+	fs.BoolVar(
+		&c.validatePushover,
+		"validate-pushover",
+		false,
+		"check the pushover app token and every alert's recipient key with the pushover api before processing alerts")
+	fs.StringVar(
+		&c.outboxFile,
+		"outbox-file",
+		"",
+		"json file to persist notifications into until they are sent, so that unsent notifications are retried on the next run (disabled if empty)")
+	fs.StringVar(
+		&c.alertLogsFile,
+		"alert-logs-file",
+		"",
+		`json file to keep the recent log lines of each alert's evaluations in, for the "logs" subcommand (in daemon mode, they are also kept in memory for the control api)`)
+	fs.BoolVar(
+		&c.daemon,
+		"daemon",
+		false,
+		"keep running and process each alert repeatedly, more often while its matches change and less often while they do not")
+	fs.BoolVar(
+		&c.desktopNotify,
+		"desktop-notify",
+		false,
+		"run in daemon mode and show a desktop notification for every notified alert and whenever alerts start or stop failing")
+	fs.DurationVar(
+		&c.minInterval,
+		"min-interval",
+		time.Minute,
+		"the shortest interval between two runs of an alert in daemon mode")
+	fs.DurationVar(
+		&c.maxInterval,
+		"max-interval",
+		30*time.Minute,
+		"the longest interval between two runs of an alert in daemon mode")
+	fs.StringVar(
+		&c.spread,
+		"spread",
+		string(SpreadNone),
+		`how to spread the runs of alerts across their interval in daemon mode, one of "none" (run all alerts at once), "even", or "hash"`)
+	fs.IntVar(
+		&c.shards,
+		"shards",
+		0,
+		"split alerts into this many cohorts in daemon mode and run one cohort every -max-interval divided by it, so that every alert runs once per -max-interval (disabled if 0)")
+	fs.BoolVar(
+		&c.skipUnchanged,
+		"skip-unchanged",
+		false,
+		"skip the alerts whose last run found no emails while the mailbox has not changed since, checked with one gmail request per run, in daemon mode")
+	fs.DurationVar(
+		&c.reloadInterval,
+		"reload-interval",
+		30*time.Second,
+		"how often to check in daemon mode whether the alerts config, credentials, or token file changed, reloading them if so (disabled if 0)")
+	fs.DurationVar(
+		&c.alertsCfgRefresh,
+		"alerts-cfg-refresh",
+		5*time.Minute,
+		"how often to fetch the alerts config again in daemon mode if it is a url, reloading it if it changed (disabled if 0)")
+	fs.DurationVar(
+		&c.alertsCfgJitter,
+		"alerts-cfg-jitter",
+		30*time.Second,
+		"the longest random delay added to each -alerts-cfg-refresh interval, so that daemons sharing a url do not fetch it at once")
+	fs.StringVar(
+		&c.controlAddr,
+		"control-addr",
+		"",
+		`the address to serve the control api on in daemon mode, either "host:port" or "unix:<socket path>" (disabled if empty)`)
+	fs.StringVar(
+		&c.controlTokenFile,
+		"control-token-file",
+		"",
+		"file holding the bearer token that calls to the control api must carry (unauthenticated if empty, which is only allowed on loopback addresses and unix sockets)")
+	fs.StringVar(
+		&c.httpAddr,
+		"http-addr",
+		"",
+		`the "host:port" address to serve the http api on in daemon mode, where "POST /run" evaluates every alert immediately, which must be a loopback address unless -http-secret-file is set (disabled if empty)`)
+	fs.StringVar(
+		&c.httpSecretFile,
+		"http-secret-file",
+		"",
+		"file holding the secret that requests to the http api must carry as a bearer token or be signed with like webhooks (unauthenticated if empty, which is only allowed on a loopback -http-addr)")
+	fs.StringVar(
+		&c.httpReadTokenFile,
+		"http-read-token-file",
+		"",
+		`file holding a bearer token that only authenticates the read-only "GET /alerts/recent" and "GET /alerts/feed" requests to the http api, for dashboards and feed readers (requires -http-secret-file)`)
+	fs.StringVar(
+		&c.leaseFile,
+		"lease-file",
+		"",
+		"json file shared by redundant instances, so that only the instance holding the lease in it sends notifications (disabled if empty)")
+	fs.DurationVar(
+		&c.leaseTTL,
+		"lease-ttl",
+		time.Minute,
+		"how long the lease in the lease file is held without being renewed before another instance takes it over")
+	fs.StringVar(
+		&c.crashDir,
+		"crash-dir",
+		".",
+		"directory to write a json crash report into if the daemon crashes unexpectedly, with the stack trace, version, and a hash of the configuration (disabled if empty)")
+	fs.StringVar(
+		&c.tuning,
+		"tuning",
+		TuningDefault,
+		`the settings to run with unless the alerts config sets them, either "default" or "low-power" for fewer concurrent evaluations, longer http timeouts, batched gmail fetches, and only errors and warnings logged, like on a raspberry pi`)
+	if err := c.parse(fs, args); err != nil {
+		return err
+	}
+	if c.desktopNotify {
+		c.daemon = true
+	}
+
+	if c.daemon && (c.minInterval <= 0 || c.maxInterval < c.minInterval) {
+		fs.Usage()
+		return errors.New(`command line flags "-min-interval" "-max-interval" must be positive with "-min-interval" no greater than "-max-interval"`)
+	}
+	if err := Spread(c.spread).ok(); err != nil {
+		fs.Usage()
+		return err
+	}
+	if c.shards < 0 {
+		fs.Usage()
+		return errors.New(`command line flag "-shards" must not be negative`)
+	}
+	if _, err := (AlertConfig{}).tuned(c.tuning); err != nil {
+		fs.Usage()
+		return err
+	}
+	if c.alertsCfgRefresh < 0 || c.alertsCfgJitter < 0 {
+		fs.Usage()
+		return errors.New(`command line flags "-alerts-cfg-refresh" "-alerts-cfg-jitter" must not be negative`)
+	}
+
+	return nil
+}
+
+// leaseHolder returns the name identifying this instance in a lease file,
+// made of the host name and the process ID.
+func leaseHolder() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// stateSaver represents a Reporter that saves a State after every run, so
+// that the notification history survives a restart in daemon mode.
+type stateSaver struct {
+	state *State
+}
+
+// Report saves the State of the receiver s. An error is returned if the
+// State cannot be saved.
+func (s stateSaver) Report(_ Summary) error {
+	return s.state.Save()
+}
+
+// flagSet returns a new flag.FlagSet with the given name that encodes the
+// command line flags shared by gmailalert and its subcommands into the
+// cliEnv receiver.
+func (c *cliEnv) flagSet(name string) *flag.FlagSet {
+	fs := newFlagSet(name)
 	fs.StringVar(
 		&c.alertsConfigFile,
 		"alerts-cfg-file",
 		"alerts.json",
-		"json file containing the alerting criteria")
+		`json file containing the alerting criteria, "-" to read it from stdin, or an http:// or https:// url to fetch it from`)
+	fs.StringVar(
+		&c.alertsCfgHeader,
+		"alerts-cfg-header",
+		"",
+		`the http header to send when fetching the alerting criteria from a url, like "Authorization: Bearer <token>" (none if empty)`)
+	fs.StringVar(
+		&c.alertsCfgCache,
+		"alerts-cfg-cache",
+		"alerts-cfg-cache.json",
+		"json file to cache the alerting criteria fetched from a url in, used while the url cannot be reached (disabled if empty)")
+	fs.StringVar(
+		&c.alertsCfgKey,
+		"alerts-cfg-public-key",
+		"",
+		`the base64-encoded ed25519 public key verifying the alerting criteria against its signature in the file or at the url with ".sig" appended (unverified if empty)`)
 	fs.StringVar(
 		&c.credsFile,
 		"credentials-file",
 		"credentials.json",
-		"json file containing your Google Developers Console credentials")
+		"json file containing your Google Developers Console credentials, or several comma-separated files while rotating them, with the new one first")
 	fs.StringVar(
 		&c.tokenFile,
 		"token-file",
 		"token.json",
 		"json file to read your Gmail OAuth2 token from (if present), or to save your Gmail OAuth2 token into (if not present)")
+	fs.StringVar(
+		&c.modifyTokenFile,
+		"modify-token-file",
+		"token-modify.json",
+		"json file of a separate Gmail OAuth2 token allowed to modify the mailbox, only loaded for mailbox actions, while -token-file stays read-only")
 	fs.IntVar(
 		&c.redirectSvrPort,
 		"port",
 		9999,
 		"the port for the local http server to listen on for redirects from the Gmail OAuth2 resource provider",
 	)
+	fs.StringVar(
+		&c.configDir,
+		"config-dir",
+		"",
+		"the directory that relative config, credentials, token, state, history, outbox, and lease file names are resolved against (the working directory if empty)")
+	fs.StringVar(
+		&c.profile,
+		"profile",
+		"",
+		"the name of the profile in the alerts config to use (all profiles if empty)")
+	fs.StringVar(
+		&c.configAgentSocket,
+		"config-agent-socket",
+		"",
+		"the unix socket of the \"config agent\" subcommand serving the passphrase of an encrypted alerts config (asked for on the terminal if empty)")
+	fs.StringVar(
+		&c.stateFile,
+		"state-file",
+		"",
+		"json file to persist notification history into for enforcing alert repeat intervals, compressed with zstandard if it ends in .zst or gzip if it ends in .gz, or the sqlite database file with the sqlite state backend (disabled if empty)")
+	fs.StringVar(
+		&c.historyFile,
+		"history-file",
+		"",
+		"json lines file to record every evaluation of every alert into for statistics, compacted into zstandard compressed segments next to it once it grows to 1MB (disabled if empty)")
+	fs.BoolVar(
+		&c.explain,
+		"explain",
+		false,
+		"print a decision trace of every alert's evaluation: the query, matches, filters, threshold, routing, and final action")
 	fs.BoolVar(
 		&c.debug,
 		"debug",
 		false,
 		"enable debug-level-logging")
+
+	return fs
+}
+
+// parse parses the given command line flags with the given flag.FlagSet, sets
+// every flag not given on the command line from its environment variable if
+// that is set, and resolves the relative file names in the cliEnv receiver
+// against its config directory. An error is returned if the flags or
+// environment variables cannot be parsed or if the flags are invalid.
+func (c *cliEnv) parse(fs *flag.FlagSet, args []string) error {
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
 
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		v, ok := os.LookupEnv(envVarName(f.Name))
+		if given[f.Name] || !ok || err != nil {
+			return
+		}
+		if setErr := fs.Set(f.Name, v); setErr != nil {
+			err = fmt.Errorf("got error setting flag -%s from environment variable %s: %v", f.Name, envVarName(f.Name), setErr)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	c.credsFile = c.resolveFiles(c.credsFile)
+	for _, file := range []*string{&c.tokenFile, &c.modifyTokenFile, &c.stateFile, &c.historyFile, &c.outboxFile, &c.alertLogsFile, &c.leaseFile, &c.alertsCfgCache, &c.httpSecretFile, &c.httpReadTokenFile, &c.crashDir} {
+		*file = c.resolve(*file)
+	}
+	if c.alertsConfigFile != stdinConfig && !isConfigURL(c.alertsConfigFile) {
+		c.alertsConfigFile = c.resolve(c.alertsConfigFile)
+	}
+	if c.alertsSource, err = newConfigSource(c.alertsConfigFile, c.alertsCfgHeader, c.alertsCfgCache, c.alertsCfgKey); err != nil {
+		return err
+	}
+
+	return c.validate(fs)
+}
+
+// envVarName returns the name of the environment variable that sets the
+// command line flag with the given name, like GMAILALERT_STATE_FILE for
+// "state-file".
+func envVarName(flagName string) string {
+	return "GMAILALERT_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// validate returns an error, after printing the usage of the given
+// flag.FlagSet, if any of the required command line flags in the cliEnv
+// receiver have an empty value, or if the http api read token is given
+// without the secret, which would leave "POST /run" unauthenticated.
+func (c *cliEnv) validate(fs *flag.FlagSet) error {
 	if c.credsFile == "" || c.alertsConfigFile == "" {
 		fs.Usage()
 		return errors.New(`command line flags "-credentials-file" "-alerts-cfg-file" must be non-empty`)
 	}
+	if c.httpReadTokenFile != "" && c.httpSecretFile == "" {
+		return errors.New(`command line flag "-http-read-token-file" requires "-http-secret-file"`)
+	}
 
 	return nil
 }
+
+// alertConfig reads the alert configuration named in the cliEnv receiver,
+// decrypts it if it is encrypted, and decodes it into an AlertConfig. An
+// error is returned if it cannot be read, decrypted, or decoded.
+func (c cliEnv) alertConfig() (AlertConfig, error) {
+	b, err := c.readAlertsConfig()
+	if err != nil {
+		return AlertConfig{}, err
+	}
+	if isEncryptedConfig(b) {
+		if b, err = c.decryptConfig(b); err != nil {
+			return AlertConfig{}, err
+		}
+	}
+
+	return DecodeAlerts(bytes.NewReader(b))
+}
+
+// readAlertsConfig returns the contents of the alert configuration named in
+// the cliEnv receiver, which is read from a file, from stdin, or from a URL.
+// An error is returned if it cannot be read.
+func (c cliEnv) readAlertsConfig() ([]byte, error) {
+	if c.alertsSource == nil {
+		return os.ReadFile(c.alertsConfigFile)
+	}
+
+	return c.alertsSource.read()
+}
+
+// debugLogger returns a Logger writing debug-level output to stdout if
+// debugging is enabled in the cliEnv receiver, or discarding it otherwise.
+func (c cliEnv) debugLogger() Logger {
+	if c.debug {
+		return log.New(os.Stdout, "DEBUG: ", log.LstdFlags|log.Lshortfile)
+	}
+
+	return log.New(io.Discard, "", log.LstdFlags)
+}
+
+// gmailClient returns a GmailClient configured from the cliEnv receiver that
+// writes its debug output to the given Logger and sends its requests with the
+// HTTP settings and proxy of the given AlertConfig. In daemon mode, the
+// GmailClient is reused from earlier runs if it is still configured the same
+// and healthy, as described by gmailClientPool. An error is returned if the
+// settings are invalid or the GmailClient cannot be created.
+func (c cliEnv) gmailClient(debugLogger Logger, alertCfg AlertConfig) (*GmailClient, error) {
+	create := func() (*GmailClient, error) {
+		httpClient, err := alertCfg.GmailHTTPClient()
+		if err != nil {
+			return nil, err
+		}
+
+		return NewGmailClient(
+			GmailClientConfig{
+				CredentialsFile: c.credsFile,
+				TokenFile:       c.tokenFile,
+				Scope:           c.gmailScope,
+				UserInput:       os.Stdin,
+				RedirectSvrPort: c.redirectSvrPort,
+				Logger:          debugLogger,
+				HTTPClient:      httpClient,
+			},
+		)
+	}
+	if c.gmailClients == nil {
+		return create()
+	}
+
+	return c.gmailClients.get(c.gmailClientKey(alertCfg), c.tokenFile, c.credentialsFingerprint(), newInfoLogger(), create)
+}
+
+// modifyClient returns a GmailClient like gmailClient, but authorized with
+// the token in the modify token file of the cliEnv receiver, which may modify
+// the mailbox, for running the mailbox actions of alerts.
+func (c cliEnv) modifyClient(debugLogger Logger, alertCfg AlertConfig) (*GmailClient, error) {
+	c.tokenFile, c.gmailScope = c.modifyTokenFile, gmail.GmailModifyScope
+	return c.gmailClient(debugLogger, alertCfg)
+}
+
+// pushoverClient returns a PushoverClient for the Pushover app of the given
+// AlertConfig that writes its debug output to the given Logger and sends its
+// requests with the Pushover HTTP settings and proxy of the AlertConfig. An
+// error is returned if the settings are invalid or the PushoverClient cannot
+// be created.
+func (c cliEnv) pushoverClient(alertCfg AlertConfig, debugLogger Logger) (PushoverClient, error) {
+	httpClient, err := alertCfg.PushoverHTTPClient()
+	if err != nil {
+		return PushoverClient{}, err
+	}
+
+	formatter, err := alertCfg.formatter(FormatPushover)
+	if err != nil {
+		return PushoverClient{}, err
+	}
+
+	return NewPushoverClient(alertCfg.PushoverApp,
+		WithPushoverClientLogger(debugLogger),
+		WithPushoverClientHTTPClient(httpClient),
+		WithPushoverClientMaxLength(alertCfg.pushoverMaxLength()),
+		WithPushoverClientFormatter(formatter))
+}
@@ -1,6 +1,9 @@
 package gmailalert_test
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/aculclasure/gmailalert"
@@ -15,3 +18,45 @@ func TestCLIWithInvalidArgsReturnsError(t *testing.T) {
 		t.Error("expected an error but did not get one")
 	}
 }
+
+func TestCLITestNotifyWithUnknownAlertReturnsError(t *testing.T) {
+	t.Parallel()
+
+	cfgFile := filepath.Join(t.TempDir(), "alerts.json")
+	cfg := `{"pushoverapp": "test", "alerts": [{"name": "bills", "gmailquery": "subject:bill"}]}`
+	if err := os.WriteFile(cfgFile, []byte(cfg), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	commandLineArgs := []string{"test-notify", "-alerts-cfg-file=" + cfgFile, "-alert=missing"}
+
+	if err := gmailalert.CLI(commandLineArgs); err == nil {
+		t.Error("expected an error but did not get one")
+	}
+}
+
+func TestCLIDaemonWithInvalidIntervalsReturnsError(t *testing.T) {
+	t.Parallel()
+
+	commandLineArgs := []string{"-daemon", "-min-interval=10m", "-max-interval=1m"}
+
+	if err := gmailalert.CLI(commandLineArgs); err == nil {
+		t.Error("expected an error but did not get one")
+	}
+}
+
+func TestCLIReadsFlagsFromEnvironmentAndConfigDir(t *testing.T) {
+	dir := t.TempDir()
+	cfg := `{"pushoverapp": "test", "alerts": [{"name": "bills", "gmailquery": "subject:bill"}]}`
+	if err := os.WriteFile(filepath.Join(dir, "alerts.json"), []byte(cfg), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GMAILALERT_CONFIG_DIR", dir)
+	t.Setenv("GMAILALERT_ALERT", "missing")
+
+	err := gmailalert.CLI([]string{"test-notify"})
+
+	if err == nil || !strings.Contains(err.Error(), `no alert named "missing"`) {
+		t.Errorf("want an error for the alert named in the environment, got: %v", err)
+	}
+}
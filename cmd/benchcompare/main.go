@@ -0,0 +1,171 @@
+// Command benchcompare compares two files of "go test -bench" output, like
+// those of a base revision and of a change, and prints the change of the
+// mean time, memory, and allocations of every benchmark found in both. It
+// exits with status 1 if any benchmark got slower by more than the
+// -threshold percentage, so that any CI system, or a developer, can gate on
+// it without extra tooling:
+//
+//	benchcompare [-threshold 10] old.txt new.txt
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// The units of the benchmark results compared.
+var units = []string{"ns/op", "B/op", "allocs/op"}
+
+// results maps the name of each benchmark to the values it was run with,
+// for each unit.
+type results map[string]map[string][]float64
+
+func main() {
+	threshold := flag.Float64("threshold", 10, "the percentage by which the time of a benchmark may grow before exiting with status 1")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: benchcompare [flags] old.txt new.txt")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	old, err := parseFile(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	cur, err := parseFile(flag.Arg(1))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if regressed := compare(os.Stdout, old, cur, *threshold); len(regressed) > 0 {
+		fmt.Printf("\n%d benchmarks got slower by more than %g%%: %s\n", len(regressed), *threshold, strings.Join(regressed, ", "))
+		os.Exit(1)
+	}
+}
+
+// parseFile returns the results of the benchmarks in the "go test -bench"
+// output file with the given name. An error is returned if the file cannot
+// be read.
+func parseFile(name string) (results, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("got error opening benchmark file: %v", err)
+	}
+	defer f.Close()
+
+	res, err := parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("got error reading benchmark file %s: %v", name, err)
+	}
+
+	return res, nil
+}
+
+// parse returns the results of the benchmarks in the "go test -bench"
+// output read from the given io.Reader, like
+// "BenchmarkBodyText-8   10   101109190 ns/op   199919936 B/op". The
+// GOMAXPROCS suffix of the names is dropped, and lines that are not
+// benchmark results are ignored. An error is returned if the output cannot
+// be read.
+func parse(r io.Reader) (results, error) {
+	res := results{}
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 4 || !strings.HasPrefix(fields[0], "Benchmark") {
+			continue
+		}
+		if _, err := strconv.Atoi(fields[1]); err != nil {
+			continue
+		}
+		name := fields[0]
+		if i := strings.LastIndex(name, "-"); i > 0 {
+			if _, err := strconv.Atoi(name[i+1:]); err == nil {
+				name = name[:i]
+			}
+		}
+		for i := 2; i+1 < len(fields); i += 2 {
+			v, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				continue
+			}
+			if res[name] == nil {
+				res[name] = map[string][]float64{}
+			}
+			res[name][fields[i+1]] = append(res[name][fields[i+1]], v)
+		}
+	}
+
+	return res, sc.Err()
+}
+
+// compare writes a table of the mean results of the benchmarks found in
+// both the old and the current results to the given io.Writer, with their
+// change in percent, and returns the names of the benchmarks whose time
+// grew by more than the given percentage.
+func compare(w io.Writer, old, cur results, threshold float64) []string {
+	names := make([]string, 0, len(cur))
+	for name := range cur {
+		if _, ok := old[name]; ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		fmt.Fprintln(w, "no benchmarks found in both files")
+		return nil
+	}
+
+	var regressed []string
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "benchmark\tunit\told\tnew\tdelta\t")
+	for _, name := range names {
+		for _, unit := range units {
+			o, ok := mean(old[name][unit])
+			if !ok {
+				continue
+			}
+			c, ok := mean(cur[name][unit])
+			if !ok {
+				continue
+			}
+			delta := "~"
+			if o != 0 {
+				pct := (c - o) / o * 100
+				delta = fmt.Sprintf("%+.1f%%", pct)
+				if unit == "ns/op" && pct > threshold {
+					regressed = append(regressed, name)
+				}
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%.0f\t%.0f\t%s\t\n", name, unit, o, c, delta)
+		}
+	}
+	tw.Flush()
+
+	return regressed
+}
+
+// mean returns the mean of the given values and reports whether there are
+// any.
+func mean(values []float64) (float64, bool) {
+	if len(values) == 0 {
+		return 0, false
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+
+	return sum / float64(len(values)), true
+}
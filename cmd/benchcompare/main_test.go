@@ -0,0 +1,84 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCompareBenchmarkFiles(t *testing.T) {
+	t.Parallel()
+
+	const old = `goos: linux
+goarch: amd64
+pkg: github.com/aculclasure/gmailalert
+BenchmarkAlerterRun-8   	     100	  10000000 ns/op	  2000 B/op	  20 allocs/op
+BenchmarkAlerterRun-8   	     100	  12000000 ns/op	  2000 B/op	  20 allocs/op
+BenchmarkBodyText-8     	    1000	   1000000 ns/op	   500 B/op	   5 allocs/op
+PASS
+`
+	testCases := map[string]struct {
+		cur           string
+		threshold     float64
+		wantRegressed []string
+		errExpected   bool
+	}{
+		"Benchmark slower by more than the threshold is a regression": {
+			cur: `BenchmarkAlerterRun-4   	     100	  13200000 ns/op	  2000 B/op	  20 allocs/op
+BenchmarkBodyText-4     	    1000	   1000000 ns/op	   500 B/op	   5 allocs/op
+`,
+			threshold:     10,
+			wantRegressed: []string{"BenchmarkAlerterRun"},
+		},
+		"Benchmark slower by less than the threshold is not a regression": {
+			cur: `BenchmarkAlerterRun-8   	     100	  11500000 ns/op	  4000 B/op	  40 allocs/op
+BenchmarkBodyText-8     	    1000	    900000 ns/op	   500 B/op	   5 allocs/op
+`,
+			threshold: 10,
+		},
+		"Benchmark missing from the old file is not compared": {
+			cur: `BenchmarkNew-8   	     100	  99000000 ns/op
+`,
+			threshold: 10,
+		},
+		"Missing file returns error": {
+			errExpected: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			oldFile, curFile := filepath.Join(dir, "old.txt"), filepath.Join(dir, "new.txt")
+			if err := os.WriteFile(oldFile, []byte(old), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if !tc.errExpected {
+				if err := os.WriteFile(curFile, []byte(tc.cur), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			oldRes, err := parseFile(oldFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			curRes, err := parseFile(curFile)
+			errReceived := err != nil
+
+			if errReceived != tc.errExpected {
+				t.Fatalf("parseFile returned unexpected error status: %v", err)
+			}
+			if tc.errExpected {
+				return
+			}
+			got := compare(io.Discard, oldRes, curRes, tc.threshold)
+			if !cmp.Equal(tc.wantRegressed, got) {
+				t.Errorf("want != got\ndiff=%s", cmp.Diff(tc.wantRegressed, got))
+			}
+		})
+	}
+}
@@ -0,0 +1,608 @@
+package gmailalert
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// command describes gmailalert or one of its subcommands, from which the
+// command line is dispatched and its help and manual page are rendered.
+type command struct {
+	// The name of the command, like "filters" for "config filters".
+	name string
+	// The arguments the command accepts after its name, with a line for
+	// each form of the command.
+	usage string
+	// A one-line summary of what the command does.
+	summary string
+	// A paragraph describing the command in detail.
+	description string
+	// Command lines showing how the command is used.
+	examples []string
+	// The subcommands of the command, if any.
+	subcommands []command
+	// The function handling the command line flags of the command, which is
+	// nil for a command that only groups its subcommands.
+	run func(args []string) error
+}
+
+// rootCommand returns the command describing gmailalert and, through its
+// subcommands, every subcommand of gmailalert. The command line flags of
+// gmailalert itself are handled by CLI.
+func rootCommand() command {
+	return command{
+		name:    "gmailalert",
+		usage:   "[flags]\n<command> [flags]",
+		summary: "send pushover notifications for the emails matching gmail queries",
+		description: "gmailalert runs the Gmail query of every alert in the alerts config and sends a Pushover notification " +
+			"for each alert with matching emails, either once or, with -daemon, repeatedly. " +
+			"Every flag can also be set with the environment variable named after it, like GMAILALERT_STATE_FILE for -state-file.",
+		examples: []string{
+			"gmailalert -alerts-cfg-file alerts.json",
+			"gmailalert -alerts-cfg-file alerts.json -daemon -min-interval 2m -max-interval 1h",
+		},
+		subcommands: []command{
+			{
+				name:    "auth",
+				usage:   "[flags]",
+				summary: "create the gmail oauth2 token file without a browser on this machine",
+				description: "Without -code, auth prints the URL for authorizing gmailalert. Once gmailalert is authorized, " +
+					"the browser is redirected to a URL with a \"code\" query parameter, whose value is exchanged for a token " +
+					"with -code and saved into the token file.",
+				examples: []string{
+					"gmailalert auth -token-file token.json",
+					"gmailalert auth -code 4/0Adeu5B...",
+				},
+				subcommands: []command{
+					{
+						name:        "export",
+						usage:       "[flags]",
+						summary:     "write the token file to stdout",
+						description: "With -encryption-key, the token is encrypted before it is written.",
+						examples:    []string{"gmailalert auth export -encryption-key \"$KEY\" > token.enc"},
+						run:         func(args []string) error { return authTransferCLI("export", args) },
+					},
+					{
+						name:        "import",
+						usage:       "[flags]",
+						summary:     "save the token read from stdin into the token file",
+						description: "With -encryption-key, the token is decrypted before it is saved.",
+						examples:    []string{"gmailalert auth import -token-file /etc/gmailalert/token.json < token.enc"},
+						run:         func(args []string) error { return authTransferCLI("import", args) },
+					},
+				},
+				run: authCLI,
+			},
+			{
+				name:    "backfill",
+				usage:   "[flags]",
+				summary: "record the past matches of an alert without sending notifications",
+				description: "backfill searches the mailbox for the emails matching the alert named by -alert since -since, " +
+					"one chunk of time at a time, and records them in the history file and as the baseline of the alert in the state file.",
+				examples: []string{"gmailalert backfill -history-file history.jsonl -alert \"Bill Due\" -since 2023-01-01"},
+				run:      backfillCLI,
+			},
+			{
+				name:    "config",
+				usage:   "<command> [flags]",
+				summary: "encrypt, decrypt, sign, serve, or export the alerts config",
+				subcommands: []command{
+					{
+						name:     "agent",
+						usage:    "[flags]",
+						summary:  "serve the passphrase of an encrypted alerts config to other gmailalert processes",
+						examples: []string{"gmailalert config agent -alerts-cfg-file alerts.json.enc -config-agent-socket $XDG_RUNTIME_DIR/gmailalert.sock"},
+						run:      agentCLI,
+					},
+					{
+						name:     "decrypt",
+						usage:    "[flags]",
+						summary:  "write the encrypted alerts config decrypted to stdout",
+						examples: []string{"gmailalert config decrypt -alerts-cfg-file alerts.json.enc > alerts.json"},
+						run:      func(args []string) error { return configCryptCLI("decrypt", args) },
+					},
+					{
+						name:     "encrypt",
+						usage:    "[flags]",
+						summary:  "write the alerts config encrypted with a passphrase to stdout",
+						examples: []string{"gmailalert config encrypt -alerts-cfg-file alerts.json > alerts.json.enc"},
+						run:      func(args []string) error { return configCryptCLI("encrypt", args) },
+					},
+					{
+						name:        "filters",
+						usage:       "[flags]",
+						summary:     "write the alerts as gmail filters to stdout",
+						description: "The filters can be imported in Gmail's \"Filters and Blocked Addresses\" settings.",
+						examples:    []string{"gmailalert config filters -alerts-cfg-file alerts.json > filters.xml"},
+						run:         filtersCLI,
+					},
+					{
+						name:    "sign",
+						usage:   "[flags]",
+						summary: "write the detached signature of the alerts config to stdout",
+						description: "sign signs the alerts config with the ed25519 private key in -signing-key-file. " +
+							"With -generate-key, it instead creates a new key pair, saves its private key into -signing-key-file, " +
+							"and prints its public key, which daemons are given with -alerts-cfg-public-key.",
+						examples: []string{
+							"gmailalert config sign -generate-key -signing-key-file signing.key",
+							"gmailalert config sign -alerts-cfg-file alerts.json -signing-key-file signing.key > alerts.json.sig",
+						},
+						run: configSignCLI,
+					},
+				},
+			},
+			{
+				name:    "ctl",
+				usage:   "[flags] status|list|evaluate [alert]|snooze <alert> <duration>",
+				summary: "control a gmailalert daemon through its control api",
+				examples: []string{
+					"gmailalert ctl -control-addr localhost:7070 list",
+					"gmailalert ctl -control-addr localhost:7070 snooze \"Invoices\" 2h",
+				},
+				run: ctlCLI,
+			},
+			{
+				name:    "diff",
+				usage:   "[flags]",
+				summary: "print the new, resolved, and persisting matches of alerts as json",
+				examples: []string{
+					"gmailalert diff -alerts-cfg-file alerts.json -alert \"Bill Due\"",
+				},
+				run: diffCLI,
+			},
+			{
+				name:     "export",
+				usage:    "[flags]",
+				summary:  "write the emails matching an alert as files into a directory",
+				examples: []string{"gmailalert export -alerts-cfg-file alerts.json -alert \"Bill Due\" -dir bills -format eml"},
+				run:      exportCLI,
+			},
+			{
+				name:     "help",
+				usage:    "[command]",
+				summary:  "print the help of gmailalert or of a command",
+				examples: []string{"gmailalert help config filters"},
+				run:      helpCLI,
+			},
+			{
+				name:     "history",
+				usage:    "[flags]",
+				summary:  "print the history file records of alerts",
+				examples: []string{"gmailalert history -history-file history.jsonl -alert \"Bill Due\" -window 168h"},
+				run:      historyCLI,
+			},
+			{
+				name:    "logs",
+				usage:   "[flags]",
+				summary: "print the recent log lines of an alert's evaluations",
+				description: "logs prints the most recent lines logged while evaluating the alert named by -alert, as kept " +
+					"by a daemon and read from its control api, or as kept in the file given by -alert-logs-file, " +
+					"to find out why an alert did or did not notify.",
+				examples: []string{
+					"gmailalert logs -alert \"Bill Due\" -limit 20",
+					"gmailalert logs -alert \"Bill Due\" -alert-logs-file alert-logs.json",
+				},
+				run: logsCLI,
+			},
+			{
+				name:     "manpage",
+				summary:  "write the manual page of gmailalert to stdout",
+				examples: []string{"gmailalert manpage > /usr/local/share/man/man1/gmailalert.1"},
+				run:      manpageCLI,
+			},
+			{
+				name:     "preview",
+				usage:    "[flags]",
+				summary:  "print the first emails matching an alert without sending notifications",
+				examples: []string{"gmailalert preview -alerts-cfg-file alerts.json -alert \"Bill Due\" -n 2"},
+				run:      previewCLI,
+			},
+			{
+				name:    "render",
+				usage:   "[flags]",
+				summary: "print the notification of an alert exactly as it would be sent",
+				description: "render evaluates the alert named by -alert against the mailbox, or against the email fixtures " +
+					"in the directory given by -fixtures, and prints its title, sound, priority, masked recipients, and message " +
+					"as they would be sent to Pushover, without sending anything.",
+				examples: []string{
+					"gmailalert render -alerts-cfg-file alerts.json -alert \"Bill Due\"",
+					"gmailalert render -alerts-cfg-file alerts.json -alert \"Bill Due\" -fixtures testdata/bills",
+				},
+				run: renderCLI,
+			},
+			{
+				name:    "replay",
+				usage:   "[flags]",
+				summary: "evaluate alerts against stored emails offline and print what they would notify",
+				description: "replay feeds the .eml or .json email fixtures in the directory given by -fixtures, like those " +
+					"written by \"gmailalert export\", through the matching and templating of alerts instead of the mailbox, " +
+					"so that alert definitions can be regression tested without network access. With -want-matches, " +
+					"replay fails if an alert does not match that many fixtures.",
+				examples: []string{
+					"gmailalert replay -alerts-cfg-file alerts.json -alert \"Bill Due\" -fixtures testdata/bills",
+					"gmailalert replay -alerts-cfg-file alerts.json -fixtures testdata/none -want-matches 0",
+				},
+				run: replayCLI,
+			},
+			{
+				name:    "simulate",
+				usage:   "[flags]",
+				summary: "poll alerts against scripted emails over virtual time and print what they would notify",
+				description: "simulate feeds the synthetic emails of the scenario file given by -scenario through the alerts as " +
+					"they arrive over virtual time, polling the alerts like the daemon, and prints the timeline of " +
+					"notifications, suppressions, and escalations, so that scheduling, repeat intervals, the dedup window, " +
+					"and emergency escalation can be checked before going live. Nothing is sent and no state is written.",
+				examples: []string{
+					"gmailalert simulate -alerts-cfg-file alerts.json -scenario scenario.json",
+					"gmailalert simulate -alerts-cfg-file alerts.json -scenario scenario.json -min-interval 5m -max-interval 1h",
+				},
+				run: simulateCLI,
+			},
+			{
+				name:    "stats",
+				usage:   "[flags]",
+				summary: "print the statistics of alerts computed from the history file",
+				examples: []string{
+					"gmailalert stats -history-file history.jsonl -window 168h",
+					"gmailalert stats -history-file history.jsonl -window 168h -report-format markdown",
+				},
+				run: statsCLI,
+			},
+			{
+				name:     "test-notify",
+				usage:    "[flags]",
+				summary:  "send a test notification for alerts without needing matching emails",
+				examples: []string{"gmailalert test-notify -alerts-cfg-file alerts.json -alert \"Bill Due\""},
+				run:      testNotifyCLI,
+			},
+			{
+				name:     "validate",
+				usage:    "[flags]",
+				summary:  "check the alerts config and its pushover keys",
+				examples: []string{"gmailalert validate -alerts-cfg-file alerts.json"},
+				run:      validateCLI,
+			},
+		},
+	}
+}
+
+// find returns the subcommand of the command receiver c named by the leading
+// arguments of the given slice, or c itself if the first argument names none,
+// along with the names of the subcommands on the way to it and the remaining
+// arguments.
+func (c command) find(args []string) (command, []string, []string) {
+	var path []string
+	for len(args) > 0 {
+		sub, ok := c.subcommand(args[0])
+		if !ok {
+			break
+		}
+		c, path, args = sub, append(path, sub.name), args[1:]
+	}
+
+	return c, path, args
+}
+
+// subcommand returns the subcommand of the command receiver c with the given
+// name, and whether there is one.
+func (c command) subcommand(name string) (command, bool) {
+	for _, sub := range c.subcommands {
+		if sub.name == name {
+			return sub, true
+		}
+	}
+
+	return command{}, false
+}
+
+// runCommand runs the subcommand of gmailalert named by the leading
+// arguments of the given slice with the remaining arguments, and reports
+// whether the arguments name a subcommand at all. An error is returned if the
+// subcommand only groups other subcommands and none of them is named, or if
+// the subcommand fails.
+func runCommand(args []string) (bool, error) {
+	cmd, path, rest := rootCommand().find(args)
+	if len(path) == 0 {
+		return false, nil
+	}
+	if cmd.run == nil {
+		names := make([]string, 0, len(cmd.subcommands))
+		for _, sub := range cmd.subcommands {
+			names = append(names, fmt.Sprintf("%q", sub.name))
+		}
+		return true, fmt.Errorf("%s subcommand must be one of %s", strings.Join(path, " "), strings.Join(names, ", "))
+	}
+
+	err := cmd.run(rest)
+	if errors.Is(err, flag.ErrHelp) {
+		return true, nil
+	}
+
+	return true, err
+}
+
+// newFlagSet returns a new flag.FlagSet with the given name, which is that of
+// the subcommand it belongs to, like "config filters", or "gmailalert". Its
+// usage prints the help of that subcommand.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	fs.Usage = func() {
+		path := strings.Fields(name)
+		if name == "gmailalert" {
+			path = nil
+		}
+		cmd, _, _ := rootCommand().find(path)
+		writeHelp(fs.Output(), cmd, path, fs)
+	}
+
+	flagSetRecorder.Lock()
+	if flagSetRecorder.record != nil {
+		flagSetRecorder.record(fs)
+	}
+	flagSetRecorder.Unlock()
+
+	return fs
+}
+
+// flagSetRecorder holds the function that newFlagSet calls with every
+// flag.FlagSet it creates while commandFlags collects the flags of a
+// subcommand.
+var flagSetRecorder struct {
+	sync.Mutex
+	record func(*flag.FlagSet)
+}
+
+// commandFlagsMtx makes calls to commandFlags wait for each other, since
+// they share the flagSetRecorder.
+var commandFlagsMtx sync.Mutex
+
+// commandFlags returns the flag.FlagSet of the given command, the
+// subcommand of gmailalert named by the given path, or of gmailalert itself
+// if the path is empty. The flags are collected by running the command with
+// the "-h" flag, which makes it return as soon as its flags are defined,
+// with its usage discarded. Nil is returned if the command has no flags.
+func commandFlags(cmd command, path []string) *flag.FlagSet {
+	commandFlagsMtx.Lock()
+	defer commandFlagsMtx.Unlock()
+
+	name := strings.Join(path, " ")
+	run := cmd.run
+	if len(path) == 0 {
+		name = "gmailalert"
+		run = func(args []string) error {
+			app := cliEnv{passphrase: new(string)}
+			return app.fromArgs(args)
+		}
+	}
+	if run == nil {
+		return nil
+	}
+
+	var flags *flag.FlagSet
+	flagSetRecorder.Lock()
+	flagSetRecorder.record = func(fs *flag.FlagSet) {
+		if fs.Name() == name {
+			fs.SetOutput(io.Discard)
+			flags = fs
+		}
+	}
+	flagSetRecorder.Unlock()
+	defer func() {
+		flagSetRecorder.Lock()
+		flagSetRecorder.record = nil
+		flagSetRecorder.Unlock()
+	}()
+
+	_ = run([]string{"-h"})
+
+	return flags
+}
+
+// writeHelp writes the help of the given command, the subcommand of
+// gmailalert named by the given path, to the given io.Writer: its usage, its
+// description, its subcommands, the flags of the given flag.FlagSet unless
+// it is nil, and its examples.
+func writeHelp(w io.Writer, cmd command, path []string, fs *flag.FlagSet) {
+	fullName := strings.Join(append([]string{"gmailalert"}, path...), " ")
+	for i, line := range strings.Split(cmd.usage, "\n") {
+		prefix := "Usage:"
+		if i > 0 {
+			prefix = "      "
+		}
+		fmt.Fprintln(w, strings.TrimRight(prefix+" "+fullName+" "+line, " "))
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, strings.ToUpper(cmd.summary[:1])+cmd.summary[1:]+".")
+	if cmd.description != "" {
+		fmt.Fprintf(w, "\n%s\n", cmd.description)
+	}
+
+	if len(cmd.subcommands) > 0 {
+		fmt.Fprintln(w, "\nCommands:")
+		width := 0
+		for _, sub := range cmd.subcommands {
+			if len(sub.name) > width {
+				width = len(sub.name)
+			}
+		}
+		for _, sub := range cmd.subcommands {
+			fmt.Fprintf(w, "  %-*s  %s\n", width, sub.name, sub.summary)
+		}
+	}
+
+	if hasFlags(fs) {
+		fmt.Fprintln(w, "\nFlags:")
+		out := fs.Output()
+		fs.SetOutput(w)
+		fs.PrintDefaults()
+		fs.SetOutput(out)
+	}
+
+	if len(cmd.examples) > 0 {
+		fmt.Fprintln(w, "\nExamples:")
+		for _, ex := range cmd.examples {
+			fmt.Fprintf(w, "  $ %s\n", ex)
+		}
+	}
+
+	if len(cmd.subcommands) > 0 {
+		fmt.Fprintf(w, "\nRun \"%s <command>\" for the help of a command.\n", strings.Join(append([]string{"gmailalert", "help"}, path...), " "))
+	}
+}
+
+// hasFlags reports whether the given flag.FlagSet is not nil and defines any
+// flags.
+func hasFlags(fs *flag.FlagSet) bool {
+	n := 0
+	if fs != nil {
+		fs.VisitAll(func(*flag.Flag) { n++ })
+	}
+
+	return n > 0
+}
+
+// helpCLI accepts the arguments of the "help" subcommand, which name the
+// subcommand of gmailalert to print the help of to stdout, or none for the
+// help of gmailalert itself. An error is returned if the arguments do not
+// name a subcommand.
+func helpCLI(args []string) error {
+	fs := newFlagSet("help")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cmd, path, rest := rootCommand().find(fs.Args())
+	if len(rest) > 0 {
+		return fmt.Errorf("unknown command %q, run \"gmailalert help\" for the list of commands", strings.Join(fs.Args(), " "))
+	}
+	writeHelp(os.Stdout, cmd, path, commandFlags(cmd, path))
+
+	return nil
+}
+
+// manpageCLI accepts the arguments of the "manpage" subcommand, which writes
+// the manual page of gmailalert and all of its subcommands to stdout in roff
+// format. An error is returned if any arguments are given or the manual page
+// cannot be written.
+func manpageCLI(args []string) error {
+	fs := newFlagSet("manpage")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return errors.New("manpage subcommand takes no arguments")
+	}
+
+	return writeManpage(os.Stdout, rootCommand())
+}
+
+// writeManpage writes the manual page of the given root command and all of
+// its subcommands to the given io.Writer in roff format, with a section for
+// each subcommand listing its examples and the flags it does not share with
+// every other subcommand. An error is returned if the manual page cannot be
+// written.
+func writeManpage(w io.Writer, root command) error {
+	var app cliEnv
+	common := map[string]bool{}
+	app.flagSet("").VisitAll(func(f *flag.Flag) { common[f.Name] = true })
+
+	var b strings.Builder
+	b.WriteString(".TH GMAILALERT 1\n")
+	fmt.Fprintf(&b, ".SH NAME\ngmailalert \\- %s\n", roffEscape(root.summary))
+	b.WriteString(".SH SYNOPSIS\n")
+	for _, line := range strings.Split(root.usage, "\n") {
+		fmt.Fprintf(&b, ".B gmailalert\n%s\n.br\n", roffEscape(line))
+	}
+	fmt.Fprintf(&b, ".SH DESCRIPTION\n%s\n", roffEscape(root.description))
+	b.WriteString(".SH OPTIONS\n")
+	writeManpageFlags(&b, commandFlags(root, nil), nil)
+	writeManpageExamples(&b, root.examples)
+
+	b.WriteString(".SH COMMANDS\n")
+	var walk func(cmd command, path []string)
+	walk = func(cmd command, path []string) {
+		for _, sub := range cmd.subcommands {
+			subPath := append(append([]string{}, path...), sub.name)
+			name := strings.Join(append([]string{"gmailalert"}, subPath...), " ")
+			fmt.Fprintf(&b, ".SS \"%s\"\n", roffEscape(name))
+			for _, line := range strings.Split(sub.usage, "\n") {
+				fmt.Fprintf(&b, ".B %s\n%s\n.br\n", roffEscape(name), roffEscape(line))
+			}
+			fmt.Fprintf(&b, ".PP\n%s.\n", roffEscape(sub.summary))
+			if sub.description != "" {
+				fmt.Fprintf(&b, ".PP\n%s\n", roffEscape(sub.description))
+			}
+			writeManpageFlags(&b, commandFlags(sub, subPath), common)
+			writeManpageExamples(&b, sub.examples)
+			walk(sub, subPath)
+		}
+	}
+	walk(root, nil)
+
+	_, err := io.WriteString(w, b.String())
+
+	return err
+}
+
+// writeManpageFlags writes the flags of the given flag.FlagSet, if it is not
+// nil, to the given strings.Builder as a roff list, except for the flags in
+// the given set of common flags, which are referred to the OPTIONS section.
+func writeManpageFlags(b *strings.Builder, fs *flag.FlagSet, common map[string]bool) {
+	if !hasFlags(fs) {
+		return
+	}
+	shared := false
+	fs.VisitAll(func(f *flag.Flag) {
+		if common[f.Name] {
+			shared = true
+			return
+		}
+		name, usage := flag.UnquoteUsage(f)
+		fmt.Fprintf(b, ".TP\n.B \\-%s", roffEscape(f.Name))
+		if name != "" {
+			fmt.Fprintf(b, " \\fI%s\\fR", roffEscape(name))
+		}
+		b.WriteString("\n" + roffEscape(usage))
+		if f.DefValue != "" && f.DefValue != "false" && f.DefValue != "0" {
+			fmt.Fprintf(b, " (default %s)", roffEscape(f.DefValue))
+		}
+		fmt.Fprintf(b, "\n(environment variable %s)\n", envVarName(f.Name))
+	})
+	if shared {
+		b.WriteString(".PP\nThe flags shared by every command, like \\-alerts\\-cfg\\-file, are described in OPTIONS.\n")
+	}
+}
+
+// writeManpageExamples writes the given examples to the given
+// strings.Builder as a roff block of unfilled lines.
+func writeManpageExamples(b *strings.Builder, examples []string) {
+	if len(examples) == 0 {
+		return
+	}
+	b.WriteString(".PP\nExamples:\n.PP\n.nf\n.RS\n")
+	for _, ex := range examples {
+		fmt.Fprintf(b, "$ %s\n", roffEscape(ex))
+	}
+	b.WriteString(".RE\n.fi\n")
+}
+
+// roffEscape returns the given text escaped for roff, with backslashes and
+// hyphens escaped and lines starting with a control character protected.
+func roffEscape(s string) string {
+	s = strings.NewReplacer(`\`, `\e`, "-", `\-`).Replace(s)
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, ".") || strings.HasPrefix(line, "'") {
+			lines[i] = `\&` + line
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
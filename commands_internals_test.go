@@ -0,0 +1,160 @@
+package gmailalert
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCommandFind(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		input    []string
+		wantName string
+		wantPath []string
+		wantRest []string
+	}{
+		"No arguments find the root command": {
+			input:    nil,
+			wantName: "gmailalert",
+			wantPath: nil,
+			wantRest: nil,
+		},
+		"Flags find the root command": {
+			input:    []string{"-daemon"},
+			wantName: "gmailalert",
+			wantPath: nil,
+			wantRest: []string{"-daemon"},
+		},
+		"Nested subcommand is found with its path": {
+			input:    []string{"config", "filters", "-label-prefix", "alerts/"},
+			wantName: "filters",
+			wantPath: []string{"config", "filters"},
+			wantRest: []string{"-label-prefix", "alerts/"},
+		},
+		"Arguments of a subcommand are not taken for subcommands": {
+			input:    []string{"ctl", "list"},
+			wantName: "ctl",
+			wantPath: []string{"ctl"},
+			wantRest: []string{"list"},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			cmd, path, rest := rootCommand().find(tc.input)
+
+			if tc.wantName != cmd.name {
+				t.Errorf("want command %q, got %q", tc.wantName, cmd.name)
+			}
+			if !cmp.Equal(tc.wantPath, path) {
+				t.Error(cmp.Diff(tc.wantPath, path))
+			}
+			if !cmp.Equal(tc.wantRest, rest) {
+				t.Error(cmp.Diff(tc.wantRest, rest))
+			}
+		})
+	}
+}
+
+func TestCommandsAreDescribed(t *testing.T) {
+	t.Parallel()
+
+	var walk func(cmd command, path string)
+	walk = func(cmd command, path string) {
+		if cmd.summary == "" {
+			t.Errorf("want a summary for command %q", path)
+		}
+		if cmd.run == nil && len(cmd.subcommands) == 0 {
+			t.Errorf("want a run function or subcommands for command %q", path)
+		}
+		for _, sub := range cmd.subcommands {
+			walk(sub, path+" "+sub.name)
+		}
+	}
+	walk(rootCommand(), "gmailalert")
+}
+
+func TestRunCommandWithGroupCommandReturnsError(t *testing.T) {
+	t.Parallel()
+
+	ok, err := runCommand([]string{"config", "unknown"})
+	if !ok {
+		t.Fatal("want config to be run as a subcommand")
+	}
+	if err == nil {
+		t.Error("expected an error but did not get one")
+	}
+}
+
+func TestWriteHelp(t *testing.T) {
+	t.Parallel()
+
+	cmd, path, _ := rootCommand().find([]string{"config", "filters"})
+	var buf bytes.Buffer
+
+	writeHelp(&buf, cmd, path, commandFlags(cmd, path))
+
+	got := buf.String()
+	for _, want := range []string{
+		"Usage: gmailalert config filters [flags]",
+		"-label-prefix",
+		"-alerts-cfg-file",
+		"$ gmailalert config filters -alerts-cfg-file alerts.json > filters.xml",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("want help to contain %q, got:\n%s", want, got)
+		}
+	}
+}
+
+func TestWriteManpage(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	if err := writeManpage(&buf, rootCommand()); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+
+	got := buf.String()
+	for _, want := range []string{
+		".TH GMAILALERT 1\n",
+		".SS \"gmailalert config filters\"\n",
+		".B \\-label\\-prefix \\fIstring\\fR\n",
+		".B \\-daemon\n",
+		"(environment variable GMAILALERT_STATE_FILE)\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("want manual page to contain %q", want)
+		}
+	}
+	if n := strings.Count(got, ".B \\-alerts\\-cfg\\-file"); n != 1 {
+		t.Errorf("want the common flags described once, got %d descriptions of -alerts-cfg-file", n)
+	}
+}
+
+func TestRoffEscape(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		input string
+		want  string
+	}{
+		"Hyphens are escaped":                  {input: "-state-file", want: `\-state\-file`},
+		"Backslashes are escaped":              {input: `a\b`, want: `a\eb`},
+		"Lines starting with a dot are quoted": {input: "a\n.b", want: "a\n\\&.b"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got := roffEscape(tc.input)
+
+			if tc.want != got {
+				t.Errorf("want %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,390 @@
+package gmailalert
+
+import (
+	"fmt"
+	"net/mail"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// conditionVars describes the variables a Condition can use, by name.
+var conditionVars = map[string]string{
+	"matches":          "the number of matching emails, or of unread emails for an unread alert",
+	"senders":          "the number of distinct senders of the matching emails",
+	"newestAgeMinutes": "the age in minutes of the most recent matching email",
+	"oldestAgeMinutes": "the age in minutes of the oldest matching email",
+	"hour":             "the current hour of the day, from 0 to 23",
+	"weekday":          "the current day of the week, from 0 (Sunday) to 6 (Saturday)",
+	"amount":           "the largest money amount found in the body of any matching email",
+	"totalAmount":      "the sum of the largest money amount found in the body of each matching email",
+}
+
+// messageConditionVars are the variables of a Condition that need the
+// details of the matching emails, which are fetched if they are used.
+var messageConditionVars = map[string]bool{"senders": true, "newestAgeMinutes": true, "oldestAgeMinutes": true}
+
+// bodyConditionVars are the variables of a Condition that need the bodies
+// of the matching emails, which are downloaded if they are used.
+var bodyConditionVars = map[string]bool{"amount": true, "totalAmount": true}
+
+// condNode represents a parsed Condition expression, or part of one, which
+// is either a number or boolean literal, a variable, or an operator applied
+// to one or two operands.
+type condNode struct {
+	op      string
+	num     float64
+	name    string
+	left    *condNode
+	right   *condNode
+	boolean bool
+}
+
+// eval returns the value of the condNode receiver n with the given values
+// of the variables, with booleans as 1 for true and 0 for false.
+func (n *condNode) eval(vars map[string]float64) float64 {
+	switch n.op {
+	case "num":
+		return n.num
+	case "var":
+		return vars[n.name]
+	case "!":
+		return boolValue(n.left.eval(vars) == 0)
+	case "neg":
+		return -n.left.eval(vars)
+	case "&&":
+		return boolValue(n.left.eval(vars) != 0 && n.right.eval(vars) != 0)
+	case "||":
+		return boolValue(n.left.eval(vars) != 0 || n.right.eval(vars) != 0)
+	}
+
+	l, r := n.left.eval(vars), n.right.eval(vars)
+	switch n.op {
+	case "+":
+		return l + r
+	case "-":
+		return l - r
+	case "*":
+		return l * r
+	case "/":
+		if r == 0 {
+			return 0
+		}
+		return l / r
+	case "==":
+		return boolValue(l == r)
+	case "!=":
+		return boolValue(l != r)
+	case "<":
+		return boolValue(l < r)
+	case "<=":
+		return boolValue(l <= r)
+	case ">":
+		return boolValue(l > r)
+	default:
+		return boolValue(l >= r)
+	}
+}
+
+// vars returns the names of the variables used by the condNode receiver n,
+// added to the given set.
+func (n *condNode) vars(used map[string]bool) map[string]bool {
+	if n == nil {
+		return used
+	}
+	if n.op == "var" {
+		used[n.name] = true
+	}
+	n.left.vars(used)
+	n.right.vars(used)
+
+	return used
+}
+
+// boolValue returns 1 if the given boolean is true and 0 otherwise.
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+// condParser represents the state of parsing a Condition expression.
+type condParser struct {
+	tokens []string
+	pos    int
+}
+
+// parseCondition parses the given Condition expression, which combines the
+// variables described by conditionVars and number literals with the
+// arithmetic operators "+", "-", "*", and "/", the comparison operators
+// "==", "!=", "<", "<=", ">", and ">=", the boolean operators "&&", "||",
+// and "!", the literals "true" and "false", and parentheses, like
+// "matches > 3 && newestAgeMinutes < 60". Division by zero results in 0. An
+// error is returned if the expression cannot be parsed, uses an unknown
+// variable, mixes numbers and booleans, or is not a boolean.
+func parseCondition(expr string) (*condNode, error) {
+	tokens, err := tokenizeCondition(expr)
+	if err != nil {
+		return nil, fmt.Errorf("got error parsing condition %q: %v", expr, err)
+	}
+	p := &condParser{tokens: tokens}
+	n, err := p.or()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+	if err == nil && !n.boolean {
+		err = fmt.Errorf("condition must be a comparison or boolean, not a number")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("got error parsing condition %q: %v", expr, err)
+	}
+
+	return n, nil
+}
+
+// tokenizeCondition splits the given Condition expression into numbers,
+// names, operators, and parentheses. An error is returned if it contains
+// any other character.
+func tokenizeCondition(expr string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(expr); {
+		c := rune(expr[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case unicode.IsDigit(c) || c == '.':
+			j := i
+			for j < len(expr) && (unicode.IsDigit(rune(expr[j])) || expr[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, expr[i:j])
+			i = j
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(expr) && (unicode.IsLetter(rune(expr[j])) || unicode.IsDigit(rune(expr[j])) || expr[j] == '_') {
+				j++
+			}
+			tokens = append(tokens, expr[i:j])
+			i = j
+		default:
+			op := ""
+			for _, candidate := range []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "+", "-", "*", "/", "(", ")"} {
+				if strings.HasPrefix(expr[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected character %q", c)
+			}
+			tokens = append(tokens, op)
+			i += len(op)
+		}
+	}
+
+	return tokens, nil
+}
+
+// peek returns the next token of the condParser receiver p, or an empty
+// string at the end of the expression.
+func (p *condParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+
+	return ""
+}
+
+// binary parses a sequence of operands, parsed with the given function,
+// joined by any of the given operators, which are applied from left to
+// right. The operands and result of an operator are booleans if the given
+// boolean is true and numbers otherwise. An error is returned if an operand
+// cannot be parsed or has the wrong type.
+func (p *condParser) binary(operand func() (*condNode, error), boolean bool, ops ...string) (*condNode, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if !containsString(ops, op) {
+			return left, nil
+		}
+		p.pos++
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		if (left.boolean != boolean || right.boolean != boolean) && boolean {
+			return nil, fmt.Errorf("operands of %q must be comparisons or booleans", op)
+		}
+		if left.boolean != boolean || right.boolean != boolean {
+			return nil, fmt.Errorf("operands of %q must be numbers", op)
+		}
+		left = &condNode{op: op, left: left, right: right, boolean: boolean}
+	}
+}
+
+// or parses a sequence of operands joined by "||".
+func (p *condParser) or() (*condNode, error) {
+	return p.binary(p.and, true, "||")
+}
+
+// and parses a sequence of operands joined by "&&".
+func (p *condParser) and() (*condNode, error) {
+	return p.binary(p.comparison, true, "&&")
+}
+
+// comparison parses a comparison of two sums, or a single sum.
+func (p *condParser) comparison() (*condNode, error) {
+	left, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	op := p.peek()
+	if !containsString([]string{"==", "!=", "<", "<=", ">", ">="}, op) {
+		return left, nil
+	}
+	p.pos++
+	right, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	if left.boolean != right.boolean || (left.boolean && op != "==" && op != "!=") {
+		return nil, fmt.Errorf("operands of %q must be numbers", op)
+	}
+
+	return &condNode{op: op, left: left, right: right, boolean: true}, nil
+}
+
+// sum parses a sequence of operands joined by "+" or "-".
+func (p *condParser) sum() (*condNode, error) {
+	return p.binary(p.product, false, "+", "-")
+}
+
+// product parses a sequence of operands joined by "*" or "/".
+func (p *condParser) product() (*condNode, error) {
+	return p.binary(p.unary, false, "*", "/")
+}
+
+// unary parses an operand negated by "!" or "-", or a single operand.
+func (p *condParser) unary() (*condNode, error) {
+	switch op := p.peek(); op {
+	case "!", "-":
+		p.pos++
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		if op == "!" && !operand.boolean {
+			return nil, fmt.Errorf(`operand of "!" must be a comparison or boolean`)
+		}
+		if op == "-" {
+			if operand.boolean {
+				return nil, fmt.Errorf(`operand of "-" must be a number`)
+			}
+			op = "neg"
+		}
+		return &condNode{op: op, left: operand, boolean: op == "!"}, nil
+	}
+
+	return p.primary()
+}
+
+// primary parses a literal, a variable, or a parenthesized expression.
+func (p *condParser) primary() (*condNode, error) {
+	token := p.peek()
+	p.pos++
+	switch {
+	case token == "":
+		return nil, fmt.Errorf("unexpected end of condition")
+	case token == "(":
+		n, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf(`missing ")"`)
+		}
+		p.pos++
+		return n, nil
+	case token == "true" || token == "false":
+		return &condNode{op: "num", num: boolValue(token == "true"), boolean: true}, nil
+	case unicode.IsDigit(rune(token[0])) || token[0] == '.':
+		num, err := strconv.ParseFloat(token, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", token)
+		}
+		return &condNode{op: "num", num: num}, nil
+	case unicode.IsLetter(rune(token[0])) || token[0] == '_':
+		if _, ok := conditionVars[token]; !ok {
+			return nil, fmt.Errorf("unknown variable %q", token)
+		}
+		return &condNode{op: "var", name: token}, nil
+	}
+
+	return nil, fmt.Errorf("unexpected %q", token)
+}
+
+// conditionHolds reports whether the condition of the given Alert holds for
+// the given number of emails found and matching messages, whose details are
+// fetched if the condition uses variables that need them. An error is
+// returned if the condition is invalid or the details cannot be fetched.
+func (a Alerter) conditionHolds(alt Alert, found int, matches []Message) (bool, error) {
+	cond, err := parseCondition(alt.Condition)
+	if err != nil {
+		return false, err
+	}
+
+	now := a.now().In(a.location(alt))
+	vars := map[string]float64{
+		"matches": float64(found),
+		"hour":    float64(now.Hour()),
+		"weekday": float64(now.Weekday()),
+	}
+	used := cond.vars(map[string]bool{})
+	detailed, bodies := false, false
+	for name := range used {
+		detailed = detailed || messageConditionVars[name]
+		bodies = bodies || bodyConditionVars[name]
+	}
+	if bodies {
+		vars["amount"], vars["totalAmount"], err = a.moneyVars(alt, matches)
+		if err != nil {
+			return false, err
+		}
+	}
+	if detailed {
+		fetcher, ok := a.Matcher.(Fetcher)
+		if !ok {
+			return false, fmt.Errorf("matcher %T must implement Fetcher to evaluate condition %q", a.Matcher, alt.Condition)
+		}
+		senders := map[string]bool{}
+		for i, m := range matches {
+			if m.Date.IsZero() {
+				msg, err := fetcher.Fetch(m.ID)
+				if err != nil {
+					return false, err
+				}
+				m = msg
+			}
+			from := strings.ToLower(m.From)
+			if addr, err := mail.ParseAddress(m.From); err == nil {
+				from = strings.ToLower(addr.Address)
+			}
+			senders[from] = true
+			age := now.Sub(m.Date).Minutes()
+			if i == 0 || age < vars["newestAgeMinutes"] {
+				vars["newestAgeMinutes"] = age
+			}
+			if i == 0 || age > vars["oldestAgeMinutes"] {
+				vars["oldestAgeMinutes"] = age
+			}
+		}
+		vars["senders"] = float64(len(senders))
+	}
+
+	return cond.eval(vars) != 0, nil
+}
@@ -0,0 +1,164 @@
+package gmailalert
+
+import (
+	"io"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestParseCondition(t *testing.T) {
+	t.Parallel()
+
+	vars := map[string]float64{"matches": 4, "newestAgeMinutes": 30, "senders": 2, "hour": 9, "weekday": 1}
+	testCases := map[string]struct {
+		expr        string
+		want        bool
+		errExpected bool
+	}{
+		"Comparison holds": {
+			expr: "matches > 3",
+			want: true,
+		},
+		"Conjunction holds": {
+			expr: "matches > 3 && newestAgeMinutes < 60",
+			want: true,
+		},
+		"Conjunction does not hold": {
+			expr: "matches > 3 && senders >= 3",
+		},
+		"Disjunction binds looser than conjunction": {
+			expr: "matches > 10 && senders > 10 || hour == 9",
+			want: true,
+		},
+		"Arithmetic binds tighter than comparison": {
+			expr: "matches / senders == 2 && -matches + 2 * 3 == 2",
+			want: true,
+		},
+		"Negated parenthesized expression": {
+			expr: "!(weekday == 0 || weekday == 6)",
+			want: true,
+		},
+		"Boolean literals compare": {
+			expr: "(matches > 1) == true",
+			want: true,
+		},
+		"Division by zero results in zero": {
+			expr: "matches / 0 == 0",
+			want: true,
+		},
+		"Unknown variable returns error": {
+			expr:        "unread > 3",
+			errExpected: true,
+		},
+		"Number returns error": {
+			expr:        "matches + 1",
+			errExpected: true,
+		},
+		"Boolean operand of arithmetic returns error": {
+			expr:        "(matches > 1) + 1 > 0",
+			errExpected: true,
+		},
+		"Number operand of conjunction returns error": {
+			expr:        "matches && hour > 1",
+			errExpected: true,
+		},
+		"Missing parenthesis returns error": {
+			expr:        "(matches > 1",
+			errExpected: true,
+		},
+		"Trailing token returns error": {
+			expr:        "matches > 1 2",
+			errExpected: true,
+		},
+		"Unexpected character returns error": {
+			expr:        "matches > 1; hour",
+			errExpected: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			cond, err := parseCondition(tc.expr)
+			errReceived := err != nil
+
+			if tc.errExpected != errReceived {
+				t.Fatalf("parseCondition(%q) returned unexpected error status: %v", tc.expr, err)
+			}
+			if tc.errExpected {
+				return
+			}
+			if got := cond.eval(vars) != 0; got != tc.want {
+				t.Errorf("want %q to be %t, got %t", tc.expr, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestProcessNotifiesOnlyWhenConditionHolds(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	m := fakePreviewFetcher{
+		matches: []Message{{ID: "1"}, {ID: "2"}},
+		msgs: map[string]Message{
+			"1": {ID: "1", From: "Bank <alerts@bank.com>", Date: now.Add(-20 * time.Minute)},
+			"2": {ID: "2", From: "alerts@bank.com", Date: now.Add(-3 * time.Hour)},
+		},
+	}
+	testCases := map[string]struct {
+		condition    string
+		wantNotified bool
+	}{
+		"Condition on matches holds": {
+			condition:    "matches >= 2",
+			wantNotified: true,
+		},
+		"Condition on ages holds": {
+			condition:    "newestAgeMinutes < 30 && oldestAgeMinutes >= 180",
+			wantNotified: true,
+		},
+		"Condition on senders does not hold": {
+			condition: "senders > 1",
+		},
+		"Condition on hour does not hold": {
+			condition: "hour < 9",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			notifier := &recordingTestNotifier{}
+			a := Alerter{
+				Matcher:  m,
+				Notifier: notifier,
+				Logger:   log.New(io.Discard, "", 0),
+				Clock:    func() time.Time { return now },
+			}
+			alt := Alert{GmailQuery: "from:bank", PushoverTitle: "t", PushoverSound: "s", PushoverTarget: "u", Condition: tc.condition}
+
+			res := a.process(alt, nil)
+
+			if res.Err != nil {
+				t.Fatalf("got unexpected error: %v", res.Err)
+			}
+			if res.Notified != tc.wantNotified || (len(notifier.alerts) == 1) != tc.wantNotified {
+				t.Errorf("want notified %t, got %t with %d notifications", tc.wantNotified, res.Notified, len(notifier.alerts))
+			}
+		})
+	}
+}
+
+func TestAlertOKRejectsMessageConditionOnUnreadAlert(t *testing.T) {
+	t.Parallel()
+
+	alt := Alert{UnreadAbove: 10, PushoverMsg: "m", PushoverTitle: "t", PushoverSound: "s", PushoverTarget: "u"}
+	alt.Condition = "matches > 20"
+	if err := alt.OK(); err != nil {
+		t.Errorf("want condition on matches of unread alert to be valid, got %v", err)
+	}
+	alt.Condition = "newestAgeMinutes < 60"
+	if err := alt.OK(); err == nil {
+		t.Error("want error for condition on email ages of unread alert, got nil")
+	}
+}
@@ -0,0 +1,152 @@
+package gmailalert
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// configAgentService is the net/rpc service of the config agent, serving the
+// passphrase of an encrypted alerts config.
+type configAgentService struct {
+	passphrase string
+}
+
+// Passphrase sets reply to the passphrase held by the agent. It takes no
+// arguments.
+func (s *configAgentService) Passphrase(_ struct{}, reply *string) error {
+	*reply = s.passphrase
+	return nil
+}
+
+// agentCLI accepts the command line flags of the "config agent" subcommand,
+// which asks for the passphrase of the encrypted alerts config on the
+// terminal, checks that it decrypts the alerts config, and serves it on the
+// unix socket named by the "-config-agent-socket" flag until the "-ttl"
+// elapses or the process is interrupted. An error is returned if the flags
+// are invalid, the passphrase is wrong, or the socket cannot be served.
+func agentCLI(args []string) error {
+	var app cliEnv
+	var ttl time.Duration
+
+	fs := app.flagSet("config agent")
+	fs.DurationVar(
+		&ttl,
+		"ttl",
+		8*time.Hour,
+		"how long to keep serving the passphrase")
+	if err := app.parse(fs, args); err != nil {
+		return err
+	}
+	if app.configAgentSocket == "" || ttl <= 0 {
+		fs.Usage()
+		return errors.New(`command line flag "-config-agent-socket" must be non-empty and "-ttl" must be positive`)
+	}
+
+	b, err := app.readAlertsConfig()
+	if err != nil {
+		return err
+	}
+	if !isEncryptedConfig(b) {
+		return fmt.Errorf("alerts config %s is not encrypted", app.alertsConfigFile)
+	}
+	passphrase, err := readPassphrase(bufio.NewReader(os.Stdin), "Alerts config passphrase: ")
+	if err != nil {
+		return err
+	}
+	if _, err := decryptConfig(b, passphrase); err != nil {
+		return err
+	}
+
+	l, err := listenConfigAgent(app.configAgentSocket)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, ttl)
+	defer cancel()
+
+	fmt.Fprintf(os.Stderr, "serving alerts config passphrase on %s until %s\n",
+		app.configAgentSocket, time.Now().Add(ttl).Format(time.RFC1123))
+
+	return serveConfigAgent(ctx, l, passphrase)
+}
+
+// listenConfigAgent listens on the unix socket with the given path, replacing
+// a socket left behind by an agent that did not exit cleanly, and makes the
+// socket accessible to the current user only. An error is returned if the
+// path exists but is not a socket or the socket cannot be listened on.
+func listenConfigAgent(socket string) (net.Listener, error) {
+	if fi, err := os.Lstat(socket); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("config agent socket %s exists and is not a socket", socket)
+		}
+		if err := os.Remove(socket); err != nil {
+			return nil, fmt.Errorf("got error removing stale config agent socket %s: %v", socket, err)
+		}
+	}
+
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("got error listening on config agent socket %s: %v", socket, err)
+	}
+	if err := os.Chmod(socket, 0600); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("got error restricting config agent socket %s: %v", socket, err)
+	}
+
+	return l, nil
+}
+
+// serveConfigAgent serves the given passphrase on the given net.Listener
+// until the given context is cancelled. An error is returned if the service
+// cannot be registered or accepting a connection fails.
+func serveConfigAgent(ctx context.Context, l net.Listener, passphrase string) error {
+	srv := rpc.NewServer()
+	if err := srv.RegisterName("ConfigAgent", &configAgentService{passphrase: passphrase}); err != nil {
+		return fmt.Errorf("got error registering config agent service: %v", err)
+	}
+
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("got error accepting config agent connection: %v", err)
+		}
+		go srv.ServeCodec(jsonrpc.NewServerCodec(conn))
+	}
+}
+
+// agentPassphrase returns the passphrase served by the config agent
+// listening on the unix socket with the given path. An error is returned if
+// the agent cannot be reached.
+func agentPassphrase(socket string) (string, error) {
+	c, err := jsonrpc.Dial("unix", socket)
+	if err != nil {
+		return "", fmt.Errorf("got error connecting to config agent at %s: %v", socket, err)
+	}
+	defer c.Close()
+
+	var passphrase string
+	if err := c.Call("ConfigAgent.Passphrase", struct{}{}, &passphrase); err != nil {
+		return "", fmt.Errorf("got error getting passphrase from config agent at %s: %v", socket, err)
+	}
+
+	return passphrase, nil
+}
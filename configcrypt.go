@@ -0,0 +1,265 @@
+package gmailalert
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// sealedConfigPrefix starts an alerts config encrypted by encryptConfig, so
+// that it can be told from a plain JSON alerts config.
+const sealedConfigPrefix = "gmailalert-config-v1:"
+
+// configKDFIterations is the number of PBKDF2 iterations used to derive the
+// key of an encrypted alerts config from its passphrase.
+const configKDFIterations = 600000
+
+// configPassphraseEnv names the environment variable holding the passphrase
+// of an encrypted alerts config. It is not a command line flag, so that the
+// passphrase does not show up in the process list.
+const configPassphraseEnv = "GMAILALERT_CONFIG_PASSPHRASE"
+
+// configCryptCLI accepts the name of a "config" subcommand, "encrypt" or
+// "decrypt", and its command line flags. The "encrypt" subcommand writes the
+// alerts config encrypted with a passphrase to stdout, and the "decrypt"
+// subcommand writes an encrypted alerts config decrypted to stdout. An error
+// is returned if the flags are invalid, or if the alerts config cannot be
+// encrypted or decrypted.
+func configCryptCLI(cmd string, args []string) error {
+	var app cliEnv
+	fs := app.flagSet("config " + cmd)
+	if err := app.parse(fs, args); err != nil {
+		return err
+	}
+	b, err := app.readAlertsConfig()
+	if err != nil {
+		return err
+	}
+
+	if cmd == "decrypt" {
+		plain, err := app.decryptConfig(b)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(plain)
+		return err
+	}
+
+	if isEncryptedConfig(b) {
+		return fmt.Errorf("alerts config %s is already encrypted", app.alertsConfigFile)
+	}
+	passphrase, err := newPassphrase()
+	if err != nil {
+		return err
+	}
+	sealed, err := encryptConfig(b, passphrase, configKDFIterations)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(os.Stdout, sealed)
+
+	return err
+}
+
+// isEncryptedConfig reports whether the given alerts config was encrypted
+// by encryptConfig.
+func isEncryptedConfig(b []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(b), []byte(sealedConfigPrefix))
+}
+
+// encryptConfig encrypts the given alerts config with a key derived from
+// the given passphrase with the given number of PBKDF2 iterations, and
+// returns it in the form "gmailalert-config-v1:<iterations>:<salt>:<data>",
+// with the salt and the encrypted data base64-encoded. An error is returned
+// if the passphrase is empty or the config cannot be encrypted.
+func encryptConfig(plain []byte, passphrase string, iterations int) (string, error) {
+	if passphrase == "" {
+		return "", errors.New("alerts config passphrase must not be empty")
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("got error generating salt: %v", err)
+	}
+	sealed, err := sealToken(plain, pbkdf2SHA256([]byte(passphrase), salt, iterations, 32))
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s%d:%s:%s", sealedConfigPrefix, iterations,
+		base64.StdEncoding.EncodeToString(salt), base64.StdEncoding.EncodeToString(sealed)), nil
+}
+
+// decryptConfig decrypts the given output of encryptConfig with the given
+// passphrase. An error is returned if the encrypted config is malformed or
+// the passphrase is wrong.
+func decryptConfig(b []byte, passphrase string) ([]byte, error) {
+	fields := strings.Split(strings.TrimPrefix(string(bytes.TrimSpace(b)), sealedConfigPrefix), ":")
+	if len(fields) != 3 {
+		return nil, errors.New("encrypted alerts config is malformed")
+	}
+	iterations, err := strconv.Atoi(fields[0])
+	if err != nil || iterations < 1 {
+		return nil, fmt.Errorf("encrypted alerts config has an invalid iteration count %q", fields[0])
+	}
+	salt, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("got error base64-decoding alerts config salt: %v", err)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(fields[2])
+	if err != nil {
+		return nil, fmt.Errorf("got error base64-decoding encrypted alerts config: %v", err)
+	}
+
+	plain, err := openToken(sealed, pbkdf2SHA256([]byte(passphrase), salt, iterations, 32))
+	if err != nil {
+		return nil, errors.New("got error decrypting alerts config, the passphrase may be wrong")
+	}
+
+	return plain, nil
+}
+
+// pbkdf2SHA256 derives a key of the given length from the given password and
+// salt with PBKDF2 using HMAC-SHA256 and the given number of iterations, as
+// described in RFC 8018.
+func pbkdf2SHA256(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	var key []byte
+	for block := uint32(1); len(key) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.Write(prf, binary.BigEndian, block)
+		u := prf.Sum(nil)
+		t := append([]byte(nil), u...)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+
+	return key[:keyLen]
+}
+
+// decryptConfig decrypts the given encrypted alerts config with the
+// passphrase found by configPassphrase. An error is returned if there is no
+// passphrase or the config cannot be decrypted with it.
+func (c cliEnv) decryptConfig(b []byte) ([]byte, error) {
+	passphrase, err := c.configPassphrase()
+	if err != nil {
+		return nil, err
+	}
+	plain, err := decryptConfig(b, passphrase)
+	if err != nil {
+		if c.passphrase != nil {
+			*c.passphrase = ""
+		}
+		return nil, err
+	}
+
+	return plain, nil
+}
+
+// configPassphrase returns the passphrase of the encrypted alerts config,
+// taken from the GMAILALERT_CONFIG_PASSPHRASE environment variable, from
+// the agent listening on the socket named by the "-config-agent-socket"
+// flag, or asked for on the terminal, in that order. In daemon mode, the
+// passphrase is remembered for reloading the alerts config. An error is
+// returned if the agent cannot be reached or the passphrase cannot be read.
+func (c cliEnv) configPassphrase() (string, error) {
+	if c.passphrase != nil && *c.passphrase != "" {
+		return *c.passphrase, nil
+	}
+
+	passphrase, ok := os.LookupEnv(configPassphraseEnv)
+	if !ok && c.configAgentSocket != "" {
+		var err error
+		if passphrase, err = agentPassphrase(c.configAgentSocket); err != nil {
+			return "", err
+		}
+		ok = true
+	}
+	if !ok {
+		var err error
+		if passphrase, err = readPassphrase(bufio.NewReader(os.Stdin), "Alerts config passphrase: "); err != nil {
+			return "", err
+		}
+	}
+	if c.passphrase != nil {
+		*c.passphrase = passphrase
+	}
+
+	return passphrase, nil
+}
+
+// newPassphrase returns the passphrase to encrypt an alerts config with,
+// taken from the GMAILALERT_CONFIG_PASSPHRASE environment variable or asked
+// for twice on the terminal. An error is returned if the passphrase cannot
+// be read, is empty, or was not repeated correctly.
+func newPassphrase() (string, error) {
+	if passphrase, ok := os.LookupEnv(configPassphraseEnv); ok {
+		return passphrase, nil
+	}
+
+	stdin := bufio.NewReader(os.Stdin)
+	passphrase, err := readPassphrase(stdin, "New alerts config passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	repeated, err := readPassphrase(stdin, "Repeat the passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if passphrase != repeated {
+		return "", errors.New("passphrases do not match")
+	}
+
+	return passphrase, nil
+}
+
+// readPassphrase writes the given prompt to stderr and reads a passphrase
+// from a line of the given reader of stdin, hiding the input with stty if
+// stdin is a terminal. An error is returned if the passphrase cannot be read
+// or is empty.
+func readPassphrase(stdin *bufio.Reader, prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	if stty("-echo") == nil {
+		defer fmt.Fprintln(os.Stderr)
+		defer stty("echo")
+	}
+
+	line, err := stdin.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("got error reading passphrase: %v", err)
+	}
+	passphrase := strings.TrimRight(line, "\r\n")
+	if passphrase == "" {
+		return "", errors.New("alerts config passphrase must not be empty")
+	}
+
+	return passphrase, nil
+}
+
+// stty runs the stty command with the given argument on stdin. An error is
+// returned if stdin is not a terminal or stty is not available.
+func stty(arg string) error {
+	cmd := exec.Command("stty", arg)
+	cmd.Stdin = os.Stdin
+
+	return cmd.Run()
+}
@@ -0,0 +1,120 @@
+package gmailalert
+
+import (
+	"context"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPBKDF2SHA256(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		iterations int
+		want       string
+	}{
+		"One iteration": {
+			iterations: 1,
+			want:       "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b",
+		},
+		"Two iterations": {
+			iterations: 2,
+			want:       "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got := hex.EncodeToString(pbkdf2SHA256([]byte("password"), []byte("salt"), tc.iterations, 32))
+			if tc.want != got {
+				t.Errorf("want key %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestEncryptConfig(t *testing.T) {
+	t.Parallel()
+
+	plain := []byte(`{"pushoverapp": "app", "alerts": []}`)
+	sealed, err := encryptConfig(plain, "correct horse", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("encrypted config is detected", func(t *testing.T) {
+		if !isEncryptedConfig([]byte(sealed+"\n")) || isEncryptedConfig(plain) {
+			t.Error("want only the encrypted config to be detected as encrypted")
+		}
+		if strings.Contains(sealed, "pushoverapp") {
+			t.Errorf("want the config to be unreadable, got %s", sealed)
+		}
+	})
+
+	t.Run("right passphrase decrypts config", func(t *testing.T) {
+		got, err := decryptConfig([]byte(sealed), "correct horse")
+		if err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+		if string(got) != string(plain) {
+			t.Errorf("want %s, got %s", plain, got)
+		}
+	})
+
+	t.Run("wrong passphrase returns an error", func(t *testing.T) {
+		if _, err := decryptConfig([]byte(sealed), "wrong horse"); err == nil {
+			t.Error("expected an error but did not get one")
+		}
+	})
+
+	t.Run("malformed config returns an error", func(t *testing.T) {
+		if _, err := decryptConfig([]byte(sealedConfigPrefix+"10:salt"), "correct horse"); err == nil {
+			t.Error("expected an error but did not get one")
+		}
+	})
+
+	t.Run("empty passphrase returns an error", func(t *testing.T) {
+		if _, err := encryptConfig(plain, "", 10); err == nil {
+			t.Error("expected an error but did not get one")
+		}
+	})
+}
+
+func TestAlertConfigWithAgentPassphrase(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	sealed, err := encryptConfig([]byte(`{"pushoverapp": "app"}`), "correct horse", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfgFile := filepath.Join(dir, "alerts.json")
+	if err := os.WriteFile(cfgFile, []byte(sealed), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	socket := filepath.Join(dir, "agent.sock")
+	l, err := listenConfigAgent(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go serveConfigAgent(ctx, l, "correct horse")
+
+	app := cliEnv{alertsConfigFile: cfgFile, configAgentSocket: socket, passphrase: new(string)}
+	alertCfg, err := app.alertConfig()
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+
+	if alertCfg.PushoverApp != "app" {
+		t.Errorf("want pushover app %q, got %q", "app", alertCfg.PushoverApp)
+	}
+	if *app.passphrase != "correct horse" {
+		t.Errorf("want the passphrase to be remembered, got %q", *app.passphrase)
+	}
+}
@@ -0,0 +1,140 @@
+package gmailalert
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// configSignatureSuffix is appended to the file name or URL of an alerts
+// config to form the file name or URL of its detached signature.
+const configSignatureSuffix = ".sig"
+
+// configSignCLI accepts the command line flags of the "config sign"
+// subcommand, which writes the detached signature of the alerts config,
+// made with the ed25519 private key in the signing key file, to stdout.
+// With the "-generate-key" flag, it instead generates a new key pair, saves
+// the private key into the signing key file, which must not exist yet, and
+// writes the public key to stdout. An error is returned if the flags are
+// invalid, or if the key or the alerts config cannot be read or written.
+func configSignCLI(args []string) error {
+	var app cliEnv
+	var keyFile string
+	var generate bool
+
+	fs := app.flagSet("config sign")
+	fs.StringVar(
+		&keyFile,
+		"signing-key-file",
+		"",
+		"file holding the base64-encoded ed25519 private key to sign the alerting criteria with")
+	fs.BoolVar(
+		&generate,
+		"generate-key",
+		false,
+		"generate a new key pair, save its private key into -signing-key-file, and print its public key")
+	if err := app.parse(fs, args); err != nil {
+		return err
+	}
+	if keyFile == "" {
+		return errors.New(`command line flag "-signing-key-file" must be non-empty`)
+	}
+
+	if generate {
+		return generateConfigKey(keyFile, os.Stdout)
+	}
+	key, err := readConfigPrivateKey(keyFile)
+	if err != nil {
+		return err
+	}
+	b, err := app.readAlertsConfig()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(os.Stdout, signConfig(key, b))
+
+	return err
+}
+
+// generateConfigKey generates a new ed25519 key pair, saves its private key
+// encoded in base64 into the given file, which must not exist yet, and
+// writes its public key encoded in base64 to the given io.Writer. An error
+// is returned if the key pair cannot be generated or saved.
+func generateConfigKey(file string, w io.Writer) error {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return fmt.Errorf("got error generating signing key: %v", err)
+	}
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("got error creating signing key file %s: %v", file, err)
+	}
+	if _, err := fmt.Fprintln(f, base64.StdEncoding.EncodeToString(priv)); err != nil {
+		f.Close()
+		return fmt.Errorf("got error writing signing key file %s: %v", file, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("got error writing signing key file %s: %v", file, err)
+	}
+	_, err = fmt.Fprintln(w, base64.StdEncoding.EncodeToString(pub))
+
+	return err
+}
+
+// readConfigPrivateKey returns the ed25519 private key encoded in base64 in
+// the given file. An error is returned if the file cannot be read or does
+// not hold a base64-encoded ed25519 private key.
+func readConfigPrivateKey(file string) (ed25519.PrivateKey, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("got error reading signing key file %s: %v", file, err)
+	}
+	key, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(b)))
+	if err != nil || len(key) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("signing key file %s must hold a base64-encoded %d-byte ed25519 private key", file, ed25519.PrivateKeySize)
+	}
+
+	return ed25519.PrivateKey(key), nil
+}
+
+// signConfig returns the detached signature of the given alerts config made
+// with the given private key, encoded in base64 as verifyConfigSignature
+// expects it.
+func signConfig(key ed25519.PrivateKey, config []byte) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(key, config))
+}
+
+// parseConfigPublicKey returns the ed25519 public key encoded in base64 in
+// the given string, or nil if the string is empty. An error is returned if
+// the string is not a base64-encoded ed25519 public key.
+func parseConfigPublicKey(encoded string) (ed25519.PublicKey, error) {
+	if encoded == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("alerts config public key must be a base64-encoded %d-byte ed25519 public key", ed25519.PublicKeySize)
+	}
+
+	return ed25519.PublicKey(key), nil
+}
+
+// verifyConfigSignature returns an error if the given detached signature,
+// an ed25519 signature encoded in base64, is not a signature of the given
+// alerts config made with the private key of the given public key.
+func verifyConfigSignature(pub ed25519.PublicKey, config, signature []byte) error {
+	sig, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(signature)))
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return errors.New("alerts config signature must be a base64-encoded ed25519 signature")
+	}
+	if !ed25519.Verify(pub, config, sig) {
+		return errors.New("alerts config signature does not match the alerts config and public key")
+	}
+
+	return nil
+}
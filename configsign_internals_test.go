@@ -0,0 +1,111 @@
+package gmailalert
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerateConfigKeySignsVerifiableConfigs(t *testing.T) {
+	t.Parallel()
+
+	keyFile := filepath.Join(t.TempDir(), "signing.key")
+	var out bytes.Buffer
+	if err := generateConfigKey(keyFile, &out); err != nil {
+		t.Fatal(err)
+	}
+	pub, err := parseConfigPublicKey(strings.TrimSpace(out.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := readConfigPrivateKey(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := []byte(`{"alerts": []}`)
+
+	sig := signConfig(key, config)
+
+	if err := verifyConfigSignature(pub, config, []byte(sig+"\n")); err != nil {
+		t.Errorf("want signature verified with the printed public key, got %v", err)
+	}
+	if err := verifyConfigSignature(pub, []byte(`{"alerts": [{}]}`), []byte(sig)); err == nil {
+		t.Error("want signature of another config rejected")
+	}
+	if err := generateConfigKey(keyFile, &out); err == nil {
+		t.Error("want error generating a key into an existing key file")
+	}
+	if info, err := os.Stat(keyFile); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("want key file only readable by its owner, got %v (%v)", info.Mode(), err)
+	}
+}
+
+func TestReadConfigPrivateKeyWithInvalidKeyReturnsError(t *testing.T) {
+	t.Parallel()
+
+	keyFile := filepath.Join(t.TempDir(), "signing.key")
+	if err := os.WriteFile(keyFile, []byte("c2hvcnQ=\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := readConfigPrivateKey(keyFile); err == nil {
+		t.Error("want error reading a key of the wrong size")
+	}
+}
+
+func TestConfigSourceVerifiesSignedFile(t *testing.T) {
+	t.Parallel()
+
+	pub, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := []byte(`{"alerts": []}`)
+	testCases := map[string]struct {
+		signature   []byte
+		errExpected bool
+	}{
+		"Valid signature": {
+			signature: []byte(signConfig(key, config)),
+		},
+		"Signature of another config returns error": {
+			signature:   []byte(signConfig(key, []byte(`{}`))),
+			errExpected: true,
+		},
+		"Missing signature returns error": {
+			errExpected: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "alerts.json")
+			if err := os.WriteFile(file, config, 0600); err != nil {
+				t.Fatal(err)
+			}
+			if tc.signature != nil {
+				if err := os.WriteFile(file+configSignatureSuffix, tc.signature, 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			s, err := newConfigSource(file, "", "", base64.StdEncoding.EncodeToString(pub))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := s.read()
+			errReceived := err != nil
+
+			if tc.errExpected != errReceived {
+				t.Fatalf("read() returned unexpected error status: %v", err)
+			}
+			if !tc.errExpected && !bytes.Equal(config, got) {
+				t.Errorf("want config %q, got %q", config, got)
+			}
+		})
+	}
+}
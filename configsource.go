@@ -0,0 +1,319 @@
+package gmailalert
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// stdinConfig is the value of the "-alerts-cfg-file" flag that reads the
+// alerts config from stdin.
+const stdinConfig = "-"
+
+// isConfigURL reports whether the given value of the "-alerts-cfg-file" flag
+// is an http:// or https:// URL.
+func isConfigURL(location string) bool {
+	return strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://")
+}
+
+// configSource reads the alerts config from a file, from stdin, or from an
+// HTTP(S) URL. Since stdin can only be read once, the alerts config read
+// from it is kept and returned on every later read, like when the daemon
+// reloads its configuration. An alerts config fetched from a URL is saved
+// into a cache file along with its ETag, which is sent on later requests so
+// that an unchanged config is not downloaded again, and which is used in
+// place of the URL while the server cannot be reached. With a public key, an
+// alerts config fetched from a URL is only used if its detached signature,
+// fetched from the URL with configSignatureSuffix appended, verifies. A
+// fetched alerts config that is not signed or cannot be decoded never
+// replaces the copy fetched before, so that a bad or partial download cannot
+// take down a fleet of daemons pulling the same URL. It is safe for
+// concurrent use by multiple goroutines.
+type configSource struct {
+	// The file name, stdinConfig, or URL to read the alerts config from.
+	location string
+	// The HTTP header sent with requests to the URL, like
+	// "Authorization: Bearer <token>", if any.
+	header string
+	// The file caching the alerts config fetched from the URL, if any.
+	cacheFile string
+	// The key verifying the signature of the alerts config fetched from the
+	// URL, if any.
+	publicKey ed25519.PublicKey
+	client    *http.Client
+	logger    Logger
+	mtx       sync.Mutex
+	body      []byte
+	etag      string
+	signature []byte
+}
+
+// configCache represents the cache file of an alerts config fetched from a
+// URL.
+type configCache struct {
+	URL       string `json:"url"`
+	ETag      string `json:"etag"`
+	Config    []byte `json:"config"`
+	Signature []byte `json:"signature,omitempty"`
+}
+
+// newConfigSource accepts the location of the alerts config, the HTTP header
+// to send with requests if it is a URL, the file to cache it in, and the
+// base64-encoded ed25519 public key to verify its signature with if it is
+// not empty, and returns a new configSource. An error is returned if the
+// header is not of the form "Name: value" or the public key is invalid.
+func newConfigSource(location, header, cacheFile, publicKey string) (*configSource, error) {
+	if header != "" {
+		name, _, ok := strings.Cut(header, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf(`alerts config header must be of the form "Name: value", got %q`, header)
+		}
+	}
+	pub, err := parseConfigPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	if pub != nil && location == stdinConfig {
+		return nil, errors.New("alerts config read from stdin cannot be verified against a signature, read it from a file or url instead")
+	}
+
+	return &configSource{
+		location:  location,
+		header:    header,
+		cacheFile: cacheFile,
+		publicKey: pub,
+		client:    &http.Client{Timeout: 30 * time.Second},
+		logger:    newInfoLogger(),
+	}, nil
+}
+
+// read returns the contents of the alerts config of the configSource
+// receiver. An error is returned if the alerts config cannot be read, or
+// cannot be fetched from its URL and no copy of it was cached.
+func (s *configSource) read() ([]byte, error) {
+	switch {
+	case s.location == stdinConfig:
+		return s.readStdin()
+	case isConfigURL(s.location):
+		return s.fetch()
+	default:
+		return s.readFile()
+	}
+}
+
+// readFile returns the alerts config read from the file of the configSource
+// receiver. If the receiver has a public key, the detached signature is read
+// from the file with configSignatureSuffix appended, and an error is
+// returned if it cannot be read or does not verify.
+func (s *configSource) readFile() ([]byte, error) {
+	b, err := os.ReadFile(s.location)
+	if err != nil || s.publicKey == nil {
+		return b, err
+	}
+	sig, err := os.ReadFile(s.location + configSignatureSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("got error reading signature of alerts config %s: %v", s.location, err)
+	}
+	if err := verifyConfigSignature(s.publicKey, b, sig); err != nil {
+		return nil, fmt.Errorf("alerts config %s is not trusted: %v", s.location, err)
+	}
+
+	return b, nil
+}
+
+// current returns the alerts config the configSource receiver read last from
+// stdin or from its URL, without reading it again, or nil if it has not read
+// any yet.
+func (s *configSource) current() []byte {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.body
+}
+
+// readStdin returns the alerts config read from stdin, reading it on the
+// first call only. An error is returned if stdin cannot be read.
+func (s *configSource) readStdin() ([]byte, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.body != nil {
+		return s.body, nil
+	}
+
+	b, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return nil, fmt.Errorf("got error reading alerts config from stdin: %v", err)
+	}
+	s.body = b
+
+	return b, nil
+}
+
+// fetch returns the alerts config fetched from the URL of the configSource
+// receiver. The request carries the ETag of the copy fetched before, or
+// cached in the cache file, so that the server can answer that the copy is
+// still current. A changed alerts config replaces the copy once it passes
+// check. If the request or the check fails, the copy is returned with a
+// warning logged. An error is returned if the request or the check fails
+// and there is no copy.
+func (s *configSource) fetch() ([]byte, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.body == nil {
+		s.loadCache()
+	}
+
+	b, etag, err := s.get(s.location, true)
+	var sig []byte
+	if err == nil && b != nil {
+		sig, err = s.check(b)
+	}
+	switch {
+	case err != nil && s.body == nil:
+		return nil, err
+	case err != nil:
+		s.logger.Printf("warning: %v, keeping the alerts config fetched before", err)
+		return s.body, nil
+	case b == nil:
+		return s.body, nil
+	}
+
+	s.body, s.etag, s.signature = b, etag, sig
+	if err := s.saveCache(); err != nil {
+		s.logger.Printf("warning: got error caching alerts config: %v", err)
+	}
+
+	return b, nil
+}
+
+// check returns the detached signature of the given alerts config fetched
+// from the URL of the configSource receiver, if the receiver has a public
+// key. An error is returned if the signature cannot be fetched or does not
+// verify, or if the alerts config is not encrypted and cannot be decoded.
+func (s *configSource) check(config []byte) ([]byte, error) {
+	var sig []byte
+	if s.publicKey != nil {
+		var err error
+		if sig, _, err = s.get(s.location+configSignatureSuffix, false); err != nil {
+			return nil, err
+		}
+		if err := verifyConfigSignature(s.publicKey, config, sig); err != nil {
+			return nil, fmt.Errorf("alerts config fetched from %s is not trusted: %v", redactURL(s.location), err)
+		}
+	}
+	if !isEncryptedConfig(config) {
+		if _, err := DecodeAlerts(bytes.NewReader(config)); err != nil {
+			return nil, fmt.Errorf("alerts config fetched from %s is invalid: %v", redactURL(s.location), err)
+		}
+	}
+
+	return sig, nil
+}
+
+// get sends a GET request for the given URL with the HTTP header of the
+// configSource receiver and returns the body and the ETag of the response.
+// If the request is conditional, it carries the ETag of the copy of the
+// receiver, and a nil body is returned if the server answered that the copy
+// is still current. An error is returned if the request fails or the
+// response status is neither 2xx nor 304 Not Modified.
+func (s *configSource) get(rawURL string, conditional bool) ([]byte, string, error) {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("got error creating alerts config request: %v", err)
+	}
+	if s.header != "" {
+		name, value, _ := strings.Cut(s.header, ":")
+		req.Header.Set(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	conditional = conditional && s.body != nil && s.etag != ""
+	if conditional {
+		req.Header.Set("If-None-Match", s.etag)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, "", fmt.Errorf("got error fetching %s: %v", redactURL(rawURL), err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && conditional {
+		return nil, s.etag, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, "", fmt.Errorf("got status %s fetching %s", resp.Status, redactURL(rawURL))
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("got error reading %s: %v", redactURL(rawURL), err)
+	}
+
+	return b, resp.Header.Get("ETag"), nil
+}
+
+// loadCache sets the copy of the alerts config and its ETag in the
+// configSource receiver from its cache file, if the cache file exists, was
+// written for the same URL, and holds a signature that verifies if the
+// receiver has a public key.
+func (s *configSource) loadCache() {
+	if s.cacheFile == "" {
+		return
+	}
+	b, err := os.ReadFile(s.cacheFile)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			s.logger.Printf("warning: got error reading alerts config cache: %v", err)
+		}
+		return
+	}
+
+	var cache configCache
+	if err := json.Unmarshal(b, &cache); err != nil || cache.URL != s.location {
+		return
+	}
+	if s.publicKey != nil {
+		if err := verifyConfigSignature(s.publicKey, cache.Config, cache.Signature); err != nil {
+			s.logger.Printf("warning: ignoring alerts config cache: %v", err)
+			return
+		}
+	}
+	s.body, s.etag, s.signature = cache.Config, cache.ETag, cache.Signature
+}
+
+// saveCache writes the copy of the alerts config, its ETag, and its
+// signature in the configSource receiver into a temporary file, readable by
+// the owner only since the alerts config holds the Pushover app token, and
+// renames it over the cache file, so that a crash while writing cannot
+// corrupt the cache file. Nothing is written if the receiver has no cache
+// file. An error is returned if the cache file cannot be written.
+func (s *configSource) saveCache() error {
+	if s.cacheFile == "" {
+		return nil
+	}
+	b, err := json.Marshal(configCache{URL: s.location, ETag: s.etag, Config: s.body, Signature: s.signature})
+	if err != nil {
+		return fmt.Errorf("got error json-encoding alerts config cache: %v", err)
+	}
+
+	tmp := s.cacheFile + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return fmt.Errorf("got error writing alerts config cache %s: %v", tmp, err)
+	}
+	if err := os.Rename(tmp, s.cacheFile); err != nil {
+		return fmt.Errorf("got error replacing alerts config cache %s: %v", s.cacheFile, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,628 @@
+package gmailalert
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aculclasure/gmailalert/controlpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// AlertStatus represents the state of an alert polled by an Alerter.
+type AlertStatus struct {
+	// The name identifying the alert.
+	Name string
+	// When the alert is next due to be evaluated.
+	NextDue time.Time
+	// When the alert was last evaluated.
+	LastEvaluated time.Time
+	// The number of emails that matched the alert when it was last
+	// evaluated.
+	LastMatches int
+	// Whether a notification was sent when the alert was last evaluated.
+	LastNotified bool
+	// The error the last evaluation of the alert failed with, if any.
+	LastError string
+	// The number of emergency notifications of the alert waiting to be
+	// acknowledged after its last evaluation.
+	Unacknowledged int
+	// Until when notifications of the alert are snoozed, if they are.
+	SnoozedUntil time.Time
+}
+
+// Status represents the state of an Alerter polling alerts.
+type Status struct {
+	// When the Alerter started polling.
+	Started time.Time
+	// The number of runs since the Alerter started polling.
+	Runs int
+	// When the last run finished.
+	LastRun time.Time
+	// The number of alerts polled.
+	Alerts int
+	// The number of alerts whose notifications are snoozed.
+	Snoozed int
+}
+
+// maxRecentAlerts is the number of fired alerts a Control remembers.
+const maxRecentAlerts = 50
+
+// FiredAlert represents a notification sent for an alert, as listed among
+// the recent fired alerts of a Control.
+type FiredAlert struct {
+	// The name identifying the alert.
+	Alert string `json:"alert"`
+	// The free-form labels of the alert.
+	Labels map[string]string `json:"labels,omitempty"`
+	// The ID of the evaluation that sent the notification.
+	EvalID string `json:"evalid"`
+	// When the run that sent the notification finished.
+	Time time.Time `json:"time"`
+	// The number of emails matching the alert.
+	Matches int `json:"matches"`
+	// The estimated total number of matching emails, if more matched than
+	// were listed.
+	Estimated int `json:"estimated,omitempty"`
+	// The title and message of the notification.
+	Title   string `json:"title,omitempty"`
+	Message string `json:"message,omitempty"`
+	// The IDs of the emails the notification was sent for.
+	MessageIDs []string `json:"messageids,omitempty"`
+}
+
+// newFiredAlert returns the FiredAlert of the given notified AlertResult of
+// a run that finished at the given time.
+func newFiredAlert(res AlertResult, finished time.Time) FiredAlert {
+	return FiredAlert{
+		Alert:      res.Alert,
+		Labels:     res.Labels,
+		EvalID:     res.EvalID,
+		Time:       finished,
+		Matches:    res.Matches,
+		Estimated:  res.Estimated,
+		Title:      res.Title,
+		Message:    res.Message,
+		MessageIDs: res.MessageIDs,
+	}
+}
+
+// Control represents the state of the alerts polled by an Alerter, which can
+// be inspected and changed while the Alerter is running, like through a
+// control API served by ServeControl. It is safe for concurrent use by
+// multiple goroutines.
+type Control struct {
+	mtx       sync.Mutex
+	status    Status
+	alerts    map[string]*AlertStatus
+	order     []string
+	requested map[string]bool
+	wake      chan struct{}
+	// The most recent fired alerts, oldest first.
+	recent []FiredAlert
+	// The lines logged while evaluating each alert, if they are kept.
+	logs *AlertLogs
+}
+
+// NewControl returns a new Control without any alerts.
+func NewControl() *Control {
+	return &Control{
+		alerts:    map[string]*AlertStatus{},
+		requested: map[string]bool{},
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+// WithAlerterControl accepts a Control and returns a functional option for
+// wiring the Control to an Alerter, which makes Poll report to the Control
+// and lets the Control trigger evaluations and snooze notifications.
+func WithAlerterControl(c *Control) AlerterOption {
+	return func(a *Alerter) {
+		a.Control = c
+		a.Hooks = append(a.Hooks, c.Hook())
+	}
+}
+
+// Hook returns a Hook that skips the notifications of snoozed alerts.
+func (c *Control) Hook() Hook {
+	return Hook{
+		BeforeNotify: func(alt *Alert) error {
+			c.mtx.Lock()
+			defer c.mtx.Unlock()
+			if st, ok := c.alerts[alt.key()]; ok && time.Now().Before(st.SnoozedUntil) {
+				return ErrSkipNotification
+			}
+			return nil
+		},
+	}
+}
+
+// EvaluateNow requests the alert with the given name, or every alert if the
+// name is empty, to be evaluated as soon as possible instead of when it is
+// next due. An error is returned if there is no alert with the given name.
+func (c *Control) EvaluateNow(name string) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if name != "" {
+		if _, ok := c.alerts[name]; !ok {
+			return fmt.Errorf("no alert named %q is polled", name)
+		}
+	}
+	c.requested[name] = true
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// Snooze suppresses the notifications of the alert with the given name for
+// the given duration, or lifts a snooze if the duration is not positive. An
+// error is returned if there is no alert with the given name.
+func (c *Control) Snooze(name string, d time.Duration) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	st, ok := c.alerts[name]
+	if !ok {
+		return fmt.Errorf("no alert named %q is polled", name)
+	}
+	st.SnoozedUntil = time.Time{}
+	if d > 0 {
+		st.SnoozedUntil = time.Now().Add(d)
+	}
+
+	return nil
+}
+
+// Alerts returns the status of every polled alert, in the order the alerts
+// are configured.
+func (c *Control) Alerts() []AlertStatus {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	alerts := make([]AlertStatus, 0, len(c.order))
+	for _, name := range c.order {
+		alerts = append(alerts, *c.alerts[name])
+	}
+
+	return alerts
+}
+
+// Status returns the status of the polling Alerter.
+func (c *Control) Status() Status {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	s := c.status
+	s.Alerts = len(c.order)
+	now := time.Now()
+	for _, st := range c.alerts {
+		if now.Before(st.SnoozedUntil) {
+			s.Snoozed++
+		}
+	}
+
+	return s
+}
+
+// Recent returns up to the given number of the most recently fired alerts,
+// newest first, or every remembered one if the number is not positive.
+func (c *Control) Recent(limit int) []FiredAlert {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if limit <= 0 || limit > len(c.recent) {
+		limit = len(c.recent)
+	}
+	recent := make([]FiredAlert, 0, limit)
+	for i := len(c.recent) - 1; len(recent) < limit; i-- {
+		recent = append(recent, c.recent[i])
+	}
+
+	return recent
+}
+
+// Logs returns up to the given number of the most recent lines logged while
+// evaluating the alert with the given name, oldest first, or every kept line
+// if the number is not positive. An error is returned if there is no alert
+// with the given name or if the logs of alerts are not kept.
+func (c *Control) Logs(name string, limit int) ([]LogLine, error) {
+	c.mtx.Lock()
+	_, ok := c.alerts[name]
+	logs := c.logs
+	c.mtx.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("no alert named %q is polled", name)
+	}
+	if logs == nil {
+		return nil, errors.New("the logs of alerts are not kept")
+	}
+
+	return logs.Lines(name, limit), nil
+}
+
+// start registers the given alerts as the alerts polled by an Alerter.
+func (c *Control) start(alerts []Alert) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.status = Status{Started: time.Now()}
+	c.order = c.order[:0]
+	for _, alt := range alerts {
+		if _, ok := c.alerts[alt.key()]; !ok {
+			c.alerts[alt.key()] = &AlertStatus{Name: alt.key()}
+		}
+		c.order = append(c.order, alt.key())
+	}
+}
+
+// takeRequests returns the names of the alerts requested to be evaluated
+// since the last call, with an empty name standing for every alert, and
+// clears the requests.
+func (c *Control) takeRequests() map[string]bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	requested := c.requested
+	c.requested = map[string]bool{}
+
+	return requested
+}
+
+// record updates the status of the alerts evaluated in a run with the given
+// Summary and next due times.
+func (c *Control) record(s Summary, due []time.Time) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.status.Runs++
+	c.status.LastRun = time.Now()
+	for i, res := range s.Results {
+		if res.Notified {
+			c.recent = append(c.recent, newFiredAlert(res, c.status.LastRun))
+		}
+		st, ok := c.alerts[res.Alert]
+		if !ok {
+			continue
+		}
+		st.NextDue = due[i]
+		st.LastEvaluated = c.status.LastRun
+		st.LastMatches = res.Matches
+		st.LastNotified = res.Notified
+		st.Unacknowledged = res.Unacknowledged
+		st.LastError = ""
+		if res.Err != nil {
+			st.LastError = res.Err.Error()
+		}
+	}
+	if len(c.recent) > maxRecentAlerts {
+		c.recent = append(c.recent[:0], c.recent[len(c.recent)-maxRecentAlerts:]...)
+	}
+}
+
+// controlServer implements the gRPC Control service of controlpb with a
+// Control.
+type controlServer struct {
+	controlpb.UnimplementedControlServer
+	c *Control
+}
+
+// EvaluateNow calls Control.EvaluateNow with the requested alert name.
+func (s controlServer) EvaluateNow(_ context.Context, req *controlpb.EvaluateNowRequest) (*controlpb.EvaluateNowResponse, error) {
+	if err := s.c.EvaluateNow(req.GetAlert()); err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	return &controlpb.EvaluateNowResponse{}, nil
+}
+
+// ListAlerts returns the status of every polled alert.
+func (s controlServer) ListAlerts(context.Context, *controlpb.ListAlertsRequest) (*controlpb.ListAlertsResponse, error) {
+	var resp controlpb.ListAlertsResponse
+	for _, st := range s.c.Alerts() {
+		resp.Alerts = append(resp.Alerts, &controlpb.AlertStatus{
+			Name:           st.Name,
+			NextDue:        toTimestamp(st.NextDue),
+			LastEvaluated:  toTimestamp(st.LastEvaluated),
+			LastMatches:    int64(st.LastMatches),
+			LastNotified:   st.LastNotified,
+			LastError:      st.LastError,
+			Unacknowledged: int64(st.Unacknowledged),
+			SnoozedUntil:   toTimestamp(st.SnoozedUntil),
+		})
+	}
+
+	return &resp, nil
+}
+
+// Snooze calls Control.Snooze with the requested alert name and duration.
+func (s controlServer) Snooze(_ context.Context, req *controlpb.SnoozeRequest) (*controlpb.SnoozeResponse, error) {
+	if d := req.GetDuration(); d != nil {
+		if err := d.CheckValid(); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "got invalid snooze duration: %v", err)
+		}
+	}
+	if err := s.c.Snooze(req.GetAlert(), req.GetDuration().AsDuration()); err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	return &controlpb.SnoozeResponse{}, nil
+}
+
+// GetLogs returns the most recent lines logged while evaluating the
+// requested alert.
+func (s controlServer) GetLogs(_ context.Context, req *controlpb.GetLogsRequest) (*controlpb.GetLogsResponse, error) {
+	lines, err := s.c.Logs(req.GetAlert(), int(req.GetLimit()))
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	var resp controlpb.GetLogsResponse
+	for _, line := range lines {
+		resp.Lines = append(resp.Lines, &controlpb.LogLine{Time: toTimestamp(line.Time), EvalId: line.EvalID, Text: line.Text})
+	}
+
+	return &resp, nil
+}
+
+// GetStatus returns the status of the polling Alerter.
+func (s controlServer) GetStatus(context.Context, *controlpb.GetStatusRequest) (*controlpb.GetStatusResponse, error) {
+	st := s.c.Status()
+
+	return &controlpb.GetStatusResponse{
+		Started: toTimestamp(st.Started),
+		Runs:    int64(st.Runs),
+		LastRun: toTimestamp(st.LastRun),
+		Alerts:  int64(st.Alerts),
+		Snoozed: int64(st.Snoozed),
+	}, nil
+}
+
+// ServeControl serves the given Control as the gRPC Control service of
+// controlpb on connections accepted from the given net.Listener, until the
+// given context is cancelled, at which point the listener is closed and nil
+// is returned. If the given token is not empty, every call must carry it as
+// a bearer token in its "authorization" metadata, like ControlClient does.
+// An error is returned if the listener accepts TCP connections on a
+// non-loopback address without a token, or if serving fails otherwise.
+func ServeControl(ctx context.Context, l net.Listener, c *Control, token string) error {
+	if addr, ok := l.Addr().(*net.TCPAddr); ok && token == "" && !addr.IP.IsLoopback() {
+		return fmt.Errorf("control api on non-loopback address %s must be authenticated with a token", addr)
+	}
+
+	srv := grpc.NewServer(grpc.UnaryInterceptor(controlAuthInterceptor(token)))
+	controlpb.RegisterControlServer(srv, controlServer{c: c})
+	go func() {
+		<-ctx.Done()
+		srv.Stop()
+	}()
+
+	if err := srv.Serve(l); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("got error serving control api: %v", err)
+	}
+
+	return nil
+}
+
+// controlAuthInterceptor returns a grpc.UnaryServerInterceptor rejecting
+// calls that do not carry the given token as a bearer token, or accepting
+// every call if the token is empty.
+func controlAuthInterceptor(token string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if token == "" {
+			return handler(ctx, req)
+		}
+		md, _ := metadata.FromIncomingContext(ctx)
+		for _, v := range md.Get("authorization") {
+			if subtle.ConstantTimeCompare([]byte(v), []byte("Bearer "+token)) == 1 {
+				return handler(ctx, req)
+			}
+		}
+
+		return nil, status.Error(codes.Unauthenticated, "control api call must carry a valid bearer token")
+	}
+}
+
+// controlToken represents a grpc.PerRPCCredentials sending a bearer token
+// with every call of a ControlClient.
+type controlToken string
+
+// GetRequestMetadata returns the "authorization" metadata carrying the
+// controlToken receiver t.
+func (t controlToken) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+// RequireTransportSecurity returns false, since the control API is served
+// without TLS on loopback addresses and Unix sockets.
+func (t controlToken) RequireTransportSecurity() bool {
+	return false
+}
+
+// ControlClient represents a client of the control API of a running
+// gmailalert daemon.
+type ControlClient struct {
+	conn   *grpc.ClientConn
+	client controlpb.ControlClient
+}
+
+// DialControl returns a ControlClient for the control API listening on the
+// given network address, like "127.0.0.1:7070" on "tcp" or a socket path on
+// "unix", which authenticates its calls with the given token unless it is
+// empty. The connection is made by the first call. An error is returned if
+// the client cannot be created.
+func DialControl(network, addr, token string) (*ControlClient, error) {
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		}),
+	}
+	if token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(controlToken(token)))
+	}
+	conn, err := grpc.Dial("passthrough:///"+addr, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("got error connecting to control api at %s: %v", addr, err)
+	}
+
+	return &ControlClient{conn: conn, client: controlpb.NewControlClient(conn)}, nil
+}
+
+// controlCallTimeout is how long a call of a ControlClient may take.
+const controlCallTimeout = 10 * time.Second
+
+// EvaluateNow requests the alert with the given name, or every alert if the
+// name is empty, to be evaluated as soon as possible.
+func (c *ControlClient) EvaluateNow(alert string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), controlCallTimeout)
+	defer cancel()
+	_, err := c.client.EvaluateNow(ctx, &controlpb.EvaluateNowRequest{Alert: alert})
+
+	return err
+}
+
+// ListAlerts returns the status of every alert polled by the daemon.
+func (c *ControlClient) ListAlerts() ([]AlertStatus, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), controlCallTimeout)
+	defer cancel()
+	resp, err := c.client.ListAlerts(ctx, &controlpb.ListAlertsRequest{})
+	if err != nil {
+		return nil, err
+	}
+
+	alerts := make([]AlertStatus, 0, len(resp.GetAlerts()))
+	for _, st := range resp.GetAlerts() {
+		alerts = append(alerts, AlertStatus{
+			Name:           st.GetName(),
+			NextDue:        fromTimestamp(st.GetNextDue()),
+			LastEvaluated:  fromTimestamp(st.GetLastEvaluated()),
+			LastMatches:    int(st.GetLastMatches()),
+			LastNotified:   st.GetLastNotified(),
+			LastError:      st.GetLastError(),
+			Unacknowledged: int(st.GetUnacknowledged()),
+			SnoozedUntil:   fromTimestamp(st.GetSnoozedUntil()),
+		})
+	}
+
+	return alerts, nil
+}
+
+// Snooze suppresses the notifications of the alert with the given name for
+// the given duration, or lifts a snooze if the duration is zero.
+func (c *ControlClient) Snooze(alert string, d time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), controlCallTimeout)
+	defer cancel()
+	_, err := c.client.Snooze(ctx, &controlpb.SnoozeRequest{Alert: alert, Duration: durationpb.New(d)})
+
+	return err
+}
+
+// Logs returns up to the given number of the most recent lines logged while
+// the daemon evaluated the alert with the given name, or every kept line if
+// the number is zero.
+func (c *ControlClient) Logs(alert string, limit int) ([]LogLine, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), controlCallTimeout)
+	defer cancel()
+	resp, err := c.client.GetLogs(ctx, &controlpb.GetLogsRequest{Alert: alert, Limit: int64(limit)})
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make([]LogLine, 0, len(resp.GetLines()))
+	for _, line := range resp.GetLines() {
+		lines = append(lines, LogLine{Time: fromTimestamp(line.GetTime()), EvalID: line.GetEvalId(), Text: line.GetText()})
+	}
+
+	return lines, nil
+}
+
+// GetStatus returns the status of the daemon.
+func (c *ControlClient) GetStatus() (Status, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), controlCallTimeout)
+	defer cancel()
+	resp, err := c.client.GetStatus(ctx, &controlpb.GetStatusRequest{})
+	if err != nil {
+		return Status{}, err
+	}
+
+	return Status{
+		Started: fromTimestamp(resp.GetStarted()),
+		Runs:    int(resp.GetRuns()),
+		LastRun: fromTimestamp(resp.GetLastRun()),
+		Alerts:  int(resp.GetAlerts()),
+		Snoozed: int(resp.GetSnoozed()),
+	}, nil
+}
+
+// Close closes the connection of the ControlClient.
+func (c *ControlClient) Close() error {
+	return c.conn.Close()
+}
+
+// toTimestamp returns the given time as a protocol buffer timestamp, or nil
+// if it is zero.
+func toTimestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+
+	return timestamppb.New(t)
+}
+
+// fromTimestamp returns the given protocol buffer timestamp as a local time,
+// or the zero time if it is nil.
+func fromTimestamp(ts *timestamppb.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+
+	return ts.AsTime().Local()
+}
+
+// readControlToken returns the control API token in the given file, without
+// surrounding whitespace, or an empty string if the file name is empty. An
+// error is returned if the file cannot be read or holds no token.
+func readControlToken(file string) (string, error) {
+	if file == "" {
+		return "", nil
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("got error reading control api token file: %v", err)
+	}
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return "", fmt.Errorf("control api token file %s must not be empty", file)
+	}
+
+	return token, nil
+}
+
+// controlNetwork returns the network and address to listen on or connect to
+// for the given control API address, which is either a "host:port" TCP
+// address or a Unix socket path prefixed with "unix:".
+func controlNetwork(addr string) (string, string) {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		return "unix", path
+	}
+
+	return "tcp", addr
+}
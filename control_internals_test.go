@@ -0,0 +1,316 @@
+package gmailalert
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestControlSnoozeSkipsNotifications(t *testing.T) {
+	t.Parallel()
+
+	c := NewControl()
+	notifier := &recordingTestNotifier{}
+	a := Alerter{
+		Matcher:  fakePreviewFetcher{matches: []Message{{ID: "1"}}},
+		Notifier: notifier,
+		Logger:   log.New(io.Discard, "", 0),
+	}
+	WithAlerterControl(c)(&a)
+	alerts := []Alert{{Name: "snoozed", GmailQuery: "is:unread"}, {Name: "awake", GmailQuery: "is:starred"}}
+	c.start(alerts)
+
+	if err := c.Snooze("snoozed", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	summary := a.run(alerts)
+
+	if len(notifier.alerts) != 1 || notifier.alerts[0].Name != "awake" {
+		t.Errorf("wanted only the alert \"awake\" to be notified, got %+v", notifier.alerts)
+	}
+	if !summary.Results[0].Suppressed {
+		t.Errorf("wanted the snoozed alert to be suppressed, got %+v", summary.Results[0])
+	}
+	if got := c.Status().Snoozed; got != 1 {
+		t.Errorf("wanted 1 snoozed alert, got %d", got)
+	}
+}
+
+func TestControlWithUnknownAlertReturnsError(t *testing.T) {
+	t.Parallel()
+
+	c := NewControl()
+	c.start([]Alert{{Name: "known", GmailQuery: "is:unread"}})
+
+	if err := c.EvaluateNow("unknown"); err == nil {
+		t.Error("expected an error evaluating an unknown alert but did not get one")
+	}
+	if err := c.Snooze("unknown", time.Hour); err == nil {
+		t.Error("expected an error snoozing an unknown alert but did not get one")
+	}
+}
+
+func TestControlRecentListsNewestFiredAlertsFirst(t *testing.T) {
+	t.Parallel()
+
+	c := NewControl()
+	c.start([]Alert{{Name: "bills"}, {Name: "orders"}})
+	for i := 0; i < maxRecentAlerts; i++ {
+		c.record(Summary{Results: []AlertResult{{Alert: "orders", EvalID: "old", Notified: true}}}, []time.Time{{}})
+	}
+	c.record(Summary{Results: []AlertResult{
+		{Alert: "bills", EvalID: "run.0", Matches: 2, Notified: true},
+		{Alert: "orders", EvalID: "run.1", Matches: 1, Suppressed: true},
+	}}, []time.Time{{}, {}})
+
+	recent := c.Recent(0)
+	latest := c.Recent(1)
+
+	if len(recent) != maxRecentAlerts {
+		t.Errorf("want %d fired alerts remembered, got %d", maxRecentAlerts, len(recent))
+	}
+	if len(latest) != 1 || latest[0].Alert != "bills" || latest[0].EvalID != "run.0" || latest[0].Matches != 2 {
+		t.Errorf("want the notified alert of the last run first, got %+v", latest)
+	}
+}
+
+func TestControlAPIControlsPollingAlerter(t *testing.T) {
+	t.Parallel()
+
+	c := NewControl()
+	a := Alerter{
+		Matcher:  fakePreviewFetcher{matches: []Message{{ID: "1"}, {ID: "2"}}},
+		Notifier: &recordingTestNotifier{},
+		Logger:   log.New(io.Discard, "", 0),
+	}
+	WithAlerterControl(c)(&a)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ServeControl(ctx, l, c, "")
+	polled := make(chan error, 1)
+	go func() {
+		polled <- a.Poll(ctx, []Alert{{Name: "unread", GmailQuery: "is:unread"}}, time.Hour, time.Hour)
+	}()
+
+	client, err := DialControl("tcp", l.Addr().String(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	waitForRuns(t, client, 1)
+
+	if err := client.EvaluateNow("unread"); err != nil {
+		t.Fatal(err)
+	}
+	waitForRuns(t, client, 2)
+
+	if err := client.Snooze("unread", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	alerts, err := client.ListAlerts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 1 || alerts[0].Name != "unread" || alerts[0].LastMatches != 2 || alerts[0].SnoozedUntil.IsZero() {
+		t.Errorf("wanted the alert \"unread\" with 2 matches to be listed as snoozed, got %+v", alerts)
+	}
+	if err := client.Snooze("unknown", time.Hour); err == nil {
+		t.Error("expected an error snoozing an unknown alert but did not get one")
+	}
+
+	cancel()
+	if err := <-polled; err != nil {
+		t.Errorf("got unexpected error polling: %v", err)
+	}
+}
+
+func TestRunControlCommand(t *testing.T) {
+	t.Parallel()
+
+	c := NewControl()
+	c.start([]Alert{{Name: "unread", GmailQuery: "is:unread"}})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ServeControl(ctx, l, c, "")
+	network, addr := controlNetwork(l.Addr().String())
+	client, err := DialControl(network, addr, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	testCases := map[string]struct {
+		args        []string
+		want        string
+		errExpected bool
+	}{
+		"Status prints the number of alerts": {
+			args: []string{"status"},
+			want: "alerts: 1",
+		},
+		"List prints every alert": {
+			args: []string{"list"},
+			want: "unread: matches=0",
+		},
+		"Evaluate of a known alert succeeds": {
+			args: []string{"evaluate", "unread"},
+		},
+		"Evaluate of an unknown alert returns error": {
+			args:        []string{"evaluate", "unknown"},
+			errExpected: true,
+		},
+		"Snooze with an invalid duration returns error": {
+			args:        []string{"snooze", "unread", "soon"},
+			errExpected: true,
+		},
+		"Missing command returns error": {
+			args:        nil,
+			errExpected: true,
+		},
+		"Unknown command returns error": {
+			args:        []string{"restart"},
+			errExpected: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := runControlCommand(client, tc.args, &out)
+			errReceived := err != nil
+
+			if tc.errExpected != errReceived {
+				t.Fatalf("runControlCommand(%q) returned unexpected error status, got error: %v", tc.args, err)
+			}
+			if !strings.Contains(out.String(), tc.want) {
+				t.Errorf("wanted output containing %q, got %q", tc.want, out.String())
+			}
+		})
+	}
+}
+
+func TestControlAPIRequiresToken(t *testing.T) {
+	t.Parallel()
+
+	c := NewControl()
+	c.start([]Alert{{Name: "unread", GmailQuery: "is:unread"}})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ServeControl(ctx, l, c, "s3cret")
+
+	testCases := map[string]struct {
+		token       string
+		errExpected bool
+	}{
+		"Call without token is rejected": {
+			errExpected: true,
+		},
+		"Call with wrong token is rejected": {
+			token:       "guess",
+			errExpected: true,
+		},
+		"Call with token succeeds": {
+			token: "s3cret",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			client, err := DialControl("tcp", l.Addr().String(), tc.token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+			_, err = client.GetStatus()
+			errReceived := err != nil
+
+			if tc.errExpected != errReceived {
+				t.Fatalf("GetStatus returned unexpected error status: %v", err)
+			}
+			if tc.errExpected && status.Code(err) != codes.Unauthenticated {
+				t.Errorf("want error code %s, got %v", codes.Unauthenticated, err)
+			}
+		})
+	}
+}
+
+func TestServeControlRejectsUnauthenticatedPublicAddress(t *testing.T) {
+	t.Parallel()
+
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	if err := ServeControl(context.Background(), l, NewControl(), ""); err == nil {
+		t.Error("want error serving the control api on every address without a token, got nil")
+	}
+}
+
+func TestReadControlToken(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "token.txt")
+	if err := os.WriteFile(file, []byte(" s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	empty := filepath.Join(dir, "empty.txt")
+	if err := os.WriteFile(empty, []byte("\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := readControlToken(file); err != nil || got != "s3cret" {
+		t.Errorf("want token %q, got %q and error %v", "s3cret", got, err)
+	}
+	if got, err := readControlToken(""); err != nil || got != "" {
+		t.Errorf("want no token without a file, got %q and error %v", got, err)
+	}
+	if _, err := readControlToken(empty); err == nil {
+		t.Error("want error for an empty token file, got nil")
+	}
+}
+
+// waitForRuns polls the daemon status with the given ControlClient until at
+// least the given number of runs finished, failing the test after a second.
+func waitForRuns(t *testing.T, c *ControlClient, runs int) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		s, err := c.GetStatus()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Runs >= runs {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("wanted at least %d runs, got %d", runs, s.Runs)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,6 @@
+// Package controlpb contains the protocol buffer messages and the gRPC
+// client and server stubs of the control API of a gmailalert daemon,
+// generated from control.proto.
+package controlpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative control.proto
@@ -0,0 +1,131 @@
+package gmailalert
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// CrashReport represents what is known about an unexpected crash of the
+// daemon, written to a file so that an unattended instance does not die
+// without a trace. It holds no secrets: the configuration is only
+// identified by a hash of its files.
+type CrashReport struct {
+	// When the crash happened.
+	Time time.Time `json:"time"`
+	// The version of gmailalert, or "(devel)" if it was not built from a
+	// tagged module version.
+	Version string `json:"version"`
+	// The version of Go gmailalert was built with.
+	GoVersion string `json:"goversion"`
+	// The operating system and architecture, like "linux/amd64".
+	Platform string `json:"platform"`
+	// The value the daemon panicked with.
+	Panic string `json:"panic"`
+	// The stack trace of the goroutine that panicked.
+	Stack string `json:"stack"`
+	// The hash of the alert configuration, credentials, and token files
+	// the daemon ran with, as described by configFingerprint.
+	ConfigFingerprint string `json:"configfingerprint"`
+	// The keys of the alerts the daemon evaluated.
+	Alerts []string `json:"alerts"`
+}
+
+// WithAlerterPanicHandler accepts a function and returns a functional option
+// for wiring it to an Alerter as the function called with the value and
+// stack trace of a panic while evaluating an alert.
+func WithAlerterPanicHandler(f func(v any, stack []byte)) AlerterOption {
+	return func(a *Alerter) {
+		a.PanicHandler = f
+	}
+}
+
+// recoverPanic is deferred by the goroutines evaluating alerts. If the
+// goroutine panics, it calls the Alerter's PanicHandler, if any, with the
+// panic's value and stack trace, and then panics again with the same value,
+// so that the crash is recorded without being hidden.
+func (a Alerter) recoverPanic() {
+	v := recover()
+	if v == nil {
+		return
+	}
+	if a.PanicHandler != nil {
+		a.PanicHandler(v, debug.Stack())
+	}
+	panic(v)
+}
+
+// newCrashReport accepts the value and stack trace of a panic, the time it
+// happened, the fingerprint of the configuration, and the alerts evaluated,
+// and returns a CrashReport describing the crash.
+func newCrashReport(v any, stack []byte, now time.Time, fingerprint string, alerts []Alert) CrashReport {
+	version := "(devel)"
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		version = info.Main.Version
+	}
+	keys := make([]string, 0, len(alerts))
+	for _, alt := range alerts {
+		keys = append(keys, alt.key())
+	}
+
+	return CrashReport{
+		Time:              now.UTC(),
+		Version:           version,
+		GoVersion:         runtime.Version(),
+		Platform:          runtime.GOOS + "/" + runtime.GOARCH,
+		Panic:             fmt.Sprint(v),
+		Stack:             string(stack),
+		ConfigFingerprint: fingerprint,
+		Alerts:            keys,
+	}
+}
+
+// write writes the CrashReport receiver r as JSON into a new file in the
+// given directory, named after the time of the crash and the process ID
+// like "gmailalert-crash-20261015T142501Z-4242.json", readable only by its
+// owner. The name of the file is returned, or an error if it cannot be
+// written.
+func (r CrashReport) write(dir string) (string, error) {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("got error json-encoding crash report: %v", err)
+	}
+	name := fmt.Sprintf("gmailalert-crash-%s-%d.json", r.Time.Format("20060102T150405Z"), os.Getpid())
+	file := filepath.Join(dir, name)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("got error creating crash report directory %s: %v", dir, err)
+	}
+	if err := os.WriteFile(file, b, 0600); err != nil {
+		return "", fmt.Errorf("got error writing crash report file %s: %v", file, err)
+	}
+
+	return file, nil
+}
+
+// reportCrash accepts the value and stack trace of a panic of the daemon
+// running the given alerts, writes a CrashReport into the crash directory
+// named in the cliEnv receiver, if any, and notifies the Monitor, if any,
+// about the crash. It logs the panic and any problem writing the report,
+// since the process is about to die.
+func (app cliEnv) reportCrash(v any, stack []byte, alerts []Alert) {
+	logger := newInfoLogger()
+	logger.Printf("daemon crashed: %v", v)
+	report := newCrashReport(v, stack, time.Now(), app.configFingerprint(), alerts)
+
+	file := ""
+	if app.crashDir != "" {
+		var err error
+		if file, err = report.write(app.crashDir); err != nil {
+			logger.Printf("got error writing crash report: %v", err)
+		} else {
+			logger.Printf("wrote crash report to %s", file)
+		}
+	}
+	if app.monitor != nil {
+		app.monitor.Crashed(v, file)
+	}
+}
@@ -0,0 +1,123 @@
+package gmailalert
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAlerterRecoverPanicCallsHandlerAndPanicsAgain(t *testing.T) {
+	t.Parallel()
+
+	var handled any
+	var stack []byte
+	a, err := NewAlerter(fakePreviewFetcher{}, &recordingTestNotifier{},
+		WithAlerterLogger(log.New(io.Discard, "", 0)),
+		WithAlerterPanicHandler(func(v any, s []byte) { handled, stack = v, s }))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := func() (v any) {
+		defer func() { v = recover() }()
+		defer a.recoverPanic()
+		panic("boom")
+	}()
+
+	if got != "boom" {
+		t.Errorf("want the panic to go on with %q, got %v", "boom", got)
+	}
+	if handled != "boom" {
+		t.Errorf("want the panic handler called with %q, got %v", "boom", handled)
+	}
+	if !strings.Contains(string(stack), "recoverPanic") {
+		t.Errorf("want the stack trace of the panic, got %q", stack)
+	}
+}
+
+func TestCrashReportWrite(t *testing.T) {
+	t.Parallel()
+
+	dir := filepath.Join(t.TempDir(), "crashes")
+	now := time.Date(2026, 10, 15, 14, 25, 1, 0, time.UTC)
+	report := newCrashReport("boom", []byte("goroutine 1 [running]:"), now, "abc123",
+		[]Alert{{Name: "bank"}, {GmailQuery: "from:shop"}})
+
+	file, err := report.write(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(filepath.Base(file), "gmailalert-crash-20261015T142501Z-") {
+		t.Errorf("want crash report file named after the time of the crash, got %s", file)
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("want crash report file only readable by its owner, got mode %v", perm)
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got CrashReport
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Panic != "boom" || got.ConfigFingerprint != "abc123" || got.Version == "" || got.GoVersion == "" {
+		t.Errorf("want crash report with panic, fingerprint, and versions, got %+v", got)
+	}
+	if len(got.Alerts) != 2 || got.Alerts[0] != "bank" {
+		t.Errorf("want crash report with the keys of the alerts, got %v", got.Alerts)
+	}
+}
+
+func TestCLIEnvReportCrashWritesReportAndNotifiesMonitor(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token.json")
+	if err := os.WriteFile(tokenFile, []byte(`{"access_token":"secret-access","refresh_token":"secret-refresh"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	n := &recordingTestNotifier{}
+	m, err := NewMonitor(MonitorConfig{PushoverTarget: "ops", Events: []string{MonitorCrash}}, n, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := cliEnv{
+		alertsConfigFile: filepath.Join(dir, "alerts.json"),
+		tokenFile:        tokenFile,
+		crashDir:         filepath.Join(dir, "crashes"),
+		monitor:          m,
+	}
+
+	app.reportCrash("boom", []byte("goroutine 1 [running]:"), []Alert{{Name: "bank"}})
+
+	files, err := filepath.Glob(filepath.Join(app.crashDir, "gmailalert-crash-*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("want one crash report file, got %v", files)
+	}
+	b, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "secret") {
+		t.Errorf("want crash report without secrets, got %s", b)
+	}
+	if len(n.alerts) != 1 || n.alerts[0].PushoverTitle != "gmailalert crashed" {
+		t.Fatalf("want one crash notification, got %+v", n.alerts)
+	}
+	if !strings.Contains(n.alerts[0].PushoverMsg, files[0]) {
+		t.Errorf("want crash notification pointing to %s, got %q", files[0], n.alerts[0].PushoverMsg)
+	}
+}
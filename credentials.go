@@ -0,0 +1,140 @@
+package gmailalert
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// storedToken represents the contents of a token file, which is a Gmail
+// OAuth2 token along with the ID of the OAuth2 client it was issued to.
+// Refresh tokens can only be refreshed by the client they were issued to,
+// so recording the client allows the credentials to be rotated.
+type storedToken struct {
+	oauth2.Token
+	// The ID of the OAuth2 client the token was issued to. It is empty in
+	// token files saved before client IDs were recorded.
+	ClientID string `json:"client_id,omitempty"`
+}
+
+// readStoredToken returns the token and client ID stored in the given token
+// file. An error is returned if the file cannot be read or decoded.
+func readStoredToken(file string) (storedToken, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return storedToken{}, fmt.Errorf("got error opening gmail oauth2 token file %s: %v", file, err)
+	}
+	defer f.Close()
+
+	var stored storedToken
+	if err := json.NewDecoder(f).Decode(&stored); err != nil {
+		return storedToken{}, fmt.Errorf("got error json-decoding gmail oauth2 token: %v", err)
+	}
+
+	return stored, nil
+}
+
+// credentialsFiles returns the comma-separated credentials files of the
+// given value of a "-credentials-file" flag or a "credentialsfile" field.
+func credentialsFiles(files string) []string {
+	var list []string
+	for _, file := range strings.Split(files, ",") {
+		if file = strings.TrimSpace(file); file != "" {
+			list = append(list, file)
+		}
+	}
+
+	return list
+}
+
+// resolveFiles returns each of the given comma-separated files resolved
+// against the config directory of the cliEnv receiver, like resolve.
+func (c cliEnv) resolveFiles(files string) string {
+	list := credentialsFiles(files)
+	for i, file := range list {
+		list[i] = c.resolve(file)
+	}
+
+	return strings.Join(list, ",")
+}
+
+// configFor returns the oauth2.Config of the credentials file of the OAuth2
+// client with the given ID, or of the first credentials file if the ID is
+// empty. Since a token can only be refreshed by the client it was issued to,
+// an error explaining how to keep using or replace the token is returned if
+// none of the credentials files belong to the client.
+func (g *gmailOAuth2) configFor(clientID string) (*oauth2.Config, error) {
+	if clientID == "" {
+		return g.oauthCfg, nil
+	}
+	for i, cfg := range g.oauthCfgs {
+		if cfg.ClientID != clientID {
+			continue
+		}
+		if i > 0 {
+			g.Logger.Printf("gmail oauth2 token in %s was issued to the oauth client of credentials file %s, "+
+				"run \"gmailalert auth\" to authorize the client of the first credentials file before removing it",
+				g.TokenFile, credentialsFiles(g.CredentialsFile)[i])
+		}
+		return cfg, nil
+	}
+
+	return nil, fmt.Errorf("gmail oauth2 token in %s was issued to oauth client %s, which none of the credentials files %s belong to; "+
+		"add its credentials file back after the new one, like \"-credentials-file new.json,old.json\", "+
+		"or run \"gmailalert auth\" to authorize the new client", g.TokenFile, clientID, g.CredentialsFile)
+}
+
+// reauthErrorCodes are the OAuth2 error codes returned when refreshing a
+// token that was revoked, expired, or issued to another client.
+var reauthErrorCodes = map[string]bool{"invalid_grant": true, "invalid_client": true, "unauthorized_client": true}
+
+// reauthRequiredError represents an error refreshing a token that the Google
+// OAuth2 API rejected, which is only fixed by authorizing gmailalert again.
+type reauthRequiredError struct {
+	msg string
+	err error
+}
+
+// Error returns the message of the reauthRequiredError receiver e, which
+// explains how to authorize gmailalert again.
+func (e *reauthRequiredError) Error() string {
+	return e.msg
+}
+
+// Unwrap returns the error refreshing the token.
+func (e *reauthRequiredError) Unwrap() error {
+	return e.err
+}
+
+// isReauthRequired reports whether the given error, or any error it wraps,
+// is a rejected token that requires authorizing gmailalert again.
+func isReauthRequired(err error) bool {
+	var reauthErr *reauthRequiredError
+	return errors.As(err, &reauthErr)
+}
+
+// reauthError returns the given error refreshing the token in the given
+// token file, with instructions to authorize gmailalert again if the Google
+// OAuth2 API rejected the token or the client.
+func reauthError(err error, tokenFile string) error {
+	var retrieveErr *oauth2.RetrieveError
+	if !errors.As(err, &retrieveErr) {
+		return err
+	}
+	var body struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(retrieveErr.Body, &body) != nil || !reauthErrorCodes[body.Error] {
+		return err
+	}
+
+	return &reauthRequiredError{
+		msg: fmt.Sprintf("gmail oauth2 token in %s was rejected (%s), it may have been revoked or issued to another oauth client "+
+			"than the first credentials file; run \"gmailalert auth\" to authorize gmailalert again: %v", tokenFile, body.Error, err),
+		err: err,
+	}
+}
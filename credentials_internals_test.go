@@ -0,0 +1,171 @@
+package gmailalert
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/oauth2"
+)
+
+// writeCredentials writes a Google Developers Console credentials file for
+// the OAuth2 client with the given ID and secret into the given directory
+// and returns its name.
+func writeCredentials(t *testing.T, dir, clientID, secret string) string {
+	t.Helper()
+	file := filepath.Join(dir, clientID+"-"+secret+".json")
+	creds := fmt.Sprintf(`{"installed": {"client_id": %q, "client_secret": %q, "redirect_uris": ["http://localhost"], `+
+		`"auth_uri": "https://accounts.google.com/o/oauth2/auth", "token_uri": "https://oauth2.googleapis.com/token"}}`, clientID, secret)
+	if err := os.WriteFile(file, []byte(creds), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestConfigFor(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	rotated := writeCredentials(t, dir, "client-a", "new-secret")
+	old := writeCredentials(t, dir, "client-a", "old-secret")
+	other := writeCredentials(t, dir, "client-b", "secret")
+	testCases := map[string]struct {
+		credentials string
+		clientID    string
+		wantSecret  string
+		errExpected bool
+	}{
+		"Token without client ID uses first credentials": {
+			credentials: rotated + "," + other,
+			wantSecret:  "new-secret",
+		},
+		"Rotated secret of the same client is used without reauthorizing": {
+			credentials: rotated + "," + old,
+			clientID:    "client-a",
+			wantSecret:  "new-secret",
+		},
+		"Token of the old client uses its credentials": {
+			credentials: other + ", " + rotated,
+			clientID:    "client-a",
+			wantSecret:  "new-secret",
+		},
+		"Token of a client without credentials returns error": {
+			credentials: other,
+			clientID:    "client-a",
+			errExpected: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			g := &gmailOAuth2{GmailClientConfig: GmailClientConfig{
+				CredentialsFile: tc.credentials,
+				TokenFile:       "token.json",
+				Logger:          log.New(io.Discard, "", 0),
+			}}
+			if err := g.initializeConfig(); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, err := g.configFor(tc.clientID)
+			errReceived := err != nil
+
+			if tc.errExpected != errReceived {
+				t.Fatalf("configFor(%q) returned unexpected error status: %v", tc.clientID, err)
+			}
+			if tc.errExpected {
+				if !strings.Contains(err.Error(), "gmailalert auth") {
+					t.Errorf("want error explaining how to authorize again, got %v", err)
+				}
+				return
+			}
+			if cfg.ClientSecret != tc.wantSecret {
+				t.Errorf("want client secret %q, got %q", tc.wantSecret, cfg.ClientSecret)
+			}
+		})
+	}
+}
+
+func TestSaveTokenRecordsClientID(t *testing.T) {
+	t.Parallel()
+
+	file := filepath.Join(t.TempDir(), "token.json")
+	tok := &oauth2.Token{AccessToken: "access", RefreshToken: "refresh", TokenType: "Bearer"}
+
+	if err := saveToken(file, tok, "client-a"); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := readStoredToken(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stored.ClientID != "client-a" {
+		t.Errorf("want client ID %q, got %q", "client-a", stored.ClientID)
+	}
+	if stored.RefreshToken != "refresh" || stored.AccessToken != "access" {
+		t.Errorf("want token saved along with client ID, got %+v", stored.Token)
+	}
+}
+
+func TestReauthError(t *testing.T) {
+	t.Parallel()
+
+	retrieveErr := func(body string) error {
+		return &oauth2.RetrieveError{Response: &http.Response{Status: "400 Bad Request"}, Body: []byte(body)}
+	}
+	testCases := map[string]struct {
+		err        error
+		wantReauth bool
+	}{
+		"Revoked token asks to authorize again": {
+			err:        retrieveErr(`{"error": "invalid_grant", "error_description": "Token has been expired or revoked."}`),
+			wantReauth: true,
+		},
+		"Token of another client asks to authorize again": {
+			err:        fmt.Errorf("refreshing: %w", retrieveErr(`{"error": "unauthorized_client"}`)),
+			wantReauth: true,
+		},
+		"Other oauth error is returned as is": {
+			err: retrieveErr(`{"error": "temporarily_unavailable"}`),
+		},
+		"Network error is returned as is": {
+			err: errors.New("connection refused"),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got := reauthError(tc.err, "token.json")
+
+			if !errors.Is(got, tc.err) {
+				t.Errorf("want error wrapping %v, got %v", tc.err, got)
+			}
+			if reauth := strings.Contains(got.Error(), "gmailalert auth"); reauth != tc.wantReauth {
+				t.Errorf("want instructions to authorize again %t, got %v", tc.wantReauth, got)
+			}
+		})
+	}
+}
+
+func TestCredentialsFiles(t *testing.T) {
+	t.Parallel()
+
+	got := credentialsFiles(" new.json, old.json,,")
+	want := []string{"new.json", "old.json"}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+
+	app := cliEnv{configDir: "/etc/gmailalert"}
+	if got := app.resolveFiles("new.json,/keys/old.json"); got != "/etc/gmailalert/new.json,/keys/old.json" {
+		t.Errorf("want each file resolved against the config directory, got %q", got)
+	}
+}
@@ -0,0 +1,123 @@
+package gmailalert
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// ctlCLI accepts the command line flags of the "ctl" subcommand, which
+// controls a gmailalert daemon through the control API it serves on the
+// address given with the "-control-addr" flag. The arguments following the
+// flags name the command to run:
+//
+//	status                     print the status of the daemon
+//	list                       print the status of every alert
+//	evaluate [alert]           evaluate the alert, or every alert, now
+//	snooze <alert> <duration>  snooze the alert's notifications (0 lifts it)
+//
+// An error is returned if the flags or command are invalid, the daemon
+// cannot be reached, or the command fails.
+func ctlCLI(args []string) error {
+	var app cliEnv
+
+	fs := app.flagSet("ctl")
+	fs.StringVar(
+		&app.controlAddr,
+		"control-addr",
+		"localhost:7070",
+		`the address of the daemon's control api, either "host:port" or "unix:<socket path>"`)
+	fs.StringVar(
+		&app.controlTokenFile,
+		"control-token-file",
+		"",
+		"file holding the bearer token the daemon's control api requires, as given to the daemon with the same flag")
+	if err := app.parse(fs, args); err != nil {
+		return err
+	}
+
+	token, err := readControlToken(app.controlTokenFile)
+	if err != nil {
+		return err
+	}
+	network, addr := controlNetwork(app.controlAddr)
+	client, err := DialControl(network, addr, token)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return runControlCommand(client, fs.Args(), os.Stdout)
+}
+
+// runControlCommand accepts a ControlClient, the arguments naming a command
+// of the "ctl" subcommand, and an io.Writer, runs the command with the
+// ControlClient, and writes its output to the io.Writer. An error is returned
+// if the command is invalid or fails.
+func runControlCommand(c *ControlClient, args []string, w io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(`a command must be given: "status", "list", "evaluate", or "snooze"`)
+	}
+
+	switch cmd, args := args[0], args[1:]; {
+	case cmd == "status" && len(args) == 0:
+		s, err := c.GetStatus()
+		if err != nil {
+			return fmt.Errorf("got error getting daemon status: %v", err)
+		}
+		fmt.Fprintf(w, "started: %s\nruns: %d\nlast run: %s\nalerts: %d\nsnoozed: %d\n",
+			formatTime(s.Started), s.Runs, formatTime(s.LastRun), s.Alerts, s.Snoozed)
+	case cmd == "list" && len(args) == 0:
+		alerts, err := c.ListAlerts()
+		if err != nil {
+			return fmt.Errorf("got error listing alerts: %v", err)
+		}
+		for _, st := range alerts {
+			fmt.Fprintf(w, "%s: matches=%d notified=%t last=%s next=%s",
+				st.Name, st.LastMatches, st.LastNotified, formatTime(st.LastEvaluated), formatTime(st.NextDue))
+			if !st.SnoozedUntil.IsZero() && time.Now().Before(st.SnoozedUntil) {
+				fmt.Fprintf(w, " snoozed-until=%s", formatTime(st.SnoozedUntil))
+			}
+			if st.Unacknowledged > 0 {
+				fmt.Fprintf(w, " unacknowledged=%d", st.Unacknowledged)
+			}
+			if st.LastError != "" {
+				fmt.Fprintf(w, " error=%q", st.LastError)
+			}
+			fmt.Fprintln(w)
+		}
+	case cmd == "evaluate" && len(args) <= 1:
+		var name string
+		if len(args) == 1 {
+			name = args[0]
+		}
+		if err := c.EvaluateNow(name); err != nil {
+			return fmt.Errorf("got error requesting evaluation: %v", err)
+		}
+	case cmd == "snooze" && len(args) == 2:
+		d, err := time.ParseDuration(args[1])
+		if err != nil {
+			return fmt.Errorf("got error parsing snooze duration %q: %v", args[1], err)
+		}
+		if err := c.Snooze(args[0], d); err != nil {
+			return fmt.Errorf("got error snoozing alert: %v", err)
+		}
+	default:
+		return fmt.Errorf("invalid command %q, want \"status\", \"list\", \"evaluate [alert]\", or \"snooze <alert> <duration>\"", strings.Join(append([]string{cmd}, args...), " "))
+	}
+
+	return nil
+}
+
+// formatTime returns the given time formatted as RFC 3339, or "-" if it is
+// zero.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+
+	return t.Format(time.RFC3339)
+}
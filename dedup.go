@@ -0,0 +1,44 @@
+package gmailalert
+
+import "time"
+
+// WithAlerterDedupWindow accepts a duration and returns a functional option
+// for making an Alerter suppress a notification whose dedup key was already
+// sent within the duration.
+func WithAlerterDedupWindow(d time.Duration) AlerterOption {
+	return func(a *Alerter) {
+		a.DedupWindow = d
+	}
+}
+
+// duplicate reports whether a notification with the dedup key of the given
+// Alert was sent within the Alerter's dedup window before the given time,
+// according to the Alerter's State.
+func (a Alerter) duplicate(alt Alert, now time.Time) bool {
+	if a.State == nil || a.DedupWindow <= 0 {
+		return false
+	}
+	sent, ok := a.State.Get(alt.key()).Sent[alt.DedupKey]
+
+	return ok && now.Sub(sent) < a.DedupWindow
+}
+
+// recordSent returns the given AlertState with the given dedup key recorded
+// as sent at the given time, if the Alerter has a dedup window, and with the
+// dedup keys sent before the window dropped.
+func (a Alerter) recordSent(st AlertState, key string, now time.Time) AlertState {
+	if a.DedupWindow <= 0 {
+		return st
+	}
+
+	sent := make(map[string]time.Time, len(st.Sent)+1)
+	for k, t := range st.Sent {
+		if now.Sub(t) < a.DedupWindow {
+			sent[k] = t
+		}
+	}
+	sent[key] = now
+	st.Sent = sent
+
+	return st
+}
@@ -0,0 +1,63 @@
+package gmailalert_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aculclasure/gmailalert"
+)
+
+func TestProcessWithDedupWindow(t *testing.T) {
+	t.Parallel()
+
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	recNotif := &recordingNotifier{}
+	alerts := []gmailalert.Alert{{Name: "orders", GmailQuery: "from:shop", RepeatInterval: "always"}}
+	setA := []gmailalert.Message{{ID: "1"}, {ID: "2"}}
+	setB := []gmailalert.Message{{ID: "3"}}
+
+	// process runs the alerts once with the given matches and a State loaded
+	// from, and saved into, the state file, like a separate process would.
+	process := func(matches []gmailalert.Message, window time.Duration) {
+		t.Helper()
+		state, err := gmailalert.LoadState(stateFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		alerter, err := gmailalert.NewAlerter(fakeMatcher{matches: matches}, recNotif,
+			gmailalert.WithAlerterLogger(&spyLogger{}),
+			gmailalert.WithAlerterState(state),
+			gmailalert.WithAlerterDedupWindow(window))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := alerter.Process(alerts); err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+		if err := state.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	process(setA, time.Hour)
+	process(setA, time.Hour)
+	process(setB, time.Hour)
+	process(setA, time.Hour)
+	if len(recNotif.alerts) != 2 {
+		t.Fatalf("want only the first notification of each set of emails within the window, got %d notifications", len(recNotif.alerts))
+	}
+
+	first, second := recNotif.alerts[0].DedupKey, recNotif.alerts[1].DedupKey
+	if first == "" || first == second {
+		t.Errorf("want distinct dedup keys for distinct sets of emails, got %q and %q", first, second)
+	}
+
+	process(setA, 0)
+	if len(recNotif.alerts) != 3 {
+		t.Fatalf("want identical notification without a dedup window, got %d notifications", len(recNotif.alerts))
+	}
+	if got := recNotif.alerts[2].DedupKey; got != first {
+		t.Errorf("want the same dedup key for the same set of emails, got %q and %q", first, got)
+	}
+}
@@ -0,0 +1,120 @@
+package gmailalert
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// checkDependencies returns an error if any of the given alerts is
+// suppressed by an alert that is not among them, or if alerts suppress each
+// other in a cycle.
+func checkDependencies(alerts []Alert) error {
+	byKey := make(map[string]Alert, len(alerts))
+	for _, alt := range alerts {
+		byKey[alt.key()] = alt
+	}
+	for _, alt := range alerts {
+		for _, dep := range alt.SuppressedBy {
+			if _, ok := byKey[dep]; !ok {
+				return fmt.Errorf("alert %q is suppressed by unknown alert %q", alt.key(), dep)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	marks := map[string]int{}
+	var visit func(key string, path []string) error
+	visit = func(key string, path []string) error {
+		switch marks[key] {
+		case visiting:
+			return fmt.Errorf("alerts suppress each other in a cycle: %q", append(path, key))
+		case visited:
+			return nil
+		}
+		marks[key] = visiting
+		for _, dep := range byKey[key].SuppressedBy {
+			if err := visit(dep, append(path, key)); err != nil {
+				return err
+			}
+		}
+		marks[key] = visited
+		return nil
+	}
+	for _, alt := range alerts {
+		if err := visit(alt.key(), nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dependencyLevels groups the indexes of the given alerts into levels, such
+// that every alert comes after the alerts among them that can suppress it.
+// The alerts of a level can be processed concurrently once the previous
+// levels are processed. Dependencies on alerts not among the given alerts
+// are ignored. Within a level, alerts are ordered by descending Priority,
+// and alerts of the same Priority keep their given order.
+func dependencyLevels(alerts []Alert) [][]int {
+	index := make(map[string]int, len(alerts))
+	for i, alt := range alerts {
+		index[alt.key()] = i
+	}
+
+	level := make([]int, len(alerts))
+	for pass := 0; pass < len(alerts); pass++ {
+		changed := false
+		for i, alt := range alerts {
+			for _, dep := range alt.SuppressedBy {
+				j, ok := index[dep]
+				if ok && level[i] <= level[j] {
+					level[i], changed = level[j]+1, true
+				}
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+
+	var levels [][]int
+	for i, l := range level {
+		for len(levels) <= l {
+			levels = append(levels, nil)
+		}
+		levels[l] = append(levels[l], i)
+	}
+	for _, l := range levels {
+		sort.SliceStable(l, func(i, j int) bool { return alerts[l[i]].Priority > alerts[l[j]].Priority })
+	}
+
+	return levels
+}
+
+// suppressingAlert returns the key of the first alert suppressing the given
+// Alert that was notified within the Alert's suppression window, or an empty
+// string if there is none. An error is returned if the Alerter has no State
+// or if the suppression window is invalid.
+func (a Alerter) suppressingAlert(alt Alert, now time.Time) (string, error) {
+	if a.State == nil {
+		return "", fmt.Errorf("alert %q requires the notification history to be persisted to be suppressed by other alerts", alt.key())
+	}
+	window, err := time.ParseDuration(alt.SuppressWindow)
+	if err != nil || window <= 0 {
+		return "", fmt.Errorf("suppression window must be a positive duration, got %q", alt.SuppressWindow)
+	}
+
+	for _, dep := range alt.SuppressedBy {
+		notified := a.State.Get(dep).Notified
+		if !notified.IsZero() && now.Sub(notified) < window {
+			return dep, nil
+		}
+	}
+
+	return "", nil
+}
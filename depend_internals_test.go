@@ -0,0 +1,164 @@
+package gmailalert
+
+import (
+	"io"
+	"log"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestCheckDependencies(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		input       []Alert
+		errExpected bool
+	}{
+		"Alerts without dependencies are valid": {
+			input: []Alert{{Name: "a"}, {Name: "b"}},
+		},
+		"Chained dependencies are valid": {
+			input: []Alert{
+				{Name: "order", SuppressedBy: []string{"summary"}},
+				{Name: "summary", SuppressedBy: []string{"digest"}},
+				{Name: "digest"},
+			},
+		},
+		"Unknown dependency returns an error": {
+			input:       []Alert{{Name: "order", SuppressedBy: []string{"summary"}}},
+			errExpected: true,
+		},
+		"Cyclic dependencies return an error": {
+			input: []Alert{
+				{Name: "a", SuppressedBy: []string{"b"}},
+				{Name: "b", SuppressedBy: []string{"a"}},
+			},
+			errExpected: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errReceived := checkDependencies(tc.input) != nil
+
+			if tc.errExpected != errReceived {
+				t.Errorf("got unexpected error status %v", errReceived)
+			}
+		})
+	}
+}
+
+func TestDependencyLevels(t *testing.T) {
+	t.Parallel()
+
+	alerts := []Alert{
+		{Name: "order", SuppressedBy: []string{"summary", "missing"}},
+		{Name: "summary", SuppressedBy: []string{"digest"}},
+		{Name: "digest"},
+		{Name: "unrelated"},
+	}
+
+	got := dependencyLevels(alerts)
+
+	want := [][]int{{2, 3}, {1}, {0}}
+	if !cmp.Equal(want, got) {
+		t.Errorf("want != got\ndiff=%s", cmp.Diff(want, got))
+	}
+}
+
+func TestDependencyLevelsOrdersAlertsByPriority(t *testing.T) {
+	t.Parallel()
+
+	alerts := []Alert{
+		{Name: "newsletter", Priority: -1},
+		{Name: "orders"},
+		{Name: "security", Priority: 10},
+		{Name: "bills"},
+		{Name: "summary", Priority: 10, SuppressedBy: []string{"bills"}},
+	}
+
+	got := dependencyLevels(alerts)
+
+	want := [][]int{{2, 1, 3, 0}, {4}}
+	if !cmp.Equal(want, got) {
+		t.Errorf("want != got\ndiff=%s", cmp.Diff(want, got))
+	}
+}
+
+// orderMatcher is a Matcher recording the order of the queries it runs.
+type orderMatcher struct {
+	mtx     sync.Mutex
+	queries []string
+}
+
+func (o *orderMatcher) Match(query string) ([]string, error) {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	o.queries = append(o.queries, query)
+	return nil, nil
+}
+
+func TestAlerterQueriesAlertsByPriority(t *testing.T) {
+	t.Parallel()
+
+	m := &orderMatcher{}
+	a := Alerter{
+		Matcher:     m,
+		Notifier:    &recordingTestNotifier{},
+		Logger:      log.New(io.Discard, "", 0),
+		Concurrency: 1,
+	}
+	alerts := []Alert{
+		{GmailQuery: "from:newsletter", Priority: -1},
+		{GmailQuery: "from:orders"},
+		{GmailQuery: "from:security", Priority: 5},
+	}
+
+	a.run(alerts)
+
+	want := []string{"from:security", "from:orders", "from:newsletter"}
+	if !cmp.Equal(want, m.queries) {
+		t.Errorf("want != got\ndiff=%s", cmp.Diff(want, m.queries))
+	}
+}
+
+func TestProcessSuppressesAlertsByRecentlyNotifiedDependencies(t *testing.T) {
+	t.Parallel()
+
+	state, err := LoadState(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.Set("stale summary", AlertState{Notified: time.Now().Add(-48 * time.Hour), MessageIDs: []string{"id0"}})
+	n := &recordingTestNotifier{}
+	a := Alerter{
+		Matcher:  fakePreviewFetcher{matches: []Message{{ID: "id0"}}},
+		Notifier: n,
+		Logger:   log.New(io.Discard, "", 0),
+		State:    state,
+	}
+	alerts := []Alert{
+		{Name: "order", GmailQuery: "subject:order", SuppressedBy: []string{"summary"}, SuppressWindow: "24h"},
+		{Name: "summary", GmailQuery: "subject:summary"},
+		{Name: "refund", GmailQuery: "subject:refund", SuppressedBy: []string{"stale summary"}, SuppressWindow: "24h"},
+		{Name: "stale summary", GmailQuery: "subject:stale", RepeatInterval: "once"},
+	}
+
+	if err := a.Process(alerts); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+
+	var got []string
+	for _, alt := range n.alerts {
+		got = append(got, alt.Name)
+	}
+	want := []string{"summary", "refund"}
+	if !cmp.Equal(want, got, cmpopts.SortSlices(func(a, b string) bool { return a < b })) {
+		t.Errorf("want != got\ndiff=%s", cmp.Diff(want, got))
+	}
+}
@@ -0,0 +1,56 @@
+package gmailalert
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Toaster represents a Reporter that shows a desktop notification, or
+// "toast", with the notification command of the platform: notify-send on
+// Linux and other unix systems, osascript on macOS, and PowerShell on
+// Windows. It shows a toast for every alert notified in a run, and one for
+// the alerts that failed whenever their number changes, so that a desktop
+// user notices both matches and problems without watching the logs.
+type Toaster struct {
+	// The function showing a toast with a title and a message.
+	show   func(title, message string) error
+	mtx    sync.Mutex
+	failed int
+}
+
+// NewToaster returns a new Toaster showing toasts with the notification
+// command of the platform.
+func NewToaster() *Toaster {
+	return &Toaster{show: showToast}
+}
+
+// Report accepts the Summary of a run and shows a toast for every alert that
+// was notified, and one for the alerts that failed if their number changed
+// since the previous run. An error is returned if any toast cannot be shown.
+func (t *Toaster) Report(s Summary) error {
+	var firstErr error
+	show := func(title, message string) {
+		if err := t.show(title, message); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("got error showing desktop notification: %v", err)
+		}
+	}
+
+	for _, r := range s.Results {
+		if r.Notified {
+			show("gmailalert: "+r.Alert, fmt.Sprintf("Found %d emails", r.Matches))
+		}
+	}
+
+	t.mtx.Lock()
+	failed, changed := s.Failed(), s.Failed() != t.failed
+	t.failed = failed
+	t.mtx.Unlock()
+	switch {
+	case changed && failed > 0:
+		show("gmailalert", fmt.Sprintf("%d alerts failed, see the logs for details", failed))
+	case changed:
+		show("gmailalert", "All alerts are working again")
+	}
+
+	return firstErr
+}
@@ -0,0 +1,50 @@
+package gmailalert
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestToasterReport(t *testing.T) {
+	t.Parallel()
+
+	var got []string
+	toaster := &Toaster{show: func(title, message string) error {
+		got = append(got, title+": "+message)
+		return nil
+	}}
+	runs := []Summary{
+		{Results: []AlertResult{{Alert: "bills", Matches: 2, Notified: true}, {Alert: "zoom"}}},
+		{Results: []AlertResult{{Alert: "bills", Err: errors.New("gmail down")}, {Alert: "zoom", Err: errors.New("gmail down")}}},
+		{Results: []AlertResult{{Alert: "bills", Err: errors.New("gmail down")}, {Alert: "zoom", Err: errors.New("gmail down")}}},
+		{Results: []AlertResult{{Alert: "bills"}, {Alert: "zoom"}}},
+	}
+
+	for _, s := range runs {
+		if err := toaster.Report(s); err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+	}
+
+	want := []string{
+		"gmailalert: bills: Found 2 emails",
+		"gmailalert: 2 alerts failed, see the logs for details",
+		"gmailalert: All alerts are working again",
+	}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestToasterReportWithFailingCommandReturnsError(t *testing.T) {
+	t.Parallel()
+
+	toaster := &Toaster{show: func(string, string) error { return errors.New("notify-send not found") }}
+
+	err := toaster.Report(Summary{Results: []AlertResult{{Alert: "bills", Matches: 1, Notified: true}}})
+	if err == nil {
+		t.Error("expected an error but did not get one")
+	}
+}
@@ -0,0 +1,133 @@
+package gmailalert
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// alertDiff represents the difference between the emails currently matching
+// an alert and the emails that matched it when it was last notified, as
+// recorded in the state file.
+type alertDiff struct {
+	// The name of the alert, or its Gmail query if it has no name.
+	Alert string `json:"alert"`
+	// The IDs of the emails matching the alert now but not before.
+	New []string `json:"new"`
+	// The IDs of the emails that matched the alert before but not now.
+	Resolved []string `json:"resolved"`
+	// The IDs of the emails matching the alert both before and now.
+	Persisting []string `json:"persisting"`
+}
+
+// diffCLI accepts the command line flags of the "diff" subcommand, which
+// evaluates the alert named by the "-alert" flag, or every alert if it is
+// empty, and prints a JSON array with the new, resolved, and persisting
+// matches of each alert compared to the state file, without sending any
+// notifications or changing the state file. An error is returned if the
+// flags are invalid, the alert configuration or state file cannot be
+// loaded, or any alert cannot be evaluated.
+func diffCLI(args []string) error {
+	var app cliEnv
+	var alertName string
+
+	fs := app.flagSet("diff")
+	fs.StringVar(
+		&alertName,
+		"alert",
+		"",
+		"the name (or gmail query) of the alert to compare matches for (all alerts if empty)")
+	if err := app.parse(fs, args); err != nil {
+		return err
+	}
+	if app.stateFile == "" {
+		fs.Usage()
+		return errors.New(`command line flag "-state-file" must be non-empty`)
+	}
+
+	app, alertCfg, err := app.profileConfig()
+	if err != nil {
+		return err
+	}
+	selected, err := selectAlerts(alertCfg.Alerts, alertName)
+	if err != nil {
+		return err
+	}
+	state, err := app.openState(alertCfg.State)
+	if err != nil {
+		return err
+	}
+
+	debugLogger := app.debugLogger()
+	gmailClient, err := app.gmailClient(debugLogger, alertCfg)
+	if err != nil {
+		return err
+	}
+	alerter := Alerter{Matcher: gmailClient, Logger: debugLogger, State: state}
+
+	return diffMatches(alerter, selected, alertName != "", os.Stdout)
+}
+
+// diffMatches accepts an Alerter, a slice of Alerts, whether the Alerts were
+// selected by name, and an io.Writer, evaluates each Alert, and writes a
+// JSON array with the alertDiff of each Alert against the Alerter's State to
+// the io.Writer. Alerts watching a label are skipped, since their matches
+// are changes rather than a set of emails, unless they were selected by
+// name, in which case an error is returned. An error is also returned if any
+// Alert cannot be evaluated or the output cannot be written.
+func diffMatches(a Alerter, alerts []Alert, selected bool, w io.Writer) error {
+	diffs := make([]alertDiff, 0, len(alerts))
+	for _, alt := range alerts {
+		if _, _, watchesLabel := alt.labelWatch(); watchesLabel {
+			if selected {
+				return fmt.Errorf("alert %q watches a label and has no matches to compare", alt.key())
+			}
+			continue
+		}
+
+		tx := a.State.Begin()
+		matches, _, err := a.candidates(alt, tx, &StageTimings{})
+		tx.Rollback()
+		if err != nil {
+			return err
+		}
+		diffs = append(diffs, diffIDs(alt.key(), a.State.Get(alt.key()).MessageIDs, messageIDs(matches)))
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(diffs); err != nil {
+		return fmt.Errorf("got error writing diff: %v", err)
+	}
+
+	return nil
+}
+
+// diffIDs returns the alertDiff of the alert with the given name between
+// the given previous and current message IDs, keeping the order in which
+// the IDs are given.
+func diffIDs(name string, prev, cur []string) alertDiff {
+	d := alertDiff{Alert: name, New: []string{}, Resolved: []string{}, Persisting: []string{}}
+	before := make(map[string]bool, len(prev))
+	for _, id := range prev {
+		before[id] = true
+	}
+	now := make(map[string]bool, len(cur))
+	for _, id := range cur {
+		now[id] = true
+		if before[id] {
+			d.Persisting = append(d.Persisting, id)
+		} else {
+			d.New = append(d.New, id)
+		}
+	}
+	for _, id := range prev {
+		if !now[id] {
+			d.Resolved = append(d.Resolved, id)
+		}
+	}
+
+	return d
+}
@@ -0,0 +1,79 @@
+package gmailalert
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDiffIDs(t *testing.T) {
+	t.Parallel()
+
+	want := alertDiff{
+		Alert:      "orders",
+		New:        []string{"4", "5"},
+		Resolved:   []string{"1"},
+		Persisting: []string{"2", "3"},
+	}
+	got := diffIDs("orders", []string{"1", "2", "3"}, []string{"2", "4", "3", "5"})
+
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestDiffMatches(t *testing.T) {
+	t.Parallel()
+
+	newAlerter := func(t *testing.T, m Matcher) Alerter {
+		state, err := LoadState(filepath.Join(t.TempDir(), "state.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		state.Set("orders", AlertState{MessageIDs: []string{"1", "2"}})
+		return Alerter{Matcher: m, Logger: log.New(&bytes.Buffer{}, "", 0), State: state}
+	}
+	alerts := []Alert{
+		{Name: "orders", GmailQuery: "from:shop"},
+		{Name: "banking", LabelAdded: "Banking"},
+	}
+
+	t.Run("label alerts are skipped", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		a := newAlerter(t, fakePreviewFetcher{matches: []Message{{ID: "2"}, {ID: "3"}}})
+
+		if err := diffMatches(a, alerts, false, out); err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		var got []alertDiff
+		if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		want := []alertDiff{{Alert: "orders", New: []string{"3"}, Resolved: []string{"1"}, Persisting: []string{"2"}}}
+		if !cmp.Equal(want, got) {
+			t.Error(cmp.Diff(want, got))
+		}
+	})
+
+	t.Run("selected label alert returns an error", func(t *testing.T) {
+		a := newAlerter(t, fakePreviewFetcher{})
+
+		if err := diffMatches(a, alerts[1:], true, &bytes.Buffer{}); err == nil {
+			t.Error("expected an error but did not get one")
+		}
+	})
+
+	t.Run("query error returns an error", func(t *testing.T) {
+		a := newAlerter(t, fakePreviewFetcher{err: errors.New("quota exceeded")})
+
+		if err := diffMatches(a, alerts[:1], false, &bytes.Buffer{}); err == nil {
+			t.Error("expected an error but did not get one")
+		}
+	})
+}
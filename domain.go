@@ -0,0 +1,90 @@
+package gmailalert
+
+import (
+	"fmt"
+	"net/mail"
+	"sort"
+	"strings"
+)
+
+// maxBreakdownDomains is the number of sender domains listed individually
+// in a domain breakdown, keeping notifications within Pushover's message
+// length limit.
+const maxBreakdownDomains = 5
+
+// domainBreakdown accepts the messages matching an Alert, fetches the
+// details of those whose sender is not known yet, and returns a breakdown of
+// the messages by sender domain, like "12 from amazon.com, 3 from chase.com".
+// An error is returned if the Alerter's Matcher does not implement Fetcher
+// or if there is a problem fetching a message's details.
+func (a Alerter) domainBreakdown(matches []Message) (string, error) {
+	fetcher, ok := a.Matcher.(Fetcher)
+	if !ok {
+		return "", fmt.Errorf("matcher %T must implement Fetcher to group emails by sender domain", a.Matcher)
+	}
+
+	senders := make([]string, 0, len(matches))
+	for _, m := range matches {
+		if m.From == "" {
+			msg, err := fetcher.Fetch(m.ID)
+			if err != nil {
+				return "", err
+			}
+			m = msg
+		}
+		senders = append(senders, m.From)
+	}
+
+	return breakdown(senders), nil
+}
+
+// breakdown returns a breakdown of the given From header values by sender
+// domain, with the domains sending the most emails first. Domains beyond
+// maxBreakdownDomains are summarized together.
+func breakdown(senders []string) string {
+	counts := map[string]int{}
+	for _, from := range senders {
+		counts[senderDomain(from)]++
+	}
+
+	domains := make([]string, 0, len(counts))
+	for d := range counts {
+		domains = append(domains, d)
+	}
+	sort.Slice(domains, func(i, j int) bool {
+		if counts[domains[i]] == counts[domains[j]] {
+			return domains[i] < domains[j]
+		}
+		return counts[domains[i]] > counts[domains[j]]
+	})
+
+	var parts []string
+	for i, d := range domains {
+		if i == maxBreakdownDomains {
+			var rest int
+			for _, d := range domains[i:] {
+				rest += counts[d]
+			}
+			parts = append(parts, fmt.Sprintf("%d from %d other domains", rest, len(domains)-i))
+			break
+		}
+		parts = append(parts, fmt.Sprintf("%d from %s", counts[d], d))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// senderDomain returns the lower-cased domain of the address in the given
+// From header value, or "unknown senders" if it has none.
+func senderDomain(from string) string {
+	addr, err := mail.ParseAddress(from)
+	if err != nil {
+		return "unknown senders"
+	}
+	at := strings.LastIndex(addr.Address, "@")
+	if at < 0 || at == len(addr.Address)-1 {
+		return "unknown senders"
+	}
+
+	return strings.ToLower(addr.Address[at+1:])
+}
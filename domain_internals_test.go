@@ -0,0 +1,41 @@
+package gmailalert
+
+import "testing"
+
+func TestBreakdown(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		senders []string
+		want    string
+	}{
+		"Domains are ordered by count then name": {
+			senders: []string{
+				"Amazon <ship@Amazon.com>",
+				"chase@chase.com",
+				"orders@amazon.com",
+				"bank@ally.com",
+			},
+			want: "2 from amazon.com, 1 from ally.com, 1 from chase.com",
+		},
+		"Unparseable senders are grouped as unknown": {
+			senders: []string{"", "not an address"},
+			want:    "2 from unknown senders",
+		},
+		"Domains beyond the limit are summarized": {
+			senders: []string{
+				"a@a.com", "a@a.com", "b@b.com", "c@c.com", "d@d.com",
+				"e@e.com", "f@f.com", "g@g.com", "g@g.com",
+			},
+			want: "2 from a.com, 2 from g.com, 1 from b.com, 1 from c.com, 1 from d.com, 2 from 2 other domains",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if got := breakdown(tc.senders); tc.want != got {
+				t.Errorf("want %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package gmailalert_test
+
+import (
+	"testing"
+
+	"github.com/aculclasure/gmailalert"
+)
+
+func TestProcessGroupsMatchesByDomain(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		matcher gmailalert.Matcher
+		wantMsg string
+	}{
+		"Fetcher adds a domain breakdown": {
+			matcher: fakeFetcher{
+				fakeMatcher: fakeMatcher{matches: []gmailalert.Message{{ID: "1"}, {ID: "2"}, {ID: "3"}}},
+				msgs: map[string]gmailalert.Message{
+					"1": {ID: "1", From: "orders@amazon.com"},
+					"2": {ID: "2", From: "Amazon <ship@amazon.com>"},
+					"3": {ID: "3", From: "alerts@chase.com"},
+				},
+			},
+			wantMsg: `Found 3 emails matching query "from:orders": 2 from amazon.com, 1 from chase.com`,
+		},
+		"Fetch error sends the notification without a breakdown": {
+			matcher: fakeFetcher{
+				fakeMatcher: fakeMatcher{matches: []gmailalert.Message{{ID: "1"}}},
+			},
+			wantMsg: `Found 1 emails matching query "from:orders"`,
+		},
+		"Non-fetcher sends the notification without a breakdown": {
+			matcher: fakeMatcher{matches: []gmailalert.Message{{ID: "1"}}},
+			wantMsg: `Found 1 emails matching query "from:orders"`,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			recNotif := &recordingNotifier{}
+			alerter := gmailalert.Alerter{
+				Matcher:  tc.matcher,
+				Notifier: recNotif,
+				Logger:   &spyLogger{},
+			}
+			alerts := []gmailalert.Alert{{GmailQuery: "from:orders", GroupByDomain: true}}
+
+			if err := alerter.Process(alerts); err != nil {
+				t.Fatalf("got unexpected error: %v", err)
+			}
+			if len(recNotif.alerts) != 1 {
+				t.Fatalf("wanted 1 notification, got %d", len(recNotif.alerts))
+			}
+			if got := recNotif.alerts[0].PushoverMsg; tc.wantMsg != got {
+				t.Errorf("want message %q, got %q", tc.wantMsg, got)
+			}
+		})
+	}
+}
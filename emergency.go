@@ -0,0 +1,284 @@
+package gmailalert
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gregdel/pushover"
+)
+
+// The defaults and limits Pushover applies to emergency notifications.
+const (
+	defaultEmergencyRetry  = time.Minute
+	minEmergencyRetry      = 30 * time.Second
+	defaultEmergencyExpire = time.Hour
+	maxEmergencyExpire     = 3 * time.Hour
+)
+
+// EmergencyConfig represents the settings of notifications sent with
+// Pushover's emergency priority, which repeat until a recipient acknowledges
+// them or they expire.
+type EmergencyConfig struct {
+	// How often the notification repeats until acknowledged, as a duration
+	// of at least "30s". If empty, "1m" is used.
+	Retry string `json:"retry"`
+	// How long the notification repeats if not acknowledged, as a duration
+	// of at most "3h". If empty, "1h" is used.
+	Expire string `json:"expire"`
+	// How long after the notification was sent it is escalated to the
+	// EscalateTo recipients if not acknowledged yet, as a duration like
+	// "15m". If empty, the notification is not escalated.
+	EscalateAfter string `json:"escalateafter"`
+	// The Pushover user or group keys notified when the notification is
+	// escalated.
+	EscalateTo []string `json:"escalateto"`
+}
+
+// durations returns the retry, expiry, and escalation durations of the
+// EmergencyConfig, with defaults applied. An error is returned if any of them
+// is invalid or out of Pushover's limits, or if only one of EscalateAfter
+// and EscalateTo is set.
+func (c EmergencyConfig) durations() (retry, expire, escalateAfter time.Duration, err error) {
+	retry, expire = defaultEmergencyRetry, defaultEmergencyExpire
+	if c.Retry != "" {
+		retry, err = time.ParseDuration(c.Retry)
+		if err != nil || retry < minEmergencyRetry {
+			return 0, 0, 0, fmt.Errorf("emergency retry must be a duration of at least %s, got %q", minEmergencyRetry, c.Retry)
+		}
+	}
+	if c.Expire != "" {
+		expire, err = time.ParseDuration(c.Expire)
+		if err != nil || expire <= 0 || expire > maxEmergencyExpire {
+			return 0, 0, 0, fmt.Errorf("emergency expire must be a positive duration of at most %s, got %q", maxEmergencyExpire, c.Expire)
+		}
+	}
+	if (c.EscalateAfter == "") != (len(c.EscalateTo) == 0) {
+		return 0, 0, 0, errors.New("emergency escalateafter and escalateto must be set together")
+	}
+	if c.EscalateAfter != "" {
+		escalateAfter, err = time.ParseDuration(c.EscalateAfter)
+		if err != nil || escalateAfter <= 0 {
+			return 0, 0, 0, fmt.Errorf("emergency escalateafter must be a positive duration, got %q", c.EscalateAfter)
+		}
+	}
+
+	return retry, expire, escalateAfter, nil
+}
+
+// ReceiptState represents the acknowledgement status of an emergency
+// notification sent to a single recipient, as recorded in an AlertState.
+type ReceiptState struct {
+	// The receipt the provider assigned to the notification.
+	ID string `json:"id"`
+	// When the notification was sent.
+	Sent time.Time `json:"sent"`
+	// Whether a recipient acknowledged the notification.
+	Acknowledged bool `json:"acknowledged,omitempty"`
+	// The user who acknowledged the notification.
+	AcknowledgedBy string `json:"acknowledgedby,omitempty"`
+	// When the notification was acknowledged.
+	AcknowledgedAt time.Time `json:"acknowledgedat,omitempty"`
+	// Whether the notification stopped repeating without being
+	// acknowledged.
+	Expired bool `json:"expired,omitempty"`
+	// Whether the notification was escalated for not being acknowledged.
+	Escalated bool `json:"escalated,omitempty"`
+}
+
+// pending reports whether the notification of the ReceiptState is still
+// waiting to be acknowledged.
+func (r ReceiptState) pending() bool {
+	return !r.Acknowledged && !r.Expired
+}
+
+// pendingReceipts returns the given ReceiptStates that are still pending.
+func pendingReceipts(receipts []ReceiptState) []ReceiptState {
+	var pending []ReceiptState
+	for _, r := range receipts {
+		if r.pending() {
+			pending = append(pending, r)
+		}
+	}
+
+	return pending
+}
+
+// recordReceipts returns the given AlertState with a pending ReceiptState
+// added for each of the given receipts of an emergency notification sent at
+// the given time. The receipts of earlier notifications that are no longer
+// pending are dropped.
+func recordReceipts(st AlertState, receipts []string, now time.Time) AlertState {
+	if len(receipts) == 0 {
+		return st
+	}
+
+	kept := pendingReceipts(st.Receipts)
+	for _, id := range receipts {
+		kept = append(kept, ReceiptState{ID: id, Sent: now})
+	}
+	st.Receipts = kept
+
+	return st
+}
+
+// ReceiptStatus represents the acknowledgement status of an emergency
+// notification reported by its provider.
+type ReceiptStatus struct {
+	// Whether a recipient acknowledged the notification.
+	Acknowledged bool
+	// The user who acknowledged the notification.
+	AcknowledgedBy string
+	// When the notification was acknowledged.
+	AcknowledgedAt time.Time
+	// Whether the notification stopped repeating without being
+	// acknowledged.
+	Expired bool
+}
+
+// ReceiptChecker is the interface that wraps the CheckReceipt method used by
+// any types implementing notification behavior that can report whether an
+// emergency notification was acknowledged.
+type ReceiptChecker interface {
+	CheckReceipt(receipt string) (ReceiptStatus, error)
+}
+
+// CheckReceipt returns the acknowledgement status of the emergency
+// notification with the given receipt. An error is returned if the status
+// cannot be retrieved from Pushover.
+func (p PushoverClient) CheckReceipt(receipt string) (ReceiptStatus, error) {
+	if receipt == "" {
+		return ReceiptStatus{}, pushover.ErrEmptyReceipt
+	}
+	query := url.Values{"token": {p.token}}
+	endpoint := fmt.Sprintf("%s/receipts/%s.json?%s", pushover.APIEndpoint, url.PathEscape(receipt), query.Encode())
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return ReceiptStatus{}, fmt.Errorf("got error checking pushover receipt: %v", err)
+	}
+
+	var details pushover.ReceiptDetails
+	if _, err := p.do(req, &details); err != nil {
+		return ReceiptStatus{}, fmt.Errorf("got error checking pushover receipt: %v", err)
+	}
+	if details.Status != 1 {
+		return ReceiptStatus{}, fmt.Errorf("pushover rejected receipt %s", receipt)
+	}
+
+	status := ReceiptStatus{
+		Acknowledged:   details.Acknowledged,
+		AcknowledgedBy: details.AcknowledgedBy,
+		Expired:        details.Expired,
+	}
+	if details.AcknowledgedAt != nil {
+		status.AcknowledgedAt = *details.AcknowledgedAt
+	}
+
+	return status, nil
+}
+
+// CheckReceipt returns the acknowledgement status of the emergency
+// notification with the given receipt from the Notifier of the receiver h.
+// An error is returned if the Notifier does not implement ReceiptChecker.
+func (h HashingNotifier) CheckReceipt(receipt string) (ReceiptStatus, error) {
+	rc, ok := h.Notifier.(ReceiptChecker)
+	if !ok {
+		return ReceiptStatus{}, fmt.Errorf("notifier %T does not implement ReceiptChecker", h.Notifier)
+	}
+
+	return rc.CheckReceipt(receipt)
+}
+
+// trackReceipts checks the emergency notifications of the given Alert that
+// are waiting to be acknowledged, records their status in the Alerter's
+// State, escalates those that were not acknowledged within the Alert's
+// escalation deadline, and returns the number still waiting. The changes are
+// committed right away, so that an escalation is not repeated when the
+// evaluation of the Alert fails. Receipts are only tracked if the Alerter has
+// a State and its Notifier implements ReceiptChecker.
+func (a Alerter) trackReceipts(alt Alert) int {
+	if a.State == nil {
+		return 0
+	}
+	st := a.State.Get(alt.key())
+	if len(pendingReceipts(st.Receipts)) == 0 {
+		return 0
+	}
+	checker, ok := a.Notifier.(ReceiptChecker)
+	if !ok {
+		return len(pendingReceipts(st.Receipts))
+	}
+
+	var escalateAfter time.Duration
+	if alt.PushoverEmergency != nil {
+		_, _, escalateAfter, _ = alt.PushoverEmergency.durations()
+	}
+	now := a.now()
+	receipts := make([]ReceiptState, len(st.Receipts))
+	copy(receipts, st.Receipts)
+	escalate := false
+	for i, r := range receipts {
+		if !r.pending() {
+			continue
+		}
+		status, err := checker.CheckReceipt(r.ID)
+		if err != nil {
+			a.errorLog().Printf("got error checking emergency notification receipt: %v", err)
+			continue
+		}
+		r.Acknowledged, r.AcknowledgedBy, r.AcknowledgedAt, r.Expired =
+			status.Acknowledged, status.AcknowledgedBy, status.AcknowledgedAt, status.Expired
+		if r.Acknowledged {
+			a.Logger.Printf("emergency notification of alert %q was acknowledged by %s", alt.key(), r.AcknowledgedBy)
+		}
+		if !r.Acknowledged && !r.Escalated && escalateAfter > 0 && now.Sub(r.Sent) >= escalateAfter {
+			r.Escalated, escalate = true, true
+		}
+		receipts[i] = r
+	}
+
+	if escalate {
+		if err := a.escalate(alt, escalateAfter); err != nil {
+			a.errorLog().Printf("got error escalating emergency notification: %v", err)
+			for i := range receipts {
+				if receipts[i].Escalated && !st.Receipts[i].Escalated {
+					receipts[i].Escalated = false
+				}
+			}
+		}
+	}
+
+	tx := a.State.Begin()
+	st = tx.Get(alt.key())
+	st.Receipts = receipts
+	tx.Set(alt.key(), st)
+	if err := tx.Commit(); err != nil {
+		a.errorLog().Printf("got error committing emergency notification receipts of alert %q: %v", alt.key(), err)
+	}
+
+	return len(pendingReceipts(receipts))
+}
+
+// escalate notifies the escalation recipients of the given Alert that its
+// emergency notification was not acknowledged within the given deadline.
+// The escalation is itself an emergency notification, whose receipts are not
+// tracked.
+func (a Alerter) escalate(alt Alert, after time.Duration) error {
+	to := alt.PushoverEmergency.EscalateTo
+	esc := alt
+	esc.PushoverTarget, esc.PushoverTargets = to[0], to[1:]
+	esc.PushoverMsg = fmt.Sprintf("Emergency notification of alert %q was not acknowledged within %s", alt.key(), after)
+	esc.Attachment = nil
+	emergency := *alt.PushoverEmergency
+	emergency.EscalateAfter, emergency.EscalateTo = "", nil
+	esc.PushoverEmergency = &emergency
+
+	if _, err := a.notify(esc); err != nil {
+		return err
+	}
+	a.Logger.Printf("escalated unacknowledged emergency notification of alert %q to %d recipients", alt.key(), len(to))
+
+	return nil
+}
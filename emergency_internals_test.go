@@ -0,0 +1,216 @@
+package gmailalert
+
+import (
+	"errors"
+	"io"
+	"log"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/gregdel/pushover"
+)
+
+func TestEmergencyConfigDurations(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		input       EmergencyConfig
+		want        []time.Duration
+		errExpected bool
+	}{
+		"Empty config uses the defaults": {
+			input:       EmergencyConfig{},
+			want:        []time.Duration{time.Minute, time.Hour, 0},
+			errExpected: false,
+		},
+		"Escalation returns its deadline": {
+			input:       EmergencyConfig{Retry: "30s", Expire: "3h", EscalateAfter: "15m", EscalateTo: []string{"gQiRzpo4DXghDmr9QzzfQu27cmVRsG"}},
+			want:        []time.Duration{30 * time.Second, 3 * time.Hour, 15 * time.Minute},
+			errExpected: false,
+		},
+		"Retry below 30s returns an error": {
+			input:       EmergencyConfig{Retry: "10s"},
+			errExpected: true,
+		},
+		"Expire above 3h returns an error": {
+			input:       EmergencyConfig{Expire: "4h"},
+			errExpected: true,
+		},
+		"Escalation deadline without recipients returns an error": {
+			input:       EmergencyConfig{EscalateAfter: "15m"},
+			errExpected: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			retry, expire, escalateAfter, err := tc.input.durations()
+			errReceived := err != nil
+
+			if tc.errExpected != errReceived {
+				t.Fatalf("got unexpected error status %t", errReceived)
+			}
+			if tc.errExpected {
+				return
+			}
+			got := []time.Duration{retry, expire, escalateAfter}
+			if !cmp.Equal(tc.want, got) {
+				t.Error(cmp.Diff(tc.want, got))
+			}
+		})
+	}
+}
+
+func TestPrepareNotifyReqSetsEmergencyPriority(t *testing.T) {
+	t.Parallel()
+
+	alt := Alert{
+		GmailQuery:        "is:unread",
+		PushoverTarget:    "uQiRzpo4DXghDmr9QzzfQu27cmVRsG",
+		PushoverTitle:     "test",
+		PushoverSound:     "test",
+		PushoverMsg:       "test",
+		PushoverEmergency: &EmergencyConfig{Retry: "2m"},
+	}
+
+	got, err := prepareNotifyReq(alt, PushoverFormatter{}, pushover.MessageMaxLength)
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+
+	if got.msg.Priority != pushover.PriorityEmergency || got.msg.Retry != 2*time.Minute || got.msg.Expire != time.Hour {
+		t.Errorf("want emergency priority with retry 2m and expire 1h, got %+v", got.msg)
+	}
+}
+
+func TestTrackReceipts(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	alt := Alert{
+		Name:           "server down",
+		PushoverTarget: "uQiRzpo4DXghDmr9QzzfQu27cmVRsG",
+		PushoverEmergency: &EmergencyConfig{
+			EscalateAfter: "15m",
+			EscalateTo:    []string{"gQiRzpo4DXghDmr9QzzfQu27cmVRsG"},
+		},
+	}
+
+	t.Run("acknowledged receipts are recorded and not escalated", func(t *testing.T) {
+		state, err := LoadState(filepath.Join(t.TempDir(), "state.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		state.Set("server down", AlertState{Receipts: []ReceiptState{{ID: "r1", Sent: now.Add(-time.Hour)}}})
+		ackedAt := now.Add(-50 * time.Minute)
+		notifier := &receiptNotifier{statuses: map[string]ReceiptStatus{
+			"r1": {Acknowledged: true, AcknowledgedBy: "u1", AcknowledgedAt: ackedAt},
+		}}
+		a := Alerter{Notifier: notifier, Logger: log.New(io.Discard, "", 0), State: state, Clock: func() time.Time { return now }}
+
+		if got := a.trackReceipts(alt); got != 0 {
+			t.Errorf("want no receipts waiting, got %d", got)
+		}
+
+		want := []ReceiptState{{ID: "r1", Sent: now.Add(-time.Hour), Acknowledged: true, AcknowledgedBy: "u1", AcknowledgedAt: ackedAt}}
+		if !cmp.Equal(want, state.Get("server down").Receipts) {
+			t.Error(cmp.Diff(want, state.Get("server down").Receipts))
+		}
+		if len(notifier.alerts) != 0 {
+			t.Errorf("want no escalation, got %d notifications", len(notifier.alerts))
+		}
+	})
+
+	t.Run("unacknowledged receipts past the deadline are escalated once", func(t *testing.T) {
+		state, err := LoadState(filepath.Join(t.TempDir(), "state.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		state.Set("server down", AlertState{Receipts: []ReceiptState{{ID: "r1", Sent: now.Add(-20 * time.Minute)}}})
+		notifier := &receiptNotifier{statuses: map[string]ReceiptStatus{"r1": {}}}
+		a := Alerter{Notifier: notifier, Logger: log.New(io.Discard, "", 0), State: state, Clock: func() time.Time { return now }}
+
+		if got := a.trackReceipts(alt); got != 1 {
+			t.Errorf("want 1 receipt waiting, got %d", got)
+		}
+		a.trackReceipts(alt)
+
+		if len(notifier.alerts) != 1 {
+			t.Fatalf("want 1 escalation, got %d notifications", len(notifier.alerts))
+		}
+		esc := notifier.alerts[0]
+		if esc.PushoverTarget != "gQiRzpo4DXghDmr9QzzfQu27cmVRsG" || esc.PushoverEmergency.EscalateTo != nil {
+			t.Errorf("want escalation to the escalation recipient without further escalation, got %+v", esc)
+		}
+		if !state.Get("server down").Receipts[0].Escalated {
+			t.Error("want receipt to be recorded as escalated")
+		}
+	})
+
+	t.Run("failed escalation is retried", func(t *testing.T) {
+		state, err := LoadState(filepath.Join(t.TempDir(), "state.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		state.Set("server down", AlertState{Receipts: []ReceiptState{{ID: "r1", Sent: now.Add(-20 * time.Minute)}}})
+		notifier := &receiptNotifier{statuses: map[string]ReceiptStatus{"r1": {}}, err: errors.New("pushover down")}
+		a := Alerter{Notifier: notifier, Logger: log.New(io.Discard, "", 0), State: state, Clock: func() time.Time { return now }}
+
+		a.trackReceipts(alt)
+
+		if state.Get("server down").Receipts[0].Escalated {
+			t.Error("want receipt not to be recorded as escalated")
+		}
+	})
+}
+
+func TestRecordReceiptsDropsResolvedReceipts(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	st := AlertState{Receipts: []ReceiptState{
+		{ID: "r1", Acknowledged: true},
+		{ID: "r2", Expired: true},
+		{ID: "r3"},
+	}}
+
+	got := recordReceipts(st, []string{"r4"}, now).Receipts
+
+	want := []ReceiptState{{ID: "r3"}, {ID: "r4", Sent: now}}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+// receiptNotifier represents a test double type that implements the Notifier
+// and ReceiptChecker interfaces. It records every Alert it is asked to notify
+// on, returns the err value it was created with, and reports the status
+// stored under each receipt in its statuses field.
+type receiptNotifier struct {
+	statuses map[string]ReceiptStatus
+	alerts   []Alert
+	err      error
+	mtx      sync.Mutex
+}
+
+// Notify appends alt to the alerts field of the receiver r and returns the
+// err field of the receiver r.
+func (r *receiptNotifier) Notify(alt Alert) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.alerts = append(r.alerts, alt)
+	return r.err
+}
+
+// CheckReceipt returns the status stored under receipt in the statuses
+// field of the receiver r, or an error if none is stored.
+func (r *receiptNotifier) CheckReceipt(receipt string) (ReceiptStatus, error) {
+	status, ok := r.statuses[receipt]
+	if !ok {
+		return ReceiptStatus{}, errors.New("unknown receipt")
+	}
+	return status, nil
+}
@@ -0,0 +1,55 @@
+package gmailalert
+
+import "strconv"
+
+// EstimatingMatcher is the interface that wraps the MatchEstimate method
+// used by any types implementing email searching behavior that list a
+// single page of the matching emails but can estimate how many emails match
+// in total, like the Gmail API's result size estimate.
+type EstimatingMatcher interface {
+	MatchEstimate(query string, s Signals) ([]Message, int, error)
+}
+
+// matchEstimate accepts a Matcher and an Alert and returns the messages
+// matching the Alert along with the number of emails found, which is the
+// Matcher's estimate of the total when it implements EstimatingMatcher and
+// the estimate exceeds the listed messages. Estimates are only used for
+// alerts with a single query, since the estimates of combined queries cannot
+// be combined.
+func matchEstimate(m Matcher, alt Alert) ([]Message, int, error) {
+	em, ok := m.(EstimatingMatcher)
+	if !ok || alt.Queries != nil {
+		msgs, err := matchAlert(m, alt)
+		return msgs, len(msgs), err
+	}
+
+	msgs, estimate, err := em.MatchEstimate(alt.GmailQuery, alt.signals())
+	if err != nil {
+		return nil, 0, err
+	}
+	if estimate < len(msgs) {
+		estimate = len(msgs)
+	}
+
+	return msgs, estimate, nil
+}
+
+// foundText returns the given number of emails found as written in
+// notification messages, which reads like "about 1,240" if the number is an
+// estimate.
+func foundText(found int, estimated bool) string {
+	if !estimated {
+		return strconv.Itoa(found)
+	}
+
+	digits := strconv.Itoa(found)
+	grouped := make([]byte, 0, len(digits)+len(digits)/3)
+	for i := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			grouped = append(grouped, ',')
+		}
+		grouped = append(grouped, digits[i])
+	}
+
+	return "about " + string(grouped)
+}
@@ -0,0 +1,111 @@
+package gmailalert
+
+import (
+	"io"
+	"log"
+	"strings"
+	"testing"
+)
+
+// estimatingMatcher is a Matcher and EstimatingMatcher listing the
+// configured page of matches along with the configured estimate.
+type estimatingMatcher struct {
+	page     []Message
+	estimate int
+}
+
+func (e estimatingMatcher) Match(query string) ([]string, error) {
+	return messageIDs(e.page), nil
+}
+
+func (e estimatingMatcher) MatchEstimate(query string, s Signals) ([]Message, int, error) {
+	return e.page, e.estimate, nil
+}
+
+func TestAlerterNotifiesEstimatedMatches(t *testing.T) {
+	t.Parallel()
+
+	page := []Message{{ID: "1"}, {ID: "2"}}
+	testCases := map[string]struct {
+		alert         Alert
+		estimate      int
+		wantMessage   string
+		wantEstimated int
+	}{
+		"Estimate beyond the listed page is notified": {
+			alert:         Alert{GmailQuery: "from:bank"},
+			estimate:      1240,
+			wantMessage:   "Found about 1,240 emails",
+			wantEstimated: 1240,
+		},
+		"Estimate below the listed page is ignored": {
+			alert:       Alert{GmailQuery: "from:bank"},
+			estimate:    1,
+			wantMessage: "Found 2 emails",
+		},
+		"Estimate of combined queries is ignored": {
+			alert:       Alert{Queries: &QueryExpr{Or: []QueryExpr{{Query: "from:bank"}, {Query: "from:shop"}}}},
+			estimate:    1240,
+			wantMessage: "Found 2 emails",
+		},
+		"Condition sees the estimate": {
+			alert:         Alert{GmailQuery: "from:bank", Condition: "matches > 1000"},
+			estimate:      1240,
+			wantMessage:   "Found about 1,240 emails",
+			wantEstimated: 1240,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			n := &recordingTestNotifier{}
+			a := Alerter{
+				Matcher:  estimatingMatcher{page: page, estimate: tc.estimate},
+				Notifier: n,
+				Logger:   log.New(io.Discard, "", 0),
+			}
+			alt := tc.alert
+			alt.PushoverTitle, alt.PushoverSound, alt.PushoverTarget = "t", "s", "u"
+
+			res := a.process(alt, nil)
+
+			if res.Err != nil {
+				t.Fatal(res.Err)
+			}
+			if len(n.alerts) != 1 {
+				t.Fatalf("want 1 notification, got %d", len(n.alerts))
+			}
+			if got := n.alerts[0].PushoverMsg; !strings.HasPrefix(got, tc.wantMessage) {
+				t.Errorf("want message starting with %q, got %q", tc.wantMessage, got)
+			}
+			if res.Matches != len(page) || res.Estimated != tc.wantEstimated {
+				t.Errorf("want %d matches and %d estimated, got %d and %d",
+					len(page), tc.wantEstimated, res.Matches, res.Estimated)
+			}
+		})
+	}
+}
+
+func TestFoundText(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		found     int
+		estimated bool
+		want      string
+	}{
+		"Exact count":           {found: 1240, want: "1240"},
+		"Small estimate":        {found: 120, estimated: true, want: "about 120"},
+		"Thousands estimate":    {found: 1240, estimated: true, want: "about 1,240"},
+		"Millions estimate":     {found: 1234567, estimated: true, want: "about 1,234,567"},
+		"Round number estimate": {found: 100000, estimated: true, want: "about 100,000"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if got := foundText(tc.found, tc.estimated); got != tc.want {
+				t.Errorf("want %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
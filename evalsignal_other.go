@@ -0,0 +1,9 @@
+//go:build !unix
+
+package gmailalert
+
+import "os"
+
+// evaluateSignals are the signals requesting every alert to be evaluated
+// immediately in daemon mode. There are none on platforms without SIGUSR1.
+var evaluateSignals []os.Signal
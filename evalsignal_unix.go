@@ -0,0 +1,12 @@
+//go:build unix
+
+package gmailalert
+
+import (
+	"os"
+	"syscall"
+)
+
+// evaluateSignals are the signals requesting every alert to be evaluated
+// immediately in daemon mode.
+var evaluateSignals = []os.Signal{syscall.SIGUSR1}
@@ -0,0 +1,140 @@
+package gmailalert
+
+import (
+	"sync"
+	"time"
+)
+
+// EventType identifies a stage in the evaluation of an alert that an Event
+// is published for.
+type EventType string
+
+const (
+	// EventQueryStarted is published before an alert's Gmail query is run.
+	EventQueryStarted EventType = "query_started"
+	// EventMatchesFound is published when an alert's Gmail query matches
+	// one or more emails.
+	EventMatchesFound EventType = "matches_found"
+	// EventAlertSuppressed is published when the notification of an alert
+	// with matches is suppressed, by its repeat interval or by a Hook.
+	EventAlertSuppressed EventType = "alert_suppressed"
+	// EventNotifySent is published when the notification of an alert is
+	// sent.
+	EventNotifySent EventType = "notify_sent"
+	// EventNotifyFailed is published when the notification of an alert
+	// cannot be sent.
+	EventNotifyFailed EventType = "notify_failed"
+)
+
+// Event represents something that happened during the evaluation of an
+// alert.
+type Event struct {
+	// The kind of event.
+	Type EventType
+	// When the event happened.
+	Time time.Time
+	// The evaluation ID of the alert.
+	EvalID string
+	// The name identifying the alert.
+	Alert string
+	// The free-form labels of the alert.
+	Labels map[string]string
+	// The number of emails matching the alert. It is only set for events
+	// published after the alert's Gmail query was run.
+	Matches int
+	// The error that caused the event. It is only set for EventNotifyFailed.
+	Err error
+}
+
+// EventBus delivers the Events published by an Alerter to the functions
+// subscribed to them. It is safe for concurrent use by multiple goroutines.
+type EventBus struct {
+	mtx    sync.RWMutex
+	nextID int
+	subs   map[int]subscription
+}
+
+// subscription represents a function subscribed to an EventBus and the
+// event types it receives.
+type subscription struct {
+	fn    func(Event)
+	types map[EventType]bool
+}
+
+// NewEventBus returns a new EventBus without subscribers.
+func NewEventBus() *EventBus {
+	return &EventBus{subs: map[int]subscription{}}
+}
+
+// Subscribe registers fn to be called with every published Event of the
+// given types, or with every published Event if no types are given. It
+// returns a function that cancels the subscription. fn is called
+// synchronously by the publishing goroutine, so it must return quickly and
+// be safe to call concurrently.
+func (b *EventBus) Subscribe(fn func(Event), types ...EventType) (unsubscribe func()) {
+	sub := subscription{fn: fn}
+	if len(types) > 0 {
+		sub.types = map[EventType]bool{}
+		for _, t := range types {
+			sub.types[t] = true
+		}
+	}
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	id := b.nextID
+	b.nextID++
+	b.subs[id] = sub
+
+	return func() {
+		b.mtx.Lock()
+		defer b.mtx.Unlock()
+		delete(b.subs, id)
+	}
+}
+
+// Publish delivers the given Event to every function subscribed to its type,
+// setting its Time to the current time if it is zero.
+func (b *EventBus) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.mtx.RLock()
+	subs := make([]subscription, 0, len(b.subs))
+	for _, sub := range b.subs {
+		subs = append(subs, sub)
+	}
+	b.mtx.RUnlock()
+
+	for _, sub := range subs {
+		if sub.types == nil || sub.types[e.Type] {
+			sub.fn(e)
+		}
+	}
+}
+
+// WithAlerterEventBus accepts an EventBus and returns a functional option for
+// wiring the EventBus to an Alerter.
+func WithAlerterEventBus(b *EventBus) AlerterOption {
+	return func(a *Alerter) {
+		a.Events = b
+	}
+}
+
+// publish publishes an Event of the given type for the given Alert on the
+// Alerter's EventBus, if it has one.
+func (a Alerter) publish(typ EventType, alt Alert, matches int, err error) {
+	if a.Events == nil {
+		return
+	}
+
+	a.Events.Publish(Event{
+		Type:    typ,
+		EvalID:  alt.EvalID,
+		Alert:   alt.key(),
+		Labels:  alt.Labels,
+		Matches: matches,
+		Err:     err,
+	})
+}
@@ -0,0 +1,123 @@
+package gmailalert_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/aculclasure/gmailalert"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestEventBus(t *testing.T) {
+	t.Parallel()
+
+	bus := gmailalert.NewEventBus()
+	var all, failed []gmailalert.EventType
+	bus.Subscribe(func(e gmailalert.Event) { all = append(all, e.Type) })
+	unsubscribe := bus.Subscribe(func(e gmailalert.Event) { failed = append(failed, e.Type) }, gmailalert.EventNotifyFailed)
+
+	bus.Publish(gmailalert.Event{Type: gmailalert.EventQueryStarted})
+	bus.Publish(gmailalert.Event{Type: gmailalert.EventNotifyFailed})
+	unsubscribe()
+	bus.Publish(gmailalert.Event{Type: gmailalert.EventNotifyFailed})
+
+	wantAll := []gmailalert.EventType{
+		gmailalert.EventQueryStarted,
+		gmailalert.EventNotifyFailed,
+		gmailalert.EventNotifyFailed,
+	}
+	if !cmp.Equal(wantAll, all) {
+		t.Errorf("want != got for unfiltered subscriber\ndiff=%s", cmp.Diff(wantAll, all))
+	}
+	wantFailed := []gmailalert.EventType{gmailalert.EventNotifyFailed}
+	if !cmp.Equal(wantFailed, failed) {
+		t.Errorf("want != got for filtered subscriber\ndiff=%s", cmp.Diff(wantFailed, failed))
+	}
+}
+
+func TestProcessPublishesEvents(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		matcher  gmailalert.Matcher
+		notifier gmailalert.Notifier
+		hooks    []gmailalert.Hook
+		want     []gmailalert.EventType
+	}{
+		"No matches only publishes the query start": {
+			matcher:  fakeMatcher{},
+			notifier: fakeNotifier{},
+			want:     []gmailalert.EventType{gmailalert.EventQueryStarted},
+		},
+		"Sent notification": {
+			matcher:  fakeMatcher{matches: []gmailalert.Message{{ID: "matching-email1"}}},
+			notifier: fakeNotifier{},
+			want: []gmailalert.EventType{
+				gmailalert.EventQueryStarted,
+				gmailalert.EventMatchesFound,
+				gmailalert.EventNotifySent,
+			},
+		},
+		"Failed notification": {
+			matcher:  fakeMatcher{matches: []gmailalert.Message{{ID: "matching-email1"}}},
+			notifier: fakeNotifier{err: errSendingNotification},
+			want: []gmailalert.EventType{
+				gmailalert.EventQueryStarted,
+				gmailalert.EventMatchesFound,
+				gmailalert.EventNotifyFailed,
+			},
+		},
+		"Suppressed notification": {
+			matcher:  fakeMatcher{matches: []gmailalert.Message{{ID: "matching-email1"}}},
+			notifier: fakeNotifier{},
+			hooks: []gmailalert.Hook{{
+				BeforeNotify: func(alt *gmailalert.Alert) error { return gmailalert.ErrSkipNotification },
+			}},
+			want: []gmailalert.EventType{
+				gmailalert.EventQueryStarted,
+				gmailalert.EventMatchesFound,
+				gmailalert.EventAlertSuppressed,
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var mtx sync.Mutex
+			var got []gmailalert.Event
+			bus := gmailalert.NewEventBus()
+			bus.Subscribe(func(e gmailalert.Event) {
+				mtx.Lock()
+				defer mtx.Unlock()
+				got = append(got, e)
+			})
+			alt := gmailalert.Alerter{
+				Matcher:  tc.matcher,
+				Notifier: tc.notifier,
+				Logger:   &spyLogger{},
+				Hooks:    tc.hooks,
+				Events:   bus,
+			}
+
+			err := alt.Process([]gmailalert.Alert{{Name: "unread", GmailQuery: "is:unread"}})
+			if err != nil {
+				t.Fatalf("got unexpected error: %v", err)
+			}
+
+			var types []gmailalert.EventType
+			for _, e := range got {
+				types = append(types, e.Type)
+				if e.Alert != "unread" || e.EvalID == "" || e.Time.IsZero() {
+					t.Errorf("wanted event to identify the alert evaluation, got %+v", e)
+				}
+				if e.Type == gmailalert.EventNotifyFailed && !errors.Is(e.Err, errSendingNotification) {
+					t.Errorf("wanted notify_failed event to carry the notification error, got %v", e.Err)
+				}
+			}
+			if !cmp.Equal(tc.want, types) {
+				t.Errorf("want != got\ndiff=%s", cmp.Diff(tc.want, types))
+			}
+		})
+	}
+}
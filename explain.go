@@ -0,0 +1,167 @@
+package gmailalert
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Explanation represents the decision trace of the evaluation of an alert,
+// recorded when an Alerter explains its evaluations.
+type Explanation struct {
+	// The emails searched for, like the Gmail query sent.
+	Searched string
+	// The number of emails returned by the search, before any filter.
+	Listed int
+	// The estimated total number of emails matching the search, if more
+	// matched than were returned.
+	Estimated int
+	// The filters applied to the returned emails, in order.
+	Filters []ExplainedFilter
+	// How the threshold of the alert was evaluated.
+	Threshold []string
+	// Where the notification of the alert is routed to.
+	Routing string
+	// Why no notification was sent, if none was sent without an error.
+	Action string
+}
+
+// ExplainedFilter represents a filter applied to the emails matching an
+// alert, as recorded in an Explanation.
+type ExplainedFilter struct {
+	// The filter, like "max age 24h".
+	Name string
+	// The number of emails the filter removed and kept.
+	Removed int
+	Kept    int
+}
+
+// WithAlerterExplain returns a functional option for making an Alerter
+// record an Explanation of the evaluation of every alert in its AlertResult.
+func WithAlerterExplain() AlerterOption {
+	return func(a *Alerter) {
+		a.Explain = true
+	}
+}
+
+// searched records the emails searched for by an alert, along with the
+// number returned and the estimated total, in the Explanation receiver e.
+// It does nothing if e is nil, like the other methods recording a step of
+// an evaluation.
+func (e *Explanation) searched(criteria string, listed, found int) {
+	if e == nil {
+		return
+	}
+	e.Searched, e.Listed = criteria, listed
+	if found > listed {
+		e.Estimated = found
+	}
+}
+
+// filtered records that the filter with the given name kept the given number
+// of the given number of emails.
+func (e *Explanation) filtered(name string, before, kept int) {
+	if e == nil {
+		return
+	}
+	e.Filters = append(e.Filters, ExplainedFilter{Name: name, Removed: before - kept, Kept: kept})
+}
+
+// thresholdf records a step of the evaluation of the threshold of an alert,
+// formatted with the given format and arguments.
+func (e *Explanation) thresholdf(format string, args ...interface{}) {
+	if e == nil {
+		return
+	}
+	e.Threshold = append(e.Threshold, fmt.Sprintf(format, args...))
+}
+
+// route records where the notification of the given Alert is routed to,
+// with its recipients masked.
+func (e *Explanation) route(alt Alert) {
+	if e == nil {
+		return
+	}
+	recipients := make([]string, 0, 1+len(alt.PushoverTargets))
+	for _, r := range append([]string{alt.PushoverTarget}, alt.PushoverTargets...) {
+		recipients = append(recipients, Secret(r).String())
+	}
+	e.Routing = fmt.Sprintf("%s, normal priority", strings.Join(recipients, ", "))
+	if em := alt.PushoverEmergency; em != nil {
+		e.Routing = fmt.Sprintf("%s, emergency priority", strings.Join(recipients, ", "))
+		if len(em.EscalateTo) > 0 {
+			e.Routing += fmt.Sprintf(", escalating to %d recipients after %s", len(em.EscalateTo), em.EscalateAfter)
+		}
+	}
+}
+
+// actf records why no notification was sent, formatted with the given format
+// and arguments.
+func (e *Explanation) actf(format string, args ...interface{}) {
+	if e == nil {
+		return
+	}
+	e.Action = fmt.Sprintf(format, args...)
+}
+
+// explainReporter represents a Reporter writing the Explanation of every
+// alert evaluated in a run to an io.Writer, in a human-readable format.
+type explainReporter struct {
+	w io.Writer
+}
+
+// Report writes the Explanation of every AlertResult of the given Summary.
+// An error is returned if there is a problem writing.
+func (r explainReporter) Report(s Summary) error {
+	for _, res := range s.Results {
+		if _, err := io.WriteString(r.w, explainResult(res)); err != nil {
+			return fmt.Errorf("got error writing explanation of alert %q: %v", res.Alert, err)
+		}
+	}
+
+	return nil
+}
+
+// explainResult returns the decision trace of the given AlertResult, one
+// step per line.
+func explainResult(res AlertResult) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "alert %q (eval %s)\n", res.Alert, res.EvalID)
+	line := func(step, format string, args ...interface{}) {
+		fmt.Fprintf(&b, "  %-10s %s\n", step+":", fmt.Sprintf(format, args...))
+	}
+	if e := res.Explanation; e != nil {
+		if e.Searched != "" {
+			line("searched", "emails %s", e.Searched)
+			if e.Estimated > 0 {
+				line("matched", "%d listed of about %d", e.Listed, e.Estimated)
+			} else {
+				line("matched", "%d", e.Listed)
+			}
+		}
+		for _, f := range e.Filters {
+			line("filtered", "%s removed %d, kept %d", f.Name, f.Removed, f.Kept)
+		}
+		if len(e.Threshold) > 0 {
+			line("threshold", "%s", strings.Join(e.Threshold, "; "))
+		}
+		if e.Routing != "" {
+			line("routing", "%s", e.Routing)
+		}
+	}
+
+	switch {
+	case res.Err != nil:
+		line("action", "failed: %v", res.Err)
+	case res.Notified:
+		line("action", "notified")
+	case res.Unchanged:
+		line("action", "skipped, the mailbox has not changed since its last evaluation found no emails")
+	case res.Explanation != nil && res.Explanation.Action != "":
+		line("action", "%s", res.Explanation.Action)
+	default:
+		line("action", "not notified")
+	}
+
+	return b.String()
+}
@@ -0,0 +1,86 @@
+package gmailalert
+
+import (
+	"io"
+	"log"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAlerterExplainsEvaluations(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	fetcher := fakePreviewFetcher{
+		matches: []Message{{ID: "1"}, {ID: "2"}},
+		msgs: map[string]Message{
+			"1": {ID: "1", Date: now.Add(-time.Hour)},
+			"2": {ID: "2", Date: now.Add(-48 * time.Hour)},
+		},
+	}
+	testCases := map[string]struct {
+		alert Alert
+		want  string
+	}{
+		"Notified alert with max age": {
+			alert: Alert{Name: "bills", GmailQuery: "from:bank", PushoverTarget: "uQiRzpo4DXghDmr9QzzfQu27cmVRsG", MaxAge: "24h"},
+			want: `alert "bills" (eval run.0)
+  searched:  emails matching query "from:bank"
+  matched:   2
+  filtered:  max age 24h removed 1, kept 1
+  threshold: 1 emails, at least 1 needed: met
+  routing:   uQiR****VRsG, normal priority
+  action:    notified
+`,
+		},
+		"Alert whose condition does not hold": {
+			alert: Alert{Name: "bills", GmailQuery: "from:bank", PushoverTarget: "u1", Condition: "matches > 5"},
+			want: `alert "bills" (eval run.0)
+  searched:  emails matching query "from:bank"
+  matched:   2
+  threshold: 2 emails, at least 1 needed: met; condition "matches > 5" does not hold
+  action:    not notified, condition does not hold
+`,
+		},
+		"Alert suppressed by repeat interval": {
+			alert: Alert{Name: "suppressed", GmailQuery: "from:bank", PushoverTarget: "u1", RepeatInterval: "24h"},
+			want: `alert "suppressed" (eval run.0)
+  searched:  emails matching query "from:bank"
+  matched:   2
+  threshold: 2 emails, at least 1 needed: met
+  routing:   ****, normal priority
+  action:    suppressed by repeat interval "24h"
+`,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			state, err := LoadState(filepath.Join(t.TempDir(), "state.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			state.Set("suppressed", AlertState{Notified: now.Add(-time.Hour), MessageIDs: []string{"1", "2"}})
+			a, err := NewAlerter(
+				fetcher,
+				&recordingTestNotifier{},
+				WithAlerterLogger(log.New(io.Discard, "", 0)),
+				WithAlerterClock(func() time.Time { return now }),
+				WithAlerterState(state),
+				WithAlerterExplain(),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tc.alert.EvalID = "run.0"
+
+			got := explainResult(a.process(tc.alert, nil))
+			if !cmp.Equal(tc.want, got) {
+				t.Errorf("want != got\ndiff=%s", cmp.Diff(tc.want, got))
+			}
+		})
+	}
+}
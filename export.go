@@ -0,0 +1,195 @@
+package gmailalert
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// defaultExportNameTemplate is the template used for naming exported email
+// files if none is given.
+const defaultExportNameTemplate = `{{.Date.Format "20060102T150405"}}-{{.ID}}`
+
+// exportOptions represents the settings for exporting matching emails into
+// files.
+type exportOptions struct {
+	// The directory to write the files into.
+	dir string
+	// The file format, either "eml" or "json".
+	format string
+	// The text/template used for naming each file, executed with the
+	// Message being exported. The format's extension is appended to it.
+	nameTemplate string
+	// What to do when a file already exists: "skip", "overwrite", or
+	// "error".
+	overwrite string
+}
+
+// exportedMessage represents an email exported in JSON format.
+type exportedMessage struct {
+	Message
+	// The raw, RFC 2822 formatted email.
+	Raw string
+}
+
+// exportFetcher is the interface that groups the methods needed to export
+// the emails matching an alert.
+type exportFetcher interface {
+	Matcher
+	Fetcher
+	RawFetcher
+}
+
+// exportCLI accepts the command line flags of the "export" subcommand, which
+// runs the Gmail query of the alert named by the "-alert" flag and writes
+// every matching email as a file into the directory given by the "-dir"
+// flag. An error is returned if the flags are invalid, the alert
+// configuration cannot be loaded, or the export fails.
+func exportCLI(args []string) error {
+	var app cliEnv
+	var alertName string
+	var opts exportOptions
+
+	fs := app.flagSet("export")
+	fs.StringVar(
+		&alertName,
+		"alert",
+		"",
+		"the name (or gmail query) of the alert to export matching emails for")
+	fs.StringVar(
+		&opts.dir,
+		"dir",
+		".",
+		"the directory to write the exported emails into")
+	fs.StringVar(
+		&opts.format,
+		"format",
+		"eml",
+		`the format of the exported emails, either "eml" or "json"`)
+	fs.StringVar(
+		&opts.nameTemplate,
+		"name-template",
+		defaultExportNameTemplate,
+		"the go template for naming each exported email file, executed with the email's ID, ThreadID, Date, From, and Subject")
+	fs.StringVar(
+		&opts.overwrite,
+		"overwrite",
+		"skip",
+		`what to do when an exported email file already exists, one of "skip", "overwrite", or "error"`)
+	if err := app.parse(fs, args); err != nil {
+		return err
+	}
+	if alertName == "" {
+		fs.Usage()
+		return errors.New(`command line flag "-alert" must be non-empty`)
+	}
+
+	app, alertCfg, err := app.profileConfig()
+	if err != nil {
+		return err
+	}
+	selected, err := selectAlerts(alertCfg.Alerts, alertName)
+	if err != nil {
+		return err
+	}
+
+	gmailClient, err := app.gmailClient(app.debugLogger(), alertCfg)
+	if err != nil {
+		return err
+	}
+
+	return exportMatches(gmailClient, selected[0], opts, os.Stdout)
+}
+
+// exportMatches accepts an exportFetcher, an Alert, exportOptions, and an
+// io.Writer, runs the Alert's Gmail query, and writes each matching email
+// into a file according to the exportOptions, reporting the outcome for
+// each email to the io.Writer. An error is returned if the exportOptions are
+// invalid, the Alert has no Gmail query, like when it watches a label, the
+// query fails, or any email cannot be fetched or written.
+func exportMatches(ef exportFetcher, alt Alert, opts exportOptions, w io.Writer) error {
+	if alt.GmailQuery == "" {
+		return fmt.Errorf("alert %q has no gmail query to export", alt.key())
+	}
+	if opts.format != "eml" && opts.format != "json" {
+		return fmt.Errorf(`export format must be "eml" or "json", got %q`, opts.format)
+	}
+	if opts.overwrite != "skip" && opts.overwrite != "overwrite" && opts.overwrite != "error" {
+		return fmt.Errorf(`export overwrite policy must be "skip", "overwrite", or "error", got %q`, opts.overwrite)
+	}
+	tmpl, err := template.New("name").Parse(opts.nameTemplate)
+	if err != nil {
+		return fmt.Errorf("got error parsing export name template: %v", err)
+	}
+	if err := os.MkdirAll(opts.dir, 0700); err != nil {
+		return fmt.Errorf("got error creating export directory %s: %v", opts.dir, err)
+	}
+
+	matches, err := matchAlert(ef, alt)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range matches {
+		msg, err := ef.Fetch(m.ID)
+		if err != nil {
+			return err
+		}
+
+		var name strings.Builder
+		if err := tmpl.Execute(&name, msg); err != nil {
+			return fmt.Errorf("got error executing export name template for message %s: %v", m.ID, err)
+		}
+		file := filepath.Join(opts.dir, sanitizeFileName(name.String())+"."+opts.format)
+
+		_, err = os.Stat(file)
+		exists := err == nil
+		if exists && opts.overwrite == "skip" {
+			fmt.Fprintf(w, "SKIP %s\n", file)
+			continue
+		}
+		if exists && opts.overwrite == "error" {
+			return fmt.Errorf("export file %s already exists", file)
+		}
+
+		raw, err := ef.FetchRaw(m.ID)
+		if err != nil {
+			return err
+		}
+		data := raw
+		if opts.format == "json" {
+			data, err = json.MarshalIndent(exportedMessage{Message: msg, Raw: string(raw)}, "", "  ")
+			if err != nil {
+				return fmt.Errorf("got error json-encoding message %s: %v", m.ID, err)
+			}
+		}
+
+		if err := os.WriteFile(file, data, 0600); err != nil {
+			return fmt.Errorf("got error writing export file %s: %v", file, err)
+		}
+		fmt.Fprintf(w, "OK   %s\n", file)
+	}
+
+	return nil
+}
+
+// sanitizeFileName replaces any characters in the given name that are not
+// safe to use in a file name on common operating systems with underscores.
+func sanitizeFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if name == "" || name == "." || name == ".." {
+		return "_"
+	}
+
+	return name
+}
@@ -0,0 +1,144 @@
+package gmailalert
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExportMatches(t *testing.T) {
+	t.Parallel()
+
+	date := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	ef := fakeExportFetcher{
+		fakePreviewFetcher: fakePreviewFetcher{
+			matches: []Message{{ID: "a"}},
+			msgs:    map[string]Message{"a": {ID: "a", Date: date, Subject: "Your bill"}},
+		},
+		raw: map[string][]byte{"a": []byte("Subject: Your bill\r\n\r\nPay up.\r\n")},
+	}
+	alt := Alert{GmailQuery: "is:unread"}
+
+	t.Run("eml format writes the raw email", func(t *testing.T) {
+		dir := t.TempDir()
+		opts := exportOptions{dir: dir, format: "eml", nameTemplate: defaultExportNameTemplate, overwrite: "skip"}
+
+		if err := exportMatches(ef, alt, opts, &bytes.Buffer{}); err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		got, err := os.ReadFile(filepath.Join(dir, "20230301T120000-a.eml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(ef.raw["a"], got) {
+			t.Errorf("want %q, got %q", ef.raw["a"], got)
+		}
+	})
+
+	t.Run("json format writes the email metadata and raw email", func(t *testing.T) {
+		dir := t.TempDir()
+		opts := exportOptions{dir: dir, format: "json", nameTemplate: "{{.Subject}}", overwrite: "skip"}
+
+		if err := exportMatches(ef, alt, opts, &bytes.Buffer{}); err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, "Your bill.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got exportedMessage
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.ID != "a" || got.Subject != "Your bill" || got.Raw != string(ef.raw["a"]) {
+			t.Errorf("got unexpected exported message %+v", got)
+		}
+	})
+
+	t.Run("overwrite policies are applied to existing files", func(t *testing.T) {
+		dir := t.TempDir()
+		file := filepath.Join(dir, "a.eml")
+		if err := os.WriteFile(file, []byte("existing"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		opts := exportOptions{dir: dir, format: "eml", nameTemplate: "{{.ID}}"}
+
+		opts.overwrite = "skip"
+		if err := exportMatches(ef, alt, opts, &bytes.Buffer{}); err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+		if got, _ := os.ReadFile(file); string(got) != "existing" {
+			t.Errorf("want skipped file to be unchanged, got %q", got)
+		}
+
+		opts.overwrite = "error"
+		if err := exportMatches(ef, alt, opts, &bytes.Buffer{}); err == nil {
+			t.Error("wanted an error but did not get one")
+		}
+
+		opts.overwrite = "overwrite"
+		if err := exportMatches(ef, alt, opts, &bytes.Buffer{}); err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+		if got, _ := os.ReadFile(file); !bytes.Equal(ef.raw["a"], got) {
+			t.Errorf("want overwritten file to hold the raw email, got %q", got)
+		}
+	})
+
+	t.Run("invalid options return an error", func(t *testing.T) {
+		for _, opts := range []exportOptions{
+			{dir: t.TempDir(), format: "pdf", nameTemplate: "{{.ID}}", overwrite: "skip"},
+			{dir: t.TempDir(), format: "eml", nameTemplate: "{{.ID}}", overwrite: "sometimes"},
+			{dir: t.TempDir(), format: "eml", nameTemplate: "{{.ID", overwrite: "skip"},
+		} {
+			if err := exportMatches(ef, alt, opts, &bytes.Buffer{}); err == nil {
+				t.Errorf("wanted an error for options %+v but did not get one", opts)
+			}
+		}
+	})
+}
+
+func TestSanitizeFileName(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		input string
+		want  string
+	}{
+		"Safe name is unchanged":           {input: "20230301-a", want: "20230301-a"},
+		"Path separators are replaced":     {input: "../etc/passwd", want: ".._etc_passwd"},
+		"Reserved characters are replaced": {input: `Re: "bill"?`, want: "Re_ _bill__"},
+		"Empty name is replaced":           {input: "", want: "_"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if got := sanitizeFileName(tc.input); tc.want != got {
+				t.Errorf("want %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+// fakeExportFetcher represents a test double type that implements the
+// Matcher, Fetcher, and RawFetcher interfaces.
+type fakeExportFetcher struct {
+	fakePreviewFetcher
+	raw map[string][]byte
+}
+
+// FetchRaw returns the raw message stored under id in the raw field of the
+// receiver f, or an error if no raw message is stored under id.
+func (f fakeExportFetcher) FetchRaw(id string) ([]byte, error) {
+	b, ok := f.raw[id]
+	if !ok {
+		return nil, errors.New("message not found")
+	}
+	return b, nil
+}
@@ -0,0 +1,476 @@
+package gmailalert
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// The channels a notification can fail over to.
+const (
+	ChannelPushover = "pushover"
+	ChannelEmail    = "email"
+	ChannelWebhook  = "webhook"
+)
+
+// defaultFailoverTimeout is how long a failover step may take before the
+// next one is tried, if the step does not set its own timeout.
+const defaultFailoverTimeout = 30 * time.Second
+
+// FailoverStep represents one channel in the ordered list of channels an
+// alert's notification is sent with, where each is only tried if the ones
+// before it failed.
+type FailoverStep struct {
+	// The channel the notification is sent with, either "pushover",
+	// "email", or "webhook".
+	Channel string `json:"channel"`
+	// Where the notification is sent: comma-separated email addresses for
+	// "email", the URL to post the notification to for "webhook", and
+	// comma-separated Pushover keys replacing the alert's recipients for
+	// "pushover", where it is optional.
+	To string `json:"to"`
+	// How long the step may take before the next one is tried, as a
+	// duration like "10s". Defaults to 30s.
+	Timeout string `json:"timeout"`
+}
+
+// ok returns an error if the FailoverStep has an unknown channel, an invalid
+// timeout, or no valid destination for an email or webhook channel.
+func (s FailoverStep) ok() error {
+	switch s.Channel {
+	case ChannelPushover:
+	case ChannelEmail:
+		if strings.TrimSpace(s.To) == "" {
+			return errors.New("email failover step must have an email address to send to")
+		}
+	case ChannelWebhook:
+		u, err := url.Parse(s.To)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("webhook failover step must have an http or https url to post to, got %q", s.To)
+		}
+	default:
+		return fmt.Errorf("failover channel must be %q, %q, or %q, got %q", ChannelPushover, ChannelEmail, ChannelWebhook, s.Channel)
+	}
+	if _, err := s.timeout(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// timeout returns how long the FailoverStep may take. An error is returned
+// if its timeout is invalid.
+func (s FailoverStep) timeout() (time.Duration, error) {
+	return parsePositiveDuration("failover timeout", s.Timeout, defaultFailoverTimeout)
+}
+
+// failoverOK returns an error if any failover step of the Alert is invalid.
+func (a Alert) failoverOK() error {
+	for i, step := range a.Failover {
+		if err := step.ok(); err != nil {
+			return fmt.Errorf("got error in failover step %d: %v", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+// ChannelNotifier is the interface that wraps the NotifyTo method used by
+// any types implementing notification behavior for a failover channel.
+// NotifyTo sends the notification of the given Alert to the given
+// destination, like an email address or a URL, and stops sending it when
+// the given context is done.
+type ChannelNotifier interface {
+	NotifyTo(ctx context.Context, alt Alert, to string) error
+}
+
+// ContextNotifier is the interface that wraps the NotifyContext method used
+// by any types implementing notification behavior that can be canceled.
+// NotifyContext behaves like NotifyResult, and stops sending the
+// notification when the given context is done.
+type ContextNotifier interface {
+	NotifyContext(ctx context.Context, a Alert) (NotifyResult, error)
+}
+
+// ChannelError represents a failure to send a notification with a single
+// failover channel.
+type ChannelError struct {
+	// The channel that failed.
+	Channel string
+	// The error returned by the channel.
+	Err error
+}
+
+// Error returns a description of the ChannelError.
+func (c ChannelError) Error() string {
+	return fmt.Sprintf("channel %s: %v", c.Channel, c.Err)
+}
+
+// Unwrap returns the error returned by the channel.
+func (c ChannelError) Unwrap() error {
+	return c.Err
+}
+
+// FailoverNotifier is a Notifier that sends the notification of an alert
+// with its failover steps in order, trying the next step only if the
+// previous one failed or timed out, unlike the recipients of an alert,
+// which are all notified at once. Alerts without failover steps are notified
+// with the wrapped Notifier alone.
+type FailoverNotifier struct {
+	// The Notifier used for alerts without failover steps and for the
+	// "pushover" steps of the others.
+	Notifier Notifier
+	// The ChannelNotifiers of the other channels, by channel name.
+	Channels map[string]ChannelNotifier
+	// The Logger the failures of steps are written to.
+	Logger Logger
+}
+
+// Notify sends the notification of the given Alert as described for
+// NotifyResult.
+func (f FailoverNotifier) Notify(alt Alert) error {
+	_, err := f.NotifyResult(alt)
+	return err
+}
+
+// NotifyResult sends the notification of the given Alert with each of its
+// failover steps in order until one succeeds, and returns a NotifyResult
+// whose Channel is the channel that delivered it. A step taking longer
+// than its timeout is canceled and treated as failed. If every step fails,
+// an error wrapping a ChannelError for each of them is returned.
+func (f FailoverNotifier) NotifyResult(alt Alert) (NotifyResult, error) {
+	if len(alt.Failover) == 0 {
+		return f.send(context.Background(), FailoverStep{Channel: ChannelPushover}, alt)
+	}
+
+	var errs []error
+	for i, step := range alt.Failover {
+		res, err := f.try(step, alt)
+		if err == nil {
+			return res, nil
+		}
+		errs = append(errs, ChannelError{Channel: step.Channel, Err: err})
+		if i < len(alt.Failover)-1 {
+			f.Logger.Printf("[eval %s] got error sending notification via %s, failing over to %s: %v",
+				alt.EvalID, step.Channel, alt.Failover[i+1].Channel, err)
+		}
+	}
+
+	return NotifyResult{}, fmt.Errorf("notification failed on all %d failover channels: %w", len(errs), errors.Join(errs...))
+}
+
+// try sends the notification of the given Alert with the given
+// FailoverStep, canceling the send and returning an error if it does not
+// finish within the step's timeout.
+func (f FailoverNotifier) try(step FailoverStep, alt Alert) (NotifyResult, error) {
+	timeout, err := step.timeout()
+	if err != nil {
+		return NotifyResult{}, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	type outcome struct {
+		res NotifyResult
+		err error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		res, err := f.send(ctx, step, alt)
+		done <- outcome{res: res, err: err}
+	}()
+	select {
+	case o := <-done:
+		return o.res, o.err
+	case <-ctx.Done():
+		return NotifyResult{}, fmt.Errorf("timed out after %s", timeout)
+	}
+}
+
+// send sends the notification of the given Alert with the given
+// FailoverStep, stopping when the given context is done, and returns a
+// NotifyResult with the step's channel. A "pushover" step can only be
+// stopped if the wrapped Notifier implements ContextNotifier. An error is
+// returned if the channel has no Notifier or the notification fails.
+func (f FailoverNotifier) send(ctx context.Context, step FailoverStep, alt Alert) (NotifyResult, error) {
+	if step.Channel == ChannelPushover {
+		if step.To != "" {
+			alt.PushoverTarget, alt.PushoverTargets = "", splitList(step.To)
+		}
+		var res NotifyResult
+		var err error
+		switch n := f.Notifier.(type) {
+		case ContextNotifier:
+			res, err = n.NotifyContext(ctx, alt)
+		case ResultNotifier:
+			res, err = n.NotifyResult(alt)
+		default:
+			err = n.Notify(alt)
+		}
+		res.Channel = ChannelPushover
+		return res, err
+	}
+
+	n, ok := f.Channels[step.Channel]
+	if !ok {
+		return NotifyResult{}, fmt.Errorf("no notifier configured for channel %s", step.Channel)
+	}
+
+	return NotifyResult{Channel: step.Channel}, n.NotifyTo(ctx, alt, step.To)
+}
+
+// CheckReceipt returns the acknowledgement status of the emergency
+// notification with the given receipt from the Notifier of the receiver f.
+// An error is returned if the Notifier does not implement ReceiptChecker.
+func (f FailoverNotifier) CheckReceipt(receipt string) (ReceiptStatus, error) {
+	rc, ok := f.Notifier.(ReceiptChecker)
+	if !ok {
+		return ReceiptStatus{}, fmt.Errorf("notifier %T does not implement ReceiptChecker", f.Notifier)
+	}
+
+	return rc.CheckReceipt(receipt)
+}
+
+// splitList returns the non-empty, space-trimmed elements of the given
+// comma-separated list.
+func splitList(s string) []string {
+	var list []string
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			list = append(list, e)
+		}
+	}
+
+	return list
+}
+
+// EmailConfig represents the configuration of the SMTP server notifications
+// are sent through by "email" failover steps.
+type EmailConfig struct {
+	// The address of the SMTP server, like "smtp.example.com:587".
+	Addr string `json:"addr"`
+	// The optional user name and password to authenticate with. The
+	// password is masked when printed.
+	Username string `json:"username"`
+	Password Secret `json:"password"`
+	// The address the emails are sent from.
+	From string `json:"from"`
+}
+
+// EmailNotifier is a ChannelNotifier sending notifications as plain-text
+// emails through an SMTP server.
+type EmailNotifier struct {
+	cfg  EmailConfig
+	send func(ctx context.Context, addr string, auth smtp.Auth, from string, to []string, msg []byte) error
+	now  func() time.Time
+}
+
+// NewEmailNotifier accepts an EmailConfig and returns a new EmailNotifier.
+// An error is returned if the server address or the sender is empty.
+func NewEmailNotifier(cfg EmailConfig) (EmailNotifier, error) {
+	if cfg.Addr == "" || cfg.From == "" {
+		return EmailNotifier{}, fmt.Errorf("email addr and from must be non-empty, got addr %q and from %q", cfg.Addr, cfg.From)
+	}
+
+	return EmailNotifier{cfg: cfg, send: sendMail, now: time.Now}, nil
+}
+
+// NotifyTo sends the title and message of the given Alert's notification as
+// an email to the given comma-separated addresses, closing the connection to
+// the SMTP server when the given context is done. An error is returned if
+// there are no addresses or the SMTP server rejects the email.
+func (e EmailNotifier) NotifyTo(ctx context.Context, alt Alert, to string) error {
+	rcpts := splitList(to)
+	if len(rcpts) == 0 {
+		return errors.New("email notification must have at least one address to send to")
+	}
+	var auth smtp.Auth
+	if e.cfg.Username != "" {
+		host, _, _ := strings.Cut(e.cfg.Addr, ":")
+		auth = smtp.PlainAuth("", e.cfg.Username, string(e.cfg.Password), host)
+	}
+	if err := e.send(ctx, e.cfg.Addr, auth, e.cfg.From, rcpts, e.message(alt, rcpts)); err != nil {
+		return fmt.Errorf("got error sending email notification: %v", err)
+	}
+
+	return nil
+}
+
+// message returns the email sent to the given recipients for the given
+// Alert's notification.
+func (e EmailNotifier) message(alt Alert, rcpts []string) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", e.cfg.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(rcpts, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", alt.PushoverTitle))
+	fmt.Fprintf(&b, "Date: %s\r\n", e.now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(alt.PushoverMsg, "\n", "\r\n"))
+	b.WriteString("\r\n")
+
+	return b.Bytes()
+}
+
+// sendMail behaves like smtp.SendMail, and additionally closes the
+// connection to the SMTP server when the given context is done, so that the
+// email is abandoned before the server accepts it.
+func sendMail(ctx context.Context, addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-stop:
+		}
+	}()
+
+	host, _, _ := net.SplitHostPort(addr)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("smtp server does not support authentication")
+		}
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+// webhookNotification represents the JSON body posted by a "webhook"
+// failover step.
+type webhookNotification struct {
+	Alert   string `json:"alert"`
+	EvalID  string `json:"evalid"`
+	Title   string `json:"title"`
+	Message string `json:"message"`
+	Matches int    `json:"matches"`
+}
+
+// WebhookNotifier is a ChannelNotifier posting notifications as JSON to a
+// URL.
+type WebhookNotifier struct {
+	client *http.Client
+}
+
+// NewWebhookNotifier accepts an *http.Client and returns a new
+// WebhookNotifier posting notifications with it.
+func NewWebhookNotifier(client *http.Client) WebhookNotifier {
+	return WebhookNotifier{client: client}
+}
+
+// NotifyTo posts the name, evaluation ID, title, message, and number of
+// matches of the given Alert's notification as JSON to the given URL. An
+// error is returned if the request fails or the response status is not
+// 2xx. The request is canceled when the given context is done.
+func (w WebhookNotifier) NotifyTo(ctx context.Context, alt Alert, to string) error {
+	body, err := json.Marshal(webhookNotification{
+		Alert:   alt.key(),
+		EvalID:  alt.EvalID,
+		Title:   alt.PushoverTitle,
+		Message: alt.PushoverMsg,
+		Matches: alt.Matches,
+	})
+	if err != nil {
+		return fmt.Errorf("got error json-encoding webhook notification: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, to, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("got error creating webhook notification request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("got error posting webhook notification: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("got unexpected webhook notification response status %s", resp.Status)
+	}
+
+	return nil
+}
+
+// failoverNotifier returns the given Notifier wrapped in a FailoverNotifier
+// if any alert of the AlertConfig receiver c has failover steps, with an
+// EmailNotifier for the SMTP server of c and a WebhookNotifier, or the given
+// Notifier otherwise. An error is returned if an alert has an "email" step
+// but c has no valid email configuration.
+func (c AlertConfig) failoverNotifier(n Notifier, logger Logger) (Notifier, error) {
+	var email bool
+	var failover bool
+	for _, alt := range c.Alerts {
+		for _, step := range alt.Failover {
+			failover = true
+			email = email || step.Channel == ChannelEmail
+		}
+	}
+	if !failover {
+		return n, nil
+	}
+
+	channels := map[string]ChannelNotifier{
+		ChannelWebhook: NewWebhookNotifier(&http.Client{Timeout: defaultFailoverTimeout}),
+	}
+	if c.Email != nil {
+		en, err := NewEmailNotifier(*c.Email)
+		if err != nil {
+			return nil, err
+		}
+		channels[ChannelEmail] = en
+	} else if email {
+		return nil, errors.New(`alerts with "email" failover steps require an "email" configuration`)
+	}
+
+	return FailoverNotifier{Notifier: n, Channels: channels, Logger: logger}, nil
+}
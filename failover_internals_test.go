@@ -0,0 +1,403 @@
+package gmailalert
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// channelTestNotifier represents a Notifier and ChannelNotifier recording
+// where it is asked to send notifications, failing with its err field after
+// its delay field, and closing its canceled field, if not nil, when a send
+// is canceled before the delay.
+type channelTestNotifier struct {
+	err      error
+	delay    time.Duration
+	sent     []string
+	canceled chan struct{}
+	mtx      sync.Mutex
+}
+
+// Notify records the recipients of the given Alert and returns the err
+// field of the receiver c after its delay.
+func (c *channelTestNotifier) Notify(alt Alert) error {
+	return c.NotifyTo(context.Background(), alt, strings.Join(alt.Recipients(), ","))
+}
+
+// NotifyContext records the recipients of the given Alert and returns the
+// err field of the receiver c after its delay, or the error of the given
+// context if it is done first.
+func (c *channelTestNotifier) NotifyContext(ctx context.Context, alt Alert) (NotifyResult, error) {
+	return NotifyResult{}, c.NotifyTo(ctx, alt, strings.Join(alt.Recipients(), ","))
+}
+
+// NotifyTo records the given destination and returns the err field of the
+// receiver c after its delay, or the error of the given context if it is
+// done first.
+func (c *channelTestNotifier) NotifyTo(ctx context.Context, _ Alert, to string) error {
+	timer := time.NewTimer(c.delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		if c.canceled != nil {
+			close(c.canceled)
+		}
+		return ctx.Err()
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.sent = append(c.sent, to)
+
+	return c.err
+}
+
+func TestFailoverNotifierNotifyResult(t *testing.T) {
+	t.Parallel()
+
+	failed := errors.New("unreachable")
+	steps := []FailoverStep{
+		{Channel: ChannelPushover, Timeout: "50ms"},
+		{Channel: ChannelEmail, To: "me@example.com"},
+		{Channel: ChannelWebhook, To: "https://example.com/hook"},
+	}
+	testCases := map[string]struct {
+		pushoverErr, emailErr, webhookErr error
+		pushoverDelay                     time.Duration
+		failover                          []FailoverStep
+		want                              string
+		wantSent                          [3][]string
+		errExpected                       bool
+	}{
+		"Alert without failover steps is sent with pushover": {
+			want:     ChannelPushover,
+			wantSent: [3][]string{{"user"}},
+		},
+		"First channel delivers": {
+			failover: steps,
+			want:     ChannelPushover,
+			wantSent: [3][]string{{"user"}},
+		},
+		"Failed channel fails over to the next": {
+			pushoverErr: failed,
+			failover:    steps,
+			want:        ChannelEmail,
+			wantSent:    [3][]string{{"user"}, {"me@example.com"}},
+		},
+		"Timed out channel fails over to the next": {
+			pushoverDelay: time.Second,
+			emailErr:      failed,
+			failover:      steps,
+			want:          ChannelWebhook,
+			wantSent:      [3][]string{nil, {"me@example.com"}, {"https://example.com/hook"}},
+		},
+		"Pushover step replaces the recipients": {
+			failover: []FailoverStep{{Channel: ChannelPushover, To: "oncall, backup"}},
+			want:     ChannelPushover,
+			wantSent: [3][]string{{"oncall,backup"}},
+		},
+		"Every channel failing returns an error": {
+			pushoverErr: failed,
+			emailErr:    failed,
+			webhookErr:  failed,
+			failover:    steps,
+			wantSent:    [3][]string{{"user"}, {"me@example.com"}, {"https://example.com/hook"}},
+			errExpected: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			pushover := &channelTestNotifier{err: tc.pushoverErr, delay: tc.pushoverDelay, canceled: make(chan struct{})}
+			email := &channelTestNotifier{err: tc.emailErr}
+			webhook := &channelTestNotifier{err: tc.webhookErr}
+			f := FailoverNotifier{
+				Notifier: pushover,
+				Channels: map[string]ChannelNotifier{ChannelEmail: email, ChannelWebhook: webhook},
+				Logger:   log.New(io.Discard, "", 0),
+			}
+			res, err := f.NotifyResult(Alert{PushoverTarget: "user", Failover: tc.failover})
+			errReceived := err != nil
+
+			if tc.errExpected != errReceived {
+				t.Fatalf("NotifyResult returned unexpected error status: %v", err)
+			}
+			if tc.errExpected {
+				var ce ChannelError
+				if !errors.As(err, &ce) || !errors.Is(err, failed) {
+					t.Errorf("want error wrapping a ChannelError, got %v", err)
+				}
+			}
+			if tc.want != res.Channel {
+				t.Errorf("want delivering channel %q, got %q", tc.want, res.Channel)
+			}
+			pushover.mtx.Lock()
+			gotSent := [3][]string{pushover.sent, email.sent, webhook.sent}
+			pushover.mtx.Unlock()
+			if !cmp.Equal(tc.wantSent, gotSent) {
+				t.Errorf("want != got\ndiff=%s", cmp.Diff(tc.wantSent, gotSent))
+			}
+			if tc.pushoverDelay > 0 {
+				select {
+				case <-pushover.canceled:
+				case <-time.After(time.Second):
+					t.Error("want timed out send canceled, but it was not")
+				}
+			}
+		})
+	}
+}
+
+func TestFailoverNotifierCheckReceipt(t *testing.T) {
+	t.Parallel()
+
+	want := ReceiptStatus{Acknowledged: true, AcknowledgedBy: "user"}
+	f := FailoverNotifier{Notifier: &receiptNotifier{statuses: map[string]ReceiptStatus{"r1": want}}}
+	got, err := f.CheckReceipt("r1")
+	if err != nil {
+		t.Fatalf("want receipt checked by the wrapped notifier, got error: %v", err)
+	}
+	if !cmp.Equal(want, got) {
+		t.Errorf("want != got\ndiff=%s", cmp.Diff(want, got))
+	}
+
+	f = FailoverNotifier{Notifier: &channelTestNotifier{}}
+	if _, err := f.CheckReceipt("r1"); err == nil {
+		t.Error("want error for a notifier without receipts, got nil")
+	}
+}
+
+func TestAlertFailoverOK(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		failover    []FailoverStep
+		errExpected bool
+	}{
+		"Valid steps": {
+			failover: []FailoverStep{
+				{Channel: ChannelPushover},
+				{Channel: ChannelEmail, To: "me@example.com", Timeout: "10s"},
+				{Channel: ChannelWebhook, To: "https://example.com/hook"},
+			},
+		},
+		"Unknown channel": {
+			failover:    []FailoverStep{{Channel: "sms"}},
+			errExpected: true,
+		},
+		"Email step without address": {
+			failover:    []FailoverStep{{Channel: ChannelEmail}},
+			errExpected: true,
+		},
+		"Webhook step without http url": {
+			failover:    []FailoverStep{{Channel: ChannelWebhook, To: "example.com/hook"}},
+			errExpected: true,
+		},
+		"Invalid timeout": {
+			failover:    []FailoverStep{{Channel: ChannelPushover, Timeout: "-1s"}},
+			errExpected: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := Alert{Failover: tc.failover}.failoverOK()
+			errReceived := err != nil
+
+			if tc.errExpected != errReceived {
+				t.Errorf("failoverOK returned unexpected error status: %v", err)
+			}
+		})
+	}
+}
+
+func TestEmailNotifierNotifyTo(t *testing.T) {
+	t.Parallel()
+
+	e, err := NewEmailNotifier(EmailConfig{Addr: "smtp.example.com:587", Username: "me", Password: "secret", From: "gmailalert@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gotTo []string
+	var gotMsg string
+	e.send = func(_ context.Context, addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
+		if addr != "smtp.example.com:587" || auth == nil || from != "gmailalert@example.com" {
+			t.Errorf("got unexpected smtp addr %q, auth %v, or from %q", addr, auth, from)
+		}
+		gotTo, gotMsg = to, string(msg)
+		return nil
+	}
+	e.now = func() time.Time { return time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC) }
+
+	alt := Alert{PushoverTitle: "Bill due", PushoverMsg: "Pay it\nsoon"}
+	if err := e.NotifyTo(context.Background(), alt, "a@example.com, b@example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	wantTo := []string{"a@example.com", "b@example.com"}
+	if !cmp.Equal(wantTo, gotTo) {
+		t.Errorf("want != got\ndiff=%s", cmp.Diff(wantTo, gotTo))
+	}
+	wantMsg := "From: gmailalert@example.com\r\n" +
+		"To: a@example.com, b@example.com\r\n" +
+		"Subject: Bill due\r\n" +
+		"Date: Thu, 15 Oct 2026 12:00:00 +0000\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n\r\n" +
+		"Pay it\r\nsoon\r\n"
+	if wantMsg != gotMsg {
+		t.Errorf("want != got\ndiff=%s", cmp.Diff(wantMsg, gotMsg))
+	}
+	if err := e.NotifyTo(context.Background(), alt, " , "); err == nil {
+		t.Error("want error sending email without addresses, got nil")
+	}
+}
+
+func TestSendMailStopsWhenContextIsDone(t *testing.T) {
+	t.Parallel()
+
+	// The server accepts the connection but never greets, so only the
+	// context can end the send.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			defer conn.Close()
+			io.Copy(io.Discard, conn)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- sendMail(ctx, l.Addr().String(), nil, "gmailalert@example.com", []string{"me@example.com"}, []byte("hi"))
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("want error from canceled send, got nil")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("want send stopped when its context is done, but it is still running")
+	}
+}
+
+func TestWebhookNotifierNotifyTo(t *testing.T) {
+	t.Parallel()
+
+	var got webhookNotification
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer svr.Close()
+
+	n := NewWebhookNotifier(svr.Client())
+	alt := Alert{Name: "Bills", EvalID: "run.0", PushoverTitle: "Bill due", PushoverMsg: "Pay it", Matches: 2}
+	if err := n.NotifyTo(context.Background(), alt, svr.URL+"/hook"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := webhookNotification{Alert: "Bills", EvalID: "run.0", Title: "Bill due", Message: "Pay it", Matches: 2}
+	if !cmp.Equal(want, got) {
+		t.Errorf("want != got\ndiff=%s", cmp.Diff(want, got))
+	}
+	if err := n.NotifyTo(context.Background(), alt, svr.URL+"/down"); err == nil {
+		t.Error("want error for unavailable webhook, got nil")
+	}
+}
+
+func TestAlertConfigFailoverNotifier(t *testing.T) {
+	t.Parallel()
+
+	email := []FailoverStep{{Channel: ChannelPushover}, {Channel: ChannelEmail, To: "me@example.com"}}
+	testCases := map[string]struct {
+		config       AlertConfig
+		wantFailover bool
+		errExpected  bool
+	}{
+		"Alerts without failover steps keep the notifier": {
+			config: AlertConfig{Alerts: []Alert{{Name: "Bills"}}},
+		},
+		"Alerts with failover steps get a failover notifier": {
+			config: AlertConfig{
+				Alerts: []Alert{{Name: "Bills", Failover: email}},
+				Email:  &EmailConfig{Addr: "smtp.example.com:25", From: "gmailalert@example.com"},
+			},
+			wantFailover: true,
+		},
+		"Email steps without email configuration": {
+			config:      AlertConfig{Alerts: []Alert{{Name: "Bills", Failover: email}}},
+			errExpected: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			n, err := tc.config.failoverNotifier(&channelTestNotifier{}, log.New(io.Discard, "", 0))
+			errReceived := err != nil
+
+			if tc.errExpected != errReceived {
+				t.Fatalf("failoverNotifier returned unexpected error status: %v", err)
+			}
+			if _, ok := n.(FailoverNotifier); !tc.errExpected && ok != tc.wantFailover {
+				t.Errorf("want failover notifier %t, got %T", tc.wantFailover, n)
+			}
+		})
+	}
+}
+
+func TestAlerterRecordsDeliveringChannel(t *testing.T) {
+	t.Parallel()
+
+	email := &channelTestNotifier{}
+	notifier := FailoverNotifier{
+		Notifier: &channelTestNotifier{err: errors.New("unreachable")},
+		Channels: map[string]ChannelNotifier{ChannelEmail: email},
+		Logger:   log.New(io.Discard, "", 0),
+	}
+	fetcher := fakePreviewFetcher{matches: []Message{{ID: "1"}}}
+	a, err := NewAlerter(fetcher, notifier, WithAlerterLogger(log.New(io.Discard, "", 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := a.process(Alert{
+		Name:           "Bills",
+		GmailQuery:     "from:bank",
+		PushoverTarget: "user",
+		PushoverTitle:  "Bill due",
+		PushoverMsg:    "Pay it",
+		Failover:       []FailoverStep{{Channel: ChannelPushover}, {Channel: ChannelEmail, To: "me@example.com"}},
+	}, nil)
+	if res.Err != nil {
+		t.Fatal(res.Err)
+	}
+
+	if !res.Notified || res.Channel != ChannelEmail {
+		t.Errorf("want alert notified via %q, got notified %t via %q", ChannelEmail, res.Notified, res.Channel)
+	}
+}
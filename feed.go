@@ -0,0 +1,228 @@
+package gmailalert
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// defaultFeedEntries is the number of fired alerts an Atom feed holds,
+// unless configured otherwise.
+const defaultFeedEntries = 50
+
+// FeedConfig represents the configuration of the Atom feed of fired alerts,
+// for users who prefer feed readers to push notifications.
+type FeedConfig struct {
+	// The file the feed is written to after every run with fired alerts,
+	// like a file served by a web server. If empty, the feed is only
+	// served by the HTTP API.
+	File string `json:"file"`
+	// The title of the feed. Defaults to "gmailalert".
+	Title string `json:"title"`
+	// The number of most recent fired alerts in the feed. Defaults to 50.
+	Entries int `json:"entries"`
+	// The Gmail account the links to emails open them in, either its index
+	// among the accounts signed in to the browser, like "1", or its address.
+	// Defaults to "0", the first account.
+	GmailUser string `json:"gmailuser"`
+}
+
+// atomFeed represents an Atom feed document, as described by RFC 4287.
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated time.Time   `xml:"updated"`
+	Author  atomPerson  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+// atomPerson represents the author of an Atom feed.
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+// atomEntry represents a fired alert in an Atom feed.
+type atomEntry struct {
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated time.Time   `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Content atomContent `xml:"content"`
+}
+
+// atomLink represents a link of an Atom entry.
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+// atomContent represents the plain text content of an Atom entry.
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Text string `xml:",chardata"`
+}
+
+// Feed is a Reporter writing the most recent fired alerts of every run to an
+// Atom feed file, with entries holding the message of each notification and
+// links opening its emails in Gmail. It is safe for concurrent use by
+// multiple goroutines.
+type Feed struct {
+	cfg     FeedConfig
+	mtx     sync.Mutex
+	entries []atomEntry
+}
+
+// NewFeed accepts a FeedConfig and returns a new Feed, starting with the
+// entries of the feed file if it exists, so that they are kept across
+// restarts. An error is returned if the file name is empty, the number of
+// entries is negative, or the existing feed file cannot be read.
+func NewFeed(cfg FeedConfig) (*Feed, error) {
+	if cfg.File == "" {
+		return nil, errors.New("feed file name must not be empty")
+	}
+	if cfg.Entries < 0 {
+		return nil, fmt.Errorf("feed entries must not be negative, got %d", cfg.Entries)
+	}
+
+	f := &Feed{cfg: cfg}
+	b, err := os.ReadFile(cfg.File)
+	if errors.Is(err, os.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("got error reading feed file: %v", err)
+	}
+	var existing atomFeed
+	if err := xml.Unmarshal(b, &existing); err != nil {
+		return nil, fmt.Errorf("got error decoding feed file %s: %v", cfg.File, err)
+	}
+	f.entries = existing.Entries
+
+	return f, nil
+}
+
+// Report accepts the Summary of a run and adds an entry for every notified
+// alert in it to the front of the feed, dropping the oldest entries beyond
+// the configured number, and writes the feed file. The file is not written
+// if no alert was notified. An error is returned if it cannot be written.
+func (f *Feed) Report(s Summary) error {
+	var added []atomEntry
+	finished := s.Started.Add(s.Duration)
+	for i := len(s.Results) - 1; i >= 0; i-- {
+		if s.Results[i].Notified {
+			added = append(added, f.cfg.entry(newFiredAlert(s.Results[i], finished)))
+		}
+	}
+	if len(added) == 0 {
+		return nil
+	}
+
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.entries = append(added, f.entries...)
+	if max := f.cfg.entries(); len(f.entries) > max {
+		f.entries = f.entries[:max]
+	}
+	b, err := f.cfg.document(f.entries)
+	if err != nil {
+		return err
+	}
+
+	tmp := f.cfg.File + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return fmt.Errorf("got error writing feed file %s: %v", tmp, err)
+	}
+	if err := os.Rename(tmp, f.cfg.File); err != nil {
+		return fmt.Errorf("got error replacing feed file %s: %v", f.cfg.File, err)
+	}
+
+	return nil
+}
+
+// feed returns the FeedConfig of the AlertConfig receiver c, or an empty one
+// using the defaults if it has none.
+func (c AlertConfig) feed() FeedConfig {
+	if c.Feed == nil {
+		return FeedConfig{}
+	}
+
+	return *c.Feed
+}
+
+// entries returns the number of fired alerts in the feed configured by the
+// FeedConfig receiver c.
+func (c FeedConfig) entries() int {
+	if c.Entries == 0 {
+		return defaultFeedEntries
+	}
+
+	return c.Entries
+}
+
+// atom returns the Atom feed document configured by the FeedConfig receiver
+// c with entries for the given fired alerts, newest first.
+func (c FeedConfig) atom(fired []FiredAlert) ([]byte, error) {
+	entries := make([]atomEntry, 0, len(fired))
+	for _, f := range fired {
+		entries = append(entries, c.entry(f))
+	}
+
+	return c.document(entries)
+}
+
+// document returns the Atom feed document configured by the FeedConfig
+// receiver c with the given entries, newest first. An error is returned if
+// the document cannot be encoded.
+func (c FeedConfig) document(entries []atomEntry) ([]byte, error) {
+	feed := atomFeed{
+		Title:   firstNonEmpty(c.Title, "gmailalert"),
+		ID:      "urn:gmailalert:feed",
+		Updated: time.Unix(0, 0).UTC(),
+		Author:  atomPerson{Name: "gmailalert"},
+		Entries: entries,
+	}
+	if len(entries) > 0 {
+		feed.Updated = entries[0].Updated
+	}
+
+	b, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("got error xml-encoding feed: %v", err)
+	}
+
+	return append([]byte(xml.Header), append(b, '\n')...), nil
+}
+
+// entry returns the Atom entry of the given FiredAlert, linking to each of
+// its emails in the Gmail account configured by the FeedConfig receiver c.
+// The first email is linked as the entry's alternate link.
+func (c FeedConfig) entry(f FiredAlert) atomEntry {
+	e := atomEntry{
+		Title:   firstNonEmpty(f.Title, f.Alert),
+		ID:      "urn:gmailalert:eval:" + f.EvalID,
+		Updated: f.Time.UTC(),
+		Content: atomContent{Type: "text", Text: f.Message},
+	}
+	for i, id := range f.MessageIDs {
+		rel := "related"
+		if i == 0 {
+			rel = "alternate"
+		}
+		e.Links = append(e.Links, atomLink{Rel: rel, Href: gmailMessageURL(c.GmailUser, id)})
+	}
+
+	return e
+}
+
+// gmailMessageURL returns the URL opening the email with the given Gmail
+// message ID in the Gmail web interface, in the signed in account with the
+// given index or address, or the first account if it is empty.
+func gmailMessageURL(user, id string) string {
+	return fmt.Sprintf("https://mail.google.com/mail/u/%s/#all/%s",
+		url.PathEscape(firstNonEmpty(user, "0")), url.PathEscape(id))
+}
@@ -0,0 +1,111 @@
+package gmailalert
+
+import (
+	"encoding/xml"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewFeed(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "invalid.xml")
+	if err := os.WriteFile(invalid, []byte("<feed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	testCases := map[string]struct {
+		cfg         FeedConfig
+		errExpected bool
+	}{
+		"Missing file starts an empty feed": {
+			cfg: FeedConfig{File: filepath.Join(dir, "feed.xml")},
+		},
+		"Empty file name returns error": {
+			cfg:         FeedConfig{},
+			errExpected: true,
+		},
+		"Negative entries returns error": {
+			cfg:         FeedConfig{File: filepath.Join(dir, "feed.xml"), Entries: -1},
+			errExpected: true,
+		},
+		"Invalid feed file returns error": {
+			cfg:         FeedConfig{File: invalid},
+			errExpected: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewFeed(tc.cfg)
+			errReceived := err != nil
+
+			if tc.errExpected != errReceived {
+				t.Fatalf("NewFeed(%+v) returned unexpected error status: %v", tc.cfg, err)
+			}
+		})
+	}
+}
+
+func TestFeedReportWritesFiredAlerts(t *testing.T) {
+	t.Parallel()
+
+	cfg := FeedConfig{File: filepath.Join(t.TempDir(), "feed.xml"), Entries: 2, GmailUser: "me@example.com"}
+	f, err := NewFeed(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := Alerter{
+		Matcher:  fakePreviewFetcher{matches: []Message{{ID: "18a1"}, {ID: "18a2"}}},
+		Notifier: &recordingTestNotifier{},
+		Logger:   log.New(io.Discard, "", 0),
+	}
+	summary := a.run([]Alert{{Name: "bills", GmailQuery: "from:bank", PushoverTitle: "Bill due"}})
+	old := Summary{Started: time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC), Results: []AlertResult{
+		{Alert: "orders", EvalID: "old.0", Notified: true},
+		{Alert: "boss", EvalID: "old.1", Notified: true},
+	}}
+
+	if err := f.Report(old); err != nil {
+		t.Fatal(err)
+	}
+	if f, err = NewFeed(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Report(summary); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(cfg.File)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var feed atomFeed
+	if err := xml.Unmarshal(b, &feed); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range feed.Entries {
+		got = append(got, e.Title)
+	}
+	want := []string{"Bill due", "boss"}
+	if !cmp.Equal(want, got) {
+		t.Fatalf("want the newest entries kept across restarts\ndiff=%s", cmp.Diff(want, got))
+	}
+	wantLinks := []atomLink{
+		{Rel: "alternate", Href: "https://mail.google.com/mail/u/me@example.com/#all/18a1"},
+		{Rel: "related", Href: "https://mail.google.com/mail/u/me@example.com/#all/18a2"},
+	}
+	if !cmp.Equal(wantLinks, feed.Entries[0].Links) {
+		t.Errorf("want links to the emails\ndiff=%s", cmp.Diff(wantLinks, feed.Entries[0].Links))
+	}
+	if feed.Entries[0].Content.Text != summary.Results[0].Message || feed.Entries[0].Content.Text == "" {
+		t.Errorf("want the notification message as content, got %q", feed.Entries[0].Content.Text)
+	}
+}
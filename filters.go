@@ -0,0 +1,155 @@
+package gmailalert
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// defaultFilterLabelPrefix is prepended to the name of each alert to form
+// the label its exported Gmail filter applies.
+const defaultFilterLabelPrefix = "gmailalert/"
+
+// filterFeed represents a Gmail filter export file, the Atom feed that
+// Gmail's "Import filters" setting reads.
+type filterFeed struct {
+	XMLName xml.Name      `xml:"feed"`
+	Xmlns   string        `xml:"xmlns,attr"`
+	Apps    string        `xml:"xmlns:apps,attr"`
+	Title   string        `xml:"title"`
+	Entries []filterEntry `xml:"entry"`
+}
+
+// filterEntry represents a single Gmail filter in a filterFeed.
+type filterEntry struct {
+	Category   filterCategory   `xml:"category"`
+	Title      string           `xml:"title"`
+	Content    string           `xml:"content"`
+	Properties []filterProperty `xml:"apps:property"`
+}
+
+// filterCategory marks a filterEntry as a filter.
+type filterCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+// filterProperty represents a criterion or an action of a Gmail filter,
+// like "hasTheWord" or "label".
+type filterProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// filtersCLI accepts the command line flags of the "config filters"
+// subcommand, which writes the alerts of the alert configuration as Gmail
+// filters to stdout, in the XML format of Gmail's "Import filters" setting.
+// Each filter applies a label made of the prefix given by the
+// "-label-prefix" flag and the name of its alert, unless the prefix is
+// empty. Alerts that cannot be expressed as a Gmail filter are reported on
+// stderr. An error is returned if the flags are invalid or the alert
+// configuration cannot be loaded.
+func filtersCLI(args []string) error {
+	var app cliEnv
+	var labelPrefix string
+
+	fs := app.flagSet("config filters")
+	fs.StringVar(
+		&labelPrefix,
+		"label-prefix",
+		defaultFilterLabelPrefix,
+		"the prefix of the label each filter applies, followed by the alert name (no labels if empty)")
+	if err := app.parse(fs, args); err != nil {
+		return err
+	}
+
+	_, alertCfg, err := app.profileConfig()
+	if err != nil {
+		return err
+	}
+
+	skipped, err := writeFilters(alertCfg.Alerts, labelPrefix, os.Stdout)
+	for _, name := range skipped {
+		fmt.Fprintf(os.Stderr, "skipped alert %q: label and unread alerts have no gmail query to filter on\n", name)
+	}
+
+	return err
+}
+
+// writeFilters writes a Gmail filter for each of the given alerts that has a
+// Gmail query to the given io.Writer as a filter export file, and returns
+// the names of the alerts that were skipped. The filter of an alert matches
+// its Gmail query, or its Queries combined into a single query, narrowed
+// down by its Signals. If the given label prefix is not empty, the filter
+// applies the label made of it and the alert's name. An error is returned if
+// the filters cannot be written.
+func writeFilters(alerts []Alert, labelPrefix string, w io.Writer) ([]string, error) {
+	feed := filterFeed{
+		Xmlns: "http://www.w3.org/2005/Atom",
+		Apps:  "http://schemas.google.com/apps/2006",
+		Title: "Mail Filters",
+	}
+	var skipped []string
+	for _, alt := range alerts {
+		query := alt.GmailQuery
+		if alt.Queries != nil {
+			query = alt.Queries.gmailQuery()
+		}
+		if query == "" {
+			skipped = append(skipped, alt.key())
+			continue
+		}
+
+		entry := filterEntry{
+			Category: filterCategory{Term: "filter"},
+			Title:    "Mail Filter",
+			Properties: []filterProperty{
+				{Name: "hasTheWord", Value: alt.signals().query(query)},
+			},
+		}
+		if labelPrefix != "" {
+			entry.Properties = append(entry.Properties, filterProperty{Name: "label", Value: labelPrefix + alt.key()})
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return skipped, err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		return skipped, fmt.Errorf("got error writing gmail filters: %v", err)
+	}
+	_, err := io.WriteString(w, "\n")
+
+	return skipped, err
+}
+
+// gmailQuery returns the QueryExpr as a single Gmail query, with the operands
+// of an And side by side, those of an Or joined by "OR", and a Not negated
+// with "-", each in parentheses.
+func (q QueryExpr) gmailQuery() string {
+	switch {
+	case q.Query != "":
+		return q.Query
+	case q.Not != nil:
+		return "-(" + q.Not.gmailQuery() + ")"
+	}
+
+	ops, sep := q.And, " "
+	if q.Or != nil {
+		ops, sep = q.Or, " OR "
+	}
+	parts := make([]string, 0, len(ops))
+	for _, op := range ops {
+		if op.Not != nil {
+			parts = append(parts, op.gmailQuery())
+			continue
+		}
+		parts = append(parts, "("+op.gmailQuery()+")")
+	}
+
+	return strings.Join(parts, sep)
+}
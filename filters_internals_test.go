@@ -0,0 +1,80 @@
+package gmailalert
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWriteFilters(t *testing.T) {
+	t.Parallel()
+
+	important := true
+	alerts := []Alert{
+		{Name: "Bill Due", GmailQuery: "from:billing@example.com", Important: &important},
+		{LabelAdded: "Banking"},
+		{Name: "Orders", Queries: &QueryExpr{And: []QueryExpr{
+			{Or: []QueryExpr{{Query: "from:shop.com"}, {Query: "from:store.com"}}},
+			{Not: &QueryExpr{Query: "subject:newsletter"}},
+		}}},
+	}
+
+	var buf bytes.Buffer
+	skipped, err := writeFilters(alerts, "gmailalert/", &buf)
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+
+	if !cmp.Equal([]string{"label added: Banking"}, skipped) {
+		t.Errorf("want the label alert to be skipped, got %v", skipped)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte(`<feed xmlns="http://www.w3.org/2005/Atom" xmlns:apps="http://schemas.google.com/apps/2006">`)) {
+		t.Errorf("want a feed with the apps namespace, got:\n%s", buf.String())
+	}
+	if !bytes.Contains(buf.Bytes(), []byte(`<apps:property name="hasTheWord"`)) {
+		t.Errorf("want apps:property elements, got:\n%s", buf.String())
+	}
+
+	// Gmail resolves the "apps:" prefix to its namespace when reading the
+	// filters, so they are parsed the same way.
+	var got struct {
+		Entries []struct {
+			Properties []filterProperty `xml:"http://schemas.google.com/apps/2006 property"`
+		} `xml:"entry"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("got error parsing the written filters: %v", err)
+	}
+	want := [][]filterProperty{
+		{
+			{Name: "hasTheWord", Value: "from:billing@example.com is:important"},
+			{Name: "label", Value: "gmailalert/Bill Due"},
+		},
+		{
+			{Name: "hasTheWord", Value: "((from:shop.com) OR (from:store.com)) -(subject:newsletter)"},
+			{Name: "label", Value: "gmailalert/Orders"},
+		},
+	}
+	var gotProps [][]filterProperty
+	for _, e := range got.Entries {
+		gotProps = append(gotProps, e.Properties)
+	}
+	if !cmp.Equal(want, gotProps) {
+		t.Error(cmp.Diff(want, gotProps))
+	}
+}
+
+func TestWriteFiltersWithoutLabels(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	if _, err := writeFilters([]Alert{{GmailQuery: "is:starred"}}, "", &buf); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+
+	if bytes.Contains(buf.Bytes(), []byte(`name="label"`)) {
+		t.Errorf("want no label action, got:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,352 @@
+package gmailalert
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// The kinds of Formatters returned by NewFormatter.
+const (
+	FormatPushover = "pushover"
+	FormatSlack    = "slack"
+	FormatDiscord  = "discord"
+	FormatWebhook  = "webhook"
+)
+
+// The maximum lengths, in characters, of the texts of Slack blocks and
+// Discord embeds.
+const (
+	slackHeaderMaxLength        = 150
+	slackSectionMaxLength       = 3000
+	discordTitleMaxLength       = 256
+	discordDescriptionMaxLength = 4096
+)
+
+// The colors of Discord embeds, for regular and emergency notifications.
+const (
+	discordColor          = 0x5865F2
+	discordEmergencyColor = 0xED4245
+)
+
+// Notification represents the data of the notification of an alert, which
+// a Formatter renders for a notifier, and which the templates of a
+// FormatTemplate are executed with.
+type Notification struct {
+	// The name identifying the alert.
+	Alert string
+	// The title of the notification.
+	Title string
+	// The message of the notification, like "Found 2 emails matching query
+	// "from:bank"".
+	Message string
+	// The number of emails matching the alert.
+	Matches int
+	// The free-form labels of the alert.
+	Labels map[string]string
+	// The evaluation ID of the alert.
+	EvalID string
+	// Whether the notification is sent with emergency priority.
+	Emergency bool
+}
+
+// newNotification returns the Notification of the given Alert.
+func newNotification(alt Alert) Notification {
+	return Notification{
+		Alert:     alt.key(),
+		Title:     alt.PushoverTitle,
+		Message:   alt.PushoverMsg,
+		Matches:   alt.Matches,
+		Labels:    alt.Labels,
+		EvalID:    alt.EvalID,
+		Emergency: alt.PushoverEmergency != nil,
+	}
+}
+
+// Formatted represents a Notification rendered by a Formatter.
+type Formatted struct {
+	// The title, for notifiers with a title of their own, like Pushover.
+	Title string
+	// The plain text message.
+	Message string
+	// The JSON payload, for notifiers posting structured messages, like
+	// Slack or Discord webhooks.
+	Payload json.RawMessage
+}
+
+// Formatter is the interface that wraps the Format method, which renders a
+// Notification in the structure a notifier sends, like the title and message
+// of a Pushover notification or the blocks of a Slack message. An error is
+// returned if the Notification cannot be rendered.
+type Formatter interface {
+	Format(n Notification) (Formatted, error)
+}
+
+// FormatTemplate represents the user-defined text/templates overriding the
+// title and message of the notifications a Formatter renders, executed with
+// the Notification, like "{{.Alert}}: {{.Matches}} new". Empty templates
+// leave the title or message unchanged.
+type FormatTemplate struct {
+	// The template of the title.
+	Title string `json:"title"`
+	// The template of the message.
+	Message string `json:"message"`
+}
+
+// templates represents the parsed templates of a FormatTemplate.
+type templates struct {
+	title   *template.Template
+	message *template.Template
+}
+
+// parse returns the parsed templates of the FormatTemplate receiver t. An
+// error is returned if any template cannot be parsed.
+func (t FormatTemplate) parse() (templates, error) {
+	var tmpls templates
+	var err error
+	if t.Title != "" {
+		if tmpls.title, err = template.New("title").Parse(t.Title); err != nil {
+			return templates{}, fmt.Errorf("got error parsing title template: %v", err)
+		}
+	}
+	if t.Message != "" {
+		if tmpls.message, err = template.New("message").Parse(t.Message); err != nil {
+			return templates{}, fmt.Errorf("got error parsing message template: %v", err)
+		}
+	}
+
+	return tmpls, nil
+}
+
+// apply returns the given Notification with its title and message replaced
+// by the results of the templates receiver t, if any. An error is returned
+// if a template cannot be executed.
+func (t templates) apply(n Notification) (Notification, error) {
+	title, err := execute(t.title, n, n.Title)
+	if err != nil {
+		return Notification{}, err
+	}
+	message, err := execute(t.message, n, n.Message)
+	if err != nil {
+		return Notification{}, err
+	}
+	n.Title, n.Message = title, message
+
+	return n, nil
+}
+
+// execute returns the result of executing the given template with the given
+// Notification, or the given default text if the template is nil. An error
+// is returned if the template cannot be executed.
+func execute(tmpl *template.Template, n Notification, text string) (string, error) {
+	if tmpl == nil {
+		return text, nil
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, n); err != nil {
+		return "", fmt.Errorf("got error executing %s template of alert %q: %v", tmpl.Name(), n.Alert, err)
+	}
+
+	return b.String(), nil
+}
+
+// NewFormatter accepts the kind of notifier, one of FormatPushover,
+// FormatSlack, FormatDiscord, or FormatWebhook, and a FormatTemplate, and
+// returns the Formatter rendering Notifications for that kind of notifier
+// with the FormatTemplate applied. An error is returned if the kind is
+// unknown or the FormatTemplate cannot be parsed.
+func NewFormatter(kind string, tmpl FormatTemplate) (Formatter, error) {
+	tmpls, err := tmpl.parse()
+	if err != nil {
+		return nil, fmt.Errorf("got error parsing %s format: %v", kind, err)
+	}
+
+	switch kind {
+	case FormatPushover:
+		return PushoverFormatter{tmpls: tmpls}, nil
+	case FormatSlack:
+		return SlackFormatter{tmpls: tmpls}, nil
+	case FormatDiscord:
+		return DiscordFormatter{tmpls: tmpls}, nil
+	case FormatWebhook:
+		return WebhookFormatter{tmpls: tmpls}, nil
+	}
+
+	return nil, fmt.Errorf("format must be one of %q, %q, %q, or %q, got %q",
+		FormatPushover, FormatSlack, FormatDiscord, FormatWebhook, kind)
+}
+
+// formatter returns the Formatter of the given kind with the template
+// configured for it in the AlertConfig receiver c, if any. An error is
+// returned if the kind is unknown or its template is invalid.
+func (c AlertConfig) formatter(kind string) (Formatter, error) {
+	for k := range c.Formats {
+		if k != FormatPushover && k != FormatSlack && k != FormatDiscord && k != FormatWebhook {
+			return nil, fmt.Errorf("formats must only configure %q, %q, %q, or %q, got %q",
+				FormatPushover, FormatSlack, FormatDiscord, FormatWebhook, k)
+		}
+	}
+
+	return NewFormatter(kind, c.Formats[kind])
+}
+
+// PushoverFormatter is a Formatter rendering the title and plain text
+// message of a Pushover notification.
+type PushoverFormatter struct {
+	tmpls templates
+}
+
+// Format returns the title and message of the given Notification. An error
+// is returned if a template cannot be executed.
+func (p PushoverFormatter) Format(n Notification) (Formatted, error) {
+	n, err := p.tmpls.apply(n)
+	if err != nil {
+		return Formatted{}, err
+	}
+
+	return Formatted{Title: n.Title, Message: n.Message}, nil
+}
+
+// SlackFormatter is a Formatter rendering the JSON payload of a Slack
+// message with a header block holding the title, a section block holding
+// the message, and a context block holding the alert, its number of matches,
+// and its labels, along with the message as the fallback text of clients
+// that cannot show blocks.
+type SlackFormatter struct {
+	tmpls templates
+}
+
+// slackText represents a text object of a Slack block.
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// slackBlock represents a block of a Slack message.
+type slackBlock struct {
+	Type     string      `json:"type"`
+	Text     *slackText  `json:"text,omitempty"`
+	Elements []slackText `json:"elements,omitempty"`
+}
+
+// Format returns the Slack message of the given Notification. An error is
+// returned if a template cannot be executed or the message cannot be
+// encoded.
+func (s SlackFormatter) Format(n Notification) (Formatted, error) {
+	n, err := s.tmpls.apply(n)
+	if err != nil {
+		return Formatted{}, err
+	}
+
+	context := fmt.Sprintf("alert *%s* · %d matches", n.Alert, n.Matches)
+	if len(n.Labels) > 0 {
+		context += " · " + formatLabels(n.Labels, "=", ", ")
+	}
+	msg := struct {
+		Text   string       `json:"text"`
+		Blocks []slackBlock `json:"blocks"`
+	}{
+		Text: n.Message,
+		Blocks: []slackBlock{
+			{Type: "header", Text: &slackText{Type: "plain_text", Text: truncateText(n.Title, slackHeaderMaxLength)}},
+			{Type: "section", Text: &slackText{Type: "mrkdwn", Text: truncateMessage(n.Message, slackSectionMaxLength)}},
+			{Type: "context", Elements: []slackText{{Type: "mrkdwn", Text: context}}},
+		},
+	}
+
+	return marshalFormatted(n, msg)
+}
+
+// DiscordFormatter is a Formatter rendering the JSON payload of a Discord
+// webhook message with an embed holding the title, the message, the number
+// of matches and the labels as fields, and the evaluation ID as the footer,
+// colored red for emergency notifications.
+type DiscordFormatter struct {
+	tmpls templates
+}
+
+// discordField represents a field of a Discord embed.
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+// discordEmbed represents an embed of a Discord message.
+type discordEmbed struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description"`
+	Color       int            `json:"color"`
+	Fields      []discordField `json:"fields"`
+	Footer      struct {
+		Text string `json:"text"`
+	} `json:"footer"`
+}
+
+// Format returns the Discord message of the given Notification. An error is
+// returned if a template cannot be executed or the message cannot be
+// encoded.
+func (d DiscordFormatter) Format(n Notification) (Formatted, error) {
+	n, err := d.tmpls.apply(n)
+	if err != nil {
+		return Formatted{}, err
+	}
+
+	embed := discordEmbed{
+		Title:       truncateText(n.Title, discordTitleMaxLength),
+		Description: truncateMessage(n.Message, discordDescriptionMaxLength),
+		Color:       discordColor,
+		Fields:      []discordField{{Name: "Matches", Value: fmt.Sprint(n.Matches), Inline: true}},
+	}
+	if n.Emergency {
+		embed.Color = discordEmergencyColor
+	}
+	for _, k := range sortedLabelKeys(n.Labels) {
+		embed.Fields = append(embed.Fields, discordField{Name: k, Value: n.Labels[k], Inline: true})
+	}
+	embed.Footer.Text = "alert " + n.Alert + " · eval " + n.EvalID
+
+	return marshalFormatted(n, struct {
+		Embeds []discordEmbed `json:"embeds"`
+	}{Embeds: []discordEmbed{embed}})
+}
+
+// WebhookFormatter is a Formatter rendering the JSON payload of a plain
+// webhook, holding every field of the Notification.
+type WebhookFormatter struct {
+	tmpls templates
+}
+
+// Format returns the webhook payload of the given Notification. An error is
+// returned if a template cannot be executed or the payload cannot be
+// encoded.
+func (w WebhookFormatter) Format(n Notification) (Formatted, error) {
+	n, err := w.tmpls.apply(n)
+	if err != nil {
+		return Formatted{}, err
+	}
+
+	return marshalFormatted(n, struct {
+		Alert     string            `json:"alert"`
+		Title     string            `json:"title"`
+		Message   string            `json:"message"`
+		Matches   int               `json:"matches"`
+		Labels    map[string]string `json:"labels,omitempty"`
+		EvalID    string            `json:"evalid"`
+		Emergency bool              `json:"emergency"`
+	}{n.Alert, n.Title, n.Message, n.Matches, n.Labels, n.EvalID, n.Emergency})
+}
+
+// marshalFormatted returns the Formatted of the given Notification with the
+// given payload encoded as JSON. An error is returned if the payload cannot
+// be encoded.
+func marshalFormatted(n Notification, payload interface{}) (Formatted, error) {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return Formatted{}, fmt.Errorf("got error json-encoding notification of alert %q: %v", n.Alert, err)
+	}
+
+	return Formatted{Title: n.Title, Message: n.Message, Payload: b}, nil
+}
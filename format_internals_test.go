@@ -0,0 +1,157 @@
+package gmailalert
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewFormatter(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		kind        string
+		tmpl        FormatTemplate
+		errExpected bool
+	}{
+		"Known kind returns no error": {
+			kind: FormatSlack,
+		},
+		"Unknown kind returns error": {
+			kind:        "teams",
+			errExpected: true,
+		},
+		"Invalid template returns error": {
+			kind:        FormatPushover,
+			tmpl:        FormatTemplate{Message: "{{.Matches"},
+			errExpected: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewFormatter(tc.kind, tc.tmpl)
+			errReceived := err != nil
+			if tc.errExpected != errReceived {
+				t.Fatalf("NewFormatter returned unexpected error status: %v", err)
+			}
+		})
+	}
+}
+
+func TestFormatters(t *testing.T) {
+	t.Parallel()
+
+	n := Notification{
+		Alert:     "bills",
+		Title:     "Bill Due!",
+		Message:   `Found 2 emails matching query "from:bank"`,
+		Matches:   2,
+		Labels:    map[string]string{"team": "billing"},
+		EvalID:    "run1.0",
+		Emergency: true,
+	}
+
+	t.Run("pushover formatter applies templates", func(t *testing.T) {
+		f, err := NewFormatter(FormatPushover, FormatTemplate{Title: "[{{.Labels.team}}] {{.Title}}", Message: "{{.Matches}} new"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := f.Format(n)
+		if err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		want := Formatted{Title: "[billing] Bill Due!", Message: "2 new"}
+		if !cmp.Equal(want, got) {
+			t.Error(cmp.Diff(want, got))
+		}
+	})
+
+	t.Run("slack formatter renders blocks", func(t *testing.T) {
+		got, err := SlackFormatter{}.Format(n)
+		if err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		var msg struct {
+			Text   string
+			Blocks []slackBlock
+		}
+		if err := json.Unmarshal(got.Payload, &msg); err != nil {
+			t.Fatal(err)
+		}
+		want := []slackBlock{
+			{Type: "header", Text: &slackText{Type: "plain_text", Text: "Bill Due!"}},
+			{Type: "section", Text: &slackText{Type: "mrkdwn", Text: n.Message}},
+			{Type: "context", Elements: []slackText{{Type: "mrkdwn", Text: "alert *bills* · 2 matches · team=billing"}}},
+		}
+		if !cmp.Equal(want, msg.Blocks) {
+			t.Error(cmp.Diff(want, msg.Blocks))
+		}
+		if msg.Text != n.Message {
+			t.Errorf("want fallback text %q, got %q", n.Message, msg.Text)
+		}
+	})
+
+	t.Run("discord formatter renders an embed", func(t *testing.T) {
+		got, err := DiscordFormatter{}.Format(n)
+		if err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		var msg struct {
+			Embeds []discordEmbed
+		}
+		if err := json.Unmarshal(got.Payload, &msg); err != nil {
+			t.Fatal(err)
+		}
+		if len(msg.Embeds) != 1 {
+			t.Fatalf("want 1 embed, got %d", len(msg.Embeds))
+		}
+		embed := msg.Embeds[0]
+		if embed.Title != "Bill Due!" || embed.Description != n.Message || embed.Color != discordEmergencyColor {
+			t.Errorf("got unexpected embed %+v", embed)
+		}
+		wantFields := []discordField{{Name: "Matches", Value: "2", Inline: true}, {Name: "team", Value: "billing", Inline: true}}
+		if !cmp.Equal(wantFields, embed.Fields) {
+			t.Error(cmp.Diff(wantFields, embed.Fields))
+		}
+	})
+
+	t.Run("webhook formatter renders every field", func(t *testing.T) {
+		got, err := WebhookFormatter{}.Format(n)
+		if err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		want := `{"alert":"bills","title":"Bill Due!","message":"Found 2 emails matching query \"from:bank\"",` +
+			`"matches":2,"labels":{"team":"billing"},"evalid":"run1.0","emergency":true}`
+		if string(got.Payload) != want {
+			t.Errorf("want payload %s, got %s", want, got.Payload)
+		}
+	})
+
+	t.Run("template that fails to execute returns an error", func(t *testing.T) {
+		f, err := NewFormatter(FormatWebhook, FormatTemplate{Message: "{{.Missing}}"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := f.Format(n); err == nil {
+			t.Fatal("wanted an error but did not get one")
+		}
+	})
+}
+
+func TestAlertConfigFormatter(t *testing.T) {
+	t.Parallel()
+
+	cfg := AlertConfig{Formats: map[string]FormatTemplate{"teams": {Title: "x"}}}
+
+	if _, err := cfg.formatter(FormatPushover); err == nil {
+		t.Fatal("wanted an error for an unknown kind in formats but did not get one")
+	}
+}
@@ -1,30 +1,52 @@
 package gmailalert
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/mail"
+	"net/textproto"
 	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/gmail/v1"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
 )
 
 const defaultTokenFile = "token.json"
 
 // GmailClientConfig represents the configuration needed to create a GmailClient.
+//
+// Deprecated: Use the stable v1.GmailClientConfig in package api/v1.
 type GmailClientConfig struct {
-	// The file containing the user's Google Developers Console credentials.
+	// The file containing the user's Google Developers Console credentials,
+	// or several comma-separated files, like the new and the old credentials
+	// while rotating them. New tokens are authorized with the first file,
+	// and an existing token is used with the credentials of the OAuth2
+	// client it was issued to.
 	CredentialsFile string
 	// The file containing the user's Gmail OAuth2 token.
 	TokenFile string
+	// The OAuth2 scope the token is authorized for, like
+	// gmail.GmailModifyScope for a client modifying the mailbox. If empty,
+	// gmail.GmailReadonlyScope is used, which only allows reading it.
+	Scope string
 	// The input source for entering the Gmail OAuth2 authentication code.
 	UserInput io.Reader
 	// The port that the local HTTP server should listen on for handling
@@ -32,6 +54,15 @@ type GmailClientConfig struct {
 	RedirectSvrPort int
 	// The Logger to use for debugging.
 	Logger Logger
+	// The HTTP client to send requests to the Gmail and Google OAuth2 APIs
+	// with, like one sending them through a proxy. If nil,
+	// http.DefaultClient is used.
+	HTTPClient *http.Client
+	// The TokenManager sharing the token source of the TokenFile with other
+	// GmailClients. The token source is created with the HTTPClient of the
+	// first GmailClient for the TokenFile. If nil, a TokenManager shared by
+	// the whole process is used.
+	Tokens *TokenManager
 }
 
 // OK returns an error if the given GmailClientConfig contains invalid values
@@ -55,8 +86,11 @@ func (g GmailClientConfig) OK() error {
 }
 
 // GmailClient represents a client for communicating with the Gmail API.
+//
+// Deprecated: Use the stable v1.GmailClient in package api/v1.
 type GmailClient struct {
-	svc *gmail.Service
+	svc        *gmail.Service
+	httpClient *http.Client
 }
 
 // NewGmailClient accepts a GmailClientConfig and returns a new GmailClient.
@@ -76,7 +110,7 @@ func NewGmailClient(cfg GmailClientConfig) (*GmailClient, error) {
 	if err := oauth.initializeConfig(); err != nil {
 		return nil, fmt.Errorf("got error initializing gmail oauth: %s", err)
 	}
-	cfg.Logger.Printf("successfully initialized google oauth2 configuration: %s", oauth.oauthCfg)
+	cfg.Logger.Printf("successfully initialized google oauth2 configuration: %s", redactConfig(oauth.oauthCfg))
 
 	httpClient, err := oauth.client()
 	if err != nil {
@@ -88,102 +122,333 @@ func NewGmailClient(cfg GmailClientConfig) (*GmailClient, error) {
 		return nil, fmt.Errorf("got error creating new gmail service: %s", err)
 	}
 
-	return &GmailClient{svc: svc}, nil
+	return &GmailClient{svc: svc, httpClient: httpClient}, nil
+}
+
+// queryOperatorWords are the words Gmail search treats as boolean operators
+// when they appear unquoted.
+var queryOperatorWords = map[string]bool{"OR": true, "AND": true, "AROUND": true}
+
+// QuoteQueryValue returns the given value made safe to use as a single
+// operand in a Gmail query, like the value of "subject:". Double quotes,
+// which Gmail search cannot escape, are replaced with spaces and whitespace
+// is collapsed. The result is put in double quotes if it is empty, contains
+// whitespace or characters with a meaning in Gmail search, like
+// parentheses, braces, colons, or a leading "-", or is an operator word
+// like "OR".
+func QuoteQueryValue(value string) string {
+	value = strings.Join(strings.Fields(strings.ReplaceAll(value, `"`, " ")), " ")
+	if value == "" || strings.ContainsAny(value, " (){}[]:~*") || strings.HasPrefix(value, "-") ||
+		strings.HasPrefix(value, "+") || queryOperatorWords[strings.ToUpper(value)] {
+		return `"` + value + `"`
+	}
+
+	return value
 }
 
 // Match queries Gmail for any emails matching the given query, which can be any
 // valid Gmail query expression, like "is:unread", "from:gopher@gmail.com", etc.
-// It returns a slice of raw email messages matching the query
-// where raw means the email message is RFC 2822 formatted and base64 encoded.
+// It returns a slice of message IDs for any emails matching the query.
 // An error is returned if the query to the Gmail API fails.
 func (g GmailClient) Match(query string) ([]string, error) {
+	msgs, err := g.MatchMessages(query)
+	return messageIDs(msgs), err
+}
+
+// MatchMessages queries Gmail for any emails matching the given query, like
+// Match, and returns them as Messages with their IDs and thread IDs. An
+// error is returned if the query to the Gmail API fails.
+func (g GmailClient) MatchMessages(query string) ([]Message, error) {
 	resp, err := g.svc.Users.Messages.List("me").Q(query).Do()
 	if err != nil {
-		return nil, fmt.Errorf("got error executing gmail query %s: %v", query, err)
+		return nil, fmt.Errorf("got error executing gmail query %s: %w", query, err)
 	}
 
 	return prepareMatchResp(resp.Messages), nil
 }
 
+// MatchSignals queries Gmail for any emails matching the given query and
+// Signals, which are applied as label filters where possible and as query
+// terms otherwise. Spam and trash are only searched if the Signals select
+// them. An error is returned if the query to the Gmail API fails.
+func (g GmailClient) MatchSignals(query string, s Signals) ([]Message, error) {
+	msgs, _, err := g.MatchEstimate(query, s)
+	return msgs, err
+}
+
+// MatchEstimate queries Gmail for any emails matching the given query and
+// Signals, like MatchSignals, and returns the first page of matching emails
+// along with Gmail's estimate of the total number of matching emails, which
+// can be much larger than the page. An error is returned if the query to the
+// Gmail API fails.
+func (g GmailClient) MatchEstimate(query string, s Signals) ([]Message, int, error) {
+	ids, terms := s.labelIDs()
+	q := strings.TrimSpace(query + " " + terms)
+	resp, err := g.svc.Users.Messages.List("me").Q(q).LabelIds(ids...).
+		IncludeSpamTrash(s.includeSpamTrash()).
+		Do()
+	if err != nil {
+		return nil, 0, fmt.Errorf("got error executing gmail query %s with labels %v: %w", q, ids, err)
+	}
+
+	return prepareMatchResp(resp.Messages), int(resp.ResultSizeEstimate), nil
+}
+
+// UnreadCount returns the number of unread emails with the label with the
+// given name, which can be a system label, like "INBOX", or a user label. An
+// error is returned if the label does not exist or if a request to the Gmail
+// API fails.
+func (g GmailClient) UnreadCount(label string) (int, error) {
+	labels, err := g.svc.Users.Labels.List("me").Do()
+	if err != nil {
+		return 0, fmt.Errorf("got error listing gmail labels: %w", err)
+	}
+	labelID, err := resolveLabelID(labels.Labels, label)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := g.svc.Users.Labels.Get("me", labelID).Do()
+	if err != nil {
+		return 0, fmt.Errorf("got error getting gmail label %s: %w", label, err)
+	}
+
+	return int(resp.MessagesUnread), nil
+}
+
+// Fetch retrieves the metadata of the email message with the given ID and
+// returns it as a Message. An error is returned if the request to the Gmail
+// API fails.
+func (g GmailClient) Fetch(id string) (Message, error) {
+	resp, err := g.svc.Users.Messages.Get("me", id).
+		Format("metadata").
+		MetadataHeaders("From", "Subject", "Date").
+		Do()
+	if err != nil {
+		return Message{}, fmt.Errorf("got error fetching gmail message %s: %w", id, err)
+	}
+
+	return prepareFetchResp(resp), nil
+}
+
+// FetchBatch retrieves the metadata of the email messages with the given IDs,
+// at most maxFetchBatch of them, with a single batch request to the Gmail
+// API and returns them as Messages, in order. An error is returned if the
+// batch request or the request for any of the messages fails.
+func (g GmailClient) FetchBatch(ids []string) ([]Message, error) {
+	return fetchBatch(g.httpClient, gmailBatchURL, ids)
+}
+
+// FetchRaw retrieves the email message with the given ID and returns it in
+// its raw, RFC 2822 formatted form. An error is returned if the request to
+// the Gmail API fails or if the raw message cannot be decoded.
+func (g GmailClient) FetchRaw(id string) ([]byte, error) {
+	resp, err := g.svc.Users.Messages.Get("me", id).Format("raw").Do()
+	if err != nil {
+		return nil, fmt.Errorf("got error fetching raw gmail message %s: %w", id, err)
+	}
+
+	return decodeRaw(resp.Raw)
+}
+
+// FetchRawLimited retrieves the email message with the given ID in full
+// format, with a single request, and returns it in its raw, RFC 2822
+// formatted form rebuilt from its parts. The bodies of the attachments that
+// do not fit within maxBytes are left out and never fetched, so that a huge
+// attachment is never held in memory. An error is returned if a request to
+// the Gmail API fails.
+func (g GmailClient) FetchRawLimited(id string, maxBytes int64) ([]byte, error) {
+	resp, err := g.svc.Users.Messages.Get("me", id).Format("full").Do()
+	if err != nil {
+		return nil, fmt.Errorf("got error fetching gmail message %s: %w", id, err)
+	}
+
+	return prunedMessage(resp.Payload, maxBytes, func(attachmentID string) (string, error) {
+		att, err := g.svc.Users.Messages.Attachments.Get("me", id, attachmentID).Do()
+		if err != nil {
+			return "", fmt.Errorf("got error fetching attachment of gmail message %s: %w", id, err)
+		}
+		return att.Data, nil
+	})
+}
+
+// Trash moves the email message with the given ID to the trash. It needs a
+// token authorized for gmail.GmailModifyScope. An error is returned if the
+// request to the Gmail API fails.
+func (g GmailClient) Trash(id string) error {
+	if _, err := g.svc.Users.Messages.Trash("me", id).Do(); err != nil {
+		return fmt.Errorf("got error trashing gmail message %s: %w", id, err)
+	}
+
+	return nil
+}
+
+// LabelChanges returns the messages that gained (if added is true) or lost
+// the label with the given name since the mailbox history point since, along
+// with the current mailbox history point, using the Gmail History API. The
+// label can be a system label, like "INBOX", or a user label. If since is
+// zero, only the current history point is returned. If the history since
+// that point has expired, ErrHistoryExpired is returned along with the
+// current history point. An error is returned if the label does not exist or
+// if a request to the Gmail API fails.
+func (g GmailClient) LabelChanges(label string, added bool, since uint64) ([]Message, uint64, error) {
+	if since == 0 {
+		current, err := g.HistoryID()
+		return nil, current, err
+	}
+
+	labels, err := g.svc.Users.Labels.List("me").Do()
+	if err != nil {
+		return nil, 0, fmt.Errorf("got error listing gmail labels: %w", err)
+	}
+	labelID, err := resolveLabelID(labels.Labels, label)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	historyType := "labelRemoved"
+	if added {
+		historyType = "labelAdded"
+	}
+	var history []*gmail.History
+	latest := since
+	err = g.svc.Users.History.List("me").
+		StartHistoryId(since).
+		HistoryTypes(historyType).
+		Pages(context.Background(), func(resp *gmail.ListHistoryResponse) error {
+			history = append(history, resp.History...)
+			latest = resp.HistoryId
+			return nil
+		})
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound {
+		current, err := g.HistoryID()
+		if err != nil {
+			return nil, 0, err
+		}
+		return nil, current, ErrHistoryExpired
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("got error listing gmail history since %d: %w", since, err)
+	}
+
+	return prepareHistoryResp(history, labelID, added), latest, nil
+}
+
+// HistoryID returns the current history point of the Gmail mailbox. An error
+// is returned if the request to the Gmail API fails.
+func (g GmailClient) HistoryID() (uint64, error) {
+	profile, err := g.svc.Users.GetProfile("me").Do()
+	if err != nil {
+		return 0, fmt.Errorf("got error fetching gmail profile: %w", err)
+	}
+
+	return profile.HistoryId, nil
+}
+
+// ping returns an error if the GmailClient cannot reach the Gmail API, like
+// when its token was revoked, by fetching the Gmail profile, which is the
+// cheapest request the API offers.
+func (g *GmailClient) ping() error {
+	_, err := g.HistoryID()
+	return err
+}
+
 // gmailOAuth2 provides behavior for handling the OAuth2 requests to the Gmail
 // API.
 type gmailOAuth2 struct {
 	GmailClientConfig
+	// The configuration of the first credentials file, which authorizes new
+	// tokens.
 	oauthCfg *oauth2.Config
+	// The configurations of all credentials files, in order.
+	oauthCfgs []*oauth2.Config
 }
 
-// initializeConfig generates an oauth2.Config from a Google Developers Console
-// credentials file and returns it. An error is returned if there is a problem
-// opening the credentials file or if the credentials data is invalid.
+// initializeConfig generates an oauth2.Config from each of the Google
+// Developers Console credentials files. An error is returned if there is a
+// problem opening a credentials file or if the credentials data is invalid.
 func (g *gmailOAuth2) initializeConfig() error {
-	g.Logger.Printf("building gmail oauth2 configuration from google credentials file %s", g.CredentialsFile)
-	f, err := os.Open(g.CredentialsFile)
-	if err != nil {
-		return err
+	g.oauthCfgs = nil
+	for _, file := range credentialsFiles(g.CredentialsFile) {
+		g.Logger.Printf("building gmail oauth2 configuration from google credentials file %s", file)
+		cfg, err := readOAuthConfig(file)
+		if err != nil {
+			return err
+		}
+		if g.Scope != "" {
+			cfg.Scopes = []string{g.Scope}
+		}
+		g.oauthCfgs = append(g.oauthCfgs, cfg)
 	}
-	defer f.Close()
+	if len(g.oauthCfgs) == 0 {
+		return errors.New("credentials file name must not be empty")
+	}
+	g.oauthCfg = g.oauthCfgs[0]
 
-	req, err := prepareConfigRequest(f)
+	return nil
+}
+
+// readOAuthConfig generates an oauth2.Config from the given Google Developers
+// Console credentials file. An error is returned if there is a problem
+// opening the file or if the credentials data is invalid.
+func readOAuthConfig(file string) (*oauth2.Config, error) {
+	f, err := os.Open(file)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer f.Close()
 
-	cfg, err := google.ConfigFromJSON(req.credentials, req.scope)
+	req, err := prepareConfigRequest(f)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	g.oauthCfg = cfg
-
-	return nil
+	return google.ConfigFromJSON(req.credentials, req.scope)
 }
 
 // token() attempts to retrive the Gmail OAuth2 token from a local file. If that
 // fails, it attempts to fetch the token from the Gmail OAuth2 resource
-// provider. An error is returned if no OAuth2 token can be determined.
-func (g gmailOAuth2) token() (*oauth2.Token, error) {
-	tok, err := g.localToken()
+// provider. It returns the token along with the ID of the OAuth2 client it was
+// issued to, which is empty for token files saved before client IDs were
+// recorded. An error is returned if no OAuth2 token can be determined.
+func (g gmailOAuth2) token() (*oauth2.Token, string, error) {
+	stored, err := readStoredToken(g.TokenFile)
 	if err == nil {
-		g.Logger.Printf("successfully read gmail oauth2 token from file %s: %+q", g.TokenFile, tok)
-		return tok, nil
+		g.Logger.Printf("successfully read gmail oauth2 token from file %s: %s", g.TokenFile, redactToken(&stored.Token))
+		return &stored.Token, stored.ClientID, nil
 	}
 
 	g.Logger.Printf("unable to read gmail oauth2 token from local file %s, attempting to fetch token from remote resource provider", g.TokenFile)
-	tok, err = g.remoteToken()
+	tok, err := g.remoteToken()
 	if err != nil {
-		return nil, fmt.Errorf("got error when remotely fetching gmail oauth2 token: %s", err)
+		return nil, "", fmt.Errorf("got error when remotely fetching gmail oauth2 token: %s", err)
 	}
-	g.Logger.Printf("successfully fetched gmail oauth2 token from remote resource provider: %+q", tok)
+	g.Logger.Printf("successfully fetched gmail oauth2 token from remote resource provider: %s", redactToken(tok))
 
 	if g.TokenFile == "" {
 		g.TokenFile = defaultTokenFile
 	}
 
-	err = saveToken(g.TokenFile, tok)
+	err = saveToken(g.TokenFile, tok, g.oauthCfg.ClientID)
 	if err != nil {
 		g.Logger.Printf("got error saving token to file: %s", err)
+		return tok, g.oauthCfg.ClientID, nil
 	}
 	g.Logger.Printf("successfully wrote gmail oauth2 token to file %s", g.TokenFile)
 
-	return tok, nil
+	return tok, g.oauthCfg.ClientID, nil
 }
 
 // localToken attemps to create a Gmail OAuth2 token from a local file. If
 // successful, then the token is returned. Otherwise, an error is returned.
 func (g gmailOAuth2) localToken() (*oauth2.Token, error) {
-	f, err := os.Open(g.TokenFile)
-	if err != nil {
-		return nil, fmt.Errorf("got error opening gmail oauth2 token file %s: %v", g.TokenFile, err)
-	}
-	defer f.Close()
-
-	var tok oauth2.Token
-	err = json.NewDecoder(f).Decode(&tok)
+	stored, err := readStoredToken(g.TokenFile)
 	if err != nil {
-		return nil, fmt.Errorf("got error json-decoding gmail oauth2 token: %v", err)
+		return nil, err
 	}
 
-	return &tok, nil
+	return &stored.Token, nil
 }
 
 // remoteToken attempts to create a Gmail OAuth2 token by first capturing an
@@ -197,35 +462,125 @@ func (g gmailOAuth2) remoteToken() (*oauth2.Token, error) {
 	if err != nil {
 		return nil, fmt.Errorf("got error retrieving oauth2 auth code: %v", err)
 	}
-	g.Logger.Printf("got authentication code from user input: %s", authCode)
+	g.Logger.Printf("got authentication code from user input: %s", Secret(authCode))
+
+	return g.oauthCfg.Exchange(g.context(), authCode)
+}
+
+// context returns a context carrying the configured HTTP client, if any, for
+// the oauth2 package to send its requests with.
+func (g gmailOAuth2) context() context.Context {
+	ctx := context.Background()
+	if g.HTTPClient != nil {
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, g.HTTPClient)
+	}
 
-	return g.oauthCfg.Exchange(context.Background(), authCode)
+	return ctx
 }
 
 // client returns an HTTP client that is configured for sending requests to the
-// Gmail API using an OAuth2 access token. An error is returned if there is
-// problem reading the Google Developers Console credentials or generating the
-// Gmail OAuth2 access token.
+// Gmail API using an OAuth2 access token, which is refreshed when it expires
+// and saved into the token file when possible. The token source is shared
+// with other GmailClients for the same token file through the TokenManager.
+// An error is returned if there is problem reading the Google Developers
+// Console credentials or generating the Gmail OAuth2 access token.
 func (g *gmailOAuth2) client() (*http.Client, error) {
-	tok, err := g.token()
+	tokens := g.Tokens
+	if tokens == nil {
+		tokens = defaultTokenManager
+	}
+
+	ctx := g.context()
+	src, err := tokens.source(g.TokenFile, func() (oauth2.TokenSource, error) {
+		tok, clientID, err := g.token()
+		if err != nil {
+			return nil, err
+		}
+		cfg, err := g.configFor(clientID)
+		if err != nil {
+			return nil, err
+		}
+		return &savingTokenSource{
+			src:      cfg.TokenSource(ctx, tok),
+			file:     g.TokenFile,
+			clientID: cfg.ClientID,
+			logger:   g.Logger,
+			last:     tok.AccessToken,
+		}, nil
+	})
 	if err != nil {
 		return nil, fmt.Errorf("got error fetching gmail oauth2 token: %s", err)
 	}
 
-	return g.oauthCfg.Client(context.Background(), tok), nil
+	client := oauth2.NewClient(ctx, src)
+	if g.HTTPClient != nil {
+		// oauth2.NewClient reuses the transport of the configured client but
+		// not its timeout.
+		client.Timeout = g.HTTPClient.Timeout
+	}
+
+	return client, nil
+}
+
+// savingTokenSource represents an oauth2.TokenSource that saves every
+// refreshed token into the token file, so that a restarted gmailalert starts
+// from the latest token. Failing to save a token, like on a read-only file
+// system, is logged and does not fail the request, since the refreshed token
+// is still used in memory. It is safe for concurrent use by multiple
+// goroutines.
+type savingTokenSource struct {
+	src oauth2.TokenSource
+	// The file the refreshed tokens are saved into.
+	file string
+	// The ID of the OAuth2 client the tokens are issued to, which is saved
+	// along with them.
+	clientID string
+	logger   Logger
+	mtx      sync.Mutex
+	last     string
 }
 
-// saveToken accepts a file name and and OAuth2 token and saves the token into
-// the file. An error is returned if there is a problem opening the file or
-// writing the token into the file.
-func saveToken(file string, token *oauth2.Token) error {
+// Token returns a valid token from the wrapped oauth2.TokenSource, saving it
+// into the token file if it differs from the last token seen. An error is
+// returned if the wrapped oauth2.TokenSource cannot provide a token, which
+// explains how to authorize gmailalert again if the token was rejected.
+func (s *savingTokenSource) Token() (*oauth2.Token, error) {
+	tok, err := s.src.Token()
+	if err != nil {
+		return nil, reauthError(err, s.file)
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if tok.AccessToken == s.last {
+		return tok, nil
+	}
+	s.last = tok.AccessToken
+
+	if s.file == "" {
+		return tok, nil
+	}
+	if err := saveToken(s.file, tok, s.clientID); err != nil {
+		s.logger.Printf("could not save refreshed gmail oauth2 token, continuing with it in memory: %v", err)
+		return tok, nil
+	}
+	s.logger.Printf("saved refreshed gmail oauth2 token to file %s: %s", s.file, redactToken(tok))
+
+	return tok, nil
+}
+
+// saveToken accepts a file name, an OAuth2 token, and the ID of the OAuth2
+// client the token was issued to, if known, and saves the token and the
+// client ID into the file. An error is returned if there is a problem opening
+// the file or writing the token into the file.
+func saveToken(file string, token *oauth2.Token, clientID string) error {
 	f, err := os.OpenFile(file, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
 		return fmt.Errorf("got error opening file %s to save gmail oauth2 token into: %s", file, err)
 	}
 	defer f.Close()
 
-	err = json.NewEncoder(f).Encode(token)
+	err = json.NewEncoder(f).Encode(storedToken{Token: *token, ClientID: clientID})
 	if err != nil {
 		return fmt.Errorf("got error writing gmail oauth2 token into file %s: %s", file, err)
 	}
@@ -299,13 +654,280 @@ func prepareConfigRequest(cfgData io.Reader) (configRequest, error) {
 }
 
 // prepareMatchResp accepts a slice of gmail.Message, iterates through them,
-// and returns a slice of raw (RFC 2822-formatted, base64-encoded) email
-// messages.
-func prepareMatchResp(msgs []*gmail.Message) []string {
-	rawMsgs := make([]string, 0, len(msgs))
+// and returns a slice of Messages containing their message and thread IDs.
+func prepareMatchResp(msgs []*gmail.Message) []Message {
+	matches := make([]Message, 0, len(msgs))
 	for _, m := range msgs {
-		rawMsgs = append(rawMsgs, m.Raw)
+		matches = append(matches, Message{ID: m.Id, ThreadID: m.ThreadId})
+	}
+
+	return matches
+}
+
+// prepareFetchResp accepts a gmail.Message retrieved in metadata format and
+// returns a Message populated from it. The message date is taken from the
+// internal date recorded by Gmail, falling back to the message's Date header.
+func prepareFetchResp(msg *gmail.Message) Message {
+	m := Message{ID: msg.Id, ThreadID: msg.ThreadId, Snippet: msg.Snippet}
+	if msg.InternalDate > 0 {
+		m.Date = time.UnixMilli(msg.InternalDate)
+	}
+
+	if msg.Payload == nil {
+		return m
+	}
+	for _, h := range msg.Payload.Headers {
+		switch strings.ToLower(h.Name) {
+		case "from":
+			m.From = h.Value
+		case "subject":
+			m.Subject = h.Value
+		case "date":
+			if !m.Date.IsZero() {
+				continue
+			}
+			if d, err := mail.ParseDate(h.Value); err == nil {
+				m.Date = d
+			}
+		}
+	}
+
+	return m
+}
+
+// resolveLabelID returns the ID of the label among the given labels whose ID
+// or name equals the given name, ignoring case. An error is returned if there
+// is no such label.
+func resolveLabelID(labels []*gmail.Label, name string) (string, error) {
+	for _, l := range labels {
+		if strings.EqualFold(l.Id, name) || strings.EqualFold(l.Name, name) {
+			return l.Id, nil
+		}
+	}
+
+	return "", fmt.Errorf("gmail label %q does not exist", name)
+}
+
+// prepareHistoryResp accepts a slice of gmail.History records and returns the
+// distinct messages that gained (if added is true) or lost the label with the
+// given ID in them, in the order they first appear.
+func prepareHistoryResp(history []*gmail.History, labelID string, added bool) []Message {
+	seen := map[string]bool{}
+	var msgs []Message
+	collect := func(m *gmail.Message, labelIDs []string) {
+		if m == nil || seen[m.Id] || !containsString(labelIDs, labelID) {
+			return
+		}
+		seen[m.Id] = true
+		msgs = append(msgs, Message{ID: m.Id, ThreadID: m.ThreadId})
+	}
+	for _, h := range history {
+		if added {
+			for _, c := range h.LabelsAdded {
+				collect(c.Message, c.LabelIds)
+			}
+			continue
+		}
+		for _, c := range h.LabelsRemoved {
+			collect(c.Message, c.LabelIds)
+		}
+	}
+
+	return msgs
+}
+
+// containsString reports whether the given string is among the given
+// strings.
+func containsString(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// maxFetchBatch is the maximum number of requests the Gmail API accepts in a
+// single batch request.
+const maxFetchBatch = 100
+
+// gmailBatchURL is the endpoint of batch requests to the Gmail API.
+const gmailBatchURL = "https://gmail.googleapis.com/batch/gmail/v1"
+
+// fetchBatch sends a batch request to the given Gmail batch endpoint with
+// the given *http.Client, fetching the metadata of the messages with the
+// given IDs like Fetch, and returns them as Messages in the order of the
+// IDs. An error is returned if there are more than maxFetchBatch IDs, if the
+// batch request fails, or if the request for any of the messages fails.
+func fetchBatch(client *http.Client, endpoint string, ids []string) ([]Message, error) {
+	if len(ids) > maxFetchBatch {
+		return nil, fmt.Errorf("gmail batch must have at most %d messages, got %d", maxFetchBatch, len(ids))
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for i, id := range ids {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type": {"application/http"},
+			"Content-Id":   {fmt.Sprintf("<%d>", i)},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("got error writing gmail batch request: %v", err)
+		}
+		fmt.Fprintf(w, "GET /gmail/v1/users/me/messages/%s?format=metadata&metadataHeaders=From&metadataHeaders=Subject&metadataHeaders=Date\r\n\r\n",
+			url.PathEscape(id))
+	}
+	if err := mw.Close(); err != nil {
+		return nil, fmt.Errorf("got error writing gmail batch request: %v", err)
+	}
+
+	resp, err := client.Post(endpoint, "multipart/mixed; boundary="+mw.Boundary(), &body)
+	if err != nil {
+		return nil, fmt.Errorf("got error sending gmail batch request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("got unexpected status %s from gmail batch request", resp.Status)
+	}
+	_, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || params["boundary"] == "" {
+		return nil, fmt.Errorf("got error reading boundary of gmail batch response: %v", err)
+	}
+
+	msgs := make([]Message, len(ids))
+	found := make([]bool, len(ids))
+	mr := multipart.NewReader(resp.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("got error reading gmail batch response: %v", err)
+		}
+		// Responses carry the Content-ID of their request prefixed with
+		// "response-".
+		contentID := strings.Trim(part.Header.Get("Content-Id"), "<>")
+		i, err := strconv.Atoi(strings.TrimPrefix(contentID, "response-"))
+		if err != nil || i < 0 || i >= len(ids) {
+			return nil, fmt.Errorf("got unexpected content id %q in gmail batch response", contentID)
+		}
+		partResp, err := http.ReadResponse(bufio.NewReader(part), nil)
+		if err != nil {
+			return nil, fmt.Errorf("got error reading gmail batch response for message %s: %v", ids[i], err)
+		}
+		var msg gmail.Message
+		err = json.NewDecoder(partResp.Body).Decode(&msg)
+		partResp.Body.Close()
+		if partResp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("got error fetching gmail message %s: status %s", ids[i], partResp.Status)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("got error json-decoding gmail message %s: %v", ids[i], err)
+		}
+		msgs[i], found[i] = prepareFetchResp(&msg), true
+	}
+	for i, ok := range found {
+		if !ok {
+			return nil, fmt.Errorf("gmail batch response is missing message %s", ids[i])
+		}
+	}
+
+	return msgs, nil
+}
+
+// omittedHeader is the header added to the parts of a message returned by
+// prunedMessage whose body was left out, holding the size of the body.
+const omittedHeader = "X-Gmailalert-Omitted-Bytes"
+
+// prunedMessage accepts the payload of a gmail.Message retrieved in full
+// format, a number of bytes, and a function returning the base64url
+// encoded body of the attachment with the given ID, and returns the message
+// in raw, RFC 2822 formatted form. The bodies of its parts are included in
+// order as long as their total size stays within maxBytes, and the others
+// are left out, with their size in an omittedHeader header. Bodies are
+// written decoded, so the Content-Transfer-Encoding of every part is
+// "binary". An error is returned if a body cannot be fetched or decoded.
+func prunedMessage(payload *gmail.MessagePart, maxBytes int64, attachment func(id string) (string, error)) ([]byte, error) {
+	var b bytes.Buffer
+	budget := maxBytes
+	if err := writePrunedPart(&b, payload, &budget, attachment); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+// writePrunedPart writes the given part of a message, and its parts, to the
+// given bytes.Buffer as described by prunedMessage, taking the size of the
+// bodies written from the given remaining budget of bytes.
+func writePrunedPart(b *bytes.Buffer, p *gmail.MessagePart, budget *int64, attachment func(id string) (string, error)) error {
+	contentType := ""
+	for _, h := range p.Headers {
+		if strings.EqualFold(h.Name, "Content-Transfer-Encoding") {
+			continue
+		}
+		if strings.EqualFold(h.Name, "Content-Type") {
+			contentType = h.Value
+		}
+		fmt.Fprintf(b, "%s: %s\r\n", h.Name, h.Value)
+	}
+
+	if strings.HasPrefix(strings.ToLower(p.MimeType), "multipart/") {
+		_, params, err := mime.ParseMediaType(contentType)
+		if err != nil || params["boundary"] == "" {
+			return fmt.Errorf("got error reading boundary of %s part: %v", p.MimeType, err)
+		}
+		b.WriteString("\r\n")
+		for _, part := range p.Parts {
+			fmt.Fprintf(b, "--%s\r\n", params["boundary"])
+			if err := writePrunedPart(b, part, budget, attachment); err != nil {
+				return err
+			}
+			b.WriteString("\r\n")
+		}
+		fmt.Fprintf(b, "--%s--\r\n", params["boundary"])
+		return nil
+	}
+
+	var data string
+	switch {
+	case p.Body == nil:
+	case p.Body.Size > *budget:
+		fmt.Fprintf(b, "%s: %d\r\n", omittedHeader, p.Body.Size)
+	case p.Body.Data != "":
+		data = p.Body.Data
+	case p.Body.AttachmentId != "":
+		var err error
+		if data, err = attachment(p.Body.AttachmentId); err != nil {
+			return err
+		}
+	}
+	body, err := decodeRaw(data)
+	if err != nil {
+		return err
+	}
+	*budget -= int64(len(body))
+	b.WriteString("Content-Transfer-Encoding: binary\r\n\r\n")
+	b.Write(body)
+
+	return nil
+}
+
+// decodeRaw decodes the base64url encoded raw message returned by the Gmail
+// API. An error is returned if the message is not valid base64url.
+func decodeRaw(raw string) ([]byte, error) {
+	b, err := base64.URLEncoding.DecodeString(raw)
+	if err != nil {
+		b, err = base64.RawURLEncoding.DecodeString(raw)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("got error decoding raw gmail message: %v", err)
 	}
 
-	return rawMsgs
+	return b, nil
 }
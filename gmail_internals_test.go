@@ -1,9 +1,22 @@
 package gmailalert
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
 	"errors"
+	"fmt"
 	"io"
 	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"net/url"
+	"path"
+	"path/filepath"
 	"strings"
 	"testing"
 	"testing/iotest"
@@ -13,6 +26,7 @@ import (
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"golang.org/x/oauth2"
 	"google.golang.org/api/gmail/v1"
+	"google.golang.org/api/option"
 )
 
 func TestPrepareMatchResp(t *testing.T) {
@@ -20,18 +34,21 @@ func TestPrepareMatchResp(t *testing.T) {
 
 	testCases := map[string]struct {
 		input []*gmail.Message
-		want  []string
+		want  []Message
 	}{
-		"Nil raw input returns an empty slice": {
+		"Nil input returns an empty slice": {
 			input: nil,
-			want:  []string{},
+			want:  []Message{},
 		},
-		"Valid non-empty raw input returns a valid string slice": {
+		"Valid non-empty input returns a valid Message slice": {
 			input: []*gmail.Message{
-				{Raw: "email0"},
-				{Raw: "email1"},
+				{Id: "id0", ThreadId: "thread0"},
+				{Id: "id1", ThreadId: "thread1"},
+			},
+			want: []Message{
+				{ID: "id0", ThreadID: "thread0"},
+				{ID: "id1", ThreadID: "thread1"},
 			},
-			want: []string{"email0", "email1"},
 		},
 	}
 
@@ -47,6 +64,388 @@ func TestPrepareMatchResp(t *testing.T) {
 	}
 }
 
+func TestPrepareFetchResp(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		input *gmail.Message
+		want  Message
+	}{
+		"Internal date and headers are returned": {
+			input: &gmail.Message{
+				Id:           "id0",
+				ThreadId:     "thread0",
+				Snippet:      "hello gopher",
+				InternalDate: 1677672000000,
+				Payload: &gmail.MessagePart{
+					Headers: []*gmail.MessagePartHeader{
+						{Name: "From", Value: "gopher@example.com"},
+						{Name: "Subject", Value: "Hello"},
+						{Name: "Date", Value: "Mon, 02 Jan 2006 15:04:05 -0700"},
+					},
+				},
+			},
+			want: Message{
+				ID:       "id0",
+				ThreadID: "thread0",
+				Snippet:  "hello gopher",
+				Date:     time.UnixMilli(1677672000000),
+				From:     "gopher@example.com",
+				Subject:  "Hello",
+			},
+		},
+		"Date header is used when internal date is missing": {
+			input: &gmail.Message{
+				Id: "id1",
+				Payload: &gmail.MessagePart{
+					Headers: []*gmail.MessagePartHeader{
+						{Name: "date", Value: "Mon, 02 Jan 2006 15:04:05 -0700"},
+					},
+				},
+			},
+			want: Message{
+				ID:   "id1",
+				Date: time.Date(2006, 1, 2, 15, 4, 5, 0, time.FixedZone("", -7*60*60)),
+			},
+		},
+		"Missing payload returns message without headers": {
+			input: &gmail.Message{Id: "id2"},
+			want:  Message{ID: "id2"},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got := prepareFetchResp(tc.input)
+
+			if !cmp.Equal(tc.want, got) {
+				t.Errorf("want != got\ndiff=%s", cmp.Diff(tc.want, got))
+			}
+		})
+	}
+}
+
+func TestDecodeRaw(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		input       string
+		want        []byte
+		errExpected bool
+	}{
+		"Padded base64url input is decoded": {
+			input: "U3ViamVjdDogaGk_Cg==",
+			want:  []byte("Subject: hi?\n"),
+		},
+		"Unpadded base64url input is decoded": {
+			input: "U3ViamVjdDogaGk_Cg",
+			want:  []byte("Subject: hi?\n"),
+		},
+		"Invalid input returns an error": {
+			input:       "not base64!",
+			errExpected: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got, err := decodeRaw(tc.input)
+			errReceived := err != nil
+
+			if errReceived != tc.errExpected {
+				t.Fatalf("got unexpected error status: %t", errReceived)
+			}
+
+			if !errReceived && !cmp.Equal(tc.want, got) {
+				t.Errorf("want %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestFetchBatch(t *testing.T) {
+	t.Parallel()
+
+	// The server answers the requests of a batch in reverse order, failing
+	// the one for the message with the ID "missing".
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		type request struct{ contentID, id string }
+		var reqs []request
+		mr := multipart.NewReader(r.Body, params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err != nil {
+				break
+			}
+			line, _ := bufio.NewReader(part).ReadString('\n')
+			target, err := url.Parse(strings.TrimPrefix(strings.TrimSpace(line), "GET "))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			reqs = append(reqs, request{strings.Trim(part.Header.Get("Content-ID"), "<>"), path.Base(target.Path)})
+		}
+
+		mw := multipart.NewWriter(w)
+		w.Header().Set("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+		for i := len(reqs) - 1; i >= 0; i-- {
+			pw, _ := mw.CreatePart(textproto.MIMEHeader{
+				"Content-Type": {"application/http"},
+				"Content-Id":   {"<response-" + reqs[i].contentID + ">"},
+			})
+			if reqs[i].id == "missing" {
+				fmt.Fprint(pw, "HTTP/1.1 404 Not Found\r\nContent-Type: application/json\r\n\r\n{}")
+				continue
+			}
+			fmt.Fprintf(pw, "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\n\r\n"+
+				`{"id":%q,"payload":{"headers":[{"name":"Subject","value":"Order %s"}]}}`, reqs[i].id, reqs[i].id)
+		}
+		mw.Close()
+	}))
+	defer svr.Close()
+
+	testCases := map[string]struct {
+		ids         []string
+		want        []Message
+		errExpected bool
+	}{
+		"Messages are returned in order": {
+			ids:  []string{"a", "b", "c"},
+			want: []Message{{ID: "a", Subject: "Order a"}, {ID: "b", Subject: "Order b"}, {ID: "c", Subject: "Order c"}},
+		},
+		"Failed message returns an error": {
+			ids:         []string{"a", "missing"},
+			errExpected: true,
+		},
+		"Too many messages return an error": {
+			ids:         make([]string, maxFetchBatch+1),
+			errExpected: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got, err := fetchBatch(svr.Client(), svr.URL, tc.ids)
+			errReceived := err != nil
+
+			if tc.errExpected != errReceived {
+				t.Fatalf("fetchBatch returned unexpected error status: %v", err)
+			}
+			if !cmp.Equal(tc.want, got) {
+				t.Errorf("want != got\ndiff=%s", cmp.Diff(tc.want, got))
+			}
+		})
+	}
+}
+
+func TestPrunedMessage(t *testing.T) {
+	t.Parallel()
+
+	encode := func(s string) string { return base64.URLEncoding.EncodeToString([]byte(s)) }
+	header := func(name, value string) *gmail.MessagePartHeader {
+		return &gmail.MessagePartHeader{Name: name, Value: value}
+	}
+	payload := &gmail.MessagePart{
+		MimeType: "multipart/mixed",
+		Headers: []*gmail.MessagePartHeader{
+			header("Subject", "Scans"),
+			header("Content-Type", `multipart/mixed; boundary="b"`),
+		},
+		Parts: []*gmail.MessagePart{
+			{
+				MimeType: "text/plain",
+				Headers: []*gmail.MessagePartHeader{
+					header("Content-Type", "text/plain"),
+					header("Content-Transfer-Encoding", "base64"),
+				},
+				Body: &gmail.MessagePartBody{Size: 11, Data: encode("Hello there")},
+			},
+			{
+				MimeType: "image/png",
+				Headers: []*gmail.MessagePartHeader{
+					header("Content-Type", "image/png"),
+					header("Content-Disposition", `attachment; filename="small.png"`),
+				},
+				Body: &gmail.MessagePartBody{Size: 9, AttachmentId: "small"},
+			},
+			{
+				MimeType: "application/pdf",
+				Headers: []*gmail.MessagePartHeader{
+					header("Content-Type", "application/pdf"),
+					header("Content-Disposition", `attachment; filename="huge.pdf"`),
+				},
+				Body: &gmail.MessagePartBody{Size: 35 << 20, AttachmentId: "huge"},
+			},
+		},
+	}
+	var fetched []string
+	attachment := func(id string) (string, error) {
+		fetched = append(fetched, id)
+		return encode("PNG bytes"), nil
+	}
+
+	raw, err := prunedMessage(payload, 1024, attachment)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"text/plain": "Hello there", "small.png": "PNG bytes", "huge.pdf": ""}
+	got := map[string]string{}
+	err = walkMIME(bytes.NewReader(raw), func(p mimePart) error {
+		b, err := io.ReadAll(p.body)
+		if p.filename != "" {
+			got[p.filename] = string(b)
+		} else {
+			got[p.mediaType] = string(b)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(want, got) {
+		t.Errorf("want != got\ndiff=%s", cmp.Diff(want, got))
+	}
+	if !cmp.Equal([]string{"small"}, fetched) {
+		t.Errorf("want only the attachment within the limit fetched, got %v", fetched)
+	}
+	if !strings.Contains(string(raw), omittedHeader+": 36700160") {
+		t.Errorf("want the size of the omitted attachment in its header, got %q", raw)
+	}
+}
+
+func TestFetchRawLimitedFetchesMessageOnce(t *testing.T) {
+	t.Parallel()
+
+	var requests []string
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path+"?format="+r.URL.Query().Get("format"))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"id":"1","sizeEstimate":11,"payload":{"mimeType":"text/plain",`+
+			`"headers":[{"name":"Content-Type","value":"text/plain"}],"body":{"size":11,"data":%q}}}`,
+			base64.URLEncoding.EncodeToString([]byte("Hello there")))
+	}))
+	defer svr.Close()
+	svc, err := gmail.NewService(context.Background(), option.WithHTTPClient(svr.Client()), option.WithEndpoint(svr.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := GmailClient{svc: svc, httpClient: svr.Client()}
+
+	raw, err := g.FetchRawLimited("1", 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasSuffix(string(raw), "\r\n\r\nHello there") {
+		t.Errorf("want the message body in the raw message, got %q", raw)
+	}
+	want := []string{"/gmail/v1/users/me/messages/1?format=full"}
+	if !cmp.Equal(want, requests) {
+		t.Errorf("want != got\ndiff=%s", cmp.Diff(want, requests))
+	}
+}
+
+func TestResolveLabelID(t *testing.T) {
+	t.Parallel()
+
+	labels := []*gmail.Label{
+		{Id: "INBOX", Name: "INBOX"},
+		{Id: "Label_12", Name: "Banking"},
+	}
+	testCases := map[string]struct {
+		input       string
+		want        string
+		errExpected bool
+	}{
+		"System label by ID": {
+			input: "inbox",
+			want:  "INBOX",
+		},
+		"User label by name": {
+			input: "banking",
+			want:  "Label_12",
+		},
+		"Unknown label returns an error": {
+			input:       "Travel",
+			errExpected: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got, err := resolveLabelID(labels, tc.input)
+			errReceived := err != nil
+
+			if tc.errExpected != errReceived {
+				t.Fatalf("got unexpected error status %v", errReceived)
+			}
+
+			if got != tc.want {
+				t.Errorf("want label ID %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestPrepareHistoryResp(t *testing.T) {
+	t.Parallel()
+
+	history := []*gmail.History{
+		{
+			LabelsAdded: []*gmail.HistoryLabelAdded{
+				{LabelIds: []string{"Label_12"}, Message: &gmail.Message{Id: "id0", ThreadId: "thread0"}},
+				{LabelIds: []string{"UNREAD"}, Message: &gmail.Message{Id: "id1", ThreadId: "thread1"}},
+			},
+			LabelsRemoved: []*gmail.HistoryLabelRemoved{
+				{LabelIds: []string{"INBOX"}, Message: &gmail.Message{Id: "id2", ThreadId: "thread2"}},
+			},
+		},
+		{
+			LabelsAdded: []*gmail.HistoryLabelAdded{
+				{LabelIds: []string{"STARRED", "Label_12"}, Message: &gmail.Message{Id: "id0", ThreadId: "thread0"}},
+				{LabelIds: []string{"Label_12"}, Message: &gmail.Message{Id: "id3", ThreadId: "thread3"}},
+			},
+		},
+	}
+	testCases := map[string]struct {
+		labelID string
+		added   bool
+		want    []Message
+	}{
+		"Added label returns each message gaining it once": {
+			labelID: "Label_12",
+			added:   true,
+			want:    []Message{{ID: "id0", ThreadID: "thread0"}, {ID: "id3", ThreadID: "thread3"}},
+		},
+		"Removed label returns the messages losing it": {
+			labelID: "INBOX",
+			added:   false,
+			want:    []Message{{ID: "id2", ThreadID: "thread2"}},
+		},
+		"Label without changes returns no messages": {
+			labelID: "INBOX",
+			added:   true,
+			want:    nil,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got := prepareHistoryResp(history, tc.labelID, tc.added)
+
+			if !cmp.Equal(tc.want, got) {
+				t.Errorf("want != got\ndiff=%s", cmp.Diff(tc.want, got))
+			}
+		})
+	}
+}
+
 func TestPrepareConfigRequest(t *testing.T) {
 	t.Parallel()
 
@@ -89,6 +488,42 @@ func TestPrepareConfigRequest(t *testing.T) {
 	}
 }
 
+func TestInitializeConfigRequestsScope(t *testing.T) {
+	t.Parallel()
+
+	credentials := writeCredentials(t, t.TempDir(), "client-a", "secret")
+	testCases := map[string]struct {
+		scope string
+		want  []string
+	}{
+		"Read-only scope by default": {
+			want: []string{gmail.GmailReadonlyScope},
+		},
+		"Modify scope for mailbox actions": {
+			scope: gmail.GmailModifyScope,
+			want:  []string{gmail.GmailModifyScope},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			g := &gmailOAuth2{GmailClientConfig: GmailClientConfig{
+				CredentialsFile: credentials,
+				TokenFile:       "token.json",
+				Scope:           tc.scope,
+				Logger:          log.New(io.Discard, "", 0),
+			}}
+			if err := g.initializeConfig(); err != nil {
+				t.Fatal(err)
+			}
+
+			if !cmp.Equal(tc.want, g.oauthCfg.Scopes) {
+				t.Errorf("want != got\ndiff=%s", cmp.Diff(tc.want, g.oauthCfg.Scopes))
+			}
+		})
+	}
+}
+
 func TestTokenReturnsTokenFromFileWhenFileExists(t *testing.T) {
 	t.Parallel()
 
@@ -110,7 +545,7 @@ func TestTokenReturnsTokenFromFileWhenFileExists(t *testing.T) {
 		},
 	}
 
-	got, err := myOAuth.token()
+	got, _, err := myOAuth.token()
 	if err != nil {
 		t.Errorf("got unexpected error: %s", err)
 	}
@@ -120,6 +555,54 @@ func TestTokenReturnsTokenFromFileWhenFileExists(t *testing.T) {
 	}
 }
 
+func TestSavingTokenSource(t *testing.T) {
+	t.Parallel()
+
+	t.Run("refreshed tokens are saved into the token file", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "token.json")
+		want := &oauth2.Token{AccessToken: "refreshed", RefreshToken: "1//gopher9876"}
+		src := &savingTokenSource{
+			src:    oauth2.StaticTokenSource(want),
+			file:   file,
+			logger: log.New(io.Discard, "", 0),
+			last:   "expired",
+		}
+
+		if _, err := src.Token(); err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		got, err := gmailOAuth2{GmailClientConfig: GmailClientConfig{TokenFile: file}}.localToken()
+		if err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+		if !cmp.Equal(want, got, cmpopts.IgnoreUnexported(oauth2.Token{})) {
+			t.Errorf("want != got\ndiff=%s", cmp.Diff(want, got, cmpopts.IgnoreUnexported(oauth2.Token{})))
+		}
+	})
+
+	t.Run("unwritable token file does not fail the refresh", func(t *testing.T) {
+		logs := &bytes.Buffer{}
+		src := &savingTokenSource{
+			src:    oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "refreshed"}),
+			file:   filepath.Join(t.TempDir(), "missing-dir", "token.json"),
+			logger: log.New(logs, "", 0),
+		}
+
+		tok, err := src.Token()
+		if err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		if tok.AccessToken != "refreshed" {
+			t.Errorf("want the refreshed token, got %q", tok.AccessToken)
+		}
+		if !strings.Contains(logs.String(), "could not save refreshed gmail oauth2 token") {
+			t.Errorf("want the failure to save the token logged, got %q", logs.String())
+		}
+	})
+}
+
 func TestGetAuthCode(t *testing.T) {
 	t.Parallel()
 
@@ -52,3 +52,51 @@ func TestNewGmailClient(t *testing.T) {
 		})
 	}
 }
+
+func TestQuoteQueryValue(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		input string
+		want  string
+	}{
+		"Plain value is left unquoted": {
+			input: "bank.com",
+			want:  "bank.com",
+		},
+		"Value with whitespace is quoted and collapsed": {
+			input: "Your  bill\tis ready",
+			want:  `"Your bill is ready"`,
+		},
+		"Embedded double quotes are replaced": {
+			input: `Re: "urgent" {invoice}`,
+			want:  `"Re: urgent {invoice}"`,
+		},
+		"Braces and parentheses are quoted": {
+			input: "(a|b){c}",
+			want:  `"(a|b){c}"`,
+		},
+		"Leading minus is quoted": {
+			input: "-spam",
+			want:  `"-spam"`,
+		},
+		"Operator word is quoted": {
+			input: "or",
+			want:  `"or"`,
+		},
+		"Empty value is quoted": {
+			input: `""`,
+			want:  `""`,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got := gmailalert.QuoteQueryValue(tc.input)
+
+			if tc.want != got {
+				t.Errorf("want %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
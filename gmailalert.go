@@ -1,44 +1,333 @@
 // Package gmailalert provides types and functions for searching
 // for Gmail messages matching specified criteria and emitting
-// Pushover notifications when matches are found.
+// Pushover notifications when matches are found. Programs using it as a
+// library should prefer the stable API of package
+// github.com/aculclasure/gmailalert/api/v1, since the rest of this package
+// also backs the command line tool and may change.
 package gmailalert
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"log"
 	"os"
+	"strings"
 	"sync"
+	"time"
 )
 
+// Message represents an email message matching a Gmail query.
+//
+// Deprecated: Use the stable v1.Message in package api/v1.
+type Message struct {
+	// The immutable ID of the message.
+	ID string
+	// The ID of the thread the message belongs to.
+	ThreadID string
+	// The date the message was received. It is only populated by a Fetcher.
+	Date time.Time
+	// The value of the message's From header. It is only populated by a
+	// Fetcher.
+	From string
+	// The value of the message's Subject header. It is only populated by a
+	// Fetcher.
+	Subject string
+	// A short part of the message text. It is only populated by a Fetcher.
+	Snippet string
+}
+
 // Matcher is the interface that wraps the Match method
 // used by any types implementing email searching behavior.
+//
+// Deprecated: Use the stable v1.Matcher in package api/v1.
 type Matcher interface {
 	Match(query string) ([]string, error)
 }
 
+// MessageMatcher is the interface that wraps the MatchMessages method used
+// by any Matchers that can return the matching emails as Messages, with
+// their thread IDs or any details they already know, rather than only their
+// IDs. The Alerter uses MatchMessages when its Matcher implements it.
+//
+// Deprecated: Use the stable v1.MessageMatcher in package api/v1.
+type MessageMatcher interface {
+	MatchMessages(query string) ([]Message, error)
+}
+
+// matchMessages returns the emails matching the given query with the given
+// Matcher, using MatchMessages if the Matcher implements MessageMatcher, or
+// else Messages with only their IDs set. An error is returned if the query
+// fails.
+func matchMessages(m Matcher, query string) ([]Message, error) {
+	if mm, ok := m.(MessageMatcher); ok {
+		return mm.MatchMessages(query)
+	}
+	ids, err := m.Match(query)
+	if err != nil {
+		return nil, err
+	}
+	msgs := make([]Message, len(ids))
+	for i, id := range ids {
+		msgs[i] = Message{ID: id}
+	}
+
+	return msgs, nil
+}
+
+// Fetcher is the interface that wraps the Fetch method used by
+// any types implementing retrieval of an email message's details.
+//
+// Deprecated: Use the stable v1.Fetcher in package api/v1.
+type Fetcher interface {
+	Fetch(id string) (Message, error)
+}
+
+// BatchFetcher is the interface that wraps the FetchBatch method used by
+// any types implementing retrieval of the details of several email messages
+// at once. FetchBatch returns the Messages with the given IDs, in order.
+type BatchFetcher interface {
+	FetchBatch(ids []string) ([]Message, error)
+}
+
+// RawFetcher is the interface that wraps the FetchRaw method used by
+// any types implementing retrieval of an email message in its raw,
+// RFC 2822 formatted form.
+//
+// Deprecated: Use the stable v1.RawFetcher in package api/v1.
+type RawFetcher interface {
+	FetchRaw(id string) ([]byte, error)
+}
+
+// LimitedRawFetcher is the interface that wraps the FetchRawLimited method
+// used by any types implementing retrieval of an email message in its raw
+// form within a memory limit. FetchRawLimited returns the message like
+// FetchRaw, but with the bodies of the attachments that do not fit within
+// maxBytes left out.
+type LimitedRawFetcher interface {
+	FetchRawLimited(id string, maxBytes int64) ([]byte, error)
+}
+
 // Notifier is the interface that wraps the Notify method
 // used by any types implementing notification behavior.
+//
+// Deprecated: Use the stable v1.Notifier in package api/v1.
 type Notifier interface {
 	Notify(a Alert) error
 }
 
+// NotifyResult represents the details of a sent notification reported by
+// the notification provider.
+//
+// Deprecated: Use the stable v1.NotifyResult in package api/v1.
+type NotifyResult struct {
+	// The ID the provider assigned to the notification request.
+	RequestID string
+	// The message quota of the provider after the notification was sent.
+	// It is nil if the provider did not report it.
+	Quota *NotifyQuota
+	// The receipts the provider assigned to an emergency notification, one
+	// per recipient, used to check whether it was acknowledged.
+	Receipts []string
+	// The failover channel that delivered the notification, like
+	// "pushover" or "email". It is empty if the notification was not sent
+	// by a FailoverNotifier.
+	Channel string
+}
+
+// lowQuotaShare is the share of a provider's message quota below which
+// the remaining quota is reported as low.
+const lowQuotaShare = 0.1
+
+// NotifyQuota represents the message quota of a notification provider, like
+// the monthly message limit of a Pushover app.
+//
+// Deprecated: Use the stable v1.NotifyQuota in package api/v1.
+type NotifyQuota struct {
+	// The number of messages that can be sent per quota period.
+	Limit int
+	// The number of messages that can still be sent in the current period.
+	Remaining int
+	// The time the current period ends and the quota is reset.
+	Reset time.Time
+}
+
+// low reports whether less than a tenth of the NotifyQuota remains.
+func (q NotifyQuota) low() bool {
+	return q.Limit > 0 && float64(q.Remaining) < lowQuotaShare*float64(q.Limit)
+}
+
+// ResultNotifier is the interface that wraps the NotifyResult method used
+// by any types implementing notification behavior that can report the
+// details of a sent notification.
+//
+// Deprecated: Use the stable v1.ResultNotifier in package api/v1.
+type ResultNotifier interface {
+	NotifyResult(a Alert) (NotifyResult, error)
+}
+
+// Reporter is the interface that wraps the Report method used by
+// any types consuming the Summary of an Alerter run.
+//
+// Deprecated: Use the stable v1.Reporter in package api/v1.
+type Reporter interface {
+	Report(s Summary) error
+}
+
 // Logger represents logger behavior that can be used by
 // the Alerter.
+//
+// Deprecated: Use the stable v1.Logger in package api/v1.
 type Logger interface {
 	Printf(string, ...interface{})
 }
 
+// Compile-time checks that the Matchers, Notifiers, Stores, and Reporters of
+// the package implement the interfaces they are used through.
+var (
+	_ Matcher         = GmailClient{}
+	_ MessageMatcher  = GmailClient{}
+	_ Fetcher         = GmailClient{}
+	_ RawFetcher      = GmailClient{}
+	_ Notifier        = PushoverClient{}
+	_ ResultNotifier  = PushoverClient{}
+	_ ResultNotifier  = HashingNotifier{}
+	_ ResultNotifier  = FailoverNotifier{}
+	_ ContextNotifier = PushoverClient{}
+	_ ContextNotifier = HashingNotifier{}
+	_ ReceiptChecker  = HashingNotifier{}
+	_ ReceiptChecker  = FailoverNotifier{}
+	_ ChannelNotifier = EmailNotifier{}
+	_ ChannelNotifier = WebhookNotifier{}
+	_ Store           = (*State)(nil)
+	_ Reloader        = (*State)(nil)
+	_ AlertStateStore = (*SQLiteStateStore)(nil)
+	_ AlertStateStore = (*RedisStateStore)(nil)
+	_ Reporter        = (*History)(nil)
+	_ Reporter        = (*Webhook)(nil)
+	_ Reporter        = (*Heartbeat)(nil)
+	_ Reporter        = (*Automation)(nil)
+	_ Reporter        = (*Feed)(nil)
+	_ Reporter        = (*MetricsReporter)(nil)
+	_ Reporter        = (*AlertLogs)(nil)
+)
+
 // Alerter is a type that provides behavior for matching emails
 // and sending a notification for any positive match results.
+//
+// Deprecated: Use the stable v1.Alerter in package api/v1.
 type Alerter struct {
 	Matcher  Matcher
 	Notifier Notifier
 	Logger   Logger
+	// ErrorLogger receives the lines about errors and warnings. If nil,
+	// they are written to Logger with the other lines.
+	ErrorLogger Logger
+	// State holds the notification history used for enforcing each
+	// alert's repeat interval. The changes made by the evaluation of an
+	// alert are only committed to State if the evaluation succeeds. If
+	// State is nil, every alert with matches is notified on every run.
+	State Store
+	// Reporters receive the Summary of each run once all alerts have
+	// been processed.
+	Reporters []Reporter
+	// TraceNotifications indicates whether the evaluation ID of an alert is
+	// appended to the message of its notification.
+	TraceNotifications bool
+	// Hooks are called around each stage of the evaluation of every alert.
+	Hooks []Hook
+	// Events receives an Event for each stage of the evaluation of every
+	// alert. If Events is nil, no Events are published.
+	Events *EventBus
+	// Outbox records every notification until it is sent, so that
+	// notifications that could not be sent are retried on the next run. If
+	// Outbox is nil, notifications that could not be sent are lost.
+	Outbox *Outbox
+	// Control is informed about every run of Poll and can request alerts
+	// to be evaluated early. It is optional.
+	Control *Control
+	// LanguageDetector detects the language of matching emails for alerts
+	// that only notify on some languages. If LanguageDetector is nil, a
+	// built-in detector is used.
+	LanguageDetector LanguageDetector
+	// CalendarParser parses the calendars attached to the emails matching
+	// alerts with a calendar. If CalendarParser is nil, a built-in
+	// iCalendar parser is used.
+	CalendarParser CalendarParser
+	// Location is the time zone of the alerts without one of their own. If
+	// Location is nil, the system's local time zone is used.
+	Location *time.Location
+	// Spread is the strategy Poll uses to spread the evaluation of alerts
+	// across their interval. If Spread is empty, alerts are not spread.
+	Spread Spread
+	// DedupWindow is how long after a notification an identical one, with
+	// the same dedup key, is suppressed. It requires State. If DedupWindow
+	// is zero, identical notifications are not suppressed.
+	DedupWindow time.Duration
+	// Concurrency is the maximum number of alerts evaluated at the same
+	// time. If Concurrency is zero, all alerts of a run are evaluated at
+	// the same time.
+	Concurrency int
+	// FetchBatch is the number of emails whose details are fetched with a
+	// single request, like for alerts with a max age, if the Matcher
+	// implements BatchFetcher. If FetchBatch is zero or one, the details of
+	// every email are fetched with a request of their own.
+	FetchBatch int
+	// Retries is the number of times a notification that could not be sent
+	// is sent again before the evaluation of its alert fails.
+	Retries int
+	// Shards is the number of cohorts Poll splits alerts into, evaluating
+	// one cohort per cycle so that every alert is evaluated at least once
+	// per maximum interval. If Shards is zero, every alert is polled at an
+	// adaptive interval of its own.
+	Shards int
+	// Changes remembers the alerts whose last evaluation found no emails, so
+	// that they are skipped while the mailbox has not changed since, if the
+	// Matcher implements HistoryReader. If Changes is nil, every alert is
+	// evaluated on every run.
+	Changes *ChangeTracker
+	// LatencyBudget is how long the evaluation of an alert may take before
+	// a warning is logged, unless the alert has a latency budget of its
+	// own. If LatencyBudget is zero, no warnings are logged.
+	LatencyBudget time.Duration
+	// Breaker skips the evaluation of alerts for a cool-down period once
+	// querying Gmail failed too many times in a row. If Breaker is nil,
+	// every alert is evaluated.
+	Breaker *Breaker
+	// Clock returns the current time. If Clock is nil, time.Now is used.
+	Clock func() time.Time
+	// Sleep blocks Poll until the given time, until a value is received from
+	// the given wake channel, or until the given context is cancelled, in
+	// which case it returns the context's error. It lets Poll run on the
+	// time of Clock, like in a simulation. If Sleep is nil, Poll sleeps in
+	// real time.
+	Sleep func(ctx context.Context, t time.Time, wake <-chan struct{}) error
+	// Logs keeps the lines logged while evaluating each alert. If Logs is
+	// nil, they are only written to Logger.
+	Logs *AlertLogs
+	// Trasher moves the emails matching alerts with the "trash" action to
+	// the trash. It is only needed for such alerts.
+	Trasher Trasher
+	// Unsubscriber unsubscribes from the senders of the emails matching
+	// alerts with the "unsubscribe" action. If Unsubscriber is nil, a
+	// OneClickUnsubscriber with its default HTTP client is used.
+	Unsubscriber Unsubscriber
+	// PanicHandler is called with the value and stack trace of a panic
+	// while evaluating an alert, before the panic goes on. It is optional.
+	PanicHandler func(v any, stack []byte)
+	// Explain indicates whether an Explanation of the evaluation of every
+	// alert is recorded in its AlertResult.
+	Explain bool
+	// explanation is the Explanation recorded during the evaluation of an
+	// alert, if Explain is set.
+	explanation *Explanation
 }
 
 // AlerterOption represents a functional option that can be passed to
 // an Alerter.
+//
+// Deprecated: Use the stable v1.Option in package api/v1.
 type AlerterOption func(a *Alerter)
 
 // WithAlerterLogger accepts a Logger and returns a functional option for
@@ -49,9 +338,97 @@ func WithAlerterLogger(l Logger) AlerterOption {
 	}
 }
 
+// WithAlerterErrorLogger accepts a Logger and returns a functional option
+// for wiring the Logger to an Alerter as the Logger of the lines about
+// errors and warnings.
+func WithAlerterErrorLogger(l Logger) AlerterOption {
+	return func(a *Alerter) {
+		a.ErrorLogger = l
+	}
+}
+
+// WithAlerterState accepts a Store, such as a State, and returns a
+// functional option for wiring the Store to an Alerter.
+func WithAlerterState(s Store) AlerterOption {
+	return func(a *Alerter) {
+		a.State = s
+	}
+}
+
+// WithAlerterReporter accepts a Reporter and returns a functional option
+// for adding the Reporter to an Alerter.
+func WithAlerterReporter(r Reporter) AlerterOption {
+	return func(a *Alerter) {
+		a.Reporters = append(a.Reporters, r)
+	}
+}
+
+// WithAlerterTraceNotifications returns a functional option that makes an
+// Alerter append each alert's evaluation ID to its notification message.
+func WithAlerterTraceNotifications() AlerterOption {
+	return func(a *Alerter) {
+		a.TraceNotifications = true
+	}
+}
+
+// WithAlerterAuditLog accepts an AuditLog and returns a functional option
+// for recording every notification sent by an Alerter in the AuditLog.
+func WithAlerterAuditLog(l *AuditLog) AlerterOption {
+	return WithAlerterHook(l.Hook())
+}
+
+// WithAlerterConcurrency accepts the maximum number of alerts to evaluate at
+// the same time and returns a functional option for setting it on an
+// Alerter.
+func WithAlerterConcurrency(n int) AlerterOption {
+	return func(a *Alerter) {
+		a.Concurrency = n
+	}
+}
+
+// WithAlerterFetchBatch accepts the number of emails to fetch the details
+// of with a single request and returns a functional option for setting it
+// on an Alerter.
+func WithAlerterFetchBatch(n int) AlerterOption {
+	return func(a *Alerter) {
+		a.FetchBatch = n
+	}
+}
+
+// WithAlerterRetries accepts the number of times to send a notification
+// again if it could not be sent and returns a functional option for setting
+// it on an Alerter.
+func WithAlerterRetries(n int) AlerterOption {
+	return func(a *Alerter) {
+		a.Retries = n
+	}
+}
+
+// WithAlerterClock accepts a function returning the current time and returns
+// a functional option for wiring it to an Alerter, so that repeat intervals,
+// dedup windows, and max ages can be evaluated against another clock.
+func WithAlerterClock(now func() time.Time) AlerterOption {
+	return func(a *Alerter) {
+		a.Clock = now
+	}
+}
+
+// WithAlerterSleep accepts a function blocking until a given time, as
+// described by the Sleep field of Alerter, and returns a functional option
+// for wiring it to an Alerter, so that Poll can run on the time of its
+// Clock.
+func WithAlerterSleep(sleep func(ctx context.Context, t time.Time, wake <-chan struct{}) error) AlerterOption {
+	return func(a *Alerter) {
+		a.Sleep = sleep
+	}
+}
+
 // NewAlerter accepts a Matcher, a Notifier, and a slice of AlerterOptions
-// creates a new Alerter struct from them, and returns the Alerter. An
-// error is returned if the Matcher or Notifier arguments are nil.
+// creates a new Alerter struct from them, and returns the Alerter. Unless
+// overridden by the options, the Alerter logs to stdout, evaluates all
+// alerts at the same time, and does not retry notifications. An error is
+// returned if the Matcher or Notifier arguments are nil or the options are
+// invalid.
 func NewAlerter(m Matcher, n Notifier, opts ...AlerterOption) (Alerter, error) {
 	if m == nil || n == nil {
 		return Alerter{}, errors.New("matcher and notifier arguments must not be nil")
@@ -60,53 +437,761 @@ func NewAlerter(m Matcher, n Notifier, opts ...AlerterOption) (Alerter, error) {
 	alerter := Alerter{
 		Matcher:  m,
 		Notifier: n,
-		Logger:   log.New(os.Stdout, "INFO: ", log.LstdFlags),
+		Logger:   newInfoLogger(),
 	}
 	for _, opt := range opts {
 		opt(&alerter)
 	}
+	if err := alerter.ok(); err != nil {
+		return Alerter{}, err
+	}
 
 	return alerter, nil
 }
 
-// Process accepts a slice of Alert structs, processes them concurrently
-// to determine if any emails satisfying the alert criteria are found, and
-// sends a notification if any matches are found. An error is returned if
-// the the Alerter receiver has any nil fields.
+// newInfoLogger returns the Logger an Alerter logs to by default.
+func newInfoLogger() Logger {
+	return log.New(os.Stdout, "INFO: ", log.LstdFlags)
+}
+
+// Process accepts a slice of Alert structs and processes them like Run,
+// discarding the Summary of the run.
+//
+// Deprecated: Use Run, which also returns the Summary of the run.
 func (a Alerter) Process(alerts []Alert) error {
+	_, err := a.Run(alerts)
+	return err
+}
+
+// Run accepts a slice of Alert structs, processes them concurrently
+// to determine if any emails satisfying the alert criteria are found, and
+// sends a notification if any matches are found. If the Alerter has an
+// Outbox, the notifications left in it by previous runs are sent first, and
+// alerts whose notification was among them are not notified again. Alerts
+// that can be suppressed by other alerts are processed after them. Once all
+// alerts are processed, the Summary of the run is passed to any Reporters
+// configured in the Alerter and returned. An error is returned if the the
+// Alerter receiver has any nil fields or if the alerts are suppressed by
+// unknown alerts or by each other in a cycle.
+func (a Alerter) Run(alerts []Alert) (Summary, error) {
+	if err := a.ok(); err != nil {
+		return Summary{}, err
+	}
+	if err := checkDependencies(alerts); err != nil {
+		return Summary{}, err
+	}
+
+	return a.run(alerts), nil
+}
+
+// ok returns an error if the Alerter receiver has any nil fields required
+// for processing alerts, a negative concurrency or number of retries, or a
+// fetch batch larger than maxFetchBatch.
+func (a Alerter) ok() error {
 	if a.Matcher == nil || a.Notifier == nil || a.Logger == nil {
-		return fmt.Errorf("alerter must have non-nil matcher, notifier, and logger fields, got: %+q", a)
+		return fmt.Errorf("alerter must have non-nil matcher, notifier, and logger fields, got: %+v", a)
+	}
+	if a.Concurrency < 0 {
+		return fmt.Errorf("alerter concurrency must not be negative, got %d", a.Concurrency)
+	}
+	if a.Retries < 0 {
+		return fmt.Errorf("alerter retries must not be negative, got %d", a.Retries)
+	}
+	if a.FetchBatch < 0 || a.FetchBatch > maxFetchBatch {
+		return fmt.Errorf("alerter fetch batch must be between 0 and %d, got %d", maxFetchBatch, a.FetchBatch)
 	}
 
-	wg := sync.WaitGroup{}
-	wg.Add(len(alerts))
+	return nil
+}
 
-	for _, alert := range alerts {
-		go func(alt Alert) {
-			defer wg.Done()
-			matches, err := a.Matcher.Match(alt.GmailQuery)
-			if err != nil {
-				a.Logger.Printf("got error searching for email matches: %v", err)
-				return
+// now returns the current time according to the Alerter's Clock.
+func (a Alerter) now() time.Time {
+	if a.Clock == nil {
+		return time.Now()
+	}
+
+	return a.Clock()
+}
+
+// sleep blocks Poll until the given time with the Alerter's Sleep function,
+// or in real time if it has none, as described by Sleep.
+func (a Alerter) sleep(ctx context.Context, t time.Time, wake <-chan struct{}) error {
+	if a.Sleep == nil {
+		return sleepUntil(ctx, t, wake)
+	}
+
+	return a.Sleep(ctx, t, wake)
+}
+
+// run processes the given alerts as a single run, passes the Summary of the
+// run to the Alerter's Reporters, and returns the Summary. Alerts are
+// processed concurrently, up to the Alerter's Concurrency at a time, level
+// by level of their dependencyLevels. Within a level, alerts start in order
+// of their Priority, so that alerts with a higher Priority take the first
+// slots of the Alerter's Concurrency. If the Alerter's State is a Reloader,
+// it is reloaded first, so that the alerts are evaluated with the changes
+// other instances sharing it made.
+func (a Alerter) run(alerts []Alert) Summary {
+	summary := Summary{
+		RunID:   newRunID(),
+		Started: a.now(),
+		Results: make([]AlertResult, len(alerts)),
+	}
+	if r, ok := a.State.(Reloader); ok {
+		if err := r.Reload(); err != nil {
+			a.errorLog().Printf("[run %s] got error reloading state, evaluating alerts with the state loaded last: %v", summary.RunID, err)
+		}
+	}
+	var resumed map[string]error
+	if a.Outbox != nil {
+		resumed = a.resume()
+	}
+	history := a.historyID()
+	var slots chan struct{}
+	if a.Concurrency > 0 {
+		slots = make(chan struct{}, a.Concurrency)
+	}
+	for _, level := range dependencyLevels(alerts) {
+		wg := sync.WaitGroup{}
+		wg.Add(len(level))
+		for _, i := range level {
+			if slots != nil {
+				slots <- struct{}{}
 			}
+			go func(i int, alt Alert) {
+				defer wg.Done()
+				defer a.recoverPanic()
+				if slots != nil {
+					defer func() { <-slots }()
+				}
+				alt.EvalID = evalID(summary.RunID, i)
+				if a.Changes == nil {
+					summary.Results[i] = a.process(alt, resumed)
+					return
+				}
+				var fingerprint string
+				if history != 0 {
+					fingerprint = changeFingerprint(alt, history)
+				}
+				if a.Changes.unchanged(alt.key(), fingerprint) {
+					a.evalLogger(a.Logger, alt).Printf("skipped alert %q, the mailbox has not changed since its last evaluation found no emails",
+						alt.key())
+					summary.Results[i] = AlertResult{Alert: alt.key(), Labels: alt.Labels, EvalID: alt.EvalID, Unchanged: true}
+					return
+				}
+				summary.Results[i] = a.process(alt, resumed)
+				a.Changes.record(alt.key(), fingerprint, summary.Results[i])
+			}(i, alerts[i])
+		}
+		wg.Wait()
+	}
+	summary.Duration = a.now().Sub(summary.Started)
+
+	for _, r := range a.Reporters {
+		if err := r.Report(summary); err != nil {
+			a.errorLog().Printf("[run %s] got error reporting run summary via %T: %v", summary.RunID, r, err)
+		}
+	}
+
+	return summary
+}
+
+// errorLog returns the Logger the Alerter receiver a writes the lines about
+// errors and warnings to, its ErrorLogger if it has one, or else its Logger.
+func (a Alerter) errorLog() Logger {
+	if a.ErrorLogger != nil {
+		return a.ErrorLogger
+	}
 
-			alt.PushoverMsg = fmt.Sprintf(`Found %d emails matching query "%s"`,
-				len(matches), alt.GmailQuery)
-			a.Logger.Printf("%s", alt.PushoverMsg)
+	return a.Logger
+}
+
+// evalLogger returns the given Logger of the Alerter receiver a wrapped for
+// the evaluation of the given Alert, which prefixes every log line with the
+// Alert's evaluation ID and labels, and keeps it in the Alerter's Logs if it
+// has any.
+func (a Alerter) evalLogger(logger Logger, alt Alert) Logger {
+	prefix := "[eval " + alt.EvalID + "] "
+	if len(alt.Labels) > 0 {
+		prefix = "[eval " + alt.EvalID + " " + formatLabels(alt.Labels, "=", " ") + "] "
+	}
+	var l Logger = tracedLogger{l: logger, prefix: prefix}
+	if a.Logs != nil {
+		l = alertLogger{l: l, logs: a.Logs, alert: alt.key(), evalID: alt.EvalID, now: a.now}
+	}
 
-			if len(matches) == 0 {
+	return l
+}
+
+// process searches for emails matching the given Alert and sends a
+// notification if any matches are found, unless the notification was already
+// resent from the Alerter's Outbox with an outcome among the given resumed
+// outcomes. Any errors encountered are logged, prefixed with the Alert's
+// evaluation ID, and the outcome is returned as an AlertResult. The changes
+// made to the Alerter's State by the evaluation are committed together once
+// it ends without an error, and discarded otherwise, so that matches which
+// could not be notified are found again on the next evaluation. They are
+// discarded as well if the notification was skipped because another
+// instance holds the Alerter's Lease, which records them itself.
+func (a Alerter) process(alt Alert, resumed map[string]error) (res AlertResult) {
+	a.Logger, a.ErrorLogger = a.evalLogger(a.Logger, alt), a.evalLogger(a.errorLog(), alt)
+	res = AlertResult{Alert: alt.key(), Labels: alt.Labels, EvalID: alt.EvalID}
+	if a.Explain {
+		a.explanation = &Explanation{}
+		res.Explanation = a.explanation
+	}
+	var timings StageTimings
+	defer func() {
+		res.Timings = timings
+		a.checkLatency(alt, timings)
+	}()
+	res.Unacknowledged = a.trackReceipts(alt)
+	var tx StoreTx
+	var discard bool
+	if a.State != nil {
+		tx = a.State.Begin()
+		defer func() {
+			if res.Err != nil || discard {
+				tx.Rollback()
 				return
 			}
+			if err := tx.Commit(); err != nil {
+				a.errorLog().Printf("got error committing state of alert %q: %v", alt.key(), err)
+				res.Err = err
+			}
+		}()
+	}
+
+	if err := a.beforeQuery(&alt); err != nil {
+		a.errorLog().Printf("%v", err)
+		res.Err = err
+		return res
+	}
+
+	if a.Breaker != nil && !a.Breaker.allow(a.now()) {
+		res.Err = ErrBreakerOpen
+		return res
+	}
+	a.publish(EventQueryStarted, alt, 0, nil)
+	matches, found, err := a.candidates(alt, tx, &timings)
+	a.observeGmail(err)
+	if err != nil {
+		a.errorLog().Printf("%v", err)
+		res.Err = err
+		return res
+	}
+
+	listed := len(matches)
+	done := a.stage(&timings.Filter)
+	matches, err = a.afterQuery(alt, matches)
+	done()
+	if err != nil {
+		a.errorLog().Printf("%v", err)
+		res.Err = err
+		return res
+	}
+	if len(matches) != listed {
+		a.explanation.filtered("hooks", listed, len(matches))
+	}
+	res.Matches, res.Senders = len(matches), messageSenders(matches)
+	if alt.UnreadAbove == 0 && len(matches) != listed {
+		found = len(matches)
+	}
+	estimated := alt.UnreadAbove == 0 && found > len(matches)
+	if estimated {
+		res.Estimated = found
+	}
+
+	alt.Matches = found
+	alt.PushoverMsg = fmt.Sprintf(`Found %s emails %s`, foundText(found, estimated), alt.criteria())
+	done = a.stage(&timings.Fetch)
+	if alt.GroupByDomain && len(matches) > 0 {
+		breakdown, err := a.domainBreakdown(matches)
+		if err != nil {
+			a.errorLog().Printf("got error grouping emails by sender domain, sending notification without a breakdown: %v", err)
+		} else {
+			alt.PushoverMsg += ": " + breakdown
+		}
+	}
+	if alt.Snippet != nil && len(matches) > 0 {
+		snippet, err := a.snippet(alt, matches[0])
+		if err != nil {
+			a.errorLog().Printf("got error reading snippet of most recent email, sending notification without it: %v", err)
+		} else if snippet != "" {
+			alt.PushoverMsg += "\n" + snippet
+		}
+	}
+	if alt.OTP != nil && len(matches) > 0 {
+		// Verification codes are pushed on their own, so that they can be
+		// read at a glance.
+		alt.PushoverMsg = alt.OTP.code(matches[0])
+	}
+	if alt.Calendar != nil && len(matches) > 0 {
+		events, err := a.calendarText(alt, matches)
+		if err != nil {
+			a.errorLog().Printf("got error reading calendar events of matching emails, sending notification without them: %v", err)
+		} else if events != "" {
+			alt.PushoverMsg += "\n" + events
+		}
+	}
+	if alt.Tracking && len(matches) > 0 {
+		links, err := a.trackingText(alt, matches)
+		if err != nil {
+			a.errorLog().Printf("got error finding tracking numbers of matching emails, sending notification without them: %v", err)
+		} else if links != "" {
+			alt.PushoverMsg += "\n" + links
+		}
+	}
+	done()
+	a.Logger.Printf("%s", alt.PushoverMsg)
+	if a.TraceNotifications {
+		alt.PushoverMsg += fmt.Sprintf(" (trace %s)", alt.EvalID)
+	}
+
+	met := "met"
+	if len(matches) == 0 {
+		met = "not met"
+	}
+	if alt.UnreadAbove > 0 {
+		a.explanation.thresholdf("%d unread emails, more than %d needed: %s", found, alt.UnreadAbove, met)
+	} else {
+		a.explanation.thresholdf("%d emails, at least 1 needed: %s", len(matches), met)
+	}
+
+	if len(matches) == 0 {
+		a.explanation.actf("not notified, no emails matched")
+		return res
+	}
+	if alt.Condition != "" {
+		done := a.stage(&timings.Filter)
+		holds, err := a.conditionHolds(alt, found, matches)
+		done()
+		if err != nil {
+			err = fmt.Errorf("got error evaluating condition of alert %q: %w", alt.key(), err)
+			a.errorLog().Printf("%v", err)
+			res.Err = err
+			return res
+		}
+		if !holds {
+			a.Logger.Printf(`notification titled "%s" not sent, condition %q does not hold`, alt.PushoverTitle, alt.Condition)
+			a.explanation.thresholdf("condition %q does not hold", alt.Condition)
+			a.explanation.actf("not notified, condition does not hold")
+			return res
+		}
+		a.explanation.thresholdf("condition %q holds", alt.Condition)
+	}
+	if alt.Script != nil {
+		done := a.stage(&timings.Filter)
+		notify, err := a.runScript(&alt, matches)
+		done()
+		if err != nil {
+			a.errorLog().Printf("%v", err)
+			res.Err = err
+			return res
+		}
+		if !notify {
+			a.Logger.Printf(`notification titled "%s" not sent, decided by script`, alt.PushoverTitle)
+			a.explanation.thresholdf("script decided not to notify")
+			a.explanation.actf("not notified, decided by script")
+			return res
+		}
+		a.explanation.thresholdf("script decided to notify")
+	}
+	a.explanation.route(alt)
+	if len(alt.Actions) > 0 {
+		if err := a.runActions(&alt, matches, tx); err != nil {
+			a.errorLog().Printf("%v", err)
+			res.Err = err
+			return res
+		}
+	}
+	a.publish(EventMatchesFound, alt, len(matches), nil)
+
+	ids := messageIDs(matches)
+	if tx != nil {
+		policy, err := parseRepeatInterval(alt.RepeatInterval)
+		if err != nil {
+			a.errorLog().Printf("got error parsing repeat interval for alert %q: %v", alt.key(), err)
+			res.Err = err
+			return res
+		}
+		if !policy.shouldNotify(tx.Get(alt.key()), ids, a.now()) {
+			a.Logger.Printf(`notification titled "%s" suppressed by repeat interval %q`,
+				alt.PushoverTitle, alt.RepeatInterval)
+			a.explanation.actf("suppressed by repeat interval %q", alt.RepeatInterval)
+			a.publish(EventAlertSuppressed, alt, len(matches), nil)
+			res.Suppressed = true
+			return res
+		}
+	}
+
+	if len(alt.SuppressedBy) > 0 {
+		dep, err := a.suppressingAlert(alt, a.now())
+		if err != nil {
+			a.errorLog().Printf("got error checking alerts suppressing alert %q: %v", alt.key(), err)
+			res.Err = err
+			return res
+		}
+		if dep != "" {
+			a.Logger.Printf(`notification titled "%s" suppressed by recently notified alert %q`,
+				alt.PushoverTitle, dep)
+			a.explanation.actf("suppressed by recently notified alert %q", dep)
+			a.publish(EventAlertSuppressed, alt, len(matches), nil)
+			res.Suppressed = true
+			return res
+		}
+	}
+
+	key := outboxKey(alt.key(), ids)
+	alt.DedupKey = key
+	if err, ok := resumed[key]; ok {
+		a.Logger.Printf(`notification titled "%s" already resent from outbox`, alt.PushoverTitle)
+		res.Notified, res.Err = err == nil, err
+		if err == nil {
+			res.Title, res.Message, res.MessageIDs = alt.PushoverTitle, alt.PushoverMsg, ids
+		}
+		return res
+	}
+	if a.duplicate(alt, a.now()) {
+		a.Logger.Printf(`notification titled "%s" suppressed as identical to one sent within %s`,
+			alt.PushoverTitle, a.DedupWindow)
+		a.explanation.actf("suppressed as identical to a notification sent within %s", a.DedupWindow)
+		a.publish(EventAlertSuppressed, alt, len(matches), nil)
+		res.Suppressed = true
+		return res
+	}
+
+	if alt.AttachImage {
+		done := a.stage(&timings.Fetch)
+		alt.Attachment, err = a.image(alt, matches[0])
+		done()
+		if err != nil {
+			a.errorLog().Printf("got error attaching image to notification, sending it without one: %v", err)
+		}
+	}
+
+	if err := a.beforeNotify(&alt); err != nil {
+		if errors.Is(err, ErrSkipNotification) {
+			a.Logger.Printf(`notification titled "%s" suppressed by hook`, alt.PushoverTitle)
+			a.explanation.actf("suppressed by hook")
+			a.publish(EventAlertSuppressed, alt, len(matches), nil)
+			res.Suppressed = true
+			discard = errors.Is(err, ErrNotLeaseHolder)
+			return res
+		}
+		a.errorLog().Printf("%v", err)
+		res.Err = err
+		return res
+	}
+
+	if a.Outbox != nil {
+		err := a.Outbox.Add(OutboxEntry{
+			Key:        key,
+			EvalID:     alt.EvalID,
+			Alert:      alt,
+			MessageIDs: ids,
+			Queued:     a.now(),
+			Attempts:   1,
+		})
+		if err != nil {
+			a.errorLog().Printf("got error recording notification in outbox: %v", err)
+		}
+	}
+
+	done = a.stage(&timings.Notify)
+	result, err := a.notify(alt)
+	done()
+	a.afterNotify(alt, result, err)
+	if err != nil {
+		a.errorLog().Printf("got error sending notification: %v", err)
+		if failed := failedRecipients(err); len(failed) > 0 && a.Outbox != nil {
+			a.keepFailedRecipients(key, failed)
+		}
+		a.publish(EventNotifyFailed, alt, len(matches), err)
+		res.Err = err
+		return res
+	}
+	a.publish(EventNotifySent, alt, len(matches), nil)
+	a.Logger.Printf(`notification titled "%s" successfully sent via %T`,
+		alt.PushoverTitle, a.Notifier)
+	if result.Channel != "" {
+		a.Logger.Printf("notification delivered via the %s channel", result.Channel)
+	}
+	res.Notified, res.Quota, res.Channel = true, result.Quota, result.Channel
+	res.Title, res.Message, res.MessageIDs = alt.PushoverTitle, alt.PushoverMsg, ids
+	if q := result.Quota; q != nil && q.low() {
+		a.errorLog().Printf("warning: only %d of %d notification messages remain until the quota resets at %s",
+			q.Remaining, q.Limit, q.Reset.Format(time.RFC3339))
+	}
+
+	if a.Outbox != nil {
+		if err := a.Outbox.Remove(key); err != nil {
+			a.errorLog().Printf("got error removing notification from outbox: %v", err)
+		}
+	}
+
+	if tx != nil {
+		st := tx.Get(alt.key())
+		st.Notified, st.MessageIDs = a.now(), ids
+		st = recordReceipts(st, result.Receipts, st.Notified)
+		tx.Set(alt.key(), a.recordSent(st, key, st.Notified))
+		res.Unacknowledged += len(result.Receipts)
+	}
+
+	return res
+}
+
+// match returns the messages the given Alert is triggered by: the messages
+// that gained or lost its label since its last evaluation if it watches a
+// label, a message standing for its overflowing label if it has an unread
+// threshold, or the messages matching its Gmail query otherwise. The number
+// of unread emails counted for an unread threshold is returned as well.
+// Changes to the Alert's state are made with the given StoreTx, which is nil
+// if the Alerter has no State.
+func (a Alerter) match(alt Alert, tx StoreTx) ([]Message, int, error) {
+	if label, added, ok := alt.labelWatch(); ok {
+		msgs, err := a.labelChanges(tx, alt, label, added)
+		return msgs, len(msgs), err
+	}
+	if alt.UnreadAbove > 0 {
+		return a.unreadOverflow(tx, alt)
+	}
+
+	now := a.now().In(a.location(alt))
+	alt.GmailQuery = expandQueryDates(alt.GmailQuery, now)
+	if alt.Queries != nil {
+		queries := alt.Queries.withQueryDates(now)
+		alt.Queries = &queries
+	}
+
+	return matchEstimate(a.Matcher, alt)
+}
 
+// notify sends a notification for the given Alert with the Alerter's
+// Notifier, sending it again up to the Alerter's Retries times if it could
+// not be sent. A retry only goes to the recipients the previous attempt
+// failed for, so that the others are not notified twice. If the Notifier
+// implements ResultNotifier, the details of the sent notifications are
+// returned, merged over the attempts.
+func (a Alerter) notify(alt Alert) (NotifyResult, error) {
+	var res NotifyResult
+	var err error
+	for attempt := 0; attempt <= a.Retries; attempt++ {
+		if attempt > 0 {
+			a.errorLog().Printf("got error sending notification, retrying (%d/%d): %v", attempt, a.Retries, err)
+		}
+		var sent NotifyResult
+		if rn, ok := a.Notifier.(ResultNotifier); ok {
+			sent, err = rn.NotifyResult(alt)
+		} else {
 			err = a.Notifier.Notify(alt)
+		}
+		res = res.merge(sent)
+		if err == nil {
+			return res, nil
+		}
+		if failed := failedRecipients(err); len(failed) > 0 {
+			alt.PushoverTarget, alt.PushoverTargets = "", failed
+		}
+	}
+
+	return res, err
+}
+
+// merge returns the NotifyResult receiver r combined with the given
+// NotifyResult of a later notification attempt, keeping the request IDs and
+// receipts of both and the latest quota and channel.
+func (r NotifyResult) merge(later NotifyResult) NotifyResult {
+	if later.RequestID != "" {
+		if r.RequestID != "" {
+			r.RequestID += ","
+		}
+		r.RequestID += later.RequestID
+	}
+	r.Receipts = append(r.Receipts, later.Receipts...)
+	if later.Quota != nil {
+		r.Quota = later.Quota
+	}
+	if later.Channel != "" {
+		r.Channel = later.Channel
+	}
+
+	return r
+}
+
+// image accepts an Alert and its most recent matching message, fetches the
+// raw message, and returns its first image that is within the Alert's
+// attachment size limit. A nil Attachment is returned if the message has no
+// such image. An error is returned if the Alerter's Matcher does not
+// implement RawFetcher or if there is a problem fetching or parsing the
+// message.
+func (a Alerter) image(alt Alert, msg Message) (*Attachment, error) {
+	fetcher, ok := a.Matcher.(RawFetcher)
+	if !ok {
+		return nil, fmt.Errorf("matcher %T must implement RawFetcher to attach images", a.Matcher)
+	}
+
+	raw, err := fetchRaw(fetcher, alt, msg.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	data, mediaType, err := firstImage(bytes.NewReader(raw), alt.attachmentMaxBytes())
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		a.Logger.Printf("no image of at most %d bytes found in message %s", alt.attachmentMaxBytes(), msg.ID)
+		return nil, nil
+	}
+
+	return &Attachment{MediaType: mediaType, Data: data}, nil
+}
+
+// candidates accepts an Alert and returns the messages matching it once its
+// max age and languages are applied, along with the number of emails found
+// as returned by match, which makes changes to the Alert's state with the
+// given StoreTx. The time spent searching and filtering is added to the
+// given StageTimings. An error is returned if there is a problem searching
+// for matches or applying the max age or languages.
+func (a Alerter) candidates(alt Alert, tx StoreTx, timings *StageTimings) ([]Message, int, error) {
+	done := a.stage(&timings.Query)
+	matches, found, err := a.match(alt, tx)
+	done()
+	if err != nil {
+		return nil, 0, fmt.Errorf("got error searching for email matches: %w", err)
+	}
+	defer a.stage(&timings.Filter)()
+	listed := len(matches)
+	a.explanation.searched(alt.criteria(), listed, found)
+
+	if alt.MaxAge != "" && len(matches) > 0 {
+		before := len(matches)
+		matches, err = a.recent(alt, matches)
+		if err != nil {
+			return nil, 0, fmt.Errorf("got error applying max age to alert %q: %w", alt.key(), err)
+		}
+		a.explanation.filtered("max age "+alt.MaxAge, before, len(matches))
+	}
+
+	if len(alt.Languages) > 0 && len(matches) > 0 {
+		before := len(matches)
+		matches, err = a.inLanguages(alt, matches)
+		if err != nil {
+			return nil, 0, fmt.Errorf("got error filtering emails of alert %q by language: %w", alt.key(), err)
+		}
+		a.explanation.filtered("languages "+strings.Join(alt.Languages, ", "), before, len(matches))
+	}
+
+	if alt.OTP != nil && len(matches) > 0 {
+		before := len(matches)
+		matches, err = a.withCodes(alt, matches)
+		if err != nil {
+			return nil, 0, fmt.Errorf("got error extracting verification codes of alert %q: %w", alt.key(), err)
+		}
+		a.explanation.filtered("verification codes", before, len(matches))
+	}
+
+	if alt.Calendar != nil && alt.Calendar.Within != "" && len(matches) > 0 {
+		before := len(matches)
+		matches, err = a.withUpcomingEvents(alt, matches)
+		if err != nil {
+			return nil, 0, fmt.Errorf("got error filtering emails of alert %q by calendar events: %w", alt.key(), err)
+		}
+		a.explanation.filtered("calendar events within "+alt.Calendar.Within, before, len(matches))
+	}
+	// An estimate of the emails found no longer holds once some were
+	// filtered out.
+	if alt.UnreadAbove == 0 && len(matches) != listed {
+		found = len(matches)
+	}
+
+	return matches, found, nil
+}
+
+// recent accepts an Alert with a max age and the messages matching the Alert,
+// fetches the details of each message, and returns the messages that are
+// not older than the max age. An error is returned if the max age is invalid,
+// if the Alerter's Matcher does not implement Fetcher, or if there is a
+// problem fetching a message's details.
+func (a Alerter) recent(alt Alert, matches []Message) ([]Message, error) {
+	maxAge, err := time.ParseDuration(alt.MaxAge)
+	if err != nil {
+		return nil, fmt.Errorf("got error parsing max age %q: %v", alt.MaxAge, err)
+	}
+
+	fetcher, ok := a.Matcher.(Fetcher)
+	if !ok {
+		return nil, fmt.Errorf("matcher %T must implement Fetcher to apply a max age", a.Matcher)
+	}
+
+	detailed, err := a.fetchDetails(fetcher, matches)
+	if err != nil {
+		return nil, err
+	}
+
+	kept := filterByAge(detailed, maxAge, a.now())
+	if ignored := len(detailed) - len(kept); ignored > 0 {
+		a.Logger.Printf("ignored %d emails older than %s matching query %q",
+			ignored, alt.MaxAge, alt.GmailQuery)
+	}
+
+	return kept, nil
+}
+
+// fetchDetails fetches the details of the given messages with the given
+// Fetcher, in batches of the Alerter's FetchBatch if the Fetcher implements
+// BatchFetcher, and returns them in order. An error is returned if there is
+// a problem fetching a message's details.
+func (a Alerter) fetchDetails(fetcher Fetcher, msgs []Message) ([]Message, error) {
+	detailed := make([]Message, 0, len(msgs))
+	if bf, ok := fetcher.(BatchFetcher); ok && a.FetchBatch > 1 {
+		for start := 0; start < len(msgs); start += a.FetchBatch {
+			end := start + a.FetchBatch
+			if end > len(msgs) {
+				end = len(msgs)
+			}
+			batch, err := bf.FetchBatch(messageIDs(msgs[start:end]))
 			if err != nil {
-				a.Logger.Printf("got error sending notification: %v", err)
-				return
+				return nil, err
 			}
-			a.Logger.Printf(`notification titled "%s" successfully sent via %T`,
-				alt.PushoverTitle, a.Notifier)
-		}(alert)
+			detailed = append(detailed, batch...)
+		}
+		return detailed, nil
 	}
-	wg.Wait()
-	return nil
+
+	for _, m := range msgs {
+		msg, err := fetcher.Fetch(m.ID)
+		if err != nil {
+			return nil, err
+		}
+		detailed = append(detailed, msg)
+	}
+
+	return detailed, nil
+}
+
+// filterByAge returns the messages whose date is not older than maxAge
+// relative to now.
+func filterByAge(msgs []Message, maxAge time.Duration, now time.Time) []Message {
+	cutoff := now.Add(-maxAge)
+	kept := make([]Message, 0, len(msgs))
+	for _, m := range msgs {
+		if m.Date.Before(cutoff) {
+			continue
+		}
+		kept = append(kept, m)
+	}
+
+	return kept
+}
+
+// messageIDs returns the IDs of the given messages.
+func messageIDs(msgs []Message) []string {
+	ids := make([]string, 0, len(msgs))
+	for _, m := range msgs {
+		ids = append(ids, m.ID)
+	}
+
+	return ids
 }
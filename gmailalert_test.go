@@ -5,12 +5,15 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"path/filepath"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/aculclasure/gmailalert"
+	"github.com/google/go-cmp/cmp"
 )
 
 var (
@@ -45,6 +48,34 @@ func TestNewAlerter(t *testing.T) {
 			t.Errorf(`Want logs to contain "hello", got: %s`, gotLogs)
 		}
 	})
+
+	t.Run("Negative concurrency or retries returns error", func(t *testing.T) {
+		_, err := gmailalert.NewAlerter(fakeMatcher{}, fakeNotifier{}, gmailalert.WithAlerterConcurrency(-1))
+		if err == nil {
+			t.Errorf("wanted an error for negative concurrency but did not get one")
+		}
+
+		_, err = gmailalert.NewAlerter(fakeMatcher{}, fakeNotifier{}, gmailalert.WithAlerterRetries(-1))
+		if err == nil {
+			t.Errorf("wanted an error for negative retries but did not get one")
+		}
+	})
+
+	t.Run("Wire in concurrency, retries, and a clock", func(t *testing.T) {
+		now := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+		alerter, err := gmailalert.NewAlerter(fakeMatcher{}, fakeNotifier{},
+			gmailalert.WithAlerterConcurrency(2),
+			gmailalert.WithAlerterRetries(3),
+			gmailalert.WithAlerterClock(func() time.Time { return now }))
+		if err != nil {
+			t.Fatalf("did not want an error but got one: %v", err)
+		}
+
+		if alerter.Concurrency != 2 || alerter.Retries != 3 || !alerter.Clock().Equal(now) {
+			t.Errorf("want concurrency 2, retries 3, and clock at %s, got %d, %d, and %s",
+				now, alerter.Concurrency, alerter.Retries, alerter.Clock())
+		}
+	})
 }
 
 func TestProcess(t *testing.T) {
@@ -103,7 +134,7 @@ func TestProcess(t *testing.T) {
 	t.Run("error during notification sending is logged", func(t *testing.T) {
 		spyLog := &spyLogger{}
 		alt := gmailalert.Alerter{
-			Matcher:  fakeMatcher{matches: []string{"matching-email"}},
+			Matcher:  fakeMatcher{matches: []gmailalert.Message{{ID: "matching-email"}}},
 			Notifier: fakeNotifier{err: errSendingNotification},
 			Logger:   spyLog,
 		}
@@ -119,11 +150,98 @@ func TestProcess(t *testing.T) {
 		}
 	})
 
+	t.Run("notification that could not be sent is retried", func(t *testing.T) {
+		mockNotif := &mockNotifier{errResponses: []error{errSendingNotification, nil}}
+		reporter := &spyReporter{}
+		alt := gmailalert.Alerter{
+			Matcher:   fakeMatcher{matches: []gmailalert.Message{{ID: "matching-email"}}},
+			Notifier:  mockNotif,
+			Logger:    &spyLogger{},
+			Reporters: []gmailalert.Reporter{reporter},
+			Retries:   1,
+		}
+
+		err := alt.Process([]gmailalert.Alert{{GmailQuery: "is:unread"}})
+		if err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		if mockNotif.next != 2 {
+			t.Errorf("wanted 2 notification attempts, got %d", mockNotif.next)
+		}
+		if !reporter.summaries[0].Results[0].Notified {
+			t.Errorf("wanted the retried notification to be sent, got %+v", reporter.summaries[0].Results[0])
+		}
+	})
+
+	t.Run("notification retry only goes to the recipients that failed", func(t *testing.T) {
+		notif := &partialNotifier{failures: map[string]int{"bob": 1}}
+		alt := gmailalert.Alerter{
+			Matcher:  fakeMatcher{matches: []gmailalert.Message{{ID: "matching-email"}}},
+			Notifier: notif,
+			Logger:   &spyLogger{},
+			Retries:  1,
+		}
+
+		err := alt.Process([]gmailalert.Alert{{GmailQuery: "is:unread", PushoverTarget: "alice", PushoverTargets: []string{"bob"}}})
+		if err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		want := [][]string{{"alice", "bob"}, {"bob"}}
+		if !cmp.Equal(want, notif.calls) {
+			t.Errorf("want != got\ndiff=%s", cmp.Diff(want, notif.calls))
+		}
+	})
+
+	t.Run("alerts are evaluated up to the concurrency at a time", func(t *testing.T) {
+		matcher := &concurrencyMatcher{}
+		alt := gmailalert.Alerter{
+			Matcher:     matcher,
+			Notifier:    fakeNotifier{},
+			Logger:      &spyLogger{},
+			Concurrency: 2,
+		}
+		alerts := make([]gmailalert.Alert, 6)
+		for i := range alerts {
+			alerts[i].GmailQuery = fmt.Sprintf("subject:%d", i)
+		}
+
+		err := alt.Process(alerts)
+		if err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		if matcher.max > 2 {
+			t.Errorf("wanted at most 2 alerts evaluated at a time, got %d", matcher.max)
+		}
+	})
+
+	t.Run("low notification quota is logged as a warning", func(t *testing.T) {
+		logs := &bytes.Buffer{}
+		alt := gmailalert.Alerter{
+			Matcher: fakeMatcher{matches: []gmailalert.Message{{ID: "matching-email"}}},
+			Notifier: fakeResultNotifier{result: gmailalert.NotifyResult{
+				Quota: &gmailalert.NotifyQuota{Limit: 10000, Remaining: 500},
+			}},
+			Logger: log.New(logs, "", 0),
+		}
+
+		err := alt.Process([]gmailalert.Alert{{GmailQuery: "is:unread"}})
+		if err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		if !strings.Contains(logs.String(), "warning: only 500 of 10000 notification messages remain") {
+			t.Errorf("want a low quota warning to be logged, got:\n%s", logs.String())
+		}
+	})
+
 	t.Run("successful single notification", func(t *testing.T) {
 		spyLog := &spyLogger{}
 		spyNotif := &spyNotifier{}
 		alt := gmailalert.Alerter{
-			Matcher:  fakeMatcher{matches: []string{"matching-email"}},
+			Matcher:  fakeMatcher{matches: []gmailalert.Message{{ID: "matching-email"}}},
 			Notifier: spyNotif,
 			Logger:   spyLog,
 		}
@@ -148,7 +266,7 @@ func TestProcess(t *testing.T) {
 		spyLog := &spyLogger{}
 		spyNotif := &spyNotifier{}
 		alt := gmailalert.Alerter{
-			Matcher:  fakeMatcher{matches: []string{"matching-email1", "matching-email2"}},
+			Matcher:  fakeMatcher{matches: []gmailalert.Message{{ID: "matching-email1"}, {ID: "matching-email2"}}},
 			Notifier: spyNotif,
 			Logger:   spyLog,
 		}
@@ -172,13 +290,269 @@ func TestProcess(t *testing.T) {
 		}
 	})
 
+	t.Run("previously notified matches are suppressed by repeat interval", func(t *testing.T) {
+		state, err := gmailalert.LoadState(filepath.Join(t.TempDir(), "state.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		state.Set("unread", gmailalert.AlertState{Notified: time.Now(), MessageIDs: []string{"matching-email1"}})
+		spyNotif := &spyNotifier{}
+		alt := gmailalert.Alerter{
+			Matcher:  fakeMatcher{matches: []gmailalert.Message{{ID: "matching-email1"}}},
+			Notifier: spyNotif,
+			Logger:   &spyLogger{},
+			State:    state,
+		}
+		alerts := []gmailalert.Alert{
+			{Name: "unread", GmailQuery: "is:unread", RepeatInterval: "once"},
+			{Name: "from", GmailQuery: "from:someone", RepeatInterval: "once"},
+		}
+
+		err = alt.Process(alerts)
+		if err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		if spyNotif.numCalls != 1 {
+			t.Fatalf("wanted 1 notification to be sent, got %d", spyNotif.numCalls)
+		}
+
+		got := state.Get("from").MessageIDs
+		if len(got) != 1 || got[0] != "matching-email1" {
+			t.Fatalf(`wanted state for alert "from" to record notified message, got %v`, got)
+		}
+	})
+
+	t.Run("matches older than max age are ignored", func(t *testing.T) {
+		spyNotif := &spyNotifier{}
+		alt := gmailalert.Alerter{
+			Matcher: fakeFetcher{
+				fakeMatcher: fakeMatcher{matches: []gmailalert.Message{{ID: "old"}}},
+				msgs: map[string]gmailalert.Message{
+					"old": {ID: "old", Date: time.Now().Add(-48 * time.Hour)},
+				},
+			},
+			Notifier: spyNotif,
+			Logger:   &spyLogger{},
+		}
+		alerts := []gmailalert.Alert{{GmailQuery: "is:unread", MaxAge: "24h"}}
+
+		err := alt.Process(alerts)
+		if err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		if spyNotif.numCalls != 0 {
+			t.Fatalf("wanted 0 notifications to be sent, got %d", spyNotif.numCalls)
+		}
+	})
+
+	t.Run("matches within max age are notified", func(t *testing.T) {
+		spyNotif := &spyNotifier{}
+		alt := gmailalert.Alerter{
+			Matcher: fakeFetcher{
+				fakeMatcher: fakeMatcher{matches: []gmailalert.Message{{ID: "old"}, {ID: "new"}}},
+				msgs: map[string]gmailalert.Message{
+					"old": {ID: "old", Date: time.Now().Add(-48 * time.Hour)},
+					"new": {ID: "new", Date: time.Now().Add(-time.Hour)},
+				},
+			},
+			Notifier: spyNotif,
+			Logger:   &spyLogger{},
+		}
+		alerts := []gmailalert.Alert{{GmailQuery: "is:unread", MaxAge: "24h"}}
+
+		err := alt.Process(alerts)
+		if err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		if spyNotif.numCalls != 1 {
+			t.Fatalf("wanted 1 notification to be sent, got %d", spyNotif.numCalls)
+		}
+	})
+
+	t.Run("max age with a matcher that cannot fetch messages is logged", func(t *testing.T) {
+		spyLog := &spyLogger{}
+		alt := gmailalert.Alerter{
+			Matcher:  fakeMatcher{matches: []gmailalert.Message{{ID: "matching-email1"}}},
+			Notifier: fakeNotifier{},
+			Logger:   spyLog,
+		}
+		alerts := []gmailalert.Alert{{GmailQuery: "is:unread", MaxAge: "24h"}}
+
+		err := alt.Process(alerts)
+		if err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		if spyLog.numErrCalls != 1 {
+			t.Fatalf("wanted 1 error to be logged, got %d", spyLog.numErrCalls)
+		}
+	})
+
+	t.Run("first image of the most recent match is attached", func(t *testing.T) {
+		recNotif := &recordingNotifier{}
+		alt := gmailalert.Alerter{
+			Matcher: fakeRawFetcher{
+				fakeMatcher: fakeMatcher{matches: []gmailalert.Message{{ID: "new"}, {ID: "old"}}},
+				raw: map[string][]byte{
+					"new": []byte("Content-Type: image/gif\r\nContent-Transfer-Encoding: base64\r\n\r\nR0lGODlh\r\n"),
+				},
+			},
+			Notifier: recNotif,
+			Logger:   &spyLogger{},
+		}
+		alerts := []gmailalert.Alert{{GmailQuery: "is:unread", AttachImage: true}}
+
+		err := alt.Process(alerts)
+		if err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		if len(recNotif.alerts) != 1 {
+			t.Fatalf("wanted 1 notification to be sent, got %d", len(recNotif.alerts))
+		}
+		want := &gmailalert.Attachment{MediaType: "image/gif", Data: []byte("GIF89a")}
+		got := recNotif.alerts[0].Attachment
+		if !cmp.Equal(want, got) {
+			t.Errorf("want != got\ndiff=%s", cmp.Diff(want, got))
+		}
+	})
+
+	t.Run("failure to attach an image is logged and the notification is still sent", func(t *testing.T) {
+		spyLog := &spyLogger{}
+		recNotif := &recordingNotifier{}
+		alt := gmailalert.Alerter{
+			Matcher:  fakeMatcher{matches: []gmailalert.Message{{ID: "matching-email1"}}},
+			Notifier: recNotif,
+			Logger:   spyLog,
+		}
+		alerts := []gmailalert.Alert{{GmailQuery: "is:unread", AttachImage: true}}
+
+		err := alt.Process(alerts)
+		if err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		if spyLog.numErrCalls != 1 {
+			t.Fatalf("wanted 1 error to be logged, got %d", spyLog.numErrCalls)
+		}
+		if len(recNotif.alerts) != 1 || recNotif.alerts[0].Attachment != nil {
+			t.Fatalf("wanted 1 notification without attachment to be sent, got %+v", recNotif.alerts)
+		}
+	})
+
+	t.Run("reporters receive the run summary", func(t *testing.T) {
+		spyRep := &spyReporter{}
+		alt := gmailalert.Alerter{
+			Matcher:   fakeMatcher{matches: []gmailalert.Message{{ID: "matching-email1"}}},
+			Notifier:  fakeNotifier{},
+			Logger:    &spyLogger{},
+			Reporters: []gmailalert.Reporter{spyRep},
+		}
+		alerts := []gmailalert.Alert{
+			{Name: "unread", GmailQuery: "is:unread"},
+			{Name: "from", GmailQuery: "from:someone"},
+		}
+
+		err := alt.Process(alerts)
+		if err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		if len(spyRep.summaries) != 1 {
+			t.Fatalf("wanted 1 summary to be reported, got %d", len(spyRep.summaries))
+		}
+		got := spyRep.summaries[0]
+		if len(got.Results) != 2 || got.Notified() != 2 || got.Matches() != 2 {
+			t.Fatalf("wanted 2 notified results with 2 matches, got %+v", got)
+		}
+		if got.Results[0].Alert != "unread" || got.Results[1].Alert != "from" {
+			t.Fatalf("wanted results in alert order, got %+v", got.Results)
+		}
+	})
+
+	t.Run("log lines and results carry the evaluation ID", func(t *testing.T) {
+		logDest := &bytes.Buffer{}
+		spyRep := &spyReporter{}
+		alt := gmailalert.Alerter{
+			Matcher:   fakeMatcher{},
+			Notifier:  fakeNotifier{},
+			Logger:    log.New(logDest, "", 0),
+			Reporters: []gmailalert.Reporter{spyRep},
+		}
+
+		err := alt.Process([]gmailalert.Alert{{GmailQuery: "is:unread"}})
+		if err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		summary := spyRep.summaries[0]
+		wantEvalID := summary.RunID + ".0"
+		if summary.Results[0].EvalID != wantEvalID {
+			t.Fatalf("want eval ID %q, got %q", wantEvalID, summary.Results[0].EvalID)
+		}
+		if !strings.HasPrefix(logDest.String(), "[eval "+wantEvalID+"] ") {
+			t.Fatalf("want log lines prefixed with eval ID %q, got: %s", wantEvalID, logDest.String())
+		}
+	})
+
+	t.Run("trace notifications appends the evaluation ID to the message", func(t *testing.T) {
+		recNotif := &recordingNotifier{}
+		alt := gmailalert.Alerter{
+			Matcher:            fakeMatcher{matches: []gmailalert.Message{{ID: "matching-email1"}}},
+			Notifier:           recNotif,
+			Logger:             &spyLogger{},
+			TraceNotifications: true,
+		}
+
+		err := alt.Process([]gmailalert.Alert{{GmailQuery: "is:unread"}})
+		if err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		got := recNotif.alerts[0]
+		if !strings.HasSuffix(got.PushoverMsg, " (trace "+got.EvalID+")") {
+			t.Fatalf("want message to end with the eval ID %q, got %q", got.EvalID, got.PushoverMsg)
+		}
+	})
+
+	t.Run("sent notifications are written to the audit log", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "audit.jsonl")
+		auditLog, err := gmailalert.NewAuditLog(gmailalert.AuditConfig{File: file})
+		if err != nil {
+			t.Fatal(err)
+		}
+		alt := gmailalert.Alerter{
+			Matcher:  fakeMatcher{matches: []gmailalert.Message{{ID: "matching-email1"}}},
+			Notifier: fakeResultNotifier{result: gmailalert.NotifyResult{RequestID: "req-123"}},
+			Logger:   &spyLogger{},
+			Hooks:    []gmailalert.Hook{auditLog.Hook()},
+		}
+		alerts := []gmailalert.Alert{{Name: "bills", GmailQuery: "is:unread", PushoverTarget: "user1"}}
+
+		err = alt.Process(alerts)
+		if err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		got := readAuditRecords(t, file)
+		if len(got) != 1 {
+			t.Fatalf("wanted 1 audit record, got %d", len(got))
+		}
+		if got[0].Alert != "bills" || got[0].Target != "user1" || got[0].ResponseID != "req-123" {
+			t.Fatalf("got unexpected audit record %+v", got[0])
+		}
+	})
+
 	t.Run("mixed successful and failed notifications", func(t *testing.T) {
 		spyLog := &spyLogger{}
 		mockNotif := &mockNotifier{
 			errResponses: []error{errSendingNotification, nil, errSendingNotification, nil},
 		}
 		alt := gmailalert.Alerter{
-			Matcher:  fakeMatcher{matches: []string{"matching-email1"}},
+			Matcher:  fakeMatcher{matches: []gmailalert.Message{{ID: "matching-email1"}}},
 			Notifier: mockNotif,
 			Logger:   spyLog,
 		}
@@ -208,15 +582,60 @@ func TestProcess(t *testing.T) {
 // Matcher interface. It's match method simply returns the matches
 // and err values that the fakeMatcher struct was created with.
 type fakeMatcher struct {
-	matches []string
+	matches []gmailalert.Message
 	err     error
 }
 
-// Match returns the matches and err fields of the receiver f.
+// Match returns the IDs of the matches and the err field of the receiver f.
 func (f fakeMatcher) Match(_ string) ([]string, error) {
+	ids := make([]string, len(f.matches))
+	for i, m := range f.matches {
+		ids[i] = m.ID
+	}
+	return ids, f.err
+}
+
+// MatchMessages returns the matches and err fields of the receiver f.
+func (f fakeMatcher) MatchMessages(_ string) ([]gmailalert.Message, error) {
 	return f.matches, f.err
 }
 
+// fakeFetcher represents a test double type that implements the
+// Matcher and Fetcher interfaces. Its Fetch method returns the message
+// stored under the given ID in the msgs field.
+type fakeFetcher struct {
+	fakeMatcher
+	msgs map[string]gmailalert.Message
+}
+
+// Fetch returns the message stored under id in the msgs field of the
+// receiver f, or an error if no message is stored under id.
+func (f fakeFetcher) Fetch(id string) (gmailalert.Message, error) {
+	m, ok := f.msgs[id]
+	if !ok {
+		return gmailalert.Message{}, errFetchingMail
+	}
+	return m, nil
+}
+
+// fakeRawFetcher represents a test double type that implements the
+// Matcher and RawFetcher interfaces. Its FetchRaw method returns the raw
+// message stored under the given ID in the raw field.
+type fakeRawFetcher struct {
+	fakeMatcher
+	raw map[string][]byte
+}
+
+// FetchRaw returns the raw message stored under id in the raw field of the
+// receiver f, or an error if no message is stored under id.
+func (f fakeRawFetcher) FetchRaw(id string) ([]byte, error) {
+	b, ok := f.raw[id]
+	if !ok {
+		return nil, errFetchingMail
+	}
+	return b, nil
+}
+
 // fakeNotifier represents a test double type that implements the
 // Notifier interface. It's Notify method simply returns the err
 // value that the fakeNotifier struct was created with.
@@ -229,6 +648,24 @@ func (f fakeNotifier) Notify(_ gmailalert.Alert) error {
 	return f.err
 }
 
+// fakeResultNotifier represents a test double type that implements the
+// Notifier and ResultNotifier interfaces. Its methods simply return the
+// result and err values that the fakeResultNotifier was created with.
+type fakeResultNotifier struct {
+	result gmailalert.NotifyResult
+	err    error
+}
+
+// Notify returns the err field of the receiver f.
+func (f fakeResultNotifier) Notify(_ gmailalert.Alert) error {
+	return f.err
+}
+
+// NotifyResult returns the result and err fields of the receiver f.
+func (f fakeResultNotifier) NotifyResult(_ gmailalert.Alert) (gmailalert.NotifyResult, error) {
+	return f.result, f.err
+}
+
 // spyNotifier represents a test double type that implements the
 // Notifier interface and keeps a count of how many times its
 // Notify method is called. It is safe to be used concurrently
@@ -244,6 +681,54 @@ func (s *spyNotifier) Notify(_ gmailalert.Alert) error {
 	return nil
 }
 
+// recordingNotifier represents a test double type that implements the
+// Notifier interface and records every Alert it is asked to notify on.
+// It is safe to be used concurrently by multiple goroutines.
+type recordingNotifier struct {
+	alerts []gmailalert.Alert
+	mtx    sync.Mutex
+}
+
+// Notify appends alt to the alerts field of the receiver r and always
+// returns a nil error.
+func (r *recordingNotifier) Notify(alt gmailalert.Alert) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.alerts = append(r.alerts, alt)
+	return nil
+}
+
+// partialNotifier represents a test double type that implements the
+// Notifier interface, records the recipients of every notification, and
+// fails to notify each recipient in its failures field as many times as
+// the recipient is mapped to, with a RecipientError for each. It is safe to
+// be used concurrently by multiple goroutines.
+type partialNotifier struct {
+	failures map[string]int
+	calls    [][]string
+	mtx      sync.Mutex
+}
+
+// Notify records the recipients of alt in the calls field of the receiver
+// p and returns an error wrapping a RecipientError for each recipient that
+// still has failures left.
+func (p *partialNotifier) Notify(alt gmailalert.Alert) error {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.calls = append(p.calls, alt.Recipients())
+	var errs []error
+	for _, r := range alt.Recipients() {
+		if p.failures[r] > 0 {
+			p.failures[r]--
+			errs = append(errs, gmailalert.RecipientError{Recipient: r, Err: errSendingNotification})
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("notification failed for %d recipients: %w", len(errs), errors.Join(errs...))
+	}
+	return nil
+}
+
 // mockNotifier represents a test double type that implements the
 // Notifier interface and is initialized with a set of error values
 // to provide when it's Notify method is called. It is safe to be
@@ -265,6 +750,47 @@ func (m *mockNotifier) Notify(_ gmailalert.Alert) error {
 	return resp
 }
 
+// concurrencyMatcher represents a test double type that implements the
+// Matcher interface and records the most calls of its Match method that
+// were running at the same time. It is safe to be used concurrently by
+// multiple goroutines.
+type concurrencyMatcher struct {
+	running int
+	max     int
+	mtx     sync.Mutex
+}
+
+// Match counts the call as running for a short while, updating the max
+// field of the receiver c, and returns no matches.
+func (c *concurrencyMatcher) Match(_ string) ([]string, error) {
+	c.mtx.Lock()
+	c.running++
+	if c.running > c.max {
+		c.max = c.running
+	}
+	c.mtx.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+
+	c.mtx.Lock()
+	c.running--
+	c.mtx.Unlock()
+	return nil, nil
+}
+
+// spyReporter represents a test double type that implements the
+// Reporter interface and records every Summary it receives.
+type spyReporter struct {
+	summaries []gmailalert.Summary
+}
+
+// Report appends s to the summaries field of the receiver r and
+// always returns a nil error.
+func (r *spyReporter) Report(s gmailalert.Summary) error {
+	r.summaries = append(r.summaries, s)
+	return nil
+}
+
 // spyLogger represents a test double type that implements the Logger
 // interface and keeps a count of how many error and non-error log calls
 // are made to its Printf method.
@@ -0,0 +1,82 @@
+package gmailalert
+
+import (
+	"fmt"
+	"sync"
+)
+
+// gmailClientPool keeps the GmailClients of a daemon, along with their Gmail
+// service, OAuth2 HTTP client, and token source, across the runs started
+// whenever its configuration is reloaded, so that a changed alert does not
+// rebuild them. A pooled GmailClient is reused as long as its credentials
+// and token are unchanged and it passes a health check, and is created again
+// otherwise. It is safe for concurrent use by multiple goroutines, like the
+// runs of several profiles, which share a GmailClient if they use the same
+// credentials, token, and HTTP settings.
+type gmailClientPool struct {
+	mtx     sync.Mutex
+	clients map[string]pooledGmailClient
+	// The TokenManager whose token source of a token file is dropped when
+	// the GmailClient using it is created again.
+	tokens *TokenManager
+	// The health check of a pooled GmailClient before it is reused.
+	check func(*GmailClient) error
+}
+
+// pooledGmailClient represents a GmailClient kept by a gmailClientPool.
+type pooledGmailClient struct {
+	client *GmailClient
+	// The fingerprint of the credentials and token the GmailClient was
+	// created with.
+	credentials string
+}
+
+// newGmailClientPool returns a new gmailClientPool without any GmailClients,
+// which checks the health of a GmailClient by fetching the Gmail profile.
+func newGmailClientPool() *gmailClientPool {
+	return &gmailClientPool{
+		clients: map[string]pooledGmailClient{},
+		tokens:  defaultTokenManager,
+		check:   (*GmailClient).ping,
+	}
+}
+
+// get returns the GmailClient kept under the given key, which identifies the
+// token file, credentials file, and HTTP settings it was created with, if it
+// was created with the given fingerprint of the credentials and token and
+// passes the health check. Otherwise, the token source of the given token
+// file is dropped and a GmailClient created with the given function is kept
+// in its place. Failed health checks are logged to the given Logger. An
+// error is returned if the GmailClient cannot be created.
+func (p *gmailClientPool) get(key, tokenFile, credentials string, logger Logger, create func() (*GmailClient, error)) (*GmailClient, error) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	pooled, ok := p.clients[key]
+	if ok && pooled.credentials == credentials {
+		err := p.check(pooled.client)
+		if err == nil {
+			return pooled.client, nil
+		}
+		logger.Printf("warning: gmail client failed its health check, creating it again: %v", err)
+	}
+	if ok {
+		p.tokens.Forget(tokenFile)
+		delete(p.clients, key)
+	}
+
+	client, err := create()
+	if err != nil {
+		return nil, err
+	}
+	p.clients[key] = pooledGmailClient{client: client, credentials: credentials}
+
+	return client, nil
+}
+
+// gmailClientKey returns the key of the GmailClient configured from the
+// cliEnv receiver and the given AlertConfig in a gmailClientPool.
+func (c cliEnv) gmailClientKey(alertCfg AlertConfig) string {
+	return fmt.Sprintf("%s|%s|%d|%s|%+v",
+		tokenManagerKey(c.tokenFile), c.credsFile, c.redirectSvrPort, alertCfg.Proxy.gmail(), alertCfg.gmailHTTPConfig())
+}
@@ -0,0 +1,119 @@
+package gmailalert
+
+import (
+	"errors"
+	"io"
+	"log"
+	"testing"
+)
+
+func TestGmailClientPool(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		credentials string
+		checkErr    error
+		wantReused  bool
+	}{
+		"Healthy client with unchanged credentials is reused": {
+			credentials: "creds",
+			wantReused:  true,
+		},
+		"Client with changed credentials is created again": {
+			credentials: "rotated",
+		},
+		"Client failing its health check is created again": {
+			credentials: "creds",
+			checkErr:    errors.New("token revoked"),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			pool := newGmailClientPool()
+			pool.tokens = NewTokenManager()
+			pool.check = func(*GmailClient) error { return tc.checkErr }
+			logger := log.New(io.Discard, "", 0)
+			created := 0
+			create := func() (*GmailClient, error) {
+				created++
+				return &GmailClient{}, nil
+			}
+
+			first, err := pool.get("key", "token.json", "creds", logger, create)
+			if err != nil {
+				t.Fatal(err)
+			}
+			second, err := pool.get("key", "token.json", tc.credentials, logger, create)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if reused := first == second; reused != tc.wantReused {
+				t.Errorf("want client reused %t, got %t", tc.wantReused, reused)
+			}
+			wantCreated := 2
+			if tc.wantReused {
+				wantCreated = 1
+			}
+			if created != wantCreated {
+				t.Errorf("want %d clients created, got %d", wantCreated, created)
+			}
+		})
+	}
+}
+
+func TestGmailClientPoolKeepsClientsPerKey(t *testing.T) {
+	t.Parallel()
+
+	pool := newGmailClientPool()
+	pool.check = func(*GmailClient) error { return nil }
+	logger := log.New(io.Discard, "", 0)
+	create := func() (*GmailClient, error) { return &GmailClient{}, nil }
+
+	a, err := pool.get("a", "a.json", "creds", logger, create)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := pool.get("b", "b.json", "creds", logger, create)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == b {
+		t.Error("want a client per key, got the same client for different keys")
+	}
+
+	_, err = pool.get("c", "c.json", "creds", logger, func() (*GmailClient, error) {
+		return nil, errors.New("no token")
+	})
+	if err == nil {
+		t.Error("want error creating client, got nil")
+	}
+	if _, ok := pool.clients["c"]; ok {
+		t.Error("want a client that failed to be created not to be kept")
+	}
+}
+
+func TestGmailClientKey(t *testing.T) {
+	t.Parallel()
+
+	app := cliEnv{credsFile: "credentials.json", tokenFile: "token.json", redirectSvrPort: 9999}
+	cfg := AlertConfig{}
+	if app.gmailClientKey(cfg) != app.gmailClientKey(AlertConfig{PushoverApp: "other"}) {
+		t.Error("want a key independent of the pushover settings")
+	}
+
+	proxied := AlertConfig{Proxy: &ProxyConfig{URL: "http://proxy:3128"}}
+	if app.gmailClientKey(cfg) == app.gmailClientKey(proxied) {
+		t.Error("want a changed gmail proxy to change the key")
+	}
+	timeout := AlertConfig{HTTP: &HTTPConfig{Gmail: &HTTPClientConfig{Timeout: "5s"}}}
+	if app.gmailClientKey(cfg) == app.gmailClientKey(timeout) {
+		t.Error("want changed gmail http settings to change the key")
+	}
+	other := app
+	other.tokenFile = "other.json"
+	if app.gmailClientKey(cfg) == other.gmailClientKey(cfg) {
+		t.Error("want a different token file to change the key")
+	}
+}
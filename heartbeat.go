@@ -0,0 +1,124 @@
+package gmailalert
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// HeartbeatConfig represents the configuration for pinging a dead man's
+// switch service, like healthchecks.io, after every run.
+type HeartbeatConfig struct {
+	// The URL to ping after every successful run.
+	URL string `json:"url"`
+	// The optional URL to ping after a run with errors.
+	FailureURL string `json:"failureurl"`
+	// The timeout for each ping, as a duration like "10s". Defaults to 10s.
+	Timeout string `json:"timeout"`
+	// The number of times a failed ping is retried. Defaults to 0.
+	Retries int `json:"retries"`
+	// The optional URL of the proxy or SSH tunnel the pings are sent
+	// through, like "socks5://localhost:1080" or
+	// "ssh://user@bastion.example.com". If empty, the proxy named by the
+	// environment is used, if any.
+	Proxy string `json:"proxy"`
+}
+
+// Heartbeat is a Reporter that pings a configured URL after every successful
+// run and a failure URL after every run with errors, so that users can be
+// alerted when gmailalert itself stops running.
+type Heartbeat struct {
+	cfg     HeartbeatConfig
+	client  *http.Client
+	backoff time.Duration
+}
+
+// NewHeartbeat accepts a HeartbeatConfig and returns a new Heartbeat. An
+// error is returned if the URL is empty, the timeout or proxy is invalid, or
+// the number of retries is negative.
+func NewHeartbeat(cfg HeartbeatConfig) (*Heartbeat, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("heartbeat url must not be empty")
+	}
+	if cfg.Retries < 0 {
+		return nil, fmt.Errorf("heartbeat retries must not be negative, got %d", cfg.Retries)
+	}
+
+	timeout := 10 * time.Second
+	if cfg.Timeout != "" {
+		d, err := time.ParseDuration(cfg.Timeout)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("heartbeat timeout must be a positive duration, got %q", cfg.Timeout)
+		}
+		timeout = d
+	}
+	client, err := adapterHTTPClient(cfg.Proxy, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("got error configuring heartbeat proxy: %v", err)
+	}
+
+	return &Heartbeat{
+		cfg:     cfg,
+		client:  client,
+		backoff: time.Second,
+	}, nil
+}
+
+// Report accepts the Summary of a run and pings the failure URL if any
+// alerts failed to be processed, or the success URL otherwise. An error is
+// returned if the ping does not succeed after all retries.
+func (h *Heartbeat) Report(s Summary) error {
+	if s.Failed() > 0 {
+		return h.Fail()
+	}
+
+	return h.ping(h.cfg.URL)
+}
+
+// Fail pings the failure URL, if one is configured. An error is returned if
+// the ping does not succeed after all retries.
+func (h *Heartbeat) Fail() error {
+	if h.cfg.FailureURL == "" {
+		return nil
+	}
+
+	return h.ping(h.cfg.FailureURL)
+}
+
+// ping sends an HTTP GET request to the given URL, retrying with a linear
+// backoff if the request fails or the response status is not 2xx. An error
+// is returned if every attempt fails. It only names the host of the URL,
+// since the path of a ping URL usually identifies the check and lets anyone
+// ping it.
+func (h *Heartbeat) ping(rawURL string) error {
+	var err error
+	for attempt := 0; attempt <= h.cfg.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * h.backoff)
+		}
+
+		var resp *http.Response
+		resp, err = h.client.Get(rawURL)
+		if err != nil {
+			var urlErr *url.Error
+			if errors.As(err, &urlErr) {
+				err = urlErr.Err
+			}
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return nil
+		}
+		err = fmt.Errorf("got unexpected response status %s", resp.Status)
+	}
+
+	host := "<invalid url>"
+	if u, parseErr := url.Parse(rawURL); parseErr == nil {
+		host = u.Host
+	}
+
+	return fmt.Errorf("got error pinging heartbeat url on host %s after %d attempts: %v", host, h.cfg.Retries+1, err)
+}
@@ -0,0 +1,148 @@
+package gmailalert
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestNewHeartbeat(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		input       HeartbeatConfig
+		errExpected bool
+	}{
+		"Empty url returns an error": {
+			input:       HeartbeatConfig{},
+			errExpected: true,
+		},
+		"Negative retries returns an error": {
+			input:       HeartbeatConfig{URL: "http://localhost", Retries: -1},
+			errExpected: true,
+		},
+		"Invalid timeout returns an error": {
+			input:       HeartbeatConfig{URL: "http://localhost", Timeout: "soon"},
+			errExpected: true,
+		},
+		"Valid config returns no error": {
+			input:       HeartbeatConfig{URL: "http://localhost", Timeout: "5s", Retries: 2},
+			errExpected: false,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewHeartbeat(tc.input)
+			errReceived := err != nil
+
+			if tc.errExpected != errReceived {
+				t.Errorf("got unexpected error status %t", errReceived)
+			}
+		})
+	}
+}
+
+func TestHeartbeatReport(t *testing.T) {
+	t.Parallel()
+
+	var okPings, failPings, flakyPings int64
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&okPings, 1)
+	})
+	mux.HandleFunc("/fail", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&failPings, 1)
+	})
+	mux.HandleFunc("/flaky", func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&flakyPings, 1) == 1 {
+			http.Error(w, "try again", http.StatusInternalServerError)
+		}
+	})
+	mux.HandleFunc("/down", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	})
+	svr := httptest.NewServer(mux)
+	defer svr.Close()
+
+	t.Run("successful run pings the url", func(t *testing.T) {
+		h, err := NewHeartbeat(HeartbeatConfig{URL: svr.URL + "/ok", FailureURL: svr.URL + "/fail"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := h.Report(Summary{Results: []AlertResult{{Alert: "a"}}}); err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		if atomic.LoadInt64(&okPings) != 1 || atomic.LoadInt64(&failPings) != 0 {
+			t.Fatalf("want 1 ok ping and 0 failure pings, got %d and %d", okPings, failPings)
+		}
+	})
+
+	t.Run("failed run pings the failure url", func(t *testing.T) {
+		h, err := NewHeartbeat(HeartbeatConfig{URL: svr.URL + "/ok", FailureURL: svr.URL + "/fail"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := h.Report(Summary{Results: []AlertResult{{Alert: "a", Err: http.ErrHandlerTimeout}}}); err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		if atomic.LoadInt64(&failPings) != 1 {
+			t.Fatalf("want 1 failure ping, got %d", failPings)
+		}
+	})
+
+	t.Run("failed ping is retried", func(t *testing.T) {
+		h, err := NewHeartbeat(HeartbeatConfig{URL: svr.URL + "/flaky", Retries: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.backoff = 0
+
+		if err := h.Report(Summary{}); err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		if atomic.LoadInt64(&flakyPings) != 2 {
+			t.Fatalf("want 2 pings, got %d", flakyPings)
+		}
+	})
+
+	t.Run("ping failing after all retries returns an error", func(t *testing.T) {
+		h, err := NewHeartbeat(HeartbeatConfig{URL: svr.URL + "/down", Retries: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.backoff = 0
+
+		err = h.Report(Summary{})
+		if err == nil {
+			t.Fatal("wanted an error but did not get one")
+		}
+		if strings.Contains(err.Error(), "/down") {
+			t.Errorf("wanted the error not to contain the path of the ping url, got %v", err)
+		}
+	})
+
+	t.Run("unreachable ping url is not logged", func(t *testing.T) {
+		down := httptest.NewServer(http.NotFoundHandler())
+		down.Close()
+		h, err := NewHeartbeat(HeartbeatConfig{URL: down.URL + "/ping/5f1c9a7e"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = h.Report(Summary{})
+		if err == nil {
+			t.Fatal("wanted an error but did not get one")
+		}
+		if strings.Contains(err.Error(), "5f1c9a7e") {
+			t.Errorf("wanted the error not to contain the path of the ping url, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,448 @@
+package gmailalert
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// HistoryRecord represents a single evaluation of an alert recorded in the
+// History, or the emails found for an alert in one chunk of a backfill.
+type HistoryRecord struct {
+	// The time of the evaluation, or the end of the backfilled chunk.
+	Time time.Time `json:"time"`
+	// The name identifying the alert.
+	Alert string `json:"alert"`
+	// The ID of the alert's evaluation. It is empty for backfilled records.
+	EvalID string `json:"evalid,omitempty"`
+	// The number of emails matching the alert.
+	Matches int `json:"matches"`
+	// Whether a notification was sent for the alert.
+	Notified bool `json:"notified"`
+	// Whether a notification was suppressed.
+	Suppressed bool `json:"suppressed"`
+	// The failover channel that delivered the notification, if any.
+	Channel string `json:"channel,omitempty"`
+	// The error encountered while processing the alert, if any.
+	Error string `json:"error,omitempty"`
+	// The From headers of the matching emails, if they were fetched.
+	Senders []string `json:"senders,omitempty"`
+	// Whether the record was written by a backfill rather than a run.
+	Backfill bool `json:"backfill,omitempty"`
+}
+
+// defaultHistorySegmentBytes is the size the history file grows to before
+// it is compacted into a compressed segment.
+const defaultHistorySegmentBytes = 1 << 20
+
+// The suffixes of the segments of a history file, after the history file
+// name and the sequence number of the segment, like
+// "history.jsonl.000001.zst". Segments are compressed with Zstandard, which
+// makes the repetitive JSON lines of the history smaller than gzip does,
+// and is faster to decompress when statistics read years of them. Segments
+// compressed with gzip by earlier versions are still read. A pending
+// segment is a history file renamed by a compaction that did not finish
+// compressing it yet.
+const (
+	historySegmentSuffix     = ".zst"
+	historyGzipSegmentSuffix = ".gz"
+	historyPendingSuffix     = ".pending"
+)
+
+// History is an append-only log of alert evaluations written as one JSON
+// object per line, which statistics are computed from. Once the history
+// file grows to a segment size, it is compacted in the background into a
+// Zstandard compressed segment next to it, so that years of history stay small
+// on disk. It implements Reporter, recording every alert of every run, and
+// is safe for concurrent use by multiple goroutines.
+type History struct {
+	file         string
+	segmentBytes int64
+	mtx          sync.Mutex
+	// compactMtx serializes compactions, which compress segments without
+	// holding mtx.
+	compactMtx sync.Mutex
+	// compacting is set while a background compaction runs, and
+	// compactErr holds the error of the last one, returned by the next
+	// Report.
+	compacting bool
+	compactErr error
+}
+
+// NewHistory accepts the name of a history file and returns a new History
+// appending to it. An error is returned if the file name is empty.
+func NewHistory(file string) (*History, error) {
+	if file == "" {
+		return nil, errors.New("history file name must not be empty")
+	}
+
+	return &History{file: file, segmentBytes: defaultHistorySegmentBytes}, nil
+}
+
+// Append appends the given HistoryRecords to the history file. An error is
+// returned if the records cannot be encoded or written.
+func (h *History) Append(recs ...HistoryRecord) error {
+	var lines []byte
+	for _, rec := range recs {
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return fmt.Errorf("got error json-encoding history record: %v", err)
+		}
+		lines = append(append(lines, line...), '\n')
+	}
+
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	f, err := os.OpenFile(h.file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("got error opening history file %s: %v", h.file, err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(lines); err != nil {
+		return fmt.Errorf("got error writing history file %s: %v", h.file, err)
+	}
+
+	return nil
+}
+
+// Records returns every HistoryRecord in the compacted segments and in the
+// history file, oldest first. No records are returned if there are none.
+// An error is returned if a file cannot be read or a record cannot be
+// decoded.
+func (h *History) Records() ([]HistoryRecord, error) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	segments, err := h.segments()
+	if err != nil {
+		return nil, err
+	}
+	var recs []HistoryRecord
+	for _, seg := range segments {
+		file := seg.pending
+		if seg.compressed != "" {
+			file = seg.compressed
+		}
+		segRecs, err := readHistoryFile(file)
+		if err != nil {
+			return nil, err
+		}
+		recs = append(recs, segRecs...)
+	}
+	active, err := readHistoryFile(h.file)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(recs, active...), nil
+}
+
+// readHistoryFile returns the HistoryRecords of the history file or segment
+// with the given name, decompressing it if it is a compressed segment. No
+// records are returned if the file does not exist. An error is returned if
+// the file cannot be read or a record cannot be decoded.
+func readHistoryFile(file string) ([]HistoryRecord, error) {
+	f, err := os.Open(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("got error opening history file %s: %v", file, err)
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	switch {
+	case strings.HasSuffix(file, historySegmentSuffix):
+		zr, err := zstd.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("got error decompressing history file %s: %v", file, err)
+		}
+		defer zr.Close()
+		r = zr
+	case strings.HasSuffix(file, historyGzipSegmentSuffix):
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("got error decompressing history file %s: %v", file, err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	var recs []HistoryRecord
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		var rec HistoryRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("got error json-decoding line %d of history file %s: %v", line, file, err)
+		}
+		recs = append(recs, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("got error reading history file %s: %v", file, err)
+	}
+
+	return recs, nil
+}
+
+// historySegment represents a compacted segment of a history file, by the
+// names of its compressed and pending files, either of which may be empty.
+type historySegment struct {
+	seq        int
+	compressed string
+	pending    string
+}
+
+// segments returns the compacted segments of the history file, oldest
+// first. The caller must hold the History's mutex. An error is returned if
+// the directory of the history file cannot be read.
+func (h *History) segments() ([]historySegment, error) {
+	entries, err := os.ReadDir(filepath.Dir(h.file))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("got error reading segments of history file %s: %v", h.file, err)
+	}
+
+	prefix := filepath.Base(h.file) + "."
+	bySeq := map[int]*historySegment{}
+	for _, e := range entries {
+		name, ok := strings.CutPrefix(e.Name(), prefix)
+		if !ok || e.IsDir() {
+			continue
+		}
+		num, suffix, _ := strings.Cut(name, ".")
+		seq, err := strconv.Atoi(num)
+		if err != nil {
+			continue
+		}
+		file := filepath.Join(filepath.Dir(h.file), e.Name())
+		switch "." + suffix {
+		case historySegmentSuffix, historyGzipSegmentSuffix:
+			if bySeq[seq] == nil {
+				bySeq[seq] = &historySegment{seq: seq}
+			}
+			bySeq[seq].compressed = file
+		case historyPendingSuffix:
+			if bySeq[seq] == nil {
+				bySeq[seq] = &historySegment{seq: seq}
+			}
+			bySeq[seq].pending = file
+		}
+	}
+
+	segments := make([]historySegment, 0, len(bySeq))
+	for _, seg := range bySeq {
+		segments = append(segments, *seg)
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i].seq < segments[j].seq })
+
+	return segments, nil
+}
+
+// Compact moves the records of the history file into a new Zstandard
+// compressed segment next to it, like "history.jsonl.000001.zst", and
+// finishes any compaction interrupted by a crash. The history file is first
+// renamed into a pending segment, which is only removed once it was
+// compressed, so that no record is lost or duplicated if the process stops
+// meanwhile. Only the renaming and removal hold the History's mutex, so
+// that Append and Records are not blocked while the segment is compressed.
+// An error is returned if a segment cannot be written.
+func (h *History) Compact() error {
+	h.compactMtx.Lock()
+	defer h.compactMtx.Unlock()
+
+	segments, err := h.rotate()
+	if err != nil {
+		return err
+	}
+
+	for _, seg := range segments {
+		if seg.pending == "" {
+			continue
+		}
+		if seg.compressed == "" {
+			if err := compressHistorySegment(seg.pending, fmt.Sprintf("%s.%06d%s", h.file, seg.seq, historySegmentSuffix)); err != nil {
+				return err
+			}
+		}
+		if err := h.removePending(seg.pending); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rotate renames the history file, unless it is empty, into a new pending
+// segment, so that the following records are appended to a new history
+// file, and returns the compacted segments, including the new one. An error
+// is returned if the segments cannot be listed or the history file cannot be
+// renamed.
+func (h *History) rotate() ([]historySegment, error) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	segments, err := h.segments()
+	if err != nil {
+		return nil, err
+	}
+	next := 1
+	if len(segments) > 0 {
+		next = segments[len(segments)-1].seq + 1
+	}
+	if info, err := os.Stat(h.file); err == nil && info.Size() > 0 {
+		seg := historySegment{seq: next, pending: fmt.Sprintf("%s.%06d%s", h.file, next, historyPendingSuffix)}
+		if err := os.Rename(h.file, seg.pending); err != nil {
+			return nil, fmt.Errorf("got error moving history file %s into a segment: %v", h.file, err)
+		}
+		segments = append(segments, seg)
+	}
+
+	return segments, nil
+}
+
+// removePending removes the given pending segment once it was compressed.
+// It holds the History's mutex, so that Records does not read the pending
+// segment while it is removed. An error is returned if the segment cannot be
+// removed.
+func (h *History) removePending(pending string) error {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	if err := os.Remove(pending); err != nil {
+		return fmt.Errorf("got error removing compacted history segment %s: %v", pending, err)
+	}
+
+	return nil
+}
+
+// compressHistorySegment writes the given pending segment of a history file
+// Zstandard compressed into the given segment file, through a temporary file
+// renamed over it, so that a segment file is always complete. An error is
+// returned if the segment cannot be written.
+func compressHistorySegment(pending, segment string) error {
+	r, err := os.Open(pending)
+	if err != nil {
+		return fmt.Errorf("got error opening history segment %s: %v", pending, err)
+	}
+	defer r.Close()
+
+	tmp := segment + ".tmp"
+	w, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("got error creating history segment %s: %v", tmp, err)
+	}
+	defer os.Remove(tmp)
+	zw, err := zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedBetterCompression))
+	if err != nil {
+		w.Close()
+		return fmt.Errorf("got error compressing history segment %s: %v", pending, err)
+	}
+	if _, err := io.Copy(zw, r); err != nil {
+		w.Close()
+		return fmt.Errorf("got error compressing history segment %s: %v", pending, err)
+	}
+	if err := zw.Close(); err != nil {
+		w.Close()
+		return fmt.Errorf("got error compressing history segment %s: %v", pending, err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("got error writing history segment %s: %v", tmp, err)
+	}
+	if err := os.Rename(tmp, segment); err != nil {
+		return fmt.Errorf("got error replacing history segment %s: %v", segment, err)
+	}
+
+	return nil
+}
+
+// compactInBackground starts compacting the history file in a new goroutine
+// if it grew to the segment size and no compaction is running yet. The
+// error of the compaction is kept for the next call to Report.
+func (h *History) compactInBackground() {
+	info, err := os.Stat(h.file)
+	if err != nil || info.Size() < h.segmentBytes {
+		return
+	}
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	if h.compacting {
+		return
+	}
+	h.compacting = true
+
+	go func() {
+		err := h.Compact()
+		h.mtx.Lock()
+		defer h.mtx.Unlock()
+		h.compacting, h.compactErr = false, err
+	}()
+}
+
+// Report appends a HistoryRecord for every alert in the given Summary to the
+// history file, and starts compacting it in the background once it grew to
+// the segment size. An error is returned if the records cannot be written,
+// or if the last compaction failed.
+func (h *History) Report(s Summary) error {
+	recs := make([]HistoryRecord, 0, len(s.Results))
+	for _, r := range s.Results {
+		rec := HistoryRecord{
+			Time:       s.Started,
+			Alert:      r.Alert,
+			EvalID:     r.EvalID,
+			Matches:    r.Matches,
+			Notified:   r.Notified,
+			Suppressed: r.Suppressed,
+			Channel:    r.Channel,
+			Senders:    r.Senders,
+		}
+		if r.Err != nil {
+			rec.Error = r.Err.Error()
+		}
+		recs = append(recs, rec)
+	}
+	if len(recs) == 0 {
+		return nil
+	}
+	if err := h.Append(recs...); err != nil {
+		return err
+	}
+
+	h.mtx.Lock()
+	compactErr := h.compactErr
+	h.compactErr = nil
+	h.mtx.Unlock()
+	h.compactInBackground()
+
+	return compactErr
+}
+
+// messageSenders returns the non-empty From headers of the given messages,
+// which are only known for messages whose details were fetched.
+func messageSenders(msgs []Message) []string {
+	var senders []string
+	for _, m := range msgs {
+		if m.From != "" {
+			senders = append(senders, m.From)
+		}
+	}
+
+	return senders
+}
@@ -0,0 +1,47 @@
+package gmailalert
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHistoryReportCompactsInBackground(t *testing.T) {
+	t.Parallel()
+
+	file := filepath.Join(t.TempDir(), "history.jsonl")
+	history, err := NewHistory(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	history.segmentBytes = 1
+
+	if err := history.Report(Summary{Results: []AlertResult{{Alert: "Orders"}}}); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		history.mtx.Lock()
+		compacting := history.compacting
+		history.mtx.Unlock()
+		if !compacting {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("want background compaction to finish, but it is still running")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, err := os.Stat(file + ".000001.zst"); err != nil {
+		t.Errorf("want history file compacted into a segment: %v", err)
+	}
+	recs, err := history.Records()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 1 || recs[0].Alert != "Orders" {
+		t.Errorf("want the record kept after compaction, got %+v", recs)
+	}
+}
@@ -0,0 +1,219 @@
+package gmailalert_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aculclasure/gmailalert"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewHistoryWithEmptyFileNameReturnsError(t *testing.T) {
+	t.Parallel()
+
+	if _, err := gmailalert.NewHistory(""); err == nil {
+		t.Error("expected an error but did not get one")
+	}
+}
+
+func TestHistoryRecordsEveryAlertOfEveryRun(t *testing.T) {
+	t.Parallel()
+
+	history, err := gmailalert.NewHistory(filepath.Join(t.TempDir(), "history.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	summaries := []gmailalert.Summary{
+		{Started: started, Results: []gmailalert.AlertResult{
+			{Alert: "Bill Due", EvalID: "run1.0", Matches: 2, Notified: true, Senders: []string{"billing@bank.com"}},
+			{Alert: "Orders", EvalID: "run1.1", Err: errors.New("quota exceeded")},
+		}},
+		{Started: started.Add(time.Hour), Results: []gmailalert.AlertResult{
+			{Alert: "Bill Due", EvalID: "run2.0", Matches: 2, Suppressed: true},
+		}},
+	}
+
+	for _, s := range summaries {
+		if err := history.Report(s); err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+	}
+	got, err := history.Records()
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+
+	want := []gmailalert.HistoryRecord{
+		{Time: started, Alert: "Bill Due", EvalID: "run1.0", Matches: 2, Notified: true, Senders: []string{"billing@bank.com"}},
+		{Time: started, Alert: "Orders", EvalID: "run1.1", Error: "quota exceeded"},
+		{Time: started.Add(time.Hour), Alert: "Bill Due", EvalID: "run2.0", Matches: 2, Suppressed: true},
+	}
+	if !cmp.Equal(want, got) {
+		t.Errorf("want != got\ndiff=%s", cmp.Diff(want, got))
+	}
+}
+
+func TestHistoryRecordsWithMissingFileReturnsNoRecords(t *testing.T) {
+	t.Parallel()
+
+	history, err := gmailalert.NewHistory(filepath.Join(t.TempDir(), "history.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recs, err := history.Records()
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if len(recs) != 0 {
+		t.Errorf("wanted no records, got %v", recs)
+	}
+}
+
+func TestHistoryCompactKeepsRecordsInCompressedSegments(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "history.jsonl")
+	history, err := gmailalert.NewHistory(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	// A compaction interrupted by a crash left a pending segment behind.
+	pending := file + ".000001.pending"
+	if err := os.WriteFile(pending, []byte(`{"time":"2023-02-28T12:00:00Z","alert":"Old"}`+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		s := gmailalert.Summary{Started: started.Add(time.Duration(i) * time.Hour), Results: []gmailalert.AlertResult{{Alert: "Orders", Matches: i}}}
+		if err := history.Report(s); err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+		if err := history.Compact(); err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+	}
+	if err := history.Report(gmailalert.Summary{Started: started.Add(2 * time.Hour), Results: []gmailalert.AlertResult{{Alert: "Orders", Matches: 2}}}); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+
+	got, err := history.Records()
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	want := []gmailalert.HistoryRecord{
+		{Time: started.Add(-24 * time.Hour), Alert: "Old"},
+		{Time: started, Alert: "Orders"},
+		{Time: started.Add(time.Hour), Alert: "Orders", Matches: 1},
+		{Time: started.Add(2 * time.Hour), Alert: "Orders", Matches: 2},
+	}
+	if !cmp.Equal(want, got) {
+		t.Errorf("want != got\ndiff=%s", cmp.Diff(want, got))
+	}
+	segments, err := filepath.Glob(file + ".*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantSegments := []string{file + ".000001.zst", file + ".000002.zst", file + ".000003.zst"}
+	if !cmp.Equal(wantSegments, segments) {
+		t.Errorf("want != got\ndiff=%s", cmp.Diff(wantSegments, segments))
+	}
+}
+
+func TestHistoryRecordsReadsGzipSegments(t *testing.T) {
+	t.Parallel()
+
+	file := filepath.Join(t.TempDir(), "history.jsonl")
+	history, err := gmailalert.NewHistory(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Segments were compressed with gzip before Zstandard was used.
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	if _, err := zw.Write([]byte(`{"time":"2023-02-28T12:00:00Z","alert":"Old"}` + "\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file+".000001.gz", b.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	started := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	if err := history.Report(gmailalert.Summary{Started: started, Results: []gmailalert.AlertResult{{Alert: "Orders"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := history.Compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := history.Records()
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	want := []gmailalert.HistoryRecord{
+		{Time: started.Add(-24 * time.Hour), Alert: "Old"},
+		{Time: started, Alert: "Orders"},
+	}
+	if !cmp.Equal(want, got) {
+		t.Errorf("want != got\ndiff=%s", cmp.Diff(want, got))
+	}
+	if _, err := os.Stat(file + ".000002.zst"); err != nil {
+		t.Errorf("want new segment after the gzip segment: %v", err)
+	}
+}
+
+func TestHistoryAppendDuringCompactKeepsEveryRecord(t *testing.T) {
+	t.Parallel()
+
+	file := filepath.Join(t.TempDir(), "history.jsonl")
+	history, err := gmailalert.NewHistory(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const appends = 200
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < appends; i++ {
+			if err := history.Append(gmailalert.HistoryRecord{Alert: "Orders", Matches: i}); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			if err := history.Compact(); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+
+	recs, err := history.Records()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != appends {
+		t.Fatalf("want %d records, got %d", appends, len(recs))
+	}
+	for i, rec := range recs {
+		if rec.Matches != i {
+			t.Fatalf("want records in the order they were appended, got record %d at position %d", rec.Matches, i)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package gmailalert
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrSkipNotification can be returned by the BeforeNotify function of a Hook
+// to suppress the notification of an alert without failing it.
+var ErrSkipNotification = errors.New("notification skipped by hook")
+
+// Hook represents functions called by an Alerter around each stage of the
+// evaluation of an alert, allowing behavior like deduplication, rate
+// limiting, or audit logging to be added to an Alerter without changing it.
+// Any of the functions may be nil. The hooks of an Alerter are called in the
+// order they were added to it.
+//
+// Deprecated: Use the stable v1.Hook in package api/v1.
+type Hook struct {
+	// BeforeQuery is called before the alert's Gmail query is run and may
+	// change the alert. If it returns an error, the alert fails.
+	BeforeQuery func(alt *Alert) error
+	// AfterQuery is called with the messages matching the alert and returns
+	// the messages to continue evaluating the alert with, which allows it to
+	// filter them. If it returns an error, the alert fails.
+	AfterQuery func(alt Alert, matches []Message) ([]Message, error)
+	// BeforeNotify is called before a notification is sent for the alert and
+	// may change the alert. If it returns ErrSkipNotification, the
+	// notification is suppressed. If it returns any other error, the alert
+	// fails.
+	BeforeNotify func(alt *Alert) error
+	// AfterNotify is called once a notification was sent for the alert, with
+	// the details of the sent notification, or with the error returned if
+	// the notification failed. Any error it returns is logged.
+	AfterNotify func(alt Alert, res NotifyResult, err error) error
+}
+
+// WithAlerterHook accepts a Hook and returns a functional option for adding
+// the Hook to an Alerter.
+func WithAlerterHook(h Hook) AlerterOption {
+	return func(a *Alerter) {
+		a.Hooks = append(a.Hooks, h)
+	}
+}
+
+// beforeQuery calls the BeforeQuery function of each of the Alerter's Hooks
+// with the given Alert, stopping at the first error.
+func (a Alerter) beforeQuery(alt *Alert) error {
+	for _, h := range a.Hooks {
+		if h.BeforeQuery == nil {
+			continue
+		}
+		if err := h.BeforeQuery(alt); err != nil {
+			return fmt.Errorf("got error running hook before query: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// afterQuery calls the AfterQuery function of each of the Alerter's Hooks
+// with the given Alert and the matches returned by the previous Hook,
+// stopping at the first error, and returns the resulting matches.
+func (a Alerter) afterQuery(alt Alert, matches []Message) ([]Message, error) {
+	for _, h := range a.Hooks {
+		if h.AfterQuery == nil {
+			continue
+		}
+		var err error
+		matches, err = h.AfterQuery(alt, matches)
+		if err != nil {
+			return nil, fmt.Errorf("got error running hook after query: %w", err)
+		}
+	}
+
+	return matches, nil
+}
+
+// beforeNotify calls the BeforeNotify function of each of the Alerter's
+// Hooks with the given Alert, stopping at the first error.
+func (a Alerter) beforeNotify(alt *Alert) error {
+	for _, h := range a.Hooks {
+		if h.BeforeNotify == nil {
+			continue
+		}
+		if err := h.BeforeNotify(alt); err != nil {
+			return fmt.Errorf("got error running hook before notification: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// afterNotify calls the AfterNotify function of each of the Alerter's Hooks
+// with the given Alert and the outcome of its notification, logging any
+// errors returned.
+func (a Alerter) afterNotify(alt Alert, res NotifyResult, notifyErr error) {
+	for _, h := range a.Hooks {
+		if h.AfterNotify == nil {
+			continue
+		}
+		if err := h.AfterNotify(alt, res, notifyErr); err != nil {
+			a.errorLog().Printf("got error running hook after notification: %v", err)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package gmailalert_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/aculclasure/gmailalert"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestProcessHooks(t *testing.T) {
+	t.Parallel()
+
+	t.Run("hooks are called around each stage in the order they were added", func(t *testing.T) {
+		var mtx sync.Mutex
+		var calls []string
+		record := func(call string) {
+			mtx.Lock()
+			defer mtx.Unlock()
+			calls = append(calls, call)
+		}
+		hook := func(name string) gmailalert.Hook {
+			return gmailalert.Hook{
+				BeforeQuery: func(alt *gmailalert.Alert) error {
+					record(name + " before query")
+					return nil
+				},
+				AfterQuery: func(alt gmailalert.Alert, matches []gmailalert.Message) ([]gmailalert.Message, error) {
+					record(name + " after query")
+					return matches, nil
+				},
+				BeforeNotify: func(alt *gmailalert.Alert) error {
+					record(name + " before notify")
+					return nil
+				},
+				AfterNotify: func(alt gmailalert.Alert, res gmailalert.NotifyResult, err error) error {
+					record(name + " after notify")
+					return nil
+				},
+			}
+		}
+		alt, err := gmailalert.NewAlerter(
+			fakeMatcher{matches: []gmailalert.Message{{ID: "matching-email1"}}},
+			fakeNotifier{},
+			gmailalert.WithAlerterLogger(&spyLogger{}),
+			gmailalert.WithAlerterHook(hook("first")),
+			gmailalert.WithAlerterHook(hook("second")),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := alt.Process([]gmailalert.Alert{{GmailQuery: "is:unread"}}); err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		want := []string{
+			"first before query", "second before query",
+			"first after query", "second after query",
+			"first before notify", "second before notify",
+			"first after notify", "second after notify",
+		}
+		if !cmp.Equal(want, calls) {
+			t.Errorf("want != got\ndiff=%s", cmp.Diff(want, calls))
+		}
+	})
+
+	t.Run("hooks can change the alert and filter its matches", func(t *testing.T) {
+		recNotif := &recordingNotifier{}
+		spyRep := &spyReporter{}
+		alt := gmailalert.Alerter{
+			Matcher:  fakeMatcher{matches: []gmailalert.Message{{ID: "keep"}, {ID: "drop"}}},
+			Notifier: recNotif,
+			Logger:   &spyLogger{},
+			Hooks: []gmailalert.Hook{{
+				AfterQuery: func(alt gmailalert.Alert, matches []gmailalert.Message) ([]gmailalert.Message, error) {
+					return matches[:1], nil
+				},
+				BeforeNotify: func(alt *gmailalert.Alert) error {
+					alt.PushoverTitle = "changed"
+					return nil
+				},
+			}},
+			Reporters: []gmailalert.Reporter{spyRep},
+		}
+
+		if err := alt.Process([]gmailalert.Alert{{GmailQuery: "is:unread", PushoverTitle: "original"}}); err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		if got := spyRep.summaries[0].Results[0].Matches; got != 1 {
+			t.Errorf("wanted 1 match after filtering, got %d", got)
+		}
+		if len(recNotif.alerts) != 1 || recNotif.alerts[0].PushoverTitle != "changed" {
+			t.Errorf("wanted 1 notification with the changed title, got %+v", recNotif.alerts)
+		}
+	})
+
+	t.Run("skipped notifications are suppressed", func(t *testing.T) {
+		spyNotif := &spyNotifier{}
+		spyRep := &spyReporter{}
+		alt := gmailalert.Alerter{
+			Matcher:  fakeMatcher{matches: []gmailalert.Message{{ID: "matching-email1"}}},
+			Notifier: spyNotif,
+			Logger:   &spyLogger{},
+			Hooks: []gmailalert.Hook{{
+				BeforeNotify: func(alt *gmailalert.Alert) error {
+					return gmailalert.ErrSkipNotification
+				},
+			}},
+			Reporters: []gmailalert.Reporter{spyRep},
+		}
+
+		if err := alt.Process([]gmailalert.Alert{{GmailQuery: "is:unread"}}); err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		if spyNotif.numCalls != 0 {
+			t.Errorf("wanted 0 notifications to be sent, got %d", spyNotif.numCalls)
+		}
+		if got := spyRep.summaries[0].Suppressed(); got != 1 {
+			t.Errorf("wanted 1 suppressed alert, got %d", got)
+		}
+	})
+
+	t.Run("hook errors fail the alert", func(t *testing.T) {
+		errHook := errors.New("hook error")
+		spyNotif := &spyNotifier{}
+		spyRep := &spyReporter{}
+		alt := gmailalert.Alerter{
+			Matcher:  fakeMatcher{matches: []gmailalert.Message{{ID: "matching-email1"}}},
+			Notifier: spyNotif,
+			Logger:   &spyLogger{},
+			Hooks: []gmailalert.Hook{{
+				BeforeQuery: func(alt *gmailalert.Alert) error {
+					return errHook
+				},
+			}},
+			Reporters: []gmailalert.Reporter{spyRep},
+		}
+
+		if err := alt.Process([]gmailalert.Alert{{GmailQuery: "is:unread"}}); err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		if spyNotif.numCalls != 0 {
+			t.Errorf("wanted 0 notifications to be sent, got %d", spyNotif.numCalls)
+		}
+		if got := spyRep.summaries[0].Results[0].Err; !errors.Is(got, errHook) {
+			t.Errorf("wanted alert to fail with the hook error, got %v", got)
+		}
+	})
+
+	t.Run("after notify hooks receive notification errors", func(t *testing.T) {
+		var got error
+		alt := gmailalert.Alerter{
+			Matcher:  fakeMatcher{matches: []gmailalert.Message{{ID: "matching-email1"}}},
+			Notifier: fakeNotifier{err: errSendingNotification},
+			Logger:   &spyLogger{},
+			Hooks: []gmailalert.Hook{{
+				AfterNotify: func(alt gmailalert.Alert, res gmailalert.NotifyResult, err error) error {
+					got = err
+					return nil
+				},
+			}},
+		}
+
+		if err := alt.Process([]gmailalert.Alert{{GmailQuery: "is:unread"}}); err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		if !errors.Is(got, errSendingNotification) {
+			t.Errorf("wanted hook to receive the notification error, got %v", got)
+		}
+	})
+}
@@ -0,0 +1,223 @@
+package gmailalert
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// httpAPIMaxAge is how long before, or after, a signed request to the HTTP
+// API was signed for it to be accepted.
+const httpAPIMaxAge = 5 * time.Minute
+
+// httpAPIMaxBodyBytes is the largest request body read to verify the
+// signature of a request to the HTTP API.
+const httpAPIMaxBodyBytes = 1 << 20
+
+// httpAPIAuth represents the secrets authenticating requests to the HTTP
+// API. Without either, requests are not authenticated, which is only
+// allowed on a loopback address.
+type httpAPIAuth struct {
+	// The secret authenticating every request, as described by
+	// authenticateHTTPAPI.
+	secret string
+	// The bearer token authenticating read-only requests, which lets
+	// dashboards list fired alerts without being able to trigger any.
+	readToken string
+}
+
+// httpAPIHandler returns the http.Handler of the HTTP API of a gmailalert
+// daemon, which serves "POST /run" to request every alert, or the alert
+// named by the "alert" query parameter, to be evaluated immediately through
+// the given Control, "GET /alerts/recent" to list its recent fired alerts as
+// JSON, up to the number given by the "limit" query parameter, and
+// "GET /alerts/feed" to serve them as an Atom feed configured by the given
+// FeedConfig. Requests are authenticated with the given httpAPIAuth, so that
+// the API can be called by external systems like a CI pipeline, a
+// dashboard, or a feed reader.
+func httpAPIHandler(c *Control, auth httpAPIAuth, feed FeedConfig) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/run", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "request method must be an HTTP POST, got "+r.Method, http.StatusMethodNotAllowed)
+			return
+		}
+		if auth.secret != "" {
+			if err := authenticateHTTPAPI(auth.secret, r, time.Now()); err != nil {
+				unauthorized(w, err)
+				return
+			}
+		}
+		if err := c.EvaluateNow(r.URL.Query().Get("alert")); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprintln(w, "evaluation requested")
+	})
+	mux.HandleFunc("/alerts/recent", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "request method must be an HTTP GET, got "+r.Method, http.StatusMethodNotAllowed)
+			return
+		}
+		if err := auth.authenticateRead(r); err != nil {
+			unauthorized(w, err)
+			return
+		}
+		limit := 0
+		if s := r.URL.Query().Get("limit"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n <= 0 {
+				http.Error(w, fmt.Sprintf("limit must be a positive number, got %q", s), http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(c.Recent(limit))
+	})
+	mux.HandleFunc("/alerts/feed", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "request method must be an HTTP GET, got "+r.Method, http.StatusMethodNotAllowed)
+			return
+		}
+		if err := auth.authenticateRead(r); err != nil {
+			unauthorized(w, err)
+			return
+		}
+		b, err := feed.atom(c.Recent(feed.entries()))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/atom+xml")
+		w.Write(b)
+	})
+
+	return mux
+}
+
+// authenticateRead returns an error unless the given read-only request
+// carries the read token of the httpAPIAuth receiver a as a bearer token, or
+// is authenticated with its secret. Without a read token or a secret, every
+// request is accepted.
+func (a httpAPIAuth) authenticateRead(r *http.Request) error {
+	if a.readToken != "" {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if ok && subtle.ConstantTimeCompare([]byte(token), []byte(a.readToken)) == 1 {
+			return nil
+		}
+	}
+	if a.secret != "" {
+		return authenticateHTTPAPI(a.secret, r, time.Now())
+	}
+	if a.readToken != "" {
+		return errors.New("request must carry the http api read token as a bearer token")
+	}
+
+	return nil
+}
+
+// unauthorized replies to a request with the given authentication error.
+func unauthorized(w http.ResponseWriter, err error) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	http.Error(w, err.Error(), http.StatusUnauthorized)
+}
+
+// authenticateHTTPAPI returns an error unless the given request to the HTTP
+// API carries the given secret as a bearer token in its "Authorization"
+// header, or is signed with the secret at the given time like the requests
+// of a Webhook, as checked by VerifyWebhook. Signing keeps the secret off
+// the wire for callers that can compute an HMAC.
+func authenticateHTTPAPI(secret string, r *http.Request, now time.Time) error {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		token, ok := strings.CutPrefix(auth, "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+			return errors.New("authorization header does not hold the http api secret")
+		}
+		return nil
+	}
+	if r.Header.Get(WebhookSignatureHeader) == "" {
+		return errors.New("request must be authenticated with a bearer token or a signature")
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, httpAPIMaxBodyBytes))
+	if err != nil {
+		return fmt.Errorf("got error reading request body: %v", err)
+	}
+
+	return VerifyWebhook(secret, r.Header, body, httpAPIMaxAge, now)
+}
+
+// readHTTPAPISecret returns the secret in the given file, without
+// surrounding whitespace, or an empty string if the file name is empty. An
+// error is returned if the file cannot be read or holds no secret.
+func readHTTPAPISecret(file string) (string, error) {
+	if file == "" {
+		return "", nil
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("got error reading http api secret file: %v", err)
+	}
+	secret := strings.TrimSpace(string(b))
+	if secret == "" {
+		return "", fmt.Errorf("http api secret file %s must not be empty", file)
+	}
+
+	return secret, nil
+}
+
+// checkAddr returns an error if the given address of the HTTP API is a TCP
+// address other than a loopback address and the httpAPIAuth receiver a has
+// no secret, since anyone reaching the address could then trigger
+// evaluations and list fired alerts.
+func (a httpAPIAuth) checkAddr(addr net.Addr) error {
+	if tcp, ok := addr.(*net.TCPAddr); ok && a.secret == "" && !tcp.IP.IsLoopback() {
+		return fmt.Errorf("http api on non-loopback address %s must be authenticated with a secret", tcp)
+	}
+
+	return nil
+}
+
+// serveHTTPAPI serves the HTTP API for the given Control on the given
+// net.Listener until the given context is cancelled, authenticating
+// requests with the given httpAPIAuth and serving the Atom feed configured
+// by the given FeedConfig. An error is returned if the listener accepts TCP
+// connections on a non-loopback address without a secret, or if serving
+// fails.
+func serveHTTPAPI(ctx context.Context, l net.Listener, c *Control, auth httpAPIAuth, feed FeedConfig) error {
+	if err := auth.checkAddr(l.Addr()); err != nil {
+		return err
+	}
+	svr := &http.Server{
+		Handler:      httpAPIHandler(c, auth, feed),
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 20 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		svr.Shutdown(shutdownCtx)
+	}()
+
+	err := svr.Serve(l)
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
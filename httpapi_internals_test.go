@@ -0,0 +1,316 @@
+package gmailalert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHTTPAPIRun(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		method        string
+		target        string
+		wantStatus    int
+		wantRequested map[string]bool
+	}{
+		"Post requests every alert": {
+			method:        http.MethodPost,
+			target:        "/run",
+			wantStatus:    http.StatusAccepted,
+			wantRequested: map[string]bool{"": true},
+		},
+		"Post with alert requests the alert": {
+			method:        http.MethodPost,
+			target:        "/run?alert=bills",
+			wantStatus:    http.StatusAccepted,
+			wantRequested: map[string]bool{"bills": true},
+		},
+		"Post with unknown alert returns not found": {
+			method:        http.MethodPost,
+			target:        "/run?alert=unknown",
+			wantStatus:    http.StatusNotFound,
+			wantRequested: map[string]bool{},
+		},
+		"Get returns method not allowed": {
+			method:        http.MethodGet,
+			target:        "/run",
+			wantStatus:    http.StatusMethodNotAllowed,
+			wantRequested: map[string]bool{},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			c := NewControl()
+			c.start([]Alert{{Name: "bills", GmailQuery: "is:unread"}})
+			rec := httptest.NewRecorder()
+
+			httpAPIHandler(c, httpAPIAuth{}, FeedConfig{}).ServeHTTP(rec, httptest.NewRequest(tc.method, tc.target, nil))
+
+			if rec.Code != tc.wantStatus {
+				t.Errorf("want status %d, got %d", tc.wantStatus, rec.Code)
+			}
+			if got := c.takeRequests(); !cmp.Equal(tc.wantRequested, got) {
+				t.Error(cmp.Diff(tc.wantRequested, got))
+			}
+		})
+	}
+}
+
+func TestHTTPAPIRunWithSecretAuthenticatesRequests(t *testing.T) {
+	t.Parallel()
+
+	body := []byte(`{"pipeline": "release"}`)
+	now := time.Now()
+	testCases := map[string]struct {
+		header     http.Header
+		wantStatus int
+	}{
+		"Bearer token is accepted": {
+			header:     http.Header{"Authorization": {"Bearer s3cret"}},
+			wantStatus: http.StatusAccepted,
+		},
+		"Signature is accepted": {
+			header: http.Header{
+				WebhookTimestampHeader: {strconv.FormatInt(now.Unix(), 10)},
+				WebhookSignatureHeader: {signWebhook("s3cret", now.Unix(), body)},
+			},
+			wantStatus: http.StatusAccepted,
+		},
+		"Wrong bearer token returns unauthorized": {
+			header:     http.Header{"Authorization": {"Bearer guess"}},
+			wantStatus: http.StatusUnauthorized,
+		},
+		"Old signature returns unauthorized": {
+			header: http.Header{
+				WebhookTimestampHeader: {strconv.FormatInt(now.Add(-time.Hour).Unix(), 10)},
+				WebhookSignatureHeader: {signWebhook("s3cret", now.Add(-time.Hour).Unix(), body)},
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		"Missing authentication returns unauthorized": {
+			header:     http.Header{},
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			c := NewControl()
+			c.start([]Alert{{Name: "release", GmailQuery: "from:ci"}})
+			req := httptest.NewRequest(http.MethodPost, "/run?alert=release", bytes.NewReader(body))
+			req.Header = tc.header
+			rec := httptest.NewRecorder()
+
+			httpAPIHandler(c, httpAPIAuth{secret: "s3cret"}, FeedConfig{}).ServeHTTP(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Errorf("want status %d, got %d: %s", tc.wantStatus, rec.Code, rec.Body)
+			}
+			if got := len(c.takeRequests()) == 1; got != (tc.wantStatus == http.StatusAccepted) {
+				t.Errorf("want alert requested %t, got %t", tc.wantStatus == http.StatusAccepted, got)
+			}
+		})
+	}
+}
+
+func TestServeHTTPAPIRejectsUnauthenticatedPublicAddress(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		addr        string
+		auth        httpAPIAuth
+		errExpected bool
+	}{
+		"Every address without a secret": {
+			addr:        ":0",
+			errExpected: true,
+		},
+		"Every address with only a read token": {
+			addr:        ":0",
+			auth:        httpAPIAuth{readToken: "r34d"},
+			errExpected: true,
+		},
+		"Every address with a secret": {
+			addr: ":0",
+			auth: httpAPIAuth{secret: "s3cret"},
+		},
+		"Loopback address without a secret": {
+			addr: "127.0.0.1:0",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			l, err := net.Listen("tcp", tc.addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer l.Close()
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			err = serveHTTPAPI(ctx, l, NewControl(), tc.auth, FeedConfig{})
+			errReceived := err != nil
+
+			if errReceived != tc.errExpected {
+				t.Errorf("got unexpected error status: %t (%v)", errReceived, err)
+			}
+		})
+	}
+}
+
+func TestReadHTTPAPISecret(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "secret")
+	if err := os.WriteFile(file, []byte("s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	empty := filepath.Join(dir, "empty")
+	if err := os.WriteFile(empty, []byte("\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := readHTTPAPISecret(file); err != nil || got != "s3cret" {
+		t.Errorf("want secret %q, got %q (%v)", "s3cret", got, err)
+	}
+	if _, err := readHTTPAPISecret(empty); err == nil {
+		t.Error("want error reading an empty secret file")
+	}
+}
+
+func TestHTTPAPIRecentAlerts(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		auth       httpAPIAuth
+		target     string
+		header     http.Header
+		wantStatus int
+		wantAlerts []string
+	}{
+		"Unauthenticated api lists every fired alert": {
+			target:     "/alerts/recent",
+			wantStatus: http.StatusOK,
+			wantAlerts: []string{"orders", "bills"},
+		},
+		"Limit lists the newest fired alerts": {
+			target:     "/alerts/recent?limit=1",
+			wantStatus: http.StatusOK,
+			wantAlerts: []string{"orders"},
+		},
+		"Read token is accepted": {
+			auth:       httpAPIAuth{secret: "s3cret", readToken: "r3ad"},
+			target:     "/alerts/recent",
+			header:     http.Header{"Authorization": {"Bearer r3ad"}},
+			wantStatus: http.StatusOK,
+			wantAlerts: []string{"orders", "bills"},
+		},
+		"Secret is accepted": {
+			auth:       httpAPIAuth{secret: "s3cret", readToken: "r3ad"},
+			target:     "/alerts/recent",
+			header:     http.Header{"Authorization": {"Bearer s3cret"}},
+			wantStatus: http.StatusOK,
+			wantAlerts: []string{"orders", "bills"},
+		},
+		"Missing token returns unauthorized": {
+			auth:       httpAPIAuth{secret: "s3cret", readToken: "r3ad"},
+			target:     "/alerts/recent",
+			wantStatus: http.StatusUnauthorized,
+		},
+		"Invalid limit returns bad request": {
+			target:     "/alerts/recent?limit=-1",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			c := NewControl()
+			c.start([]Alert{{Name: "bills"}, {Name: "orders"}})
+			c.record(Summary{Results: []AlertResult{{Alert: "bills", Notified: true}}}, []time.Time{{}})
+			c.record(Summary{Results: []AlertResult{{Alert: "orders", Notified: true}}}, []time.Time{{}})
+			req := httptest.NewRequest(http.MethodGet, tc.target, nil)
+			if tc.header != nil {
+				req.Header = tc.header
+			}
+			rec := httptest.NewRecorder()
+
+			httpAPIHandler(c, tc.auth, FeedConfig{}).ServeHTTP(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("want status %d, got %d: %s", tc.wantStatus, rec.Code, rec.Body)
+			}
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+			var fired []FiredAlert
+			if err := json.NewDecoder(rec.Body).Decode(&fired); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, f := range fired {
+				got = append(got, f.Alert)
+			}
+			if !cmp.Equal(tc.wantAlerts, got) {
+				t.Error(cmp.Diff(tc.wantAlerts, got))
+			}
+		})
+	}
+}
+
+func TestHTTPAPIReadTokenDoesNotAuthenticateRun(t *testing.T) {
+	t.Parallel()
+
+	c := NewControl()
+	c.start([]Alert{{Name: "bills"}})
+	req := httptest.NewRequest(http.MethodPost, "/run", nil)
+	req.Header.Set("Authorization", "Bearer r3ad")
+	rec := httptest.NewRecorder()
+
+	httpAPIHandler(c, httpAPIAuth{secret: "s3cret", readToken: "r3ad"}, FeedConfig{}).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("want status %d, got %d", http.StatusUnauthorized, rec.Code)
+	}
+}
+
+func TestHTTPAPIFeedServesFiredAlerts(t *testing.T) {
+	t.Parallel()
+
+	c := NewControl()
+	c.start([]Alert{{Name: "bills"}})
+	c.record(Summary{Results: []AlertResult{
+		{Alert: "bills", EvalID: "run.0", Notified: true, Title: "Bill due", MessageIDs: []string{"18a1"}},
+	}}, []time.Time{{}})
+	rec := httptest.NewRecorder()
+
+	httpAPIHandler(c, httpAPIAuth{}, FeedConfig{Title: "My alerts"}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/alerts/feed", nil))
+
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/atom+xml" {
+		t.Fatalf("want an atom feed, got status %d and content type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var feed atomFeed
+	if err := xml.NewDecoder(rec.Body).Decode(&feed); err != nil {
+		t.Fatal(err)
+	}
+	if feed.Title != "My alerts" || len(feed.Entries) != 1 || feed.Entries[0].Title != "Bill due" ||
+		feed.Entries[0].Links[0].Href != "https://mail.google.com/mail/u/0/#all/18a1" {
+		t.Errorf("want a feed with the fired alert linking to its email, got %+v", feed)
+	}
+}
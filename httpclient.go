@@ -0,0 +1,168 @@
+package gmailalert
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// HTTPClientConfig represents the timeouts and connection pooling of an HTTP
+// client. Zero fields keep their defaults.
+type HTTPClientConfig struct {
+	// The time limit for each request, including reading the response, as a
+	// duration like "30s". Defaults to 30s.
+	Timeout string `json:"timeout"`
+	// The interval between keep-alive probes of open connections, as a
+	// duration like "30s". Defaults to 30s.
+	KeepAlive string `json:"keepalive"`
+	// How long an idle connection is kept open for reuse, as a duration like
+	// "90s". Defaults to 90s.
+	IdleConnTimeout string `json:"idleconntimeout"`
+	// The maximum number of idle connections kept open. Defaults to 100.
+	MaxIdleConns int `json:"maxidleconns"`
+	// The maximum number of idle connections kept open to each host.
+	// Defaults to 2.
+	MaxIdleConnsPerHost int `json:"maxidleconnsperhost"`
+}
+
+// HTTPConfig represents the timeouts and connection pooling of the HTTP
+// clients sending requests to the Gmail and Pushover APIs. Its fields apply
+// to both clients, and the fields set in Gmail or Pushover override them for
+// that client.
+type HTTPConfig struct {
+	HTTPClientConfig
+	// The settings overriding those of the Gmail client, which also sends
+	// the requests refreshing the Google OAuth2 token.
+	Gmail *HTTPClientConfig `json:"gmail"`
+	// The settings overriding those of the Pushover client.
+	Pushover *HTTPClientConfig `json:"pushover"`
+}
+
+// GmailHTTPClient returns an *http.Client for sending requests to the Gmail
+// and Google OAuth2 APIs with the HTTP settings and proxy of the AlertConfig
+// receiver c. An error is returned if any of the settings are invalid.
+func (c AlertConfig) GmailHTTPClient() (*http.Client, error) {
+	return newHTTPClient(c.Proxy.gmail(), c.gmailHTTPConfig())
+}
+
+// gmailHTTPConfig returns the HTTP settings of the Gmail client of the
+// AlertConfig receiver c.
+func (c AlertConfig) gmailHTTPConfig() HTTPClientConfig {
+	if c.HTTP == nil {
+		return HTTPClientConfig{}
+	}
+
+	return c.HTTP.HTTPClientConfig.merge(c.HTTP.Gmail)
+}
+
+// PushoverHTTPClient returns an *http.Client for sending requests to the
+// Pushover API with the HTTP settings and proxy of the AlertConfig receiver
+// c. An error is returned if any of the settings are invalid.
+func (c AlertConfig) PushoverHTTPClient() (*http.Client, error) {
+	var cfg HTTPClientConfig
+	if c.HTTP != nil {
+		cfg = c.HTTP.HTTPClientConfig.merge(c.HTTP.Pushover)
+	}
+
+	return newHTTPClient(c.Proxy.pushover(), cfg)
+}
+
+// merge returns the HTTPClientConfig receiver c with its fields overridden by
+// the non-zero fields of the given HTTPClientConfig, which may be nil.
+func (c HTTPClientConfig) merge(override *HTTPClientConfig) HTTPClientConfig {
+	if override == nil {
+		return c
+	}
+
+	c.Timeout = firstNonEmpty(override.Timeout, c.Timeout)
+	c.KeepAlive = firstNonEmpty(override.KeepAlive, c.KeepAlive)
+	c.IdleConnTimeout = firstNonEmpty(override.IdleConnTimeout, c.IdleConnTimeout)
+	if override.MaxIdleConns != 0 {
+		c.MaxIdleConns = override.MaxIdleConns
+	}
+	if override.MaxIdleConnsPerHost != 0 {
+		c.MaxIdleConnsPerHost = override.MaxIdleConnsPerHost
+	}
+
+	return c
+}
+
+// newHTTPClient returns an *http.Client sending requests through the proxy
+// with the given URL, or through the proxy named by the environment if the
+// URL is empty, with the given settings. An error is returned if the URL or
+// any of the settings are invalid.
+func newHTTPClient(proxyURL string, cfg HTTPClientConfig) (*http.Client, error) {
+	u, err := parseProxyURL(proxyURL)
+	if err != nil {
+		return nil, err
+	}
+	timeout, err := parsePositiveDuration("http timeout", cfg.Timeout, 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	keepAlive, err := parsePositiveDuration("http keep-alive interval", cfg.KeepAlive, 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	idleConnTimeout, err := parsePositiveDuration("http idle connection timeout", cfg.IdleConnTimeout, 90*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.MaxIdleConns < 0 || cfg.MaxIdleConnsPerHost < 0 {
+		return nil, fmt.Errorf("http maximum idle connections must not be negative, got %d and %d per host",
+			cfg.MaxIdleConns, cfg.MaxIdleConnsPerHost)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	switch {
+	case u != nil && u.Scheme == "ssh":
+		transport.Proxy = sshProxy(u)
+	case u != nil:
+		transport.Proxy = http.ProxyURL(u)
+	}
+	transport.DialContext = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: keepAlive}).DialContext
+	transport.IdleConnTimeout = idleConnTimeout
+	if cfg.MaxIdleConns > 0 {
+		transport.MaxIdleConns = cfg.MaxIdleConns
+	}
+	if cfg.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	}
+
+	return &http.Client{Transport: transport, Timeout: timeout}, nil
+}
+
+// adapterHTTPClient returns an *http.Client with the given timeout for a
+// notifier adapter, like a Webhook or Heartbeat, sending its requests through
+// the proxy or SSH tunnel with the given URL, or through the proxy named by
+// the environment if the URL is empty. An error is returned if the URL is
+// invalid.
+func adapterHTTPClient(proxyURL string, timeout time.Duration) (*http.Client, error) {
+	if proxyURL == "" {
+		return &http.Client{Timeout: timeout}, nil
+	}
+	client, err := newHTTPClient(proxyURL, HTTPClientConfig{})
+	if err != nil {
+		return nil, err
+	}
+	client.Timeout = timeout
+
+	return client, nil
+}
+
+// parsePositiveDuration parses the given duration, returning the given
+// default if it is empty. An error naming the duration with the given
+// description is returned if it is invalid or not positive.
+func parsePositiveDuration(desc, s string, def time.Duration) (time.Duration, error) {
+	if s == "" {
+		return def, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%s must be a positive duration, got %q", desc, s)
+	}
+
+	return d, nil
+}
@@ -0,0 +1,97 @@
+package gmailalert
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHTTPClientConfigMerge(t *testing.T) {
+	t.Parallel()
+
+	global := HTTPClientConfig{Timeout: "10s", KeepAlive: "15s", MaxIdleConns: 10}
+	testCases := map[string]struct {
+		override *HTTPClientConfig
+		want     HTTPClientConfig
+	}{
+		"Nil override keeps the global settings": {
+			override: nil,
+			want:     global,
+		},
+		"Non-zero override fields replace the global settings": {
+			override: &HTTPClientConfig{Timeout: "1m", MaxIdleConnsPerHost: 4},
+			want:     HTTPClientConfig{Timeout: "1m", KeepAlive: "15s", MaxIdleConns: 10, MaxIdleConnsPerHost: 4},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got := global.merge(tc.override)
+
+			if !cmp.Equal(tc.want, got) {
+				t.Errorf("want != got\ndiff=%s", cmp.Diff(tc.want, got))
+			}
+		})
+	}
+}
+
+func TestAlertConfigHTTPClientsUseHTTPSettings(t *testing.T) {
+	t.Parallel()
+
+	cfg := AlertConfig{HTTP: &HTTPConfig{
+		HTTPClientConfig: HTTPClientConfig{Timeout: "20s", IdleConnTimeout: "2m", MaxIdleConnsPerHost: 5},
+		Pushover:         &HTTPClientConfig{Timeout: "5s"},
+	}}
+
+	gmailClient, err := cfg.GmailHTTPClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pushoverClient, err := cfg.PushoverHTTPClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if gmailClient.Timeout != 20*time.Second || pushoverClient.Timeout != 5*time.Second {
+		t.Errorf("want timeouts 20s and 5s, got %s and %s", gmailClient.Timeout, pushoverClient.Timeout)
+	}
+	transport := pushoverClient.Transport.(*http.Transport)
+	if transport.IdleConnTimeout != 2*time.Minute || transport.MaxIdleConnsPerHost != 5 {
+		t.Errorf("want idle connection timeout 2m and 5 idle connections per host, got %s and %d",
+			transport.IdleConnTimeout, transport.MaxIdleConnsPerHost)
+	}
+}
+
+func TestNewHTTPClientDefaultsTimeout(t *testing.T) {
+	t.Parallel()
+
+	c, err := newHTTPClient("", HTTPClientConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Timeout != 30*time.Second {
+		t.Errorf("want default timeout 30s, got %s", c.Timeout)
+	}
+}
+
+func TestNewHTTPClientWithInvalidSettingsReturnsError(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]HTTPClientConfig{
+		"Invalid timeout":               {Timeout: "soon"},
+		"Non-positive keep-alive":       {KeepAlive: "0s"},
+		"Invalid idle timeout":          {IdleConnTimeout: "-1m"},
+		"Negative max idle connections": {MaxIdleConns: -1},
+	}
+
+	for name, cfg := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := newHTTPClient("", cfg); err == nil {
+				t.Error("expected an error but did not get one")
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package gmailalert
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// HistoryReader is the interface that wraps the HistoryID method used by any
+// types implementing reading the current history point of a mailbox, which
+// changes whenever an email is added, deleted, or relabeled.
+type HistoryReader interface {
+	HistoryID() (uint64, error)
+}
+
+// ChangeTracker remembers the alerts whose last evaluation found no emails,
+// along with the history point of the mailbox at the time, so that an
+// Alerter can skip evaluating them again until the mailbox or the alert
+// changes. It is safe for concurrent use by multiple goroutines.
+type ChangeTracker struct {
+	mtx sync.Mutex
+	// The fingerprints of the alerts whose last evaluation found no emails,
+	// by alert.
+	quiet map[string]string
+}
+
+// NewChangeTracker returns a new ChangeTracker without any alerts.
+func NewChangeTracker() *ChangeTracker {
+	return &ChangeTracker{quiet: map[string]string{}}
+}
+
+// WithAlerterChangeTracker accepts a ChangeTracker and returns a functional
+// option for making an Alerter skip the alerts whose last evaluation found
+// no emails while the mailbox has not changed since, if its Matcher
+// implements HistoryReader.
+func WithAlerterChangeTracker(t *ChangeTracker) AlerterOption {
+	return func(a *Alerter) {
+		a.Changes = t
+	}
+}
+
+// unchanged reports whether the last evaluation of the alert with the given
+// key found no emails and had the given fingerprint.
+func (t *ChangeTracker) unchanged(key, fingerprint string) bool {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	return fingerprint != "" && t.quiet[key] == fingerprint
+}
+
+// record remembers the given fingerprint of the alert with the given key if
+// the given AlertResult of its evaluation found no emails, and forgets the
+// alert otherwise.
+func (t *ChangeTracker) record(key, fingerprint string, res AlertResult) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if fingerprint == "" || res.Err != nil || res.Matches > 0 || res.Notified || res.Suppressed {
+		delete(t.quiet, key)
+		return
+	}
+	t.quiet[key] = fingerprint
+}
+
+// changeFingerprint returns the fingerprint of the evaluation of the given
+// Alert at the given history point of the mailbox, which is a hash of both,
+// or an empty string if the emails matching the Alert can change without
+// the mailbox changing, like with relative dates in its query or a max age.
+func changeFingerprint(alt Alert, historyID uint64) string {
+	if alt.NewerThan != "" || alt.MaxAge != "" {
+		return ""
+	}
+	for _, query := range alt.gmailQueries() {
+		if strings.Contains(query, "newer_than:") || strings.Contains(query, "older_than:") {
+			return ""
+		}
+	}
+	b, err := json.Marshal(alt)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d\n%s", historyID, b)))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// historyID returns the current history point of the mailbox of the
+// Alerter's Matcher, or 0 if the Alerter has no ChangeTracker, its Matcher
+// does not implement HistoryReader, or the history point cannot be read, in
+// which case every alert is evaluated.
+func (a Alerter) historyID() uint64 {
+	if a.Changes == nil {
+		return 0
+	}
+	reader, ok := a.Matcher.(HistoryReader)
+	if !ok {
+		return 0
+	}
+	id, err := reader.HistoryID()
+	if err != nil {
+		a.errorLog().Printf("got error reading mailbox history point, evaluating every alert: %v", err)
+		return 0
+	}
+
+	return id
+}
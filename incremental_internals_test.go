@@ -0,0 +1,141 @@
+package gmailalert
+
+import (
+	"io"
+	"log"
+	"sync"
+	"testing"
+)
+
+// historyMatcher is a Matcher and HistoryReader counting the queries it
+// runs and returning the configured matches of each query.
+type historyMatcher struct {
+	mtx     sync.Mutex
+	history uint64
+	matches map[string][]Message
+	queries map[string]int
+}
+
+func (h *historyMatcher) Match(query string) ([]string, error) {
+	msgs, err := h.MatchMessages(query)
+	return messageIDs(msgs), err
+}
+
+func (h *historyMatcher) MatchMessages(query string) ([]Message, error) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.queries[query]++
+	return h.matches[query], nil
+}
+
+func (h *historyMatcher) HistoryID() (uint64, error) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	return h.history, nil
+}
+
+func TestAlerterSkipsUnchangedAlerts(t *testing.T) {
+	t.Parallel()
+
+	m := &historyMatcher{
+		history: 100,
+		matches: map[string][]Message{"from:bank": {{ID: "1"}}},
+		queries: map[string]int{},
+	}
+	a := Alerter{
+		Matcher:  m,
+		Notifier: &recordingTestNotifier{},
+		Logger:   log.New(io.Discard, "", 0),
+		Changes:  NewChangeTracker(),
+	}
+	alerts := []Alert{
+		{Name: "quiet", GmailQuery: "from:boss", PushoverTitle: "t", PushoverSound: "s", PushoverTarget: "u"},
+		{Name: "matching", GmailQuery: "from:bank", PushoverTitle: "t", PushoverSound: "s", PushoverTarget: "u"},
+		{Name: "relative", GmailQuery: "from:boss newer_than:1d", PushoverTitle: "t", PushoverSound: "s", PushoverTarget: "u"},
+	}
+
+	a.run(alerts)
+	summary := a.run(alerts)
+
+	if summary.Unchanged() != 1 || !summary.Results[0].Unchanged {
+		t.Errorf("want only the quiet alert skipped, got results %+v", summary.Results)
+	}
+	want := map[string]int{"from:boss": 1, "from:bank": 2, "from:boss newer_than:1d": 2}
+	for query, n := range want {
+		if m.queries[query] != n {
+			t.Errorf("want query %q run %d times, got %d", query, n, m.queries[query])
+		}
+	}
+
+	m.history = 101
+	a.run(alerts)
+	if m.queries["from:boss"] != 2 {
+		t.Errorf("want quiet alert evaluated again after the mailbox changed, got %d queries", m.queries["from:boss"])
+	}
+
+	alerts[0].GmailQuery = "from:boss is:unread"
+	a.run(alerts)
+	if m.queries["from:boss is:unread"] != 1 {
+		t.Error("want changed alert evaluated again while the mailbox is unchanged")
+	}
+}
+
+func TestChangeFingerprint(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		alert     Alert
+		wantEmpty bool
+	}{
+		"Plain query has a fingerprint": {
+			alert: Alert{GmailQuery: "from:bank"},
+		},
+		"Query with newer_than has no fingerprint": {
+			alert:     Alert{GmailQuery: "from:bank newer_than:2d"},
+			wantEmpty: true,
+		},
+		"Query with older_than has no fingerprint": {
+			alert:     Alert{GmailQuery: "older_than:1y"},
+			wantEmpty: true,
+		},
+		"Alert with newerthan has no fingerprint": {
+			alert:     Alert{From: "bank", NewerThan: "1d"},
+			wantEmpty: true,
+		},
+		"Alert with max age has no fingerprint": {
+			alert:     Alert{GmailQuery: "from:bank", MaxAge: "1h"},
+			wantEmpty: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got := changeFingerprint(tc.alert, 1)
+			if (got == "") != tc.wantEmpty {
+				t.Fatalf("want empty fingerprint %t, got %q", tc.wantEmpty, got)
+			}
+			if !tc.wantEmpty && got == changeFingerprint(tc.alert, 2) {
+				t.Error("want a changed history point to change the fingerprint")
+			}
+		})
+	}
+}
+
+func TestAlerterWithoutHistoryReaderEvaluatesEveryAlert(t *testing.T) {
+	t.Parallel()
+
+	a := Alerter{
+		Matcher:  fakePreviewFetcher{},
+		Notifier: &recordingTestNotifier{},
+		Logger:   log.New(io.Discard, "", 0),
+		Changes:  NewChangeTracker(),
+	}
+	alerts := []Alert{{Name: "quiet", GmailQuery: "from:boss", PushoverTitle: "t", PushoverSound: "s", PushoverTarget: "u"}}
+
+	a.run(alerts)
+	summary := a.run(alerts)
+
+	if summary.Unchanged() != 0 {
+		t.Errorf("want no alerts skipped without a history point, got %d", summary.Unchanged())
+	}
+}
@@ -0,0 +1,58 @@
+package gmailalert
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrHistoryExpired is returned by a LabelWatcher when the mailbox history
+// it was asked for is no longer available, in which case changes made since
+// then cannot be reported.
+var ErrHistoryExpired = errors.New("mailbox history is no longer available")
+
+// LabelWatcher is the interface that wraps the LabelChanges method used by
+// any types implementing detection of labels being added to or removed from
+// email messages.
+//
+// LabelChanges returns the messages that gained (if added is true) or lost
+// the label with the given name since the mailbox history point identified
+// by since, along with the current mailbox history point. If since is zero,
+// no messages are returned and only the current history point is. If the
+// history since that point is no longer available, ErrHistoryExpired is
+// returned along with the current history point.
+type LabelWatcher interface {
+	LabelChanges(label string, added bool, since uint64) ([]Message, uint64, error)
+}
+
+// labelChanges returns the messages that gained or lost the label watched by
+// the given Alert since the Alert was last evaluated, and records the
+// current mailbox history point with the given StoreTx for the next
+// evaluation. On the first evaluation of the Alert, no messages are
+// returned. An error is returned if the StoreTx is nil because the Alerter
+// has no State, if its Matcher does not implement LabelWatcher, or if the
+// label changes cannot be retrieved.
+func (a Alerter) labelChanges(tx StoreTx, alt Alert, label string, added bool) ([]Message, error) {
+	if tx == nil {
+		return nil, errors.New("label alerts require the notification history to be persisted")
+	}
+	watcher, ok := a.Matcher.(LabelWatcher)
+	if !ok {
+		return nil, fmt.Errorf("matcher %T must implement LabelWatcher to watch labels", a.Matcher)
+	}
+
+	st := tx.Get(alt.key())
+	msgs, historyID, err := watcher.LabelChanges(label, added, st.HistoryID)
+	switch {
+	case errors.Is(err, ErrHistoryExpired):
+		a.errorLog().Printf("label changes before the current mailbox history point were missed: %v", err)
+	case err != nil:
+		return nil, err
+	case st.HistoryID == 0:
+		a.Logger.Printf("started watching label %q from mailbox history point %d", label, historyID)
+	}
+
+	st.HistoryID = historyID
+	tx.Set(alt.key(), st)
+
+	return msgs, nil
+}
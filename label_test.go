@@ -0,0 +1,205 @@
+package gmailalert_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/aculclasure/gmailalert"
+)
+
+func TestAlertOKWithLabels(t *testing.T) {
+	t.Parallel()
+
+	base := gmailalert.Alert{
+		PushoverTarget: "test",
+		PushoverTitle:  "test",
+		PushoverSound:  "test",
+		PushoverMsg:    "test",
+	}
+	testCases := map[string]struct {
+		query        string
+		labelAdded   string
+		labelRemoved string
+		category     string
+		errExpected  bool
+	}{
+		"Added label without query is valid": {
+			labelAdded: "Banking",
+		},
+		"Removed label without query is valid": {
+			labelRemoved: "INBOX",
+		},
+		"Label with query returns an error": {
+			query:       "is:unread",
+			labelAdded:  "Banking",
+			errExpected: true,
+		},
+		"Added and removed labels return an error": {
+			labelAdded:   "Banking",
+			labelRemoved: "INBOX",
+			errExpected:  true,
+		},
+		"Label with a category returns an error": {
+			labelAdded:  "Banking",
+			category:    "updates",
+			errExpected: true,
+		},
+		"Query with a category is valid": {
+			query:    "is:unread",
+			category: "updates",
+		},
+		"Query with an unknown category returns an error": {
+			query:       "is:unread",
+			category:    "newsletters",
+			errExpected: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			alt := base
+			alt.GmailQuery, alt.LabelAdded, alt.LabelRemoved = tc.query, tc.labelAdded, tc.labelRemoved
+			alt.Category = tc.category
+
+			errReceived := alt.OK() != nil
+
+			if tc.errExpected != errReceived {
+				t.Errorf("got unexpected error status %v", errReceived)
+			}
+		})
+	}
+}
+
+func TestProcessLabelAlerts(t *testing.T) {
+	t.Parallel()
+
+	t.Run("label changes since the previous run are notified", func(t *testing.T) {
+		state, err := gmailalert.LoadState(filepath.Join(t.TempDir(), "state.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		watcher := &fakeLabelWatcher{
+			historyID: 100,
+			changes:   []gmailalert.Message{{ID: "id0"}},
+		}
+		recNotif := &recordingNotifier{}
+		alt := gmailalert.Alerter{
+			Matcher:  watcher,
+			Notifier: recNotif,
+			Logger:   &spyLogger{},
+			State:    state,
+		}
+		alerts := []gmailalert.Alert{{Name: "banking", LabelAdded: "Banking"}}
+
+		for i := 0; i < 2; i++ {
+			if err := alt.Process(alerts); err != nil {
+				t.Fatalf("got unexpected error: %v", err)
+			}
+		}
+
+		if len(recNotif.alerts) != 1 {
+			t.Fatalf("wanted only the second run to notify, got %d notifications", len(recNotif.alerts))
+		}
+		if want := `Found 1 emails that gained label "Banking"`; recNotif.alerts[0].PushoverMsg != want {
+			t.Errorf("want message %q, got %q", want, recNotif.alerts[0].PushoverMsg)
+		}
+		if got := watcher.since; got != 100 {
+			t.Errorf("wanted the second run to continue from history point 100, got %d", got)
+		}
+		if got := state.Get("banking").HistoryID; got != 100 {
+			t.Errorf("wanted history point 100 in state, got %d", got)
+		}
+	})
+
+	t.Run("expired history is logged and restarted", func(t *testing.T) {
+		state, err := gmailalert.LoadState(filepath.Join(t.TempDir(), "state.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		state.Set("banking", gmailalert.AlertState{HistoryID: 5})
+		spyNotif := &spyNotifier{}
+		alt := gmailalert.Alerter{
+			Matcher:  &fakeLabelWatcher{historyID: 100, err: gmailalert.ErrHistoryExpired},
+			Notifier: spyNotif,
+			Logger:   &spyLogger{},
+			State:    state,
+		}
+
+		if err := alt.Process([]gmailalert.Alert{{Name: "banking", LabelAdded: "Banking"}}); err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		if spyNotif.numCalls != 0 {
+			t.Errorf("wanted 0 notifications to be sent, got %d", spyNotif.numCalls)
+		}
+		if got := state.Get("banking").HistoryID; got != 100 {
+			t.Errorf("wanted history point 100 in state, got %d", got)
+		}
+	})
+
+	t.Run("label changes whose notification failed are found again", func(t *testing.T) {
+		state, err := gmailalert.LoadState(filepath.Join(t.TempDir(), "state.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		state.Set("banking", gmailalert.AlertState{HistoryID: 5})
+		alt := gmailalert.Alerter{
+			Matcher: &fakeLabelWatcher{
+				historyID: 100,
+				changes:   []gmailalert.Message{{ID: "id0"}},
+			},
+			Notifier: fakeNotifier{err: errors.New("push failed")},
+			Logger:   &spyLogger{},
+			State:    state,
+		}
+
+		if err := alt.Process([]gmailalert.Alert{{Name: "banking", LabelAdded: "Banking"}}); err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		if got := state.Get("banking").HistoryID; got != 5 {
+			t.Errorf("wanted history point 5 to be kept in state, got %d", got)
+		}
+	})
+
+	t.Run("label alerts without state are logged as errors", func(t *testing.T) {
+		spyLog := &spyLogger{}
+		alt := gmailalert.Alerter{
+			Matcher:  &fakeLabelWatcher{historyID: 100},
+			Notifier: fakeNotifier{},
+			Logger:   spyLog,
+		}
+
+		if err := alt.Process([]gmailalert.Alert{{LabelRemoved: "INBOX"}}); err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		if spyLog.numErrCalls != 1 {
+			t.Errorf("wanted 1 error to be logged, got %d", spyLog.numErrCalls)
+		}
+	})
+}
+
+// fakeLabelWatcher represents a test double type that implements the
+// Matcher and LabelWatcher interfaces. Its LabelChanges method returns the
+// changes, historyID, and err values it was created with, or only the
+// historyID if it is asked for the changes since history point zero. It
+// records the history point it was last asked for.
+type fakeLabelWatcher struct {
+	fakeMatcher
+	changes   []gmailalert.Message
+	historyID uint64
+	err       error
+	since     uint64
+}
+
+// LabelChanges records since in the receiver f and returns the changes,
+// historyID, and err fields of the receiver f.
+func (f *fakeLabelWatcher) LabelChanges(_ string, _ bool, since uint64) ([]gmailalert.Message, uint64, error) {
+	f.since = since
+	if since == 0 {
+		return nil, f.historyID, nil
+	}
+	return f.changes, f.historyID, f.err
+}
@@ -0,0 +1,182 @@
+package gmailalert
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// maxLanguageBodyBytes is the number of bytes of an email's body that are
+// read to detect its language.
+const maxLanguageBodyBytes = 64 << 10
+
+// LanguageDetector is the interface that wraps the DetectLanguage method used
+// by any types implementing detection of the language of a text.
+// DetectLanguage returns the lowercase ISO 639-1 code of the language of the
+// given text, like "en", or an empty string if it cannot be detected.
+type LanguageDetector interface {
+	DetectLanguage(text string) string
+}
+
+// WithAlerterLanguageDetector accepts a LanguageDetector and returns a
+// functional option for wiring the LanguageDetector to an Alerter, in place
+// of the built-in one.
+func WithAlerterLanguageDetector(d LanguageDetector) AlerterOption {
+	return func(a *Alerter) {
+		a.LanguageDetector = d
+	}
+}
+
+// languageCode matches an ISO 639-1 language code.
+var languageCode = regexp.MustCompile(`^[a-z]{2}$`)
+
+// inLanguages accepts an Alert with languages and the messages matching the
+// Alert, fetches the body of each message, and returns the messages written
+// in one of the Alert's languages. Messages whose language cannot be
+// detected are kept. An error is returned if the Alerter's Matcher does not
+// implement RawFetcher or if there is a problem fetching a message.
+func (a Alerter) inLanguages(alt Alert, matches []Message) ([]Message, error) {
+	fetcher, ok := a.Matcher.(RawFetcher)
+	if !ok {
+		return nil, fmt.Errorf("matcher %T must implement RawFetcher to filter by language", a.Matcher)
+	}
+	var detector LanguageDetector = stopwordDetector{}
+	if a.LanguageDetector != nil {
+		detector = a.LanguageDetector
+	}
+
+	kept := make([]Message, 0, len(matches))
+	for _, m := range matches {
+		raw, err := fetchRaw(fetcher, alt, m.ID)
+		if err != nil {
+			return nil, err
+		}
+		text, err := bodyText(bytes.NewReader(raw), maxLanguageBodyBytes)
+		if err != nil {
+			a.errorLog().Printf("got error reading body of email %s, keeping it: %v", m.ID, err)
+			kept = append(kept, m)
+			continue
+		}
+
+		lang := detector.DetectLanguage(text)
+		if lang == "" || containsString(alt.Languages, lang) {
+			kept = append(kept, m)
+		}
+	}
+
+	if ignored := len(matches) - len(kept); ignored > 0 {
+		a.Logger.Printf("ignored %d emails not in %s matching alert %q",
+			ignored, strings.Join(alt.Languages, ", "), alt.key())
+	}
+
+	return kept, nil
+}
+
+// scriptLanguages maps the writing systems that are mostly used by a single
+// language to that language. Texts mostly written in Han characters are
+// Japanese if they contain any kana.
+var scriptLanguages = []struct {
+	script *unicode.RangeTable
+	lang   string
+}{
+	{unicode.Han, "zh"},
+	{unicode.Hangul, "ko"},
+	{unicode.Cyrillic, "ru"},
+	{unicode.Greek, "el"},
+	{unicode.Arabic, "ar"},
+	{unicode.Hebrew, "he"},
+	{unicode.Thai, "th"},
+}
+
+// stopwords maps the languages written in Latin script that are detected by
+// the stopwordDetector to some of their most frequent words.
+var stopwords = map[string][]string{
+	"de": {"der", "die", "und", "das", "ist", "nicht", "ein", "eine", "zu", "den", "mit", "sie", "ich", "auf", "für", "dem", "ihr", "wir", "auch", "sich"},
+	"en": {"the", "and", "of", "to", "is", "in", "that", "for", "you", "with", "your", "this", "are", "have", "on", "be", "it", "not", "will", "from"},
+	"es": {"el", "la", "los", "las", "y", "es", "que", "una", "por", "para", "con", "su", "del", "al", "usted", "lo", "pero", "como", "gracias", "está"},
+	"fr": {"le", "la", "les", "et", "est", "des", "une", "pour", "vous", "dans", "qui", "pas", "sur", "avec", "au", "du", "votre", "nous", "ce", "mais"},
+	"it": {"il", "della", "che", "di", "per", "non", "sono", "gli", "con", "del", "alla", "questo", "anche", "più", "ma", "come", "suo", "essere", "grazie", "una"},
+	"nl": {"de", "het", "een", "en", "van", "is", "dat", "niet", "op", "te", "voor", "met", "zijn", "je", "uw", "wij", "ook", "naar", "maar", "bij"},
+	"pt": {"o", "os", "as", "e", "não", "um", "uma", "para", "com", "do", "da", "em", "que", "seu", "sua", "você", "obrigado", "mais", "é", "dos"},
+}
+
+// stopwordDetector is the built-in LanguageDetector. It detects languages
+// with their own writing system by the script most of a text is written in,
+// and German, English, Spanish, French, Italian, Dutch, and Portuguese by
+// counting their most frequent words.
+type stopwordDetector struct{}
+
+// DetectLanguage returns the ISO 639-1 code of the language of the given
+// text, or an empty string if it cannot be detected.
+func (stopwordDetector) DetectLanguage(text string) string {
+	var latin, kana int
+	scripts := make([]int, len(scriptLanguages))
+	for _, r := range text {
+		switch {
+		case unicode.In(r, unicode.Latin):
+			latin++
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			kana++
+		default:
+			for i, s := range scriptLanguages {
+				if unicode.Is(s.script, r) {
+					scripts[i]++
+					break
+				}
+			}
+		}
+	}
+
+	best := 0
+	for i := range scripts {
+		if scripts[i] > scripts[best] {
+			best = i
+		}
+	}
+	if scripts[best]+kana > latin {
+		if kana > 0 && (scriptLanguages[best].lang == "zh" || kana >= scripts[best]) {
+			return "ja"
+		}
+		return scriptLanguages[best].lang
+	}
+
+	return detectByStopwords(text)
+}
+
+// detectByStopwords returns the language whose most frequent words occur
+// most often in the given text, or an empty string if no language has at
+// least two occurrences more than any other.
+func detectByStopwords(text string) string {
+	counts := map[string]int{}
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	for _, w := range words {
+		for lang, sw := range stopwords {
+			if containsString(sw, w) {
+				counts[lang]++
+			}
+		}
+	}
+
+	langs := make([]string, 0, len(counts))
+	for lang := range counts {
+		langs = append(langs, lang)
+	}
+	sort.Slice(langs, func(i, j int) bool {
+		if counts[langs[i]] == counts[langs[j]] {
+			return langs[i] < langs[j]
+		}
+		return counts[langs[i]] > counts[langs[j]]
+	})
+
+	if len(langs) == 0 || counts[langs[0]] < 2 ||
+		(len(langs) > 1 && counts[langs[0]]-counts[langs[1]] < 2) {
+		return ""
+	}
+
+	return langs[0]
+}
@@ -0,0 +1,53 @@
+package gmailalert
+
+import "testing"
+
+func TestStopwordDetector(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		text string
+		want string
+	}{
+		"English": {
+			text: "Your order has shipped and will arrive on Monday. Thank you for shopping with us.",
+			want: "en",
+		},
+		"German": {
+			text: "Ihre Bestellung ist unterwegs und wird am Montag bei Ihnen sein. Vielen Dank für die Bestellung.",
+			want: "de",
+		},
+		"French": {
+			text: "Votre commande est en route et arrivera lundi. Merci pour votre achat avec nous.",
+			want: "fr",
+		},
+		"Spanish": {
+			text: "Su pedido está en camino y llegará el lunes. Gracias por su compra con nosotros.",
+			want: "es",
+		},
+		"Russian by script": {
+			text: "Ваш заказ отправлен и прибудет в понедельник.",
+			want: "ru",
+		},
+		"Japanese by kana": {
+			text: "ご注文の商品を発送しました。",
+			want: "ja",
+		},
+		"Chinese by script": {
+			text: "您的订单已发货。",
+			want: "zh",
+		},
+		"Too short to detect": {
+			text: "Invoice 1234",
+		},
+		"Empty text": {},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if got := (stopwordDetector{}).DetectLanguage(tc.text); tc.want != got {
+				t.Errorf("want language %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
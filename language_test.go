@@ -0,0 +1,139 @@
+package gmailalert_test
+
+import (
+	"testing"
+
+	"github.com/aculclasure/gmailalert"
+)
+
+// fixedDetector represents a test double type that implements the
+// LanguageDetector interface. It detects the language stored under a text
+// in the langs field.
+type fixedDetector struct {
+	langs map[string]string
+}
+
+// DetectLanguage returns the language stored under text in the langs field
+// of the receiver d.
+func (d fixedDetector) DetectLanguage(text string) string {
+	return d.langs[text]
+}
+
+func TestProcessFiltersMatchesByLanguage(t *testing.T) {
+	t.Parallel()
+
+	matcher := fakeRawFetcher{
+		fakeMatcher: fakeMatcher{matches: []gmailalert.Message{{ID: "en"}, {ID: "de"}, {ID: "unknown"}}},
+		raw: map[string][]byte{
+			"en":      []byte("Subject: order\r\n\r\nYour order has shipped and is on the way to you.\r\n"),
+			"de":      []byte("Subject: order\r\n\r\nIhre Bestellung ist unterwegs und wird bald bei Ihnen sein.\r\n"),
+			"unknown": []byte("Subject: order\r\n\r\n1234\r\n"),
+		},
+	}
+
+	testCases := map[string]struct {
+		matcher     gmailalert.Matcher
+		detector    gmailalert.LanguageDetector
+		languages   []string
+		wantMatches int
+		errExpected bool
+	}{
+		"Built-in detector keeps wanted and undetected languages": {
+			matcher:     matcher,
+			languages:   []string{"en"},
+			wantMatches: 2,
+		},
+		"Several languages are kept": {
+			matcher:     matcher,
+			languages:   []string{"en", "de"},
+			wantMatches: 3,
+		},
+		"Configured detector is used": {
+			matcher: matcher,
+			detector: fixedDetector{langs: map[string]string{
+				"1234\r\n": "fr",
+			}},
+			languages:   []string{"fr"},
+			wantMatches: 3,
+		},
+		"Fetch error returns an error": {
+			matcher: fakeRawFetcher{
+				fakeMatcher: fakeMatcher{matches: []gmailalert.Message{{ID: "missing"}}},
+			},
+			languages:   []string{"en"},
+			errExpected: true,
+		},
+		"Non raw fetcher returns an error": {
+			matcher:     fakeMatcher{matches: []gmailalert.Message{{ID: "en"}}},
+			languages:   []string{"en"},
+			errExpected: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			reporter := &spyReporter{}
+			alerter, err := gmailalert.NewAlerter(tc.matcher, &recordingNotifier{},
+				gmailalert.WithAlerterLogger(&spyLogger{}),
+				gmailalert.WithAlerterReporter(reporter),
+				gmailalert.WithAlerterLanguageDetector(tc.detector))
+			if err != nil {
+				t.Fatal(err)
+			}
+			alerts := []gmailalert.Alert{{GmailQuery: "subject:order", Languages: tc.languages}}
+
+			if err := alerter.Process(alerts); err != nil {
+				t.Fatalf("got unexpected error: %v", err)
+			}
+
+			res := reporter.summaries[0].Results[0]
+			errReceived := res.Err != nil
+			if tc.errExpected != errReceived {
+				t.Fatalf("got unexpected error status, got error: %v", res.Err)
+			}
+			if !tc.errExpected && tc.wantMatches != res.Matches {
+				t.Errorf("want %d matches, got %d", tc.wantMatches, res.Matches)
+			}
+		})
+	}
+}
+
+func TestAlertOKWithLanguages(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		alt         gmailalert.Alert
+		errExpected bool
+	}{
+		"Language codes are valid": {
+			alt: gmailalert.Alert{GmailQuery: "is:unread", Languages: []string{"en", "de"}},
+		},
+		"Language name returns an error": {
+			alt:         gmailalert.Alert{GmailQuery: "is:unread", Languages: []string{"English"}},
+			errExpected: true,
+		},
+		"Uppercase language code returns an error": {
+			alt:         gmailalert.Alert{GmailQuery: "is:unread", Languages: []string{"EN"}},
+			errExpected: true,
+		},
+		"Languages with unread threshold return an error": {
+			alt:         gmailalert.Alert{UnreadAbove: 100, Languages: []string{"en"}},
+			errExpected: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			alt := tc.alt
+			alt.PushoverTarget, alt.PushoverTitle = "test", "test"
+			alt.PushoverSound, alt.PushoverMsg = "test", "test"
+
+			err := alt.OK()
+			errReceived := err != nil
+
+			if tc.errExpected != errReceived {
+				t.Errorf("got unexpected error status, got error: %v", err)
+			}
+		})
+	}
+}
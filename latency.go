@@ -0,0 +1,67 @@
+package gmailalert
+
+import (
+	"fmt"
+	"time"
+)
+
+// StageTimings represents how long each stage of the evaluation of an alert
+// took.
+type StageTimings struct {
+	// The time spent running the alert's Gmail query, or reading the label
+	// changes or unread count it watches.
+	Query time.Duration
+	// The time spent filtering the matching emails, like by max age or
+	// language, including fetching the details the filters need, and in
+	// hooks called after the query.
+	Filter time.Duration
+	// The time spent fetching what the notification includes, like the
+	// sender domains, the snippet, or an image.
+	Fetch time.Duration
+	// The time spent sending the notification, including retries.
+	Notify time.Duration
+}
+
+// Total returns the time spent in all stages of the StageTimings receiver.
+func (s StageTimings) Total() time.Duration {
+	return s.Query + s.Filter + s.Fetch + s.Notify
+}
+
+// String returns the time spent in each stage of the StageTimings receiver,
+// like "query 1.2s, filter 0s, fetch 300ms, notify 150ms".
+func (s StageTimings) String() string {
+	return fmt.Sprintf("query %s, filter %s, fetch %s, notify %s", s.Query, s.Filter, s.Fetch, s.Notify)
+}
+
+// WithAlerterLatencyBudget accepts a duration and returns a functional
+// option for making an Alerter warn about the evaluations of alerts taking
+// longer than the duration, unless an alert has a latency budget of its own.
+func WithAlerterLatencyBudget(d time.Duration) AlerterOption {
+	return func(a *Alerter) {
+		a.LatencyBudget = d
+	}
+}
+
+// stage returns a function that adds the time passed since stage was called
+// to the given duration, according to the Alerter's Clock.
+func (a Alerter) stage(d *time.Duration) func() {
+	start := a.now()
+	return func() {
+		*d += a.now().Sub(start)
+	}
+}
+
+// checkLatency logs a warning if the given StageTimings of the given Alert
+// add up to more than its latency budget, or the Alerter's if it has none.
+func (a Alerter) checkLatency(alt Alert, timings StageTimings) {
+	budget := a.LatencyBudget
+	if alt.LatencyBudget != "" {
+		budget, _ = time.ParseDuration(alt.LatencyBudget)
+	}
+	if budget <= 0 || timings.Total() <= budget {
+		return
+	}
+
+	a.errorLog().Printf("warning: alert %q took %s, over its latency budget of %s (%s)",
+		alt.key(), timings.Total(), budget, timings)
+}
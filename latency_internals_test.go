@@ -0,0 +1,88 @@
+package gmailalert
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAlerterChecksLatencyBudget(t *testing.T) {
+	t.Parallel()
+
+	raw := "From: billing@example.com\r\nSubject: Your bill\r\nDate: Wed, 1 Mar 2023 12:00:00 +0000\r\n\r\nPay up.\r\n"
+	f, err := newReplayFixture(replayedMessage{exportedMessage: exportedMessage{Message: Message{ID: "a"}, Raw: raw}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	matcher := replayMatcher{fixtures: []*replayFixture{f}}
+	bills := Alert{
+		Name:           "bills",
+		GmailQuery:     "from:billing",
+		PushoverTarget: "target",
+		PushoverTitle:  "Bill Due!",
+		PushoverSound:  "cashregister",
+		PushoverMsg:    "Bills",
+	}
+
+	testCases := map[string]struct {
+		alerterBudget time.Duration
+		alertBudget   string
+		wantWarning   bool
+	}{
+		"Alert over the alerter's budget is warned about": {
+			alerterBudget: 2 * time.Second,
+			wantWarning:   true,
+		},
+		"Alert's own budget overrides the alerter's": {
+			alerterBudget: 2 * time.Second,
+			alertBudget:   "1m",
+			wantWarning:   false,
+		},
+		"No budget logs no warning": {
+			wantWarning: false,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var mtx sync.Mutex
+			now := time.Date(2023, 3, 2, 12, 0, 0, 0, time.UTC)
+			clock := func() time.Time {
+				mtx.Lock()
+				defer mtx.Unlock()
+				now = now.Add(time.Second)
+				return now
+			}
+			buf := &bytes.Buffer{}
+			var summary Summary
+			alerter, err := NewAlerter(matcher, &replayNotifier{alerts: map[string]Alert{}},
+				WithAlerterLogger(log.New(buf, "", 0)),
+				WithAlerterClock(clock),
+				WithAlerterLatencyBudget(tc.alerterBudget),
+				WithAlerterReporter(replaySummary{summary: &summary}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			alt := bills
+			alt.LatencyBudget = tc.alertBudget
+
+			if err := alerter.Process([]Alert{alt}); err != nil {
+				t.Fatalf("got unexpected error: %v", err)
+			}
+
+			timings := summary.Results[0].Timings
+			for stage, d := range map[string]time.Duration{"query": timings.Query, "filter": timings.Filter, "fetch": timings.Fetch, "notify": timings.Notify} {
+				if d <= 0 {
+					t.Errorf("want %s stage to be timed, got %s", stage, d)
+				}
+			}
+			gotWarning := strings.Contains(buf.String(), "over its latency budget")
+			if tc.wantWarning != gotWarning {
+				t.Errorf("want latency warning %t, got %t in log:\n%s", tc.wantWarning, gotWarning, buf.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package gmailalert
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Lease represents the leadership of a group of redundant gmailalert
+// instances sharing a lease file, like on a shared volume, so that only the
+// instance holding the Lease sends notifications while the others stand by.
+// The lease file records the holder of the Lease and when it expires. The
+// holder renews the Lease before it expires, and a standby instance takes
+// the Lease over once the holder stops renewing it. A Lease is safe for
+// concurrent use by multiple goroutines.
+//
+// Since the lease file is replaced atomically but not locked, two instances
+// taking over an expired Lease at the same moment may both believe they hold
+// it until their next renewal.
+type Lease struct {
+	file   string
+	holder string
+	ttl    time.Duration
+	mtx    sync.Mutex
+}
+
+// leaseRecord represents the contents of a lease file.
+type leaseRecord struct {
+	Holder  string    `json:"holder"`
+	Expires time.Time `json:"expires"`
+}
+
+// NewLease accepts the name of a lease file, the name identifying the
+// instance, and how long the Lease is held without being renewed, and
+// returns a Lease. An error is returned if any of the arguments are empty or
+// the duration is not positive.
+func NewLease(file, holder string, ttl time.Duration) (*Lease, error) {
+	if file == "" || holder == "" {
+		return nil, errors.New("lease file and holder arguments must be non-empty")
+	}
+	if ttl <= 0 {
+		return nil, fmt.Errorf("lease duration must be positive, got %s", ttl)
+	}
+
+	return &Lease{file: file, holder: holder, ttl: ttl}, nil
+}
+
+// Acquire takes or renews the Lease for the instance of the Lease receiver l
+// if the Lease is free, expired, or already held by the instance, and reports
+// whether the instance holds the Lease. An error is returned if the lease
+// file cannot be read or written.
+func (l *Lease) Acquire() (bool, error) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	rec, err := l.read()
+	if err != nil {
+		return false, err
+	}
+	now := time.Now()
+	if rec.Holder != "" && rec.Holder != l.holder && now.Before(rec.Expires) {
+		return false, nil
+	}
+
+	if err := l.write(leaseRecord{Holder: l.holder, Expires: now.Add(l.ttl)}); err != nil {
+		return false, err
+	}
+	rec, err = l.read()
+	if err != nil {
+		return false, err
+	}
+
+	return rec.Holder == l.holder, nil
+}
+
+// Release gives up the Lease if it is held by the instance of the Lease
+// receiver l, so that a standby instance can take it over immediately. An
+// error is returned if the lease file cannot be read or written.
+func (l *Lease) Release() error {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	rec, err := l.read()
+	if err != nil || rec.Holder != l.holder {
+		return err
+	}
+
+	return l.write(leaseRecord{})
+}
+
+// Keep acquires the Lease every third of its duration, so that it is renewed
+// before it expires while held and taken over soon after it expires while
+// not, until the given context is cancelled. Changes of leadership and errors
+// are logged to the given Logger.
+func (l *Lease) Keep(ctx context.Context, logger Logger) {
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+
+	var held bool
+	for {
+		ok, err := l.Acquire()
+		switch {
+		case err != nil:
+			logger.Printf("got error acquiring lease: %v", err)
+		case ok && !held:
+			logger.Printf("acquired lease %s, this instance is now sending notifications", l.file)
+		case !ok && held:
+			logger.Printf("lost lease %s, this instance is now standing by", l.file)
+		}
+		held = ok
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ErrNotLeaseHolder is wrapped by the error of a Lease's Hook skipping a
+// notification because another instance holds the Lease. The Alerter then
+// discards the changes the evaluation made to its State, so that an instance
+// sharing the State with the lease holder does not overwrite them.
+var ErrNotLeaseHolder = errors.New("lease is held by another instance")
+
+// Hook returns a Hook that skips every notification while the instance of
+// the Lease receiver l does not hold the Lease, or the Lease cannot be
+// acquired.
+func (l *Lease) Hook() Hook {
+	return Hook{
+		BeforeNotify: func(_ *Alert) error {
+			ok, err := l.Acquire()
+			if err != nil {
+				return fmt.Errorf("%w: %v", ErrSkipNotification, err)
+			}
+			if !ok {
+				return fmt.Errorf("%w: %w: %s", ErrSkipNotification, ErrNotLeaseHolder, l.file)
+			}
+			return nil
+		},
+	}
+}
+
+// WithAlerterLease accepts a Lease and returns a functional option for
+// wiring the Lease to an Alerter, so that the Alerter only sends
+// notifications while it holds the Lease.
+func WithAlerterLease(l *Lease) AlerterOption {
+	return WithAlerterHook(l.Hook())
+}
+
+// read returns the record in the lease file, or an empty record if the file
+// does not exist. The caller must hold the Lease's mutex.
+func (l *Lease) read() (leaseRecord, error) {
+	b, err := os.ReadFile(l.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return leaseRecord{}, nil
+	}
+	if err != nil {
+		return leaseRecord{}, fmt.Errorf("got error reading lease file %s: %v", l.file, err)
+	}
+
+	var rec leaseRecord
+	if err := json.Unmarshal(b, &rec); err != nil {
+		return leaseRecord{}, fmt.Errorf("got error json-decoding lease file %s: %v", l.file, err)
+	}
+
+	return rec, nil
+}
+
+// write writes the given record into a temporary file unique to the instance
+// and renames it over the lease file. The caller must hold the Lease's
+// mutex.
+func (l *Lease) write(rec leaseRecord) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("got error json-encoding lease: %v", err)
+	}
+
+	tmp := fmt.Sprintf("%s.%x.tmp", l.file, l.holder)
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return fmt.Errorf("got error writing lease file %s: %v", tmp, err)
+	}
+	if err := os.Rename(tmp, l.file); err != nil {
+		return fmt.Errorf("got error replacing lease file %s: %v", l.file, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,192 @@
+package gmailalert_test
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aculclasure/gmailalert"
+)
+
+func TestNewLeaseWithInvalidArgumentsReturnsError(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		file   string
+		holder string
+		ttl    time.Duration
+	}{
+		"Empty file name":     {holder: "a", ttl: time.Minute},
+		"Empty holder":        {file: "lease.json", ttl: time.Minute},
+		"Non-positive period": {file: "lease.json", holder: "a"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := gmailalert.NewLease(tc.file, tc.holder, tc.ttl); err == nil {
+				t.Error("expected an error but did not get one")
+			}
+		})
+	}
+}
+
+func TestLeaseIsHeldByOneInstanceAtATime(t *testing.T) {
+	t.Parallel()
+
+	file := filepath.Join(t.TempDir(), "lease.json")
+	first, err := gmailalert.NewLease(file, "first", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := gmailalert.NewLease(file, "second", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, tc := range []struct {
+		lease *gmailalert.Lease
+		want  bool
+	}{{first, true}, {second, false}, {first, true}} {
+		got, err := tc.lease.Acquire()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.want != got {
+			t.Errorf("acquisition %d: want %t, got %t", i, tc.want, got)
+		}
+	}
+
+	if err := second.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if held, err := second.Acquire(); err != nil || held {
+		t.Errorf("wanted releasing a lease held by another instance to be a no-op, got held %t and error %v", held, err)
+	}
+	if err := first.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if held, err := second.Acquire(); err != nil || !held {
+		t.Errorf("wanted a released lease to be taken over, got held %t and error %v", held, err)
+	}
+}
+
+func TestLeaseIsTakenOverOnceExpired(t *testing.T) {
+	t.Parallel()
+
+	file := filepath.Join(t.TempDir(), "lease.json")
+	first, err := gmailalert.NewLease(file, "first", time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := gmailalert.NewLease(file, "second", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := first.Acquire(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	if held, err := second.Acquire(); err != nil || !held {
+		t.Errorf("wanted an expired lease to be taken over, got held %t and error %v", held, err)
+	}
+}
+
+func TestLeaseWithInvalidFileReturnsError(t *testing.T) {
+	t.Parallel()
+
+	file := filepath.Join(t.TempDir(), "lease.json")
+	if err := os.WriteFile(file, []byte("this-is-not-json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	l, err := gmailalert.NewLease(file, "first", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := l.Acquire(); err == nil {
+		t.Error("expected an error but did not get one")
+	}
+}
+
+func TestAlerterOnlyNotifiesWhileHoldingLease(t *testing.T) {
+	t.Parallel()
+
+	file := filepath.Join(t.TempDir(), "lease.json")
+	leader, err := gmailalert.NewLease(file, "leader", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	standby, err := gmailalert.NewLease(file, "standby", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := leader.Acquire(); err != nil {
+		t.Fatal(err)
+	}
+	bus := gmailalert.NewEventBus()
+	var sent, suppressed int
+	bus.Subscribe(func(e gmailalert.Event) { sent++ }, gmailalert.EventNotifySent)
+	bus.Subscribe(func(e gmailalert.Event) { suppressed++ }, gmailalert.EventAlertSuppressed)
+	state, err := gmailalert.LoadState(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &txCountingStore{State: state}
+	a, err := gmailalert.NewAlerter(
+		fakeMatcher{matches: []gmailalert.Message{{ID: "1"}}},
+		fakeNotifier{},
+		gmailalert.WithAlerterLogger(log.New(io.Discard, "", 0)),
+		gmailalert.WithAlerterEventBus(bus),
+		gmailalert.WithAlerterState(store),
+		gmailalert.WithAlerterLease(standby))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.Process([]gmailalert.Alert{{PushoverTarget: "abc", GmailQuery: "is:unread"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if sent != 0 || suppressed != 1 {
+		t.Errorf("wanted the standby instance to suppress its notification, got %d sent and %d suppressed", sent, suppressed)
+	}
+	if store.commits != 0 || store.rollbacks != 1 {
+		t.Errorf("wanted the standby instance to discard its state changes, got %d commits and %d rollbacks", store.commits, store.rollbacks)
+	}
+}
+
+// txCountingStore represents a Store counting the StoreTxs committed and
+// rolled back on the State it wraps.
+type txCountingStore struct {
+	*gmailalert.State
+	commits, rollbacks int
+}
+
+// Begin returns a StoreTx of the wrapped State counting its commit or
+// rollback in the receiver s.
+func (s *txCountingStore) Begin() gmailalert.StoreTx {
+	return countingTx{StoreTx: s.State.Begin(), store: s}
+}
+
+// countingTx represents a StoreTx counting its commit or rollback in its
+// txCountingStore.
+type countingTx struct {
+	gmailalert.StoreTx
+	store *txCountingStore
+}
+
+// Commit counts the commit and commits the wrapped StoreTx.
+func (t countingTx) Commit() error {
+	t.store.commits++
+	return t.StoreTx.Commit()
+}
+
+// Rollback counts the rollback and rolls back the wrapped StoreTx.
+func (t countingTx) Rollback() {
+	t.store.rollbacks++
+	t.StoreTx.Rollback()
+}
@@ -0,0 +1,186 @@
+package gmailalert
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// QueryIssue represents a likely mistake found in a Gmail query.
+type QueryIssue struct {
+	// The term of the query the issue was found in. It is empty for issues
+	// concerning the query as a whole, like unbalanced parentheses.
+	Term string
+	// A description of the issue.
+	Msg string
+}
+
+// String returns a human-readable description of the QueryIssue.
+func (q QueryIssue) String() string {
+	if q.Term == "" {
+		return q.Msg
+	}
+
+	return fmt.Sprintf("%q: %s", q.Term, q.Msg)
+}
+
+// queryOperatorValues maps each known Gmail search operator to a regular
+// expression its value must match, or to nil if any value is accepted.
+// See https://support.google.com/mail/answer/7190?hl=en
+var queryOperatorValues = map[string]*regexp.Regexp{
+	"from":        nil,
+	"to":          nil,
+	"cc":          nil,
+	"bcc":         nil,
+	"subject":     nil,
+	"label":       nil,
+	"list":        nil,
+	"filename":    nil,
+	"deliveredto": nil,
+	"rfc822msgid": nil,
+	"category":    regexp.MustCompile(`^(?i)(primary|social|promotions|updates|forums|reservations|purchases)$`),
+	"has":         regexp.MustCompile(`^(?i)(attachment|drive|document|spreadsheet|presentation|youtube|userlabels|nouserlabels|yellow-star|orange-star|red-star|purple-star|blue-star|green-star|red-bang|orange-guillemet|yellow-bang|green-check|blue-info|purple-question)$`),
+	"is":          regexp.MustCompile(`^(?i)(important|starred|unread|read|snoozed|muted)$`),
+	"in":          regexp.MustCompile(`^(?i)(anywhere|inbox|trash|spam|sent|drafts|snoozed|chats|important|starred)$`),
+	"after":       queryDateValue,
+	"before":      queryDateValue,
+	"older":       queryDateValue,
+	"newer":       queryDateValue,
+	"older_than":  queryRelativeDateValue,
+	"newer_than":  queryRelativeDateValue,
+	"size":        querySizeValue,
+	"larger":      querySizeValue,
+	"smaller":     querySizeValue,
+}
+
+var (
+	queryDateValue         = regexp.MustCompile(`^(?i)(\d{4}[/-]\d{1,2}[/-]\d{1,2}|\d{1,2}/\d{1,2}/\d{4}|\d+|today|yesterday|tomorrow)$`)
+	queryRelativeDateValue = regexp.MustCompile(`^\d+[dmy]$`)
+	querySizeValue         = regexp.MustCompile(`^(?i)\d+[km]?$`)
+	queryOperatorName      = regexp.MustCompile(`^[A-Za-z_]+$`)
+)
+
+// LintQuery inspects the given Gmail query for likely mistakes, like
+// unbalanced quotes or parentheses, unknown operators, or operator values
+// Gmail does not understand (e.g. "newer_than:30days" instead of
+// "newer_than:30d"), and returns any issues found. Gmail silently treats
+// such mistakes as plain search text, which typically results in an alert
+// that never matches.
+func LintQuery(query string) []QueryIssue {
+	var issues []QueryIssue
+	if strings.TrimSpace(query) == "" {
+		return []QueryIssue{{Msg: "query is empty"}}
+	}
+
+	if strings.Count(query, `"`)%2 != 0 {
+		issues = append(issues, QueryIssue{Msg: "query has an unbalanced double quote"})
+	}
+	for _, pair := range []string{"()", "{}"} {
+		if msg := checkBalance(query, rune(pair[0]), rune(pair[1])); msg != "" {
+			issues = append(issues, QueryIssue{Msg: msg})
+		}
+	}
+
+	for _, term := range queryTerms(query) {
+		if msg := lintTerm(term); msg != "" {
+			issues = append(issues, QueryIssue{Term: term, Msg: msg})
+		}
+	}
+
+	return issues
+}
+
+// checkBalance returns a description of the problem if the open and close
+// runes outside of double quotes in the given query are unbalanced, or an
+// empty string otherwise.
+func checkBalance(query string, open, close rune) string {
+	var depth int
+	var quoted bool
+	for _, r := range query {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case quoted:
+		case r == open:
+			depth++
+		case r == close:
+			depth--
+			if depth < 0 {
+				return fmt.Sprintf("query has a %q without a matching %q", close, open)
+			}
+		}
+	}
+	if depth > 0 {
+		return fmt.Sprintf("query has a %q without a matching %q", open, close)
+	}
+
+	return ""
+}
+
+// queryTerms splits the given Gmail query into its terms, separated by
+// whitespace, parentheses, or braces outside of double quotes. An operator
+// whose value is a group, like "from:(a OR b)", is returned as a term ending
+// with the opening parenthesis or brace of the group.
+func queryTerms(query string) []string {
+	var terms []string
+	var b strings.Builder
+	var quoted bool
+	flush := func() {
+		if b.Len() > 0 {
+			terms = append(terms, b.String())
+			b.Reset()
+		}
+	}
+
+	for _, r := range query {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			b.WriteRune(r)
+		case quoted:
+			b.WriteRune(r)
+		case (r == '(' || r == '{') && strings.HasSuffix(b.String(), ":"):
+			b.WriteRune(r)
+			flush()
+		case unicode.IsSpace(r), strings.ContainsRune("(){}", r):
+			flush()
+		default:
+			b.WriteRune(r)
+		}
+	}
+	flush()
+
+	return terms
+}
+
+// lintTerm returns a description of the problem with the given query term,
+// or an empty string if no problem is found.
+func lintTerm(term string) string {
+	if term == "or" || term == "and" {
+		return fmt.Sprintf("boolean operators must be uppercase, use %q", strings.ToUpper(term))
+	}
+
+	t := strings.TrimLeft(term, "-+")
+	if strings.HasPrefix(t, `"`) {
+		return ""
+	}
+	op, val, found := strings.Cut(t, ":")
+	if !found || !queryOperatorName.MatchString(op) || strings.HasPrefix(val, "//") {
+		return ""
+	}
+
+	valid, known := queryOperatorValues[strings.ToLower(op)]
+	switch {
+	case !known:
+		return fmt.Sprintf("unknown operator %q", op)
+	case val == "":
+		return fmt.Sprintf("operator %q has no value", op)
+	case val == "(" || val == "{":
+		return ""
+	case valid != nil && !valid.MatchString(strings.Trim(val, `"`)):
+		return fmt.Sprintf("operator %q has an invalid value %q", op, val)
+	}
+
+	return ""
+}
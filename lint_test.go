@@ -0,0 +1,76 @@
+package gmailalert_test
+
+import (
+	"testing"
+
+	"github.com/aculclasure/gmailalert"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLintQuery(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		input string
+		want  []gmailalert.QueryIssue
+	}{
+		"Valid query returns no issues": {
+			input: `is:unread from:(bank@example.com OR alerts@example.com) subject:"Your bill" newer_than:2d -label:archived`,
+			want:  nil,
+		},
+		"Quoted text containing colons and parentheses returns no issues": {
+			input: `"meeting at 10:30 (room a)" has:attachment`,
+			want:  nil,
+		},
+		"URL returns no issues": {
+			input: `https://example.com/invoice`,
+			want:  nil,
+		},
+		"Empty query returns an issue": {
+			input: " ",
+			want:  []gmailalert.QueryIssue{{Msg: "query is empty"}},
+		},
+		"Unbalanced double quote returns an issue": {
+			input: `subject:"Your bill`,
+			want:  []gmailalert.QueryIssue{{Msg: "query has an unbalanced double quote"}},
+		},
+		"Unbalanced parentheses returns an issue": {
+			input: `from:(a@example.com OR b@example.com`,
+			want:  []gmailalert.QueryIssue{{Msg: `query has a '(' without a matching ')'`}},
+		},
+		"Unmatched closing brace returns an issue": {
+			input: `from:a@example.com}`,
+			want:  []gmailalert.QueryIssue{{Msg: `query has a '}' without a matching '{'`}},
+		},
+		"Unknown operator returns an issue": {
+			input: `sender:a@example.com`,
+			want:  []gmailalert.QueryIssue{{Term: "sender:a@example.com", Msg: `unknown operator "sender"`}},
+		},
+		"Invalid relative date returns an issue": {
+			input: `newer_than:30days`,
+			want:  []gmailalert.QueryIssue{{Term: "newer_than:30days", Msg: `operator "newer_than" has an invalid value "30days"`}},
+		},
+		"Invalid is value returns an issue": {
+			input: `is:new`,
+			want:  []gmailalert.QueryIssue{{Term: "is:new", Msg: `operator "is" has an invalid value "new"`}},
+		},
+		"Operator without value returns an issue": {
+			input: `from: a@example.com`,
+			want:  []gmailalert.QueryIssue{{Term: "from:", Msg: `operator "from" has no value`}},
+		},
+		"Lowercase boolean operator returns an issue": {
+			input: `from:a@example.com or from:b@example.com`,
+			want:  []gmailalert.QueryIssue{{Term: "or", Msg: `boolean operators must be uppercase, use "OR"`}},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got := gmailalert.LintQuery(tc.input)
+
+			if !cmp.Equal(tc.want, got) {
+				t.Errorf("LintQuery(%q) want != got\ndiff=%s", tc.input, cmp.Diff(tc.want, got))
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package gmailalert
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// maxAlertLogLines is the number of log lines AlertLogs keeps per alert.
+const maxAlertLogLines = 200
+
+// LogLine represents a line logged while evaluating an alert, as kept by
+// AlertLogs.
+type LogLine struct {
+	// When the line was logged.
+	Time time.Time `json:"time"`
+	// The ID of the evaluation that logged the line.
+	EvalID string `json:"evalid"`
+	// The logged text.
+	Text string `json:"text"`
+}
+
+// AlertLogs keeps the most recent lines logged while evaluating each alert
+// in a ring buffer per alert, so that why an alert did or did not notify can
+// be looked up after the fact. The lines can be persisted as JSON in a local
+// file, which is written after every run when AlertLogs is used as a
+// Reporter. It is safe for concurrent use by multiple goroutines.
+type AlertLogs struct {
+	file  string
+	mtx   sync.Mutex
+	lines map[string][]LogLine
+}
+
+// NewAlertLogs accepts the name of a JSON alert logs file and returns new
+// AlertLogs populated from it. If the file name is empty, the AlertLogs are
+// only kept in memory. If the file does not exist, empty AlertLogs are
+// returned. An error is returned if the file exists but cannot be read or
+// decoded.
+func NewAlertLogs(file string) (*AlertLogs, error) {
+	l := &AlertLogs{file: file, lines: map[string][]LogLine{}}
+	if file == "" {
+		return l, nil
+	}
+
+	lines, err := readAlertLogs(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	l.lines = lines
+
+	return l, nil
+}
+
+// readAlertLogs returns the lines of every alert stored in the given JSON
+// alert logs file. An error wrapping os.ErrNotExist is returned if the file
+// does not exist.
+func readAlertLogs(file string) (map[string][]LogLine, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("got error opening alert logs file %s: %w", file, err)
+	}
+	defer f.Close()
+
+	lines := map[string][]LogLine{}
+	if err := json.NewDecoder(f).Decode(&lines); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("got error json-decoding alert logs file %s: %v", file, err)
+	}
+
+	return lines, nil
+}
+
+// add appends the given LogLine to the lines of the alert with the given
+// name, dropping its oldest line once it has more than maxAlertLogLines.
+func (l *AlertLogs) add(alert string, line LogLine) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	lines := append(l.lines[alert], line)
+	if len(lines) > maxAlertLogLines {
+		lines = append(lines[:0], lines[len(lines)-maxAlertLogLines:]...)
+	}
+	l.lines[alert] = lines
+}
+
+// Lines returns up to the given number of the most recent lines logged for
+// the alert with the given name, oldest first, or every kept line if the
+// number is not positive.
+func (l *AlertLogs) Lines(alert string, limit int) []LogLine {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	return lastLogLines(l.lines[alert], limit)
+}
+
+// Report writes the AlertLogs into their file, if they have one, once a run
+// ends. An error is returned if there is a problem writing the file.
+func (l *AlertLogs) Report(Summary) error {
+	if l.file == "" {
+		return nil
+	}
+
+	l.mtx.Lock()
+	b, err := json.Marshal(l.lines)
+	l.mtx.Unlock()
+	if err != nil {
+		return fmt.Errorf("got error json-encoding alert logs: %v", err)
+	}
+
+	tmp := l.file + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return fmt.Errorf("got error writing alert logs file %s: %v", tmp, err)
+	}
+	if err := os.Rename(tmp, l.file); err != nil {
+		return fmt.Errorf("got error replacing alert logs file %s: %v", l.file, err)
+	}
+
+	return nil
+}
+
+// lastLogLines returns up to the given number of the last of the given
+// lines, or every line if the number is not positive.
+func lastLogLines(lines []LogLine, limit int) []LogLine {
+	if limit <= 0 || limit > len(lines) {
+		limit = len(lines)
+	}
+
+	return append([]LogLine{}, lines[len(lines)-limit:]...)
+}
+
+// WithAlerterLogs accepts AlertLogs and returns a functional option for
+// wiring them to an Alerter, which keeps the lines logged while evaluating
+// each alert in them and writes them into their file after every run.
+func WithAlerterLogs(l *AlertLogs) AlerterOption {
+	return func(a *Alerter) {
+		a.Logs = l
+		a.Reporters = append(a.Reporters, l)
+	}
+}
+
+// alertLogger is a Logger that keeps every line logged while evaluating an
+// alert in AlertLogs before passing it to the wrapped Logger.
+type alertLogger struct {
+	l      Logger
+	logs   *AlertLogs
+	alert  string
+	evalID string
+	now    func() time.Time
+}
+
+// Printf keeps the formatted log line in the AlertLogs of the receiver and
+// writes it to the wrapped Logger.
+func (l alertLogger) Printf(format string, args ...interface{}) {
+	l.logs.add(l.alert, LogLine{Time: l.now(), EvalID: l.evalID, Text: fmt.Sprintf(format, args...)})
+	l.l.Printf(format, args...)
+}
+
+// logsCLI accepts the command line flags of the "logs" subcommand, which
+// prints the most recent lines logged while evaluating the alert named with
+// the "-alert" flag, read from the alert logs file given with the
+// "-alert-logs-file" flag, or else from the control API of a running
+// gmailalert daemon. An error is returned if the flags are invalid or the
+// logs cannot be read.
+func logsCLI(args []string) error {
+	var app cliEnv
+	var alert, file string
+	var limit int
+
+	fs := app.flagSet("logs")
+	fs.StringVar(
+		&alert,
+		"alert",
+		"",
+		"the name of the alert to print the logs of")
+	fs.StringVar(
+		&file,
+		"alert-logs-file",
+		"",
+		"json file the alert logs are kept in, as given to the daemon or run with the same flag (if empty, the logs are read from the daemon's control api)")
+	fs.StringVar(
+		&app.controlAddr,
+		"control-addr",
+		"localhost:7070",
+		`the address of the daemon's control api, either "host:port" or "unix:<socket path>"`)
+	fs.StringVar(
+		&app.controlTokenFile,
+		"control-token-file",
+		"",
+		"file holding the bearer token the daemon's control api requires, as given to the daemon with the same flag")
+	fs.IntVar(
+		&limit,
+		"limit",
+		0,
+		"the maximum number of the most recent lines to print (if not positive, every kept line is printed)")
+	if err := app.parse(fs, args); err != nil {
+		return err
+	}
+	if alert == "" {
+		fs.Usage()
+		return errors.New(`command line flag "-alert" must be non-empty`)
+	}
+
+	var lines []LogLine
+	if file != "" {
+		logs, err := readAlertLogs(file)
+		if err != nil {
+			return err
+		}
+		lines = lastLogLines(logs[alert], limit)
+	} else {
+		token, err := readControlToken(app.controlTokenFile)
+		if err != nil {
+			return err
+		}
+		network, addr := controlNetwork(app.controlAddr)
+		client, err := DialControl(network, addr, token)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+		if lines, err = client.Logs(alert, limit); err != nil {
+			return fmt.Errorf("got error getting logs of alert %q: %v", alert, err)
+		}
+	}
+
+	return printLogLines(lines, os.Stdout)
+}
+
+// printLogLines writes the given lines to the given io.Writer, one per line
+// prefixed with their time and evaluation ID. An error is returned if there
+// is a problem writing.
+func printLogLines(lines []LogLine, w io.Writer) error {
+	for _, line := range lines {
+		if _, err := fmt.Fprintf(w, "%s [eval %s] %s\n", formatTime(line.Time), line.EvalID, line.Text); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
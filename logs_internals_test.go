@@ -0,0 +1,139 @@
+package gmailalert
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAlerterKeepsLogLinesOfEachAlert(t *testing.T) {
+	t.Parallel()
+
+	file := filepath.Join(t.TempDir(), "alert-logs.json")
+	logs, err := NewAlertLogs(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2023, 3, 1, 8, 0, 0, 0, time.UTC)
+	a, err := NewAlerter(
+		fakePreviewFetcher{matches: []Message{{ID: "1"}}},
+		&recordingTestNotifier{},
+		WithAlerterLogger(log.New(io.Discard, "", 0)),
+		WithAlerterClock(func() time.Time { return now }),
+		WithAlerterLogs(logs),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	summary := a.run([]Alert{
+		{Name: "bills", GmailQuery: "from:bank", PushoverTitle: "Bill due"},
+		{Name: "orders", GmailQuery: "from:shop", PushoverTitle: "Order shipped"},
+	})
+	for _, res := range summary.Results {
+		if res.Err != nil {
+			t.Fatal(res.Err)
+		}
+	}
+	reloaded, err := NewAlertLogs(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []LogLine{
+		{Time: now, EvalID: summary.Results[0].EvalID, Text: `Found 1 emails matching query "from:bank"`},
+		{Time: now, EvalID: summary.Results[0].EvalID, Text: `notification titled "Bill due" successfully sent via *gmailalert.recordingTestNotifier`},
+	}
+	got := reloaded.Lines("bills", 0)
+	if !cmp.Equal(want, got) {
+		t.Errorf("want != got\ndiff=%s", cmp.Diff(want, got))
+	}
+	for _, line := range reloaded.Lines("orders", 0) {
+		if strings.Contains(line.Text, "from:bank") {
+			t.Errorf("want only lines of alert \"orders\", got %+v", line)
+		}
+	}
+	var out bytes.Buffer
+	if err := printLogLines(got[:1], &out); err != nil {
+		t.Fatal(err)
+	}
+	wantOut := "2023-03-01T08:00:00Z [eval " + summary.Results[0].EvalID + "] Found 1 emails matching query \"from:bank\"\n"
+	if out.String() != wantOut {
+		t.Errorf("want printed line %q, got %q", wantOut, out.String())
+	}
+}
+
+func TestAlertLogsKeepMostRecentLines(t *testing.T) {
+	t.Parallel()
+
+	logs, err := NewAlertLogs("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < maxAlertLogLines+10; i++ {
+		logs.add("bills", LogLine{EvalID: "run." + strings.Repeat("x", i%2), Text: strings.Repeat("a", i)})
+	}
+
+	all := logs.Lines("bills", 0)
+	last := logs.Lines("bills", 2)
+
+	if len(all) != maxAlertLogLines || len(all[0].Text) != 10 {
+		t.Errorf("want the last %d lines kept, got %d starting with %q", maxAlertLogLines, len(all), all[0].Text)
+	}
+	if len(last) != 2 || len(last[1].Text) != maxAlertLogLines+9 {
+		t.Errorf("want the last 2 lines oldest first, got %+v", last)
+	}
+	if err := logs.Report(Summary{}); err != nil {
+		t.Errorf("got unexpected error reporting logs kept in memory: %v", err)
+	}
+}
+
+func TestControlAPIReturnsLogLinesOfAlert(t *testing.T) {
+	t.Parallel()
+
+	c := NewControl()
+	c.start([]Alert{{Name: "bills"}, {Name: "orders"}})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ServeControl(ctx, l, c, "")
+	client, err := DialControl("tcp", l.Addr().String(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if _, err := client.Logs("bills", 0); err == nil {
+		t.Error("expected an error getting logs that are not kept but did not get one")
+	}
+	c.mtx.Lock()
+	c.logs, err = NewAlertLogs("")
+	c.mtx.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.logs.add("bills", LogLine{EvalID: "run.0", Text: "first"})
+	c.logs.add("bills", LogLine{EvalID: "run.1", Text: "second"})
+	lines, err := client.Logs("bills", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(lines) != 1 || lines[0].EvalID != "run.1" || lines[0].Text != "second" {
+		t.Errorf("want the last line of alert \"bills\", got %+v", lines)
+	}
+	if _, err := client.Logs("unknown", 0); err == nil {
+		t.Error("expected an error getting the logs of an unknown alert but did not get one")
+	}
+}
@@ -0,0 +1,181 @@
+package gmailalert
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// MetricsConfig represents the configuration for pushing the metrics of each
+// run to a StatsD or Graphite server.
+type MetricsConfig struct {
+	// The protocol to push metrics with, either "statsd" or "graphite".
+	Protocol string `json:"protocol"`
+	// The address of the metrics server in the form "host:port".
+	Address string `json:"address"`
+	// The prefix prepended to every metric name. If empty, "gmailalert" is
+	// used.
+	Prefix string `json:"prefix"`
+}
+
+// maxStatsDPacket is the largest StatsD payload sent in a single UDP packet,
+// which fits the usual Ethernet MTU of 1500 bytes after the IP and UDP
+// headers without fragmentation.
+const maxStatsDPacket = 1432
+
+// MetricsReporter is a Reporter that pushes the metrics of each run to a
+// StatsD server over UDP or to a Graphite server over TCP using the
+// plaintext protocol.
+type MetricsReporter struct {
+	cfg     MetricsConfig
+	timeout time.Duration
+	now     func() time.Time
+}
+
+// NewMetricsReporter accepts a MetricsConfig and returns a new
+// MetricsReporter. An error is returned if the protocol is unknown or the
+// address is empty.
+func NewMetricsReporter(cfg MetricsConfig) (*MetricsReporter, error) {
+	if cfg.Protocol != "statsd" && cfg.Protocol != "graphite" {
+		return nil, fmt.Errorf(`metrics protocol must be "statsd" or "graphite", got %q`, cfg.Protocol)
+	}
+	if cfg.Address == "" {
+		return nil, errors.New("metrics address must not be empty")
+	}
+	if cfg.Prefix == "" {
+		cfg.Prefix = "gmailalert"
+	}
+
+	return &MetricsReporter{cfg: cfg, timeout: 5 * time.Second, now: time.Now}, nil
+}
+
+// Report accepts the Summary of a run and pushes its metrics to the
+// configured server, split into UDP packets of at most maxStatsDPacket bytes
+// for StatsD. An error is returned if the server cannot be reached or the
+// metrics cannot be written.
+func (m *MetricsReporter) Report(s Summary) error {
+	network := "udp"
+	if m.cfg.Protocol == "graphite" {
+		network = "tcp"
+	}
+
+	conn, err := net.DialTimeout(network, m.cfg.Address, m.timeout)
+	if err != nil {
+		return fmt.Errorf("got error connecting to %s server %s: %v", m.cfg.Protocol, m.cfg.Address, err)
+	}
+	defer conn.Close()
+
+	if err := conn.SetWriteDeadline(time.Now().Add(m.timeout)); err != nil {
+		return err
+	}
+	lines := m.format(s)
+	payloads := []string{strings.Join(lines, "")}
+	if m.cfg.Protocol == "statsd" {
+		payloads = packets(lines, maxStatsDPacket)
+	}
+	for _, p := range payloads {
+		if _, err := conn.Write([]byte(p)); err != nil {
+			return fmt.Errorf("got error writing metrics to %s server %s: %v", m.cfg.Protocol, m.cfg.Address, err)
+		}
+	}
+
+	return nil
+}
+
+// packets joins the given newline-terminated lines into payloads of at most
+// the given size in bytes, without splitting any line. A line longer than
+// the size is sent in a payload of its own.
+func packets(lines []string, size int) []string {
+	var payloads []string
+	var b strings.Builder
+	for _, l := range lines {
+		if b.Len() > 0 && b.Len()+len(l) > size {
+			payloads = append(payloads, b.String())
+			b.Reset()
+		}
+		b.WriteString(l)
+	}
+	if b.Len() > 0 {
+		payloads = append(payloads, b.String())
+	}
+
+	return payloads
+}
+
+// format renders the metrics of the given Summary as lines in the
+// configured protocol's line format. The metrics of each alert are tagged
+// with the alert's labels, as DogStatsD tags for StatsD and as Graphite
+// tags, with the keys and values of the labels sanitized by metricName.
+func (m *MetricsReporter) format(s Summary) []string {
+	type metric struct {
+		name  string
+		value int64
+		kind  string
+		tags  map[string]string
+	}
+	metrics := []metric{
+		{"alerts", int64(len(s.Results)), "g", nil},
+		{"matches", int64(s.Matches()), "g", nil},
+		{"notified", int64(s.Notified()), "g", nil},
+		{"suppressed", int64(s.Suppressed()), "g", nil},
+		{"unchanged", int64(s.Unchanged()), "g", nil},
+		{"failed", int64(s.Failed()), "g", nil},
+		{"duration_ms", s.Duration.Milliseconds(), "ms", nil},
+	}
+	for _, r := range s.Results {
+		name := "alert." + metricName(r.Alert)
+		metrics = append(metrics,
+			metric{name + ".matches", int64(r.Matches), "g", r.Labels},
+			metric{name + ".query_ms", r.Timings.Query.Milliseconds(), "ms", r.Labels},
+			metric{name + ".filter_ms", r.Timings.Filter.Milliseconds(), "ms", r.Labels},
+			metric{name + ".fetch_ms", r.Timings.Fetch.Milliseconds(), "ms", r.Labels},
+			metric{name + ".notify_ms", r.Timings.Notify.Milliseconds(), "ms", r.Labels})
+	}
+	if q := s.Quota(); q != nil {
+		metrics = append(metrics,
+			metric{"quota.limit", int64(q.Limit), "g", nil},
+			metric{"quota.remaining", int64(q.Remaining), "g", nil})
+	}
+
+	lines := make([]string, 0, len(metrics))
+	ts := m.now().Unix()
+	for _, mt := range metrics {
+		tags := make(map[string]string, len(mt.tags))
+		for k, v := range mt.tags {
+			tags[metricName(k)] = metricName(v)
+		}
+		var b strings.Builder
+		if m.cfg.Protocol == "graphite" {
+			fmt.Fprintf(&b, "%s.%s", m.cfg.Prefix, mt.name)
+			if len(tags) > 0 {
+				fmt.Fprintf(&b, ";%s", formatLabels(tags, "=", ";"))
+			}
+			fmt.Fprintf(&b, " %d %d\n", mt.value, ts)
+		} else {
+			fmt.Fprintf(&b, "%s.%s:%d|%s", m.cfg.Prefix, mt.name, mt.value, mt.kind)
+			if len(tags) > 0 {
+				fmt.Fprintf(&b, "|#%s", formatLabels(tags, ":", ","))
+			}
+			b.WriteString("\n")
+		}
+		lines = append(lines, b.String())
+	}
+
+	return lines
+}
+
+// metricName converts the given alert name, label key, or label value into a
+// single metric path segment by replacing any characters other than letters,
+// digits, dashes, and underscores with underscores, which keeps it from
+// breaking the StatsD and Graphite line formats.
+func metricName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, name)
+}
@@ -0,0 +1,242 @@
+package gmailalert_test
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aculclasure/gmailalert"
+)
+
+func TestNewMetricsReporter(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		input       gmailalert.MetricsConfig
+		errExpected bool
+	}{
+		"Unknown protocol returns an error": {
+			input:       gmailalert.MetricsConfig{Protocol: "carbon", Address: "127.0.0.1:8125"},
+			errExpected: true,
+		},
+		"Empty address returns an error": {
+			input:       gmailalert.MetricsConfig{Protocol: "statsd"},
+			errExpected: true,
+		},
+		"Valid statsd config returns no error": {
+			input:       gmailalert.MetricsConfig{Protocol: "statsd", Address: "127.0.0.1:8125"},
+			errExpected: false,
+		},
+		"Valid graphite config returns no error": {
+			input:       gmailalert.MetricsConfig{Protocol: "graphite", Address: "127.0.0.1:2003"},
+			errExpected: false,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := gmailalert.NewMetricsReporter(tc.input)
+			errReceived := err != nil
+
+			if tc.errExpected != errReceived {
+				t.Errorf("got unexpected error status %t", errReceived)
+			}
+		})
+	}
+}
+
+func TestMetricsReporterPushesStatsDMetrics(t *testing.T) {
+	t.Parallel()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	reporter, err := gmailalert.NewMetricsReporter(gmailalert.MetricsConfig{
+		Protocol: "statsd",
+		Address:  conn.LocalAddr().String(),
+		Prefix:   "test",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = reporter.Report(testSummary())
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+
+	buf := make([]byte, 4096)
+	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(buf[:n])
+
+	for _, want := range []string{
+		"test.alerts:2|g\n",
+		"test.matches:3|g\n",
+		"test.notified:1|g\n",
+		"test.failed:1|g\n",
+		"test.duration_ms:1500|ms\n",
+		"test.alert.bill_due.matches:3|g\n",
+		"test.alert.bill_due.query_ms:1200|ms\n",
+		"test.alert.bill_due.notify_ms:300|ms\n",
+		"test.alert.is_unread.matches:0|g|#team:on_call,tier:1\n",
+		"test.quota.limit:10000|g\n",
+		"test.quota.remaining:42|g\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("want metrics to contain %q, got:\n%s", want, got)
+		}
+	}
+}
+
+func TestMetricsReporterSplitsStatsDMetricsIntoPackets(t *testing.T) {
+	t.Parallel()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// The packets are only read after they were all sent.
+	if err := conn.(*net.UDPConn).SetReadBuffer(1 << 20); err != nil {
+		t.Fatal(err)
+	}
+
+	reporter, err := gmailalert.NewMetricsReporter(gmailalert.MetricsConfig{
+		Protocol: "statsd",
+		Address:  conn.LocalAddr().String(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s gmailalert.Summary
+	for i := 0; i < 200; i++ {
+		s.Results = append(s.Results, gmailalert.AlertResult{
+			Alert:  fmt.Sprintf("alert %d", i),
+			Labels: map[string]string{"on call|team": "a,b"},
+		})
+	}
+
+	if err := reporter.Report(s); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+
+	// 7 metrics of the run and 5 of each alert.
+	wantLines := 7 + 5*len(s.Results)
+	var gotLines int
+	buf := make([]byte, 65536)
+	for gotLines < wantLines {
+		if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+			t.Fatal(err)
+		}
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("got error after reading %d of %d metrics: %v", gotLines, wantLines, err)
+		}
+		if n > 1432 {
+			t.Errorf("want packets of at most 1432 bytes, got %d", n)
+		}
+		packet := string(buf[:n])
+		if !strings.HasSuffix(packet, "\n") {
+			t.Errorf("want packets of whole lines, got %q", packet)
+		}
+		gotLines += strings.Count(packet, "\n")
+		if strings.Contains(packet, "|#") && !strings.Contains(packet, "|#on_call_team:a_b\n") {
+			t.Errorf("want sanitized label key and value, got %q", packet)
+		}
+	}
+}
+
+func TestMetricsReporterPushesGraphiteMetrics(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	lines := make(chan string, 16)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			close(lines)
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+
+	reporter, err := gmailalert.NewMetricsReporter(gmailalert.MetricsConfig{
+		Protocol: "graphite",
+		Address:  ln.Addr().String(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = reporter.Report(testSummary())
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+
+	var got []string
+	for l := range lines {
+		got = append(got, l)
+	}
+
+	want := "gmailalert.matches 3 "
+	found := false
+	for _, l := range got {
+		if strings.HasPrefix(l, want) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("want a line starting with %q, got: %v", want, got)
+	}
+
+	want = "gmailalert.alert.is_unread.matches;team=on_call;tier=1 0 "
+	found = false
+	for _, l := range got {
+		if strings.HasPrefix(l, want) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("want a line starting with %q, got: %v", want, got)
+	}
+}
+
+// testSummary returns a Summary of a run with one notified alert and one
+// failed alert.
+func testSummary() gmailalert.Summary {
+	return gmailalert.Summary{
+		Duration: 1500 * time.Millisecond,
+		Results: []gmailalert.AlertResult{
+			{
+				Alert:    "bill due",
+				Matches:  3,
+				Notified: true,
+				Quota:    &gmailalert.NotifyQuota{Limit: 10000, Remaining: 42},
+				Timings:  gmailalert.StageTimings{Query: 1200 * time.Millisecond, Notify: 300 * time.Millisecond},
+			},
+			{Alert: "is:unread", Labels: map[string]string{"team": "on call", "tier": "1"}, Err: errFetchingMail},
+		},
+	}
+}
@@ -0,0 +1,185 @@
+package gmailalert
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"regexp"
+	"strings"
+)
+
+// defaultMaxMessageBytes is the maximum size in bytes of a message matching
+// an alert that is held in memory, unless the alert sets its own.
+const defaultMaxMessageBytes = 10 << 20
+
+// errStopWalk can be returned by the function passed to walkMIME to stop
+// walking the parts of a message without returning an error.
+var errStopWalk = errors.New("stop walking mime parts")
+
+// mimePart represents a single, non-multipart part of a MIME message.
+type mimePart struct {
+	// The lowercased media type of the part, like "text/plain".
+	mediaType string
+	// The parameters of the part's Content-Type header, like "charset".
+	params map[string]string
+	// The file name of the part, if it is an attachment.
+	filename string
+	// The body of the part, with its Content-Transfer-Encoding decoded.
+	body io.Reader
+}
+
+// fetchRaw accepts a RawFetcher, an Alert, and the ID of a message matching
+// the Alert and returns the raw message. If the RawFetcher implements
+// LimitedRawFetcher, a message larger than the Alert's message size limit
+// is returned without the bodies of the attachments that do not fit. An
+// error is returned if the message cannot be fetched.
+func fetchRaw(f RawFetcher, alt Alert, id string) ([]byte, error) {
+	if lf, ok := f.(LimitedRawFetcher); ok {
+		return lf.FetchRawLimited(id, alt.messageMaxBytes())
+	}
+
+	return f.FetchRaw(id)
+}
+
+// walkMIME parses the given raw, RFC 2822 formatted message and calls fn for
+// each non-multipart part of it, in order, with the part's body decoded. A
+// message that is not multipart is passed to fn as a single part. Walking
+// stops at the first error returned by fn, which is returned unless it is
+// errStopWalk. An error is also returned if the message cannot be parsed.
+func walkMIME(raw io.Reader, fn func(p mimePart) error) error {
+	msg, err := mail.ReadMessage(raw)
+	if err != nil {
+		return fmt.Errorf("got error parsing email message: %v", err)
+	}
+
+	err = walkEntity(msg.Header.Get, msg.Body, fn)
+	if errors.Is(err, errStopWalk) {
+		return nil
+	}
+
+	return err
+}
+
+// walkEntity calls fn for each non-multipart part of the MIME entity with
+// the given header accessor and body, recursing into multipart entities.
+func walkEntity(header func(string) string, body io.Reader, fn func(p mimePart) error) error {
+	mediaType, params, err := mime.ParseMediaType(header("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		p := mimePart{
+			mediaType: mediaType,
+			params:    params,
+			body:      decodeTransfer(header("Content-Transfer-Encoding"), body),
+		}
+		if _, dparams, err := mime.ParseMediaType(header("Content-Disposition")); err == nil {
+			p.filename = dparams["filename"]
+		}
+		if p.filename == "" {
+			p.filename = params["name"]
+		}
+
+		return fn(p)
+	}
+
+	mr := multipart.NewReader(body, params["boundary"])
+	for {
+		part, err := mr.NextRawPart()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("got error reading %s part: %v", mediaType, err)
+		}
+
+		if err := walkEntity(part.Header.Get, part, fn); err != nil {
+			return err
+		}
+	}
+}
+
+// decodeTransfer returns a reader decoding the given body according to the
+// given Content-Transfer-Encoding.
+func decodeTransfer(encoding string, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	}
+
+	return body
+}
+
+// firstImage returns the body and media type of the first image part of the
+// given raw message that is no larger than maxBytes. Larger images are
+// skipped. An empty body is returned if the message has no such image, and
+// an error is returned if the message cannot be parsed.
+func firstImage(raw io.Reader, maxBytes int64) ([]byte, string, error) {
+	var img []byte
+	var mediaType string
+	err := walkMIME(raw, func(p mimePart) error {
+		if !strings.HasPrefix(p.mediaType, "image/") {
+			return nil
+		}
+
+		b, err := io.ReadAll(io.LimitReader(p.body, maxBytes+1))
+		if err != nil {
+			return fmt.Errorf("got error reading image part: %v", err)
+		}
+		if int64(len(b)) > maxBytes {
+			return nil
+		}
+
+		img, mediaType = b, p.mediaType
+		return errStopWalk
+	})
+
+	return img, mediaType, err
+}
+
+// htmlTag matches an HTML tag, comment, or the contents of a script or
+// style element.
+var htmlTag = regexp.MustCompile(`(?is)<(script|style)\b.*?</(script|style)>|<!--.*?-->|<[^>]*>`)
+
+// bodyText returns up to maxBytes of the text of the given raw message. The
+// first plain text part is preferred, and the first HTML part is used with
+// its tags removed if the message has no plain text part. An empty string is
+// returned if the message has no text, and an error is returned if the
+// message cannot be parsed.
+func bodyText(raw io.Reader, maxBytes int64) (string, error) {
+	var text, html string
+	err := walkMIME(raw, func(p mimePart) error {
+		if p.filename != "" || (p.mediaType != "text/plain" && p.mediaType != "text/html") ||
+			(p.mediaType == "text/html" && html != "") {
+			return nil
+		}
+
+		b, err := io.ReadAll(io.LimitReader(p.body, maxBytes))
+		if err != nil {
+			return fmt.Errorf("got error reading %s part: %v", p.mediaType, err)
+		}
+		if p.mediaType == "text/html" {
+			html = htmlTag.ReplaceAllString(string(b), " ")
+			return nil
+		}
+
+		text = string(b)
+		return errStopWalk
+	})
+	if err != nil {
+		return "", err
+	}
+	if text == "" {
+		text = html
+	}
+
+	return text, nil
+}
@@ -0,0 +1,209 @@
+package gmailalert
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// testMultipartEmail is a raw email with a quoted-printable text part, an
+// oversized base64 image, and a small base64 image attachment.
+const testMultipartEmail = "From: shop@example.com\r\n" +
+	"Subject: Your order\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=outer\r\n" +
+	"\r\n" +
+	"--outer\r\n" +
+	"Content-Type: multipart/alternative; boundary=inner\r\n" +
+	"\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"Your order =E2=9C=93 has shipped.\r\n" +
+	"--inner--\r\n" +
+	"--outer\r\n" +
+	"Content-Type: image/png; name=big.png\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA\r\n" +
+	"--outer\r\n" +
+	"Content-Type: image/jpeg\r\n" +
+	"Content-Disposition: attachment; filename=small.jpg\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"/9j/4A==\r\n" +
+	"--outer--\r\n"
+
+func TestWalkMIME(t *testing.T) {
+	t.Parallel()
+
+	type part struct {
+		MediaType string
+		Filename  string
+		Body      string
+	}
+
+	testCases := map[string]struct {
+		input string
+		want  []part
+	}{
+		"Nested multipart message returns every leaf part decoded": {
+			input: testMultipartEmail,
+			want: []part{
+				{MediaType: "text/plain", Body: "Your order ✓ has shipped."},
+				{MediaType: "image/png", Filename: "big.png", Body: strings.Repeat("\x00", 24)},
+				{MediaType: "image/jpeg", Filename: "small.jpg", Body: "\xff\xd8\xff\xe0"},
+			},
+		},
+		"Message without content type returns a single text part": {
+			input: "Subject: hi\r\n\r\nhello\r\n",
+			want:  []part{{MediaType: "text/plain", Body: "hello\r\n"}},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var got []part
+			err := walkMIME(strings.NewReader(tc.input), func(p mimePart) error {
+				b, err := io.ReadAll(p.body)
+				if err != nil {
+					return err
+				}
+				got = append(got, part{MediaType: p.mediaType, Filename: p.filename, Body: string(b)})
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("got unexpected error: %v", err)
+			}
+
+			if !cmp.Equal(tc.want, got) {
+				t.Errorf("want != got\ndiff=%s", cmp.Diff(tc.want, got))
+			}
+		})
+	}
+}
+
+func TestWalkMIMEWithInvalidMessageReturnsError(t *testing.T) {
+	t.Parallel()
+
+	err := walkMIME(strings.NewReader("not an email"), func(p mimePart) error { return nil })
+
+	if err == nil {
+		t.Error("expected an error but did not get one")
+	}
+}
+
+func TestFirstImage(t *testing.T) {
+	t.Parallel()
+
+	t.Run("oversized images are skipped", func(t *testing.T) {
+		img, mediaType, err := firstImage(strings.NewReader(testMultipartEmail), 10)
+		if err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		if mediaType != "image/jpeg" || !bytes.Equal(img, []byte("\xff\xd8\xff\xe0")) {
+			t.Errorf("want the small jpeg image, got %s %q", mediaType, img)
+		}
+	})
+
+	t.Run("first image within the limit is returned", func(t *testing.T) {
+		_, mediaType, err := firstImage(strings.NewReader(testMultipartEmail), 1024)
+		if err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		if mediaType != "image/png" {
+			t.Errorf("want the png image, got %s", mediaType)
+		}
+	})
+
+	t.Run("message without images returns no image", func(t *testing.T) {
+		img, _, err := firstImage(strings.NewReader("Subject: hi\r\n\r\nhello\r\n"), 1024)
+		if err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		if img != nil {
+			t.Errorf("want no image, got %q", img)
+		}
+	})
+}
+
+func TestBodyText(t *testing.T) {
+	t.Parallel()
+
+	htmlEmail := "Content-Type: multipart/alternative; boundary=b\r\n" +
+		"\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/html\r\n" +
+		"\r\n" +
+		"<style>p { color: red; }</style><p>Hallo <b>Welt</b></p>\r\n" +
+		"--b--\r\n"
+
+	testCases := map[string]struct {
+		input string
+		want  string
+	}{
+		"Plain text part is preferred": {
+			input: testMultipartEmail,
+			want:  "Your order ✓ has shipped.",
+		},
+		"HTML part is used without its tags": {
+			input: htmlEmail,
+			want:  "Hallo Welt",
+		},
+		"Message without text returns an empty string": {
+			input: "Content-Type: image/png\r\n\r\nAAAA\r\n",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got, err := bodyText(strings.NewReader(tc.input), 1024)
+			if err != nil {
+				t.Fatalf("got unexpected error: %v", err)
+			}
+			if got = strings.Join(strings.Fields(got), " "); tc.want != got {
+				t.Errorf("want %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+// limitedTestFetcher represents a LimitedRawFetcher recording the size
+// limits it is asked to fetch messages within.
+type limitedTestFetcher struct {
+	limits []int64
+}
+
+// FetchRaw returns an empty message.
+func (f *limitedTestFetcher) FetchRaw(_ string) ([]byte, error) {
+	return nil, nil
+}
+
+// FetchRawLimited records the given limit and returns an empty message.
+func (f *limitedTestFetcher) FetchRawLimited(_ string, maxBytes int64) ([]byte, error) {
+	f.limits = append(f.limits, maxBytes)
+	return nil, nil
+}
+
+func TestFetchRawUsesAlertMessageLimit(t *testing.T) {
+	t.Parallel()
+
+	f := &limitedTestFetcher{}
+	for _, alt := range []Alert{{}, {MaxMessageBytes: 1 << 20}} {
+		if _, err := fetchRaw(f, alt, "1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []int64{defaultMaxMessageBytes, 1 << 20}
+	if !cmp.Equal(want, f.limits) {
+		t.Errorf("want != got\ndiff=%s", cmp.Diff(want, f.limits))
+	}
+}
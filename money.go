@@ -0,0 +1,200 @@
+package gmailalert
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxMoneyBodyBytes is the number of bytes of an email's body that are read
+// to find money amounts.
+const maxMoneyBodyBytes = 256 << 10
+
+// currencySymbols maps the currency symbols and prefixes that can stand for
+// a currency code in an amount to that code.
+var currencySymbols = map[string]string{
+	"$":   "USD",
+	"US$": "USD",
+	"C$":  "CAD",
+	"A$":  "AUD",
+	"€":   "EUR",
+	"£":   "GBP",
+	"¥":   "JPY",
+	"₹":   "INR",
+}
+
+// currencyCodes are the ISO 4217 codes of the currencies whose amounts
+// are recognized when written with their code, like "EUR 20".
+var currencyCodes = []string{
+	"AUD", "BRL", "CAD", "CHF", "CNY", "CZK", "DKK", "EUR", "GBP", "HKD", "INR",
+	"JPY", "MXN", "NOK", "NZD", "PLN", "SEK", "SGD", "USD", "ZAR",
+}
+
+// moneyNumber matches a number that may have group separators and up to two
+// decimals, like "1,234.56", "1.234,56", "1'234", or "20". Besides commas
+// and points, groups can be separated by apostrophes and non-breaking
+// spaces, but not by plain spaces, which separate numbers in text.
+const moneyNumber = `\d{1,3}(?:[.,'\x{00A0}\x{202F}]\d{3})+(?:[.,]\d{1,2})?|\d+(?:[.,]\d{1,2})?`
+
+// moneyAmount matches an amount of money with its currency symbol or code
+// before or after the number, like "$1,234.56", "EUR 20", or "1.234,56 €".
+// The number is matched by the group named "num" or "num2", and the
+// currency by the group named "pre" or "post".
+var moneyAmount = regexp.MustCompile(
+	`(?:(?P<pre>US\$|C\$|A\$|[$€£¥₹]|\b(?:` + strings.Join(currencyCodes, "|") + `))\s?(?P<num>` + moneyNumber + `))` +
+		`|(?:(?P<num2>` + moneyNumber + `)\s?(?P<post>[$€£¥₹]|(?:` + strings.Join(currencyCodes, "|") + `)\b))`)
+
+// decimalCommaLanguages are the languages whose locales write a comma as the
+// decimal separator, like "1.234,56".
+var decimalCommaLanguages = map[string]bool{
+	"cs": true, "da": true, "de": true, "es": true, "fi": true, "fr": true, "id": true, "it": true,
+	"nb": true, "nl": true, "pl": true, "pt": true, "ro": true, "ru": true, "sv": true, "tr": true, "uk": true,
+}
+
+// MoneyConfig represents how the money amounts of the emails matching an
+// alert, like the totals of receipts, are read for the "amount" and
+// "totalAmount" variables of its condition.
+type MoneyConfig struct {
+	// The locale the amounts are written in, like "en-US" or "de-DE",
+	// whose language decides whether a comma or a point separates the
+	// decimals. If empty, the separator is guessed for every amount.
+	Locale string `json:"locale"`
+	// The ISO 4217 codes, like "USD", of the currencies whose amounts are
+	// read. Amounts written with "$" are read as "USD". If empty, amounts of
+	// any currency are read.
+	Currencies []string `json:"currencies"`
+}
+
+// ok returns an error if the locale of the MoneyConfig does not start with
+// an ISO 639-1 language code or any of its currencies is not the ISO 4217
+// code of a recognized currency.
+func (c MoneyConfig) ok() error {
+	if c.Locale != "" && !languageCode.MatchString(c.language()) {
+		return fmt.Errorf("money locale must start with a lowercase ISO 639-1 language code like \"en-US\", got %q", c.Locale)
+	}
+	for _, cur := range c.Currencies {
+		if !containsString(currencyCodes, cur) {
+			return fmt.Errorf("money currency must be one of %q, got %q", currencyCodes, cur)
+		}
+	}
+
+	return nil
+}
+
+// language returns the language part of the locale of the MoneyConfig.
+func (c MoneyConfig) language() string {
+	lang, _, _ := strings.Cut(strings.ReplaceAll(c.Locale, "_", "-"), "-")
+	return lang
+}
+
+// amounts returns the values of the money amounts found in the given email
+// text in the currencies of the MoneyConfig, in order.
+func (c MoneyConfig) amounts(text string) []float64 {
+	var values []float64
+	for _, m := range moneyAmount.FindAllStringSubmatch(text, -1) {
+		var cur, num string
+		for i, name := range moneyAmount.SubexpNames() {
+			switch name {
+			case "pre", "post":
+				cur += m[i]
+			case "num", "num2":
+				num += m[i]
+			}
+		}
+		if code, ok := currencySymbols[cur]; ok {
+			cur = code
+		}
+		if len(c.Currencies) > 0 && !containsString(c.Currencies, cur) {
+			continue
+		}
+		v, err := c.parseNumber(num)
+		if err != nil {
+			continue
+		}
+		values = append(values, v)
+	}
+
+	return values
+}
+
+// parseNumber parses the given number with the decimal separator of the
+// locale of the MoneyConfig. Without a locale, the last comma or point is
+// the decimal separator if it is followed by one or two digits and is the
+// only one of its kind, or if the number has both. An error is returned if
+// the number cannot be parsed.
+func (c MoneyConfig) parseNumber(num string) (float64, error) {
+	decimal := '.'
+	switch {
+	case c.Locale != "" && decimalCommaLanguages[c.language()]:
+		decimal = ','
+	case c.Locale != "":
+	default:
+		last := strings.LastIndexAny(num, ".,")
+		if last >= 0 {
+			sep := rune(num[last])
+			decimals := len(num) - last - 1
+			if (decimals <= 2 && strings.Count(num, string(sep)) == 1) || strings.ContainsAny(num[:last], ".,") {
+				decimal = sep
+			} else {
+				decimal = 0
+			}
+		}
+	}
+
+	var b strings.Builder
+	for _, r := range num {
+		switch {
+		case r == decimal:
+			b.WriteRune('.')
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		}
+	}
+
+	return strconv.ParseFloat(b.String(), 64)
+}
+
+// moneyVars accepts an Alert and the messages matching it and returns the
+// largest money amount found in any of the messages' bodies and the sum of
+// the largest amount of each message, read according to the Alert's
+// MoneyConfig if it has one. Messages without amounts count as 0. An error
+// is returned if the Alerter's Matcher does not implement RawFetcher or if
+// there is a problem fetching a message.
+func (a Alerter) moneyVars(alt Alert, matches []Message) (float64, float64, error) {
+	fetcher, ok := a.Matcher.(RawFetcher)
+	if !ok {
+		return 0, 0, fmt.Errorf("matcher %T must implement RawFetcher to read money amounts", a.Matcher)
+	}
+	var c MoneyConfig
+	if alt.Money != nil {
+		c = *alt.Money
+	}
+
+	var max, total float64
+	for _, m := range matches {
+		raw, err := fetchRaw(fetcher, alt, m.ID)
+		if err != nil {
+			return 0, 0, err
+		}
+		text, err := bodyText(bytes.NewReader(raw), maxMoneyBodyBytes)
+		if err != nil {
+			a.errorLog().Printf("got error reading body of email %s, skipping its money amounts: %v", m.ID, err)
+			continue
+		}
+		var largest float64
+		for _, v := range c.amounts(html.UnescapeString(text)) {
+			if v > largest {
+				largest = v
+			}
+		}
+		total += largest
+		if largest > max {
+			max = largest
+		}
+	}
+
+	return max, total, nil
+}
@@ -0,0 +1,135 @@
+package gmailalert
+
+import (
+	"io"
+	"log"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMoneyConfigAmounts(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		config MoneyConfig
+		input  string
+		want   []float64
+	}{
+		"Symbols and codes before and after numbers": {
+			input: "Subtotal $1,234.56, shipping EUR 20, fees 3,50 € and £7",
+			want:  []float64{1234.56, 20, 3.5, 7},
+		},
+		"Guessed separators": {
+			input: "Paid 1.234,56 € and USD 1,234 and CHF 2'500.00",
+			want:  []float64{1234.56, 1234, 2500},
+		},
+		"German locale": {
+			config: MoneyConfig{Locale: "de-DE"},
+			input:  "Betrag: 1.234 EUR, Rabatt 12,5 EUR",
+			want:   []float64{1234, 12.5},
+		},
+		"English locale": {
+			config: MoneyConfig{Locale: "en_US"},
+			input:  "Total: $1.234",
+			want:   []float64{1.234},
+		},
+		"Only given currencies": {
+			config: MoneyConfig{Currencies: []string{"USD"}},
+			input:  "Charged US$ 45.10, converted from 40 EUR",
+			want:   []float64{45.1},
+		},
+		"Numbers without currency are ignored": {
+			input: "Order 12345 of 3 items, REF 20230",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got := tc.config.amounts(tc.input)
+			if !cmp.Equal(tc.want, got) {
+				t.Errorf("want != got\ndiff=%s", cmp.Diff(tc.want, got))
+			}
+		})
+	}
+}
+
+func TestMoneyConfigOK(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		input       MoneyConfig
+		errExpected bool
+	}{
+		"Empty config": {},
+		"Valid locale and currencies": {
+			input: MoneyConfig{Locale: "fr-CA", Currencies: []string{"CAD", "USD"}},
+		},
+		"Invalid locale": {
+			input:       MoneyConfig{Locale: "German"},
+			errExpected: true,
+		},
+		"Unknown currency": {
+			input:       MoneyConfig{Currencies: []string{"usd"}},
+			errExpected: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := tc.input.ok()
+			errReceived := err != nil
+
+			if tc.errExpected != errReceived {
+				t.Fatalf("ok returned unexpected error status: %v", err)
+			}
+		})
+	}
+}
+
+func TestAlerterConditionOnAmounts(t *testing.T) {
+	t.Parallel()
+
+	fetcher := fakeExportFetcher{
+		fakePreviewFetcher: fakePreviewFetcher{matches: []Message{{ID: "1"}, {ID: "2"}}},
+		raw: map[string][]byte{
+			"1": []byte("Content-Type: text/html\r\n\r\n<p>Card purchase of <b>&euro;120,00</b> at Shop</p>"),
+			"2": []byte("Subject: receipt\r\n\r\nYou paid EUR 450.00 (incl. EUR 71.85 VAT)."),
+		},
+	}
+	testCases := map[string]struct {
+		condition  string
+		wantNotify bool
+	}{
+		"Largest amount over threshold": {
+			condition:  "amount >= 450",
+			wantNotify: true,
+		},
+		"Largest amount under threshold": {
+			condition: "amount >= 500",
+		},
+		"Total of largest amounts": {
+			condition:  "totalAmount == 570",
+			wantNotify: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			notifier := &recordingTestNotifier{}
+			a, err := NewAlerter(fetcher, notifier, WithAlerterLogger(log.New(io.Discard, "", 0)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res := a.process(Alert{Name: "spend", GmailQuery: "from:bank", Condition: tc.condition}, nil)
+			if res.Err != nil {
+				t.Fatal(res.Err)
+			}
+
+			if notified := len(notifier.alerts) == 1; tc.wantNotify != notified {
+				t.Errorf("want notified %v for condition %q, got %v", tc.wantNotify, tc.condition, notified)
+			}
+		})
+	}
+}
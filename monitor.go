@@ -0,0 +1,204 @@
+package gmailalert
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// The events a Monitor notifies about.
+const (
+	MonitorStart  = "start"
+	MonitorStop   = "stop"
+	MonitorAuth   = "auth"
+	MonitorReload = "reload"
+	MonitorErrors = "errors"
+	MonitorCrash  = "crash"
+)
+
+// defaultMonitorErrorRate is the share of failed alerts in a run above which
+// a Monitor notifies about errors, unless configured otherwise.
+const defaultMonitorErrorRate = 0.5
+
+// monitorEvents are the events a Monitor notifies about, with the title of
+// their notifications.
+var monitorEvents = map[string]string{
+	MonitorStart:  "gmailalert started",
+	MonitorStop:   "gmailalert stopped",
+	MonitorAuth:   "gmailalert authorization failed",
+	MonitorReload: "gmailalert configuration rejected",
+	MonitorErrors: "gmailalert alerts failing",
+	MonitorCrash:  "gmailalert crashed",
+}
+
+// MonitorConfig represents the configuration of the notifications gmailalert
+// sends about its own operation, so that operational problems are heard
+// about through the same channel as email alerts.
+type MonitorConfig struct {
+	// The Pushover recipient of the notifications.
+	PushoverTarget string `json:"pushovertarget"`
+	// The Pushover sound of the notifications.
+	PushoverSound string `json:"pushoversound"`
+	// The events notified about, among "start" and "stop" of the daemon,
+	// "auth" when Gmail rejects the token, "reload" when a changed alert
+	// configuration is rejected, "errors" when too many alerts of a run
+	// fail, and "crash" when the daemon crashes unexpectedly. If empty,
+	// every event is notified about.
+	Events []string `json:"events"`
+	// The share of the alerts of a run, between 0 and 1, that must fail for
+	// the "errors" event to be notified. Defaults to 0.5.
+	ErrorRate float64 `json:"errorrate"`
+}
+
+// Monitor is a Reporter notifying about the operation of gmailalert itself:
+// the start, stop, and crash of the daemon, a rejected configuration
+// reload, Gmail rejecting the token, and runs in which too many alerts fail.
+// Problems lasting over several runs are only notified about once, until a
+// run without them. It is safe to be used concurrently by multiple goroutines.
+type Monitor struct {
+	cfg      MonitorConfig
+	events   map[string]bool
+	notifier Notifier
+	logger   Logger
+	mtx      sync.Mutex
+	// The events of problems notified about that did not go away since.
+	ongoing map[string]bool
+}
+
+// NewMonitor accepts a MonitorConfig, the Notifier to send its
+// notifications with, and the Logger to log notifications that could not be
+// sent to, and returns a new Monitor. An error is returned if the recipient
+// is empty, an event is unknown, or the error rate is not between 0 and 1.
+func NewMonitor(cfg MonitorConfig, n Notifier, l Logger) (*Monitor, error) {
+	if cfg.PushoverTarget == "" {
+		return nil, errors.New("monitor pushover target must not be empty")
+	}
+	if cfg.ErrorRate < 0 || cfg.ErrorRate > 1 {
+		return nil, fmt.Errorf("monitor error rate must be between 0 and 1, got %g", cfg.ErrorRate)
+	}
+	events := make(map[string]bool, len(monitorEvents))
+	for _, e := range cfg.Events {
+		if _, ok := monitorEvents[e]; !ok {
+			return nil, fmt.Errorf("unknown monitor event %q", e)
+		}
+		events[e] = true
+	}
+	if len(events) == 0 {
+		for e := range monitorEvents {
+			events[e] = true
+		}
+	}
+
+	return &Monitor{cfg: cfg, events: events, notifier: n, logger: l, ongoing: map[string]bool{}}, nil
+}
+
+// Started notifies that the daemon started.
+func (m *Monitor) Started() {
+	m.notify(MonitorStart, "The daemon started evaluating alerts.")
+}
+
+// Stopped notifies that the daemon stopped, with the given error it stopped
+// with, if any.
+func (m *Monitor) Stopped(err error) {
+	if err != nil {
+		m.notify(MonitorStop, fmt.Sprintf("The daemon stopped: %v", err))
+		return
+	}
+	m.notify(MonitorStop, "The daemon stopped.")
+}
+
+// Crashed notifies that the daemon crashed with the given panic value,
+// pointing to the given crash report file if one was written.
+func (m *Monitor) Crashed(v any, reportFile string) {
+	msg := fmt.Sprintf("The daemon crashed: %v", v)
+	if reportFile != "" {
+		msg += fmt.Sprintf(", see the crash report in %s", reportFile)
+	}
+	m.notify(MonitorCrash, msg)
+}
+
+// ReloadRejected notifies that a changed alert configuration was rejected
+// with the given error, and that the running one is kept.
+func (m *Monitor) ReloadRejected(err error) {
+	m.notify(MonitorReload, fmt.Sprintf("The changed configuration was rejected, the running one is kept: %v", err))
+}
+
+// AuthFailed notifies that Gmail rejected the token with the given error,
+// unless it was already notified about since the last run in which Gmail
+// accepted the token.
+func (m *Monitor) AuthFailed(err error) {
+	if m.start(MonitorAuth) {
+		m.notify(MonitorAuth, err.Error())
+	}
+}
+
+// Report accepts the Summary of a run and notifies if Gmail rejected the
+// token or if the share of failed alerts exceeds the error rate, unless
+// that was already notified about and did not go away since. It never
+// returns an error, since notifications that could not be sent are logged.
+func (m *Monitor) Report(s Summary) error {
+	var reauthErr error
+	for _, r := range s.Results {
+		if isReauthRequired(r.Err) {
+			reauthErr = r.Err
+			break
+		}
+	}
+	if reauthErr != nil {
+		m.AuthFailed(reauthErr)
+	} else {
+		m.end(MonitorAuth)
+	}
+
+	rate := m.cfg.ErrorRate
+	if rate == 0 {
+		rate = defaultMonitorErrorRate
+	}
+	if len(s.Results) == 0 || float64(s.Failed()) <= rate*float64(len(s.Results)) {
+		m.end(MonitorErrors)
+		return nil
+	}
+	if m.start(MonitorErrors) {
+		m.notify(MonitorErrors, fmt.Sprintf("%d of %d alerts failed in run %s, see the logs for details",
+			s.Failed(), len(s.Results), s.RunID))
+	}
+
+	return nil
+}
+
+// start records that the problem of the given event is ongoing and reports
+// whether it just started.
+func (m *Monitor) start(event string) bool {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	started := !m.ongoing[event]
+	m.ongoing[event] = true
+
+	return started
+}
+
+// end records that the problem of the given event went away.
+func (m *Monitor) end(event string) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	delete(m.ongoing, event)
+}
+
+// notify sends a notification with the given message about the given event,
+// if the Monitor notifies about it. A notification that cannot be sent is
+// logged.
+func (m *Monitor) notify(event, msg string) {
+	if !m.events[event] {
+		return
+	}
+	alt := Alert{
+		Name:           "gmailalert monitor",
+		PushoverTitle:  monitorEvents[event],
+		PushoverTarget: m.cfg.PushoverTarget,
+		PushoverSound:  m.cfg.PushoverSound,
+		PushoverMsg:    msg,
+	}
+	if err := m.notifier.Notify(alt); err != nil {
+		m.logger.Printf("got error sending %q monitor notification: %v", event, err)
+	}
+}
@@ -0,0 +1,110 @@
+package gmailalert
+
+import (
+	"errors"
+	"io"
+	"log"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewMonitor(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		cfg         MonitorConfig
+		errExpected bool
+	}{
+		"Valid config": {
+			cfg: MonitorConfig{PushoverTarget: "ops", Events: []string{"start", "errors"}, ErrorRate: 0.2},
+		},
+		"Empty target returns error": {
+			cfg:         MonitorConfig{},
+			errExpected: true,
+		},
+		"Unknown event returns error": {
+			cfg:         MonitorConfig{PushoverTarget: "ops", Events: []string{"explode"}},
+			errExpected: true,
+		},
+		"Error rate above 1 returns error": {
+			cfg:         MonitorConfig{PushoverTarget: "ops", ErrorRate: 1.5},
+			errExpected: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewMonitor(tc.cfg, &recordingTestNotifier{}, log.New(io.Discard, "", 0))
+			errReceived := err != nil
+
+			if tc.errExpected != errReceived {
+				t.Fatalf("NewMonitor(%+v) returned unexpected error status: %v", tc.cfg, err)
+			}
+		})
+	}
+}
+
+func TestMonitorNotifiesOngoingProblemsOnce(t *testing.T) {
+	t.Parallel()
+
+	n := &recordingTestNotifier{}
+	m, err := NewMonitor(MonitorConfig{PushoverTarget: "ops"}, n, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rejected := &reauthRequiredError{msg: "token rejected", err: errors.New("invalid_grant")}
+	failing := Summary{RunID: "run", Results: []AlertResult{
+		{Alert: "bills", Err: rejected},
+		{Alert: "orders", Err: errors.New("quota exceeded")},
+		{Alert: "boss"},
+	}}
+	healthy := Summary{RunID: "run", Results: []AlertResult{{Alert: "bills"}, {Alert: "orders"}, {Alert: "boss"}}}
+
+	m.Started()
+	for _, s := range []Summary{failing, failing, healthy, failing} {
+		if err := m.Report(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m.Stopped(nil)
+
+	var got []string
+	for _, alt := range n.alerts {
+		if alt.PushoverTarget != "ops" {
+			t.Errorf("want monitor notifications sent to %q, got %q", "ops", alt.PushoverTarget)
+		}
+		got = append(got, alt.PushoverTitle)
+	}
+	want := []string{
+		"gmailalert started",
+		"gmailalert authorization failed",
+		"gmailalert alerts failing",
+		"gmailalert authorization failed",
+		"gmailalert alerts failing",
+		"gmailalert stopped",
+	}
+	if !cmp.Equal(want, got) {
+		t.Errorf("want != got\ndiff=%s", cmp.Diff(want, got))
+	}
+}
+
+func TestMonitorOnlyNotifiesConfiguredEvents(t *testing.T) {
+	t.Parallel()
+
+	n := &recordingTestNotifier{}
+	cfg := MonitorConfig{PushoverTarget: "ops", Events: []string{"reload"}, ErrorRate: 0.9}
+	m, err := NewMonitor(cfg, n, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m.Started()
+	m.Report(Summary{Results: []AlertResult{{Err: errors.New("quota exceeded")}}})
+	m.ReloadRejected(errors.New("got an error decoding JSON"))
+	m.Stopped(nil)
+
+	if len(n.alerts) != 1 || n.alerts[0].PushoverTitle != "gmailalert configuration rejected" {
+		t.Errorf("want only the rejected reload notified, got %+v", n.alerts)
+	}
+}
@@ -0,0 +1,121 @@
+package gmailalert
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// otpPatterns match the verification codes of common sign-in emails, like
+// "Your verification code is 123456", "123456 is your login code", or
+// Google's "G-123456". Their first group is the code.
+var otpPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`\bG-(\d{6})\b`),
+	regexp.MustCompile(`(?i)\b(?:code|otp|passcode|pin|token)\b\D{0,20}?\b(\d{4,8})\b`),
+	regexp.MustCompile(`(?i)\b(\d{4,8})\b\s+is\s+your\b`),
+}
+
+// OTPConfig represents how the verification codes of the emails matching an
+// alert, like one-time passwords sent when signing in, are extracted and
+// pushed on their own with high priority.
+type OTPConfig struct {
+	// The addresses, like "noreply@example.com", or domains, like
+	// "example.com", of the senders whose emails codes are taken from. A
+	// domain also allows its subdomains. If empty, codes are taken from
+	// emails of any sender.
+	Senders []string `json:"senders"`
+	// Regular expressions matching codes, tried before the built-in ones.
+	// If a pattern has a group, the code is its first group, and otherwise
+	// the whole match.
+	Patterns []string `json:"patterns"`
+}
+
+// ok returns an error if any sender of the OTPConfig is empty or any of its
+// patterns is not a valid regular expression.
+func (c OTPConfig) ok() error {
+	for _, s := range c.Senders {
+		if strings.TrimSpace(s) == "" {
+			return fmt.Errorf("otp senders must not be empty, got %q", c.Senders)
+		}
+	}
+	for _, pattern := range c.Patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("got error compiling otp pattern %q: %v", pattern, err)
+		}
+	}
+
+	return nil
+}
+
+// allows reports whether the OTPConfig takes codes from emails with the
+// given From header value.
+func (c OTPConfig) allows(from string) bool {
+	if len(c.Senders) == 0 {
+		return true
+	}
+	addr, domain := senderAddress(from), senderDomain(from)
+	for _, s := range c.Senders {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if addr == s || domain == s || strings.HasSuffix(domain, "."+s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// code returns the verification code in the subject or snippet of the given
+// message, or an empty string if it has none. The patterns of the OTPConfig
+// are tried before the built-in ones, and must be valid, as checked by ok.
+func (c OTPConfig) code(msg Message) string {
+	patterns := make([]*regexp.Regexp, 0, len(c.Patterns)+len(otpPatterns))
+	for _, pattern := range c.Patterns {
+		patterns = append(patterns, regexp.MustCompile(pattern))
+	}
+	patterns = append(patterns, otpPatterns...)
+
+	for _, text := range []string{msg.Subject, msg.Snippet} {
+		for _, re := range patterns {
+			m := re.FindStringSubmatch(text)
+			if m == nil {
+				continue
+			}
+			if len(m) > 1 {
+				return m[1]
+			}
+			return m[0]
+		}
+	}
+
+	return ""
+}
+
+// withCodes accepts an Alert with an OTPConfig and the messages matching the
+// Alert, fetches the metadata and snippet of each message, and returns the
+// fetched messages from allowed senders that hold a verification code. An
+// error is returned if the Alerter's Matcher does not implement Fetcher or
+// if there is a problem fetching a message.
+func (a Alerter) withCodes(alt Alert, matches []Message) ([]Message, error) {
+	fetcher, ok := a.Matcher.(Fetcher)
+	if !ok {
+		return nil, fmt.Errorf("matcher %T must implement Fetcher to extract verification codes", a.Matcher)
+	}
+
+	kept := make([]Message, 0, len(matches))
+	for _, m := range matches {
+		msg, err := fetcher.Fetch(m.ID)
+		if err != nil {
+			return nil, err
+		}
+		if alt.OTP.allows(msg.From) && alt.OTP.code(msg) != "" {
+			kept = append(kept, msg)
+		}
+	}
+
+	if ignored := len(matches) - len(kept); ignored > 0 {
+		a.Logger.Printf("ignored %d emails without a verification code from an allowed sender matching alert %q",
+			ignored, alt.key())
+	}
+
+	return kept, nil
+}
@@ -0,0 +1,132 @@
+package gmailalert
+
+import (
+	"io"
+	"log"
+	"testing"
+)
+
+func TestOTPConfigCode(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		config OTPConfig
+		input  Message
+		want   string
+	}{
+		"Code after keyword in snippet": {
+			input: Message{Subject: "Sign in to Example", Snippet: "Your verification code is 482913. It expires in 10 minutes."},
+			want:  "482913",
+		},
+		"Code before keyword in subject": {
+			input: Message{Subject: "771204 is your Example login code"},
+			want:  "771204",
+		},
+		"Google code": {
+			input: Message{Subject: "G-350128 is your Google verification code"},
+			want:  "350128",
+		},
+		"Custom pattern with group": {
+			config: OTPConfig{Patterns: []string{`ref ([A-Z]{3}\d{3})`}},
+			input:  Message{Snippet: "Use ref ABC123 to confirm, not code 1234"},
+			want:   "ABC123",
+		},
+		"Custom pattern without group": {
+			config: OTPConfig{Patterns: []string{`[A-Z]{3}-\d{3}`}},
+			input:  Message{Snippet: "Enter XYZ-987 to continue"},
+			want:   "XYZ-987",
+		},
+		"No code": {
+			input: Message{Subject: "Your order of 2026 widgets has shipped"},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if got := tc.config.code(tc.input); tc.want != got {
+				t.Errorf("want %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestOTPConfigAllows(t *testing.T) {
+	t.Parallel()
+
+	senders := []string{"example.com", "NoReply@bank.test"}
+	testCases := map[string]struct {
+		senders []string
+		from    string
+		want    bool
+	}{
+		"Allowed domain":        {senders: senders, from: "Example <login@example.com>", want: true},
+		"Subdomain of domain":   {senders: senders, from: "accounts@mail.example.com", want: true},
+		"Allowed address":       {senders: senders, from: "Bank <noreply@bank.test>", want: true},
+		"Other address":         {senders: senders, from: "alerts@bank.test"},
+		"Lookalike domain":      {senders: senders, from: "login@badexample.com"},
+		"Unparseable From":      {senders: senders, from: "not an address"},
+		"Any sender if not set": {from: "anyone@anywhere.test", want: true},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if got := (OTPConfig{Senders: tc.senders}).allows(tc.from); tc.want != got {
+				t.Errorf("want %v for sender %q, got %v", tc.want, tc.from, got)
+			}
+		})
+	}
+}
+
+func TestAlerterNotifiesVerificationCode(t *testing.T) {
+	t.Parallel()
+
+	fetcher := fakePreviewFetcher{
+		matches: []Message{{ID: "1"}, {ID: "2"}, {ID: "3"}},
+		msgs: map[string]Message{
+			"1": {ID: "1", From: "phish@example.net", Subject: "Your code is 111111"},
+			"2": {ID: "2", From: "login@example.com", Subject: "Welcome back"},
+			"3": {ID: "3", From: "login@example.com", Snippet: "Your code is 222222"},
+		},
+	}
+	notifier := &recordingTestNotifier{}
+	a, err := NewAlerter(fetcher, notifier, WithAlerterLogger(log.New(io.Discard, "", 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := a.process(Alert{Name: "codes", GmailQuery: "newer_than:1h", OTP: &OTPConfig{Senders: []string{"example.com"}}}, nil)
+	if res.Err != nil {
+		t.Fatal(res.Err)
+	}
+
+	if res.Matches != 1 || len(notifier.alerts) != 1 || notifier.alerts[0].PushoverMsg != "222222" {
+		t.Errorf("want only code \"222222\" notified, got result %+v and notified alerts %+v", res, notifier.alerts)
+	}
+}
+
+func TestAlertOKRejectsInvalidOTP(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]Alert{
+		"Invalid pattern": {
+			GmailQuery: "test", PushoverTarget: "test", PushoverTitle: "test", PushoverSound: "test",
+			OTP: &OTPConfig{Patterns: []string{"("}},
+		},
+		"Empty sender": {
+			GmailQuery: "test", PushoverTarget: "test", PushoverTitle: "test", PushoverSound: "test",
+			OTP: &OTPConfig{Senders: []string{" "}},
+		},
+		"Snippet with code": {
+			GmailQuery: "test", PushoverTarget: "test", PushoverTitle: "test", PushoverSound: "test",
+			OTP: &OTPConfig{}, Snippet: &SnippetConfig{},
+		},
+	}
+
+	for name, alt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if err := alt.OK(); err == nil {
+				t.Error("expected an error but did not get one")
+			}
+		})
+	}
+}
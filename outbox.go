@@ -0,0 +1,248 @@
+package gmailalert
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxOutboxAttempts is the number of times a notification in an Outbox is
+// attempted before it is dropped.
+const maxOutboxAttempts = 5
+
+// OutboxEntry represents a notification recorded in an Outbox before it is
+// sent.
+type OutboxEntry struct {
+	// The key deduplicating the notification, derived from the alert and
+	// the IDs of the messages it matched.
+	Key string `json:"key"`
+	// The evaluation ID of the alert the notification was created by.
+	EvalID string `json:"evalid"`
+	// The alert to notify. Its Attachment is not persisted.
+	Alert Alert `json:"alert"`
+	// The IDs of the messages the alert matched.
+	MessageIDs []string `json:"messageids"`
+	// When the notification was first recorded.
+	Queued time.Time `json:"queued"`
+	// The number of times sending the notification was attempted.
+	Attempts int `json:"attempts"`
+}
+
+// Outbox represents the notifications that are about to be sent, persisted
+// as JSON in a local file so that notifications interrupted by a crash or a
+// failure of the notification provider can be sent on the next run. It is
+// safe for concurrent use by multiple goroutines.
+type Outbox struct {
+	file    string
+	mtx     sync.Mutex
+	entries map[string]OutboxEntry
+}
+
+// LoadOutbox accepts the name of a JSON outbox file and returns an Outbox
+// populated from it. If the file does not exist, an empty Outbox is returned.
+// An error is returned if the file name is empty or if the file exists but
+// cannot be read or decoded.
+func LoadOutbox(file string) (*Outbox, error) {
+	if file == "" {
+		return nil, errors.New("outbox file name must not be empty")
+	}
+
+	o := &Outbox{file: file, entries: map[string]OutboxEntry{}}
+	f, err := os.Open(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return o, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("got error opening outbox file %s: %v", file, err)
+	}
+	defer f.Close()
+
+	if err := json.NewDecoder(f).Decode(&o.entries); err != nil {
+		return nil, fmt.Errorf("got error json-decoding outbox file %s: %v", file, err)
+	}
+
+	return o, nil
+}
+
+// Add stores the given OutboxEntry under its key, replacing any entry with
+// the same key, and writes the Outbox into its file. An error is returned if
+// there is a problem writing the file.
+func (o *Outbox) Add(e OutboxEntry) error {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+
+	o.entries[e.Key] = e
+
+	return o.save()
+}
+
+// Remove deletes the OutboxEntry stored under the given key and writes the
+// Outbox into its file. An error is returned if there is a problem writing
+// the file.
+func (o *Outbox) Remove(key string) error {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+
+	delete(o.entries, key)
+
+	return o.save()
+}
+
+// Pending returns the entries of the Outbox, oldest first.
+func (o *Outbox) Pending() []OutboxEntry {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+
+	pending := make([]OutboxEntry, 0, len(o.entries))
+	for _, e := range o.entries {
+		pending = append(pending, e)
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		if pending[i].Queued.Equal(pending[j].Queued) {
+			return pending[i].Key < pending[j].Key
+		}
+		return pending[i].Queued.Before(pending[j].Queued)
+	})
+
+	return pending
+}
+
+// save writes the entries of the Outbox into a temporary file and renames
+// it over the outbox file, so that a crash while writing cannot corrupt the
+// outbox file. The caller must hold the Outbox's mutex.
+func (o *Outbox) save() error {
+	b, err := json.Marshal(o.entries)
+	if err != nil {
+		return fmt.Errorf("got error json-encoding outbox: %v", err)
+	}
+
+	tmp := o.file + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return fmt.Errorf("got error writing outbox file %s: %v", tmp, err)
+	}
+	if err := os.Rename(tmp, o.file); err != nil {
+		return fmt.Errorf("got error replacing outbox file %s: %v", o.file, err)
+	}
+
+	return nil
+}
+
+// outboxKey returns the key deduplicating the notification of the alert with
+// the given key for the given matching message IDs.
+func outboxKey(alertKey string, ids []string) string {
+	sorted := append([]string(nil), ids...)
+	sort.Strings(sorted)
+	sum := sha256.Sum256([]byte(strings.Join(sorted, ",")))
+
+	return alertKey + ":" + hex.EncodeToString(sum[:8])
+}
+
+// WithAlerterOutbox accepts an Outbox and returns a functional option for
+// wiring the Outbox to an Alerter.
+func WithAlerterOutbox(o *Outbox) AlerterOption {
+	return func(a *Alerter) {
+		a.Outbox = o
+	}
+}
+
+// keepFailedRecipients replaces the recipients of the notification stored in
+// the Alerter's Outbox under the given key with the given recipients it
+// could not be sent to, so that it is only resent to them.
+func (a Alerter) keepFailedRecipients(key string, failed []string) {
+	for _, e := range a.Outbox.Pending() {
+		if e.Key != key {
+			continue
+		}
+		e.Alert.PushoverTarget, e.Alert.PushoverTargets = "", failed
+		if err := a.Outbox.Add(e); err != nil {
+			a.errorLog().Printf("got error recording failed recipients in outbox: %v", err)
+		}
+		return
+	}
+}
+
+// resume sends the notifications left in the Alerter's Outbox by previous
+// runs, dropping those that were attempted too many times. A notification
+// that failed for some of its recipients is only resent to those. Like any
+// other notification, it is first passed to the BeforeNotify function of
+// the Alerter's Hooks: one they skip is left in the Outbox without counting
+// an attempt, unless the Alerter does not hold its lease, in which case it
+// is dropped for the lease holder to send. It returns the outcome of each
+// attempted notification by its key.
+func (a Alerter) resume() map[string]error {
+	resumed := map[string]error{}
+	for _, e := range a.Outbox.Pending() {
+		alt := e.Alert
+		alt.EvalID, alt.DedupKey, alt.Matches = e.EvalID, e.Key, len(e.MessageIDs)
+		logger := tracedLogger{l: a.Logger, prefix: "[eval " + alt.EvalID + "] "}
+		errLogger := tracedLogger{l: a.errorLog(), prefix: "[eval " + alt.EvalID + "] "}
+
+		if e.Attempts >= maxOutboxAttempts {
+			errLogger.Printf("dropping notification titled %q from outbox after %d attempts", alt.PushoverTitle, e.Attempts)
+			if err := a.Outbox.Remove(e.Key); err != nil {
+				errLogger.Printf("got error removing notification from outbox: %v", err)
+			}
+			continue
+		}
+
+		hookErr := a.beforeNotify(&alt)
+		if errors.Is(hookErr, ErrNotLeaseHolder) {
+			logger.Printf(`dropping notification titled "%s" from outbox, %v`, alt.PushoverTitle, hookErr)
+			if err := a.Outbox.Remove(e.Key); err != nil {
+				errLogger.Printf("got error removing notification from outbox: %v", err)
+			}
+			continue
+		}
+		if errors.Is(hookErr, ErrSkipNotification) {
+			logger.Printf(`notification titled "%s" left in outbox, suppressed by hook`, alt.PushoverTitle)
+			continue
+		}
+
+		e.Attempts++
+		if err := a.Outbox.Add(e); err != nil {
+			errLogger.Printf("got error recording notification attempt in outbox: %v", err)
+		}
+		if hookErr != nil {
+			errLogger.Printf("%v", hookErr)
+			resumed[e.Key] = hookErr
+			continue
+		}
+
+		result, err := a.notify(alt)
+		a.afterNotify(alt, result, err)
+		resumed[e.Key] = err
+		if err != nil {
+			errLogger.Printf("got error resending notification from outbox: %v", err)
+			if failed := failedRecipients(err); len(failed) > 0 {
+				a.keepFailedRecipients(e.Key, failed)
+			}
+			a.publish(EventNotifyFailed, alt, len(e.MessageIDs), err)
+			continue
+		}
+		logger.Printf(`notification titled "%s" from outbox successfully sent via %T`, alt.PushoverTitle, a.Notifier)
+		a.publish(EventNotifySent, alt, len(e.MessageIDs), nil)
+
+		if err := a.Outbox.Remove(e.Key); err != nil {
+			errLogger.Printf("got error removing notification from outbox: %v", err)
+		}
+		if a.State != nil {
+			tx := a.State.Begin()
+			st := tx.Get(alt.key())
+			st.Notified, st.MessageIDs = a.now(), e.MessageIDs
+			st = recordReceipts(st, result.Receipts, st.Notified)
+			tx.Set(alt.key(), a.recordSent(st, e.Key, st.Notified))
+			if err := tx.Commit(); err != nil {
+				errLogger.Printf("got error committing state of alert %q: %v", alt.key(), err)
+			}
+		}
+	}
+
+	return resumed
+}
@@ -0,0 +1,255 @@
+package gmailalert_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aculclasure/gmailalert"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLoadOutboxWithEmptyFileNameReturnsError(t *testing.T) {
+	t.Parallel()
+
+	if _, err := gmailalert.LoadOutbox(""); err == nil {
+		t.Error("expected an error but did not get one")
+	}
+}
+
+func TestLoadOutboxWithInvalidFileReturnsError(t *testing.T) {
+	t.Parallel()
+
+	file := filepath.Join(t.TempDir(), "outbox.json")
+	if err := os.WriteFile(file, []byte("this-is-not-json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := gmailalert.LoadOutbox(file); err == nil {
+		t.Error("expected an error but did not get one")
+	}
+}
+
+func TestOutboxPersistsPendingEntries(t *testing.T) {
+	t.Parallel()
+
+	file := filepath.Join(t.TempDir(), "outbox.json")
+	outbox, err := gmailalert.LoadOutbox(file)
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+
+	older := gmailalert.OutboxEntry{
+		Key:        "older",
+		EvalID:     "run.0",
+		Alert:      gmailalert.Alert{GmailQuery: "is:unread", PushoverMsg: "Found 1 emails"},
+		MessageIDs: []string{"id0"},
+		Queued:     time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC),
+		Attempts:   1,
+	}
+	newer := older
+	newer.Key = "newer"
+	newer.Queued = older.Queued.Add(time.Minute)
+	for _, e := range []gmailalert.OutboxEntry{newer, older, {Key: "removed"}} {
+		if err := outbox.Add(e); err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+	}
+	if err := outbox.Remove("removed"); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+
+	loaded, err := gmailalert.LoadOutbox(file)
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	got := loaded.Pending()
+
+	want := []gmailalert.OutboxEntry{older, newer}
+	if !cmp.Equal(want, got) {
+		t.Errorf("want != got\ndiff=%s", cmp.Diff(want, got))
+	}
+}
+
+func TestProcessWithOutbox(t *testing.T) {
+	t.Parallel()
+
+	t.Run("sent notifications are removed from the outbox", func(t *testing.T) {
+		outbox, err := gmailalert.LoadOutbox(filepath.Join(t.TempDir(), "outbox.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		alt := gmailalert.Alerter{
+			Matcher:  fakeMatcher{matches: []gmailalert.Message{{ID: "matching-email1"}}},
+			Notifier: fakeNotifier{},
+			Logger:   &spyLogger{},
+			Outbox:   outbox,
+		}
+
+		if err := alt.Process([]gmailalert.Alert{{GmailQuery: "is:unread"}}); err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		if got := outbox.Pending(); len(got) != 0 {
+			t.Errorf("wanted an empty outbox, got %+v", got)
+		}
+	})
+
+	t.Run("unsent notifications are resent on the next run without duplicates", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "outbox.json")
+		outbox, err := gmailalert.LoadOutbox(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		matcher := fakeMatcher{matches: []gmailalert.Message{{ID: "matching-email1"}}}
+		alerts := []gmailalert.Alert{{GmailQuery: "is:unread", PushoverTitle: "Unread"}}
+		failing := gmailalert.Alerter{
+			Matcher:  matcher,
+			Notifier: fakeNotifier{err: errSendingNotification},
+			Logger:   &spyLogger{},
+			Outbox:   outbox,
+		}
+		if err := failing.Process(alerts); err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+		if got := len(outbox.Pending()); got != 1 {
+			t.Fatalf("wanted 1 notification left in the outbox, got %d", got)
+		}
+
+		outbox, err = gmailalert.LoadOutbox(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recNotif := &recordingNotifier{}
+		spyRep := &spyReporter{}
+		resuming := gmailalert.Alerter{
+			Matcher:   matcher,
+			Notifier:  recNotif,
+			Logger:    &spyLogger{},
+			Outbox:    outbox,
+			Reporters: []gmailalert.Reporter{spyRep},
+		}
+		if err := resuming.Process(alerts); err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		if len(recNotif.alerts) != 1 || recNotif.alerts[0].PushoverTitle != "Unread" {
+			t.Errorf("wanted the unsent notification to be sent once, got %+v", recNotif.alerts)
+		}
+		if got := spyRep.summaries[0].Notified(); got != 1 {
+			t.Errorf("wanted 1 alert reported as notified, got %d", got)
+		}
+		if got := outbox.Pending(); len(got) != 0 {
+			t.Errorf("wanted an empty outbox, got %+v", got)
+		}
+	})
+
+	t.Run("notifications failing for some recipients are only resent to them", func(t *testing.T) {
+		outbox, err := gmailalert.LoadOutbox(filepath.Join(t.TempDir(), "outbox.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		notif := &partialNotifier{failures: map[string]int{"bob": 1}}
+		alt := gmailalert.Alerter{
+			Matcher:  fakeMatcher{matches: []gmailalert.Message{{ID: "matching-email1"}}},
+			Notifier: notif,
+			Logger:   &spyLogger{},
+			Outbox:   outbox,
+		}
+		alerts := []gmailalert.Alert{{GmailQuery: "is:unread", PushoverTarget: "alice", PushoverTargets: []string{"bob"}}}
+
+		for i := 0; i < 2; i++ {
+			if err := alt.Process(alerts); err != nil {
+				t.Fatalf("got unexpected error: %v", err)
+			}
+		}
+
+		want := [][]string{{"alice", "bob"}, {"bob"}}
+		if !cmp.Equal(want, notif.calls) {
+			t.Errorf("want != got\ndiff=%s", cmp.Diff(want, notif.calls))
+		}
+		if got := outbox.Pending(); len(got) != 0 {
+			t.Errorf("wanted an empty outbox, got %+v", got)
+		}
+	})
+
+	t.Run("notifications are dropped after too many attempts", func(t *testing.T) {
+		outbox, err := gmailalert.LoadOutbox(filepath.Join(t.TempDir(), "outbox.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := outbox.Add(gmailalert.OutboxEntry{Key: "stale", Attempts: 5}); err != nil {
+			t.Fatal(err)
+		}
+		spyNotif := &spyNotifier{}
+		alt := gmailalert.Alerter{
+			Matcher:  fakeMatcher{},
+			Notifier: spyNotif,
+			Logger:   &spyLogger{},
+			Outbox:   outbox,
+		}
+
+		if err := alt.Process(nil); err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		if spyNotif.numCalls != 0 {
+			t.Errorf("wanted 0 notifications to be sent, got %d", spyNotif.numCalls)
+		}
+		if got := outbox.Pending(); len(got) != 0 {
+			t.Errorf("wanted an empty outbox, got %+v", got)
+		}
+	})
+
+	t.Run("notifications skipped by hooks are left in the outbox without an attempt", func(t *testing.T) {
+		testCases := map[string]struct {
+			hookErr error
+			want    []gmailalert.OutboxEntry
+		}{
+			"Skipped notification": {
+				hookErr: gmailalert.ErrSkipNotification,
+				want:    []gmailalert.OutboxEntry{{Key: "pending", Attempts: 1}},
+			},
+			"Notification skipped by a lease held by another instance": {
+				hookErr: fmt.Errorf("%w: %w", gmailalert.ErrSkipNotification, gmailalert.ErrNotLeaseHolder),
+				want:    []gmailalert.OutboxEntry{},
+			},
+		}
+
+		for name, tc := range testCases {
+			t.Run(name, func(t *testing.T) {
+				outbox, err := gmailalert.LoadOutbox(filepath.Join(t.TempDir(), "outbox.json"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := outbox.Add(gmailalert.OutboxEntry{Key: "pending", Attempts: 1}); err != nil {
+					t.Fatal(err)
+				}
+				spyNotif := &spyNotifier{}
+				alt := gmailalert.Alerter{
+					Matcher:  fakeMatcher{},
+					Notifier: spyNotif,
+					Logger:   &spyLogger{},
+					Outbox:   outbox,
+					Hooks: []gmailalert.Hook{{
+						BeforeNotify: func(*gmailalert.Alert) error { return tc.hookErr },
+					}},
+				}
+
+				if err := alt.Process(nil); err != nil {
+					t.Fatalf("got unexpected error: %v", err)
+				}
+
+				if spyNotif.numCalls != 0 {
+					t.Errorf("wanted 0 notifications to be sent, got %d", spyNotif.numCalls)
+				}
+				got := outbox.Pending()
+				if !cmp.Equal(tc.want, got) {
+					t.Errorf("want != got\ndiff=%s", cmp.Diff(tc.want, got))
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,171 @@
+package gmailalert
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Poll processes the given alerts repeatedly, each on its own schedule,
+// until the given context is cancelled. Every alert is processed immediately
+// and then again once its polling interval has elapsed. The interval of an
+// alert starts at minInterval and adapts to the activity of its mailbox: it
+// is reset to minInterval whenever the number of emails matching the alert
+// changes, and doubled, up to maxInterval, whenever it does not. The interval
+// of an alert that fails to be processed is kept. Alerts that are due at the
+// same time are processed together as a single run, whose Summary is passed
+// to the Alerter's Reporters and Control. Alerts the Control requests to be
+// evaluated now are processed in the next run, regardless of when they are
+// due. With the Alerter's Spread strategy, the first run of each alert is
+// delayed by its phase of minInterval instead, and up to a tenth of its
+// interval is added to every later one. With the Alerter's Shards, alerts
+// are instead processed in rotating cohorts, as described by pollShards,
+// with maxInterval as the longest time between two runs of an alert.
+//
+// Poll returns nil once the context is cancelled. An error is returned if
+// the Alerter receiver has any nil fields, if the alerts are suppressed by
+// unknown alerts or by each other in a cycle, if the Spread strategy is
+// unknown, if the number of Shards is negative, or if the intervals are not
+// positive with minInterval no greater than maxInterval.
+func (a Alerter) Poll(ctx context.Context, alerts []Alert, minInterval, maxInterval time.Duration) error {
+	if err := a.ok(); err != nil {
+		return err
+	}
+	if err := checkDependencies(alerts); err != nil {
+		return err
+	}
+	if err := a.Spread.ok(); err != nil {
+		return err
+	}
+	if minInterval <= 0 || maxInterval < minInterval {
+		return fmt.Errorf("poll intervals must be positive with the minimum no greater than the maximum, got minimum %s and maximum %s",
+			minInterval, maxInterval)
+	}
+	if a.Shards < 0 {
+		return fmt.Errorf("number of shards must not be negative, got %d", a.Shards)
+	}
+	if a.Shards > 0 {
+		return a.pollShards(ctx, alerts, maxInterval)
+	}
+
+	schedules := make([]pollSchedule, len(alerts))
+	for i := range schedules {
+		phase := a.Spread.phase(alerts[i], i, len(alerts))
+		schedules[i] = pollSchedule{
+			due:      a.now().Add(time.Duration(phase * float64(minInterval))),
+			interval: minInterval,
+			matches:  -1,
+			phase:    phase,
+		}
+	}
+	var wake <-chan struct{}
+	if a.Control != nil {
+		a.Control.start(alerts)
+		wake = a.Control.wake
+	}
+
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		var requested map[string]bool
+		if a.Control != nil {
+			requested = a.Control.takeRequests()
+		}
+		var due []int
+		for i, s := range schedules {
+			if !s.due.After(a.now()) || requested[""] || requested[alerts[i].key()] {
+				due = append(due, i)
+			}
+		}
+		if len(due) > 0 {
+			batch := make([]Alert, len(due))
+			for j, i := range due {
+				batch[j] = alerts[i]
+			}
+			summary := a.run(batch)
+			for j, i := range due {
+				schedules[i] = schedules[i].next(summary.Results[j], minInterval, maxInterval, a.now())
+			}
+			if a.Control != nil {
+				next := make([]time.Time, len(due))
+				for j, i := range due {
+					next[j] = schedules[i].due
+				}
+				a.Control.record(summary, next)
+			}
+		}
+
+		if err := a.sleep(ctx, nextDue(schedules), wake); err != nil {
+			return nil
+		}
+	}
+}
+
+// pollSchedule represents when an alert is next due to be processed by Poll.
+type pollSchedule struct {
+	due      time.Time
+	interval time.Duration
+	// The number of emails matching the alert when it was last processed,
+	// or -1 if it was never processed successfully.
+	matches int
+	// The position of the alert within its interval, between 0 and 1, as
+	// given by the Alerter's Spread strategy.
+	phase float64
+}
+
+// next returns the schedule following the receiver s after an alert was
+// processed at the given time with the given result. Up to a tenth of the
+// new interval is added to it, in proportion to the alert's phase.
+func (s pollSchedule) next(res AlertResult, minInterval, maxInterval time.Duration, now time.Time) pollSchedule {
+	switch {
+	case res.Err != nil:
+	case res.Matches != s.matches:
+		s.interval = minInterval
+		s.matches = res.Matches
+	default:
+		s.interval *= 2
+		if s.interval > maxInterval {
+			s.interval = maxInterval
+		}
+	}
+	s.due = now.Add(s.interval + time.Duration(s.phase*spreadJitter*float64(s.interval)))
+
+	return s
+}
+
+// nextDue returns the earliest due time of the given schedules, or the zero
+// time if there are none.
+func nextDue(schedules []pollSchedule) time.Time {
+	var next time.Time
+	for _, s := range schedules {
+		if next.IsZero() || s.due.Before(next) {
+			next = s.due
+		}
+	}
+
+	return next
+}
+
+// sleepUntil blocks until the given time, until a value is received from
+// the given wake channel, or until the given context is cancelled, in which
+// case the context's error is returned. If the given time is zero, it does
+// not wake up at any time. A nil wake channel is never received from.
+func sleepUntil(ctx context.Context, t time.Time, wake <-chan struct{}) error {
+	var at <-chan time.Time
+	if !t.IsZero() {
+		timer := time.NewTimer(time.Until(t))
+		defer timer.Stop()
+		at = timer.C
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-at:
+		return nil
+	case <-wake:
+		return nil
+	}
+}
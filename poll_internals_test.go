@@ -0,0 +1,114 @@
+package gmailalert
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPollScheduleNext(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	testCases := map[string]struct {
+		schedule pollSchedule
+		result   AlertResult
+		want     pollSchedule
+	}{
+		"Changed number of matches resets the interval": {
+			schedule: pollSchedule{interval: 8 * time.Minute, matches: 1},
+			result:   AlertResult{Matches: 2},
+			want:     pollSchedule{due: now.Add(time.Minute), interval: time.Minute, matches: 2},
+		},
+		"First successful evaluation resets the interval": {
+			schedule: pollSchedule{interval: time.Minute, matches: -1},
+			result:   AlertResult{},
+			want:     pollSchedule{due: now.Add(time.Minute), interval: time.Minute, matches: 0},
+		},
+		"Unchanged number of matches doubles the interval": {
+			schedule: pollSchedule{interval: 2 * time.Minute, matches: 1},
+			result:   AlertResult{Matches: 1},
+			want:     pollSchedule{due: now.Add(4 * time.Minute), interval: 4 * time.Minute, matches: 1},
+		},
+		"Interval is capped at the maximum": {
+			schedule: pollSchedule{interval: 8 * time.Minute, matches: 0},
+			result:   AlertResult{},
+			want:     pollSchedule{due: now.Add(10 * time.Minute), interval: 10 * time.Minute, matches: 0},
+		},
+		"Phase adds jitter to the interval": {
+			schedule: pollSchedule{interval: 2 * time.Minute, matches: 1, phase: 0.5},
+			result:   AlertResult{Matches: 1},
+			want:     pollSchedule{due: now.Add(4*time.Minute + 12*time.Second), interval: 4 * time.Minute, matches: 1, phase: 0.5},
+		},
+		"Failed evaluation keeps the interval": {
+			schedule: pollSchedule{interval: 4 * time.Minute, matches: 1},
+			result:   AlertResult{Err: errors.New("search failed")},
+			want:     pollSchedule{due: now.Add(4 * time.Minute), interval: 4 * time.Minute, matches: 1},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got := tc.schedule.next(tc.result, time.Minute, 10*time.Minute, now)
+
+			if !cmp.Equal(tc.want, got, cmp.AllowUnexported(pollSchedule{})) {
+				t.Errorf("want != got\ndiff=%s", cmp.Diff(tc.want, got, cmp.AllowUnexported(pollSchedule{})))
+			}
+		})
+	}
+}
+
+func TestPollWithInvalidIntervalsReturnsError(t *testing.T) {
+	t.Parallel()
+
+	a := Alerter{
+		Matcher:  fakePreviewFetcher{},
+		Notifier: &recordingTestNotifier{},
+		Logger:   log.New(io.Discard, "", 0),
+	}
+
+	if err := a.Poll(context.Background(), nil, time.Minute, time.Second); err == nil {
+		t.Error("expected an error but did not get one")
+	}
+}
+
+func TestPollProcessesAlertsUntilCancelled(t *testing.T) {
+	t.Parallel()
+
+	rep := &countingReporter{}
+	a := Alerter{
+		Matcher:   fakePreviewFetcher{},
+		Notifier:  &recordingTestNotifier{},
+		Logger:    log.New(io.Discard, "", 0),
+		Reporters: []Reporter{rep},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	err := a.Poll(ctx, []Alert{{GmailQuery: "is:unread"}}, 10*time.Millisecond, 20*time.Millisecond)
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+
+	if rep.runs < 3 {
+		t.Errorf("wanted the alert to be processed at least 3 times, got %d", rep.runs)
+	}
+}
+
+// countingReporter represents a test double type that implements the
+// Reporter interface and counts the runs it is reported.
+type countingReporter struct {
+	runs int
+}
+
+// Report increments the runs field of the receiver r and always returns a
+// nil error.
+func (r *countingReporter) Report(_ Summary) error {
+	r.runs++
+	return nil
+}
@@ -0,0 +1,101 @@
+package gmailalert
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// previewCLI accepts the command line flags of the "preview" subcommand,
+// which runs the Gmail query of the alert named by the "-alert" flag and
+// prints the date, sender, and subject of the first matching emails,
+// limited by the "-n" flag, without sending any notifications. An error is
+// returned if the flags are invalid, the alert configuration cannot be
+// loaded, or the query fails.
+func previewCLI(args []string) error {
+	var app cliEnv
+	var alertName string
+	var n int
+
+	fs := app.flagSet("preview")
+	fs.StringVar(
+		&alertName,
+		"alert",
+		"",
+		"the name (or gmail query) of the alert to preview matches for")
+	fs.IntVar(
+		&n,
+		"n",
+		10,
+		"the maximum number of matching emails to show")
+	if err := app.parse(fs, args); err != nil {
+		return err
+	}
+	if alertName == "" || n < 1 {
+		fs.Usage()
+		return errors.New(`command line flag "-alert" must be non-empty and "-n" must be positive`)
+	}
+
+	app, alertCfg, err := app.profileConfig()
+	if err != nil {
+		return err
+	}
+	selected, err := selectAlerts(alertCfg.Alerts, alertName)
+	if err != nil {
+		return err
+	}
+
+	gmailClient, err := app.gmailClient(app.debugLogger(), alertCfg)
+	if err != nil {
+		return err
+	}
+
+	return previewMatches(gmailClient, selected[0], n, os.Stdout)
+}
+
+// previewFetcher is the interface that groups the Match and Fetch methods
+// needed to preview the emails matching an alert.
+type previewFetcher interface {
+	Matcher
+	Fetcher
+}
+
+// previewMatches accepts a previewFetcher, an Alert, a maximum number of
+// emails, and an io.Writer, runs the Alert's Gmail query, and writes a table
+// of the date, sender, and subject of up to n matching emails to the
+// io.Writer. An error is returned if the query fails or if the details of a
+// matching email cannot be fetched, or if the Alert has no Gmail query, like
+// when it watches a label.
+func previewMatches(pf previewFetcher, alt Alert, n int, w io.Writer) error {
+	if alt.GmailQuery == "" {
+		return fmt.Errorf("alert %q has no gmail query to preview", alt.key())
+	}
+
+	matches, err := matchAlert(pf, alt)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Found %d emails matching query %q\n", len(matches), alt.GmailQuery)
+	if len(matches) == 0 {
+		return nil
+	}
+	if len(matches) > n {
+		matches = matches[:n]
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DATE\tFROM\tSUBJECT")
+	for _, m := range matches {
+		msg, err := pf.Fetch(m.ID)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", msg.Date.Format(time.RFC822), msg.From, msg.Subject)
+	}
+
+	return tw.Flush()
+}
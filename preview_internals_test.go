@@ -0,0 +1,92 @@
+package gmailalert
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPreviewMatches(t *testing.T) {
+	t.Parallel()
+
+	date := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	pf := fakePreviewFetcher{
+		matches: []Message{{ID: "a"}, {ID: "b"}, {ID: "c"}},
+		msgs: map[string]Message{
+			"a": {ID: "a", Date: date, From: "bank@example.com", Subject: "Your bill"},
+			"b": {ID: "b", Date: date, From: "shop@example.com", Subject: "Your order"},
+			"c": {ID: "c", Date: date, From: "news@example.com", Subject: "Weekly news"},
+		},
+	}
+
+	t.Run("first n matches are shown", func(t *testing.T) {
+		out := &bytes.Buffer{}
+
+		err := previewMatches(pf, Alert{GmailQuery: "is:unread"}, 2, out)
+		if err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		got := out.String()
+		for _, want := range []string{`Found 3 emails matching query "is:unread"`, "bank@example.com", "Your order", "01 Mar 23 12:00 UTC"} {
+			if !strings.Contains(got, want) {
+				t.Errorf("want output to contain %q, got:\n%s", want, got)
+			}
+		}
+		if strings.Contains(got, "Weekly news") {
+			t.Errorf("want output limited to 2 emails, got:\n%s", got)
+		}
+	})
+
+	t.Run("no matches shows no table", func(t *testing.T) {
+		out := &bytes.Buffer{}
+
+		err := previewMatches(fakePreviewFetcher{}, Alert{GmailQuery: "is:unread"}, 2, out)
+		if err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		if strings.Contains(out.String(), "SUBJECT") {
+			t.Errorf("want no table, got:\n%s", out.String())
+		}
+	})
+
+	t.Run("query error returns an error", func(t *testing.T) {
+		err := previewMatches(fakePreviewFetcher{err: errors.New("quota exceeded")}, Alert{}, 2, &bytes.Buffer{})
+
+		if err == nil {
+			t.Fatal("wanted an error but did not get one")
+		}
+	})
+}
+
+// fakePreviewFetcher represents a test double type that implements the
+// Matcher and Fetcher interfaces, returning the matches, msgs, and err
+// values it was created with.
+type fakePreviewFetcher struct {
+	matches []Message
+	msgs    map[string]Message
+	err     error
+}
+
+// Match returns the IDs of the matches and the err field of the receiver f.
+func (f fakePreviewFetcher) Match(_ string) ([]string, error) {
+	return messageIDs(f.matches), f.err
+}
+
+// MatchMessages returns the matches and err fields of the receiver f.
+func (f fakePreviewFetcher) MatchMessages(_ string) ([]Message, error) {
+	return f.matches, f.err
+}
+
+// Fetch returns the message stored under id in the msgs field of the
+// receiver f, or an error if no message is stored under id.
+func (f fakePreviewFetcher) Fetch(id string) (Message, error) {
+	m, ok := f.msgs[id]
+	if !ok {
+		return Message{}, errors.New("message not found")
+	}
+	return m, nil
+}
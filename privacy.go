@@ -0,0 +1,78 @@
+package gmailalert
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// The privacy modes of an external notifier: "full" sends the notification
+// content, and "hashed" only sends counts and a hash of the content, which
+// stays in the local logs.
+const (
+	PrivacyFull   = "full"
+	PrivacyHashed = "hashed"
+)
+
+// privacyOK returns an error if the given privacy mode of the notifier with
+// the given name is neither empty, PrivacyFull, nor PrivacyHashed.
+func privacyOK(notifier, mode string) error {
+	if mode != "" && mode != PrivacyFull && mode != PrivacyHashed {
+		return fmt.Errorf(`%s privacy must be %q or %q, got %q`, notifier, PrivacyFull, PrivacyHashed, mode)
+	}
+
+	return nil
+}
+
+// contentHash returns a short hash of the given content, which identifies
+// it in the local logs without revealing it.
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+
+	return hex.EncodeToString(sum[:6])
+}
+
+// HashingNotifier is a Notifier that sends notifications through another
+// Notifier with their message replaced by the number of matching emails and
+// a hash of the message, and without their attached image. The full message
+// is written to its Logger along with the hash, so that it can be looked up
+// locally.
+type HashingNotifier struct {
+	Notifier Notifier
+	Logger   Logger
+}
+
+// Notify sends the given Alert through the Notifier of the receiver h with
+// its content replaced by a hash.
+func (h HashingNotifier) Notify(alt Alert) error {
+	_, err := h.NotifyResult(alt)
+
+	return err
+}
+
+// NotifyResult sends the given Alert through the Notifier of the receiver h
+// with its content replaced by a hash, and returns the details of the sent
+// notification if the Notifier implements ResultNotifier.
+func (h HashingNotifier) NotifyResult(alt Alert) (NotifyResult, error) {
+	return h.NotifyContext(context.Background(), alt)
+}
+
+// NotifyContext behaves like NotifyResult, and stops sending the
+// notification when the given context is done if the Notifier implements
+// ContextNotifier.
+func (h HashingNotifier) NotifyContext(ctx context.Context, alt Alert) (NotifyResult, error) {
+	ref := contentHash(alt.PushoverMsg)
+	h.Logger.Printf("notification ref %s of alert %q: %s", ref, alt.key(), alt.PushoverMsg)
+	alt.PushoverMsg = fmt.Sprintf("Found %d emails (ref %s)", alt.Matches, ref)
+	alt.Attachment = nil
+
+	switch n := h.Notifier.(type) {
+	case ContextNotifier:
+		return n.NotifyContext(ctx, alt)
+	case ResultNotifier:
+		return n.NotifyResult(alt)
+	}
+
+	return NotifyResult{}, h.Notifier.Notify(alt)
+}
@@ -0,0 +1,94 @@
+package gmailalert
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHashingNotifierSendsOnlyCountAndHash(t *testing.T) {
+	t.Parallel()
+
+	notifier := &recordingTestNotifier{}
+	var logged strings.Builder
+	h := HashingNotifier{Notifier: notifier, Logger: bufLogger{&logged}}
+	alt := Alert{
+		GmailQuery:  "from:bank",
+		PushoverMsg: "Found 2 emails matching gmail query from:bank",
+		Matches:     2,
+		Attachment:  &Attachment{MediaType: "image/png", Data: []byte("image")},
+	}
+
+	if err := h.Notify(alt); err != nil {
+		t.Fatal(err)
+	}
+
+	ref := contentHash(alt.PushoverMsg)
+	want := []Alert{{GmailQuery: "from:bank", PushoverMsg: "Found 2 emails (ref " + ref + ")", Matches: 2}}
+	if !cmp.Equal(want, notifier.alerts) {
+		t.Error(cmp.Diff(want, notifier.alerts))
+	}
+	if !strings.Contains(logged.String(), ref) || !strings.Contains(logged.String(), alt.PushoverMsg) {
+		t.Errorf("want log to contain ref %s and the full message, got %q", ref, logged.String())
+	}
+}
+
+func TestNewWebhookRunHashed(t *testing.T) {
+	t.Parallel()
+
+	s := Summary{
+		RunID: "run1",
+		Results: []AlertResult{
+			{Alert: "bills", EvalID: "run1.0", Matches: 2, Notified: true},
+			{Alert: "orders", EvalID: "run1.1", Err: errors.New("quota exceeded for orders@example.com")},
+		},
+	}
+	want := []webhookAlert{
+		{Alert: contentHash("bills"), EvalID: "run1.0", Matches: 2, Notified: true},
+		{Alert: contentHash("orders"), EvalID: "run1.1", Error: "failed"},
+	}
+
+	got := newWebhookRun(s, true).Alerts
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestPrivacyOK(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		input       string
+		errExpected bool
+	}{
+		"Empty mode returns no error":   {input: "", errExpected: false},
+		"Full mode returns no error":    {input: PrivacyFull, errExpected: false},
+		"Hashed mode returns no error":  {input: PrivacyHashed, errExpected: false},
+		"Unknown mode returns an error": {input: "encrypted", errExpected: true},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := privacyOK("pushover", tc.input)
+			errReceived := err != nil
+
+			if tc.errExpected != errReceived {
+				t.Errorf("got unexpected error status %t", errReceived)
+			}
+		})
+	}
+}
+
+// bufLogger represents a test double type that implements the Logger
+// interface and writes every formatted line to its strings.Builder.
+type bufLogger struct {
+	b *strings.Builder
+}
+
+// Printf writes the formatted line to the strings.Builder of the receiver l.
+func (l bufLogger) Printf(format string, v ...interface{}) {
+	fmt.Fprintf(l.b, format+"\n", v...)
+}
@@ -0,0 +1,178 @@
+package gmailalert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Profile represents an independent group of alerts for one Gmail account,
+// notified with its own Pushover app, so that one deployment can serve the
+// mailboxes of a family or a small team.
+type Profile struct {
+	// The name identifying the profile.
+	Name string `json:"name"`
+	// The file containing the Google Developers Console credentials to
+	// authorize the profile's account with, or several comma-separated files
+	// like the "-credentials-file" flag. Defaults to the files given with the
+	// "-credentials-file" flag.
+	CredentialsFile string `json:"credentialsfile"`
+	// The file containing the Gmail OAuth2 token of the profile's account.
+	// Defaults to the file given with the "-token-file" flag with the
+	// profile's name appended, like "token-alice.json".
+	TokenFile string `json:"tokenfile"`
+	// The Pushover app token to send the profile's notifications with.
+	PushoverApp string `json:"pushoverapp"`
+	// The alerts of the profile.
+	Alerts []Alert `json:"alerts"`
+}
+
+// profileRun represents the environment and configuration of one profile to
+// process alerts for.
+type profileRun struct {
+	name     string
+	app      cliEnv
+	alertCfg AlertConfig
+}
+
+// profiles returns the profiles of the given AlertConfig to process alerts
+// for, which are the profile named with the "-profile" flag, or every
+// profile if the flag is empty. Each profile is returned with the cliEnv
+// receiver pointing at its credentials and token files and at state and
+// outbox files of its own, and with an AlertConfig holding its Pushover app
+// and alerts. If the AlertConfig has no profiles, the cliEnv receiver and
+// the AlertConfig are returned as the only profile. An error is returned if
+// the profiles are invalid, the named profile does not exist, or several
+// profiles would share the daemon's control API.
+func (c cliEnv) profiles(alertCfg AlertConfig) ([]profileRun, error) {
+	if len(alertCfg.Profiles) == 0 {
+		if c.profile != "" {
+			return nil, fmt.Errorf("profile %q does not exist, the alert configuration has no profiles", c.profile)
+		}
+		return []profileRun{{app: c, alertCfg: alertCfg}}, nil
+	}
+	if len(alertCfg.Alerts) > 0 || alertCfg.PushoverApp != "" {
+		return nil, errors.New("alerts and pushover app must be configured either at the top level or in profiles, not both")
+	}
+
+	var runs []profileRun
+	seen := map[string]bool{}
+	for _, p := range alertCfg.Profiles {
+		if p.Name == "" || strings.ContainsAny(p.Name, `/\`) || seen[p.Name] {
+			return nil, fmt.Errorf("profile names must be unique, non-empty, and not contain slashes, got %q", p.Name)
+		}
+		seen[p.Name] = true
+		if c.profile != "" && c.profile != p.Name {
+			continue
+		}
+
+		app := c
+		app.profile = p.Name
+		app.credsFile = firstNonEmpty(c.resolveFiles(p.CredentialsFile), c.credsFile)
+		app.tokenFile = firstNonEmpty(c.resolve(p.TokenFile), profileFile(c.tokenFile, p.Name))
+		app.modifyTokenFile = profileFile(c.modifyTokenFile, p.Name)
+		app.stateFile = profileFile(c.stateFile, p.Name)
+		app.historyFile = profileFile(c.historyFile, p.Name)
+		app.outboxFile = profileFile(c.outboxFile, p.Name)
+		cfg := alertCfg
+		cfg.Profiles = nil
+		cfg.PushoverApp = p.PushoverApp
+		cfg.Alerts = p.Alerts
+		runs = append(runs, profileRun{name: p.Name, app: app, alertCfg: cfg})
+	}
+
+	if len(runs) == 0 {
+		return nil, fmt.Errorf("profile %q does not exist", c.profile)
+	}
+	if len(runs) > 1 && c.daemon && c.control != nil {
+		return nil, errors.New(`command line flags "-control-addr" and "-http-addr" can only be used with a single profile, select one with "-profile"`)
+	}
+
+	return runs, nil
+}
+
+// profileConfig loads the alert configuration file named in the cliEnv
+// receiver and returns the single profile of it to run a subcommand for, as
+// returned by profiles. An error is returned if the file cannot be loaded,
+// the profiles are invalid, or no single profile is selected.
+func (c cliEnv) profileConfig() (cliEnv, AlertConfig, error) {
+	alertCfg, err := c.alertConfig()
+	if err != nil {
+		return cliEnv{}, AlertConfig{}, err
+	}
+
+	runs, err := c.profiles(alertCfg)
+	if err != nil {
+		return cliEnv{}, AlertConfig{}, err
+	}
+	if len(runs) > 1 {
+		return cliEnv{}, AlertConfig{}, fmt.Errorf(`the alert configuration has %d profiles, command line flag "-profile" must name one of them`, len(runs))
+	}
+
+	return runs[0].app, runs[0].alertCfg, nil
+}
+
+// runProfiles processes the alerts of the given profiles with the given
+// Reporters. Outside of daemon mode, the profiles are processed one after
+// another. In daemon mode, they are processed concurrently until any of them
+// stops, like when the process is interrupted or the configuration needs to
+// be reloaded, at which point all of them are stopped. An error naming the
+// profile is returned for every profile that fails.
+func runProfiles(runs []profileRun, reporters []Reporter) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if len(runs) == 1 {
+		return runs[0].app.run(ctx, runs[0].alertCfg, reporters)
+	}
+
+	errs := make([]error, len(runs))
+	if !runs[0].app.daemon {
+		for i, r := range runs {
+			if err := r.app.run(ctx, r.alertCfg, reporters); err != nil {
+				errs[i] = fmt.Errorf("profile %q: %w", r.name, err)
+			}
+		}
+		return errors.Join(errs...)
+	}
+
+	var wg sync.WaitGroup
+	for i, r := range runs {
+		wg.Add(1)
+		go func(i int, r profileRun) {
+			defer wg.Done()
+			defer cancel()
+			if err := r.app.run(ctx, r.alertCfg, reporters); err != nil {
+				errs[i] = fmt.Errorf("profile %q: %w", r.name, err)
+			}
+		}(i, r)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// resolve returns the given file name resolved against the config directory
+// of the cliEnv receiver if it is relative.
+func (c cliEnv) resolve(file string) string {
+	if file == "" || c.configDir == "" || filepath.IsAbs(file) {
+		return file
+	}
+
+	return filepath.Join(c.configDir, file)
+}
+
+// profileFile returns the given file name with the given profile name
+// appended to its base name, like "state-alice.json" for "state.json", or
+// an empty string if the file name is empty.
+func profileFile(file, profile string) string {
+	if file == "" {
+		return ""
+	}
+
+	ext := filepath.Ext(file)
+	return strings.TrimSuffix(file, ext) + "-" + profile + ext
+}
@@ -0,0 +1,168 @@
+package gmailalert
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCLIEnvProfiles(t *testing.T) {
+	t.Parallel()
+
+	app := cliEnv{
+		credsFile:  "/etc/gmailalert/credentials.json",
+		tokenFile:  "/etc/gmailalert/token.json",
+		stateFile:  "/var/lib/gmailalert/state.json",
+		configDir:  "/etc/gmailalert",
+		outboxFile: "",
+	}
+	alertCfg := AlertConfig{
+		TraceNotifications: true,
+		Profiles: []Profile{
+			{Name: "alice", PushoverApp: "alice-app", Alerts: []Alert{{Name: "a"}}},
+			{Name: "bob", CredentialsFile: "bob-credentials.json", TokenFile: "/secrets/bob.json", PushoverApp: "bob-app", Alerts: []Alert{{Name: "b"}}},
+		},
+	}
+
+	testCases := map[string]struct {
+		profile string
+		want    []profileRun
+	}{
+		"Empty profile selects every profile": {
+			want: []profileRun{
+				{
+					name: "alice",
+					app: cliEnv{
+						profile:   "alice",
+						credsFile: "/etc/gmailalert/credentials.json",
+						tokenFile: "/etc/gmailalert/token-alice.json",
+						stateFile: "/var/lib/gmailalert/state-alice.json",
+						configDir: "/etc/gmailalert",
+					},
+					alertCfg: AlertConfig{TraceNotifications: true, PushoverApp: "alice-app", Alerts: []Alert{{Name: "a"}}},
+				},
+				{
+					name: "bob",
+					app: cliEnv{
+						profile:   "bob",
+						credsFile: "/etc/gmailalert/bob-credentials.json",
+						tokenFile: "/secrets/bob.json",
+						stateFile: "/var/lib/gmailalert/state-bob.json",
+						configDir: "/etc/gmailalert",
+					},
+					alertCfg: AlertConfig{TraceNotifications: true, PushoverApp: "bob-app", Alerts: []Alert{{Name: "b"}}},
+				},
+			},
+		},
+		"Named profile selects only that profile": {
+			profile: "bob",
+			want: []profileRun{
+				{
+					name: "bob",
+					app: cliEnv{
+						profile:   "bob",
+						credsFile: "/etc/gmailalert/bob-credentials.json",
+						tokenFile: "/secrets/bob.json",
+						stateFile: "/var/lib/gmailalert/state-bob.json",
+						configDir: "/etc/gmailalert",
+					},
+					alertCfg: AlertConfig{TraceNotifications: true, PushoverApp: "bob-app", Alerts: []Alert{{Name: "b"}}},
+				},
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			app := app
+			app.profile = tc.profile
+			got, err := app.profiles(alertCfg)
+			if err != nil {
+				t.Fatalf("got unexpected error: %v", err)
+			}
+
+			opts := cmp.AllowUnexported(profileRun{}, cliEnv{})
+			if !cmp.Equal(tc.want, got, opts) {
+				t.Errorf("want != got\ndiff=%s", cmp.Diff(tc.want, got, opts))
+			}
+		})
+	}
+}
+
+func TestCLIEnvProfilesWithoutProfilesReturnsConfig(t *testing.T) {
+	t.Parallel()
+
+	app := cliEnv{tokenFile: "token.json"}
+	alertCfg := AlertConfig{PushoverApp: "app", Alerts: []Alert{{Name: "a"}}}
+
+	got, err := app.profiles(alertCfg)
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+
+	want := []profileRun{{app: app, alertCfg: alertCfg}}
+	opts := cmp.AllowUnexported(profileRun{}, cliEnv{})
+	if !cmp.Equal(want, got, opts) {
+		t.Errorf("want != got\ndiff=%s", cmp.Diff(want, got, opts))
+	}
+}
+
+func TestCLIEnvProfilesWithInvalidProfilesReturnsError(t *testing.T) {
+	t.Parallel()
+
+	profiles := []Profile{{Name: "alice"}, {Name: "bob"}}
+	testCases := map[string]struct {
+		app      cliEnv
+		alertCfg AlertConfig
+	}{
+		"Unknown profile": {
+			app:      cliEnv{profile: "carol"},
+			alertCfg: AlertConfig{Profiles: profiles},
+		},
+		"Profile without profiles": {
+			app: cliEnv{profile: "alice"},
+		},
+		"Top-level alerts with profiles": {
+			alertCfg: AlertConfig{Alerts: []Alert{{Name: "a"}}, Profiles: profiles},
+		},
+		"Duplicate profile names": {
+			alertCfg: AlertConfig{Profiles: []Profile{{Name: "alice"}, {Name: "alice"}}},
+		},
+		"Profile name with a slash": {
+			alertCfg: AlertConfig{Profiles: []Profile{{Name: "../alice"}}},
+		},
+		"Control api with several profiles in daemon mode": {
+			app:      cliEnv{daemon: true, control: NewControl()},
+			alertCfg: AlertConfig{Profiles: profiles},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := tc.app.profiles(tc.alertCfg); err == nil {
+				t.Error("expected an error but did not get one")
+			}
+		})
+	}
+}
+
+func TestProfileFile(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		file string
+		want string
+	}{
+		"Name is appended before the extension":        {file: "/data/state.json", want: "/data/state-alice.json"},
+		"Name is appended to a file without extension": {file: "outbox", want: "outbox-alice"},
+		"Empty file stays empty":                       {file: "", want: ""},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if got := profileFile(tc.file, "alice"); tc.want != got {
+				t.Errorf("want %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package gmailalert
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// ProxyConfig represents the HTTP or SOCKS5 proxies, or SSH tunnels, that
+// the requests to the Gmail and Pushover APIs are sent through, like in
+// networks that only allow egress through a proxy or an SSH bastion. Without
+// a ProxyConfig, or for a client whose proxy is not configured, the proxy
+// named by the HTTPS_PROXY, HTTP_PROXY, and NO_PROXY environment variables is
+// used, if any.
+type ProxyConfig struct {
+	// The URL of the proxy used by every client without a proxy of its own,
+	// like "http://proxy.example.com:3128", "socks5://localhost:1080", or
+	// "ssh://user@bastion.example.com" for an SSH tunnel.
+	URL string `json:"url"`
+	// The URL of the proxy used for the Gmail and Google OAuth2 APIs.
+	Gmail string `json:"gmail"`
+	// The URL of the proxy used for the Pushover API.
+	Pushover string `json:"pushover"`
+}
+
+// gmail returns the URL of the proxy for the Gmail client configured in the
+// ProxyConfig receiver p, which may be nil, or an empty string if there is
+// none.
+func (p *ProxyConfig) gmail() string {
+	if p == nil {
+		return ""
+	}
+
+	return firstNonEmpty(p.Gmail, p.URL)
+}
+
+// pushover returns the URL of the proxy for the Pushover client configured in
+// the ProxyConfig receiver p, which may be nil, or an empty string if there
+// is none.
+func (p *ProxyConfig) pushover() string {
+	if p == nil {
+		return ""
+	}
+
+	return firstNonEmpty(p.Pushover, p.URL)
+}
+
+// parseProxyURL parses the given proxy URL, returning nil if it is empty. An
+// error is returned if the URL is invalid, has no host, or has a scheme
+// other than those supported by net/http and "ssh", for an sshTunnel.
+func parseProxyURL(rawURL string) (*url.URL, error) {
+	if rawURL == "" {
+		return nil, nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("got error parsing proxy url: %v", err)
+	}
+	switch {
+	case u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5" && u.Scheme != "ssh":
+		return nil, fmt.Errorf(`proxy url scheme must be "http", "https", "socks5", or "ssh", got %q`, u.Scheme)
+	case u.Host == "":
+		return nil, fmt.Errorf("proxy url must have a host, got %q", u.Redacted())
+	case u.Scheme == "ssh":
+		if err := checkSSHProxyURL(u); err != nil {
+			return nil, err
+		}
+	}
+
+	return u, nil
+}
+
+// firstNonEmpty returns the first of the given strings that is not empty,
+// or an empty string if they all are.
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
@@ -1,16 +1,28 @@
 package gmailalert
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gregdel/pushover"
 )
 
 // PushoverClientOpt represents a functional option that can be wired to a
 // PushoverClient.
+//
+// Deprecated: Use the stable v1.PushoverClientOpt in package api/v1.
 type PushoverClientOpt func(p *PushoverClient)
 
 // WithPushoverClientLogger accepts a Logger and returns a function that
@@ -21,28 +33,77 @@ func WithPushoverClientLogger(l Logger) PushoverClientOpt {
 	}
 }
 
+// WithPushoverClientMaxLength accepts a maximum number of characters and
+// returns a function that wires it to a PushoverClient as the length longer
+// notification messages are truncated to.
+func WithPushoverClientMaxLength(n int) PushoverClientOpt {
+	return func(p *PushoverClient) {
+		p.maxLength = n
+	}
+}
+
+// WithPushoverClientFormatter accepts a Formatter and returns a function
+// that wires it to a PushoverClient to render the title and message of
+// notifications with.
+func WithPushoverClientFormatter(f Formatter) PushoverClientOpt {
+	return func(p *PushoverClient) {
+		p.formatter = f
+	}
+}
+
+// WithPushoverClientHTTPClient accepts an *http.Client and returns a function
+// that wires it to a PushoverClient to send its requests to the Pushover API
+// with.
+func WithPushoverClientHTTPClient(c *http.Client) PushoverClientOpt {
+	return func(p *PushoverClient) {
+		p.httpClient = c
+	}
+}
+
+// pushoverKeyRegexp matches well-formed Pushover app tokens and recipient
+// keys.
+var pushoverKeyRegexp = regexp.MustCompile(`^[A-Za-z0-9]{30}$`)
+
 // PushoverClient represents a type providing behavior for
 // sending Pushover notifications.
+//
+// Deprecated: Use the stable v1.PushoverClient in package api/v1.
 type PushoverClient struct {
-	app    *pushover.Pushover
-	logger Logger
+	token      string
+	httpClient *http.Client
+	logger     Logger
+	maxLength  int
+	formatter  Formatter
 }
 
 // NewPushoverClient accepts a Pushover app token and returns a new
-// PushoverClient. An error is returned if the Pushover app token is invalid.
+// PushoverClient, which renders notifications with a PushoverFormatter
+// unless another Formatter is given with WithPushoverClientFormatter and
+// truncates their messages to Pushover's maximum length unless a shorter
+// one is given with WithPushoverClientMaxLength. Requests are sent with
+// http.DefaultClient unless another client is given with
+// WithPushoverClientHTTPClient. An error is returned if the Pushover app
+// token is invalid or the maximum length is not between 1 and Pushover's.
 func NewPushoverClient(token string, opts ...PushoverClientOpt) (PushoverClient, error) {
 	if token == "" {
 		return PushoverClient{}, errors.New("token argument must be non-empty")
 	}
 
 	client := PushoverClient{
-		app:    pushover.New(token),
-		logger: log.New(io.Discard, "", log.LstdFlags),
+		token:      token,
+		httpClient: http.DefaultClient,
+		logger:     log.New(io.Discard, "", log.LstdFlags),
+		maxLength:  pushover.MessageMaxLength,
+		formatter:  PushoverFormatter{},
 	}
 
 	for _, opt := range opts {
 		opt(&client)
 	}
+	if client.maxLength < 1 || client.maxLength > pushover.MessageMaxLength {
+		return PushoverClient{}, fmt.Errorf("maximum message length must be between 1 and %d, got %d",
+			pushover.MessageMaxLength, client.maxLength)
+	}
 
 	return client, nil
 }
@@ -51,52 +112,349 @@ func NewPushoverClient(token string, opts ...PushoverClientOpt) (PushoverClient,
 // from the data in the Alert and emits the Pushover notification.
 // An error is returned if the message send fails.
 func (p PushoverClient) Notify(alt Alert) error {
-	req, err := prepareNotifyReq(alt)
+	_, err := p.NotifyResult(alt)
+	return err
+}
+
+// NotifyResult behaves like Notify and additionally returns a NotifyResult
+// containing the request IDs Pushover assigned to the notification. The
+// notification is sent to each of the Alert's recipients separately, with
+// the Alert's Attachment if it has one. If any recipients cannot be
+// notified, an error wrapping a RecipientError for each of them is returned.
+func (p PushoverClient) NotifyResult(alt Alert) (NotifyResult, error) {
+	return p.NotifyContext(context.Background(), alt)
+}
+
+// NotifyContext behaves like NotifyResult, and cancels the requests to
+// Pushover when the given context is done.
+func (p PushoverClient) NotifyContext(ctx context.Context, alt Alert) (NotifyResult, error) {
+	req, err := prepareNotifyReq(alt, p.formatter, p.maxLength)
+	if err != nil {
+		return NotifyResult{}, fmt.Errorf("got error preparing request to send pushover notification: %v", err)
+	}
+
+	var ids []string
+	var errs []error
+	var quota *NotifyQuota
+	var receipts []string
+	var attachment []byte
+	if alt.Attachment != nil {
+		attachment = alt.Attachment.Data
+	}
+	for _, recipient := range req.recipients {
+		p.logger.Printf("[eval %s] sending pushover message %+q to recipient %s", alt.EvalID, req.msg, Secret(recipient))
+		resp, err := p.sendMessage(ctx, req.msg, recipient, attachment)
+		res, err := p.handle(resp, err)
+		if err != nil {
+			errs = append(errs, RecipientError{Recipient: recipient, Err: err})
+			continue
+		}
+		ids = append(ids, res.RequestID)
+		if res.Quota != nil {
+			quota = res.Quota
+		}
+		receipts = append(receipts, res.Receipts...)
+	}
+
+	res := NotifyResult{RequestID: strings.Join(ids, ","), Quota: quota, Receipts: receipts}
+	if len(errs) > 0 {
+		return res, fmt.Errorf("pushover notification failed for %d of %d recipients: %w",
+			len(errs), len(req.recipients), errors.Join(errs...))
+	}
+
+	return res, nil
+}
+
+// RecipientError represents a failure to send a Pushover notification to a
+// single recipient.
+type RecipientError struct {
+	// The recipient key that could not be notified.
+	Recipient string
+	// The error returned when notifying the recipient.
+	Err error
+}
+
+// Error returns a description of the RecipientError with the recipient key
+// masked.
+func (r RecipientError) Error() string {
+	return fmt.Sprintf("recipient %s: %v", Secret(r.Recipient), r.Err)
+}
+
+// Unwrap returns the error returned when notifying the recipient.
+func (r RecipientError) Unwrap() error {
+	return r.Err
+}
+
+// failedRecipients returns the recipients of the RecipientErrors wrapped by
+// the given error, for which a notification failed while its other
+// recipients were notified. Nil is returned if the error wraps none, or if
+// it wraps a ChannelError, since failover channels other than Pushover do
+// not notify the alert's recipients.
+func failedRecipients(err error) []string {
+	var ce ChannelError
+	if errors.As(err, &ce) {
+		return nil
+	}
+
+	var failed []string
+	var walk func(err error)
+	walk = func(err error) {
+		switch e := err.(type) {
+		case RecipientError:
+			failed = append(failed, e.Recipient)
+		case interface{ Unwrap() []error }:
+			for _, err := range e.Unwrap() {
+				walk(err)
+			}
+		case interface{ Unwrap() error }:
+			walk(e.Unwrap())
+		}
+	}
+	walk(err)
+
+	return failed
+}
+
+// PushoverError represents a notification rejected by the Pushover API, such
+// as for an invalid recipient or an exhausted monthly message limit.
+type PushoverError struct {
+	// The reasons Pushover gave for rejecting the notification.
+	Errors []string
+}
+
+// Error returns the reasons Pushover gave for rejecting the notification.
+func (p PushoverError) Error() string {
+	return "pushover rejected notification: " + strings.Join(p.Errors, "; ")
+}
+
+// ValidateRecipient checks with the Pushover API that the app token of the
+// PushoverClient is valid and that the given recipient key identifies a
+// Pushover user or group. An error describing the problem is returned
+// otherwise.
+func (p PushoverClient) ValidateRecipient(key string) error {
+	if err := p.validateKeys(key); err != nil {
+		return fmt.Errorf("got error validating pushover recipient: %v", err)
+	}
+	params := url.Values{"token": {p.token}, "user": {key}}
+	req, err := http.NewRequest(http.MethodPost, pushover.APIEndpoint+"/users/validate.json", strings.NewReader(params.Encode()))
+	if err != nil {
+		return fmt.Errorf("got error validating pushover recipient: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var details pushover.RecipientDetails
+	if _, err := p.do(req, &details); err != nil {
+		return fmt.Errorf("got error validating pushover recipient: %v", err)
+	}
+	if details.Status != 1 {
+		return fmt.Errorf("pushover rejected recipient: %v", details.Errors)
+	}
+
+	return nil
+}
+
+// sendMessage sends the given Pushover message, with the given attachment if
+// it is not nil, to the given recipient key using the HTTP client of the
+// PushoverClient receiver p, and returns Pushover's response with the app's
+// message quota. The request is canceled when the given context is done. An
+// error is returned if the request fails, wrapping pushover.Errors if
+// Pushover rejected the message.
+func (p PushoverClient) sendMessage(ctx context.Context, msg pushover.Message, recipient string, attachment []byte) (*pushover.Response, error) {
+	if err := p.validateKeys(recipient); err != nil {
+		return nil, err
+	}
+	if msg.Message == "" {
+		return nil, pushover.ErrMessageEmpty
+	}
+
+	params := url.Values{
+		"token":    {p.token},
+		"user":     {recipient},
+		"message":  {msg.Message},
+		"priority": {strconv.Itoa(msg.Priority)},
+	}
+	if msg.Title != "" {
+		params.Set("title", msg.Title)
+	}
+	if msg.Sound != "" {
+		params.Set("sound", msg.Sound)
+	}
+	if msg.Priority == pushover.PriorityEmergency {
+		params.Set("retry", strconv.Itoa(int(msg.Retry.Seconds())))
+		params.Set("expire", strconv.Itoa(int(msg.Expire.Seconds())))
+	}
+
+	body, contentType, err := pushoverBody(params, attachment)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, pushover.APIEndpoint+"/messages.json", body)
 	if err != nil {
-		return fmt.Errorf("got error preparing request to send pushover notification: %v", err)
+		return nil, err
 	}
+	req.Header.Set("Content-Type", contentType)
 
-	tgt := pushover.NewRecipient(req.recipient)
-	p.logger.Printf("sending pushover message %+q to recipient %s", req.msg, req.recipient)
-	resp, err := p.app.SendMessage(&req.msg, tgt)
-	return p.handle(resp, err)
+	var resp pushover.Response
+	header, err := p.do(req, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Status != 1 {
+		return nil, resp.Errors
+	}
+	resp.Limit = pushoverLimit(header)
+
+	return &resp, nil
+}
+
+// validateKeys returns an error if the app token of the PushoverClient
+// receiver p or the given recipient key is malformed.
+func (p PushoverClient) validateKeys(recipient string) error {
+	if !pushoverKeyRegexp.MatchString(p.token) {
+		return pushover.ErrInvalidToken
+	}
+	if !pushoverKeyRegexp.MatchString(recipient) {
+		return pushover.ErrInvalidRecipientToken
+	}
+
+	return nil
+}
+
+// do sends the given request to the Pushover API with the HTTP client of the
+// PushoverClient receiver p, decodes the JSON response into the value
+// pointed to by v and returns the response headers. An error is returned if
+// the request fails, Pushover returns a server error, or the response cannot
+// be decoded.
+func (p PushoverClient) do(req *http.Request, v interface{}) (http.Header, error) {
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return nil, fmt.Errorf("%w: %s", pushover.ErrHTTPPushover, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return nil, fmt.Errorf("got error decoding pushover response: %v", err)
+	}
+
+	return resp.Header, nil
+}
+
+// pushoverBody returns the request body and its content type for sending the
+// given parameters to Pushover, as a multipart form including the given
+// attachment if it is not nil, or as a URL-encoded form otherwise.
+func pushoverBody(params url.Values, attachment []byte) (io.Reader, string, error) {
+	if attachment == nil {
+		return strings.NewReader(params.Encode()), "application/x-www-form-urlencoded", nil
+	}
+	if len(attachment) > pushover.MessageMaxAttachmentByte {
+		return nil, "", pushover.ErrMessageAttachmentTooLarge
+	}
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	fw, err := w.CreateFormFile("attachment", "attachment")
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := fw.Write(attachment); err != nil {
+		return nil, "", err
+	}
+	for k := range params {
+		if err := w.WriteField(k, params.Get(k)); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+
+	return &body, w.FormDataContentType(), nil
+}
+
+// pushoverLimit returns the app's message quota from the given headers of a
+// Pushover response, or nil if the headers do not contain it.
+func pushoverLimit(header http.Header) *pushover.Limit {
+	var values [3]int
+	for i, name := range []string{"X-Limit-App-Limit", "X-Limit-App-Remaining", "X-Limit-App-Reset"} {
+		v, err := strconv.Atoi(header.Get(name))
+		if err != nil {
+			return nil
+		}
+		values[i] = v
+	}
+
+	return &pushover.Limit{Total: values[0], Remaining: values[1], NextReset: time.Unix(int64(values[2]), 0)}
 }
 
 // handle accepts a Pushover response and error returned after making a call to
-// Pushover. If the error is not nil, it is returned. If the error is nil, then
-// the Pushover response is logged.
-func (p PushoverClient) handle(resp *pushover.Response, err error) error {
+// Pushover. If the error is not nil, it is returned, wrapping a PushoverError
+// if Pushover rejected the notification. If the error is nil, then the
+// Pushover response is logged and its details, including the app's message
+// quota, are returned.
+func (p PushoverClient) handle(resp *pushover.Response, err error) (NotifyResult, error) {
 	if err != nil {
-		return fmt.Errorf("got error sending pushover notification: %v", err)
+		var rejected pushover.Errors
+		if errors.As(err, &rejected) {
+			err = PushoverError{Errors: rejected}
+		}
+		return NotifyResult{}, fmt.Errorf("got error sending pushover notification: %w", err)
 	}
 
 	p.logger.Printf("pushover message sent, got response: %s", resp.String())
 
-	return nil
+	res := NotifyResult{RequestID: resp.ID}
+	if resp.Receipt != "" {
+		res.Receipts = []string{resp.Receipt}
+	}
+	if resp.Limit != nil {
+		res.Quota = &NotifyQuota{Limit: resp.Limit.Total, Remaining: resp.Limit.Remaining, Reset: resp.Limit.NextReset}
+	}
+
+	return res, nil
 }
 
 // notifyReq provides data that is expected to create a Pushover notification
-// to a specific recipient and the message that the notification should contain.
+// to specific recipients and the message that the notification should contain.
 type notifyReq struct {
-	recipient string
-	msg       pushover.Message
+	recipients []string
+	msg        pushover.Message
 }
 
-// prepareNotifyReq accepts an Alert, uses it to create a notifyReq struct
-// containing the details needed for sending a Pushover notification, and
-// returns it. An error is returned if the given Alert argument is invalid.
-func prepareNotifyReq(alt Alert) (notifyReq, error) {
+// prepareNotifyReq accepts an Alert, a Formatter, and a maximum message
+// length, uses them to create a notifyReq struct containing the details
+// needed for sending a Pushover notification, with the title and message
+// rendered by the Formatter, the message truncated by truncateMessage, and
+// the title cut to Pushover's maximum length, and returns it. An error is
+// returned if the given Alert argument is invalid or cannot be formatted.
+func prepareNotifyReq(alt Alert, f Formatter, maxLength int) (notifyReq, error) {
 	if err := alt.OK(); err != nil {
 		return notifyReq{}, err
 	}
+	formatted, err := f.Format(newNotification(alt))
+	if err != nil {
+		return notifyReq{}, err
+	}
 
 	n := notifyReq{
-		recipient: alt.PushoverTarget,
+		recipients: alt.Recipients(),
 		msg: pushover.Message{
-			Message: alt.PushoverMsg,
-			Title:   alt.PushoverTitle,
+			Message: truncateMessage(formatted.Message, maxLength),
+			Title:   truncateText(formatted.Title, pushover.MessageTitleMaxLength),
 			Sound:   alt.PushoverSound,
 		},
 	}
+	if alt.OTP != nil {
+		n.msg.Priority = pushover.PriorityHigh
+	}
+	if alt.PushoverEmergency != nil {
+		retry, expire, _, err := alt.PushoverEmergency.durations()
+		if err != nil {
+			return notifyReq{}, err
+		}
+		n.msg.Priority, n.msg.Retry, n.msg.Expire = pushover.PriorityEmergency, retry, expire
+	}
 	return n, nil
 }
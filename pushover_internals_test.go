@@ -2,7 +2,15 @@ package gmailalert
 
 import (
 	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/gregdel/pushover"
@@ -28,6 +36,14 @@ func TestNewPushoverClient(t *testing.T) {
 			t.Fatalf("got an unexpected error: %v", err)
 		}
 	})
+
+	t.Run("maximum length above Pushover's returns an error", func(t *testing.T) {
+		_, err := NewPushoverClient("da123321safdad", WithPushoverClientMaxLength(pushover.MessageMaxLength+1))
+
+		if err == nil {
+			t.Fatalf("wanted an error but did not get one")
+		}
+	})
 }
 
 func TestPrepareNotifyReq(t *testing.T) {
@@ -42,6 +58,30 @@ func TestPrepareNotifyReq(t *testing.T) {
 			want:        notifyReq{},
 			errExpected: true,
 		},
+		"Giving an Alert with an attachment limit above Pushover's returns an error": {
+			input: Alert{
+				GmailQuery:          "test",
+				PushoverTarget:      "test",
+				PushoverTitle:       "test",
+				PushoverSound:       "test",
+				PushoverMsg:         "test",
+				AttachImageMaxBytes: pushover.MessageMaxAttachmentByte + 1,
+			},
+			want:        notifyReq{},
+			errExpected: true,
+		},
+		"Giving an Alert with a negative message size limit returns an error": {
+			input: Alert{
+				GmailQuery:      "test",
+				PushoverTarget:  "test",
+				PushoverTitle:   "test",
+				PushoverSound:   "test",
+				PushoverMsg:     "test",
+				MaxMessageBytes: -1,
+			},
+			want:        notifyReq{},
+			errExpected: true,
+		},
 		"Valid notification request": {
 			input: Alert{
 				GmailQuery:     "test",
@@ -51,7 +91,7 @@ func TestPrepareNotifyReq(t *testing.T) {
 				PushoverMsg:    "test",
 			},
 			want: notifyReq{
-				recipient: "test",
+				recipients: []string{"test"},
 				msg: pushover.Message{
 					Message: "test",
 					Title:   "test",
@@ -60,11 +100,49 @@ func TestPrepareNotifyReq(t *testing.T) {
 			},
 			errExpected: false,
 		},
+		"Long message and title are truncated": {
+			input: Alert{
+				GmailQuery:     "test",
+				PushoverTarget: "test",
+				PushoverTitle:  strings.Repeat("t", pushover.MessageTitleMaxLength+1),
+				PushoverSound:  "test",
+				PushoverMsg:    "Found 2 emails\n" + strings.Repeat("m", pushover.MessageMaxLength),
+			},
+			want: notifyReq{
+				recipients: []string{"test"},
+				msg: pushover.Message{
+					Message: "Found 2 emails\n…and 1 more",
+					Title:   strings.Repeat("t", pushover.MessageTitleMaxLength-1) + "…",
+					Sound:   "test",
+				},
+			},
+			errExpected: false,
+		},
+		"Verification code is sent with high priority": {
+			input: Alert{
+				GmailQuery:     "test",
+				PushoverTarget: "test",
+				PushoverTitle:  "test",
+				PushoverSound:  "test",
+				PushoverMsg:    "123456",
+				OTP:            &OTPConfig{},
+			},
+			want: notifyReq{
+				recipients: []string{"test"},
+				msg: pushover.Message{
+					Message:  "123456",
+					Title:    "test",
+					Sound:    "test",
+					Priority: pushover.PriorityHigh,
+				},
+			},
+			errExpected: false,
+		},
 	}
 
 	for name, tc := range testCases {
 		t.Run(name, func(t *testing.T) {
-			got, err := prepareNotifyReq(tc.input)
+			got, err := prepareNotifyReq(tc.input, PushoverFormatter{}, pushover.MessageMaxLength)
 			errReceived := err != nil
 
 			if tc.errExpected != errReceived {
@@ -84,10 +162,301 @@ func TestHandle(t *testing.T) {
 	t.Parallel()
 	t.Run("Error returned from pushover call returns an error", func(t *testing.T) {
 		client := PushoverClient{}
-		err := client.handle(nil, errors.New("error from pushover call"))
+		_, err := client.handle(nil, errors.New("error from pushover call"))
 
 		if err == nil {
 			t.Fatalf("expected an error but did not get one")
 		}
 	})
+
+	t.Run("Successful pushover call returns the request ID", func(t *testing.T) {
+		client := PushoverClient{logger: log.New(io.Discard, "", 0)}
+		got, err := client.handle(&pushover.Response{Status: 1, ID: "req-123"}, nil)
+
+		if err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+		if got.RequestID != "req-123" {
+			t.Fatalf("want request ID %q, got %q", "req-123", got.RequestID)
+		}
+	})
+
+	t.Run("Rejected pushover call returns a PushoverError", func(t *testing.T) {
+		client := PushoverClient{}
+		_, err := client.handle(nil, pushover.Errors{"application is over its quota"})
+
+		var pushoverErr PushoverError
+		if !errors.As(err, &pushoverErr) {
+			t.Fatalf("want a PushoverError, got: %v", err)
+		}
+		want := []string{"application is over its quota"}
+		if !cmp.Equal(want, pushoverErr.Errors) {
+			t.Error(cmp.Diff(want, pushoverErr.Errors))
+		}
+	})
+
+	t.Run("Successful pushover call returns the app's quota", func(t *testing.T) {
+		client := PushoverClient{logger: log.New(io.Discard, "", 0)}
+		reset := time.Unix(1393653600, 0)
+		got, err := client.handle(&pushover.Response{
+			Status: 1,
+			ID:     "req-123",
+			Limit:  &pushover.Limit{Total: 10000, Remaining: 9999, NextReset: reset},
+		}, nil)
+
+		if err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+		want := &NotifyQuota{Limit: 10000, Remaining: 9999, Reset: reset}
+		if !cmp.Equal(want, got.Quota) {
+			t.Error(cmp.Diff(want, got.Quota))
+		}
+	})
+}
+
+func TestValidateRecipient(t *testing.T) {
+	const validUser = "uQiRzpo4DXghDmr9QzzfQu27cmVRsG"
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("user") != validUser {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"status":0,"user":"invalid","errors":["user key is invalid"],"request":"r1"}`))
+			return
+		}
+		w.Write([]byte(`{"status":1,"group":0,"devices":["phone"],"request":"r2"}`))
+	}))
+	defer svr.Close()
+
+	origEndpoint := pushover.APIEndpoint
+	pushover.APIEndpoint = svr.URL
+	defer func() { pushover.APIEndpoint = origEndpoint }()
+
+	client, err := NewPushoverClient("azGDORePK8gMaC0QOYAMyEEuzJnyUi")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := map[string]struct {
+		input       string
+		errExpected bool
+	}{
+		"Malformed recipient key returns an error": {
+			input:       "not-a-key",
+			errExpected: true,
+		},
+		"Recipient key rejected by pushover returns an error": {
+			input:       "aQiRzpo4DXghDmr9QzzfQu27cmVRsG",
+			errExpected: true,
+		},
+		"Valid recipient key returns no error": {
+			input:       validUser,
+			errExpected: false,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := client.ValidateRecipient(tc.input)
+			errReceived := err != nil
+
+			if tc.errExpected != errReceived {
+				t.Errorf("got unexpected error status %t: %v", errReceived, err)
+			}
+		})
+	}
+}
+
+func TestNotifyResultWithMultipleRecipients(t *testing.T) {
+	const badUser = "bQiRzpo4DXghDmr9QzzfQu27cmVRsG"
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("user") == badUser {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"status":0,"user":"invalid","errors":["user identifier is invalid"],"request":"r0"}`))
+			return
+		}
+		w.Header().Set("X-Limit-App-Limit", "10000")
+		w.Header().Set("X-Limit-App-Remaining", "9999")
+		w.Header().Set("X-Limit-App-Reset", "1393653600")
+		w.Write([]byte(`{"status":1,"request":"req-` + r.FormValue("user")[:2] + `"}`))
+	}))
+	defer svr.Close()
+
+	origEndpoint := pushover.APIEndpoint
+	pushover.APIEndpoint = svr.URL
+	defer func() { pushover.APIEndpoint = origEndpoint }()
+
+	client, err := NewPushoverClient("azGDORePK8gMaC0QOYAMyEEuzJnyUi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	alt := Alert{
+		GmailQuery:      "is:unread",
+		PushoverTarget:  "uQiRzpo4DXghDmr9QzzfQu27cmVRsG",
+		PushoverTargets: []string{badUser, "gQiRzpo4DXghDmr9QzzfQu27cmVRsG"},
+		PushoverTitle:   "test",
+		PushoverSound:   "test",
+		PushoverMsg:     "test",
+	}
+
+	got, err := client.NotifyResult(alt)
+
+	var recipientErr RecipientError
+	if !errors.As(err, &recipientErr) || recipientErr.Recipient != badUser {
+		t.Fatalf("want a RecipientError for recipient %s, got: %v", badUser, err)
+	}
+	if got.RequestID != "req-uQ,req-gQ" {
+		t.Errorf("want request IDs of the notified recipients, got %q", got.RequestID)
+	}
+}
+
+func TestNotifyResultSendsAttachmentToEveryRecipient(t *testing.T) {
+	var mtx sync.Mutex
+	var got []string
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, _, err := r.FormFile("attachment")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"status":0,"errors":["missing attachment"],"request":"r0"}`))
+			return
+		}
+		b, _ := io.ReadAll(f)
+		mtx.Lock()
+		got = append(got, string(b))
+		mtx.Unlock()
+		w.Header().Set("X-Limit-App-Limit", "10000")
+		w.Header().Set("X-Limit-App-Remaining", "9999")
+		w.Header().Set("X-Limit-App-Reset", "1393653600")
+		w.Write([]byte(`{"status":1,"request":"r1"}`))
+	}))
+	defer svr.Close()
+
+	origEndpoint := pushover.APIEndpoint
+	pushover.APIEndpoint = svr.URL
+	defer func() { pushover.APIEndpoint = origEndpoint }()
+
+	client, err := NewPushoverClient("azGDORePK8gMaC0QOYAMyEEuzJnyUi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	alt := Alert{
+		GmailQuery:      "is:unread",
+		PushoverTarget:  "uQiRzpo4DXghDmr9QzzfQu27cmVRsG",
+		PushoverTargets: []string{"gQiRzpo4DXghDmr9QzzfQu27cmVRsG"},
+		PushoverTitle:   "test",
+		PushoverSound:   "test",
+		PushoverMsg:     "test",
+		Attachment:      &Attachment{MediaType: "image/gif", Data: []byte("GIF89a")},
+	}
+
+	if _, err := client.NotifyResult(alt); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+
+	want := []string{"GIF89a", "GIF89a"}
+	if !cmp.Equal(want, got) {
+		t.Errorf("want != got\ndiff=%s", cmp.Diff(want, got))
+	}
+}
+
+// countingTransport represents an http.RoundTripper counting the requests it
+// sends.
+type countingTransport struct {
+	requests int
+	mtx      sync.Mutex
+}
+
+// RoundTrip counts the given request and sends it with
+// http.DefaultTransport.
+func (c *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	c.mtx.Lock()
+	c.requests++
+	c.mtx.Unlock()
+
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestPushoverClientUsesGivenHTTPClient(t *testing.T) {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/receipts/") {
+			w.Write([]byte(`{"status":1,"acknowledged":1,"acknowledged_at":1393653600,"acknowledged_by":"uQiRzpo4DXghDmr9QzzfQu27cmVRsG",` +
+				`"last_delivered_at":1393653600,"expired":0,"expires_at":1393657200,"called_back":0,"called_back_at":0,"request":"r2"}`))
+			return
+		}
+		w.Write([]byte(`{"status":1,"request":"r1","receipt":"rcpt1"}`))
+	}))
+	defer svr.Close()
+
+	origEndpoint := pushover.APIEndpoint
+	pushover.APIEndpoint = svr.URL
+	defer func() { pushover.APIEndpoint = origEndpoint }()
+
+	transport := &countingTransport{}
+	origDefault := http.DefaultClient
+	client, err := NewPushoverClient("azGDORePK8gMaC0QOYAMyEEuzJnyUi",
+		WithPushoverClientHTTPClient(&http.Client{Transport: transport}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	alt := Alert{
+		GmailQuery:     "is:unread",
+		PushoverTarget: "uQiRzpo4DXghDmr9QzzfQu27cmVRsG",
+		PushoverTitle:  "test",
+		PushoverSound:  "test",
+		PushoverMsg:    "test",
+	}
+
+	res, err := client.NotifyResult(alt)
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	status, err := client.CheckReceipt(res.Receipts[0])
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if err := client.ValidateRecipient(alt.PushoverTarget); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+
+	if !status.Acknowledged {
+		t.Errorf("want acknowledged receipt, got %+v", status)
+	}
+	if transport.requests != 3 {
+		t.Errorf("want 3 requests sent with the given client, got %d", transport.requests)
+	}
+	if http.DefaultClient != origDefault {
+		t.Error("want http.DefaultClient left unchanged")
+	}
+}
+
+func TestFailedRecipients(t *testing.T) {
+	t.Parallel()
+
+	failed := errors.New("unreachable")
+	partial := fmt.Errorf("pushover notification failed for 2 of 3 recipients: %w", errors.Join(
+		RecipientError{Recipient: "alice", Err: failed},
+		RecipientError{Recipient: "bob", Err: failed}))
+	testCases := map[string]struct {
+		input error
+		want  []string
+	}{
+		"Error without recipient errors": {
+			input: failed,
+		},
+		"Recipient errors of a partial failure": {
+			input: partial,
+			want:  []string{"alice", "bob"},
+		},
+		"Recipient errors of a failover channel": {
+			input: ChannelError{Channel: ChannelPushover, Err: partial},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got := failedRecipients(tc.input)
+
+			if !cmp.Equal(tc.want, got) {
+				t.Errorf("want != got\ndiff=%s", cmp.Diff(tc.want, got))
+			}
+		})
+	}
 }
@@ -0,0 +1,240 @@
+package gmailalert
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// QueryExpr represents a boolean composition of Gmail queries, evaluated
+// client-side over the IDs of the messages matching each query, for
+// conditions a single Gmail query cannot express. Exactly one of its fields
+// must be set.
+type QueryExpr struct {
+	// A Gmail query whose matching messages are the result of the
+	// expression.
+	Query string `json:"query"`
+	// The expressions that a message must match all of.
+	And []QueryExpr `json:"and"`
+	// The expressions that a message must match any of.
+	Or []QueryExpr `json:"or"`
+	// The expression that a message must not match. It is only allowed as
+	// an operand of And, next to an operand that is not a Not, since the
+	// messages not matching a query are not searched for.
+	Not *QueryExpr `json:"not"`
+}
+
+// ok returns an error if the QueryExpr, or any expression it is made of,
+// does not have exactly one field set, if an And or Or has no operands, or
+// if a Not is not an operand of an And with another operand that is not a
+// Not.
+func (q QueryExpr) ok() error {
+	set := 0
+	for _, isSet := range []bool{q.Query != "", q.And != nil, q.Or != nil, q.Not != nil} {
+		if isSet {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf(`query expression must have exactly one of "query", "and", "or", or "not", got %+v`, q)
+	}
+	if q.Not != nil {
+		return errors.New(`"not" query expression must be an operand of an "and" with an operand that is not a "not"`)
+	}
+
+	if q.Or != nil {
+		if len(q.Or) == 0 {
+			return errors.New(`"or" query expression must have operands`)
+		}
+		for _, op := range q.Or {
+			if err := op.ok(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if q.And != nil {
+		positive := false
+		for _, op := range q.And {
+			if op.Not != nil {
+				if op.Query != "" || op.And != nil || op.Or != nil {
+					return fmt.Errorf(`query expression must have exactly one of "query", "and", "or", or "not", got %+v`, op)
+				}
+				if err := op.Not.ok(); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := op.ok(); err != nil {
+				return err
+			}
+			positive = true
+		}
+		if !positive {
+			return errors.New(`"and" query expression must have an operand that is not a "not"`)
+		}
+	}
+
+	return nil
+}
+
+// queries returns every Gmail query the QueryExpr is made of.
+func (q QueryExpr) queries() []string {
+	if q.Query != "" {
+		return []string{q.Query}
+	}
+	if q.Not != nil {
+		return q.Not.queries()
+	}
+
+	var queries []string
+	for _, op := range append(q.And, q.Or...) {
+		queries = append(queries, op.queries()...)
+	}
+
+	return queries
+}
+
+// mapQueries returns a copy of the QueryExpr with each of its queries
+// replaced by the result of calling the given function with it.
+func (q QueryExpr) mapQueries(fn func(query string) string) QueryExpr {
+	if q.Query != "" {
+		return QueryExpr{Query: fn(q.Query)}
+	}
+	if q.Not != nil {
+		not := q.Not.mapQueries(fn)
+		return QueryExpr{Not: &not}
+	}
+
+	var mapped QueryExpr
+	for _, op := range q.And {
+		mapped.And = append(mapped.And, op.mapQueries(fn))
+	}
+	for _, op := range q.Or {
+		mapped.Or = append(mapped.Or, op.mapQueries(fn))
+	}
+
+	return mapped
+}
+
+// describe returns a human-readable form of the QueryExpr, like
+// `"from:bank" AND NOT ("label:paid" OR "subject:receipt")`.
+func (q QueryExpr) describe() string {
+	switch {
+	case q.Query != "":
+		return fmt.Sprintf("%q", q.Query)
+	case q.Not != nil:
+		return "NOT " + q.Not.operand()
+	}
+
+	ops, sep := q.And, " AND "
+	if q.Or != nil {
+		ops, sep = q.Or, " OR "
+	}
+	parts := make([]string, 0, len(ops))
+	for _, op := range ops {
+		parts = append(parts, op.operand())
+	}
+
+	return strings.Join(parts, sep)
+}
+
+// operand returns the description of the QueryExpr as an operand of another
+// expression, in parentheses unless it is a single query or a Not.
+func (q QueryExpr) operand() string {
+	if q.Query != "" || q.Not != nil {
+		return q.describe()
+	}
+
+	return "(" + q.describe() + ")"
+}
+
+// eval returns the messages matching the QueryExpr, searching for the
+// messages matching each of its queries with the given function. Messages
+// are returned in the order of the first operand they were found by. The
+// operands of an And are no longer searched once no message matches all of
+// the searched ones. An error is returned if any search fails.
+func (q QueryExpr) eval(search func(query string) ([]Message, error)) ([]Message, error) {
+	switch {
+	case q.Query != "":
+		return search(q.Query)
+	case q.Or != nil:
+		var union []Message
+		seen := map[string]bool{}
+		for _, op := range q.Or {
+			msgs, err := op.eval(search)
+			if err != nil {
+				return nil, err
+			}
+			for _, m := range msgs {
+				if !seen[m.ID] {
+					seen[m.ID] = true
+					union = append(union, m)
+				}
+			}
+		}
+		return union, nil
+	case q.And != nil:
+		return q.evalAnd(search)
+	}
+
+	return nil, errors.New(`"not" query expression cannot be evaluated on its own`)
+}
+
+// evalAnd returns the messages matching every operand of the And of the
+// QueryExpr that is not a Not, and none of its Not operands.
+func (q QueryExpr) evalAnd(search func(query string) ([]Message, error)) ([]Message, error) {
+	var result []Message
+	first := true
+	for _, op := range q.And {
+		if op.Not != nil {
+			continue
+		}
+		msgs, err := op.eval(search)
+		if err != nil {
+			return nil, err
+		}
+		if first {
+			result, first = msgs, false
+		} else {
+			result = intersectMessages(result, msgs, true)
+		}
+		if len(result) == 0 {
+			return nil, nil
+		}
+	}
+
+	for _, op := range q.And {
+		if op.Not == nil {
+			continue
+		}
+		msgs, err := op.Not.eval(search)
+		if err != nil {
+			return nil, err
+		}
+		result = intersectMessages(result, msgs, false)
+		if len(result) == 0 {
+			return nil, nil
+		}
+	}
+
+	return result, nil
+}
+
+// intersectMessages returns the messages of a that are in b if in is true,
+// or that are not in b otherwise, compared by ID.
+func intersectMessages(a, b []Message, in bool) []Message {
+	ids := make(map[string]bool, len(b))
+	for _, m := range b {
+		ids[m.ID] = true
+	}
+
+	var result []Message
+	for _, m := range a {
+		if ids[m.ID] == in {
+			result = append(result, m)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,182 @@
+package gmailalert
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestQueryExprOK(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		expr        QueryExpr
+		errExpected bool
+	}{
+		"Single query returns no error": {
+			expr: QueryExpr{Query: "from:bank"},
+		},
+		"And with a not operand returns no error": {
+			expr: QueryExpr{And: []QueryExpr{
+				{Query: "from:bank newer_than:1d"},
+				{Not: &QueryExpr{Or: []QueryExpr{{Query: "label:paid"}, {Query: "subject:receipt"}}}},
+			}},
+		},
+		"Empty expression returns an error": {
+			expr:        QueryExpr{},
+			errExpected: true,
+		},
+		"Expression with two fields set returns an error": {
+			expr:        QueryExpr{Query: "from:bank", Or: []QueryExpr{{Query: "from:shop"}}},
+			errExpected: true,
+		},
+		"Top-level not returns an error": {
+			expr:        QueryExpr{Not: &QueryExpr{Query: "from:bank"}},
+			errExpected: true,
+		},
+		"And with only not operands returns an error": {
+			expr:        QueryExpr{And: []QueryExpr{{Not: &QueryExpr{Query: "from:bank"}}}},
+			errExpected: true,
+		},
+		"Not inside an or returns an error": {
+			expr: QueryExpr{Or: []QueryExpr{
+				{Query: "from:bank"},
+				{Not: &QueryExpr{Query: "label:paid"}},
+			}},
+			errExpected: true,
+		},
+		"Or without operands returns an error": {
+			expr:        QueryExpr{Or: []QueryExpr{}},
+			errExpected: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := tc.expr.ok()
+			errReceived := err != nil
+
+			if tc.errExpected != errReceived {
+				t.Errorf("got unexpected error status, got error: %v", err)
+			}
+		})
+	}
+}
+
+func TestQueryExprEval(t *testing.T) {
+	t.Parallel()
+
+	results := map[string][]Message{
+		"A": {{ID: "1"}, {ID: "2"}, {ID: "3"}},
+		"B": {{ID: "3"}, {ID: "2"}},
+		"C": {{ID: "2"}, {ID: "4"}},
+	}
+	testCases := map[string]struct {
+		expr     QueryExpr
+		want     []Message
+		searched []string
+	}{
+		"And keeps the messages matching every operand": {
+			expr:     QueryExpr{And: []QueryExpr{{Query: "A"}, {Query: "B"}}},
+			want:     []Message{{ID: "2"}, {ID: "3"}},
+			searched: []string{"A", "B"},
+		},
+		"Or keeps the messages matching any operand once": {
+			expr:     QueryExpr{Or: []QueryExpr{{Query: "B"}, {Query: "C"}}},
+			want:     []Message{{ID: "3"}, {ID: "2"}, {ID: "4"}},
+			searched: []string{"B", "C"},
+		},
+		"Not removes the messages matching its operand": {
+			expr: QueryExpr{And: []QueryExpr{
+				{Not: &QueryExpr{Query: "C"}},
+				{Query: "A"},
+			}},
+			want:     []Message{{ID: "1"}, {ID: "3"}},
+			searched: []string{"A", "C"},
+		},
+		"And stops searching once nothing matches": {
+			expr:     QueryExpr{And: []QueryExpr{{Query: "empty"}, {Query: "A"}, {Not: &QueryExpr{Query: "B"}}}},
+			searched: []string{"empty"},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var searched []string
+			got, err := tc.expr.eval(func(query string) ([]Message, error) {
+				searched = append(searched, query)
+				return results[query], nil
+			})
+			if err != nil {
+				t.Fatalf("got unexpected error: %v", err)
+			}
+
+			if !cmp.Equal(tc.want, got) {
+				t.Errorf("want != got\ndiff=%s", cmp.Diff(tc.want, got))
+			}
+			if !cmp.Equal(tc.searched, searched) {
+				t.Errorf("wanted queries %v to be searched, got %v", tc.searched, searched)
+			}
+		})
+	}
+}
+
+func TestQueryExprEvalWithFailingSearchReturnsError(t *testing.T) {
+	t.Parallel()
+
+	expr := QueryExpr{Or: []QueryExpr{{Query: "A"}, {Query: "B"}}}
+	_, err := expr.eval(func(query string) ([]Message, error) {
+		return nil, errors.New("quota exceeded")
+	})
+
+	if err == nil {
+		t.Error("expected an error but did not get one")
+	}
+}
+
+func TestQueryExprDescribe(t *testing.T) {
+	t.Parallel()
+
+	expr := QueryExpr{And: []QueryExpr{
+		{Query: "from:bank"},
+		{Not: &QueryExpr{Or: []QueryExpr{{Query: "label:paid"}, {Query: "subject:receipt"}}}},
+	}}
+	want := `"from:bank" AND NOT ("label:paid" OR "subject:receipt")`
+
+	if got := expr.describe(); got != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+}
+
+func TestMatchAlertAppliesSignalsToEachQuery(t *testing.T) {
+	t.Parallel()
+
+	m := &queryRecordingMatcher{}
+	alt := Alert{
+		Folder:  "inbox",
+		Queries: &QueryExpr{Or: []QueryExpr{{Query: "from:bank"}, {Query: "from:shop"}}},
+	}
+
+	if _, err := matchAlert(m, alt); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+
+	s := Signals{Folder: "inbox"}
+	want := []string{s.query("from:bank"), s.query("from:shop")}
+	if !cmp.Equal(want, m.queries) {
+		t.Errorf("want != got\ndiff=%s", cmp.Diff(want, m.queries))
+	}
+}
+
+// queryRecordingMatcher represents a test double type that implements the
+// Matcher interface and records every query it is asked to match.
+type queryRecordingMatcher struct {
+	queries []string
+}
+
+// Match records the given query and returns no matches.
+func (q *queryRecordingMatcher) Match(query string) ([]string, error) {
+	q.queries = append(q.queries, query)
+	return nil, nil
+}
@@ -0,0 +1,65 @@
+package gmailalert
+
+import (
+	"fmt"
+	"net/url"
+
+	"golang.org/x/oauth2"
+)
+
+// Secret is a string holding a sensitive value, like a token or a key, that
+// is masked whenever it is formatted, so it can be passed to a Logger
+// without leaking its value. Only the first and last 4 characters of values
+// longer than 12 characters are kept.
+type Secret string
+
+// String returns the masked value of s.
+func (s Secret) String() string {
+	if len(s) <= 12 {
+		return "****"
+	}
+
+	return string(s[:4]) + "****" + string(s[len(s)-4:])
+}
+
+// GoString returns the masked value of s, so that it is also masked when
+// formatted with the %#v verb.
+func (s Secret) GoString() string {
+	return s.String()
+}
+
+// redactToken returns a loggable description of the given OAuth2 token with
+// its access and refresh tokens masked.
+func redactToken(tok *oauth2.Token) string {
+	if tok == nil {
+		return "<nil>"
+	}
+
+	return fmt.Sprintf("{AccessToken: %s, TokenType: %s, RefreshToken: %s, Expiry: %s}",
+		Secret(tok.AccessToken), tok.TokenType, Secret(tok.RefreshToken), tok.Expiry)
+}
+
+// redactConfig returns a loggable description of the given OAuth2
+// configuration with its client secret masked.
+func redactConfig(cfg *oauth2.Config) string {
+	if cfg == nil {
+		return "<nil>"
+	}
+
+	return fmt.Sprintf("{ClientID: %s, ClientSecret: %s, AuthURL: %s, TokenURL: %s, RedirectURL: %s, Scopes: %v}",
+		cfg.ClientID, Secret(cfg.ClientSecret), cfg.Endpoint.AuthURL, cfg.Endpoint.TokenURL, cfg.RedirectURL, cfg.Scopes)
+}
+
+// redactURL returns a loggable form of the given URL with its password and
+// query masked, since either may hold an access token.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "<invalid url>"
+	}
+	if u.RawQuery != "" {
+		u.RawQuery = "xxxxx"
+	}
+
+	return u.Redacted()
+}
@@ -0,0 +1,86 @@
+package gmailalert
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestSecretMasksValue(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		input  Secret
+		format string
+		want   string
+	}{
+		"Long value keeps first and last 4 characters": {
+			input:  Secret("ab12.gophercd4567"),
+			format: "%s",
+			want:   "ab12****4567",
+		},
+		"Short value is fully masked": {
+			input:  Secret("abc123"),
+			format: "%s",
+			want:   "****",
+		},
+		"Quoted value is masked": {
+			input:  Secret("ab12.gophercd4567"),
+			format: "%q",
+			want:   `"ab12****4567"`,
+		},
+		"Go-syntax value is masked": {
+			input:  Secret("ab12.gophercd4567"),
+			format: "%#v",
+			want:   "ab12****4567",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got := fmt.Sprintf(tc.format, tc.input)
+
+			if tc.want != got {
+				t.Errorf("want %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestRedactTokenMasksSecrets(t *testing.T) {
+	t.Parallel()
+
+	tok := &oauth2.Token{
+		AccessToken:  "ab12.gophercd4567",
+		TokenType:    "Bearer",
+		RefreshToken: "1//gopher9876543",
+	}
+
+	got := redactToken(tok)
+
+	for _, secret := range []string{tok.AccessToken, tok.RefreshToken} {
+		if strings.Contains(got, secret) {
+			t.Errorf("want redacted token to not contain %q, got %s", secret, got)
+		}
+	}
+	if !strings.Contains(got, "Bearer") {
+		t.Errorf("want redacted token to contain the token type, got %s", got)
+	}
+}
+
+func TestRedactConfigMasksClientSecret(t *testing.T) {
+	t.Parallel()
+
+	cfg := &oauth2.Config{ClientID: "my-client-id", ClientSecret: "GOCSPX-supersecretvalue"}
+
+	got := redactConfig(cfg)
+
+	if strings.Contains(got, cfg.ClientSecret) {
+		t.Errorf("want redacted config to not contain the client secret, got %s", got)
+	}
+	if !strings.Contains(got, cfg.ClientID) {
+		t.Errorf("want redacted config to contain the client ID, got %s", got)
+	}
+}
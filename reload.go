@@ -0,0 +1,233 @@
+package gmailalert
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// errConfigChanged is returned by the daemon mode of the CLI when the alert
+// configuration, credentials, or token files changed and need to be
+// reloaded.
+var errConfigChanged = errors.New("configuration files changed")
+
+// checkMounts returns an error if the directory of any of the files named in
+// the cliEnv receiver does not exist, or if the alert configuration or
+// credentials file does not exist. This turns a volume that was not mounted,
+// like a Kubernetes secret or config map, into an explicit error.
+func (c cliEnv) checkMounts() error {
+	type mount struct {
+		flag     string
+		file     string
+		required bool
+	}
+	files := []mount{
+		{flag: "alerts-cfg-file", file: c.alertsConfigFile, required: true},
+		{flag: "token-file", file: c.tokenFile},
+		{flag: "state-file", file: c.stateFile},
+		{flag: "history-file", file: c.historyFile},
+		{flag: "outbox-file", file: c.outboxFile},
+	}
+	for _, file := range credentialsFiles(c.credsFile) {
+		files = append(files, mount{flag: "credentials-file", file: file, required: true})
+	}
+	for _, f := range files {
+		if f.file == "" || f.file == stdinConfig || isConfigURL(f.file) {
+			continue
+		}
+		dir := filepath.Dir(f.file)
+		if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf(`directory %s of the "-%s" file does not exist, check that it is mounted`, dir, f.flag)
+		}
+		if !f.required {
+			continue
+		}
+		if _, err := os.Stat(f.file); errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf(`"-%s" file %s does not exist, check that it is mounted`, f.flag, f.file)
+		}
+	}
+
+	return nil
+}
+
+// poll processes the given alerts with the given Alerter in daemon mode until
+// the given context is cancelled. If a reload interval is set in the cliEnv
+// receiver, the alert configuration, credentials, and token files are
+// checked for changes at that interval, and if the alert configuration is
+// hosted at a URL with a refresh interval set, it is fetched again at that
+// interval. errConfigChanged is returned once any of them changed. Without a
+// gmailClientPool, which only creates the Gmail client again if its
+// credentials or token changed, the shared token source of the token file is
+// dropped first so that the reloaded configuration reads the token file
+// again.
+func (c cliEnv) poll(ctx context.Context, alerter Alerter, alerts []Alert) error {
+	if c.reloadInterval <= 0 && !c.refreshesConfig() {
+		return alerter.Poll(ctx, alerts, c.minInterval, c.maxInterval)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	changed := make(chan struct{})
+	go func() {
+		if c.watchConfig(ctx, alerter.errorLog()) {
+			close(changed)
+			cancel()
+		}
+	}()
+
+	err := alerter.Poll(ctx, alerts, c.minInterval, c.maxInterval)
+	select {
+	case <-changed:
+		if c.gmailClients == nil {
+			defaultTokenManager.Forget(c.tokenFile)
+		}
+		return errConfigChanged
+	default:
+		return err
+	}
+}
+
+// watchConfig checks the configuration fingerprint of the cliEnv receiver at
+// its reload interval, and after fetching the alert configuration again at
+// its refresh interval, with a random jitter added to each, and returns true
+// once it changed, or false once the given context is cancelled. A changed
+// configuration that cannot be loaded is logged, and notified about by the
+// cliEnv receiver's Monitor, if any, instead of being reloaded.
+func (c cliEnv) watchConfig(ctx context.Context, logger Logger) bool {
+	initial := c.configFingerprint()
+	var reload <-chan time.Time
+	if c.reloadInterval > 0 {
+		ticker := time.NewTicker(c.reloadInterval)
+		defer ticker.Stop()
+		reload = ticker.C
+	}
+	var refresh *time.Timer
+	var refreshed <-chan time.Time
+	if c.refreshesConfig() {
+		refresh = time.NewTimer(c.alertsCfgRefresh + jitter(c.alertsCfgJitter))
+		defer refresh.Stop()
+		refreshed = refresh.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-reload:
+		case <-refreshed:
+			if _, err := c.alertsSource.read(); err != nil {
+				logger.Printf("warning: got error refreshing alert configuration: %v", err)
+			}
+			refresh.Reset(c.alertsCfgRefresh + jitter(c.alertsCfgJitter))
+		}
+		if fp := c.configFingerprint(); fp != initial {
+			if err := c.checkReload(); err != nil {
+				logger.Printf("warning: rejected changed alert configuration, keeping the running one: %v", err)
+				if c.monitor != nil {
+					c.monitor.ReloadRejected(err)
+				}
+				initial = fp
+				continue
+			}
+			logger.Printf("alert configuration, credentials, or token file changed, reloading")
+			return true
+		}
+	}
+}
+
+// checkReload returns an error if the alert configuration named in the
+// cliEnv receiver cannot be loaded again, like when it was changed into
+// invalid JSON or its profiles are invalid, in which case the daemon keeps
+// running with the configuration it loaded before.
+func (c cliEnv) checkReload() error {
+	alertCfg, err := c.alertConfig()
+	if err != nil {
+		return err
+	}
+	_, err = c.profiles(alertCfg)
+
+	return err
+}
+
+// configFingerprint returns a hash of the contents of the alert configuration
+// and credentials files and of the refresh token in the token file named in
+// the cliEnv receiver. Only the refresh token is hashed so that saving a
+// refreshed access token does not count as a change, while a rotated token
+// secret does. The detached signature of a signed alert configuration file
+// is hashed too, so that a config rejected until its new signature was
+// published is reloaded then. For an alert configuration read from stdin or
+// a URL, the copy read last is hashed without reading it again. Missing
+// files are hashed as such.
+func (c cliEnv) configFingerprint() string {
+	files := []string{c.alertsConfigFile}
+	if c.alertsCfgKey != "" && c.alertsConfigFile != stdinConfig && !isConfigURL(c.alertsConfigFile) {
+		files = append(files, c.alertsConfigFile+configSignatureSuffix)
+	}
+
+	return c.fingerprint(append(files, c.credentialsAndToken()...)...)
+}
+
+// credentialsFingerprint returns a hash of the contents of the credentials
+// file and of the refresh token in the token file named in the cliEnv
+// receiver, like configFingerprint, which changes when the Gmail client needs
+// to be created again.
+func (c cliEnv) credentialsFingerprint() string {
+	return c.fingerprint(c.credentialsAndToken()...)
+}
+
+// credentialsAndToken returns the credentials files and the token file named
+// in the cliEnv receiver.
+func (c cliEnv) credentialsAndToken() []string {
+	return append(credentialsFiles(c.credsFile), c.tokenFile)
+}
+
+// fingerprint returns a hash of the contents of the given files, which are
+// among the alert configuration, credentials, and token files named in the
+// cliEnv receiver, as described by configFingerprint.
+func (c cliEnv) fingerprint(files ...string) string {
+	h := sha256.New()
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if file == c.alertsConfigFile && c.alertsSource != nil && c.alertsSource.current() != nil {
+			b, err = c.alertsSource.current(), nil
+		}
+		if err != nil {
+			fmt.Fprintf(h, "%s: unreadable\n", file)
+			continue
+		}
+		if file == c.tokenFile {
+			var tok struct {
+				RefreshToken string `json:"refresh_token"`
+			}
+			if json.Unmarshal(b, &tok) == nil {
+				b = []byte(tok.RefreshToken)
+			}
+		}
+		fmt.Fprintf(h, "%s: %x\n", file, sha256.Sum256(b))
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// refreshesConfig reports whether the alert configuration named in the
+// cliEnv receiver is hosted at a URL that is fetched again at a refresh
+// interval in daemon mode.
+func (c cliEnv) refreshesConfig() bool {
+	return c.alertsSource != nil && isConfigURL(c.alertsConfigFile) && c.alertsCfgRefresh > 0
+}
+
+// jitter returns a random duration between 0 and the given maximum.
+func jitter(limit time.Duration) time.Duration {
+	if limit <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(limit) + 1))
+}
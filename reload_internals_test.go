@@ -0,0 +1,173 @@
+package gmailalert
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckMounts(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	alertsFile := filepath.Join(dir, "alerts.json")
+	credsFile := filepath.Join(dir, "credentials.json")
+	for _, f := range []string{alertsFile, credsFile} {
+		if err := os.WriteFile(f, []byte("{}"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := map[string]struct {
+		input       cliEnv
+		errExpected bool
+	}{
+		"Existing files and missing token file are valid": {
+			input: cliEnv{alertsConfigFile: alertsFile, credsFile: credsFile, tokenFile: filepath.Join(dir, "token.json")},
+		},
+		"Missing credentials file returns an error": {
+			input:       cliEnv{alertsConfigFile: alertsFile, credsFile: filepath.Join(dir, "missing.json")},
+			errExpected: true,
+		},
+		"Missing token directory returns an error": {
+			input:       cliEnv{alertsConfigFile: alertsFile, credsFile: credsFile, tokenFile: filepath.Join(dir, "secrets", "token.json")},
+			errExpected: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			errReceived := tc.input.checkMounts() != nil
+
+			if tc.errExpected != errReceived {
+				t.Errorf("got unexpected error status %v", errReceived)
+			}
+		})
+	}
+}
+
+func TestConfigFingerprint(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	app := cliEnv{
+		alertsConfigFile: filepath.Join(dir, "alerts.json"),
+		credsFile:        filepath.Join(dir, "credentials.json"),
+		tokenFile:        filepath.Join(dir, "token.json"),
+	}
+	write := func(file, content string) {
+		t.Helper()
+		if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(app.alertsConfigFile, `{"alerts": []}`)
+	write(app.credsFile, `{"installed": {}}`)
+	write(app.tokenFile, `{"access_token": "a1", "refresh_token": "r1"}`)
+	initial := app.configFingerprint()
+
+	write(app.tokenFile, `{"access_token": "a2", "refresh_token": "r1"}`)
+	if app.configFingerprint() != initial {
+		t.Error("want a refreshed access token to keep the fingerprint")
+	}
+
+	write(app.tokenFile, `{"access_token": "a2", "refresh_token": "r2"}`)
+	rotated := app.configFingerprint()
+	if rotated == initial {
+		t.Error("want a rotated refresh token to change the fingerprint")
+	}
+
+	write(app.alertsConfigFile, `{"alerts": [{}]}`)
+	if app.configFingerprint() == rotated {
+		t.Error("want a changed alerts config to change the fingerprint")
+	}
+}
+
+func TestPollReturnsErrConfigChangedWhenFilesChange(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	app := cliEnv{
+		alertsConfigFile: filepath.Join(dir, "alerts.json"),
+		minInterval:      time.Hour,
+		maxInterval:      time.Hour,
+		reloadInterval:   10 * time.Millisecond,
+	}
+	if err := os.WriteFile(app.alertsConfigFile, []byte(`{"alerts": []}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	a := Alerter{
+		Matcher:  fakePreviewFetcher{},
+		Notifier: &recordingTestNotifier{},
+		Logger:   log.New(io.Discard, "", 0),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		os.WriteFile(app.alertsConfigFile, []byte(`{"alerts": [{}]}`), 0600)
+	}()
+
+	err := app.poll(ctx, a, []Alert{{GmailQuery: "is:unread"}})
+
+	if !errors.Is(err, errConfigChanged) {
+		t.Errorf("want errConfigChanged, got %v", err)
+	}
+}
+
+func TestPollKeepsRunningWhenChangedConfigIsRejected(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	n := &recordingTestNotifier{}
+	monitor, err := NewMonitor(MonitorConfig{PushoverTarget: "ops"}, n, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := cliEnv{
+		alertsConfigFile: filepath.Join(dir, "alerts.json"),
+		minInterval:      time.Hour,
+		maxInterval:      time.Hour,
+		reloadInterval:   10 * time.Millisecond,
+		monitor:          monitor,
+	}
+	if err := os.WriteFile(app.alertsConfigFile, []byte(`{"alerts": []}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	a := Alerter{
+		Matcher:  fakePreviewFetcher{},
+		Notifier: &recordingTestNotifier{},
+		Logger:   log.New(io.Discard, "", 0),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// The configuration is replaced by renaming, so that the daemon never
+	// reads a partly written file.
+	replace := func(content string) {
+		tmp := app.alertsConfigFile + ".tmp"
+		os.WriteFile(tmp, []byte(content), 0600)
+		os.Rename(tmp, app.alertsConfigFile)
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		replace(`{"alerts": [`)
+		time.Sleep(100 * time.Millisecond)
+		replace(`{"alerts": [{}]}`)
+	}()
+
+	err = app.poll(ctx, a, []Alert{{GmailQuery: "is:unread"}})
+
+	if !errors.Is(err, errConfigChanged) {
+		t.Errorf("want errConfigChanged once the configuration was fixed, got %v", err)
+	}
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	if len(n.alerts) != 1 || n.alerts[0].PushoverTitle != "gmailalert configuration rejected" {
+		t.Errorf("want the rejected configuration notified once, got %+v", n.alerts)
+	}
+}
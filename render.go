@@ -0,0 +1,151 @@
+package gmailalert
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gregdel/pushover"
+)
+
+// renderCLI accepts the command line flags of the "render" subcommand, which
+// evaluates the alert named by the "-alert" flag against the mailbox, or
+// against the email fixtures in the directory given by the "-fixtures" flag,
+// and prints the Pushover notification exactly as it would be sent, or its
+// rendering for the kind of notifier given by the "-format" flag, without
+// sending it. An error is returned if the flags are invalid, the alert
+// configuration or fixtures cannot be loaded, the alert fails, or its
+// notification would be rejected.
+func renderCLI(args []string) error {
+	var app cliEnv
+	var alertName, fixturesDir, format string
+
+	fs := app.flagSet("render")
+	fs.StringVar(
+		&alertName,
+		"alert",
+		"",
+		"the name (or gmail query) of the alert to render the notification of")
+	fs.StringVar(
+		&fixturesDir,
+		"fixtures",
+		"",
+		"the directory of the .eml or .json email fixtures to evaluate the alert against (the mailbox if empty)")
+	fs.StringVar(
+		&format,
+		"format",
+		FormatPushover,
+		`the kind of notifier to render the notification for, one of "pushover", "slack", "discord", or "webhook"`)
+	if err := app.parse(fs, args); err != nil {
+		return err
+	}
+	if alertName == "" {
+		fs.Usage()
+		return errors.New(`command line flag "-alert" must be non-empty`)
+	}
+
+	app, alertCfg, err := app.profileConfig()
+	if err != nil {
+		return err
+	}
+	selected, err := selectAlerts(alertCfg.Alerts, alertName)
+	if err != nil {
+		return err
+	}
+	formatter, err := alertCfg.formatter(format)
+	if err != nil {
+		return err
+	}
+
+	var logger Logger = log.New(io.Discard, "", 0)
+	if app.debug {
+		logger = newInfoLogger()
+	}
+	now := time.Now()
+	var m Matcher
+	if fixturesDir != "" {
+		fixtures, err := loadReplayFixtures(fixturesDir)
+		if err != nil {
+			return err
+		}
+		m = replayMatcher{fixtures: fixtures, now: now}
+	} else {
+		gmailClient, err := app.gmailClient(app.debugLogger(), alertCfg)
+		if err != nil {
+			return err
+		}
+		m = gmailClient
+	}
+
+	return renderNotification(m, selected[0], formatter, alertCfg.pushoverMaxLength(), now, logger, os.Stdout)
+}
+
+// renderNotification accepts a Matcher, an Alert, a Formatter, the maximum
+// length of a Pushover notification message, the time to evaluate the Alert
+// at, a Logger, and an io.Writer, evaluates the Alert without sending any
+// notification, and writes the notification that would be sent for it to
+// the io.Writer, or a note that none would be sent if the Alert does not
+// fire. The notification is written as the indented JSON payload if the
+// Formatter renders one, and as the Pushover notification, truncated like
+// PushoverClient does, otherwise. An error is returned if the
+// Alert fails or its notification would be rejected before being sent, like
+// when it has no recipients.
+func renderNotification(m Matcher, alt Alert, f Formatter, maxLength int, at time.Time, logger Logger, w io.Writer) error {
+	summary, notified, err := dryRunAlerts(m, []Alert{alt}, at, logger)
+	if err != nil {
+		return err
+	}
+	for _, res := range summary.Results {
+		if res.Alert == alt.key() && res.Err != nil {
+			return res.Err
+		}
+	}
+
+	rendered, ok := notified[alt.key()]
+	if !ok {
+		_, err := fmt.Fprintf(w, "alert %q would not send a notification\n", alt.key())
+		return err
+	}
+	req, err := prepareNotifyReq(rendered, f, maxLength)
+	if err != nil {
+		return fmt.Errorf("notification of alert %q would be rejected: %v", alt.key(), err)
+	}
+	formatted, err := f.Format(newNotification(rendered))
+	if err != nil {
+		return err
+	}
+	if formatted.Payload != nil {
+		var b bytes.Buffer
+		if err := json.Indent(&b, formatted.Payload, "", "  "); err != nil {
+			return err
+		}
+		_, err := fmt.Fprintln(w, b.String())
+		return err
+	}
+
+	recipients := make([]string, 0, len(req.recipients))
+	for _, r := range req.recipients {
+		recipients = append(recipients, Secret(r).String())
+	}
+	priority := "normal"
+	if req.msg.Priority == pushover.PriorityEmergency {
+		priority = fmt.Sprintf("emergency (retry %s, expire %s)", req.msg.Retry, req.msg.Expire)
+	}
+
+	fmt.Fprintf(w, "Title:      %s\n", req.msg.Title)
+	fmt.Fprintf(w, "Sound:      %s\n", req.msg.Sound)
+	fmt.Fprintf(w, "Priority:   %s\n", priority)
+	fmt.Fprintf(w, "Recipients: %s\n", strings.Join(recipients, ", "))
+	if rendered.Attachment != nil {
+		fmt.Fprintf(w, "Attachment: %s (%d bytes)\n", rendered.Attachment.MediaType, len(rendered.Attachment.Data))
+	}
+	_, err = fmt.Fprintf(w, "Message (%d characters):\n%s\n", len([]rune(req.msg.Message)), req.msg.Message)
+
+	return err
+}
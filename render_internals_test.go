@@ -0,0 +1,92 @@
+package gmailalert
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gregdel/pushover"
+)
+
+func TestRenderNotification(t *testing.T) {
+	t.Parallel()
+
+	at := time.Date(2023, 3, 2, 12, 0, 0, 0, time.UTC)
+	raw := "From: billing@example.com\r\nSubject: Your bill\r\nDate: Wed, 1 Mar 2023 12:00:00 +0000\r\n\r\nPay up.\r\n"
+	f, err := newReplayFixture(replayedMessage{exportedMessage: exportedMessage{Message: Message{ID: "a"}, Raw: raw}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := replayMatcher{fixtures: []*replayFixture{f}, now: at}
+	logger := log.New(io.Discard, "", 0)
+	bills := Alert{
+		Name:           "bills",
+		GmailQuery:     "from:billing",
+		PushoverTarget: "uQiRzpo4DXghDmr9QzzfQu27cmVRsG",
+		PushoverTitle:  "Bill Due!",
+		PushoverSound:  "cashregister",
+		PushoverMsg:    "Bills",
+	}
+
+	testCases := map[string]struct {
+		alt         Alert
+		formatter   Formatter
+		wantOutput  []string
+		errExpected bool
+	}{
+		"Firing alert prints the notification that would be sent": {
+			alt:       bills,
+			formatter: PushoverFormatter{},
+			wantOutput: []string{
+				"Title:      Bill Due!",
+				"Sound:      cashregister",
+				"Priority:   normal",
+				"Recipients: uQiR****VRsG",
+				`Found 1 emails matching query "from:billing"`,
+			},
+		},
+		"Formatter with a payload prints it as indented JSON": {
+			alt:       bills,
+			formatter: SlackFormatter{},
+			wantOutput: []string{
+				`"type": "header"`,
+				`"text": "Bill Due!"`,
+			},
+		},
+		"Alert without matches prints no notification": {
+			alt:        Alert{Name: "none", GmailQuery: "subject:invoice", PushoverTitle: "Invoice!"},
+			formatter:  PushoverFormatter{},
+			wantOutput: []string{`alert "none" would not send a notification`},
+		},
+		"Notification that would be rejected returns error": {
+			alt:         Alert{Name: "bills", GmailQuery: "from:billing", PushoverTitle: "Bill Due!"},
+			formatter:   PushoverFormatter{},
+			errExpected: true,
+		},
+		"Failing alert returns error": {
+			alt:         Alert{Name: "snoozed", GmailQuery: "is:snoozed", PushoverTitle: "Snoozed!"},
+			formatter:   PushoverFormatter{},
+			errExpected: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+
+			err := renderNotification(r, tc.alt, tc.formatter, pushover.MessageMaxLength, at, logger, out)
+			errReceived := err != nil
+			if tc.errExpected != errReceived {
+				t.Fatalf("renderNotification returned unexpected error status: %v", err)
+			}
+			for _, want := range tc.wantOutput {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("want output to contain %q, got:\n%s", want, out.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package gmailalert
+
+import (
+	"fmt"
+	"time"
+)
+
+// repeatPolicy represents how often an alert that keeps matching the same
+// messages should be notified again.
+type repeatPolicy struct {
+	// once indicates the alert is only notified when new messages match.
+	once bool
+	// interval is the minimum amount of time between notifications for the
+	// same messages. A zero interval means the alert is notified on every run.
+	interval time.Duration
+}
+
+// parseRepeatInterval accepts a repeat interval value from an alert
+// configuration and returns the corresponding repeatPolicy. An empty value is
+// treated as "always". An error is returned if the value is not "always",
+// "once", or a positive duration.
+func parseRepeatInterval(s string) (repeatPolicy, error) {
+	switch s {
+	case "", "always":
+		return repeatPolicy{}, nil
+	case "once":
+		return repeatPolicy{once: true}, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return repeatPolicy{}, fmt.Errorf(`repeat interval must be "always", "once", or a duration, got %q`, s)
+	}
+	if d <= 0 {
+		return repeatPolicy{}, fmt.Errorf("repeat interval duration must be positive, got %q", s)
+	}
+
+	return repeatPolicy{interval: d}, nil
+}
+
+// shouldNotify accepts the previously persisted AlertState for an alert, the
+// IDs of the messages currently matching the alert, and the current time, and
+// reports whether the alert should be notified. An alert is always notified
+// when any of the matching messages were not part of the last notification.
+func (r repeatPolicy) shouldNotify(prev AlertState, ids []string, now time.Time) bool {
+	if !r.once && r.interval == 0 {
+		return true
+	}
+
+	seen := make(map[string]bool, len(prev.MessageIDs))
+	for _, id := range prev.MessageIDs {
+		seen[id] = true
+	}
+	for _, id := range ids {
+		if !seen[id] {
+			return true
+		}
+	}
+
+	if r.once {
+		return false
+	}
+
+	return now.Sub(prev.Notified) >= r.interval
+}
@@ -0,0 +1,119 @@
+package gmailalert
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseRepeatInterval(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		input       string
+		want        repeatPolicy
+		errExpected bool
+	}{
+		"Empty value notifies on every run": {
+			input: "",
+			want:  repeatPolicy{},
+		},
+		`"always" notifies on every run`: {
+			input: "always",
+			want:  repeatPolicy{},
+		},
+		`"once" notifies only once`: {
+			input: "once",
+			want:  repeatPolicy{once: true},
+		},
+		"Duration notifies at the given interval": {
+			input: "6h",
+			want:  repeatPolicy{interval: 6 * time.Hour},
+		},
+		"Non-positive duration returns an error": {
+			input:       "-1h",
+			errExpected: true,
+		},
+		"Unknown value returns an error": {
+			input:       "sometimes",
+			errExpected: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got, err := parseRepeatInterval(tc.input)
+			errReceived := err != nil
+
+			if tc.errExpected != errReceived {
+				t.Fatalf("got unexpected error status %t", errReceived)
+			}
+
+			if !errReceived && !cmp.Equal(tc.want, got, cmp.AllowUnexported(repeatPolicy{})) {
+				t.Errorf("want != got\ndiff=%s", cmp.Diff(tc.want, got, cmp.AllowUnexported(repeatPolicy{})))
+			}
+		})
+	}
+}
+
+func TestShouldNotify(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	prev := AlertState{Notified: now.Add(-2 * time.Hour), MessageIDs: []string{"a", "b"}}
+
+	testCases := map[string]struct {
+		policy repeatPolicy
+		prev   AlertState
+		ids    []string
+		want   bool
+	}{
+		"Always policy notifies for previously notified messages": {
+			policy: repeatPolicy{},
+			prev:   prev,
+			ids:    []string{"a", "b"},
+			want:   true,
+		},
+		"Once policy notifies without previous state": {
+			policy: repeatPolicy{once: true},
+			prev:   AlertState{},
+			ids:    []string{"a"},
+			want:   true,
+		},
+		"Once policy suppresses previously notified messages": {
+			policy: repeatPolicy{once: true},
+			prev:   prev,
+			ids:    []string{"b"},
+			want:   false,
+		},
+		"Once policy notifies for new messages": {
+			policy: repeatPolicy{once: true},
+			prev:   prev,
+			ids:    []string{"a", "c"},
+			want:   true,
+		},
+		"Interval policy suppresses before the interval elapses": {
+			policy: repeatPolicy{interval: 3 * time.Hour},
+			prev:   prev,
+			ids:    []string{"a", "b"},
+			want:   false,
+		},
+		"Interval policy notifies after the interval elapses": {
+			policy: repeatPolicy{interval: time.Hour},
+			prev:   prev,
+			ids:    []string{"a", "b"},
+			want:   true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got := tc.policy.shouldNotify(tc.prev, tc.ids, now)
+
+			if tc.want != got {
+				t.Errorf("want %t, got %t", tc.want, got)
+			}
+		})
+	}
+}
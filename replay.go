@@ -0,0 +1,409 @@
+package gmailalert
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// replaySnippetChars is the number of characters of the text of an email
+// fixture used as its snippet if it has none.
+const replaySnippetChars = 200
+
+// replayFixture represents a stored email that alerts are replayed against.
+type replayFixture struct {
+	msg Message
+	raw []byte
+	// The headers of the email.
+	header mail.Header
+	// The IDs of the labels of the email, like "INBOX" or "UNREAD".
+	labels []string
+	// The file names of the attachments of the email.
+	attachments []string
+	// The lowercased headers and text searched for the words of a query.
+	searchText string
+}
+
+// replayedMessage represents an email fixture in JSON format, like the files
+// written by the "export" subcommand with "-format json", optionally with the
+// IDs of its labels.
+type replayedMessage struct {
+	exportedMessage
+	Labels []string
+}
+
+// hasLabel reports whether the replayFixture receiver f has the label with
+// the given ID, compared case-insensitively.
+func (f *replayFixture) hasLabel(id string) bool {
+	for _, l := range f.labels {
+		if strings.EqualFold(l, id) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// loadReplayFixtures reads every email fixture in the given directory, in
+// file name order. Fixtures are raw emails in files with the ".eml"
+// extension, whose ID is their file name without the extension and whose
+// labels are read from their "X-Gmail-Labels" header, like in a Google
+// Takeout export, or JSON files with the ".json" extension holding a
+// replayedMessage. Other files are ignored. An error is returned if the
+// directory cannot be read, any fixture cannot be parsed, or there are no
+// fixtures.
+func loadReplayFixtures(dir string) ([]*replayFixture, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("got error reading fixtures directory: %v", err)
+	}
+
+	var fixtures []*replayFixture
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		if e.IsDir() || (ext != ".eml" && ext != ".json") {
+			continue
+		}
+		file := filepath.Join(dir, e.Name())
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("got error reading fixture %s: %v", file, err)
+		}
+
+		rm := replayedMessage{exportedMessage: exportedMessage{Message: Message{ID: strings.TrimSuffix(e.Name(), ext)}, Raw: string(b)}}
+		if ext == ".json" {
+			if err := json.Unmarshal(b, &rm); err != nil {
+				return nil, fmt.Errorf("got error decoding fixture %s: %v", file, err)
+			}
+		}
+		f, err := newReplayFixture(rm)
+		if err != nil {
+			return nil, fmt.Errorf("got error parsing fixture %s: %v", file, err)
+		}
+		fixtures = append(fixtures, f)
+	}
+	if len(fixtures) == 0 {
+		return nil, fmt.Errorf("fixtures directory %s has no .eml or .json files", dir)
+	}
+
+	return fixtures, nil
+}
+
+// newReplayFixture returns the replayFixture of the given replayedMessage,
+// filling in the fields of its Message that are not set from its raw email.
+// An error is returned if the raw email cannot be parsed.
+func newReplayFixture(rm replayedMessage) (*replayFixture, error) {
+	raw := []byte(rm.Raw)
+	parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("got error parsing email message: %v", err)
+	}
+
+	f := &replayFixture{msg: rm.Message, raw: raw, header: parsed.Header, labels: rm.Labels}
+	if f.labels == nil {
+		f.labels = takeoutLabels(parsed.Header.Get("X-Gmail-Labels"))
+	}
+	if f.msg.ThreadID == "" {
+		f.msg.ThreadID = f.msg.ID
+	}
+	if f.msg.Date.IsZero() {
+		f.msg.Date, _ = parsed.Header.Date()
+	}
+	if f.msg.From == "" {
+		f.msg.From = parsed.Header.Get("From")
+	}
+	if f.msg.Subject == "" {
+		f.msg.Subject = parsed.Header.Get("Subject")
+	}
+
+	err = walkMIME(bytes.NewReader(raw), func(p mimePart) error {
+		if p.filename != "" {
+			f.attachments = append(f.attachments, p.filename)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	text, err := bodyText(bytes.NewReader(raw), int64(len(raw)))
+	if err != nil {
+		return nil, err
+	}
+	text = strings.Join(strings.Fields(text), " ")
+	if f.msg.Snippet == "" {
+		f.msg.Snippet = truncateRunes(text, replaySnippetChars)
+	}
+
+	h := parsed.Header
+	f.searchText = strings.ToLower(strings.Join([]string{h.Get("From"), h.Get("To"), h.Get("Cc"), h.Get("Subject"), text}, "\n"))
+
+	return f, nil
+}
+
+// takeoutLabels returns the label IDs of the given value of the
+// "X-Gmail-Labels" header of a Google Takeout export, like "Inbox,Unread",
+// with the names of system labels turned into their IDs, like "INBOX".
+func takeoutLabels(header string) []string {
+	var labels []string
+	for _, name := range strings.Split(header, ",") {
+		name = strings.TrimSpace(name)
+		id := strings.ToUpper(strings.ReplaceAll(name, " ", "_"))
+		switch {
+		case name == "":
+			continue
+		case id == "OPENED":
+			continue
+		case systemLabel(id):
+			labels = append(labels, id)
+		default:
+			labels = append(labels, name)
+		}
+	}
+
+	return labels
+}
+
+// replayMatcher represents a Matcher, Fetcher, and RawFetcher searching
+// stored email fixtures instead of a mailbox, evaluating Gmail queries
+// offline with parseReplayQuery.
+type replayMatcher struct {
+	fixtures []*replayFixture
+	// The time relative dates in queries are evaluated against.
+	now time.Time
+}
+
+// Match returns the IDs of the fixtures MatchMessages returns for the given
+// Gmail query.
+func (r replayMatcher) Match(query string) ([]string, error) {
+	msgs, err := r.MatchMessages(query)
+	return messageIDs(msgs), err
+}
+
+// MatchMessages returns the fixtures of the replayMatcher receiver r
+// matching the given Gmail query, newest first like Gmail. An error is
+// returned if the query cannot be evaluated offline.
+func (r replayMatcher) MatchMessages(query string) ([]Message, error) {
+	pred, err := parseReplayQuery(query, r.now)
+	if err != nil {
+		return nil, fmt.Errorf("got error evaluating gmail query %q offline: %v", query, err)
+	}
+
+	var msgs []Message
+	for _, f := range r.fixtures {
+		if pred(f) {
+			msgs = append(msgs, f.msg)
+		}
+	}
+	sort.SliceStable(msgs, func(i, j int) bool { return msgs[i].Date.After(msgs[j].Date) })
+
+	return msgs, nil
+}
+
+// Fetch returns the Message of the fixture with the given ID. An error is
+// returned if there is no such fixture.
+func (r replayMatcher) Fetch(id string) (Message, error) {
+	f, err := r.fixture(id)
+	if err != nil {
+		return Message{}, err
+	}
+
+	return f.msg, nil
+}
+
+// FetchRaw returns the raw email of the fixture with the given ID. An error
+// is returned if there is no such fixture.
+func (r replayMatcher) FetchRaw(id string) ([]byte, error) {
+	f, err := r.fixture(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return f.raw, nil
+}
+
+// fixture returns the fixture of the replayMatcher receiver r with the given
+// ID. An error is returned if there is no such fixture.
+func (r replayMatcher) fixture(id string) (*replayFixture, error) {
+	for _, f := range r.fixtures {
+		if f.msg.ID == id {
+			return f, nil
+		}
+	}
+
+	return nil, fmt.Errorf("fixture %q does not exist", id)
+}
+
+// replayNotifier represents a Notifier recording the notifications of a
+// replay instead of sending them.
+type replayNotifier struct {
+	mtx    sync.Mutex
+	alerts map[string]Alert
+}
+
+// Notify records the given Alert under its key.
+func (n *replayNotifier) Notify(alt Alert) error {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	n.alerts[alt.key()] = alt
+
+	return nil
+}
+
+// replaySummary represents a Reporter keeping the Summary of a replay.
+type replaySummary struct {
+	summary *Summary
+}
+
+// Report keeps the given Summary.
+func (r replaySummary) Report(s Summary) error {
+	*r.summary = s
+	return nil
+}
+
+// dryRunAlerts accepts a Matcher, a slice of Alerts, the time to process
+// them at, and a Logger, processes the Alerts without sending any
+// notifications, and returns the Summary of the run along with the Alerts
+// that would have been notified, by key. An error is returned if the Alerts
+// cannot be processed.
+func dryRunAlerts(m Matcher, alerts []Alert, at time.Time, logger Logger) (Summary, map[string]Alert, error) {
+	var summary Summary
+	notifier := &replayNotifier{alerts: map[string]Alert{}}
+	alerter, err := NewAlerter(m, notifier,
+		WithAlerterLogger(logger),
+		WithAlerterClock(func() time.Time { return at }),
+		WithAlerterReporter(replaySummary{summary: &summary}))
+	if err != nil {
+		return Summary{}, nil, err
+	}
+	if _, err := alerter.Run(alerts); err != nil {
+		return Summary{}, nil, err
+	}
+
+	return summary, notifier.alerts, nil
+}
+
+// replayCLI accepts the command line flags of the "replay" subcommand, which
+// evaluates the alert named by the "-alert" flag, or every alert if it is
+// empty, against the email fixtures in the directory given by the
+// "-fixtures" flag instead of the mailbox, and prints the matches of each
+// alert and the notification that would be sent, without sending it. With
+// "-want-matches", it fails if any alert does not match that many emails,
+// which turns a directory of fixtures into a regression test for alert
+// definitions. An error is returned if the flags are invalid, the alert
+// configuration or fixtures cannot be loaded, or any alert fails or does not
+// match the wanted number of emails.
+func replayCLI(args []string) error {
+	var app cliEnv
+	var alertName, fixturesDir, now string
+	var wantMatches int
+
+	fs := app.flagSet("replay")
+	fs.StringVar(
+		&alertName,
+		"alert",
+		"",
+		"the name (or gmail query) of the alert to replay (all alerts if empty)")
+	fs.StringVar(
+		&fixturesDir,
+		"fixtures",
+		"",
+		"the directory of the .eml or .json email fixtures to replay the alerts against")
+	fs.StringVar(
+		&now,
+		"now",
+		"",
+		`the time to replay the alerts at, like "2023-03-01T12:00:00Z", which relative dates like "newer_than:2d" are evaluated against (the current time if empty)`)
+	fs.IntVar(
+		&wantMatches,
+		"want-matches",
+		-1,
+		"fail if any replayed alert does not match this number of emails (not checked if negative)")
+	if err := app.parse(fs, args); err != nil {
+		return err
+	}
+	if fixturesDir == "" {
+		fs.Usage()
+		return errors.New(`command line flag "-fixtures" must be non-empty`)
+	}
+	at := time.Now()
+	if now != "" {
+		var err error
+		if at, err = time.Parse(time.RFC3339, now); err != nil {
+			fs.Usage()
+			return fmt.Errorf(`command line flag "-now" must be an RFC 3339 time, got %q`, now)
+		}
+	}
+
+	_, alertCfg, err := app.profileConfig()
+	if err != nil {
+		return err
+	}
+	selected, err := selectAlerts(alertCfg.Alerts, alertName)
+	if err != nil {
+		return err
+	}
+	fixtures, err := loadReplayFixtures(fixturesDir)
+	if err != nil {
+		return err
+	}
+
+	var logger Logger = log.New(io.Discard, "", 0)
+	if app.debug {
+		logger = newInfoLogger()
+	}
+
+	return replayAlerts(replayMatcher{fixtures: fixtures, now: at}, selected, at, wantMatches, logger, os.Stdout)
+}
+
+// replayAlerts accepts a replayMatcher, a slice of Alerts, the time to
+// replay them at, the number of emails each alert must match or a negative
+// number, a Logger, and an io.Writer, processes the Alerts against the
+// fixtures of the replayMatcher, and writes the matches and notification of
+// each Alert to the io.Writer. An error is returned if any Alert cannot be
+// replayed, fails, or does not match the wanted number of emails.
+func replayAlerts(r replayMatcher, alerts []Alert, at time.Time, wantMatches int, logger Logger, w io.Writer) error {
+	for _, alt := range alerts {
+		if alt.GmailQuery == "" && alt.Queries == nil {
+			return fmt.Errorf("alert %q has no gmail query to replay", alt.key())
+		}
+	}
+
+	summary, notified, err := dryRunAlerts(r, alerts, at, logger)
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	for _, res := range summary.Results {
+		fmt.Fprintf(w, "%s: %d matches\n", res.Alert, res.Matches)
+		if res.Err != nil {
+			fmt.Fprintf(w, "  FAIL %v\n", res.Err)
+			failed++
+			continue
+		}
+		if alt, ok := notified[res.Alert]; ok {
+			fmt.Fprintf(w, "  notification %q: %s\n", alt.PushoverTitle, alt.PushoverMsg)
+		} else {
+			fmt.Fprintln(w, "  no notification")
+		}
+		if wantMatches >= 0 && res.Matches != wantMatches {
+			fmt.Fprintf(w, "  FAIL want %d matches\n", wantMatches)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d replayed alerts failed", failed, len(summary.Results))
+	}
+
+	return nil
+}
@@ -0,0 +1,136 @@
+package gmailalert
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadReplayFixtures(t *testing.T) {
+	t.Parallel()
+
+	t.Run("eml and json fixtures are loaded", func(t *testing.T) {
+		dir := t.TempDir()
+		eml := "From: billing@example.com\r\nSubject: Your bill\r\nDate: Wed, 1 Mar 2023 12:00:00 +0000\r\n" +
+			"X-Gmail-Labels: Inbox,Opened,Bills\r\n\r\nPay up.\r\n"
+		json := `{"ID": "b", "Subject": "Stored", "Labels": ["SPAM"], "Raw": "Subject: Raw\r\n\r\nHello.\r\n"}`
+		files := map[string]string{"a.eml": eml, "b.json": json, "notes.txt": "ignored"}
+		for name, content := range files {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		fixtures, err := loadReplayFixtures(dir)
+		if err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		if len(fixtures) != 2 {
+			t.Fatalf("want 2 fixtures, got %d", len(fixtures))
+		}
+		a, b := fixtures[0], fixtures[1]
+		if a.msg.ID != "a" || a.msg.Subject != "Your bill" || a.msg.Snippet != "Pay up." || a.msg.Date.IsZero() {
+			t.Errorf("got unexpected eml fixture message %+v", a.msg)
+		}
+		if !a.hasLabel("INBOX") || !a.hasLabel("Bills") || a.hasLabel("OPENED") {
+			t.Errorf("got unexpected eml fixture labels %v", a.labels)
+		}
+		if b.msg.ID != "b" || b.msg.Subject != "Stored" || !b.hasLabel("SPAM") {
+			t.Errorf("got unexpected json fixture %+v with labels %v", b.msg, b.labels)
+		}
+	})
+
+	t.Run("directory without fixtures returns an error", func(t *testing.T) {
+		if _, err := loadReplayFixtures(t.TempDir()); err == nil {
+			t.Fatal("wanted an error but did not get one")
+		}
+	})
+
+	t.Run("invalid json fixture returns an error", func(t *testing.T) {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "a.json"), []byte("{"), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := loadReplayFixtures(dir); err == nil {
+			t.Fatal("wanted an error but did not get one")
+		}
+	})
+}
+
+func TestReplayAlerts(t *testing.T) {
+	t.Parallel()
+
+	at := time.Date(2023, 3, 2, 12, 0, 0, 0, time.UTC)
+	var fixtures []*replayFixture
+	for _, id := range []string{"a", "b"} {
+		raw := "From: billing@example.com\r\nSubject: Bill " + id + "\r\nDate: Wed, 1 Mar 2023 12:00:00 +0000\r\n\r\nPay up.\r\n"
+		f, err := newReplayFixture(replayedMessage{exportedMessage: exportedMessage{Message: Message{ID: id}, Raw: raw}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		fixtures = append(fixtures, f)
+	}
+	r := replayMatcher{fixtures: fixtures, now: at}
+	logger := log.New(io.Discard, "", 0)
+	bills := Alert{Name: "bills", GmailQuery: "from:billing newer_than:2d", PushoverTitle: "Bill Due!"}
+	none := Alert{Name: "none", GmailQuery: "subject:invoice", PushoverTitle: "Invoice!"}
+
+	testCases := map[string]struct {
+		alerts      []Alert
+		wantMatches int
+		wantOutput  []string
+		errExpected bool
+	}{
+		"Matching alert prints the notification it would send": {
+			alerts:      []Alert{bills},
+			wantMatches: 2,
+			wantOutput:  []string{"bills: 2 matches", `notification "Bill Due!": Found 2 emails`},
+		},
+		"Alert without matches prints no notification": {
+			alerts:      []Alert{none},
+			wantMatches: -1,
+			wantOutput:  []string{"none: 0 matches", "no notification"},
+		},
+		"Unexpected number of matches returns error": {
+			alerts:      []Alert{bills, none},
+			wantMatches: 2,
+			wantOutput:  []string{"FAIL want 2 matches"},
+			errExpected: true,
+		},
+		"Query that cannot be evaluated offline returns error": {
+			alerts:      []Alert{{Name: "snoozed", GmailQuery: "is:snoozed", PushoverTitle: "Snoozed!"}},
+			wantMatches: -1,
+			wantOutput:  []string{"FAIL"},
+			errExpected: true,
+		},
+		"Alert without gmail query returns error": {
+			alerts:      []Alert{{Name: "unread", UnreadAbove: 1}},
+			wantMatches: -1,
+			errExpected: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+
+			err := replayAlerts(r, tc.alerts, at, tc.wantMatches, logger, out)
+			errReceived := err != nil
+			if tc.errExpected != errReceived {
+				t.Fatalf("replayAlerts returned unexpected error status: %v", err)
+			}
+			for _, want := range tc.wantOutput {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("want output to contain %q, got:\n%s", want, out.String())
+				}
+			}
+		})
+	}
+}
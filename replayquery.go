@@ -0,0 +1,350 @@
+package gmailalert
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// queryPredicate reports whether a replayed email matches part of a Gmail
+// query.
+type queryPredicate func(f *replayFixture) bool
+
+// queryParser parses a Gmail query into a queryPredicate evaluated against
+// replayed emails, for replaying alerts offline. It understands the query
+// syntax described at https://support.google.com/mail/answer/7190?hl=en:
+// terms side by side must all match, "OR" or "|" between terms and terms in
+// braces need any to match, "-" negates a term, parentheses group terms, and
+// an operator followed by a group, like "from:(a OR b)", applies to every
+// term in the group. Words and phrases are searched in the headers and the
+// text of an email, which is looser than Gmail's word matching.
+type queryParser struct {
+	tokens []string
+	pos    int
+	now    time.Time
+	// The operator applying to the words of the group being parsed, if any.
+	field string
+	// Whether the query asks for emails in spam or trash.
+	spamTrash bool
+}
+
+// parseReplayQuery returns the queryPredicate of the given Gmail query,
+// evaluating relative dates like "newer_than:2d" against the given time.
+// Like Gmail, the predicate does not match emails in spam or trash unless
+// the query asks for them. An error is returned if the query is malformed or
+// uses an operator that cannot be evaluated offline, like "is:snoozed".
+func parseReplayQuery(query string, now time.Time) (queryPredicate, error) {
+	p := &queryParser{tokens: tokenizeQuery(query), now: now}
+	pred, err := p.sequence("", false)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("query has an unexpected %q", p.tokens[p.pos])
+	}
+	if p.spamTrash {
+		return pred, nil
+	}
+
+	return func(f *replayFixture) bool {
+		return !f.hasLabel("SPAM") && !f.hasLabel("TRASH") && pred(f)
+	}, nil
+}
+
+// tokenizeQuery splits the given Gmail query into parentheses, braces,
+// negations, and terms, keeping double-quoted text together. An operator
+// whose value is a group, like "from:(", is a single token.
+func tokenizeQuery(query string) []string {
+	var tokens []string
+	var b strings.Builder
+	var quoted bool
+	flush := func() {
+		if b.Len() > 0 {
+			tokens = append(tokens, b.String())
+			b.Reset()
+		}
+	}
+
+	for _, r := range query {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			b.WriteRune(r)
+		case quoted:
+			b.WriteRune(r)
+		case (r == '(' || r == '{') && strings.HasSuffix(b.String(), ":"):
+			b.WriteRune(r)
+			flush()
+		case unicode.IsSpace(r):
+			flush()
+		case strings.ContainsRune("(){}", r):
+			flush()
+			tokens = append(tokens, string(r))
+		case r == '-' && b.Len() == 0:
+			tokens = append(tokens, "-")
+		default:
+			b.WriteRune(r)
+		}
+	}
+	flush()
+
+	return tokens
+}
+
+// sequence parses terms up to the given closing token, or up to the end of
+// the query if it is empty, and returns a queryPredicate matching if any of
+// the terms match when anyOf is set, or if all of them match otherwise. As
+// in Gmail, "OR" binds tighter than terms side by side, so "a b OR c" means
+// "a (b OR c)".
+func (p *queryParser) sequence(closing string, anyOf bool) (queryPredicate, error) {
+	var terms []queryPredicate
+	var or bool
+	for p.pos < len(p.tokens) && p.tokens[p.pos] != closing {
+		switch tok := p.tokens[p.pos]; tok {
+		case "OR", "|":
+			if len(terms) == 0 || or {
+				return nil, fmt.Errorf("query has an %q without a term before it", tok)
+			}
+			or = true
+			p.pos++
+		case "AND":
+			p.pos++
+		default:
+			term, err := p.unary()
+			if err != nil {
+				return nil, err
+			}
+			if or {
+				left := terms[len(terms)-1]
+				terms[len(terms)-1] = func(f *replayFixture) bool { return left(f) || term(f) }
+				or = false
+				continue
+			}
+			terms = append(terms, term)
+		}
+	}
+	if closing != "" {
+		if p.pos == len(p.tokens) {
+			return nil, fmt.Errorf("query has a group without a closing %q", closing)
+		}
+		p.pos++
+	}
+	if len(terms) == 0 || or {
+		return nil, fmt.Errorf("query has an empty group or a trailing OR")
+	}
+
+	return func(f *replayFixture) bool { return matchTerms(terms, f, anyOf) }, nil
+}
+
+// matchTerms reports whether any of the given terms match the given email if
+// anyOf is set, or whether all of them do otherwise.
+func matchTerms(terms []queryPredicate, f *replayFixture, anyOf bool) bool {
+	for _, term := range terms {
+		if term(f) == anyOf {
+			return anyOf
+		}
+	}
+
+	return !anyOf
+}
+
+// unary parses a single, possibly negated, term or group.
+func (p *queryParser) unary() (queryPredicate, error) {
+	tok := p.tokens[p.pos]
+	p.pos++
+
+	switch {
+	case tok == "-":
+		if p.pos == len(p.tokens) {
+			return nil, fmt.Errorf(`query ends with a "-"`)
+		}
+		term, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(f *replayFixture) bool { return !term(f) }, nil
+	case tok == "(":
+		return p.sequence(")", false)
+	case tok == "{":
+		return p.sequence("}", true)
+	case tok == ")" || tok == "}":
+		return nil, fmt.Errorf("query has a %q without a matching opening", tok)
+	case strings.HasSuffix(tok, ":(") || strings.HasSuffix(tok, ":{"):
+		field := p.field
+		p.field = tok[:len(tok)-2]
+		defer func() { p.field = field }()
+		if tok[len(tok)-1] == '{' {
+			return p.sequence("}", true)
+		}
+		return p.sequence(")", false)
+	}
+
+	if op, value, ok := strings.Cut(tok, ":"); ok && !strings.HasPrefix(tok, `"`) && queryOperatorName.MatchString(op) {
+		return p.operator(strings.ToLower(op), unquoteTerm(value))
+	}
+	if p.field != "" {
+		return p.operator(p.field, unquoteTerm(tok))
+	}
+	text := strings.ToLower(unquoteTerm(tok))
+
+	return func(f *replayFixture) bool { return strings.Contains(f.searchText, text) }, nil
+}
+
+// unquoteTerm returns the given term without its surrounding double quotes.
+func unquoteTerm(term string) string {
+	return strings.Trim(term, `"`)
+}
+
+// replaySize matches the value of a size operator, like "10k" or "2M".
+var replaySize = regexp.MustCompile(`^(?i)(\d+)([km]?)$`)
+
+// operator returns the queryPredicate of the given operator with the given
+// value. An error is returned if the operator or its value cannot be
+// evaluated offline.
+func (p *queryParser) operator(op, value string) (queryPredicate, error) {
+	lower := strings.ToLower(value)
+	header := func(name string) queryPredicate {
+		return func(f *replayFixture) bool {
+			return strings.Contains(strings.ToLower(f.header.Get(name)), lower)
+		}
+	}
+	label := func(id string) queryPredicate {
+		return func(f *replayFixture) bool { return f.hasLabel(id) }
+	}
+
+	switch op {
+	case "from", "to", "cc", "bcc", "subject":
+		return header(strings.ToUpper(op[:1]) + op[1:]), nil
+	case "deliveredto":
+		return header("Delivered-To"), nil
+	case "list":
+		return header("List-Id"), nil
+	case "rfc822msgid":
+		return header("Message-Id"), nil
+	case "filename":
+		return func(f *replayFixture) bool {
+			for _, name := range f.attachments {
+				if strings.Contains(strings.ToLower(name), lower) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	case "label":
+		name := strings.NewReplacer("-", " ", "/", " ").Replace(lower)
+		return func(f *replayFixture) bool {
+			for _, l := range f.labels {
+				if strings.NewReplacer("-", " ", "/", " ").Replace(strings.ToLower(l)) == name {
+					return true
+				}
+			}
+			return false
+		}, nil
+	case "category":
+		if id, ok := categoryLabels[lower]; ok {
+			return label(id), nil
+		}
+	case "has":
+		switch lower {
+		case "attachment":
+			return func(f *replayFixture) bool { return len(f.attachments) > 0 }, nil
+		case "userlabels", "nouserlabels":
+			return func(f *replayFixture) bool {
+				for _, l := range f.labels {
+					if !systemLabel(l) {
+						return lower == "userlabels"
+					}
+				}
+				return lower == "nouserlabels"
+			}, nil
+		}
+	case "is":
+		switch lower {
+		case "unread", "starred", "important":
+			return label(strings.ToUpper(lower)), nil
+		case "read":
+			return func(f *replayFixture) bool { return !f.hasLabel("UNREAD") }, nil
+		}
+	case "in":
+		switch lower {
+		case "anywhere":
+			p.spamTrash = true
+			return func(*replayFixture) bool { return true }, nil
+		case "spam", "trash":
+			p.spamTrash = true
+			return label(strings.ToUpper(lower)), nil
+		case "inbox", "sent", "starred", "important":
+			return label(strings.ToUpper(lower)), nil
+		case "drafts":
+			return label("DRAFT"), nil
+		}
+	case "after", "newer", "before", "older":
+		t, err := parseQueryDate(value)
+		if err != nil {
+			return nil, err
+		}
+		if op == "after" || op == "newer" {
+			return func(f *replayFixture) bool { return !f.msg.Date.Before(t) }, nil
+		}
+		return func(f *replayFixture) bool { return f.msg.Date.Before(t) }, nil
+	case "newer_than", "older_than":
+		if !queryRelativeDateValue.MatchString(lower) {
+			break
+		}
+		n, _ := strconv.Atoi(lower[:len(lower)-1])
+		t := map[byte]time.Time{
+			'd': p.now.AddDate(0, 0, -n),
+			'm': p.now.AddDate(0, -n, 0),
+			'y': p.now.AddDate(-n, 0, 0),
+		}[lower[len(lower)-1]]
+		if op == "newer_than" {
+			return func(f *replayFixture) bool { return f.msg.Date.After(t) }, nil
+		}
+		return func(f *replayFixture) bool { return f.msg.Date.Before(t) }, nil
+	case "size", "larger", "smaller":
+		m := replaySize.FindStringSubmatch(value)
+		if m == nil {
+			break
+		}
+		n, _ := strconv.Atoi(m[1])
+		n *= map[string]int{"": 1, "k": 1 << 10, "m": 1 << 20}[strings.ToLower(m[2])]
+		if op == "smaller" {
+			return func(f *replayFixture) bool { return len(f.raw) < n }, nil
+		}
+		return func(f *replayFixture) bool { return len(f.raw) > n }, nil
+	default:
+		return nil, fmt.Errorf("operator %q cannot be evaluated offline", op)
+	}
+
+	return nil, fmt.Errorf("%s:%s cannot be evaluated offline", op, value)
+}
+
+// parseQueryDate returns the time of the given value of a date operator,
+// like "2023/01/31" or a number of seconds since the Unix epoch. An error is
+// returned if the value is not a date.
+func parseQueryDate(value string) (time.Time, error) {
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	for _, layout := range []string{"2006/1/2", "2006-1-2", "1/2/2006"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("date %q must be like 2023/01/31 or a unix time", value)
+}
+
+// systemLabel reports whether the given label ID is that of a Gmail system
+// label, like "INBOX" or "CATEGORY_SOCIAL", rather than a user label.
+func systemLabel(id string) bool {
+	switch id {
+	case "INBOX", "SPAM", "TRASH", "UNREAD", "STARRED", "IMPORTANT", "SENT", "DRAFT", "CHAT":
+		return true
+	}
+
+	return strings.HasPrefix(id, "CATEGORY_")
+}
@@ -0,0 +1,136 @@
+package gmailalert
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseReplayQuery(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2023, 3, 10, 12, 0, 0, 0, time.UTC)
+	raw := "From: Billing <billing@example.com>\r\n" +
+		"To: me@example.com\r\n" +
+		"Subject: Your bill is due\r\n" +
+		"Date: Wed, 1 Mar 2023 12:00:00 +0000\r\n" +
+		"X-Gmail-Labels: Inbox,Unread,Category Updates,Bills\r\n" +
+		"\r\n" +
+		"Please pay 42 dollars.\r\n"
+	f, err := newReplayFixture(replayedMessage{exportedMessage: exportedMessage{Message: Message{ID: "a"}, Raw: raw}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	spam, err := newReplayFixture(replayedMessage{
+		exportedMessage: exportedMessage{Message: Message{ID: "b"}, Raw: raw},
+		Labels:          []string{"SPAM"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := map[string]struct {
+		query       string
+		fixture     *replayFixture
+		want        bool
+		errExpected bool
+	}{
+		"Word in body matches": {
+			query:   "pay",
+			fixture: f,
+			want:    true,
+		},
+		"Quoted phrase matches": {
+			query:   `"bill is due"`,
+			fixture: f,
+			want:    true,
+		},
+		"Header operators match": {
+			query:   "from:billing@example.com subject:bill to:me",
+			fixture: f,
+			want:    true,
+		},
+		"Terms side by side must all match": {
+			query:   "from:billing subject:invoice",
+			fixture: f,
+			want:    false,
+		},
+		"OR needs any term to match": {
+			query:   "subject:invoice OR subject:bill",
+			fixture: f,
+			want:    true,
+		},
+		"Braces need any term to match": {
+			query:   "{subject:invoice subject:bill}",
+			fixture: f,
+			want:    true,
+		},
+		"Negation excludes matches": {
+			query:   "from:billing -subject:bill",
+			fixture: f,
+			want:    false,
+		},
+		"Operator applies to a group": {
+			query:   "subject:(due bill)",
+			fixture: f,
+			want:    true,
+		},
+		"Labels and categories match": {
+			query:   "is:unread in:inbox category:updates label:bills",
+			fixture: f,
+			want:    true,
+		},
+		"Read email does not match is:read when unread": {
+			query:   "is:read",
+			fixture: f,
+			want:    false,
+		},
+		"Relative dates are evaluated against now": {
+			query:   "newer_than:10d -newer_than:2d",
+			fixture: f,
+			want:    true,
+		},
+		"Absolute dates match": {
+			query:   "after:2023/02/28 before:2023/03/02",
+			fixture: f,
+			want:    true,
+		},
+		"Spam is excluded by default": {
+			query:   "from:billing",
+			fixture: spam,
+			want:    false,
+		},
+		"Spam matches in:anywhere": {
+			query:   "from:billing in:anywhere",
+			fixture: spam,
+			want:    true,
+		},
+		"Operator that cannot be evaluated offline returns error": {
+			query:       "is:snoozed",
+			errExpected: true,
+		},
+		"Unbalanced parentheses return error": {
+			query:       "(from:billing",
+			errExpected: true,
+		},
+		"Trailing OR returns error": {
+			query:       "from:billing OR",
+			errExpected: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			pred, err := parseReplayQuery(tc.query, now)
+			errReceived := err != nil
+			if tc.errExpected != errReceived {
+				t.Fatalf("parseReplayQuery(%q) returned unexpected error status: %v", tc.query, err)
+			}
+			if tc.errExpected {
+				return
+			}
+			if got := pred(tc.fixture); tc.want != got {
+				t.Errorf("query %q: want %t, got %t", tc.query, tc.want, got)
+			}
+		})
+	}
+}
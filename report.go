@@ -0,0 +1,186 @@
+package gmailalert
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// report represents tabular output, like statistics or history records,
+// that can be rendered in several formats.
+type report struct {
+	// The title of the report, used as the heading of a Markdown summary.
+	title string
+	// The line describing what the report covers, written below the
+	// heading of a Markdown summary.
+	note string
+	// The names of the columns.
+	header []string
+	// The cells of every row, one per column.
+	rows [][]string
+}
+
+// write renders the receiver r to the given io.Writer in the given format:
+// "table" for aligned columns, "csv" for comma-separated values with a
+// header line, or "markdown" for a heading, the note, and a Markdown table.
+// An error is returned if the format is unknown or the report cannot be
+// written.
+func (r report) write(format string, w io.Writer) error {
+	switch format {
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		for _, row := range append([][]string{r.header}, r.rows...) {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		return tw.Flush()
+	case "csv":
+		cw := csv.NewWriter(w)
+		if err := cw.WriteAll(append([][]string{r.header}, r.rows...)); err != nil {
+			return fmt.Errorf("got error writing csv report: %v", err)
+		}
+		return nil
+	case "markdown":
+		var b strings.Builder
+		fmt.Fprintf(&b, "### %s\n\n", r.title)
+		if r.note != "" {
+			fmt.Fprintf(&b, "%s\n\n", r.note)
+		}
+		b.WriteString(markdownRow(r.header))
+		b.WriteString("|" + strings.Repeat(" --- |", len(r.header)) + "\n")
+		for _, row := range r.rows {
+			b.WriteString(markdownRow(row))
+		}
+		_, err := io.WriteString(w, b.String())
+		return err
+	}
+
+	return fmt.Errorf(`report format must be "table", "csv", or "markdown", got %q`, format)
+}
+
+// markdownRow returns the given cells as a row of a Markdown table, with
+// the characters that would break the table escaped.
+func markdownRow(cells []string) string {
+	escaped := make([]string, 0, len(cells))
+	for _, c := range cells {
+		c = strings.ReplaceAll(c, "|", `\|`)
+		escaped = append(escaped, strings.ReplaceAll(c, "\n", " "))
+	}
+
+	return "| " + strings.Join(escaped, " | ") + " |\n"
+}
+
+// windowNote returns the line describing the time window of a report, as
+// given to the "-window" flag.
+func windowNote(window time.Duration, now time.Time) string {
+	if window <= 0 {
+		return fmt.Sprintf("Whole history up to %s.", now.Format(time.RFC3339))
+	}
+
+	return fmt.Sprintf("From %s to %s.", now.Add(-window).Format(time.RFC3339), now.Format(time.RFC3339))
+}
+
+// historyCLI accepts the command line flags of the "history" subcommand,
+// which prints the records of the history file for the alert named by the
+// "-alert" flag, or for every alert if it is empty, over the time window
+// given by the "-window" flag, in the format given by the "-report-format"
+// flag. An error is returned if the flags are invalid or the alert
+// configuration or history file cannot be loaded.
+func historyCLI(args []string) error {
+	var app cliEnv
+	var alertName, format string
+	var window time.Duration
+
+	fs := app.flagSet("history")
+	fs.StringVar(
+		&alertName,
+		"alert",
+		"",
+		"the name (or gmail query) of the alert to print the history of (all alerts if empty)")
+	fs.DurationVar(
+		&window,
+		"window",
+		0,
+		"how far back from now to print the history, like 168h (the whole history if 0)")
+	fs.StringVar(
+		&format,
+		"report-format",
+		"table",
+		`the output format, one of "table", "csv", or "markdown"`)
+	if err := app.parse(fs, args); err != nil {
+		return err
+	}
+	if app.historyFile == "" {
+		fs.Usage()
+		return errors.New(`command line flag "-history-file" must be non-empty`)
+	}
+
+	app, _, err := app.profileConfig()
+	if err != nil {
+		return err
+	}
+	history, err := NewHistory(app.historyFile)
+	if err != nil {
+		return err
+	}
+	recs, err := history.Records()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	return historyReport(windowRecords(recs, alertName, window, now), windowNote(window, now)).write(format, os.Stdout)
+}
+
+// windowRecords returns the given HistoryRecords of the alert with the given
+// name, or of every alert if it is empty, that are within the given window
+// before now, or not after now if the window is zero.
+func windowRecords(recs []HistoryRecord, alertName string, window time.Duration, now time.Time) []HistoryRecord {
+	var from time.Time
+	if window > 0 {
+		from = now.Add(-window)
+	}
+
+	var selected []HistoryRecord
+	for _, rec := range recs {
+		if (alertName != "" && rec.Alert != alertName) || rec.Time.Before(from) || rec.Time.After(now) {
+			continue
+		}
+		selected = append(selected, rec)
+	}
+
+	return selected
+}
+
+// historyReport returns a report with a row for each of the given
+// HistoryRecords, described by the given note.
+func historyReport(recs []HistoryRecord, note string) report {
+	r := report{
+		title:  "gmailalert history",
+		note:   note,
+		header: []string{"TIME", "ALERT", "EVAL ID", "MATCHES", "OUTCOME", "ERROR"},
+	}
+	for _, rec := range recs {
+		outcome := "none"
+		switch {
+		case rec.Backfill:
+			outcome = "backfilled"
+		case rec.Error != "":
+			outcome = "failed"
+		case rec.Notified:
+			outcome = "notified"
+		case rec.Suppressed:
+			outcome = "suppressed"
+		}
+		r.rows = append(r.rows, []string{
+			rec.Time.Format(time.RFC3339), rec.Alert, rec.EvalID, strconv.Itoa(rec.Matches), outcome, rec.Error,
+		})
+	}
+
+	return r
+}
@@ -0,0 +1,82 @@
+package gmailalert
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestReportWrite(t *testing.T) {
+	t.Parallel()
+
+	r := report{
+		title:  "gmailalert statistics",
+		note:   "Whole history.",
+		header: []string{"ALERT", "TOP SENDERS"},
+		rows:   [][]string{{"Bill Due", "billing@bank.com (3), alerts@bank.com (1)"}, {"a|b", ""}},
+	}
+	testCases := map[string]struct {
+		format      string
+		want        string
+		errExpected bool
+	}{
+		"CSV format quotes cells with commas": {
+			format: "csv",
+			want: "ALERT,TOP SENDERS\n" +
+				"Bill Due,\"billing@bank.com (3), alerts@bank.com (1)\"\n" +
+				"a|b,\n",
+		},
+		"Markdown format writes a heading, the note, and a table": {
+			format: "markdown",
+			want: "### gmailalert statistics\n\n" +
+				"Whole history.\n\n" +
+				"| ALERT | TOP SENDERS |\n" +
+				"| --- | --- |\n" +
+				"| Bill Due | billing@bank.com (3), alerts@bank.com (1) |\n" +
+				"| a\\|b |  |\n",
+		},
+		"Unknown format returns an error": {
+			format:      "html",
+			errExpected: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := r.write(tc.format, &buf)
+			errReceived := err != nil
+
+			if tc.errExpected != errReceived {
+				t.Fatalf("got unexpected error status, got error: %v", err)
+			}
+			if got := buf.String(); !tc.errExpected && tc.want != got {
+				t.Errorf("want != got\ndiff=%s", cmp.Diff(tc.want, got))
+			}
+		})
+	}
+}
+
+func TestHistoryReport(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2023, 3, 11, 0, 0, 0, 0, time.UTC)
+	recs := []HistoryRecord{
+		{Time: now.AddDate(0, 0, -30), Alert: "Bill Due", Matches: 4, Backfill: true},
+		{Time: now.AddDate(0, 0, -2), Alert: "Bill Due", EvalID: "run1.0", Matches: 2, Notified: true},
+		{Time: now.AddDate(0, 0, -1), Alert: "Bill Due", EvalID: "run2.0", Error: "quota exceeded"},
+		{Time: now.AddDate(0, 0, -1), Alert: "Orders", EvalID: "run2.1"},
+	}
+
+	got := historyReport(windowRecords(recs, "Bill Due", 7*24*time.Hour, now), "").rows
+
+	want := [][]string{
+		{"2023-03-09T00:00:00Z", "Bill Due", "run1.0", "2", "notified", ""},
+		{"2023-03-10T00:00:00Z", "Bill Due", "run2.0", "0", "failed", "quota exceeded"},
+	}
+	if !cmp.Equal(want, got) {
+		t.Errorf("want != got\ndiff=%s", cmp.Diff(want, got))
+	}
+}
@@ -0,0 +1,188 @@
+package gmailalert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// The defaults and limits of a ScriptConfig.
+const (
+	defaultScriptTimeout = 5 * time.Second
+	maxScriptOutputBytes = 64 << 10
+)
+
+// ScriptConfig represents an external command hook run for every alert
+// with matches, which decides whether the alert is notified and can change
+// the title, message, and recipients of its notification. The command reads
+// a JSON description of the alert and its matching emails from stdin and
+// writes a JSON object with its decision to stdout. It is not sandboxed: it
+// runs with the permissions of gmailalert and an empty environment, except
+// for PATH, under a time limit and an optional memory limit.
+type ScriptConfig struct {
+	// The executable and its arguments, like ["python3", "route.py"].
+	Command []string `json:"command"`
+	// How long the command may run, as a duration like "2s". Defaults to
+	// 5s.
+	Timeout string `json:"timeout"`
+	// The maximum virtual memory of the command in megabytes, or 0 for no
+	// limit. Runtimes reserving address space up front, like node or the
+	// JVM, need several gigabytes. It is ignored on macOS and on platforms
+	// other than Unix, which do not support it.
+	MaxMemoryMB int `json:"maxmemorymb"`
+}
+
+// ok returns an error if the ScriptConfig has no command, an invalid
+// timeout, or a negative memory limit.
+func (c ScriptConfig) ok() error {
+	if len(c.Command) == 0 || c.Command[0] == "" {
+		return errors.New("script command must not be empty")
+	}
+	if _, err := parsePositiveDuration("script timeout", c.Timeout, defaultScriptTimeout); err != nil {
+		return err
+	}
+	if c.MaxMemoryMB < 0 {
+		return fmt.Errorf("script memory limit must not be negative, got %d", c.MaxMemoryMB)
+	}
+
+	return nil
+}
+
+// scriptEmail represents a matching email in the input of a script. Its
+// details are empty unless they were fetched while evaluating the alert,
+// like for alerts with a max age.
+type scriptEmail struct {
+	ID      string `json:"id"`
+	From    string `json:"from,omitempty"`
+	Subject string `json:"subject,omitempty"`
+	Date    string `json:"date,omitempty"`
+}
+
+// scriptInput represents the JSON object a script reads from stdin.
+type scriptInput struct {
+	Alert      string            `json:"alert"`
+	Title      string            `json:"title"`
+	Message    string            `json:"message"`
+	Matches    int               `json:"matches"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Recipients []string          `json:"recipients"`
+	Emails     []scriptEmail     `json:"emails"`
+}
+
+// scriptOutput represents the JSON object a script writes to stdout. Fields
+// left out keep the alert unchanged.
+type scriptOutput struct {
+	// Whether the alert is notified.
+	Notify *bool `json:"notify"`
+	// The title replacing that of the notification.
+	Title string `json:"title"`
+	// The message replacing that of the notification.
+	Message string `json:"message"`
+	// The Pushover recipient keys replacing those of the alert.
+	Recipients []string `json:"recipients"`
+}
+
+// limitedBuffer represents a bytes.Buffer failing writes beyond a maximum
+// number of bytes, which bounds the output read from a script.
+type limitedBuffer struct {
+	bytes.Buffer
+	max int
+}
+
+// Write appends the given bytes to the limitedBuffer receiver b. An error is
+// returned if the buffer would grow beyond its maximum.
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > b.max {
+		return 0, fmt.Errorf("output exceeds %d bytes", b.max)
+	}
+
+	return b.Buffer.Write(p)
+}
+
+// runScript runs the script of the given Alert with the given matching
+// messages and applies its output to the Alert. It returns false if the
+// script decided that the Alert is not notified. An error is returned if the
+// script fails, runs out of time or memory, or writes invalid output.
+func (a Alerter) runScript(alt *Alert, matches []Message) (bool, error) {
+	cfg := alt.Script
+	timeout, err := parsePositiveDuration("script timeout", cfg.Timeout, defaultScriptTimeout)
+	if err != nil {
+		return false, err
+	}
+	in := scriptInput{
+		Alert:      alt.key(),
+		Title:      alt.PushoverTitle,
+		Message:    alt.PushoverMsg,
+		Matches:    alt.Matches,
+		Labels:     alt.Labels,
+		Recipients: alt.Recipients(),
+		Emails:     make([]scriptEmail, 0, len(matches)),
+	}
+	for _, m := range matches {
+		email := scriptEmail{ID: m.ID, From: m.From, Subject: m.Subject}
+		if !m.Date.IsZero() {
+			email.Date = m.Date.Format(time.RFC3339)
+		}
+		in.Emails = append(in.Emails, email)
+	}
+	stdin, err := json.Marshal(in)
+	if err != nil {
+		return false, fmt.Errorf("got error json-encoding script input: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := scriptCommand(ctx, cfg.Command, cfg.MaxMemoryMB)
+	cmd.Env = []string{"PATH=" + os.Getenv("PATH")}
+	cmd.Stdin = bytes.NewReader(stdin)
+	stdout := &limitedBuffer{max: maxScriptOutputBytes}
+	stderr := &limitedBuffer{max: maxScriptOutputBytes}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	// Stop waiting for the output of processes the script started once it
+	// was killed.
+	cmd.WaitDelay = time.Second
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return false, fmt.Errorf("script %q did not finish within %s", strings.Join(cfg.Command, " "), timeout)
+		}
+		return false, fmt.Errorf("got error running script %q: %v: %s",
+			strings.Join(cfg.Command, " "), err, strings.TrimSpace(stderr.String()))
+	}
+
+	var out scriptOutput
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		return false, fmt.Errorf("got error decoding output of script %q: %v", strings.Join(cfg.Command, " "), err)
+	}
+	if out.Notify != nil && !*out.Notify {
+		return false, nil
+	}
+	if out.Title != "" {
+		alt.PushoverTitle = out.Title
+	}
+	if out.Message != "" {
+		alt.PushoverMsg = out.Message
+	}
+	if out.Recipients != nil {
+		if len(out.Recipients) == 0 {
+			return false, fmt.Errorf("script %q must not remove every recipient", strings.Join(cfg.Command, " "))
+		}
+		alt.PushoverTarget, alt.PushoverTargets = "", out.Recipients
+	}
+
+	return true, nil
+}
+
+// scriptCommand returns the command running the given script, given as its
+// executable and arguments, until the given context is done, with its
+// memory limited to the given number of megabytes, unless it is 0, where
+// supported.
+func scriptCommand(ctx context.Context, command []string, maxMemoryMB int) *exec.Cmd {
+	name, args := limitMemory(command, maxMemoryMB)
+	return exec.CommandContext(ctx, name, args...)
+}
@@ -0,0 +1,150 @@
+package gmailalert
+
+import (
+	"io"
+	"log"
+	"runtime"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRunScript(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("scripts are run with /bin/sh")
+	}
+	testCases := map[string]struct {
+		script         string
+		timeout        string
+		maxMemoryMB    int
+		wantNotify     bool
+		wantTitle      string
+		wantMsg        string
+		wantRecipients []string
+		errExpected    bool
+	}{
+		"Empty output keeps alert": {
+			script:         `cat >/dev/null; echo '{}'`,
+			wantNotify:     true,
+			wantTitle:      "Bank",
+			wantMsg:        "Found 2 emails",
+			wantRecipients: []string{"user"},
+		},
+		"Script runs under memory limit": {
+			script:         `cat >/dev/null; echo '{}'`,
+			maxMemoryMB:    512,
+			wantNotify:     true,
+			wantTitle:      "Bank",
+			wantMsg:        "Found 2 emails",
+			wantRecipients: []string{"user"},
+		},
+		"Output changes title, message, and recipients": {
+			script:         `cat >/dev/null; echo '{"title": "Urgent", "message": "Pay now", "recipients": ["oncall"]}'`,
+			wantNotify:     true,
+			wantTitle:      "Urgent",
+			wantMsg:        "Pay now",
+			wantRecipients: []string{"oncall"},
+		},
+		"Output decides not to notify": {
+			script: `cat >/dev/null; echo '{"notify": false}'`,
+		},
+		"Script reads alert from stdin": {
+			script:         `grep -q '"matches":2' && grep -q . ; echo '{"message": "read"}'`,
+			wantNotify:     true,
+			wantTitle:      "Bank",
+			wantMsg:        "read",
+			wantRecipients: []string{"user"},
+		},
+		"Failing script returns error": {
+			script:      `echo broken >&2; exit 1`,
+			errExpected: true,
+		},
+		"Invalid output returns error": {
+			script:      `echo not json`,
+			errExpected: true,
+		},
+		"Removing every recipient returns error": {
+			script:      `echo '{"recipients": []}'`,
+			errExpected: true,
+		},
+		"Script running too long returns error": {
+			script:      `sleep 5`,
+			timeout:     "100ms",
+			errExpected: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			a := Alerter{Logger: log.New(io.Discard, "", 0)}
+			alt := Alert{
+				Name:           "bank",
+				PushoverTitle:  "Bank",
+				PushoverMsg:    "Found 2 emails",
+				PushoverTarget: "user",
+				Matches:        2,
+				Script:         &ScriptConfig{Command: []string{"sh", "-c", tc.script}, Timeout: tc.timeout, MaxMemoryMB: tc.maxMemoryMB},
+			}
+
+			notify, err := a.runScript(&alt, []Message{{ID: "1"}, {ID: "2"}})
+			errReceived := err != nil
+
+			if tc.errExpected != errReceived {
+				t.Fatalf("runScript returned unexpected error status: %v", err)
+			}
+			if tc.errExpected {
+				return
+			}
+			if notify != tc.wantNotify {
+				t.Errorf("want notify %t, got %t", tc.wantNotify, notify)
+			}
+			if !tc.wantNotify {
+				return
+			}
+			if alt.PushoverTitle != tc.wantTitle || alt.PushoverMsg != tc.wantMsg {
+				t.Errorf("want title %q and message %q, got %q and %q", tc.wantTitle, tc.wantMsg, alt.PushoverTitle, alt.PushoverMsg)
+			}
+			if !cmp.Equal(tc.wantRecipients, alt.Recipients()) {
+				t.Error(cmp.Diff(tc.wantRecipients, alt.Recipients()))
+			}
+		})
+	}
+}
+
+func TestScriptConfigOK(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		cfg         ScriptConfig
+		errExpected bool
+	}{
+		"Command with defaults is valid": {
+			cfg: ScriptConfig{Command: []string{"./route"}},
+		},
+		"Empty command returns error": {
+			cfg:         ScriptConfig{},
+			errExpected: true,
+		},
+		"Invalid timeout returns error": {
+			cfg:         ScriptConfig{Command: []string{"./route"}, Timeout: "soon"},
+			errExpected: true,
+		},
+		"Negative memory limit returns error": {
+			cfg:         ScriptConfig{Command: []string{"./route"}, MaxMemoryMB: -1},
+			errExpected: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := tc.cfg.ok()
+			errReceived := err != nil
+
+			if tc.errExpected != errReceived {
+				t.Fatalf("ok() returned unexpected error status: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !unix || darwin
+
+package gmailalert
+
+// limitMemory returns the executable and arguments of the given command.
+// Memory limits are not supported on macOS, where ulimit -v fails, and on
+// platforms other than Unix.
+func limitMemory(command []string, _ int) (string, []string) {
+	return command[0], command[1:]
+}
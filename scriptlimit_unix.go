@@ -0,0 +1,17 @@
+//go:build unix && !darwin
+
+package gmailalert
+
+import "strconv"
+
+// limitMemory returns the executable and arguments running the given
+// command through the shell with its virtual memory limited to the given
+// number of megabytes, or the executable and arguments of the command if
+// the limit is 0.
+func limitMemory(command []string, maxMemoryMB int) (string, []string) {
+	if maxMemoryMB == 0 {
+		return command[0], command[1:]
+	}
+	args := []string{"-c", `ulimit -v "$1" && shift && exec "$@"`, "sh", strconv.Itoa(maxMemoryMB * 1024)}
+	return "/bin/sh", append(args, command...)
+}
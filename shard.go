@@ -0,0 +1,93 @@
+package gmailalert
+
+import (
+	"context"
+	"time"
+)
+
+// WithAlerterShards accepts a number of shards and returns a functional
+// option for making an Alerter's Poll split alerts into that many cohorts
+// and evaluate one cohort per cycle, instead of giving every alert an
+// adaptive interval of its own.
+func WithAlerterShards(n int) AlerterOption {
+	return func(a *Alerter) {
+		a.Shards = n
+	}
+}
+
+// cohort returns the cohort, between 0 and shards-1, of the given alert,
+// which is the i-th of the alerts. With SpreadHash, the cohort is derived
+// from a hash of the alert's name, so that an alert keeps its cohort when
+// other alerts are added or removed. Otherwise, alerts are dealt into the
+// cohorts in the order they are configured, which keeps the cohorts the
+// same size.
+func (s Spread) cohort(alt Alert, i, shards int) int {
+	if s == SpreadHash {
+		return int(s.phase(alt, i, 0) * float64(shards))
+	}
+
+	return i % shards
+}
+
+// pollShards processes the given alerts in the Alerter's Shards cohorts,
+// evaluating the next cohort every window divided by the number of shards,
+// so that every run queries a bounded share of the alerts and every alert
+// is evaluated at least once per window, until the given context is
+// cancelled. Alerts the Control requests to be evaluated now are processed
+// right away, without changing the rotation of the cohorts. It returns nil
+// once the context is cancelled.
+func (a Alerter) pollShards(ctx context.Context, alerts []Alert, window time.Duration) error {
+	cohorts := make([]int, len(alerts))
+	for i, alt := range alerts {
+		cohorts[i] = a.Spread.cohort(alt, i, a.Shards)
+	}
+	cycle := window / time.Duration(a.Shards)
+	var wake <-chan struct{}
+	if a.Control != nil {
+		a.Control.start(alerts)
+		wake = a.Control.wake
+	}
+
+	start := a.now()
+	turn := 0
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		var requested map[string]bool
+		if a.Control != nil {
+			requested = a.Control.takeRequests()
+		}
+		current := -1
+		if !start.Add(time.Duration(turn) * cycle).After(a.now()) {
+			current = turn % a.Shards
+			turn++
+		}
+		var due []int
+		for i := range alerts {
+			if cohorts[i] == current || requested[""] || requested[alerts[i].key()] {
+				due = append(due, i)
+			}
+		}
+		if len(due) > 0 {
+			batch := make([]Alert, len(due))
+			for j, i := range due {
+				batch[j] = alerts[i]
+			}
+			summary := a.run(batch)
+			if a.Control != nil {
+				next := make([]time.Time, len(due))
+				for j, i := range due {
+					wait := (cohorts[i] - turn%a.Shards + a.Shards) % a.Shards
+					next[j] = start.Add(time.Duration(turn+wait) * cycle)
+				}
+				a.Control.record(summary, next)
+			}
+		}
+
+		if err := a.sleep(ctx, start.Add(time.Duration(turn)*cycle), wake); err != nil {
+			return nil
+		}
+	}
+}
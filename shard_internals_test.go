@@ -0,0 +1,109 @@
+package gmailalert
+
+import (
+	"context"
+	"io"
+	"log"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSpreadCohort(t *testing.T) {
+	t.Parallel()
+
+	alerts := []Alert{{Name: "a"}, {Name: "b"}, {Name: "c"}, {Name: "d"}, {Name: "e"}}
+
+	t.Run("alerts are dealt into cohorts in order", func(t *testing.T) {
+		var got []int
+		for i, alt := range alerts {
+			got = append(got, SpreadEven.cohort(alt, i, 2))
+		}
+
+		want := []int{0, 1, 0, 1, 0}
+		if !cmp.Equal(want, got) {
+			t.Error(cmp.Diff(want, got))
+		}
+	})
+
+	t.Run("hashed cohort does not depend on the position of an alert", func(t *testing.T) {
+		for i, alt := range alerts {
+			got := SpreadHash.cohort(alt, i, 3)
+			if got < 0 || got >= 3 {
+				t.Errorf("want cohort of alert %q between 0 and 2, got %d", alt.Name, got)
+			}
+			if moved := SpreadHash.cohort(alt, i+7, 3); moved != got {
+				t.Errorf("want cohort %d of alert %q to be kept when it moves, got %d", got, alt.Name, moved)
+			}
+		}
+	})
+}
+
+func TestPollShardsRotatesCohorts(t *testing.T) {
+	t.Parallel()
+
+	rep := &batchReporter{}
+	a := Alerter{
+		Matcher:   fakePreviewFetcher{},
+		Notifier:  &recordingTestNotifier{},
+		Logger:    log.New(io.Discard, "", 0),
+		Reporters: []Reporter{rep},
+		Shards:    2,
+	}
+	alerts := []Alert{{Name: "a", GmailQuery: "a"}, {Name: "b", GmailQuery: "b"}, {Name: "c", GmailQuery: "c"}}
+	ctx, cancel := context.WithTimeout(context.Background(), 170*time.Millisecond)
+	defer cancel()
+
+	err := a.Poll(ctx, alerts, 10*time.Millisecond, 100*time.Millisecond)
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+
+	rep.mtx.Lock()
+	defer rep.mtx.Unlock()
+	want := [][]string{{"a", "c"}, {"b"}, {"a", "c"}}
+	if len(rep.batches) < len(want) {
+		t.Fatalf("want at least %d runs, got %v", len(want), rep.batches)
+	}
+	if !cmp.Equal(want, rep.batches[:len(want)]) {
+		t.Error(cmp.Diff(want, rep.batches[:len(want)]))
+	}
+}
+
+func TestPollWithNegativeShardsReturnsError(t *testing.T) {
+	t.Parallel()
+
+	a := Alerter{
+		Matcher:  fakePreviewFetcher{},
+		Notifier: &recordingTestNotifier{},
+		Logger:   log.New(io.Discard, "", 0),
+		Shards:   -1,
+	}
+
+	if err := a.Poll(context.Background(), nil, time.Minute, time.Hour); err == nil {
+		t.Error("expected an error but did not get one")
+	}
+}
+
+// batchReporter represents a test double type that implements the Reporter
+// interface and records the alerts of every run it is reported.
+type batchReporter struct {
+	mtx     sync.Mutex
+	batches [][]string
+}
+
+// Report records the names of the alerts of the given Summary and always
+// returns a nil error.
+func (r *batchReporter) Report(s Summary) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	var names []string
+	for _, res := range s.Results {
+		names = append(names, res.Alert)
+	}
+	r.batches = append(r.batches, names)
+
+	return nil
+}
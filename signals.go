@@ -0,0 +1,170 @@
+package gmailalert
+
+import (
+	"fmt"
+	"strings"
+)
+
+// categoryLabels maps the name of each Gmail inbox category to the ID of the
+// system label Gmail marks the emails in that category with.
+var categoryLabels = map[string]string{
+	"primary":    "CATEGORY_PERSONAL",
+	"social":     "CATEGORY_SOCIAL",
+	"promotions": "CATEGORY_PROMOTIONS",
+	"updates":    "CATEGORY_UPDATES",
+	"forums":     "CATEGORY_FORUMS",
+}
+
+// folderLabels maps the name of each Gmail system folder to the ID of the
+// system label of the emails in that folder, and the query term selecting
+// them.
+var folderLabels = map[string]struct{ id, term string }{
+	"inbox": {"INBOX", "in:inbox"},
+	"sent":  {"SENT", "in:sent"},
+	"draft": {"DRAFT", "in:drafts"},
+	"spam":  {"SPAM", "in:spam"},
+	"trash": {"TRASH", "in:trash"},
+}
+
+// Signals represents conditions on how Gmail classified an email, which
+// narrow down the emails matching a Gmail query. Emails in spam or trash
+// only match if IncludeSpamTrash is set or the Folder is "spam" or "trash".
+type Signals struct {
+	// The inbox category, like "primary" or "promotions", that matching
+	// emails must be in. If empty, the category is ignored.
+	Category string
+	// Whether matching emails must be marked important, or must not be if
+	// false. If nil, importance is ignored.
+	Important *bool
+	// The system folder, like "sent" or "spam", that matching emails must
+	// be in. If empty, the folder is ignored.
+	Folder string
+	// Whether emails in spam or trash can match.
+	IncludeSpamTrash bool
+}
+
+// SignalMatcher is the interface that wraps the MatchSignals method used by
+// any types implementing email searching behavior that can apply Signals
+// natively, like with label filters, rather than as query terms.
+type SignalMatcher interface {
+	MatchSignals(query string, s Signals) ([]Message, error)
+}
+
+// empty reports whether the Signals receiver s has no conditions.
+func (s Signals) empty() bool {
+	return s.Category == "" && s.Important == nil && s.Folder == "" && !s.IncludeSpamTrash
+}
+
+// ok returns an error if the category or folder of the Signals receiver s is
+// unknown.
+func (s Signals) ok() error {
+	if _, known := categoryLabels[s.Category]; s.Category != "" && !known {
+		return fmt.Errorf(`category must be one of "primary", "social", "promotions", "updates", or "forums", got %q`, s.Category)
+	}
+	if _, known := folderLabels[s.Folder]; s.Folder != "" && !known {
+		return fmt.Errorf(`folder must be one of "inbox", "sent", "draft", "spam", or "trash", got %q`, s.Folder)
+	}
+
+	return nil
+}
+
+// includeSpamTrash reports whether emails in spam or trash must be searched
+// to find the emails matching the Signals receiver s.
+func (s Signals) includeSpamTrash() bool {
+	return s.IncludeSpamTrash || s.Folder == "spam" || s.Folder == "trash"
+}
+
+// labelIDs returns the IDs of the labels that emails matching the Signals
+// receiver s must have, and the query terms for the conditions of s that
+// cannot be expressed as labels, like an email not being important.
+func (s Signals) labelIDs() ([]string, string) {
+	var ids []string
+	var terms string
+	if s.Category != "" {
+		ids = append(ids, categoryLabels[s.Category])
+	}
+	if s.Important != nil {
+		if *s.Important {
+			ids = append(ids, "IMPORTANT")
+		} else {
+			terms = "-is:important"
+		}
+	}
+	if s.Folder != "" {
+		ids = append(ids, folderLabels[s.Folder].id)
+	}
+
+	return ids, terms
+}
+
+// query returns the given Gmail query extended with the query terms for the
+// conditions of the Signals receiver s.
+func (s Signals) query(q string) string {
+	terms := []string{q}
+	if s.Category != "" {
+		terms = append(terms, "category:"+s.Category)
+	}
+	if s.Important != nil {
+		if *s.Important {
+			terms = append(terms, "is:important")
+		} else {
+			terms = append(terms, "-is:important")
+		}
+	}
+	if s.Folder != "" {
+		terms = append(terms, folderLabels[s.Folder].term)
+	}
+	if s.IncludeSpamTrash && s.Folder == "" {
+		terms = append(terms, "in:anywhere")
+	}
+
+	return strings.TrimSpace(strings.Join(terms, " "))
+}
+
+// describe returns a description of the conditions of the Signals receiver
+// s, starting with a space, or an empty string if it has none.
+func (s Signals) describe() string {
+	var d string
+	if s.Category != "" {
+		d += fmt.Sprintf(" in category %q", s.Category)
+	}
+	if s.Important != nil {
+		if *s.Important {
+			d += " marked important"
+		} else {
+			d += " not marked important"
+		}
+	}
+	if s.Folder != "" {
+		d += " in " + s.Folder
+	}
+	if s.IncludeSpamTrash && s.Folder == "" {
+		d += " including spam and trash"
+	}
+
+	return d
+}
+
+// matchAlert returns the emails matching the Gmail query and Signals of the
+// given Alert with the given Matcher, applying the Signals natively if the
+// Matcher implements SignalMatcher, or as query terms otherwise. If the
+// Alert has Queries, the Signals are applied to each of them.
+func matchAlert(m Matcher, alt Alert) ([]Message, error) {
+	if alt.Queries != nil {
+		return alt.Queries.eval(func(query string) ([]Message, error) {
+			leaf := alt
+			leaf.GmailQuery, leaf.Queries = query, nil
+			return matchAlert(m, leaf)
+		})
+	}
+
+	s := alt.signals()
+	if s.empty() {
+		return matchMessages(m, alt.GmailQuery)
+	}
+	if sm, ok := m.(SignalMatcher); ok {
+		return sm.MatchSignals(alt.GmailQuery, s)
+	}
+
+	return matchMessages(m, s.query(alt.GmailQuery))
+}
@@ -0,0 +1,204 @@
+package gmailalert
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSignalsTranslation(t *testing.T) {
+	t.Parallel()
+
+	important, unimportant := true, false
+	testCases := map[string]struct {
+		signals   Signals
+		wantQuery string
+		wantIDs   []string
+		wantTerms string
+	}{
+		"Category is a category label": {
+			signals:   Signals{Category: "primary"},
+			wantQuery: "is:unread category:primary",
+			wantIDs:   []string{"CATEGORY_PERSONAL"},
+		},
+		"Importance is the important label": {
+			signals:   Signals{Category: "updates", Important: &important},
+			wantQuery: "is:unread category:updates is:important",
+			wantIDs:   []string{"CATEGORY_UPDATES", "IMPORTANT"},
+		},
+		"Folder is a system label": {
+			signals:   Signals{Folder: "draft"},
+			wantQuery: "is:unread in:drafts",
+			wantIDs:   []string{"DRAFT"},
+		},
+		"Spam and trash inclusion searches anywhere": {
+			signals:   Signals{IncludeSpamTrash: true},
+			wantQuery: "is:unread in:anywhere",
+		},
+		"Unimportance is a query term": {
+			signals:   Signals{Important: &unimportant},
+			wantQuery: "is:unread -is:important",
+			wantTerms: "-is:important",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if got := tc.signals.query("is:unread"); tc.wantQuery != got {
+				t.Errorf("want query %q, got %q", tc.wantQuery, got)
+			}
+			ids, terms := tc.signals.labelIDs()
+			if !cmp.Equal(tc.wantIDs, ids) || tc.wantTerms != terms {
+				t.Errorf("want label ids %v and terms %q, got %v and %q", tc.wantIDs, tc.wantTerms, ids, terms)
+			}
+		})
+	}
+}
+
+func TestSignalsWithUnknownCategoryReturnsError(t *testing.T) {
+	t.Parallel()
+
+	if err := (Signals{Category: "newsletters"}).ok(); err == nil {
+		t.Error("expected an error but did not get one")
+	}
+}
+
+func TestSignalsWithUnknownFolderReturnsError(t *testing.T) {
+	t.Parallel()
+
+	if err := (Signals{Folder: "archive"}).ok(); err == nil {
+		t.Error("expected an error but did not get one")
+	}
+}
+
+func TestSignalsIncludeSpamTrash(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		signals Signals
+		want    bool
+	}{
+		"No folder excludes spam and trash":    {signals: Signals{Category: "updates"}},
+		"Sent folder excludes spam and trash":  {signals: Signals{Folder: "sent"}},
+		"Spam folder includes spam and trash":  {signals: Signals{Folder: "spam"}, want: true},
+		"Trash folder includes spam and trash": {signals: Signals{Folder: "trash"}, want: true},
+		"Toggle includes spam and trash":       {signals: Signals{IncludeSpamTrash: true}, want: true},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if got := tc.signals.includeSpamTrash(); tc.want != got {
+				t.Errorf("want %t, got %t", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestMatchAlertAppliesSignals(t *testing.T) {
+	t.Parallel()
+
+	important := true
+	alt := Alert{GmailQuery: "from:bank", Category: "updates", Important: &important}
+
+	t.Run("Signal matcher receives the signals", func(t *testing.T) {
+		m := &recordingSignalMatcher{}
+		if _, err := matchAlert(m, alt); err != nil {
+			t.Fatal(err)
+		}
+		want := Signals{Category: "updates", Important: &important}
+		if m.query != "from:bank" || !cmp.Equal(want, m.signals) {
+			t.Errorf("want query %q with signals %+v, got %q with %+v", "from:bank", want, m.query, m.signals)
+		}
+	})
+
+	t.Run("Plain matcher receives query terms", func(t *testing.T) {
+		m := &recordingSignalMatcher{}
+		if _, err := matchAlert(plainMatcher{m}, alt); err != nil {
+			t.Fatal(err)
+		}
+		if want := "from:bank category:updates is:important"; m.query != want {
+			t.Errorf("want query %q, got %q", want, m.query)
+		}
+	})
+}
+
+// recordingSignalMatcher represents a test double type that implements the
+// Matcher and SignalMatcher interfaces and records the query and Signals it
+// was last called with.
+type recordingSignalMatcher struct {
+	query   string
+	signals Signals
+}
+
+// Match records the given query and returns no matches.
+func (r *recordingSignalMatcher) Match(query string) ([]string, error) {
+	r.query = query
+	return nil, nil
+}
+
+// MatchSignals records the given query and Signals and returns no matches.
+func (r *recordingSignalMatcher) MatchSignals(query string, s Signals) ([]Message, error) {
+	r.query, r.signals = query, s
+	return nil, nil
+}
+
+// plainMatcher represents a test double type that hides every method of the
+// Matcher it wraps other than Match.
+type plainMatcher struct {
+	m Matcher
+}
+
+// Match calls the Match method of the wrapped Matcher.
+func (p plainMatcher) Match(query string) ([]string, error) {
+	return p.m.Match(query)
+}
+
+// idMatcher represents a Matcher that only implements Match, returning its
+// IDs for every query.
+type idMatcher []string
+
+// Match returns the IDs of the receiver i.
+func (i idMatcher) Match(_ string) ([]string, error) {
+	return i, nil
+}
+
+func TestMatchMessages(t *testing.T) {
+	t.Parallel()
+
+	date := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	testCases := map[string]struct {
+		matcher     Matcher
+		want        []Message
+		errExpected bool
+	}{
+		"Matcher returns Messages with only their IDs": {
+			matcher: idMatcher{"1", "2"},
+			want:    []Message{{ID: "1"}, {ID: "2"}},
+		},
+		"MessageMatcher returns its Messages": {
+			matcher: fakePreviewFetcher{matches: []Message{{ID: "1", ThreadID: "t1", Date: date}}},
+			want:    []Message{{ID: "1", ThreadID: "t1", Date: date}},
+		},
+		"Error of the Matcher is returned": {
+			matcher:     &failingMatcher{err: errors.New("quota exceeded")},
+			errExpected: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got, err := matchMessages(tc.matcher, "from:bank")
+			errReceived := err != nil
+
+			if errReceived != tc.errExpected {
+				t.Fatalf("got unexpected error status: %t", errReceived)
+			}
+
+			if !errReceived && !cmp.Equal(tc.want, got) {
+				t.Errorf("want != got\ndiff=%s", cmp.Diff(tc.want, got))
+			}
+		})
+	}
+}
@@ -0,0 +1,436 @@
+package gmailalert
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// simulationScenario represents the scripted sequence of synthetic emails a
+// simulation feeds through the alerts, as read from a scenario file.
+type simulationScenario struct {
+	// The virtual time the simulation starts at, like
+	// "2023-03-01T08:00:00Z". Defaults to the current time.
+	Start string `json:"start"`
+	// How much virtual time is simulated, as a duration like "24h".
+	Duration string `json:"duration"`
+	// The emails arriving during the simulation.
+	Messages []scenarioMessage `json:"messages"`
+	// When emergency notifications are acknowledged. Emergency
+	// notifications of other alerts are never acknowledged.
+	Acknowledge []scenarioAck `json:"acknowledge"`
+}
+
+// scenarioMessage represents a synthetic email arriving during a
+// simulation. Its ID, From, Subject, Snippet, and Labels fields are those of
+// a replayedMessage, whose raw email is made up from them if it has none.
+type scenarioMessage struct {
+	// When the email arrives, as a duration after the start of the
+	// simulation like "90m".
+	At string `json:"at"`
+	// The value of the email's To header.
+	To string `json:"to"`
+	// The text of the email.
+	Text string `json:"text"`
+	replayedMessage
+}
+
+// scenarioAck represents the acknowledgement of the emergency notifications
+// of an alert during a simulation.
+type scenarioAck struct {
+	// The name identifying the alert.
+	Alert string `json:"alert"`
+	// How long after each emergency notification of the alert it is
+	// acknowledged, as a duration like "10m".
+	After string `json:"after"`
+}
+
+// simulationClock represents the virtual time of a simulation, which only
+// advances when Poll sleeps.
+type simulationClock struct {
+	mtx sync.Mutex
+	now time.Time
+	end time.Time
+}
+
+// Now returns the virtual time of the simulationClock receiver c.
+func (c *simulationClock) Now() time.Time {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return c.now
+}
+
+// Sleep advances the virtual time of the simulationClock receiver c to the
+// given time right away, as described by the Sleep field of Alerter. It
+// returns context.Canceled, ending Poll, once the given time is past the end
+// of the simulation or zero.
+func (c *simulationClock) Sleep(ctx context.Context, t time.Time, wake <-chan struct{}) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if t.IsZero() || t.After(c.end) {
+		return context.Canceled
+	}
+	if t.After(c.now) {
+		c.now = t
+	}
+
+	return ctx.Err()
+}
+
+// simulationMatcher represents a Matcher, Fetcher, and RawFetcher searching
+// the synthetic emails of a simulation that arrived by the virtual time of
+// its simulationClock.
+type simulationMatcher struct {
+	clock    *simulationClock
+	fixtures []*replayFixture
+	arrivals []time.Time
+}
+
+// Match returns the IDs of the emails MatchMessages returns for the given
+// Gmail query.
+func (m simulationMatcher) Match(query string) ([]string, error) {
+	msgs, err := m.MatchMessages(query)
+	return messageIDs(msgs), err
+}
+
+// MatchMessages returns the emails of the simulationMatcher receiver m that
+// arrived by its virtual time and match the given Gmail query, newest first.
+// An error is returned if the query cannot be evaluated offline.
+func (m simulationMatcher) MatchMessages(query string) ([]Message, error) {
+	now := m.clock.Now()
+	var arrived []*replayFixture
+	for i, f := range m.fixtures {
+		if !m.arrivals[i].After(now) {
+			arrived = append(arrived, f)
+		}
+	}
+
+	return replayMatcher{fixtures: arrived, now: now}.MatchMessages(query)
+}
+
+// Fetch returns the Message of the email with the given ID.
+func (m simulationMatcher) Fetch(id string) (Message, error) {
+	return replayMatcher{fixtures: m.fixtures}.Fetch(id)
+}
+
+// FetchRaw returns the raw email with the given ID.
+func (m simulationMatcher) FetchRaw(id string) ([]byte, error) {
+	return replayMatcher{fixtures: m.fixtures}.FetchRaw(id)
+}
+
+// simulationEvent represents a line of the timeline of a simulation.
+type simulationEvent struct {
+	at    time.Time
+	alert string
+	what  string
+}
+
+// simulationRecorder represents a Notifier, ReceiptChecker, and Reporter
+// recording the notifications and suppressed or failed alerts of a
+// simulation in its timeline, and acknowledging emergency notifications as
+// scripted by the scenario.
+type simulationRecorder struct {
+	clock    *simulationClock
+	acks     map[string]time.Duration
+	mtx      sync.Mutex
+	timeline []simulationEvent
+	receipts map[string]simulationReceipt
+	// suppressed maps the alerts whose notification was suppressed since
+	// they last notified to the number of emails suppressed, so that a
+	// notification suppressed run after run is only listed once.
+	suppressed map[string]int
+}
+
+// simulationReceipt represents an emergency notification sent during a
+// simulation.
+type simulationReceipt struct {
+	alert  string
+	sent   time.Time
+	expire time.Duration
+}
+
+// NotifyResult records the given Alert in the timeline and returns a
+// receipt per recipient if it is an emergency notification.
+func (r *simulationRecorder) NotifyResult(alt Alert) (NotifyResult, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	now := r.clock.Now()
+	recipients := append([]string{alt.PushoverTarget}, alt.PushoverTargets...)
+	kind := "notified"
+	var res NotifyResult
+	if alt.PushoverEmergency != nil {
+		kind = "emergency"
+		_, expire, _, _ := alt.PushoverEmergency.durations()
+		for range recipients {
+			id := fmt.Sprintf("receipt-%d", len(r.receipts)+1)
+			r.receipts[id] = simulationReceipt{alert: alt.key(), sent: now, expire: expire}
+			res.Receipts = append(res.Receipts, id)
+		}
+	}
+	masked := make([]string, len(recipients))
+	for i, rcpt := range recipients {
+		masked[i] = Secret(rcpt).String()
+	}
+	r.timeline = append(r.timeline, simulationEvent{
+		at:    now,
+		alert: alt.key(),
+		what:  fmt.Sprintf("%s %q to %s: %s", kind, alt.PushoverTitle, strings.Join(masked, ", "), alt.PushoverMsg),
+	})
+
+	return res, nil
+}
+
+// Notify records the given Alert in the timeline.
+func (r *simulationRecorder) Notify(alt Alert) error {
+	_, err := r.NotifyResult(alt)
+	return err
+}
+
+// CheckReceipt reports an emergency notification as acknowledged once the
+// acknowledgement delay of its alert in the scenario elapsed, or as expired
+// once its expiry elapsed without acknowledgement.
+func (r *simulationRecorder) CheckReceipt(receipt string) (ReceiptStatus, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	rc, ok := r.receipts[receipt]
+	if !ok {
+		return ReceiptStatus{}, fmt.Errorf("receipt %s was not issued", receipt)
+	}
+	now := r.clock.Now()
+	if after, ok := r.acks[rc.alert]; ok && now.Sub(rc.sent) >= after {
+		return ReceiptStatus{Acknowledged: true, AcknowledgedBy: "simulation", AcknowledgedAt: rc.sent.Add(after)}, nil
+	}
+
+	return ReceiptStatus{Expired: now.Sub(rc.sent) >= rc.expire}, nil
+}
+
+// Report records the alerts of the given Summary whose notification was
+// suppressed or that failed in the timeline.
+func (r *simulationRecorder) Report(s Summary) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	for _, res := range s.Results {
+		switch {
+		case res.Err != nil:
+			r.timeline = append(r.timeline, simulationEvent{at: r.clock.Now(), alert: res.Alert, what: "FAIL " + res.Err.Error()})
+		case res.Notified:
+			delete(r.suppressed, res.Alert)
+		case res.Suppressed:
+			if n, ok := r.suppressed[res.Alert]; ok && n == res.Matches {
+				continue
+			}
+			r.suppressed[res.Alert] = res.Matches
+			r.timeline = append(r.timeline, simulationEvent{at: r.clock.Now(), alert: res.Alert,
+				what: fmt.Sprintf("suppressed notification of %d emails", res.Matches)})
+		}
+	}
+
+	return nil
+}
+
+// simulationStateStore represents a StateStore keeping the state of a
+// simulation in memory only.
+type simulationStateStore struct{}
+
+// Load returns no state.
+func (simulationStateStore) Load() (map[string]AlertState, error) {
+	return nil, nil
+}
+
+// Save discards the given state.
+func (simulationStateStore) Save(map[string]AlertState) error {
+	return nil
+}
+
+// simulateCLI accepts the command line flags of the "simulate" subcommand,
+// which feeds the synthetic emails of the scenario file given by the
+// "-scenario" flag through the alerts over virtual time, polling them like
+// the daemon, and prints the timeline of the notifications that would be
+// sent, suppressed, or escalated, without sending any. An error is returned
+// if the flags are invalid, the alert configuration or scenario cannot be
+// loaded, or the simulation fails.
+func simulateCLI(args []string) error {
+	var app cliEnv
+	var scenarioFile string
+
+	fs := app.flagSet("simulate")
+	fs.StringVar(
+		&scenarioFile,
+		"scenario",
+		"",
+		"json file of the synthetic emails arriving over virtual time, and when emergency notifications are acknowledged")
+	fs.DurationVar(
+		&app.minInterval,
+		"min-interval",
+		time.Minute,
+		"the shortest interval between two runs of an alert")
+	fs.DurationVar(
+		&app.maxInterval,
+		"max-interval",
+		30*time.Minute,
+		"the longest interval between two runs of an alert")
+	fs.StringVar(
+		&app.spread,
+		"spread",
+		string(SpreadNone),
+		`how to spread the runs of alerts across their interval, one of "none", "even", or "hash"`)
+	if err := app.parse(fs, args); err != nil {
+		return err
+	}
+	if scenarioFile == "" {
+		fs.Usage()
+		return errors.New(`command line flag "-scenario" must be non-empty`)
+	}
+
+	_, alertCfg, err := app.profileConfig()
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(scenarioFile)
+	if err != nil {
+		return fmt.Errorf("got error opening scenario file: %v", err)
+	}
+	defer f.Close()
+	var scenario simulationScenario
+	if err := json.NewDecoder(f).Decode(&scenario); err != nil {
+		return fmt.Errorf("got error decoding scenario file %s: %v", scenarioFile, err)
+	}
+
+	var logger Logger = log.New(io.Discard, "", 0)
+	if app.debug {
+		logger = newInfoLogger()
+	}
+
+	return simulate(scenario, alertCfg, app.minInterval, app.maxInterval, Spread(app.spread), logger, os.Stdout)
+}
+
+// simulate accepts a simulationScenario, an AlertConfig, the poll intervals
+// and Spread strategy, a Logger, and an io.Writer, polls the alerts of the
+// AlertConfig against the synthetic emails of the scenario over its virtual
+// time, with the AlertConfig's dedup window and with repeat intervals and
+// emergency receipts kept in memory, and writes the timeline of the
+// simulation to the io.Writer. An error is returned if the scenario is
+// invalid or the alerts cannot be polled.
+func simulate(scenario simulationScenario, alertCfg AlertConfig, minInterval, maxInterval time.Duration, spread Spread,
+	logger Logger, w io.Writer) error {
+	start := time.Now().Truncate(time.Second)
+	if scenario.Start != "" {
+		var err error
+		if start, err = time.Parse(time.RFC3339, scenario.Start); err != nil {
+			return fmt.Errorf("scenario start must be an RFC 3339 time, got %q", scenario.Start)
+		}
+	}
+	duration, err := time.ParseDuration(scenario.Duration)
+	if err != nil || duration <= 0 {
+		return fmt.Errorf("scenario duration must be a positive duration, got %q", scenario.Duration)
+	}
+	clock := &simulationClock{now: start, end: start.Add(duration)}
+
+	matcher := simulationMatcher{clock: clock}
+	for i, sm := range scenario.Messages {
+		at, err := time.ParseDuration(sm.At)
+		if err != nil || at < 0 {
+			return fmt.Errorf("scenario message %d must arrive at a non-negative duration, got %q", i+1, sm.At)
+		}
+		fixture, err := newScenarioFixture(sm, i, start.Add(at))
+		if err != nil {
+			return fmt.Errorf("got error parsing scenario message %d: %v", i+1, err)
+		}
+		matcher.fixtures = append(matcher.fixtures, fixture)
+		matcher.arrivals = append(matcher.arrivals, start.Add(at))
+	}
+
+	recorder := &simulationRecorder{clock: clock, acks: map[string]time.Duration{}, receipts: map[string]simulationReceipt{}, suppressed: map[string]int{}}
+	for _, ack := range scenario.Acknowledge {
+		after, err := time.ParseDuration(ack.After)
+		if err != nil || after < 0 {
+			return fmt.Errorf("scenario acknowledgement of alert %q must be after a non-negative duration, got %q", ack.Alert, ack.After)
+		}
+		recorder.acks[ack.Alert] = after
+	}
+
+	state, err := OpenState(simulationStateStore{})
+	if err != nil {
+		return err
+	}
+	opts := []AlerterOption{
+		WithAlerterLogger(logger),
+		WithAlerterClock(clock.Now),
+		WithAlerterSleep(clock.Sleep),
+		WithAlerterState(state),
+		WithAlerterSpread(spread),
+		WithAlerterConcurrency(1),
+		WithAlerterReporter(recorder),
+	}
+	if alertCfg.DedupWindow != "" {
+		d, err := time.ParseDuration(alertCfg.DedupWindow)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("dedup window must be a positive duration, got %q", alertCfg.DedupWindow)
+		}
+		opts = append(opts, WithAlerterDedupWindow(d))
+	}
+	alerter, err := NewAlerter(matcher, recorder, opts...)
+	if err != nil {
+		return err
+	}
+	if err := alerter.Poll(context.Background(), alertCfg.Alerts, minInterval, maxInterval); err != nil {
+		return err
+	}
+
+	sort.SliceStable(recorder.timeline, func(i, j int) bool { return recorder.timeline[i].at.Before(recorder.timeline[j].at) })
+	for _, e := range recorder.timeline {
+		fmt.Fprintf(w, "+%-9s %s: %s\n", e.at.Sub(start), e.alert, e.what)
+	}
+	fmt.Fprintf(w, "simulated %s with %d emails: %d notifications, %d suppressed or failed\n",
+		duration, len(scenario.Messages), recorder.notifications(), len(recorder.timeline)-recorder.notifications())
+
+	return nil
+}
+
+// notifications returns the number of notifications in the timeline of the
+// simulationRecorder receiver r.
+func (r *simulationRecorder) notifications() int {
+	var n int
+	for _, e := range r.timeline {
+		if strings.HasPrefix(e.what, "notified ") || strings.HasPrefix(e.what, "emergency ") {
+			n++
+		}
+	}
+
+	return n
+}
+
+// newScenarioFixture returns the replayFixture of the given scenarioMessage,
+// the given index among the messages of its scenario, arriving at the given
+// time. Its ID defaults to one made up from the index, its date to its
+// arrival, and its labels to "INBOX" and "UNREAD". If it has no raw email,
+// one is made up from its headers and text. An error is returned if the raw
+// email cannot be parsed.
+func newScenarioFixture(sm scenarioMessage, index int, arrival time.Time) (*replayFixture, error) {
+	rm := sm.replayedMessage
+	if rm.ID == "" {
+		rm.ID = fmt.Sprintf("simulated-%d", index+1)
+	}
+	if rm.Date.IsZero() {
+		rm.Date = arrival
+	}
+	if rm.Labels == nil {
+		rm.Labels = []string{"INBOX", "UNREAD"}
+	}
+	if rm.Raw == "" {
+		text := firstNonEmpty(sm.Text, rm.Snippet)
+		rm.Raw = fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n",
+			rm.From, sm.To, rm.Subject, rm.Date.Format(time.RFC1123Z), text)
+	}
+
+	return newReplayFixture(rm)
+}
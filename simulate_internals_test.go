@@ -0,0 +1,93 @@
+package gmailalert
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSimulatePrintsTimeline(t *testing.T) {
+	t.Parallel()
+
+	alertCfg := AlertConfig{Alerts: []Alert{
+		{
+			Name:           "bills",
+			GmailQuery:     "from:bank",
+			PushoverTarget: "uQiRzpo4DXghDmr9QzzfQu27cmVRsG",
+			PushoverTitle:  "Bill due",
+			RepeatInterval: "2h",
+		},
+		{
+			Name:              "outage",
+			GmailQuery:        "subject:down",
+			PushoverTarget:    "uQiRzpo4DXghDmr9QzzfQu27cmVRsG",
+			PushoverTitle:     "Server down",
+			PushoverEmergency: &EmergencyConfig{EscalateAfter: "15m", EscalateTo: []string{"uOps7rTq2mXbZ1aW9cY4dE6fGhJ8kL"}},
+			RepeatInterval:    "24h",
+		},
+	}}
+	scenario := simulationScenario{
+		Start:    "2023-03-01T08:00:00Z",
+		Duration: "3h",
+		Messages: []scenarioMessage{
+			{At: "10m", replayedMessage: replayedMessage{exportedMessage: exportedMessage{Message: Message{From: "billing@bank.example", Subject: "Your bill"}}}},
+			{At: "1h", replayedMessage: replayedMessage{exportedMessage: exportedMessage{Message: Message{From: "billing@bank.example", Subject: "Reminder"}}}},
+			{At: "2h", replayedMessage: replayedMessage{exportedMessage: exportedMessage{Message: Message{From: "monitor@example.com", Subject: "Server down"}}}},
+		},
+	}
+	var out bytes.Buffer
+
+	err := simulate(scenario, alertCfg, 10*time.Minute, 10*time.Minute, SpreadNone, log.New(io.Discard, "", 0), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		`+10m0s     bills: notified "Bill due" to uQiR****VRsG: Found 1 emails matching query "from:bank"`,
+		`+20m0s     bills: suppressed notification of 1 emails`,
+		`+1h0m0s    bills: notified "Bill due" to uQiR****VRsG: Found 2 emails matching query "from:bank"`,
+		`+1h10m0s   bills: suppressed notification of 2 emails`,
+		`+2h0m0s    outage: emergency "Server down" to uQiR****VRsG: Found 1 emails matching query "subject:down"`,
+		`+2h10m0s   outage: suppressed notification of 1 emails`,
+		`+2h20m0s   outage: emergency "Server down" to uOps****J8kL: Emergency notification of alert "outage" was not acknowledged within 15m0s`,
+		`+3h0m0s    bills: notified "Bill due" to uQiR****VRsG: Found 2 emails matching query "from:bank"`,
+	}
+	got := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if !cmp.Equal(want, got[:len(got)-1]) {
+		t.Errorf("want != got\ndiff=%s", cmp.Diff(want, got[:len(got)-1]))
+	}
+}
+
+func TestSimulateDoesNotEscalateAcknowledgedEmergency(t *testing.T) {
+	t.Parallel()
+
+	alertCfg := AlertConfig{Alerts: []Alert{{
+		Name:              "outage",
+		GmailQuery:        "subject:down",
+		PushoverTarget:    "uQiRzpo4DXghDmr9QzzfQu27cmVRsG",
+		PushoverTitle:     "Server down",
+		PushoverEmergency: &EmergencyConfig{EscalateAfter: "15m", EscalateTo: []string{"uOps7rTq2mXbZ1aW9cY4dE6fGhJ8kL"}},
+		RepeatInterval:    "24h",
+	}}}
+	scenario := simulationScenario{
+		Start:       "2023-03-01T08:00:00Z",
+		Duration:    "1h",
+		Messages:    []scenarioMessage{{At: "0s", replayedMessage: replayedMessage{exportedMessage: exportedMessage{Message: Message{Subject: "Server down"}}}}},
+		Acknowledge: []scenarioAck{{Alert: "outage", After: "5m"}},
+	}
+	var out bytes.Buffer
+
+	err := simulate(scenario, alertCfg, 10*time.Minute, 10*time.Minute, SpreadNone, log.New(io.Discard, "", 0), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(out.String(), `emergency "Server down" to uQiR****VRsG`) || strings.Contains(out.String(), "to uOps") {
+		t.Errorf("want acknowledged emergency notification not escalated, got\n%s", out.String())
+	}
+}
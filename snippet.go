@@ -0,0 +1,102 @@
+package gmailalert
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// defaultSnippetMaxChars is the number of characters a snippet is truncated
+// to unless another limit is configured.
+const defaultSnippetMaxChars = 100
+
+// snippetMask is what every masked part of a snippet is replaced with.
+const snippetMask = "****"
+
+var (
+	// cardNumber matches a payment card number of 13 to 19 digits, which
+	// may be grouped with spaces or dashes.
+	cardNumber = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+	// oneTimeCode matches a standalone number of 4 to 8 digits, like a
+	// one-time password or a verification code.
+	oneTimeCode = regexp.MustCompile(`\b\d{4,8}\b`)
+)
+
+// SnippetConfig represents how the snippet of the most recent matching
+// email is sanitized before it is included in a notification, since
+// notifications pass through third-party push providers.
+type SnippetConfig struct {
+	// The maximum number of characters of the snippet. Longer snippets are
+	// truncated. If zero, 100 is used.
+	MaxChars int `json:"maxchars"`
+	// Regular expressions whose matches are masked, in addition to card
+	// numbers and one-time codes.
+	Mask []string `json:"mask"`
+	// Whether card numbers and one-time codes are left unmasked.
+	KeepNumbers bool `json:"keepnumbers"`
+}
+
+// ok returns an error if the maximum number of characters of the
+// SnippetConfig is negative or any of its mask patterns is not a valid
+// regular expression.
+func (c SnippetConfig) ok() error {
+	if c.MaxChars < 0 {
+		return fmt.Errorf("snippet max chars must not be negative, got %d", c.MaxChars)
+	}
+	for _, pattern := range c.Mask {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("got error compiling snippet mask %q: %v", pattern, err)
+		}
+	}
+
+	return nil
+}
+
+// sanitize returns the given email text with its HTML tags stripped, its
+// HTML entities decoded, its whitespace collapsed, the sensitive patterns
+// of the SnippetConfig masked, and truncated to its maximum number of
+// characters. The mask patterns must be valid, as checked by ok.
+func (c SnippetConfig) sanitize(text string) string {
+	text = html.UnescapeString(htmlTag.ReplaceAllString(text, " "))
+	text = strings.Join(strings.Fields(text), " ")
+
+	if !c.KeepNumbers {
+		text = cardNumber.ReplaceAllString(text, snippetMask)
+		text = oneTimeCode.ReplaceAllString(text, snippetMask)
+	}
+	for _, pattern := range c.Mask {
+		text = regexp.MustCompile(pattern).ReplaceAllString(text, snippetMask)
+	}
+
+	max := c.MaxChars
+	if max == 0 {
+		max = defaultSnippetMaxChars
+	}
+	if utf8.RuneCountInString(text) <= max {
+		return text
+	}
+
+	return string([]rune(text)[:max]) + "…"
+}
+
+// snippet accepts an Alert and its most recent matching message and returns
+// the message's snippet sanitized according to the Alert's SnippetConfig.
+// An error is returned if the Alerter's Matcher does not implement Fetcher
+// or the message cannot be fetched.
+func (a Alerter) snippet(alt Alert, msg Message) (string, error) {
+	if msg.Snippet == "" {
+		fetcher, ok := a.Matcher.(Fetcher)
+		if !ok {
+			return "", fmt.Errorf("matcher %T must implement Fetcher to include snippets", a.Matcher)
+		}
+		var err error
+		msg, err = fetcher.Fetch(msg.ID)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return alt.Snippet.sanitize(msg.Snippet), nil
+}
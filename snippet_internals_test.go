@@ -0,0 +1,100 @@
+package gmailalert
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSnippetConfigSanitize(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		cfg  SnippetConfig
+		text string
+		want string
+	}{
+		"HTML is stripped and entities decoded": {
+			text: "<p>Your order&#39;s  <b>shipped</b></p>",
+			want: "Your order's shipped",
+		},
+		"Card numbers and codes are masked": {
+			text: "Card 4111 1111 1111 1111 charged, code 482913",
+			want: "Card **** charged, code ****",
+		},
+		"Numbers are kept if configured": {
+			cfg:  SnippetConfig{KeepNumbers: true},
+			text: "Your code is 482913",
+			want: "Your code is 482913",
+		},
+		"Custom patterns are masked": {
+			cfg:  SnippetConfig{Mask: []string{`(?i)account \S+`}},
+			text: "Payment from Account AB-12 received",
+			want: "Payment from **** received",
+		},
+		"Long snippets are truncated": {
+			cfg:  SnippetConfig{MaxChars: 10},
+			text: "Your statement is ready",
+			want: "Your state…",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got := tc.cfg.sanitize(tc.text)
+
+			if tc.want != got {
+				t.Errorf("want != got\ndiff=%s", cmp.Diff(tc.want, got))
+			}
+		})
+	}
+}
+
+func TestSnippetConfigOK(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		cfg         SnippetConfig
+		errExpected bool
+	}{
+		"Default config returns no error": {
+			cfg: SnippetConfig{},
+		},
+		"Negative max chars returns an error": {
+			cfg:         SnippetConfig{MaxChars: -1},
+			errExpected: true,
+		},
+		"Invalid mask pattern returns an error": {
+			cfg:         SnippetConfig{Mask: []string{"("}},
+			errExpected: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := tc.cfg.ok()
+			errReceived := err != nil
+
+			if tc.errExpected != errReceived {
+				t.Errorf("got unexpected error status, got error: %v", err)
+			}
+		})
+	}
+}
+
+func TestAlerterSnippetFetchesMessage(t *testing.T) {
+	t.Parallel()
+
+	a := Alerter{Matcher: fakePreviewFetcher{
+		msgs: map[string]Message{"id0": {ID: "id0", Snippet: "Your code is 123456"}},
+	}}
+
+	got, err := a.snippet(Alert{Snippet: &SnippetConfig{}}, Message{ID: "id0"})
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+
+	if want := "Your code is ****"; want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,63 @@
+package gmailalert
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+// Spread represents the strategy Poll uses to spread the evaluation of
+// alerts sharing a schedule across their interval, so that their Gmail
+// queries are not all sent at the same instant.
+type Spread string
+
+const (
+	// SpreadNone evaluates every alert immediately when polling starts,
+	// and again as soon as its interval elapses.
+	SpreadNone Spread = "none"
+	// SpreadEven spreads the first evaluation of the alerts evenly across
+	// the minimum interval, in the order the alerts are configured.
+	SpreadEven Spread = "even"
+	// SpreadHash spreads the first evaluation of each alert across the
+	// minimum interval by a hash of its name, so that an alert keeps its
+	// place when other alerts are added or removed.
+	SpreadHash Spread = "hash"
+)
+
+// spreadJitter is the largest share of an alert's interval that Poll adds
+// to it when the alert is spread, keeping alerts that ended up being
+// evaluated together apart.
+const spreadJitter = 0.1
+
+// WithAlerterSpread accepts a Spread strategy and returns a functional
+// option for making an Alerter spread the evaluation of alerts with it.
+func WithAlerterSpread(s Spread) AlerterOption {
+	return func(a *Alerter) {
+		a.Spread = s
+	}
+}
+
+// ok returns an error if the receiver s is not a known Spread strategy. The
+// empty Spread is the same as SpreadNone.
+func (s Spread) ok() error {
+	switch s {
+	case "", SpreadNone, SpreadEven, SpreadHash:
+		return nil
+	}
+
+	return fmt.Errorf(`spread must be one of "none", "even", or "hash", got %q`, s)
+}
+
+// phase returns the deterministic position, between 0 and 1, of the given
+// alert, which is the i-th of n alerts, within its interval.
+func (s Spread) phase(alt Alert, i, n int) float64 {
+	switch s {
+	case SpreadEven:
+		return float64(i) / float64(n)
+	case SpreadHash:
+		h := fnv.New32a()
+		h.Write([]byte(alt.key()))
+		return float64(h.Sum32()) / (1 << 32)
+	}
+
+	return 0
+}
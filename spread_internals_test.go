@@ -0,0 +1,63 @@
+package gmailalert
+
+import (
+	"context"
+	"io"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestSpreadPhase(t *testing.T) {
+	t.Parallel()
+
+	alerts := []Alert{{Name: "bills"}, {Name: "orders"}, {Name: "travel"}, {Name: "news"}}
+
+	t.Run("none puts every alert at the start", func(t *testing.T) {
+		for i, alt := range alerts {
+			if got := SpreadNone.phase(alt, i, len(alerts)); got != 0 {
+				t.Errorf("want phase 0 for alert %q, got %v", alt.Name, got)
+			}
+		}
+	})
+
+	t.Run("even spreads alerts in order", func(t *testing.T) {
+		for i, want := range []float64{0, 0.25, 0.5, 0.75} {
+			if got := SpreadEven.phase(alerts[i], i, len(alerts)); want != got {
+				t.Errorf("want phase %v for alert %q, got %v", want, alerts[i].Name, got)
+			}
+		}
+	})
+
+	t.Run("hash depends only on the alert", func(t *testing.T) {
+		seen := map[float64]bool{}
+		for i, alt := range alerts {
+			got := SpreadHash.phase(alt, i, len(alerts))
+			if got < 0 || got >= 1 {
+				t.Errorf("want phase in [0, 1) for alert %q, got %v", alt.Name, got)
+			}
+			if again := SpreadHash.phase(alt, 0, 1); again != got {
+				t.Errorf("want the same phase for alert %q at any position, got %v and %v", alt.Name, got, again)
+			}
+			seen[got] = true
+		}
+		if len(seen) != len(alerts) {
+			t.Errorf("want a distinct phase for each alert, got %v", seen)
+		}
+	})
+}
+
+func TestPollWithUnknownSpreadReturnsError(t *testing.T) {
+	t.Parallel()
+
+	a := Alerter{
+		Matcher:  fakePreviewFetcher{},
+		Notifier: &recordingTestNotifier{},
+		Logger:   log.New(io.Discard, "", 0),
+		Spread:   "random",
+	}
+
+	if err := a.Poll(context.Background(), nil, time.Minute, time.Hour); err == nil {
+		t.Error("expected an error but did not get one")
+	}
+}
@@ -0,0 +1,165 @@
+package gmailalert
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sshCommand is the command starting SSH tunnels, which is the OpenSSH
+// client.
+var sshCommand = "ssh"
+
+// sshTunnelTimeout is how long starting an SSH tunnel may take before it is
+// given up.
+const sshTunnelTimeout = 15 * time.Second
+
+// sshTunnel represents an SSH connection with dynamic port forwarding, run by
+// the ssh command, which serves a SOCKS5 proxy on a local port forwarding
+// connections through the SSH server. It lets clients reach the Internet
+// from networks where only an SSH bastion is reachable.
+type sshTunnel struct {
+	cmd  *exec.Cmd
+	addr string
+	done chan struct{}
+}
+
+// running reports whether the ssh command of the sshTunnel receiver t has
+// not exited.
+func (t *sshTunnel) running() bool {
+	select {
+	case <-t.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// sshTunnels holds the SSH tunnels of the process by the URL of their SSH
+// server, so that clients configured with the same URL, including clients
+// created again when the configuration is reloaded, share a tunnel.
+var sshTunnels = struct {
+	mtx     sync.Mutex
+	tunnels map[string]*sshTunnel
+}{tunnels: map[string]*sshTunnel{}}
+
+// sshProxy returns a function for the Proxy field of an http.Transport that
+// sends requests through the SOCKS5 proxy of the SSH tunnel to the SSH
+// server with the given URL, like "ssh://user@bastion.example.com:22". The
+// tunnel is started on the first request and started again if it exited,
+// like when the SSH connection dropped.
+func sshProxy(u *url.URL) func(*http.Request) (*url.URL, error) {
+	return func(*http.Request) (*url.URL, error) {
+		sshTunnels.mtx.Lock()
+		defer sshTunnels.mtx.Unlock()
+		key := u.String()
+		t, ok := sshTunnels.tunnels[key]
+		if !ok || !t.running() {
+			var err error
+			if t, err = startSSHTunnel(u); err != nil {
+				return nil, err
+			}
+			sshTunnels.tunnels[key] = t
+		}
+
+		return &url.URL{Scheme: "socks5", Host: t.addr}, nil
+	}
+}
+
+// closeSSHTunnels stops every SSH tunnel of the process.
+func closeSSHTunnels() {
+	sshTunnels.mtx.Lock()
+	defer sshTunnels.mtx.Unlock()
+	for key, t := range sshTunnels.tunnels {
+		if t.running() {
+			t.cmd.Process.Kill()
+			<-t.done
+		}
+		delete(sshTunnels.tunnels, key)
+	}
+}
+
+// startSSHTunnel starts an SSH tunnel to the SSH server with the given URL
+// and waits until its SOCKS5 proxy accepts connections. An error is returned
+// if the ssh command cannot be started, exits, or does not open its local
+// port within sshTunnelTimeout.
+func startSSHTunnel(u *url.URL) (*sshTunnel, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("got error finding a free port for ssh tunnel: %v", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	cmd := exec.Command(sshCommand, sshTunnelArgs(u, addr)...)
+	stderr := &limitedBuffer{max: maxScriptOutputBytes}
+	cmd.Stderr = stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("got error starting ssh tunnel to %s: %v", u.Redacted(), err)
+	}
+	t := &sshTunnel{cmd: cmd, addr: addr, done: make(chan struct{})}
+	go func() {
+		cmd.Wait()
+		close(t.done)
+	}()
+
+	deadline := time.Now().Add(sshTunnelTimeout)
+	for time.Now().Before(deadline) {
+		if !t.running() {
+			return nil, fmt.Errorf("ssh tunnel to %s exited: %s", u.Redacted(), strings.TrimSpace(stderr.String()))
+		}
+		if conn, err := net.DialTimeout("tcp", addr, time.Second); err == nil {
+			conn.Close()
+			return t, nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	cmd.Process.Kill()
+	<-t.done
+
+	return nil, fmt.Errorf("ssh tunnel to %s did not open within %s: %s",
+		u.Redacted(), sshTunnelTimeout, strings.TrimSpace(stderr.String()))
+}
+
+// sshTunnelArgs returns the arguments of the ssh command running a tunnel to
+// the SSH server with the given URL, with its SOCKS5 proxy listening on the
+// given local address. The "identity" query parameter of the URL names the
+// private key file to authenticate with, and the ssh command never prompts,
+// so that the server must accept the key or an agent's key.
+func sshTunnelArgs(u *url.URL, addr string) []string {
+	args := []string{
+		"-N",
+		"-D", addr,
+		"-o", "BatchMode=yes",
+		"-o", "ExitOnForwardFailure=yes",
+		"-o", "ServerAliveInterval=30",
+	}
+	if port := u.Port(); port != "" {
+		args = append(args, "-p", port)
+	}
+	if identity := u.Query().Get("identity"); identity != "" {
+		args = append(args, "-i", identity)
+	}
+	dest := u.Hostname()
+	if user := u.User.Username(); user != "" {
+		dest = user + "@" + dest
+	}
+
+	return append(args, "--", dest)
+}
+
+// checkSSHProxyURL returns an error if the given SSH proxy URL has a
+// password, which the ssh command cannot be given without prompting.
+func checkSSHProxyURL(u *url.URL) error {
+	if _, ok := u.User.Password(); ok {
+		return errors.New("ssh proxy url must not contain a password, authenticate with a key given by the \"identity\" query parameter or an ssh agent")
+	}
+
+	return nil
+}
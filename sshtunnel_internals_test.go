@@ -0,0 +1,95 @@
+package gmailalert
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSSHTunnelArgs(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		url  string
+		want []string
+	}{
+		"Host only": {
+			url: "ssh://bastion.example.com",
+			want: []string{"-N", "-D", "127.0.0.1:1080", "-o", "BatchMode=yes", "-o", "ExitOnForwardFailure=yes",
+				"-o", "ServerAliveInterval=30", "--", "bastion.example.com"},
+		},
+		"User, port, and identity": {
+			url: "ssh://alerts@bastion.example.com:2222?identity=/keys/id_ed25519",
+			want: []string{"-N", "-D", "127.0.0.1:1080", "-o", "BatchMode=yes", "-o", "ExitOnForwardFailure=yes",
+				"-o", "ServerAliveInterval=30", "-p", "2222", "-i", "/keys/id_ed25519", "--", "alerts@bastion.example.com"},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			u, err := parseProxyURL(tc.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := sshTunnelArgs(u, "127.0.0.1:1080")
+
+			if !cmp.Equal(tc.want, got) {
+				t.Errorf("want != got\ndiff=%s", cmp.Diff(tc.want, got))
+			}
+		})
+	}
+}
+
+// TestSSHProxyReturnsErrorOfExitedTunnel is not run in parallel, since it
+// replaces the ssh command.
+func TestSSHProxyReturnsErrorOfExitedTunnel(t *testing.T) {
+	fakeSSH := filepath.Join(t.TempDir(), "ssh")
+	script := "#!/bin/sh\necho 'Permission denied (publickey).' >&2\nexit 255\n"
+	if err := os.WriteFile(fakeSSH, []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+	defer func(cmd string) { sshCommand = cmd }(sshCommand)
+	sshCommand = fakeSSH
+	defer closeSSHTunnels()
+	client, err := newHTTPClient("ssh://alerts@bastion.invalid", HTTPClientConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.Get("https://api.pushover.net/1/messages.json")
+
+	if err == nil || !strings.Contains(err.Error(), "Permission denied") {
+		t.Errorf("want error of the exited ssh command, got %v", err)
+	}
+}
+
+func TestAdapterHTTPClientSendsRequestsThroughProxy(t *testing.T) {
+	t.Parallel()
+
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+	}))
+	defer proxy.Close()
+	w, err := NewWebhook(WebhookConfig{URL: "http://hooks.example.com/runs", Proxy: proxy.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Report(Summary{RunID: "run"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "http://hooks.example.com/runs"; want != proxied {
+		t.Errorf("want webhook request for %q to reach the proxy, got %q", want, proxied)
+	}
+	if _, err := NewHeartbeat(HeartbeatConfig{URL: "http://hc.example.com", Proxy: "ftp://proxy:21"}); err == nil {
+		t.Error("want error creating a heartbeat with an invalid proxy")
+	}
+}
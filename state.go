@@ -0,0 +1,231 @@
+package gmailalert
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// AlertState represents the persisted notification history of a single alert.
+type AlertState struct {
+	// The time the alert was last notified.
+	Notified time.Time `json:"notified"`
+	// The IDs of the messages that matched the alert when it was last
+	// notified.
+	MessageIDs []string `json:"messageids"`
+	// The mailbox history point up to which label changes were checked,
+	// for alerts watching a label.
+	HistoryID uint64 `json:"historyid,omitempty"`
+	// The dedup keys of the notifications sent for the alert within the
+	// dedup window, mapped to when they were sent.
+	Sent map[string]time.Time `json:"sent,omitempty"`
+	// The receipts of the alert's emergency notifications that are waiting
+	// to be acknowledged, and of its last emergency notification.
+	Receipts []ReceiptState `json:"receipts,omitempty"`
+	// The one-click unsubscribe URLs of the senders of the emails that
+	// matched the alert which were unsubscribed from.
+	Unsubscribed []string `json:"unsubscribed,omitempty"`
+}
+
+// Store is the interface wrapping the methods used by an Alerter to read and
+// update the notification history of alerts.
+//
+// Get returns the committed AlertState stored under the given key, or the
+// zero AlertState if none is stored. Begin starts a StoreTx for the changes
+// made by a single evaluation of an alert.
+//
+// Deprecated: Use the stable v1.Store in package api/v1.
+type Store interface {
+	Get(key string) AlertState
+	Begin() StoreTx
+}
+
+// StoreTx is the interface wrapping the methods of a unit of work on a
+// Store. Changes made with Set are only seen through the StoreTx until it is
+// committed, when they are applied to the Store together. Changes of a
+// StoreTx that is rolled back are discarded.
+//
+// Calling Commit or Rollback after the StoreTx was committed or rolled back
+// has no effect.
+//
+// Deprecated: Use the stable v1.StoreTx in package api/v1.
+type StoreTx interface {
+	Get(key string) AlertState
+	Set(key string, as AlertState)
+	Commit() error
+	Rollback()
+}
+
+// Reloader is the interface that wraps the Reload method used by any types
+// implementing a Store whose AlertStates can be changed by other instances
+// sharing it. Reload rereads the AlertStates changed by the other instances.
+type Reloader interface {
+	Reload() error
+}
+
+// State represents the notification history of all alerts, persisted
+// between runs in a StateStore, by default as JSON in a local file. It
+// implements Store and is safe for concurrent use by multiple goroutines.
+//
+// Deprecated: Use the stable v1.State in package api/v1.
+type State struct {
+	store  StateStore
+	mtx    sync.Mutex
+	alerts map[string]AlertState
+	// The keys of the AlertStates changed since the State was last saved.
+	dirty map[string]bool
+}
+
+// LoadState accepts the name of a JSON state file and returns a State
+// populated from it. If the file does not exist, an empty State is returned
+// which will be written to the file when saved. An error is returned if the
+// file name is empty or if the file exists but cannot be read or decoded.
+func LoadState(file string) (*State, error) {
+	if file == "" {
+		return nil, errors.New("state file name must not be empty")
+	}
+
+	return OpenState(fileStateStore{file: file})
+}
+
+// OpenState accepts a StateStore and returns a State populated from it,
+// which is written back to the StateStore when saved. An error is returned
+// if the StateStore cannot be loaded.
+func OpenState(store StateStore) (*State, error) {
+	alerts, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+	if alerts == nil {
+		alerts = map[string]AlertState{}
+	}
+
+	return &State{store: store, alerts: alerts, dirty: map[string]bool{}}, nil
+}
+
+// Get returns the AlertState stored under the given key. The zero AlertState
+// is returned if no state is stored for the key.
+func (s *State) Get(key string) AlertState {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.alerts[key]
+}
+
+// Set stores the given AlertState under the given key.
+func (s *State) Set(key string, as AlertState) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.alerts[key] = as
+	s.dirty[key] = true
+}
+
+// Begin returns a StoreTx whose changes are applied to the State when it is
+// committed. Changes committed by concurrent StoreTxs to the same key
+// overwrite each other, the last one winning.
+func (s *State) Begin() StoreTx {
+	return &stateTx{state: s, staged: map[string]AlertState{}}
+}
+
+// Save writes the State into its StateStore. If the StateStore is an
+// AlertStateStore, only the AlertStates changed since the State was last
+// saved are written, so that the AlertStates other instances sharing the
+// StateStore saved in the meantime are kept. An error is returned if there
+// is a problem writing the StateStore.
+func (s *State) Save() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if store, ok := s.store.(AlertStateStore); ok {
+		changed := make(map[string]AlertState, len(s.dirty))
+		for key := range s.dirty {
+			changed[key] = s.alerts[key]
+		}
+		if len(changed) > 0 {
+			if err := store.SaveAlerts(changed); err != nil {
+				return err
+			}
+		}
+	} else if err := s.store.Save(s.alerts); err != nil {
+		return err
+	}
+	s.dirty = map[string]bool{}
+
+	return nil
+}
+
+// Reload rereads the AlertStates of the State from its StateStore if it is
+// an AlertStateStore, which other instances may share, keeping the
+// AlertStates changed since the State was last saved. It has no effect with
+// other StateStores, which only the State writes to. An error is returned if
+// the StateStore cannot be loaded, in which case the State is left as it is.
+func (s *State) Reload() error {
+	if _, ok := s.store.(AlertStateStore); !ok {
+		return nil
+	}
+	alerts, err := s.store.Load()
+	if err != nil {
+		return err
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if alerts == nil {
+		alerts = map[string]AlertState{}
+	}
+	for key := range s.dirty {
+		alerts[key] = s.alerts[key]
+	}
+	s.alerts = alerts
+
+	return nil
+}
+
+// stateTx represents a StoreTx on a State.
+type stateTx struct {
+	state  *State
+	staged map[string]AlertState
+	done   bool
+}
+
+// Get returns the AlertState staged under the given key by the receiver t,
+// or the one committed to its State if none is staged.
+func (t *stateTx) Get(key string) AlertState {
+	if as, ok := t.staged[key]; ok {
+		return as
+	}
+
+	return t.state.Get(key)
+}
+
+// Set stages the given AlertState under the given key.
+func (t *stateTx) Set(key string, as AlertState) {
+	if t.done {
+		return
+	}
+	t.staged[key] = as
+}
+
+// Commit applies the staged AlertStates of the receiver t to its State.
+func (t *stateTx) Commit() error {
+	if t.done {
+		return nil
+	}
+	t.done = true
+
+	t.state.mtx.Lock()
+	defer t.state.mtx.Unlock()
+	for key, as := range t.staged {
+		t.state.alerts[key] = as
+		t.state.dirty[key] = true
+	}
+
+	return nil
+}
+
+// Rollback discards the staged AlertStates of the receiver t.
+func (t *stateTx) Rollback() {
+	t.done = true
+	t.staged = nil
+}
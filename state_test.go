@@ -0,0 +1,145 @@
+package gmailalert_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aculclasure/gmailalert"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLoadStateWithEmptyFileNameReturnsError(t *testing.T) {
+	t.Parallel()
+
+	if _, err := gmailalert.LoadState(""); err == nil {
+		t.Error("expected an error but did not get one")
+	}
+}
+
+func TestLoadStateWithInvalidFileReturnsError(t *testing.T) {
+	t.Parallel()
+
+	file := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(file, []byte("this-is-not-json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := gmailalert.LoadState(file); err == nil {
+		t.Error("expected an error but did not get one")
+	}
+}
+
+func TestStateSaveAndLoadRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	file := filepath.Join(t.TempDir(), "state.json")
+	state, err := gmailalert.LoadState(file)
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+
+	want := gmailalert.AlertState{
+		Notified:   time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC),
+		MessageIDs: []string{"id0", "id1"},
+	}
+	state.Set("my-alert", want)
+	if err := state.Save(); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+
+	loaded, err := gmailalert.LoadState(file)
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	got := loaded.Get("my-alert")
+
+	if !cmp.Equal(want, got) {
+		t.Errorf("want != got\ndiff=%s", cmp.Diff(want, got))
+	}
+}
+
+func TestStateSaveAndLoadCompressedRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		file  string
+		magic []byte
+	}{
+		"Zstandard compressed state file": {
+			file:  "state.json.zst",
+			magic: []byte{0x28, 0xb5, 0x2f, 0xfd},
+		},
+		"Gzip compressed state file": {
+			file:  "state.json.gz",
+			magic: []byte{0x1f, 0x8b},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), tc.file)
+			state, err := gmailalert.LoadState(file)
+			if err != nil {
+				t.Fatalf("got unexpected error: %v", err)
+			}
+			want := gmailalert.AlertState{
+				Notified:   time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC),
+				MessageIDs: []string{"id0", "id1"},
+			}
+			state.Set("my-alert", want)
+			if err := state.Save(); err != nil {
+				t.Fatalf("got unexpected error: %v", err)
+			}
+
+			b, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasPrefix(b, tc.magic) {
+				t.Fatalf("want state file starting with %x, got %q", tc.magic, b)
+			}
+			loaded, err := gmailalert.LoadState(file)
+			if err != nil {
+				t.Fatalf("got unexpected error: %v", err)
+			}
+			if got := loaded.Get("my-alert"); !cmp.Equal(want, got) {
+				t.Errorf("want != got\ndiff=%s", cmp.Diff(want, got))
+			}
+		})
+	}
+}
+
+func TestStateTxCommitAndRollback(t *testing.T) {
+	t.Parallel()
+
+	state, err := gmailalert.LoadState(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	want := gmailalert.AlertState{MessageIDs: []string{"id0"}}
+
+	rolledBack := state.Begin()
+	rolledBack.Set("my-alert", want)
+	rolledBack.Rollback()
+	if got := state.Get("my-alert"); !cmp.Equal(gmailalert.AlertState{}, got) {
+		t.Errorf("wanted rolled back changes to be discarded, got %+v", got)
+	}
+
+	tx := state.Begin()
+	tx.Set("my-alert", want)
+	if got := tx.Get("my-alert"); !cmp.Equal(want, got) {
+		t.Errorf("wanted staged changes to be seen through the transaction\ndiff=%s", cmp.Diff(want, got))
+	}
+	if got := state.Get("my-alert"); !cmp.Equal(gmailalert.AlertState{}, got) {
+		t.Errorf("wanted uncommitted changes to be hidden from the state, got %+v", got)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if got := state.Get("my-alert"); !cmp.Equal(want, got) {
+		t.Errorf("want != got\ndiff=%s", cmp.Diff(want, got))
+	}
+}
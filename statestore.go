@@ -0,0 +1,681 @@
+package gmailalert
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	// The pure Go SQLite driver of the sqlite state backend, registered as
+	// "sqlite", which keeps gmailalert a single binary without cgo.
+	_ "modernc.org/sqlite"
+)
+
+// StateStore is the interface wrapping the methods used by a State to
+// persist the notification history of alerts.
+//
+// Load returns the AlertStates of all alerts by their keys, or an empty or
+// nil map if nothing was saved yet. Save replaces the saved AlertStates with
+// the given ones as a whole, so that a failed Save leaves the previously
+// saved AlertStates intact.
+type StateStore interface {
+	Load() (map[string]AlertState, error)
+	Save(alerts map[string]AlertState) error
+}
+
+// AlertStateStore is the interface wrapping the methods of a StateStore
+// keeping the AlertState of each alert separately, so that several instances
+// can share it. SaveAlerts saves the given AlertStates under their keys,
+// leaving the saved AlertStates of other keys intact, so that an instance
+// only overwrites the AlertStates of the alerts it changed.
+type AlertStateStore interface {
+	StateStore
+	SaveAlerts(alerts map[string]AlertState) error
+}
+
+// The backends of a StateConfig.
+const (
+	StateBackendFile   = "file"
+	StateBackendSQLite = "sqlite"
+	StateBackendRedis  = "redis"
+)
+
+// StateConfig represents the configuration of the StateStore holding the
+// notification history.
+type StateConfig struct {
+	// The backend to store the notification history in, either "file" to
+	// keep it in the JSON file given by the -state-file flag, "sqlite" to
+	// keep it in the SQLite database file given by the -state-file flag,
+	// which instances on the same host can share, or "redis" to share it
+	// between instances through a Redis server. If empty, "file" is used.
+	Backend string `json:"backend"`
+	// The address of the Redis server in the form "host:port".
+	Address string `json:"address"`
+	// The optional password to authenticate to the Redis server with.
+	Password string `json:"password"`
+	// The Redis database number.
+	DB int `json:"db"`
+	// The Redis key to store the notification history under. If empty,
+	// "gmailalert:state" is used.
+	Key string `json:"key"`
+}
+
+// openState returns the State of the cliEnv receiver app, stored in the
+// backend described by the given StateConfig, which may be nil. With the
+// file backend, a nil State is returned if no state file is set. With the
+// Redis backend, the name of the profile, if any, is appended to the key.
+// An error is returned if the StateConfig is invalid or the State cannot be
+// loaded.
+func (app cliEnv) openState(cfg *StateConfig) (*State, error) {
+	backend := StateBackendFile
+	if cfg != nil && cfg.Backend != "" {
+		backend = cfg.Backend
+	}
+	switch backend {
+	case StateBackendFile:
+		if app.stateFile == "" {
+			return nil, nil
+		}
+		return LoadState(app.stateFile)
+	case StateBackendSQLite:
+		store, err := NewSQLiteStateStore(app.stateFile)
+		if err != nil {
+			return nil, err
+		}
+		return OpenState(store)
+	case StateBackendRedis:
+	default:
+		return nil, fmt.Errorf("state backend must be %q, %q, or %q, got %q",
+			StateBackendFile, StateBackendSQLite, StateBackendRedis, cfg.Backend)
+	}
+
+	redisCfg := *cfg
+	if app.profile != "" {
+		redisCfg.Key = firstNonEmpty(redisCfg.Key, defaultRedisStateKey) + ":" + app.profile
+	}
+	store, err := NewRedisStateStore(redisCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return OpenState(store)
+}
+
+// fileStateStore represents a StateStore keeping the notification history
+// as JSON in a local file, compressed with Zstandard if the file name ends
+// in ".zst", or with gzip if it ends in ".gz".
+type fileStateStore struct {
+	file string
+}
+
+// Load reads the AlertStates from the file of the receiver f, decompressing
+// it if it is Zstandard or gzip compressed, whatever its name. A nil map is
+// returned if the file does not exist.
+func (f fileStateStore) Load() (map[string]AlertState, error) {
+	file, err := os.Open(f.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("got error opening state file %s: %v", f.file, err)
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	var dec *json.Decoder
+	magic, _ := r.Peek(len(zstdMagic))
+	switch {
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("got error decompressing state file %s: %v", f.file, err)
+		}
+		defer zr.Close()
+		dec = json.NewDecoder(zr)
+	case bytes.HasPrefix(magic, gzipMagic):
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("got error decompressing state file %s: %v", f.file, err)
+		}
+		defer zr.Close()
+		dec = json.NewDecoder(zr)
+	default:
+		dec = json.NewDecoder(r)
+	}
+
+	var alerts map[string]AlertState
+	if err := dec.Decode(&alerts); err != nil {
+		return nil, fmt.Errorf("got error json-decoding state file %s: %v", f.file, err)
+	}
+
+	return alerts, nil
+}
+
+// Save writes the given AlertStates into the file of the receiver f. The
+// file is replaced in a single step, so that it is left intact if the
+// AlertStates cannot be written.
+func (f fileStateStore) Save(alerts map[string]AlertState) error {
+	w, err := os.CreateTemp(filepath.Dir(f.file), filepath.Base(f.file)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("got error creating temporary file for state file %s: %v", f.file, err)
+	}
+	defer os.Remove(w.Name())
+
+	var enc io.Writer = w
+	var zw io.WriteCloser
+	switch {
+	case strings.HasSuffix(f.file, ".zst"):
+		if zw, err = zstd.NewWriter(w); err != nil {
+			w.Close()
+			return fmt.Errorf("got error compressing state file %s: %v", f.file, err)
+		}
+		enc = zw
+	case strings.HasSuffix(f.file, ".gz"):
+		zw = gzip.NewWriter(w)
+		enc = zw
+	}
+	if err := json.NewEncoder(enc).Encode(alerts); err != nil {
+		w.Close()
+		return fmt.Errorf("got error writing state file %s: %v", f.file, err)
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			w.Close()
+			return fmt.Errorf("got error compressing state file %s: %v", f.file, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("got error writing state file %s: %v", f.file, err)
+	}
+	if err := os.Rename(w.Name(), f.file); err != nil {
+		return fmt.Errorf("got error replacing state file %s: %v", f.file, err)
+	}
+
+	return nil
+}
+
+// The first bytes of gzip and Zstandard compressed data.
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// sqliteStateSchema creates the table of a SQLiteStateStore, holding the
+// AlertState of each alert as JSON.
+const sqliteStateSchema = `CREATE TABLE IF NOT EXISTS alert_states (
+	alert TEXT PRIMARY KEY,
+	state TEXT NOT NULL
+)`
+
+// SQLiteStateStore is an AlertStateStore keeping the notification history in
+// a SQLite database file, with the AlertState of each alert as JSON in its
+// own row, so that instances on the same host, like a daemon and one-off
+// runs, can share it. The database is opened for every Load and Save, and
+// waits for the locks of other instances for up to 10s.
+type SQLiteStateStore struct {
+	file string
+}
+
+// NewSQLiteStateStore accepts the name of a SQLite database file and returns
+// a new SQLiteStateStore keeping the notification history in it. The file is
+// created on the first Save if it does not exist. An error is returned if
+// the file name is empty.
+func NewSQLiteStateStore(file string) (*SQLiteStateStore, error) {
+	if file == "" {
+		return nil, errors.New("sqlite state file name must not be empty")
+	}
+
+	return &SQLiteStateStore{file: file}, nil
+}
+
+// Load reads the AlertStates from the database of the receiver s. A nil map
+// is returned if no AlertStates were saved yet. An error is returned if the
+// database cannot be read or a stored AlertState cannot be decoded.
+func (s *SQLiteStateStore) Load() (map[string]AlertState, error) {
+	var alerts map[string]AlertState
+	err := s.do(func(tx *sql.Tx) error {
+		rows, err := tx.Query("SELECT alert, state FROM alert_states")
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var key, value string
+			if err := rows.Scan(&key, &value); err != nil {
+				return err
+			}
+			var as AlertState
+			if err := json.Unmarshal([]byte(value), &as); err != nil {
+				return fmt.Errorf("got error json-decoding state of alert %q: %v", key, err)
+			}
+			if alerts == nil {
+				alerts = map[string]AlertState{}
+			}
+			alerts[key] = as
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("got error reading sqlite state file %s: %v", s.file, err)
+	}
+
+	return alerts, nil
+}
+
+// Save replaces the AlertStates in the database of the receiver s with the
+// given ones in a single transaction. An error is returned if the
+// AlertStates cannot be encoded or written.
+func (s *SQLiteStateStore) Save(alerts map[string]AlertState) error {
+	err := s.do(func(tx *sql.Tx) error {
+		if _, err := tx.Exec("DELETE FROM alert_states"); err != nil {
+			return err
+		}
+		return saveSQLiteAlerts(tx, alerts)
+	})
+	if err != nil {
+		return fmt.Errorf("got error writing sqlite state file %s: %v", s.file, err)
+	}
+
+	return nil
+}
+
+// SaveAlerts writes the given AlertStates into their rows of the database of
+// the receiver s in a single transaction, leaving the other rows intact. An
+// error is returned if the AlertStates cannot be encoded or written.
+func (s *SQLiteStateStore) SaveAlerts(alerts map[string]AlertState) error {
+	if err := s.do(func(tx *sql.Tx) error { return saveSQLiteAlerts(tx, alerts) }); err != nil {
+		return fmt.Errorf("got error writing sqlite state file %s: %v", s.file, err)
+	}
+
+	return nil
+}
+
+// do opens the database of the receiver s, creating its table if needed,
+// and calls the given function within a transaction, which is committed if
+// the function returns no error and rolled back otherwise.
+func (s *SQLiteStateStore) do(fn func(tx *sql.Tx) error) error {
+	db, err := sql.Open("sqlite", s.file+"?_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if _, err := db.Exec(sqliteStateSchema); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// saveSQLiteAlerts inserts the given AlertStates as JSON into their rows
+// with the given transaction, replacing the rows stored under their keys.
+func saveSQLiteAlerts(tx *sql.Tx, alerts map[string]AlertState) error {
+	stmt, err := tx.Prepare("INSERT INTO alert_states (alert, state) VALUES (?, ?) " +
+		"ON CONFLICT (alert) DO UPDATE SET state = excluded.state")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for key, as := range alerts {
+		value, err := json.Marshal(as)
+		if err != nil {
+			return fmt.Errorf("got error json-encoding state of alert %q: %v", key, err)
+		}
+		if _, err := stmt.Exec(key, string(value)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// defaultRedisStateKey is the Redis key the notification history is stored
+// under unless another one is configured.
+const defaultRedisStateKey = "gmailalert:state"
+
+// RedisStateStore is an AlertStateStore keeping the notification history in
+// a hash under a single key of a Redis server, with the AlertState of each
+// alert as JSON in its own field, so that redundant instances share it. It
+// speaks the Redis protocol directly over a new connection for every Load
+// and Save.
+type RedisStateStore struct {
+	cfg     StateConfig
+	timeout time.Duration
+}
+
+// NewRedisStateStore accepts a StateConfig and returns a new
+// RedisStateStore. An error is returned if the address is empty or the
+// database number is negative.
+func NewRedisStateStore(cfg StateConfig) (*RedisStateStore, error) {
+	if cfg.Address == "" {
+		return nil, errors.New("redis state address must not be empty")
+	}
+	if cfg.DB < 0 {
+		return nil, fmt.Errorf("redis state database must not be negative, got %d", cfg.DB)
+	}
+	if cfg.Key == "" {
+		cfg.Key = defaultRedisStateKey
+	}
+
+	return &RedisStateStore{cfg: cfg, timeout: 10 * time.Second}, nil
+}
+
+// Load reads the AlertStates from the hash under the key of the receiver r.
+// A nil map is returned if the key does not exist. The notification history
+// of older versions, stored as a single JSON string under the key, is read
+// and converted to a hash. An error is returned if the Redis server cannot
+// be reached or the stored value cannot be decoded.
+func (r *RedisStateStore) Load() (map[string]AlertState, error) {
+	var alerts map[string]AlertState
+	var legacy bool
+	err := r.do(func(c *redisConn) error {
+		kind, err := c.command("TYPE", r.cfg.Key)
+		if err != nil {
+			return err
+		}
+		switch string(kind) {
+		case "none":
+			return nil
+		case "string":
+			legacy = true
+			value, err := c.command("GET", r.cfg.Key)
+			if err != nil || value == nil {
+				return err
+			}
+			if err := json.Unmarshal(value, &alerts); err != nil {
+				return fmt.Errorf("got error json-decoding state key %s: %v", r.cfg.Key, err)
+			}
+			return nil
+		case "hash":
+		default:
+			return fmt.Errorf("state key %s must hold a hash, got a %s", r.cfg.Key, kind)
+		}
+
+		fields, err := c.list("HGETALL", r.cfg.Key)
+		if err != nil {
+			return err
+		}
+		alerts = make(map[string]AlertState, len(fields)/2)
+		for i := 0; i+1 < len(fields); i += 2 {
+			var as AlertState
+			if err := json.Unmarshal(fields[i+1], &as); err != nil {
+				return fmt.Errorf("got error json-decoding field %s of state key %s: %v", fields[i], r.cfg.Key, err)
+			}
+			alerts[string(fields[i])] = as
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if legacy {
+		if err := r.Save(alerts); err != nil {
+			return nil, fmt.Errorf("got error converting state key %s to a hash: %v", r.cfg.Key, err)
+		}
+	}
+
+	return alerts, nil
+}
+
+// Save replaces the hash under the key of the receiver r with the given
+// AlertStates. The key is deleted and written again in a transaction, so
+// that the key is left intact if the AlertStates cannot be written and
+// instances saving at the same time cannot mix their AlertStates. An error
+// is returned if the AlertStates cannot be encoded or the Redis server
+// cannot be reached.
+func (r *RedisStateStore) Save(alerts map[string]AlertState) error {
+	args, err := redisHashArgs(alerts)
+	if err != nil {
+		return err
+	}
+
+	return r.do(func(c *redisConn) error {
+		cmds := [][]string{{"DEL", r.cfg.Key}}
+		if len(args) > 0 {
+			cmds = append(cmds, append([]string{"HSET", r.cfg.Key}, args...))
+		}
+		return c.transaction(cmds...)
+	})
+}
+
+// SaveAlerts writes the given AlertStates into their fields of the hash
+// under the key of the receiver r, leaving the other fields intact. An error
+// is returned if the AlertStates cannot be encoded or the Redis server
+// cannot be reached.
+func (r *RedisStateStore) SaveAlerts(alerts map[string]AlertState) error {
+	args, err := redisHashArgs(alerts)
+	if err != nil || len(args) == 0 {
+		return err
+	}
+
+	return r.do(func(c *redisConn) error {
+		_, err := c.command(append([]string{"HSET", r.cfg.Key}, args...)...)
+		return err
+	})
+}
+
+// redisHashArgs returns the field and value arguments of an HSET command
+// setting the given AlertStates as JSON under their keys. An error is
+// returned if any AlertState cannot be encoded.
+func redisHashArgs(alerts map[string]AlertState) ([]string, error) {
+	args := make([]string, 0, 2*len(alerts))
+	for key, as := range alerts {
+		value, err := json.Marshal(as)
+		if err != nil {
+			return nil, fmt.Errorf("got error json-encoding state of alert %q: %v", key, err)
+		}
+		args = append(args, key, string(value))
+	}
+
+	return args, nil
+}
+
+// do connects to the Redis server of the receiver r, authenticates and
+// selects the configured database, and calls the given function with the
+// connection.
+func (r *RedisStateStore) do(fn func(c *redisConn) error) error {
+	conn, err := net.DialTimeout("tcp", r.cfg.Address, r.timeout)
+	if err != nil {
+		return fmt.Errorf("got error connecting to redis server %s: %v", r.cfg.Address, err)
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(r.timeout)); err != nil {
+		return err
+	}
+
+	c := &redisConn{rw: bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))}
+	if r.cfg.Password != "" {
+		if _, err := c.command("AUTH", r.cfg.Password); err != nil {
+			return err
+		}
+	}
+	if r.cfg.DB != 0 {
+		if _, err := c.command("SELECT", strconv.Itoa(r.cfg.DB)); err != nil {
+			return err
+		}
+	}
+
+	return fn(c)
+}
+
+// redisConn represents a connection to a Redis server.
+type redisConn struct {
+	rw *bufio.ReadWriter
+}
+
+// command sends a command made of the given arguments over the receiver c
+// and returns its reply. A nil reply is returned for a null bulk string. An
+// error is returned if the server replies with an error or an array, or the
+// reply cannot be read.
+func (c *redisConn) command(args ...string) ([]byte, error) {
+	line, err := c.send(args)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.reply(args[0], line)
+}
+
+// list sends a command made of the given arguments over the receiver c and
+// returns the elements of its array reply. An error is returned if the
+// server replies with an error or anything but an array of bulk strings, or
+// the reply cannot be read.
+func (c *redisConn) list(args ...string) ([][]byte, error) {
+	line, err := c.send(args)
+	if err != nil {
+		return nil, err
+	}
+	if line[0] != '*' {
+		_, err := c.reply(args[0], line)
+		if err == nil {
+			err = fmt.Errorf("got unexpected redis %s reply %q", args[0], line)
+		}
+		return nil, err
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return nil, fmt.Errorf("got invalid redis %s reply %q", args[0], line)
+	}
+	if n < 0 {
+		return nil, nil
+	}
+
+	elems := make([][]byte, 0, n)
+	for i := 0; i < n; i++ {
+		line, err := c.readLine(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if line[0] != '$' {
+			return nil, fmt.Errorf("got unexpected redis %s reply element %q", args[0], line)
+		}
+		elem, err := c.reply(args[0], line)
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, elem)
+	}
+
+	return elems, nil
+}
+
+// transaction sends the given commands, each made of its arguments, over the
+// receiver c between MULTI and EXEC, so that the server applies them
+// together. If sending fails before EXEC, the connection is closed by the
+// caller and the server discards them. An error is returned if the server
+// rejects any of the commands or their replies cannot be read.
+func (c *redisConn) transaction(cmds ...[]string) error {
+	if _, err := c.command("MULTI"); err != nil {
+		return err
+	}
+	for _, args := range cmds {
+		if _, err := c.command(args...); err != nil {
+			return err
+		}
+	}
+
+	line, err := c.send([]string{"EXEC"})
+	if err != nil {
+		return err
+	}
+	if line[0] != '*' {
+		_, err := c.reply("EXEC", line)
+		if err == nil {
+			err = fmt.Errorf("got unexpected redis EXEC reply %q", line)
+		}
+		return err
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n != len(cmds) {
+		return fmt.Errorf("got invalid redis EXEC reply %q", line)
+	}
+	for _, args := range cmds {
+		line, err := c.readLine(args[0])
+		if err != nil {
+			return err
+		}
+		if _, err := c.reply(args[0], line); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// send sends a command made of the given arguments over the receiver c and
+// returns the first line of its reply, without its line ending.
+func (c *redisConn) send(args []string) (string, error) {
+	fmt.Fprintf(c.rw, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(c.rw, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if err := c.rw.Flush(); err != nil {
+		return "", fmt.Errorf("got error sending redis %s command: %v", args[0], err)
+	}
+
+	return c.readLine(args[0])
+}
+
+// readLine reads a line of the reply to the command with the given name
+// from the receiver c and returns it without its line ending. An error is
+// returned if the line is empty or cannot be read.
+func (c *redisConn) readLine(cmd string) (string, error) {
+	line, err := c.rw.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("got error reading redis %s reply: %v", cmd, err)
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return "", fmt.Errorf("got empty redis %s reply", cmd)
+	}
+
+	return line, nil
+}
+
+// reply returns the value of the reply to the command with the given name
+// starting with the given line, reading the rest of a bulk string from the
+// receiver c. A nil value is returned for a null bulk string. An error is
+// returned if the reply is an error or cannot be read.
+func (c *redisConn) reply(cmd, line string) ([]byte, error) {
+	switch line[0] {
+	case '+', ':':
+		return []byte(line[1:]), nil
+	case '-':
+		return nil, fmt.Errorf("got error from redis %s command: %s", cmd, line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("got invalid redis %s reply %q", cmd, line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		value := make([]byte, n+2)
+		if _, err := io.ReadFull(c.rw, value); err != nil {
+			return nil, fmt.Errorf("got error reading redis %s reply: %v", cmd, err)
+		}
+		return value[:n], nil
+	default:
+		return nil, fmt.Errorf("got unexpected redis %s reply %q", cmd, line)
+	}
+}
@@ -0,0 +1,500 @@
+package gmailalert
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRedisStateStoreSaveAndLoadRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	svr := newFakeRedis(t, "s3cret")
+	store, err := NewRedisStateStore(StateConfig{Address: svr.addr, Password: "s3cret", DB: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	empty, err := store.Load()
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if empty != nil {
+		t.Errorf("wanted no state before the first save, got %v", empty)
+	}
+
+	want := map[string]AlertState{
+		"my-alert": {
+			Notified:   time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC),
+			MessageIDs: []string{"id0", "id1"},
+		},
+	}
+	if err := store.Save(want); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	got, err := store.Load()
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+
+	if !cmp.Equal(want, got) {
+		t.Errorf("want != got\ndiff=%s", cmp.Diff(want, got))
+	}
+	if _, ok := svr.value("2/gmailalert:state"); !ok {
+		t.Errorf("wanted the state to be stored under the default key of database 2")
+	}
+}
+
+func TestRedisStateStoreWithWrongPasswordReturnsError(t *testing.T) {
+	t.Parallel()
+
+	svr := newFakeRedis(t, "s3cret")
+	store, err := NewRedisStateStore(StateConfig{Address: svr.addr, Password: "wrong"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Load(); err == nil {
+		t.Error("expected an error but did not get one")
+	}
+}
+
+func TestOpenState(t *testing.T) {
+	t.Parallel()
+
+	svr := newFakeRedis(t, "")
+	testCases := map[string]struct {
+		app         cliEnv
+		cfg         *StateConfig
+		wantNil     bool
+		wantKey     string
+		errExpected bool
+	}{
+		"No state file and no config returns a nil State": {
+			wantNil: true,
+		},
+		"Redis backend of a profile appends the profile to the key": {
+			app:     cliEnv{profile: "alice"},
+			cfg:     &StateConfig{Backend: "redis", Address: svr.addr, Key: "alerts"},
+			wantKey: "0/alerts:alice",
+		},
+		"Redis backend without an address returns an error": {
+			cfg:         &StateConfig{Backend: "redis"},
+			errExpected: true,
+		},
+		"SQLite backend without a state file returns an error": {
+			cfg:         &StateConfig{Backend: StateBackendSQLite},
+			errExpected: true,
+		},
+		"Unknown backend returns an error": {
+			cfg:         &StateConfig{Backend: "mongodb"},
+			errExpected: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			state, err := tc.app.openState(tc.cfg)
+			errReceived := err != nil
+
+			if tc.errExpected != errReceived {
+				t.Fatalf("got unexpected error status, got error: %v", err)
+			}
+			if tc.errExpected {
+				return
+			}
+			if tc.wantNil {
+				if state != nil {
+					t.Errorf("wanted a nil State, got %v", state)
+				}
+				return
+			}
+			state.Set("my-alert", AlertState{})
+			if err := state.Save(); err != nil {
+				t.Fatalf("got unexpected error: %v", err)
+			}
+			if _, ok := svr.value(tc.wantKey); !ok {
+				t.Errorf("wanted the state to be stored under %q", tc.wantKey)
+			}
+		})
+	}
+}
+
+func TestRedisStateStoreConvertsLegacyState(t *testing.T) {
+	t.Parallel()
+
+	svr := newFakeRedis(t, "")
+	svr.values["0/gmailalert:state"] = `{"my-alert":{"messageids":["id0"]}}`
+	store, err := NewRedisStateStore(StateConfig{Address: svr.addr})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := store.Load()
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+
+	want := map[string]AlertState{"my-alert": {MessageIDs: []string{"id0"}}}
+	if !cmp.Equal(want, got) {
+		t.Errorf("want != got\ndiff=%s", cmp.Diff(want, got))
+	}
+	if _, ok := svr.field("0/gmailalert:state", "my-alert"); !ok {
+		t.Error("wanted the legacy state to be converted to a hash")
+	}
+}
+
+func TestRedisStateStoreSavesOfInstancesDoNotMix(t *testing.T) {
+	t.Parallel()
+
+	svr := newFakeRedis(t, "")
+	saved := make([]map[string]AlertState, 8)
+	errs := make([]error, len(saved))
+	var wg sync.WaitGroup
+	for i := range saved {
+		store, err := NewRedisStateStore(StateConfig{Address: svr.addr})
+		if err != nil {
+			t.Fatal(err)
+		}
+		saved[i] = map[string]AlertState{
+			fmt.Sprintf("alert%d", i):   {MessageIDs: []string{strconv.Itoa(i)}},
+			fmt.Sprintf("alert%d-b", i): {MessageIDs: []string{strconv.Itoa(i)}},
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = store.Save(saved[i])
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+	}
+	store, err := NewRedisStateStore(StateConfig{Address: svr.addr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.Load()
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	found := false
+	for _, want := range saved {
+		found = found || cmp.Equal(want, got)
+	}
+	if !found {
+		t.Errorf("wanted the state saved by exactly one instance, got %v", got)
+	}
+	if want, got := []string{"0/gmailalert:state"}, svr.keys(); !cmp.Equal(want, got) {
+		t.Errorf("want != got\ndiff=%s", cmp.Diff(want, got))
+	}
+}
+
+func TestStateSharedBetweenInstances(t *testing.T) {
+	t.Parallel()
+
+	svr := newFakeRedis(t, "")
+	testCases := map[string]func(t *testing.T) StateStore{
+		"Redis": func(t *testing.T) StateStore {
+			store, err := NewRedisStateStore(StateConfig{Address: svr.addr, Key: t.Name()})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return store
+		},
+		"SQLite": func(t *testing.T) StateStore {
+			store, err := NewSQLiteStateStore(filepath.Join(t.TempDir(), "state.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return store
+		},
+	}
+
+	for name, newStore := range testCases {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			leader, err := OpenState(store)
+			if err != nil {
+				t.Fatal(err)
+			}
+			standby, err := OpenState(store)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			notified := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+			tx := leader.Begin()
+			tx.Set("orders", AlertState{Notified: notified, MessageIDs: []string{"id0"}})
+			if err := tx.Commit(); err != nil {
+				t.Fatal(err)
+			}
+			if err := leader.Save(); err != nil {
+				t.Fatal(err)
+			}
+			standby.Set("bills", AlertState{Notified: notified})
+			if err := standby.Save(); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := store.Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := map[string]AlertState{
+				"orders": {Notified: notified, MessageIDs: []string{"id0"}},
+				"bills":  {Notified: notified},
+			}
+			if !cmp.Equal(want, got) {
+				t.Errorf("wanted the saves of both instances kept\ndiff=%s", cmp.Diff(want, got))
+			}
+			if err := standby.Reload(); err != nil {
+				t.Fatal(err)
+			}
+			if !cmp.Equal(want["orders"], standby.Get("orders")) {
+				t.Errorf("wanted the reloaded state to have the leader's changes\ndiff=%s", cmp.Diff(want["orders"], standby.Get("orders")))
+			}
+		})
+	}
+}
+
+func TestStateReloadKeepsUnsavedChanges(t *testing.T) {
+	t.Parallel()
+
+	store, err := NewSQLiteStateStore(filepath.Join(t.TempDir(), "state.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(map[string]AlertState{"orders": {MessageIDs: []string{"saved"}}}); err != nil {
+		t.Fatal(err)
+	}
+	state, err := OpenState(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.Set("orders", AlertState{MessageIDs: []string{"unsaved"}})
+
+	if err := state.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := AlertState{MessageIDs: []string{"unsaved"}}
+	if got := state.Get("orders"); !cmp.Equal(want, got) {
+		t.Errorf("want != got\ndiff=%s", cmp.Diff(want, got))
+	}
+}
+
+// fakeRedis represents a test double Redis server supporting the AUTH,
+// SELECT, TYPE, GET, SET, DEL, HSET, and HGETALL commands, and MULTI and
+// EXEC transactions. Its values and hashes are stored by the selected
+// database number and key, separated by a slash.
+type fakeRedis struct {
+	addr     string
+	password string
+	mtx      sync.Mutex
+	values   map[string]string
+	hashes   map[string]map[string]string
+}
+
+// newFakeRedis returns a fakeRedis listening on a local address, requiring
+// the given password if it is not empty. The server is closed when the test
+// ends.
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	f := &fakeRedis{addr: l.Addr().String(), password: password, values: map[string]string{}, hashes: map[string]map[string]string{}}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+
+	return f
+}
+
+// value returns the value stored under the given database-qualified key,
+// and whether a value or a hash is stored under it.
+func (f *fakeRedis) value(key string) (string, bool) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	v, ok := f.values[key]
+	_, isHash := f.hashes[key]
+	return v, ok || isHash
+}
+
+// field returns the field with the given name of the hash stored under the
+// given database-qualified key.
+func (f *fakeRedis) field(key, name string) (string, bool) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	v, ok := f.hashes[key][name]
+	return v, ok
+}
+
+// keys returns the database-qualified keys of the values and hashes stored
+// by the fakeRedis, sorted.
+func (f *fakeRedis) keys() []string {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	var keys []string
+	for k := range f.values {
+		keys = append(keys, k)
+	}
+	for k := range f.hashes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// serve answers the commands read from the given connection until it is
+// closed. The commands of a transaction are queued until EXEC and then run
+// together.
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	db, authed := "0", f.password == ""
+	var queued [][]string
+	inTx := false
+	for {
+		args, err := readRedisCommand(r)
+		if err != nil {
+			return
+		}
+
+		f.mtx.Lock()
+		switch cmd := strings.ToUpper(args[0]); {
+		case cmd == "AUTH" && args[1] == f.password:
+			authed = true
+			fmt.Fprint(conn, "+OK\r\n")
+		case cmd == "AUTH":
+			fmt.Fprint(conn, "-WRONGPASS invalid password\r\n")
+		case !authed:
+			fmt.Fprint(conn, "-NOAUTH Authentication required.\r\n")
+		case cmd == "MULTI":
+			inTx, queued = true, nil
+			fmt.Fprint(conn, "+OK\r\n")
+		case cmd == "EXEC" && !inTx:
+			fmt.Fprint(conn, "-ERR EXEC without MULTI\r\n")
+		case cmd == "EXEC":
+			fmt.Fprintf(conn, "*%d\r\n", len(queued))
+			for _, args := range queued {
+				f.run(conn, &db, args)
+			}
+			inTx, queued = false, nil
+		case inTx:
+			queued = append(queued, args)
+			fmt.Fprint(conn, "+QUEUED\r\n")
+		default:
+			f.run(conn, &db, args)
+		}
+		f.mtx.Unlock()
+	}
+}
+
+// run runs the command made of the given arguments against the selected
+// database pointed to by db and writes its reply to the given io.Writer.
+// The caller must hold the fakeRedis's mutex.
+func (f *fakeRedis) run(w io.Writer, db *string, args []string) {
+	switch cmd := strings.ToUpper(args[0]); cmd {
+	case "SELECT":
+		*db = args[1]
+		fmt.Fprint(w, "+OK\r\n")
+	case "SET":
+		f.values[*db+"/"+args[1]] = args[2]
+		fmt.Fprint(w, "+OK\r\n")
+	case "GET":
+		if v, ok := f.values[*db+"/"+args[1]]; ok {
+			fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+		} else {
+			fmt.Fprint(w, "$-1\r\n")
+		}
+	case "TYPE":
+		kind := "none"
+		if _, ok := f.values[*db+"/"+args[1]]; ok {
+			kind = "string"
+		} else if _, ok := f.hashes[*db+"/"+args[1]]; ok {
+			kind = "hash"
+		}
+		fmt.Fprintf(w, "+%s\r\n", kind)
+	case "DEL":
+		delete(f.values, *db+"/"+args[1])
+		delete(f.hashes, *db+"/"+args[1])
+		fmt.Fprint(w, ":1\r\n")
+	case "HSET":
+		key := *db + "/" + args[1]
+		if _, ok := f.values[key]; ok {
+			fmt.Fprint(w, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n")
+			return
+		}
+		if f.hashes[key] == nil {
+			f.hashes[key] = map[string]string{}
+		}
+		for i := 2; i+1 < len(args); i += 2 {
+			f.hashes[key][args[i]] = args[i+1]
+		}
+		fmt.Fprintf(w, ":%d\r\n", (len(args)-2)/2)
+	case "HGETALL":
+		h := f.hashes[*db+"/"+args[1]]
+		fmt.Fprintf(w, "*%d\r\n", 2*len(h))
+		for k, v := range h {
+			fmt.Fprintf(w, "$%d\r\n%s\r\n$%d\r\n%s\r\n", len(k), k, len(v), v)
+		}
+	default:
+		fmt.Fprintf(w, "-ERR unknown command %s\r\n", cmd)
+	}
+}
+
+// readRedisCommand reads a command sent as an array of bulk strings from the
+// given reader and returns its arguments.
+func readRedisCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("invalid command header %q", line)
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, fmt.Errorf("invalid argument header %q", line)
+		}
+		arg := make([]byte, size+2)
+		if _, err := io.ReadFull(r, arg); err != nil {
+			return nil, err
+		}
+		args[i] = string(arg[:size])
+	}
+
+	return args, nil
+}
@@ -0,0 +1,253 @@
+package gmailalert
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxStatsSenders is the number of busiest senders reported for each alert.
+const maxStatsSenders = 3
+
+// alertStats represents the statistics of an alert computed from its
+// history over a time window.
+type alertStats struct {
+	// The name of the alert, or its Gmail query if it has no name.
+	Alert string `json:"alert"`
+	// The number of evaluations of the alert.
+	Runs int `json:"runs"`
+	// The number of evaluations that sent a notification.
+	Notified int `json:"notified"`
+	// The number of evaluations whose notification was suppressed.
+	Suppressed int `json:"suppressed"`
+	// The number of evaluations that ended in an error.
+	Failed int `json:"failed"`
+	// The average number of notifications sent per day.
+	FiresPerDay float64 `json:"firesperday"`
+	// The average number of matching emails per evaluation.
+	AvgMatches float64 `json:"avgmatches"`
+	// The share of evaluations that ended in an error, between 0 and 1.
+	FailureRate float64 `json:"failurerate"`
+	// The number of emails found by backfills.
+	Backfilled int `json:"backfilled"`
+	// The senders of the most matching emails, busiest first.
+	TopSenders []senderCount `json:"topsenders"`
+}
+
+// senderCount represents the number of matching emails from a sender.
+type senderCount struct {
+	Sender string `json:"sender"`
+	Emails int    `json:"emails"`
+}
+
+// statsCLI accepts the command line flags of the "stats" subcommand, which
+// computes the statistics of the alert named by the "-alert" flag, or of
+// every alert if it is empty, from the history file over the time window
+// given by the "-window" flag, and prints them as a table or as JSON, or in
+// the format given by the "-report-format" flag if it is set. An error is
+// returned if the flags are invalid or the alert configuration or history
+// file cannot be loaded.
+func statsCLI(args []string) error {
+	var app cliEnv
+	var alertName, format, reportFormat string
+	var window time.Duration
+
+	fs := app.flagSet("stats")
+	fs.StringVar(
+		&alertName,
+		"alert",
+		"",
+		"the name (or gmail query) of the alert to report statistics for (all alerts if empty)")
+	fs.DurationVar(
+		&window,
+		"window",
+		0,
+		"how far back from now to compute statistics over, like 168h (the whole history if 0)")
+	fs.StringVar(
+		&format,
+		"format",
+		"table",
+		`the output format, either "table" or "json"`)
+	fs.StringVar(
+		&reportFormat,
+		"report-format",
+		"",
+		`the report format, one of "table", "csv", or "markdown", used instead of -format (unused if empty)`)
+	if err := app.parse(fs, args); err != nil {
+		return err
+	}
+	if app.historyFile == "" {
+		fs.Usage()
+		return errors.New(`command line flag "-history-file" must be non-empty`)
+	}
+
+	app, _, err := app.profileConfig()
+	if err != nil {
+		return err
+	}
+	history, err := NewHistory(app.historyFile)
+	if err != nil {
+		return err
+	}
+	recs, err := history.Records()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	stats := computeStats(recs, alertName, window, now)
+	if alertName != "" && len(stats) == 0 {
+		return fmt.Errorf("no history found for alert %q", alertName)
+	}
+	if reportFormat != "" {
+		return statsReport(stats, windowNote(window, now)).write(reportFormat, os.Stdout)
+	}
+
+	return writeStats(stats, format, os.Stdout)
+}
+
+// computeStats returns the statistics of every alert with HistoryRecords
+// among the given ones, or only of the alert with the given name if it is
+// not empty, sorted by alert name. Only the records within the given window
+// before now are used, or every record if the window is zero. Fires per day
+// are averaged over the window, or over the time since the oldest record if
+// the window is zero.
+func computeStats(recs []HistoryRecord, alertName string, window time.Duration, now time.Time) []alertStats {
+	byAlert := map[string]*alertStats{}
+	senders := map[string]map[string]int{}
+	oldest := now
+	for _, rec := range windowRecords(recs, alertName, window, now) {
+		if rec.Time.Before(oldest) {
+			oldest = rec.Time
+		}
+
+		s, ok := byAlert[rec.Alert]
+		if !ok {
+			s = &alertStats{Alert: rec.Alert}
+			byAlert[rec.Alert] = s
+			senders[rec.Alert] = map[string]int{}
+		}
+		for _, sender := range rec.Senders {
+			senders[rec.Alert][senderAddress(sender)]++
+		}
+		if rec.Backfill {
+			s.Backfilled += rec.Matches
+			continue
+		}
+
+		s.Runs++
+		s.AvgMatches += float64(rec.Matches)
+		switch {
+		case rec.Error != "":
+			s.Failed++
+		case rec.Notified:
+			s.Notified++
+		case rec.Suppressed:
+			s.Suppressed++
+		}
+	}
+
+	days := now.Sub(oldest).Hours() / 24
+	if window > 0 {
+		days = window.Hours() / 24
+	}
+	stats := make([]alertStats, 0, len(byAlert))
+	for name, s := range byAlert {
+		if s.Runs > 0 {
+			s.AvgMatches /= float64(s.Runs)
+			s.FailureRate = float64(s.Failed) / float64(s.Runs)
+		}
+		if days > 0 {
+			s.FiresPerDay = float64(s.Notified) / days
+		}
+		s.TopSenders = topSenders(senders[name], maxStatsSenders)
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Alert < stats[j].Alert })
+
+	return stats
+}
+
+// topSenders returns up to n of the given senders with the most emails,
+// busiest first, with ties broken by sender.
+func topSenders(counts map[string]int, n int) []senderCount {
+	top := make([]senderCount, 0, len(counts))
+	for sender, emails := range counts {
+		top = append(top, senderCount{Sender: sender, Emails: emails})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Emails != top[j].Emails {
+			return top[i].Emails > top[j].Emails
+		}
+		return top[i].Sender < top[j].Sender
+	})
+	if len(top) > n {
+		top = top[:n]
+	}
+
+	return top
+}
+
+// senderAddress returns the lower-cased address in the given From header
+// value, or the value itself if it holds no address.
+func senderAddress(from string) string {
+	addr, err := mail.ParseAddress(from)
+	if err != nil {
+		return from
+	}
+
+	return strings.ToLower(addr.Address)
+}
+
+// writeStats writes the given statistics to the given io.Writer in the given
+// format, either "table" or "json". An error is returned if the format is
+// unknown or the statistics cannot be written.
+func writeStats(stats []alertStats, format string, w io.Writer) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(stats); err != nil {
+			return fmt.Errorf("got error writing statistics: %v", err)
+		}
+		return nil
+	case "table":
+		return statsReport(stats, "").write("table", w)
+	}
+
+	return fmt.Errorf(`stats format must be "table" or "json", got %q`, format)
+}
+
+// statsReport returns a report with a row for the statistics of each alert,
+// described by the given note.
+func statsReport(stats []alertStats, note string) report {
+	r := report{
+		title:  "gmailalert statistics",
+		note:   note,
+		header: []string{"ALERT", "RUNS", "NOTIFIED", "FIRES/DAY", "AVG MATCHES", "FAILURE RATE", "TOP SENDERS"},
+	}
+	for _, s := range stats {
+		top := make([]string, 0, len(s.TopSenders))
+		for _, sc := range s.TopSenders {
+			top = append(top, fmt.Sprintf("%s (%d)", sc.Sender, sc.Emails))
+		}
+		r.rows = append(r.rows, []string{
+			s.Alert,
+			strconv.Itoa(s.Runs),
+			strconv.Itoa(s.Notified),
+			fmt.Sprintf("%.2f", s.FiresPerDay),
+			fmt.Sprintf("%.1f", s.AvgMatches),
+			fmt.Sprintf("%.0f%%", s.FailureRate*100),
+			strings.Join(top, ", "),
+		})
+	}
+
+	return r
+}
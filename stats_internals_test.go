@@ -0,0 +1,99 @@
+package gmailalert
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestComputeStats(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2023, 3, 11, 0, 0, 0, 0, time.UTC)
+	recs := []HistoryRecord{
+		{Time: now.AddDate(0, -1, 0), Alert: "Bill Due", Matches: 4, Senders: []string{"billing@bank.com", "billing@bank.com", "Shop <orders@shop.com>"}, Backfill: true},
+		{Time: now.AddDate(0, 0, -20), Alert: "Bill Due", Matches: 9, Notified: true},
+		{Time: now.AddDate(0, 0, -3), Alert: "Bill Due", Matches: 2, Notified: true, Senders: []string{"Bank <Billing@Bank.com>"}},
+		{Time: now.AddDate(0, 0, -2), Alert: "Bill Due", Matches: 2, Suppressed: true},
+		{Time: now.AddDate(0, 0, -1), Alert: "Bill Due", Matches: 0, Error: "quota exceeded"},
+		{Time: now.AddDate(0, 0, -1), Alert: "Orders", Matches: 1, Notified: true},
+	}
+	testCases := map[string]struct {
+		alertName string
+		window    time.Duration
+		want      []alertStats
+	}{
+		"Window only uses recent records": {
+			window: 10 * 24 * time.Hour,
+			want: []alertStats{
+				{
+					Alert: "Bill Due", Runs: 3, Notified: 1, Suppressed: 1, Failed: 1,
+					FiresPerDay: 0.1, AvgMatches: 4.0 / 3, FailureRate: 1.0 / 3,
+					TopSenders: []senderCount{{Sender: "billing@bank.com", Emails: 1}},
+				},
+				{Alert: "Orders", Runs: 1, Notified: 1, FiresPerDay: 0.1, AvgMatches: 1, TopSenders: []senderCount{}},
+			},
+		},
+		"Zero window uses the whole history of the named alert": {
+			alertName: "Bill Due",
+			want: []alertStats{
+				{
+					Alert: "Bill Due", Runs: 4, Notified: 2, Suppressed: 1, Failed: 1,
+					FiresPerDay: 2.0 / 28, AvgMatches: 13.0 / 4, FailureRate: 0.25, Backfilled: 4,
+					TopSenders: []senderCount{{Sender: "billing@bank.com", Emails: 3}, {Sender: "orders@shop.com", Emails: 1}},
+				},
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got := computeStats(recs, tc.alertName, tc.window, now)
+
+			if !cmp.Equal(tc.want, got) {
+				t.Errorf("want != got\ndiff=%s", cmp.Diff(tc.want, got))
+			}
+		})
+	}
+}
+
+func TestWriteStats(t *testing.T) {
+	t.Parallel()
+
+	stats := []alertStats{{
+		Alert: "Bill Due", Runs: 4, Notified: 2, FiresPerDay: 0.5, AvgMatches: 3.25, FailureRate: 0.25,
+		TopSenders: []senderCount{{Sender: "billing@bank.com", Emails: 3}},
+	}}
+	testCases := map[string]struct {
+		format      string
+		want        string
+		errExpected bool
+	}{
+		"Table format writes a row per alert": {
+			format: "table",
+			want: "ALERT     RUNS  NOTIFIED  FIRES/DAY  AVG MATCHES  FAILURE RATE  TOP SENDERS\n" +
+				"Bill Due  4     2         0.50       3.2          25%           billing@bank.com (3)\n",
+		},
+		"Unknown format returns an error": {
+			format:      "yaml",
+			errExpected: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := writeStats(stats, tc.format, &buf)
+			errReceived := err != nil
+
+			if tc.errExpected != errReceived {
+				t.Fatalf("got unexpected error status, got error: %v", err)
+			}
+			if got := buf.String(); !tc.errExpected && tc.want != got {
+				t.Errorf("want != got\ndiff=%s", cmp.Diff(tc.want, got))
+			}
+		})
+	}
+}
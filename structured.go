@@ -0,0 +1,76 @@
+package gmailalert
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// relativeAge matches the value of a Gmail "newer_than:" term, like "2d",
+// "3m", or "1y".
+var relativeAge = regexp.MustCompile(`^[1-9][0-9]*[dmy]$`)
+
+// structured reports whether any of the structured search fields of the
+// Alert are set.
+func (a Alert) structured() bool {
+	return a.From != "" || a.To != "" || a.Subject != "" || a.NewerThan != "" || a.Label != "" || a.HasAttachment
+}
+
+// structuredOK returns an error if the NewerThan of the Alert is set but is
+// not a relative age like "2d".
+func (a Alert) structuredOK() error {
+	if a.NewerThan != "" && !relativeAge.MatchString(a.NewerThan) {
+		return fmt.Errorf(`newerthan must be a number of days, months, or years like "2d", "3m", or "1y", got %q`, a.NewerThan)
+	}
+
+	return nil
+}
+
+// structuredQuery returns the Gmail query composed of the structured search
+// fields of the Alert, or an empty string if none are set.
+func (a Alert) structuredQuery() string {
+	var terms []string
+	if a.From != "" {
+		terms = append(terms, queryTerm("from", a.From))
+	}
+	if a.To != "" {
+		terms = append(terms, queryTerm("to", a.To))
+	}
+	if a.Subject != "" {
+		terms = append(terms, queryTerm("subject", a.Subject))
+	}
+	if a.Label != "" {
+		terms = append(terms, queryTerm("label", strings.Join(strings.Fields(a.Label), "-")))
+	}
+	if a.HasAttachment {
+		terms = append(terms, "has:attachment")
+	}
+	if a.NewerThan != "" {
+		terms = append(terms, "newer_than:"+a.NewerThan)
+	}
+
+	return strings.Join(terms, " ")
+}
+
+// composeQuery returns the Alert with the query composed of its structured
+// search fields prepended to its GmailQuery, which is put in parentheses if
+// it is not empty.
+func (a Alert) composeQuery() Alert {
+	if !a.structured() {
+		return a
+	}
+
+	q := a.structuredQuery()
+	if a.GmailQuery != "" {
+		q += " (" + a.GmailQuery + ")"
+	}
+	a.GmailQuery = q
+
+	return a
+}
+
+// queryTerm returns the Gmail query term searching the given operator, like
+// "from", for the given value, quoted with QuoteQueryValue.
+func queryTerm(op, value string) string {
+	return op + ":" + QuoteQueryValue(value)
+}
@@ -0,0 +1,89 @@
+package gmailalert
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestComposeQuery(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		input Alert
+		want  string
+	}{
+		"Alert without structured fields keeps its gmail query": {
+			input: Alert{GmailQuery: "is:unread"},
+			want:  "is:unread",
+		},
+		"Structured fields are composed in a fixed order": {
+			input: Alert{NewerThan: "2d", HasAttachment: true, From: "bank.com", To: "me@example.com", Subject: "statement"},
+			want:  "from:bank.com to:me@example.com subject:statement has:attachment newer_than:2d",
+		},
+		"Values with whitespace are quoted": {
+			input: Alert{Subject: "Your bill is ready"},
+			want:  `subject:"Your bill is ready"`,
+		},
+		"Quotes and braces in values cannot break the query": {
+			input: Alert{Subject: `Re: "Order" {42}`, From: "bank.com"},
+			want:  `from:bank.com subject:"Re: Order {42}"`,
+		},
+		"Label names with whitespace are dashed": {
+			input: Alert{Label: "Bank Statements"},
+			want:  "label:Bank-Statements",
+		},
+		"Gmail query is added in parentheses": {
+			input: Alert{From: "bank.com", GmailQuery: "is:unread OR is:starred"},
+			want:  "from:bank.com (is:unread OR is:starred)",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got := tc.input.composeQuery().GmailQuery
+
+			if tc.want != got {
+				t.Errorf("want query %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestDecodeAlertsComposesStructuredQueries(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := DecodeAlerts(strings.NewReader(`{"alerts": [{"from": "bank.com", "newerthan": "1d"}]}`))
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+
+	if got := cfg.Alerts[0].GmailQuery; got != "from:bank.com newer_than:1d" {
+		t.Errorf("want composed query %q, got %q", "from:bank.com newer_than:1d", got)
+	}
+}
+
+func TestStructuredOK(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		input       Alert
+		errExpected bool
+	}{
+		"Days returns no error":         {input: Alert{NewerThan: "2d"}, errExpected: false},
+		"Years returns no error":        {input: Alert{NewerThan: "1y"}, errExpected: false},
+		"Hours returns an error":        {input: Alert{NewerThan: "12h"}, errExpected: true},
+		"Zero days returns an error":    {input: Alert{NewerThan: "0d"}, errExpected: true},
+		"Missing unit returns an error": {input: Alert{NewerThan: "2"}, errExpected: true},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := tc.input.structuredOK()
+			errReceived := err != nil
+
+			if tc.errExpected != errReceived {
+				t.Errorf("got unexpected error status %t", errReceived)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package gmailalert
+
+import "time"
+
+// AlertResult represents the outcome of processing a single alert.
+//
+// Deprecated: Use the stable v1.AlertResult in package api/v1.
+type AlertResult struct {
+	// The name identifying the alert.
+	Alert string
+	// The free-form labels of the alert.
+	Labels map[string]string
+	// The ID of the alert's evaluation, which prefixes every log line
+	// written while processing the alert.
+	EvalID string
+	// The number of emails matching the alert.
+	Matches int
+	// The estimated total number of emails matching the alert when more
+	// emails match than are listed in a single page of search results, and
+	// 0 otherwise.
+	Estimated int
+	// The From headers of the matching emails whose details were fetched,
+	// like for alerts with a max age.
+	Senders []string
+	// Whether a notification was sent for the alert.
+	Notified bool
+	// The title and message of the sent notification, and the IDs of the
+	// emails it was sent for. They are only set if a notification was sent.
+	Title      string
+	Message    string
+	MessageIDs []string
+	// Whether a notification was suppressed by the alert's repeat interval.
+	Suppressed bool
+	// Whether the evaluation of the alert was skipped because the mailbox
+	// did not change since its last evaluation found no emails.
+	Unchanged bool
+	// The failover channel that delivered the alert's notification, if it
+	// was sent by a FailoverNotifier.
+	Channel string
+	// The message quota of the notification provider reported when the
+	// alert was notified, if any.
+	Quota *NotifyQuota
+	// The number of emergency notifications of the alert still waiting to
+	// be acknowledged.
+	Unacknowledged int
+	// How long each stage of the alert's evaluation took.
+	Timings StageTimings
+	// The decision trace of the alert's evaluation, if the Alerter explains
+	// its evaluations.
+	Explanation *Explanation
+	// The error encountered while processing the alert, if any.
+	Err error
+}
+
+// Summary represents the outcome of a single Alerter run over a set of
+// alerts.
+//
+// Deprecated: Use the stable v1.Summary in package api/v1.
+type Summary struct {
+	// The randomly generated ID of the run. Evaluation IDs of the alerts in
+	// the run are derived from it.
+	RunID string
+	// The time the run started.
+	Started time.Time
+	// How long the run took.
+	Duration time.Duration
+	// The outcome of each alert processed in the run.
+	Results []AlertResult
+}
+
+// Matches returns the total number of emails matching all alerts in the run.
+func (s Summary) Matches() int {
+	var n int
+	for _, r := range s.Results {
+		n += r.Matches
+	}
+
+	return n
+}
+
+// Notified returns the number of alerts a notification was sent for.
+func (s Summary) Notified() int {
+	var n int
+	for _, r := range s.Results {
+		if r.Notified {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Suppressed returns the number of alerts whose notification was suppressed.
+func (s Summary) Suppressed() int {
+	var n int
+	for _, r := range s.Results {
+		if r.Suppressed {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Unchanged returns the number of alerts whose evaluation was skipped because
+// the mailbox did not change since their last evaluation found no emails.
+func (s Summary) Unchanged() int {
+	var n int
+	for _, r := range s.Results {
+		if r.Unchanged {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Quota returns the lowest remaining message quota of the notification
+// provider reported by any alert notified in the run, or nil if none was
+// reported.
+func (s Summary) Quota() *NotifyQuota {
+	var q *NotifyQuota
+	for _, r := range s.Results {
+		if r.Quota != nil && (q == nil || r.Quota.Remaining < q.Remaining) {
+			q = r.Quota
+		}
+	}
+
+	return q
+}
+
+// Failed returns the number of alerts that could not be processed.
+func (s Summary) Failed() int {
+	var n int
+	for _, r := range s.Results {
+		if r.Err != nil {
+			n++
+		}
+	}
+
+	return n
+}
@@ -0,0 +1,53 @@
+package gmailalert_test
+
+import (
+	"testing"
+
+	"github.com/aculclasure/gmailalert"
+)
+
+func TestSummaryCounts(t *testing.T) {
+	t.Parallel()
+
+	s := gmailalert.Summary{
+		Results: []gmailalert.AlertResult{
+			{Alert: "a", Matches: 2, Notified: true},
+			{Alert: "b", Matches: 1, Suppressed: true},
+			{Alert: "c", Err: errFetchingMail},
+			{Alert: "d"},
+		},
+	}
+
+	if got := s.Matches(); got != 3 {
+		t.Errorf("want 3 matches, got %d", got)
+	}
+	if got := s.Notified(); got != 1 {
+		t.Errorf("want 1 notified alert, got %d", got)
+	}
+	if got := s.Suppressed(); got != 1 {
+		t.Errorf("want 1 suppressed alert, got %d", got)
+	}
+	if got := s.Failed(); got != 1 {
+		t.Errorf("want 1 failed alert, got %d", got)
+	}
+	if got := s.Quota(); got != nil {
+		t.Errorf("want no quota, got %+v", got)
+	}
+}
+
+func TestSummaryQuotaIsLowestRemaining(t *testing.T) {
+	t.Parallel()
+
+	s := gmailalert.Summary{
+		Results: []gmailalert.AlertResult{
+			{Alert: "a", Notified: true, Quota: &gmailalert.NotifyQuota{Limit: 10000, Remaining: 120}},
+			{Alert: "b", Notified: true, Quota: &gmailalert.NotifyQuota{Limit: 10000, Remaining: 119}},
+			{Alert: "c"},
+		},
+	}
+
+	got := s.Quota()
+	if got == nil || got.Remaining != 119 {
+		t.Errorf("want quota with 119 remaining, got %+v", got)
+	}
+}
@@ -0,0 +1,86 @@
+package gmailalert
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// testNotifyCLI accepts the command line flags of the "test-notify"
+// subcommand, which sends a test notification for the alert named by the
+// "-alert" flag, or for every configured alert if the flag is empty, without
+// needing any matching emails. An error is returned if the flags are invalid,
+// the alert configuration cannot be loaded, or any notification fails.
+func testNotifyCLI(args []string) error {
+	var app cliEnv
+	var alertName string
+
+	fs := app.flagSet("test-notify")
+	fs.StringVar(
+		&alertName,
+		"alert",
+		"",
+		"the name (or gmail query) of the alert to send a test notification for (all alerts if empty)")
+	if err := app.parse(fs, args); err != nil {
+		return err
+	}
+
+	app, alertCfg, err := app.profileConfig()
+	if err != nil {
+		return err
+	}
+
+	pushoverClient, err := app.pushoverClient(alertCfg, app.debugLogger())
+	if err != nil {
+		return err
+	}
+
+	return sendTestNotifications(pushoverClient, alertCfg.Alerts, alertName, os.Stdout)
+}
+
+// sendTestNotifications accepts a Notifier, a slice of Alerts, the name of an
+// alert, and an io.Writer, and sends a test notification for the named alert,
+// or for every alert if the name is empty, writing the outcome of each
+// notification to the io.Writer. An error is returned if no alert has the
+// given name or if any of the notifications fail.
+func sendTestNotifications(n Notifier, alerts []Alert, name string, w io.Writer) error {
+	selected, err := selectAlerts(alerts, name)
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	for _, alt := range selected {
+		alt.PushoverTitle = "[TEST] " + alt.PushoverTitle
+		alt.PushoverMsg = fmt.Sprintf("This is a test notification for the gmailalert alert %q.", alt.key())
+		if err := n.Notify(alt); err != nil {
+			fmt.Fprintf(w, "FAIL %s: %v\n", alt.key(), err)
+			failed++
+			continue
+		}
+		fmt.Fprintf(w, "OK   %s\n", alt.key())
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d test notifications failed", failed, len(selected))
+	}
+
+	return nil
+}
+
+// selectAlerts returns the alert identified by the given name, or all of
+// the given alerts if the name is empty. An error is returned if no alert is
+// identified by the name.
+func selectAlerts(alerts []Alert, name string) ([]Alert, error) {
+	if name == "" {
+		return alerts, nil
+	}
+
+	for _, alt := range alerts {
+		if alt.key() == name {
+			return []Alert{alt}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no alert named %q found in alert configuration", name)
+}
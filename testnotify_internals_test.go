@@ -0,0 +1,92 @@
+package gmailalert
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSendTestNotifications(t *testing.T) {
+	t.Parallel()
+
+	alerts := []Alert{
+		{Name: "bills", GmailQuery: "subject:bill", PushoverTitle: "Bill Due!"},
+		{GmailQuery: "is:unread", PushoverTitle: "Unread!"},
+	}
+
+	t.Run("all alerts are notified when no name is given", func(t *testing.T) {
+		n := &recordingTestNotifier{}
+		out := &bytes.Buffer{}
+
+		err := sendTestNotifications(n, alerts, "", out)
+		if err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		if len(n.alerts) != 2 {
+			t.Fatalf("want 2 test notifications, got %d", len(n.alerts))
+		}
+		if n.alerts[0].PushoverTitle != "[TEST] Bill Due!" {
+			t.Errorf("want test notification title to be marked, got %q", n.alerts[0].PushoverTitle)
+		}
+		if !strings.Contains(out.String(), "OK   is:unread") {
+			t.Errorf("want output to report alert identified by its query, got:\n%s", out.String())
+		}
+	})
+
+	t.Run("only the named alert is notified", func(t *testing.T) {
+		n := &recordingTestNotifier{}
+
+		err := sendTestNotifications(n, alerts, "bills", &bytes.Buffer{})
+		if err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		if len(n.alerts) != 1 || n.alerts[0].Name != "bills" {
+			t.Fatalf("want 1 test notification for alert bills, got %+v", n.alerts)
+		}
+	})
+
+	t.Run("unknown alert name returns an error", func(t *testing.T) {
+		err := sendTestNotifications(&recordingTestNotifier{}, alerts, "missing", &bytes.Buffer{})
+
+		if err == nil {
+			t.Fatal("wanted an error but did not get one")
+		}
+	})
+
+	t.Run("failed notification returns an error", func(t *testing.T) {
+		n := &recordingTestNotifier{err: errors.New("invalid token")}
+		out := &bytes.Buffer{}
+
+		err := sendTestNotifications(n, alerts, "bills", out)
+		if err == nil {
+			t.Fatal("wanted an error but did not get one")
+		}
+
+		if !strings.Contains(out.String(), "FAIL bills: invalid token") {
+			t.Errorf("want output to report the failure, got:\n%s", out.String())
+		}
+	})
+}
+
+// recordingTestNotifier represents a test double type that implements the
+// Notifier interface, records every Alert it is asked to notify on, and
+// returns the err value it was created with. It is safe to be used
+// concurrently by multiple goroutines.
+type recordingTestNotifier struct {
+	alerts []Alert
+	err    error
+	mtx    sync.Mutex
+}
+
+// Notify appends alt to the alerts field of the receiver r and returns the
+// err field of the receiver r.
+func (r *recordingTestNotifier) Notify(alt Alert) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.alerts = append(r.alerts, alt)
+	return r.err
+}
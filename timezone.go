@@ -0,0 +1,95 @@
+package gmailalert
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// queryDateWord matches a date operator of a Gmail query whose value is a
+// day relative to today, like "after:today" or "before:yesterday", which
+// Gmail does not understand. The operator is its first group and the day its
+// second.
+var queryDateWord = regexp.MustCompile(`(?i)\b(after|before|newer|older):(today|yesterday|tomorrow)\b`)
+
+// WithAlerterLocation accepts a *time.Location and returns a functional
+// option for wiring it to an Alerter as the time zone of the alerts without
+// one of their own.
+func WithAlerterLocation(loc *time.Location) AlerterOption {
+	return func(a *Alerter) {
+		a.Location = loc
+	}
+}
+
+// loadTimeZone returns the location of the given IANA time zone name, like
+// "Europe/Berlin", or the system's local time zone if the name is empty. An
+// error is returned if the time zone is unknown.
+func loadTimeZone(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("time zone must be an IANA time zone name like \"Europe/Berlin\", got %q", name)
+	}
+
+	return loc, nil
+}
+
+// location returns the time zone of the given Alert: its own if it has one,
+// or else the Alerter's Location, or else the system's local time zone.
+func (a Alerter) location(alt Alert) *time.Location {
+	if alt.TimeZone != "" {
+		if loc, err := loadTimeZone(alt.TimeZone); err == nil {
+			return loc
+		}
+	}
+	if a.Location != nil {
+		return a.Location
+	}
+
+	return time.Local
+}
+
+// expandQueryDates returns the given Gmail query with the days of its date
+// operators written relative to today replaced by the Unix time of the
+// midnight starting that day, so that "after:today" means after midnight in
+// the time zone of the given now rather than in Gmail's.
+func expandQueryDates(query string, now time.Time) string {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	days := map[string]int{"yesterday": -1, "today": 0, "tomorrow": 1}
+
+	return queryDateWord.ReplaceAllStringFunc(query, func(m string) string {
+		op, day, _ := strings.Cut(m, ":")
+		t := today.AddDate(0, 0, days[strings.ToLower(day)])
+		return op + ":" + strconv.FormatInt(t.Unix(), 10)
+	})
+}
+
+// withQueryDates returns the QueryExpr receiver q with the relative days of
+// the date operators of all its queries expanded by expandQueryDates.
+func (q QueryExpr) withQueryDates(now time.Time) QueryExpr {
+	q.Query = expandQueryDates(q.Query, now)
+	if q.And != nil {
+		and := make([]QueryExpr, len(q.And))
+		for i, op := range q.And {
+			and[i] = op.withQueryDates(now)
+		}
+		q.And = and
+	}
+	if q.Or != nil {
+		or := make([]QueryExpr, len(q.Or))
+		for i, op := range q.Or {
+			or[i] = op.withQueryDates(now)
+		}
+		q.Or = or
+	}
+	if q.Not != nil {
+		not := q.Not.withQueryDates(now)
+		q.Not = &not
+	}
+
+	return q
+}
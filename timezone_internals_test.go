@@ -0,0 +1,143 @@
+package gmailalert
+
+import (
+	"io"
+	"log"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestExpandQueryDates(t *testing.T) {
+	t.Parallel()
+
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// It is already October 16 in Tokyo.
+	now := time.Date(2026, 10, 15, 20, 0, 0, 0, time.UTC).In(tokyo)
+	midnight := func(day int) string {
+		return strconv.FormatInt(time.Date(2026, 10, day, 0, 0, 0, 0, tokyo).Unix(), 10)
+	}
+	testCases := map[string]struct {
+		input string
+		want  string
+	}{
+		"Today and yesterday": {
+			input: "from:bank after:yesterday before:Today",
+			want:  "from:bank after:" + midnight(15) + " before:" + midnight(16),
+		},
+		"Newer and older than tomorrow": {
+			input: "newer:today older:tomorrow",
+			want:  "newer:" + midnight(16) + " older:" + midnight(17),
+		},
+		"Absolute dates are kept": {
+			input: "after:2026/10/01 subject:today",
+			want:  "after:2026/10/01 subject:today",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if got := expandQueryDates(tc.input, now); tc.want != got {
+				t.Errorf("want %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+// recordingQueryMatcher represents a Matcher recording the queries it is
+// asked to match, without matching any messages.
+type recordingQueryMatcher struct {
+	queries []string
+}
+
+// Match records the given query.
+func (m *recordingQueryMatcher) Match(query string) ([]string, error) {
+	m.queries = append(m.queries, query)
+	return nil, nil
+}
+
+func TestAlerterEvaluatesAlertsInTimeZone(t *testing.T) {
+	t.Parallel()
+
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 10, 15, 2, 0, 0, 0, time.UTC)
+	testCases := map[string]struct {
+		alert    Alert
+		location *time.Location
+		want     string
+	}{
+		"Alerter location": {
+			alert:    Alert{GmailQuery: "after:today"},
+			location: newYork,
+			want:     "after:" + strconv.FormatInt(time.Date(2026, 10, 14, 0, 0, 0, 0, newYork).Unix(), 10),
+		},
+		"Alert time zone overrides Alerter location": {
+			alert:    Alert{GmailQuery: "after:today", TimeZone: "UTC"},
+			location: newYork,
+			want:     "after:" + strconv.FormatInt(time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC).Unix(), 10),
+		},
+		"Combined queries": {
+			alert:    Alert{Queries: &QueryExpr{Or: []QueryExpr{{Query: "after:yesterday"}}}, TimeZone: "UTC"},
+			location: newYork,
+			want:     "after:" + strconv.FormatInt(time.Date(2026, 10, 14, 0, 0, 0, 0, time.UTC).Unix(), 10),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			m := &recordingQueryMatcher{}
+			a, err := NewAlerter(m, &recordingTestNotifier{},
+				WithAlerterLogger(log.New(io.Discard, "", 0)),
+				WithAlerterClock(func() time.Time { return now }),
+				WithAlerterLocation(tc.location))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if res := a.process(tc.alert, nil); res.Err != nil {
+				t.Fatal(res.Err)
+			}
+			if !cmp.Equal([]string{tc.want}, m.queries) {
+				t.Errorf("want != got\ndiff=%s", cmp.Diff([]string{tc.want}, m.queries))
+			}
+		})
+	}
+}
+
+func TestConditionHourInAlertTimeZone(t *testing.T) {
+	t.Parallel()
+
+	// 23:30 UTC is 08:30 the next day in Tokyo.
+	now := time.Date(2026, 10, 15, 23, 30, 0, 0, time.UTC)
+	a, err := NewAlerter(fakePreviewFetcher{}, &recordingTestNotifier{},
+		WithAlerterLogger(log.New(io.Discard, "", 0)),
+		WithAlerterClock(func() time.Time { return now }))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	holds, err := a.conditionHolds(Alert{Condition: "hour == 8 && weekday == 5", TimeZone: "Asia/Tokyo"}, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !holds {
+		t.Error("want condition on hour and weekday to hold in the alert's time zone")
+	}
+}
+
+func TestAlertOKRejectsUnknownTimeZone(t *testing.T) {
+	t.Parallel()
+
+	alt := Alert{GmailQuery: "test", PushoverTarget: "test", PushoverTitle: "test", PushoverSound: "test", TimeZone: "Mars/Olympus"}
+	if err := alt.OK(); err == nil {
+		t.Error("expected an error for an unknown time zone but did not get one")
+	}
+}
@@ -0,0 +1,18 @@
+package gmailalert
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// showToast shows a desktop notification with the given title and message
+// in the macOS notification center through osascript. An error is returned
+// if osascript fails.
+func showToast(title, message string) error {
+	quote := func(s string) string {
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+	}
+	script := "display notification " + quote(message) + " with title " + quote(title)
+
+	return exec.Command("osascript", "-e", script).Run()
+}
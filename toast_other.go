@@ -0,0 +1,12 @@
+//go:build !darwin && !windows
+
+package gmailalert
+
+import "os/exec"
+
+// showToast shows a desktop notification with the given title and message
+// through notify-send, which talks to the notification daemon of the
+// desktop environment. An error is returned if notify-send fails.
+func showToast(title, message string) error {
+	return exec.Command("notify-send", "--app-name=gmailalert", title, message).Run()
+}
@@ -0,0 +1,28 @@
+package gmailalert
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// toastScript is the PowerShell script showing a Windows toast notification,
+// formatted with the title and the message as single-quoted strings.
+const toastScript = `[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null
+$template = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$texts = $template.GetElementsByTagName('text')
+$texts.Item(0).AppendChild($template.CreateTextNode(%s)) > $null
+$texts.Item(1).AppendChild($template.CreateTextNode(%s)) > $null
+$toast = [Windows.UI.Notifications.ToastNotification]::new($template)
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('gmailalert').Show($toast)`
+
+// showToast shows a Windows toast notification with the given title and
+// message through PowerShell. An error is returned if PowerShell fails.
+func showToast(title, message string) error {
+	quote := func(s string) string {
+		return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+	}
+	script := fmt.Sprintf(toastScript, quote(title), quote(message))
+
+	return exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", script).Run()
+}
@@ -0,0 +1,73 @@
+package gmailalert
+
+import (
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+// TokenManager shares one OAuth2 token source per token file between all
+// GmailClients created with it, like the clients of several profiles or of
+// the runs of a daemon that reloads its configuration. A shared token source
+// refreshes its token once for all of them, instead of each client reading
+// the token file and refreshing and saving the token on its own. It is safe
+// for concurrent use by multiple goroutines.
+type TokenManager struct {
+	mtx     sync.Mutex
+	sources map[string]oauth2.TokenSource
+}
+
+// NewTokenManager returns a new TokenManager without any token sources.
+func NewTokenManager() *TokenManager {
+	return &TokenManager{sources: map[string]oauth2.TokenSource{}}
+}
+
+// defaultTokenManager is the TokenManager of every GmailClient whose
+// GmailClientConfig has none.
+var defaultTokenManager = NewTokenManager()
+
+// source returns the token source shared for the given token file, creating
+// it with the given function if there is none yet. Token sources are created
+// one at a time, so that a missing token is only requested from the user
+// once. An error is returned if the token source cannot be created.
+func (m *TokenManager) source(tokenFile string, create func() (oauth2.TokenSource, error)) (oauth2.TokenSource, error) {
+	key := tokenManagerKey(tokenFile)
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if src, ok := m.sources[key]; ok {
+		return src, nil
+	}
+
+	src, err := create()
+	if err != nil {
+		return nil, err
+	}
+	m.sources[key] = src
+
+	return src, nil
+}
+
+// Forget drops the token source shared for the given token file, so that the
+// next GmailClient created for it reads the token file again, like after the
+// token was replaced with "auth import".
+func (m *TokenManager) Forget(tokenFile string) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	delete(m.sources, tokenManagerKey(tokenFile))
+}
+
+// tokenManagerKey returns the key of the given token file in a TokenManager,
+// which is its absolute path, or that of the default token file if it is
+// empty.
+func tokenManagerKey(tokenFile string) string {
+	if tokenFile == "" {
+		tokenFile = defaultTokenFile
+	}
+	if abs, err := filepath.Abs(tokenFile); err == nil {
+		return abs
+	}
+
+	return tokenFile
+}
@@ -0,0 +1,75 @@
+package gmailalert
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestTokenManagerSharesTokenSourcePerFile(t *testing.T) {
+	t.Parallel()
+
+	m := NewTokenManager()
+	var created int64
+	create := func() (oauth2.TokenSource, error) {
+		atomic.AddInt64(&created, 1)
+		return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "a"}), nil
+	}
+
+	var wg sync.WaitGroup
+	sources := make([]oauth2.TokenSource, 10)
+	for i := range sources {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			src, err := m.source("token.json", create)
+			if err != nil {
+				t.Errorf("got unexpected error: %v", err)
+			}
+			sources[i] = src
+		}(i)
+	}
+	wg.Wait()
+
+	if created != 1 {
+		t.Errorf("want 1 token source created, got %d", created)
+	}
+	for _, src := range sources[1:] {
+		if src != sources[0] {
+			t.Fatal("want every client to share the same token source")
+		}
+	}
+
+	if _, err := m.source("other.json", create); err != nil {
+		t.Fatal(err)
+	}
+	m.Forget("token.json")
+	if _, err := m.source("token.json", create); err != nil {
+		t.Fatal(err)
+	}
+	if created != 3 {
+		t.Errorf("want a token source created for another file and after forgetting, got %d created", created)
+	}
+}
+
+func TestTokenManagerDoesNotShareFailedTokenSource(t *testing.T) {
+	t.Parallel()
+
+	m := NewTokenManager()
+	_, err := m.source("token.json", func() (oauth2.TokenSource, error) {
+		return nil, errors.New("no token")
+	})
+	if err == nil {
+		t.Fatal("wanted an error but did not get one")
+	}
+
+	src, err := m.source("token.json", func() (oauth2.TokenSource, error) {
+		return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "a"}), nil
+	})
+	if err != nil || src == nil {
+		t.Errorf("want a token source once it can be created, got %v and error %v", src, err)
+	}
+}
@@ -0,0 +1,191 @@
+package gmailalert
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// sealedTokenPrefix starts an encrypted token written by exportToken, so
+// that importToken can tell it from a plain JSON token.
+const sealedTokenPrefix = "gmailalert-token-v1:"
+
+// authTransferCLI accepts the name of an "auth" subcommand, "export" or
+// "import", and its command line flags. The "export" subcommand writes the
+// token file to stdout and the "import" subcommand saves the token read from
+// stdin into the token file, so that a token can be moved between machines
+// or injected from a CI secret. With the "-encryption-key" flag, the token
+// is encrypted when exported and decrypted when imported. With the
+// "-profile" flag, the token file of the named profile is used. An error is
+// returned if the flags are invalid or the token cannot be exported or
+// imported.
+func authTransferCLI(cmd string, args []string) error {
+	var app cliEnv
+	var encodedKey string
+
+	fs := app.flagSet("auth " + cmd)
+	fs.StringVar(
+		&encodedKey,
+		"encryption-key",
+		"",
+		"the base64-encoded 32-byte key to encrypt or decrypt the token with, like one generated by \"openssl rand -base64 32\" (unencrypted if empty)")
+	if err := app.parse(fs, args); err != nil {
+		return err
+	}
+	if app.profile != "" {
+		var err error
+		if app, _, err = app.profileConfig(); err != nil {
+			return err
+		}
+	}
+
+	key, err := decodeTokenKey(encodedKey)
+	if err != nil {
+		return err
+	}
+
+	if cmd == "export" {
+		return exportToken(app.tokenFile, key, os.Stdout)
+	}
+
+	return importToken(os.Stdin, key, app.tokenFile)
+}
+
+// exportToken writes the Gmail OAuth2 token in the given token file to the
+// given io.Writer, as JSON if the given key is empty, or encrypted with the
+// key otherwise. An error is returned if the token cannot be read or
+// written.
+func exportToken(tokenFile string, key []byte, w io.Writer) error {
+	stored, err := readStoredToken(tokenFile)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(stored)
+	if err != nil {
+		return fmt.Errorf("got error json-encoding gmail oauth2 token: %v", err)
+	}
+	if len(key) > 0 {
+		sealed, err := sealToken(b, key)
+		if err != nil {
+			return err
+		}
+		b = []byte(sealedTokenPrefix + base64.StdEncoding.EncodeToString(sealed))
+	}
+
+	if _, err := fmt.Fprintf(w, "%s\n", b); err != nil {
+		return fmt.Errorf("got error writing gmail oauth2 token: %v", err)
+	}
+
+	return nil
+}
+
+// importToken reads a Gmail OAuth2 token written by exportToken from the
+// given io.Reader, decrypting it with the given key if it is encrypted, and
+// saves it into the given token file. An error is returned if the token is
+// encrypted but no key is given, cannot be decrypted, has no refresh token,
+// or cannot be saved.
+func importToken(r io.Reader, key []byte, tokenFile string) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("got error reading gmail oauth2 token: %v", err)
+	}
+
+	b = bytes.TrimSpace(b)
+	if encoded, ok := strings.CutPrefix(string(b), sealedTokenPrefix); ok {
+		if len(key) == 0 {
+			return errors.New(`gmail oauth2 token is encrypted, command line flag "-encryption-key" must be non-empty`)
+		}
+		sealed, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return fmt.Errorf("got error base64-decoding encrypted gmail oauth2 token: %v", err)
+		}
+		if b, err = openToken(sealed, key); err != nil {
+			return err
+		}
+	}
+
+	var stored storedToken
+	if err := json.Unmarshal(b, &stored); err != nil {
+		return fmt.Errorf("got error json-decoding gmail oauth2 token: %v", err)
+	}
+	if stored.RefreshToken == "" {
+		return errors.New("gmail oauth2 token must have a refresh token")
+	}
+
+	return saveToken(tokenFile, &stored.Token, stored.ClientID)
+}
+
+// decodeTokenKey decodes the given base64-encoded token encryption key,
+// returning nil if it is empty. An error is returned if the key is not valid
+// base64 or is not 32 bytes long.
+func decodeTokenKey(encoded string) ([]byte, error) {
+	if encoded == "" {
+		return nil, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("got error base64-decoding encryption key: %v", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("encryption key must be 32 bytes long, got %d bytes", len(key))
+	}
+
+	return key, nil
+}
+
+// sealToken encrypts and authenticates the given plaintext with AES-256-GCM
+// using the given key, and returns the random nonce followed by the
+// ciphertext.
+func sealToken(plaintext, key []byte) ([]byte, error) {
+	gcm, err := tokenCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("got error generating nonce: %v", err)
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// openToken decrypts the given output of sealToken with the given key. An
+// error is returned if the key is wrong or the data was tampered with.
+func openToken(sealed, key []byte) ([]byte, error) {
+	gcm, err := tokenCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("encrypted gmail oauth2 token is too short")
+	}
+
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, errors.New("got error decrypting gmail oauth2 token, the encryption key may be wrong")
+	}
+
+	return plaintext, nil
+}
+
+// tokenCipher returns an AES-GCM cipher using the given key.
+func tokenCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("got error creating cipher: %v", err)
+	}
+
+	return cipher.NewGCM(block)
+}
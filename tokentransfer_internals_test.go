@@ -0,0 +1,133 @@
+package gmailalert
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/oauth2"
+)
+
+func TestExportTokenThenImportTokenRoundTrips(t *testing.T) {
+	t.Parallel()
+
+	key := bytes.Repeat([]byte{7}, 32)
+	testCases := map[string]struct {
+		key        []byte
+		wantPrefix string
+	}{
+		"Plain token is exported as JSON": {
+			wantPrefix: "{",
+		},
+		"Encrypted token is exported with a prefix": {
+			key:        key,
+			wantPrefix: sealedTokenPrefix,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			src, dst := filepath.Join(dir, "src.json"), filepath.Join(dir, "dst.json")
+			want := &oauth2.Token{AccessToken: "access", RefreshToken: "refresh", TokenType: "Bearer"}
+			if err := saveToken(src, want, ""); err != nil {
+				t.Fatal(err)
+			}
+
+			var out bytes.Buffer
+			if err := exportToken(src, tc.key, &out); err != nil {
+				t.Fatalf("got unexpected error exporting token: %v", err)
+			}
+			if !strings.HasPrefix(out.String(), tc.wantPrefix) || (tc.key != nil && strings.Contains(out.String(), "refresh")) {
+				t.Errorf("want exported token starting with %q without the plain refresh token, got %q", tc.wantPrefix, out.String())
+			}
+			if err := importToken(&out, tc.key, dst); err != nil {
+				t.Fatalf("got unexpected error importing token: %v", err)
+			}
+
+			got, err := gmailOAuth2{GmailClientConfig: GmailClientConfig{TokenFile: dst}}.localToken()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cmp.Equal(want, got, cmp.AllowUnexported(oauth2.Token{})) {
+				t.Errorf("want != got\ndiff=%s", cmp.Diff(want, got, cmp.AllowUnexported(oauth2.Token{})))
+			}
+		})
+	}
+}
+
+func TestImportTokenWithInvalidInputReturnsError(t *testing.T) {
+	t.Parallel()
+
+	key := bytes.Repeat([]byte{7}, 32)
+	sealed, err := sealToken([]byte(`{"refresh_token":"refresh"}`), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted := sealedTokenPrefix + base64.StdEncoding.EncodeToString(sealed)
+
+	testCases := map[string]struct {
+		input string
+		key   []byte
+	}{
+		"Encrypted token without key":    {input: encrypted},
+		"Encrypted token with wrong key": {input: encrypted, key: bytes.Repeat([]byte{8}, 32)},
+		"Token without refresh token":    {input: `{"access_token":"access"}`},
+		"Input that is not a token":      {input: "this-is-not-json"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "token.json")
+
+			if err := importToken(strings.NewReader(tc.input), tc.key, file); err == nil {
+				t.Error("expected an error but did not get one")
+			}
+			if _, err := os.Stat(file); err == nil {
+				t.Error("want no token file to be written")
+			}
+		})
+	}
+}
+
+func TestDecodeTokenKey(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		encoded     string
+		wantLen     int
+		errExpected bool
+	}{
+		"Empty key disables encryption": {},
+		"32-byte key is accepted": {
+			encoded: base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32)),
+			wantLen: 32,
+		},
+		"Short key returns error": {
+			encoded:     base64.StdEncoding.EncodeToString([]byte("short")),
+			errExpected: true,
+		},
+		"Invalid base64 returns error": {
+			encoded:     "not base64!",
+			errExpected: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got, err := decodeTokenKey(tc.encoded)
+			errReceived := err != nil
+
+			if tc.errExpected != errReceived {
+				t.Fatalf("decodeTokenKey(%q) returned unexpected error status, got error: %v", tc.encoded, err)
+			}
+			if len(got) != tc.wantLen {
+				t.Errorf("want key of %d bytes, got %d", tc.wantLen, len(got))
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package gmailalert
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+)
+
+// newRunID returns a random hex-encoded identifier for an Alerter run.
+func newRunID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "00000000"
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// evalID returns the identifier of the evaluation of the alert at the given
+// index in the run identified by runID.
+func evalID(runID string, index int) string {
+	return fmt.Sprintf("%s.%d", runID, index)
+}
+
+// tracedLogger is a Logger that prefixes every log line with a trace
+// identifier before passing it to the wrapped Logger.
+type tracedLogger struct {
+	l      Logger
+	prefix string
+}
+
+// Printf prefixes the formatted log line with the receiver's trace prefix
+// and writes it to the wrapped Logger.
+func (t tracedLogger) Printf(format string, args ...interface{}) {
+	t.l.Printf("%s"+format, append([]interface{}{t.prefix}, args...)...)
+}
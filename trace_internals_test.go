@@ -0,0 +1,46 @@
+package gmailalert
+
+import (
+	"bytes"
+	"log"
+	"regexp"
+	"testing"
+)
+
+func TestNewRunIDIsRandomHex(t *testing.T) {
+	t.Parallel()
+
+	first, second := newRunID(), newRunID()
+
+	if !regexp.MustCompile(`^[0-9a-f]{8}$`).MatchString(first) {
+		t.Errorf("want an 8 character hex run ID, got %q", first)
+	}
+	if first == second {
+		t.Errorf("want distinct run IDs, got %q twice", first)
+	}
+}
+
+func TestEvalID(t *testing.T) {
+	t.Parallel()
+
+	want := "3f2a9c1d.2"
+	got := evalID("3f2a9c1d", 2)
+
+	if want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+func TestTracedLoggerPrefixesLogLines(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+	l := tracedLogger{l: log.New(buf, "", 0), prefix: "[eval abc.0] "}
+
+	l.Printf("found %d emails", 3)
+
+	want := "[eval abc.0] found 3 emails\n"
+	if got := buf.String(); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
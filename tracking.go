@@ -0,0 +1,135 @@
+package gmailalert
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// maxTrackingBodyBytes is the number of bytes of an email's body that are
+// read to find tracking numbers, which is larger than for other features
+// since shipping emails are mostly HTML.
+const maxTrackingBodyBytes = 256 << 10
+
+// maxTrackingNumbers is the number of tracking numbers of the matching
+// emails linked in a notification.
+const maxTrackingNumbers = 5
+
+// carrier represents a parcel carrier whose tracking numbers can be found
+// in the body of shipping emails.
+type carrier struct {
+	// The name of the carrier, like "UPS".
+	name string
+	// The pattern matching the carrier's tracking numbers, whose first
+	// group is the number.
+	pattern *regexp.Regexp
+	// Whether the carrier's name must appear in the email for its pattern
+	// to count, since plain digit numbers of its length are common.
+	named bool
+	// The format of the carrier's tracking link, given the number.
+	link string
+}
+
+// carriers are the carriers whose tracking numbers are recognized, in the
+// order they are looked for. Carriers with distinctive number formats come
+// first.
+var carriers = []carrier{
+	{
+		name:    "UPS",
+		pattern: regexp.MustCompile(`\b(1Z[0-9A-Z]{16})\b`),
+		link:    "https://www.ups.com/track?tracknum=%s",
+	},
+	{
+		name:    "USPS",
+		pattern: regexp.MustCompile(`\b(9[1-5]\d{18}|9[1-5]\d{20}|[A-Z]{2}\d{9}US)\b`),
+		link:    "https://tools.usps.com/go/TrackConfirmAction?tLabels=%s",
+	},
+	{
+		name:    "FedEx",
+		pattern: regexp.MustCompile(`\b(\d{12}|\d{15})\b`),
+		named:   true,
+		link:    "https://www.fedex.com/fedextrack/?trknbr=%s",
+	},
+	{
+		name:    "DHL",
+		pattern: regexp.MustCompile(`\b(\d{10}|JJD\d{18})\b`),
+		named:   true,
+		link:    "https://www.dhl.com/global-en/home/tracking/tracking-express.html?submit=1&tracking-id=%s",
+	},
+}
+
+// trackingNumber represents a parcel tracking number found in an email.
+type trackingNumber struct {
+	carrier carrier
+	number  string
+}
+
+// String returns the carrier, number, and tracking link of the
+// trackingNumber receiver t, like "UPS 1Z999AA10123456784:
+// https://www.ups.com/track?tracknum=1Z999AA10123456784".
+func (t trackingNumber) String() string {
+	return fmt.Sprintf("%s %s: %s", t.carrier.name, t.number, fmt.Sprintf(t.carrier.link, t.number))
+}
+
+// findTrackingNumbers returns the tracking numbers found in the given email
+// text, in the order of carriers and then of their appearance. A number is
+// only returned once, for the first carrier it matches.
+func findTrackingNumbers(text string) []trackingNumber {
+	lower := strings.ToLower(text)
+	seen := map[string]bool{}
+	var found []trackingNumber
+	for _, c := range carriers {
+		if c.named && !strings.Contains(lower, strings.ToLower(c.name)) {
+			continue
+		}
+		for _, m := range c.pattern.FindAllStringSubmatch(text, -1) {
+			if seen[m[1]] {
+				continue
+			}
+			seen[m[1]] = true
+			found = append(found, trackingNumber{carrier: c, number: m[1]})
+		}
+	}
+
+	return found
+}
+
+// trackingText accepts an Alert and its matching messages and returns a line
+// with the carrier tracking link of each of the first tracking numbers
+// found in the bodies of the messages, from the most recent message on. An
+// empty string is returned if the messages have no tracking numbers, and an
+// error is returned if the Alerter's Matcher does not implement RawFetcher
+// or if there is a problem fetching a message.
+func (a Alerter) trackingText(alt Alert, matches []Message) (string, error) {
+	fetcher, ok := a.Matcher.(RawFetcher)
+	if !ok {
+		return "", fmt.Errorf("matcher %T must implement RawFetcher to find tracking numbers", a.Matcher)
+	}
+
+	var lines []string
+	seen := map[string]bool{}
+	for _, m := range matches {
+		raw, err := fetchRaw(fetcher, alt, m.ID)
+		if err != nil {
+			return "", err
+		}
+		text, err := bodyText(bytes.NewReader(raw), maxTrackingBodyBytes)
+		if err != nil {
+			a.errorLog().Printf("got error reading body of email %s, skipping its tracking numbers: %v", m.ID, err)
+			continue
+		}
+		for _, t := range findTrackingNumbers(text) {
+			if seen[t.number] {
+				continue
+			}
+			if len(lines) == maxTrackingNumbers {
+				return strings.Join(lines, "\n"), nil
+			}
+			seen[t.number] = true
+			lines = append(lines, t.String())
+		}
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
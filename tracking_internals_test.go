@@ -0,0 +1,88 @@
+package gmailalert
+
+import (
+	"io"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestFindTrackingNumbers(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		input string
+		want  []string
+	}{
+		"UPS number": {
+			input: "Your package 1Z999AA10123456784 is on its way.",
+			want:  []string{"UPS 1Z999AA10123456784: https://www.ups.com/track?tracknum=1Z999AA10123456784"},
+		},
+		"USPS numbers": {
+			input: "Tracking: 9400111899223197428490, international EA123456789US",
+			want: []string{
+				"USPS 9400111899223197428490: https://tools.usps.com/go/TrackConfirmAction?tLabels=9400111899223197428490",
+				"USPS EA123456789US: https://tools.usps.com/go/TrackConfirmAction?tLabels=EA123456789US",
+			},
+		},
+		"FedEx number with carrier named": {
+			input: "Shipped with FedEx, tracking number 449044304137821.",
+			want:  []string{"FedEx 449044304137821: https://www.fedex.com/fedextrack/?trknbr=449044304137821"},
+		},
+		"DHL number with carrier named": {
+			input: "DHL Express shipment 1234567890 departed.",
+			want:  []string{"DHL 1234567890: https://www.dhl.com/global-en/home/tracking/tracking-express.html?submit=1&tracking-id=1234567890"},
+		},
+		"Digit numbers without carrier named are ignored": {
+			input: "Order 449044304137 paid, call 1234567890 for help.",
+		},
+		"Repeated number is found once": {
+			input: "1Z999AA10123456784 ... track 1Z999AA10123456784",
+			want:  []string{"UPS 1Z999AA10123456784: https://www.ups.com/track?tracknum=1Z999AA10123456784"},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var got []string
+			for _, n := range findTrackingNumbers(tc.input) {
+				got = append(got, n.String())
+			}
+			if strings.Join(tc.want, "\n") != strings.Join(got, "\n") {
+				t.Errorf("want %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestAlerterNotifiesTrackingLinks(t *testing.T) {
+	t.Parallel()
+
+	fetcher := fakeExportFetcher{
+		fakePreviewFetcher: fakePreviewFetcher{matches: []Message{{ID: "1"}, {ID: "2"}}},
+		raw: map[string][]byte{
+			"1": []byte("Content-Type: text/html\r\n\r\n<p>Your order shipped with <b>UPS</b>: <a href=\"#\">1Z999AA10123456784</a></p>"),
+			"2": []byte("Subject: shipped\r\n\r\nTrack 1Z999AA10123456784 and EA123456789US."),
+		},
+	}
+	notifier := &recordingTestNotifier{}
+	a, err := NewAlerter(fetcher, notifier, WithAlerterLogger(log.New(io.Discard, "", 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := a.process(Alert{Name: "parcels", GmailQuery: "subject:shipped", Tracking: true}, nil)
+	if res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	if len(notifier.alerts) != 1 {
+		t.Fatalf("want one notification, got %+v", notifier.alerts)
+	}
+
+	want := "UPS 1Z999AA10123456784: https://www.ups.com/track?tracknum=1Z999AA10123456784\n" +
+		"USPS EA123456789US: https://tools.usps.com/go/TrackConfirmAction?tLabels=EA123456789US"
+	_, got, _ := strings.Cut(notifier.alerts[0].PushoverMsg, "\n")
+	if want != got {
+		t.Errorf("want tracking links %q in notification message, got %q", want, got)
+	}
+}
@@ -0,0 +1,73 @@
+package gmailalert
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gregdel/pushover"
+)
+
+// ellipsis marks text cut short by truncation.
+const ellipsis = "…"
+
+// pushoverMaxLength returns the number of characters Pushover notification
+// messages are truncated to according to the AlertConfig receiver c.
+func (c AlertConfig) pushoverMaxLength() int {
+	if c.PushoverMaxLength == 0 {
+		return pushover.MessageMaxLength
+	}
+
+	return c.PushoverMaxLength
+}
+
+// truncateMessage returns the given notification message shortened to at
+// most maxLen characters, or unchanged if it fits or maxLen is not positive.
+// Since the first line of a notification holds its headline, like the number
+// of matching emails, it is always kept, and the following lines, like
+// snippets or subject lines added by hooks, are kept whole for as long as
+// they fit along with a last line like "…and 12 more" counting those that do
+// not. If the first line alone does not fit, it is cut and ends with an
+// ellipsis.
+func truncateMessage(msg string, maxLen int) string {
+	if maxLen <= 0 || utf8.RuneCountInString(msg) <= maxLen {
+		return msg
+	}
+
+	lines := strings.Split(msg, "\n")
+	more := func(n int) string { return fmt.Sprintf("\n%sand %d more", ellipsis, n) }
+	if utf8.RuneCountInString(lines[0]+more(len(lines)-1)) > maxLen {
+		return truncateText(lines[0], maxLen)
+	}
+
+	kept, length := 1, utf8.RuneCountInString(lines[0])
+	for _, line := range lines[1:] {
+		n := 1 + utf8.RuneCountInString(line)
+		if length+n+utf8.RuneCountInString(more(len(lines)-kept-1)) > maxLen {
+			break
+		}
+		kept, length = kept+1, length+n
+	}
+
+	return strings.Join(lines[:kept], "\n") + more(len(lines)-kept)
+}
+
+// truncateText returns the given text cut to at most maxLen characters,
+// ending with an ellipsis if it was cut, or unchanged if it fits or maxLen is
+// not positive.
+func truncateText(text string, maxLen int) string {
+	if maxLen <= 0 || utf8.RuneCountInString(text) <= maxLen {
+		return text
+	}
+
+	return truncateRunes(text, maxLen-1) + ellipsis
+}
+
+// truncateRunes returns the given text cut to at most n runes.
+func truncateRunes(text string, n int) string {
+	if r := []rune(text); len(r) > n {
+		return string(r[:n])
+	}
+
+	return text
+}
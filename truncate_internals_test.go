@@ -0,0 +1,73 @@
+package gmailalert
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateMessage(t *testing.T) {
+	t.Parallel()
+
+	subjects := "Found 4 emails\nYour bill\nYour invoice\nYour receipt\nYour statement"
+
+	testCases := map[string]struct {
+		msg    string
+		maxLen int
+		want   string
+	}{
+		"Message that fits is unchanged": {
+			msg:    subjects,
+			maxLen: 100,
+			want:   subjects,
+		},
+		"Non-positive length leaves message unchanged": {
+			msg:    subjects,
+			maxLen: 0,
+			want:   subjects,
+		},
+		"Whole lines that fit are kept and the rest counted": {
+			msg:    subjects,
+			maxLen: 50,
+			want:   "Found 4 emails\nYour bill\nYour invoice\n…and 2 more",
+		},
+		"Headline is kept even if no other line fits": {
+			msg:    subjects,
+			maxLen: 28,
+			want:   "Found 4 emails\n…and 4 more",
+		},
+		"Headline that does not fit is cut": {
+			msg:    "Found 4 emails matching query \"from:bank\"\nYour bill",
+			maxLen: 10,
+			want:   "Found 4 e…",
+		},
+		"Characters are counted rather than bytes": {
+			msg:    "Gefunden: Rechnungsänderung",
+			maxLen: 12,
+			want:   "Gefunden: R…",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got := truncateMessage(tc.msg, tc.maxLen)
+			if tc.want != got {
+				t.Errorf("want %q, got %q", tc.want, got)
+			}
+			if tc.maxLen > 0 && utf8.RuneCountInString(got) > tc.maxLen {
+				t.Errorf("want at most %d characters, got %d", tc.maxLen, utf8.RuneCountInString(got))
+			}
+		})
+	}
+}
+
+func TestTruncateText(t *testing.T) {
+	t.Parallel()
+
+	if got := truncateText(strings.Repeat("a", 10), 5); got != "aaaa…" {
+		t.Errorf("want %q, got %q", "aaaa…", got)
+	}
+	if got := truncateText("short", 5); got != "short" {
+		t.Errorf("want %q, got %q", "short", got)
+	}
+}
@@ -0,0 +1,85 @@
+package gmailalert
+
+import (
+	"fmt"
+	"io"
+	"log"
+)
+
+// The tunings selectable with the "-tuning" flag.
+const (
+	TuningDefault  = "default"
+	TuningLowPower = "low-power"
+)
+
+// The kinds of logging of an AlertConfig.
+const (
+	LoggingAll    = "all"
+	LoggingErrors = "errors"
+)
+
+// lowPowerConfig holds the settings of the low-power tuning, for devices
+// like a Raspberry Pi: few alerts evaluated at once, patient HTTP requests
+// over few connections, email details fetched in batches, and only errors
+// and warnings logged.
+var lowPowerConfig = AlertConfig{
+	Concurrency: 2,
+	FetchBatch:  50,
+	Logging:     LoggingErrors,
+	HTTP: &HTTPConfig{HTTPClientConfig: HTTPClientConfig{
+		Timeout:             "90s",
+		KeepAlive:           "60s",
+		IdleConnTimeout:     "30s",
+		MaxIdleConns:        4,
+		MaxIdleConnsPerHost: 1,
+	}},
+}
+
+// tuned returns the AlertConfig receiver c with the settings of the given
+// tuning, either TuningDefault or TuningLowPower, filled in where c does not
+// set them itself. An empty tuning is TuningDefault, which changes nothing.
+// An error is returned if the tuning is unknown.
+func (c AlertConfig) tuned(tuning string) (AlertConfig, error) {
+	switch tuning {
+	case "", TuningDefault:
+		return c, nil
+	case TuningLowPower:
+	default:
+		return AlertConfig{}, fmt.Errorf("tuning must be %q or %q, got %q", TuningDefault, TuningLowPower, tuning)
+	}
+
+	t := lowPowerConfig
+	if c.Concurrency == 0 {
+		c.Concurrency = t.Concurrency
+	}
+	if c.FetchBatch == 0 {
+		c.FetchBatch = t.FetchBatch
+	}
+	c.Logging = firstNonEmpty(c.Logging, t.Logging)
+	httpCfg := HTTPConfig{HTTPClientConfig: t.HTTP.HTTPClientConfig}
+	if c.HTTP != nil {
+		httpCfg.HTTPClientConfig = httpCfg.HTTPClientConfig.merge(&c.HTTP.HTTPClientConfig)
+		httpCfg.Gmail, httpCfg.Pushover = c.HTTP.Gmail, c.HTTP.Pushover
+	}
+	c.HTTP = &httpCfg
+
+	return c, nil
+}
+
+// alerterLoggers returns the Loggers an Alerter logs to with the logging of
+// the AlertConfig receiver c, its Logger and its ErrorLogger. With
+// LoggingAll, the default, every line is logged. With LoggingErrors, only
+// the lines the Alerter writes to its ErrorLogger, about errors and
+// warnings, are logged, and the others, like the matches found by every
+// evaluation, are discarded. An error is returned if the logging is
+// unknown.
+func (c AlertConfig) alerterLoggers() (logger Logger, errorLogger Logger, err error) {
+	switch c.Logging {
+	case "", LoggingAll:
+		return newInfoLogger(), nil, nil
+	case LoggingErrors:
+		return log.New(io.Discard, "", 0), newInfoLogger(), nil
+	}
+
+	return nil, nil, fmt.Errorf("logging must be %q or %q, got %q", LoggingAll, LoggingErrors, c.Logging)
+}
@@ -0,0 +1,219 @@
+package gmailalert
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAlertConfigTuned(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		config      AlertConfig
+		tuning      string
+		want        AlertConfig
+		errExpected bool
+	}{
+		"Default tuning changes nothing": {
+			config: AlertConfig{Concurrency: 8},
+			tuning: TuningDefault,
+			want:   AlertConfig{Concurrency: 8},
+		},
+		"Low-power tuning fills in unset settings": {
+			tuning: TuningLowPower,
+			want:   lowPowerConfig,
+		},
+		"Settings of the config override low-power tuning": {
+			config: AlertConfig{
+				Concurrency: 4,
+				Logging:     LoggingAll,
+				HTTP: &HTTPConfig{
+					HTTPClientConfig: HTTPClientConfig{Timeout: "2m"},
+					Gmail:            &HTTPClientConfig{MaxIdleConns: 2},
+				},
+			},
+			tuning: TuningLowPower,
+			want: AlertConfig{
+				Concurrency: 4,
+				FetchBatch:  50,
+				Logging:     LoggingAll,
+				HTTP: &HTTPConfig{
+					HTTPClientConfig: HTTPClientConfig{
+						Timeout:             "2m",
+						KeepAlive:           "60s",
+						IdleConnTimeout:     "30s",
+						MaxIdleConns:        4,
+						MaxIdleConnsPerHost: 1,
+					},
+					Gmail: &HTTPClientConfig{MaxIdleConns: 2},
+				},
+			},
+		},
+		"Unknown tuning": {
+			tuning:      "turbo",
+			errExpected: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got, err := tc.config.tuned(tc.tuning)
+			errReceived := err != nil
+
+			if tc.errExpected != errReceived {
+				t.Fatalf("tuned returned unexpected error status: %v", err)
+			}
+			if !cmp.Equal(tc.want, got) {
+				t.Errorf("want != got\ndiff=%s", cmp.Diff(tc.want, got))
+			}
+		})
+	}
+}
+
+func TestAlerterLogsErrorsToErrorLogger(t *testing.T) {
+	t.Parallel()
+
+	// The alert is named and titled "failover" so that none of its lines
+	// can be told apart from the lines about errors by their words.
+	alt := Alert{Name: "failover", GmailQuery: "from:bank", PushoverTitle: "failover", PushoverSound: "s", PushoverTarget: "u"}
+	testCases := map[string]struct {
+		matcher    Matcher
+		wantInfo   bool
+		wantErrors bool
+	}{
+		"Lines of a notified alert go to the Logger": {
+			matcher:  fakePreviewFetcher{matches: []Message{{ID: "id0"}}},
+			wantInfo: true,
+		},
+		"Errors go to the ErrorLogger": {
+			matcher:    &failingMatcher{err: errors.New("quota exceeded")},
+			wantErrors: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var info, errs bytes.Buffer
+			a := Alerter{
+				Matcher:     tc.matcher,
+				Notifier:    discardNotifier{},
+				Logger:      log.New(&info, "", 0),
+				ErrorLogger: log.New(&errs, "", 0),
+				Concurrency: 1,
+			}
+
+			a.run([]Alert{alt})
+
+			if got := info.Len() > 0; tc.wantInfo != got {
+				t.Errorf("want lines logged to the Logger %t, got %q", tc.wantInfo, info.String())
+			}
+			if got := errs.Len() > 0; tc.wantErrors != got {
+				t.Errorf("want lines logged to the ErrorLogger %t, got %q", tc.wantErrors, errs.String())
+			}
+			if tc.wantErrors && !strings.Contains(errs.String(), "quota exceeded") {
+				t.Errorf("want the error of the matcher logged, got %q", errs.String())
+			}
+		})
+	}
+}
+
+func TestAlertConfigAlerterLoggers(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		logging         string
+		wantErrorLogger bool
+		errExpected     bool
+	}{
+		"All lines are logged to a single Logger": {
+			logging: LoggingAll,
+		},
+		"Errors are logged to a separate ErrorLogger": {
+			logging:         LoggingErrors,
+			wantErrorLogger: true,
+		},
+		"Unknown logging": {
+			logging:     "some",
+			errExpected: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			logger, errorLogger, err := AlertConfig{Logging: tc.logging}.alerterLoggers()
+			errReceived := err != nil
+
+			if errReceived != tc.errExpected {
+				t.Fatalf("got unexpected error status: %t", errReceived)
+			}
+
+			if !errReceived && (logger == nil || tc.wantErrorLogger != (errorLogger != nil)) {
+				t.Errorf("want a logger and an error logger %t, got %v and %v", tc.wantErrorLogger, logger, errorLogger)
+			}
+		})
+	}
+}
+
+// batchTestFetcher represents a Matcher and BatchFetcher recording the
+// batches of IDs it is asked to fetch.
+type batchTestFetcher struct {
+	fakePreviewFetcher
+	batches [][]string
+}
+
+// FetchBatch records the given IDs and returns the messages stored under
+// them.
+func (f *batchTestFetcher) FetchBatch(ids []string) ([]Message, error) {
+	f.batches = append(f.batches, ids)
+	msgs := make([]Message, 0, len(ids))
+	for _, id := range ids {
+		m, err := f.Fetch(id)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, m)
+	}
+
+	return msgs, nil
+}
+
+func TestAlerterFetchesDetailsInBatches(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	fetcher := &batchTestFetcher{fakePreviewFetcher: fakePreviewFetcher{
+		matches: []Message{{ID: "1"}, {ID: "2"}, {ID: "3"}},
+		msgs: map[string]Message{
+			"1": {ID: "1", Date: now.Add(-time.Minute)},
+			"2": {ID: "2", Date: now.Add(-2 * time.Hour)},
+			"3": {ID: "3", Date: now.Add(-3 * time.Minute)},
+		},
+	}}
+	a, err := NewAlerter(fetcher, &recordingTestNotifier{},
+		WithAlerterLogger(log.New(io.Discard, "", 0)),
+		WithAlerterClock(func() time.Time { return now }),
+		WithAlerterFetchBatch(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := a.process(Alert{Name: "recent", GmailQuery: "from:bank", MaxAge: "1h"}, nil)
+	if res.Err != nil {
+		t.Fatal(res.Err)
+	}
+
+	if res.Matches != 2 {
+		t.Errorf("want 2 recent matches, got %d", res.Matches)
+	}
+	want := [][]string{{"1", "2"}, {"3"}}
+	if !cmp.Equal(want, fetcher.batches) {
+		t.Errorf("want != got\ndiff=%s", cmp.Diff(want, fetcher.batches))
+	}
+}
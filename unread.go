@@ -0,0 +1,54 @@
+package gmailalert
+
+import (
+	"fmt"
+)
+
+// UnreadCounter is the interface that wraps the UnreadCount method used by
+// any types implementing counting of the unread email messages with a
+// label.
+type UnreadCounter interface {
+	UnreadCount(label string) (int, error)
+}
+
+// unreadLabel returns the name of the label whose unread emails an unread
+// Alert counts.
+func (a Alert) unreadLabel() string {
+	if a.UnreadLabel != "" {
+		return a.UnreadLabel
+	}
+
+	return "INBOX"
+}
+
+// unreadOverflow counts the unread emails with the label of the given unread
+// Alert and returns a single message standing for the overflowing label, if
+// the count exceeds the Alert's threshold, along with the count. Whenever
+// the count does not exceed the threshold, the notified messages of the
+// Alert are cleared with the given StoreTx, so that an Alert notified
+// "once" is notified again the next time the label overflows. An error is
+// returned if the Alerter's Matcher does not implement UnreadCounter or if
+// the unread emails cannot be counted.
+func (a Alerter) unreadOverflow(tx StoreTx, alt Alert) ([]Message, int, error) {
+	counter, ok := a.Matcher.(UnreadCounter)
+	if !ok {
+		return nil, 0, fmt.Errorf("matcher %T must implement UnreadCounter to count unread emails", a.Matcher)
+	}
+
+	count, err := counter.UnreadCount(alt.unreadLabel())
+	if err != nil {
+		return nil, 0, err
+	}
+	if count <= alt.UnreadAbove {
+		if tx != nil {
+			st := tx.Get(alt.key())
+			if len(st.MessageIDs) > 0 {
+				st.MessageIDs = nil
+				tx.Set(alt.key(), st)
+			}
+		}
+		return nil, count, nil
+	}
+
+	return []Message{{ID: "unread:" + alt.unreadLabel()}}, count, nil
+}
@@ -0,0 +1,135 @@
+package gmailalert_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/aculclasure/gmailalert"
+)
+
+func TestAlertOKWithUnreadThreshold(t *testing.T) {
+	t.Parallel()
+
+	base := gmailalert.Alert{
+		PushoverTarget: "test",
+		PushoverTitle:  "test",
+		PushoverSound:  "test",
+		PushoverMsg:    "test",
+	}
+	testCases := map[string]struct {
+		alt         gmailalert.Alert
+		errExpected bool
+	}{
+		"Threshold without query is valid": {
+			alt: gmailalert.Alert{UnreadAbove: 100},
+		},
+		"Threshold with label to count is valid": {
+			alt: gmailalert.Alert{UnreadAbove: 100, UnreadLabel: "Banking"},
+		},
+		"Threshold with query returns an error": {
+			alt:         gmailalert.Alert{UnreadAbove: 100, GmailQuery: "is:unread"},
+			errExpected: true,
+		},
+		"Threshold with watched label returns an error": {
+			alt:         gmailalert.Alert{UnreadAbove: 100, LabelAdded: "Banking"},
+			errExpected: true,
+		},
+		"Threshold with max age returns an error": {
+			alt:         gmailalert.Alert{UnreadAbove: 100, MaxAge: "24h"},
+			errExpected: true,
+		},
+		"Threshold with domain breakdown returns an error": {
+			alt:         gmailalert.Alert{UnreadAbove: 100, GroupByDomain: true},
+			errExpected: true,
+		},
+		"Negative threshold returns an error": {
+			alt:         gmailalert.Alert{UnreadAbove: -1, GmailQuery: "is:unread"},
+			errExpected: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			alt := tc.alt
+			alt.PushoverTarget, alt.PushoverTitle = base.PushoverTarget, base.PushoverTitle
+			alt.PushoverSound, alt.PushoverMsg = base.PushoverSound, base.PushoverMsg
+
+			err := alt.OK()
+			errReceived := err != nil
+
+			if tc.errExpected != errReceived {
+				t.Errorf("got unexpected error status, got error: %v", err)
+			}
+		})
+	}
+}
+
+func TestProcessUnreadAlerts(t *testing.T) {
+	t.Parallel()
+
+	t.Run("overflowing label is notified once per overflow", func(t *testing.T) {
+		state, err := gmailalert.LoadState(filepath.Join(t.TempDir(), "state.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		counter := &fakeUnreadCounter{}
+		recNotif := &recordingNotifier{}
+		alt := gmailalert.Alerter{
+			Matcher:  counter,
+			Notifier: recNotif,
+			Logger:   &spyLogger{},
+			State:    state,
+		}
+		alerts := []gmailalert.Alert{{Name: "overflow", UnreadAbove: 100, RepeatInterval: "once"}}
+
+		for _, count := range []int{150, 160, 50, 120} {
+			counter.count = count
+			if err := alt.Process(alerts); err != nil {
+				t.Fatalf("got unexpected error: %v", err)
+			}
+		}
+
+		if len(recNotif.alerts) != 2 {
+			t.Fatalf("wanted the first and the last run to notify, got %d notifications", len(recNotif.alerts))
+		}
+		if want := `Found 150 emails unread with label "INBOX", more than 100`; recNotif.alerts[0].PushoverMsg != want {
+			t.Errorf("want message %q, got %q", want, recNotif.alerts[0].PushoverMsg)
+		}
+		if counter.label != "INBOX" {
+			t.Errorf("wanted unread emails in INBOX to be counted, got %q", counter.label)
+		}
+	})
+
+	t.Run("unread alerts without an unread counter are logged as errors", func(t *testing.T) {
+		spyLog := &spyLogger{}
+		alt := gmailalert.Alerter{
+			Matcher:  fakeMatcher{},
+			Notifier: fakeNotifier{},
+			Logger:   spyLog,
+		}
+
+		if err := alt.Process([]gmailalert.Alert{{UnreadAbove: 100}}); err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		if spyLog.numErrCalls != 1 {
+			t.Errorf("wanted 1 error to be logged, got %d", spyLog.numErrCalls)
+		}
+	})
+}
+
+// fakeUnreadCounter represents a test double type that implements the
+// Matcher and UnreadCounter interfaces, returning the count it holds and
+// recording the label it was asked about.
+type fakeUnreadCounter struct {
+	fakeMatcher
+	count int
+	label string
+}
+
+// UnreadCount records the given label and returns the count field of the
+// receiver f.
+func (f *fakeUnreadCounter) UnreadCount(label string) (int, error) {
+	f.label = label
+	return f.count, nil
+}
@@ -0,0 +1,195 @@
+package gmailalert
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// maxUnsubscribed is the number of unsubscribe URLs remembered per alert, so
+// that senders are not unsubscribed from again on every evaluation.
+const maxUnsubscribed = 100
+
+// oneClickBody is the body of a one-click unsubscribe request, as defined by
+// RFC 8058.
+const oneClickBody = "List-Unsubscribe=One-Click"
+
+// Unsubscriber is the interface that wraps the Unsubscribe method used by
+// any types implementing the one-click unsubscribe of RFC 8058 with the
+// given HTTPS URL from a List-Unsubscribe header.
+type Unsubscriber interface {
+	Unsubscribe(u string) error
+}
+
+// WithAlerterUnsubscriber accepts an Unsubscriber and returns a functional
+// option for wiring the Unsubscriber to an Alerter, which runs the
+// "unsubscribe" action of alerts with it.
+func WithAlerterUnsubscriber(u Unsubscriber) AlerterOption {
+	return func(a *Alerter) {
+		a.Unsubscriber = u
+	}
+}
+
+// OneClickUnsubscriber represents an Unsubscriber sending the one-click
+// unsubscribe requests of RFC 8058 with an HTTP client.
+type OneClickUnsubscriber struct {
+	// The HTTP client to send the requests with. Redirects are not
+	// followed. If nil, a client with a timeout of 30 seconds is used.
+	Client *http.Client
+}
+
+// Unsubscribe sends a one-click unsubscribe request to the given URL. An
+// error is returned if the request fails or is answered with an error
+// status.
+func (o OneClickUnsubscriber) Unsubscribe(u string) error {
+	client := http.Client{Timeout: 30 * time.Second}
+	if o.Client != nil {
+		client = *o.Client
+	}
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	resp, err := client.Post(u, "application/x-www-form-urlencoded", strings.NewReader(oneClickBody))
+	if err != nil {
+		return fmt.Errorf("got error sending unsubscribe request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("unsubscribe request got http status %s", resp.Status)
+	}
+
+	return nil
+}
+
+// listUnsubscribe represents the unsubscribe methods a sender offers in the
+// List-Unsubscribe and List-Unsubscribe-Post headers of an email.
+type listUnsubscribe struct {
+	// The first HTTPS URL, if any.
+	https string
+	// The first link of any kind, preferring HTTP(S) URLs over mailto ones.
+	link string
+	// Whether the HTTPS URL supports the one-click unsubscribe of RFC 8058.
+	oneClick bool
+}
+
+// parseListUnsubscribe returns the unsubscribe methods of the raw email
+// with the given headers. An error is returned if the headers cannot be
+// parsed.
+func parseListUnsubscribe(raw []byte) (listUnsubscribe, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return listUnsubscribe{}, fmt.Errorf("got error parsing email message: %v", err)
+	}
+
+	var l listUnsubscribe
+	var mailto string
+	for _, field := range strings.Split(msg.Header.Get("List-Unsubscribe"), ",") {
+		field = strings.TrimSpace(field)
+		if !strings.HasPrefix(field, "<") || !strings.HasSuffix(field, ">") {
+			continue
+		}
+		u, err := url.Parse(strings.TrimSpace(field[1 : len(field)-1]))
+		if err != nil {
+			continue
+		}
+		switch strings.ToLower(u.Scheme) {
+		case "https":
+			if l.https == "" {
+				l.https = u.String()
+			}
+			fallthrough
+		case "http":
+			if l.link == "" {
+				l.link = u.String()
+			}
+		case "mailto":
+			if mailto == "" {
+				mailto = u.String()
+			}
+		}
+	}
+	if l.link == "" {
+		l.link = mailto
+	}
+	l.oneClick = l.https != "" &&
+		strings.EqualFold(strings.TrimSpace(msg.Header.Get("List-Unsubscribe-Post")), oneClickBody)
+
+	return l, nil
+}
+
+// unsubscribe reads the List-Unsubscribe headers of the given messages
+// matching the given Alert and appends the unsubscribe link of every sender
+// to the Alert's notification message. If oneClick is true, senders offering
+// the one-click unsubscribe of RFC 8058 are unsubscribed from instead, once
+// per URL as remembered in the Alert's state with the given StoreTx, which
+// is nil if the Alerter has no State, and their link is only appended if
+// unsubscribing fails. An error is returned if the Alerter's Matcher does
+// not implement RawFetcher or a message cannot be fetched or parsed.
+func (a Alerter) unsubscribe(alt *Alert, matches []Message, tx StoreTx, oneClick bool) error {
+	fetcher, ok := a.Matcher.(RawFetcher)
+	if !ok {
+		return fmt.Errorf("matcher %T must implement RawFetcher to unsubscribe", a.Matcher)
+	}
+	var st AlertState
+	if tx != nil {
+		st = tx.Get(alt.key())
+	}
+	done := map[string]bool{}
+	for _, u := range st.Unsubscribed {
+		done[u] = true
+	}
+	unsubscriber := a.Unsubscriber
+	if unsubscriber == nil {
+		unsubscriber = OneClickUnsubscriber{}
+	}
+
+	var links []string
+	var unsubscribed int
+	for _, m := range matches {
+		raw, err := fetchRaw(fetcher, *alt, m.ID)
+		if err != nil {
+			return err
+		}
+		l, err := parseListUnsubscribe(raw)
+		if err != nil {
+			return err
+		}
+		switch {
+		case oneClick && l.oneClick && done[l.https]:
+			continue
+		case oneClick && l.oneClick:
+			if err := unsubscriber.Unsubscribe(l.https); err != nil {
+				a.errorLog().Printf("got error unsubscribing from email %s, adding its unsubscribe link to the notification: %v", m.ID, err)
+				break
+			}
+			done[l.https] = true
+			st.Unsubscribed = append(st.Unsubscribed, l.https)
+			unsubscribed++
+			continue
+		}
+		if l.link != "" && !done[l.link] {
+			done[l.link] = true
+			links = append(links, l.link)
+		}
+	}
+
+	if unsubscribed > 0 {
+		a.Logger.Printf("unsubscribed from %d senders of emails matching alert %q", unsubscribed, alt.key())
+		if len(st.Unsubscribed) > maxUnsubscribed {
+			st.Unsubscribed = st.Unsubscribed[len(st.Unsubscribed)-maxUnsubscribed:]
+		}
+		if tx != nil {
+			tx.Set(alt.key(), st)
+		}
+	}
+	for _, link := range links {
+		alt.PushoverMsg += "\nUnsubscribe: " + link
+	}
+
+	return nil
+}
@@ -0,0 +1,250 @@
+package gmailalert
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+// recordingUnsubscriber represents an Unsubscriber recording the URLs it
+// unsubscribes with, or failing with its err field if it is set.
+type recordingUnsubscriber struct {
+	urls []string
+	err  error
+}
+
+// Unsubscribe records the given URL, or returns the err field of the
+// receiver u if it is set.
+func (u *recordingUnsubscriber) Unsubscribe(url string) error {
+	if u.err != nil {
+		return u.err
+	}
+	u.urls = append(u.urls, url)
+	return nil
+}
+
+func TestParseListUnsubscribe(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		raw         string
+		want        listUnsubscribe
+		errExpected bool
+	}{
+		"One-click HTTPS URL and mailto": {
+			raw: "List-Unsubscribe: <mailto:leave@news.example.com>, <https://news.example.com/u/1>\r\n" +
+				"List-Unsubscribe-Post: List-Unsubscribe=One-Click\r\n\r\nbody",
+			want: listUnsubscribe{https: "https://news.example.com/u/1", link: "https://news.example.com/u/1", oneClick: true},
+		},
+		"HTTPS URL without one-click": {
+			raw:  "List-Unsubscribe: <https://news.example.com/u/1>\r\n\r\nbody",
+			want: listUnsubscribe{https: "https://news.example.com/u/1", link: "https://news.example.com/u/1"},
+		},
+		"Only mailto": {
+			raw:  "List-Unsubscribe: <mailto:leave@news.example.com?subject=unsubscribe>\r\n\r\nbody",
+			want: listUnsubscribe{link: "mailto:leave@news.example.com?subject=unsubscribe"},
+		},
+		"Plain HTTP URL cannot be one-click": {
+			raw: "List-Unsubscribe: <http://news.example.com/u/1>\r\n" +
+				"List-Unsubscribe-Post: List-Unsubscribe=One-Click\r\n\r\nbody",
+			want: listUnsubscribe{link: "http://news.example.com/u/1"},
+		},
+		"No header": {
+			raw:  "Subject: hello\r\n\r\nbody",
+			want: listUnsubscribe{},
+		},
+		"Malformed headers": {
+			raw:         "not a header",
+			errExpected: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got, err := parseListUnsubscribe([]byte(tc.raw))
+			errReceived := err != nil
+
+			if tc.errExpected != errReceived {
+				t.Fatalf("parseListUnsubscribe returned unexpected error status: %v", err)
+			}
+			if !cmp.Equal(tc.want, got, cmp.AllowUnexported(listUnsubscribe{})) {
+				t.Errorf("want != got\ndiff=%s", cmp.Diff(tc.want, got, cmp.AllowUnexported(listUnsubscribe{})))
+			}
+		})
+	}
+}
+
+func TestOneClickUnsubscriberUnsubscribe(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		status      int
+		errExpected bool
+	}{
+		"Accepted request": {
+			status: http.StatusOK,
+		},
+		"Redirect is not followed": {
+			status: http.StatusFound,
+		},
+		"Rejected request": {
+			status:      http.StatusNotFound,
+			errExpected: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var method, contentType, body string
+			svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := io.ReadAll(r.Body)
+				method, contentType, body = r.Method, r.Header.Get("Content-Type"), string(b)
+				if tc.status == http.StatusFound {
+					w.Header().Set("Location", "/elsewhere")
+				}
+				w.WriteHeader(tc.status)
+			}))
+			defer svr.Close()
+
+			err := OneClickUnsubscriber{Client: svr.Client()}.Unsubscribe(svr.URL + "/u/1")
+			errReceived := err != nil
+
+			if tc.errExpected != errReceived {
+				t.Fatalf("Unsubscribe returned unexpected error status: %v", err)
+			}
+			if method != http.MethodPost || contentType != "application/x-www-form-urlencoded" || body != oneClickBody {
+				t.Errorf("want one-click POST request, got method %q, content type %q, and body %q", method, contentType, body)
+			}
+		})
+	}
+}
+
+func TestAlerterRunsUnsubscribeActions(t *testing.T) {
+	t.Parallel()
+
+	raw := map[string][]byte{
+		"1": []byte("List-Unsubscribe: <https://news.example.com/u/1>\r\n" +
+			"List-Unsubscribe-Post: List-Unsubscribe=One-Click\r\n\r\nbody"),
+		"2": []byte("List-Unsubscribe: <mailto:leave@shop.example.com>\r\n\r\nbody"),
+	}
+	testCases := map[string]struct {
+		action       string
+		unsubscriber *recordingUnsubscriber
+		wantURLs     []string
+		wantLinks    string
+	}{
+		"Unsubscribe with one-click and link fallback": {
+			action:       ActionUnsubscribe,
+			unsubscriber: &recordingUnsubscriber{},
+			wantURLs:     []string{"https://news.example.com/u/1"},
+			wantLinks:    "Unsubscribe: mailto:leave@shop.example.com",
+		},
+		"Failed one-click falls back to link": {
+			action:       ActionUnsubscribe,
+			unsubscriber: &recordingUnsubscriber{err: errors.New("connection refused")},
+			wantLinks:    "Unsubscribe: https://news.example.com/u/1\nUnsubscribe: mailto:leave@shop.example.com",
+		},
+		"Links only": {
+			action:       ActionUnsubscribeLink,
+			unsubscriber: &recordingUnsubscriber{},
+			wantLinks:    "Unsubscribe: https://news.example.com/u/1\nUnsubscribe: mailto:leave@shop.example.com",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			state, err := LoadState(filepath.Join(t.TempDir(), "state.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			notifier := &recordingTestNotifier{}
+			fetcher := fakeExportFetcher{
+				fakePreviewFetcher: fakePreviewFetcher{matches: []Message{{ID: "1"}, {ID: "2"}}},
+				raw:                raw,
+			}
+			a, err := NewAlerter(fetcher, notifier,
+				WithAlerterLogger(log.New(io.Discard, "", 0)),
+				WithAlerterState(state),
+				WithAlerterUnsubscriber(tc.unsubscriber))
+			if err != nil {
+				t.Fatal(err)
+			}
+			alt := Alert{Name: "newsletters", GmailQuery: "from:news", Actions: []string{tc.action}}
+
+			res := a.process(alt, nil)
+			if res.Err != nil {
+				t.Fatal(res.Err)
+			}
+			if !cmp.Equal(tc.wantURLs, tc.unsubscriber.urls) {
+				t.Errorf("want != got\ndiff=%s", cmp.Diff(tc.wantURLs, tc.unsubscriber.urls))
+			}
+			if len(notifier.alerts) != 1 {
+				t.Fatalf("want one notification, got %+v", notifier.alerts)
+			}
+			_, got, _ := strings.Cut(notifier.alerts[0].PushoverMsg, "\n")
+			if tc.wantLinks != got {
+				t.Errorf("want unsubscribe links %q appended to notification message, got %q", tc.wantLinks, got)
+			}
+			if !cmp.Equal(tc.wantURLs, state.Get(alt.key()).Unsubscribed, cmpopts.EquateEmpty()) {
+				t.Errorf("want unsubscribed URLs %q recorded in state, got %q", tc.wantURLs, state.Get(alt.key()).Unsubscribed)
+			}
+		})
+	}
+}
+
+func TestAlerterUnsubscribesOncePerURL(t *testing.T) {
+	t.Parallel()
+
+	state, err := LoadState(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsubscriber := &recordingUnsubscriber{}
+	fetcher := fakeExportFetcher{
+		fakePreviewFetcher: fakePreviewFetcher{matches: []Message{{ID: "1"}}},
+		raw: map[string][]byte{"1": []byte("List-Unsubscribe: <https://news.example.com/u/1>\r\n" +
+			"List-Unsubscribe-Post: List-Unsubscribe=One-Click\r\n\r\nbody")},
+	}
+	a, err := NewAlerter(fetcher, &recordingTestNotifier{},
+		WithAlerterLogger(log.New(io.Discard, "", 0)),
+		WithAlerterState(state),
+		WithAlerterUnsubscriber(unsubscriber))
+	if err != nil {
+		t.Fatal(err)
+	}
+	alt := Alert{Name: "newsletters", GmailQuery: "from:news", Actions: []string{ActionUnsubscribe}}
+
+	for i := 0; i < 2; i++ {
+		if res := a.process(alt, nil); res.Err != nil {
+			t.Fatal(res.Err)
+		}
+	}
+
+	want := []string{"https://news.example.com/u/1"}
+	if !cmp.Equal(want, unsubscriber.urls) {
+		t.Errorf("want != got\ndiff=%s", cmp.Diff(want, unsubscriber.urls))
+	}
+}
+
+func TestAlerterUnsubscribeNeedsRawFetcher(t *testing.T) {
+	t.Parallel()
+
+	a, err := NewAlerter(fakePreviewFetcher{matches: []Message{{ID: "1"}}}, &recordingTestNotifier{},
+		WithAlerterLogger(log.New(io.Discard, "", 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := a.process(Alert{Name: "newsletters", GmailQuery: "from:news", Actions: []string{ActionUnsubscribeLink}}, nil)
+	if res.Err == nil {
+		t.Error("expected an error unsubscribing without a RawFetcher but did not get one")
+	}
+}
@@ -0,0 +1,107 @@
+package gmailalert
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// recipientValidator is the interface that wraps the ValidateRecipient
+// method used by any types that can check a notification recipient key with
+// the notification provider.
+type recipientValidator interface {
+	ValidateRecipient(key string) error
+}
+
+// validateCLI accepts the command line flags of the "validate" subcommand,
+// which loads the alert configuration, lints the Gmail query of every alert,
+// and checks the Pushover app token and the recipient key of every alert with
+// the Pushover API. An error is returned if the flags are invalid, the alert
+// configuration cannot be loaded, or any check fails.
+func validateCLI(args []string) error {
+	var app cliEnv
+
+	fs := app.flagSet("validate")
+	if err := app.parse(fs, args); err != nil {
+		return err
+	}
+
+	app, alertCfg, err := app.profileConfig()
+	if err != nil {
+		return err
+	}
+
+	pushoverClient, err := app.pushoverClient(alertCfg, app.debugLogger())
+	if err != nil {
+		return err
+	}
+
+	return errors.Join(
+		lintAlerts(alertCfg.Alerts, os.Stdout),
+		validatePushover(pushoverClient, alertCfg.Alerts, os.Stdout),
+	)
+}
+
+// lintAlerts accepts a slice of Alerts and an io.Writer, lints the Gmail
+// queries of every alert that has any, and writes any issues found to
+// the io.Writer. An error naming the alerts with issues is returned if any
+// are found.
+func lintAlerts(alerts []Alert, w io.Writer) error {
+	var flagged []string
+	for _, alt := range alerts {
+		var issues []QueryIssue
+		for _, query := range alt.gmailQueries() {
+			issues = append(issues, LintQuery(query)...)
+		}
+		for _, issue := range issues {
+			fmt.Fprintf(w, "WARN %s: %s\n", alt.key(), issue)
+		}
+		if len(issues) > 0 {
+			flagged = append(flagged, alt.key())
+		}
+	}
+
+	if len(flagged) > 0 {
+		return fmt.Errorf("alerts with gmail query issues: %q", flagged)
+	}
+
+	return nil
+}
+
+// validatePushover accepts a recipientValidator, a slice of Alerts, and an
+// io.Writer, checks the recipient key of every alert with the
+// recipientValidator, and writes the outcome of each check to the io.Writer.
+// Every recipient of an alert is checked.
+// Each distinct recipient key is only checked once. An error naming the
+// alerts with invalid recipients is returned if any check fails.
+func validatePushover(v recipientValidator, alerts []Alert, w io.Writer) error {
+	checked := map[string]error{}
+	var invalid []string
+	for _, alt := range alerts {
+		var failed bool
+		for _, recipient := range alt.Recipients() {
+			err, ok := checked[recipient]
+			if !ok {
+				err = v.ValidateRecipient(recipient)
+				checked[recipient] = err
+			}
+			if err != nil {
+				fmt.Fprintf(w, "FAIL %s: recipient %s: %v\n", alt.key(), Secret(recipient), err)
+				failed = true
+			}
+		}
+
+		if failed {
+			invalid = append(invalid, alt.key())
+			continue
+		}
+		fmt.Fprintf(w, "OK   %s\n", alt.key())
+	}
+
+	if len(invalid) > 0 {
+		return fmt.Errorf("alerts with invalid pushover recipients: %q", invalid)
+	}
+
+	return nil
+}
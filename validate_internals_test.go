@@ -0,0 +1,105 @@
+package gmailalert
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidatePushover(t *testing.T) {
+	t.Parallel()
+
+	t.Run("valid recipients return no error", func(t *testing.T) {
+		v := &fakeRecipientValidator{invalid: map[string]bool{}}
+		alerts := []Alert{
+			{Name: "bills", PushoverTarget: "user1"},
+			{Name: "zoom", PushoverTarget: "user1"},
+		}
+
+		err := validatePushover(v, alerts, &bytes.Buffer{})
+		if err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		if v.numCalls != 1 {
+			t.Errorf("want each distinct recipient to be checked once, got %d checks", v.numCalls)
+		}
+	})
+
+	t.Run("invalid recipient returns an error naming the alert", func(t *testing.T) {
+		v := &fakeRecipientValidator{invalid: map[string]bool{"bad-user": true}}
+		alerts := []Alert{
+			{Name: "bills", PushoverTarget: "user1"},
+			{Name: "zoom", PushoverTarget: "bad-user"},
+		}
+		out := &bytes.Buffer{}
+
+		err := validatePushover(v, alerts, out)
+		if err == nil {
+			t.Fatal("wanted an error but did not get one")
+		}
+
+		if !strings.Contains(err.Error(), "zoom") || strings.Contains(err.Error(), "bills") {
+			t.Errorf("want error to only name alert zoom, got: %v", err)
+		}
+		if !strings.Contains(out.String(), "OK   bills") || !strings.Contains(out.String(), "FAIL zoom") {
+			t.Errorf("want output to report each alert, got:\n%s", out.String())
+		}
+	})
+}
+
+func TestLintAlerts(t *testing.T) {
+	t.Parallel()
+
+	t.Run("valid queries return no error", func(t *testing.T) {
+		alerts := []Alert{{Name: "bills", GmailQuery: "is:unread subject:bill"}}
+		out := &bytes.Buffer{}
+
+		if err := lintAlerts(alerts, out); err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		if out.Len() != 0 {
+			t.Errorf("want no output, got:\n%s", out.String())
+		}
+	})
+
+	t.Run("query issues return an error naming the alert", func(t *testing.T) {
+		alerts := []Alert{
+			{Name: "bills", GmailQuery: "is:unread subject:bill"},
+			{Name: "recent", GmailQuery: "newer_than:30days"},
+		}
+		out := &bytes.Buffer{}
+
+		err := lintAlerts(alerts, out)
+		if err == nil {
+			t.Fatal("wanted an error but did not get one")
+		}
+
+		if !strings.Contains(err.Error(), "recent") || strings.Contains(err.Error(), "bills") {
+			t.Errorf("want error to only name alert recent, got: %v", err)
+		}
+		if !strings.Contains(out.String(), "WARN recent:") {
+			t.Errorf("want output to report the issue, got:\n%s", out.String())
+		}
+	})
+}
+
+// fakeRecipientValidator represents a test double type that implements the
+// recipientValidator interface. It rejects the recipient keys in its invalid
+// field and counts how many checks are made.
+type fakeRecipientValidator struct {
+	invalid  map[string]bool
+	numCalls int
+}
+
+// ValidateRecipient increments the numCalls field of the receiver f and
+// returns an error if key is in the invalid field of the receiver f.
+func (f *fakeRecipientValidator) ValidateRecipient(key string) error {
+	f.numCalls++
+	if f.invalid[key] {
+		return errors.New("user key is invalid")
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package gmailalert
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// WebhookConfig represents the configuration for posting a summary of every
+// run to a webhook, like the endpoint of a dashboard showing when alerts
+// were last checked.
+type WebhookConfig struct {
+	// The URL to post the summary of every run to.
+	URL string `json:"url"`
+	// The optional headers to send with each request, like an
+	// "Authorization" header.
+	Headers map[string]string `json:"headers"`
+	// The timeout for each request, as a duration like "10s". Defaults to
+	// 10s.
+	Timeout string `json:"timeout"`
+	// The number of times a failed request is retried. Defaults to 0.
+	Retries int `json:"retries"`
+	// The optional secret to sign each request with, so that receivers can
+	// authenticate it with VerifyWebhook.
+	Secret string `json:"secret"`
+	// What the webhook is sent about alerts, either "full" for their names
+	// and errors or "hashed" for hashes of their names and no errors. If
+	// empty, "full" is used.
+	Privacy string `json:"privacy"`
+	// The optional URL of the proxy or SSH tunnel the requests are sent
+	// through, like "socks5://localhost:1080" or
+	// "ssh://user@bastion.example.com". If empty, the proxy named by the
+	// environment is used, if any.
+	Proxy string `json:"proxy"`
+}
+
+// The headers of a signed webhook request holding the time it was signed, in
+// seconds since the Unix epoch, and its signature.
+const (
+	WebhookTimestampHeader = "X-Gmailalert-Timestamp"
+	WebhookSignatureHeader = "X-Gmailalert-Signature"
+)
+
+// webhookRun represents the JSON body posted to a webhook after a run.
+type webhookRun struct {
+	RunID      string         `json:"runid"`
+	Started    time.Time      `json:"started"`
+	Finished   time.Time      `json:"finished"`
+	Matches    int            `json:"matches"`
+	Notified   int            `json:"notified"`
+	Suppressed int            `json:"suppressed"`
+	Failed     int            `json:"failed"`
+	Alerts     []webhookAlert `json:"alerts"`
+}
+
+// webhookAlert represents the outcome of a single alert in the JSON body
+// posted to a webhook.
+type webhookAlert struct {
+	Alert      string            `json:"alert"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	EvalID     string            `json:"evalid"`
+	Matches    int               `json:"matches"`
+	Estimated  int               `json:"estimated,omitempty"`
+	Notified   bool              `json:"notified"`
+	Suppressed bool              `json:"suppressed"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// Webhook is a Reporter that posts a JSON summary of every run to a
+// configured URL, whether or not any alerts were notified, so that external
+// dashboards can show when gmailalert last checked for emails.
+type Webhook struct {
+	cfg     WebhookConfig
+	client  *http.Client
+	backoff time.Duration
+}
+
+// NewWebhook accepts a WebhookConfig and returns a new Webhook. An error is
+// returned if the URL is empty, the timeout or proxy is invalid, or the
+// number of retries is negative.
+func NewWebhook(cfg WebhookConfig) (*Webhook, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("webhook url must not be empty")
+	}
+	if cfg.Retries < 0 {
+		return nil, fmt.Errorf("webhook retries must not be negative, got %d", cfg.Retries)
+	}
+	if err := privacyOK("webhook", cfg.Privacy); err != nil {
+		return nil, err
+	}
+
+	timeout := 10 * time.Second
+	if cfg.Timeout != "" {
+		d, err := time.ParseDuration(cfg.Timeout)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("webhook timeout must be a positive duration, got %q", cfg.Timeout)
+		}
+		timeout = d
+	}
+	client, err := adapterHTTPClient(cfg.Proxy, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("got error configuring webhook proxy: %v", err)
+	}
+
+	return &Webhook{
+		cfg:     cfg,
+		client:  client,
+		backoff: time.Second,
+	}, nil
+}
+
+// Report accepts the Summary of a run and posts it as JSON to the webhook
+// URL, retrying with a linear backoff if the request fails or the response
+// status is not 2xx. An error is returned if every attempt fails.
+func (w *Webhook) Report(s Summary) error {
+	body, err := json.Marshal(newWebhookRun(s, w.cfg.Privacy == PrivacyHashed))
+	if err != nil {
+		return fmt.Errorf("got error json-encoding webhook body: %v", err)
+	}
+
+	for attempt := 0; attempt <= w.cfg.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * w.backoff)
+		}
+
+		err = w.post(body)
+		if err == nil {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("got error posting to webhook url %s after %d attempts: %v", w.cfg.URL, w.cfg.Retries+1, err)
+}
+
+// post sends a single HTTP POST request with the given JSON body to the
+// webhook URL. An error is returned if the request fails or the response
+// status is not 2xx.
+func (w *Webhook) post(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, w.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	if w.cfg.Secret != "" {
+		ts := time.Now().Unix()
+		req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(ts, 10))
+		req.Header.Set(WebhookSignatureHeader, signWebhook(w.cfg.Secret, ts, body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("got unexpected response status %s", resp.Status)
+	}
+
+	return nil
+}
+
+// newWebhookRun returns the JSON body posted to a webhook for the given
+// Summary. If hashed is true, the names of the alerts are replaced by hashes
+// of them and their errors by "failed".
+func newWebhookRun(s Summary, hashed bool) webhookRun {
+	run := webhookRun{
+		RunID:      s.RunID,
+		Started:    s.Started,
+		Finished:   s.Started.Add(s.Duration),
+		Matches:    s.Matches(),
+		Notified:   s.Notified(),
+		Suppressed: s.Suppressed(),
+		Failed:     s.Failed(),
+		Alerts:     make([]webhookAlert, 0, len(s.Results)),
+	}
+	for _, r := range s.Results {
+		a := webhookAlert{
+			Alert:      r.Alert,
+			Labels:     r.Labels,
+			EvalID:     r.EvalID,
+			Matches:    r.Matches,
+			Estimated:  r.Estimated,
+			Notified:   r.Notified,
+			Suppressed: r.Suppressed,
+		}
+		if r.Err != nil {
+			a.Error = r.Err.Error()
+		}
+		if hashed {
+			a.Alert = contentHash(r.Alert)
+			if r.Err != nil {
+				a.Error = "failed"
+			}
+		}
+		run.Alerts = append(run.Alerts, a)
+	}
+
+	return run
+}
@@ -0,0 +1,144 @@
+package gmailalert
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewWebhook(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		input       WebhookConfig
+		errExpected bool
+	}{
+		"Empty url returns an error": {
+			input:       WebhookConfig{},
+			errExpected: true,
+		},
+		"Negative retries returns an error": {
+			input:       WebhookConfig{URL: "http://localhost", Retries: -1},
+			errExpected: true,
+		},
+		"Invalid timeout returns an error": {
+			input:       WebhookConfig{URL: "http://localhost", Timeout: "soon"},
+			errExpected: true,
+		},
+		"Unknown privacy mode returns an error": {
+			input:       WebhookConfig{URL: "http://localhost", Privacy: "secret"},
+			errExpected: true,
+		},
+		"Valid config returns no error": {
+			input:       WebhookConfig{URL: "http://localhost", Timeout: "5s", Retries: 2},
+			errExpected: false,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewWebhook(tc.input)
+			errReceived := err != nil
+
+			if tc.errExpected != errReceived {
+				t.Errorf("got unexpected error status %t", errReceived)
+			}
+		})
+	}
+}
+
+func TestWebhookReport(t *testing.T) {
+	t.Parallel()
+
+	started := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	summary := Summary{
+		RunID:    "run1",
+		Started:  started,
+		Duration: 2 * time.Second,
+		Results: []AlertResult{
+			{Alert: "bills", Labels: map[string]string{"team": "billing"}, EvalID: "run1.0", Matches: 2, Notified: true},
+			{Alert: "orders", EvalID: "run1.1", Err: errors.New("quota exceeded")},
+		},
+	}
+
+	var received webhookRun
+	var auth string
+	var flakyPosts int64
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	})
+	mux.HandleFunc("/flaky", func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&flakyPosts, 1) == 1 {
+			http.Error(w, "try again", http.StatusInternalServerError)
+		}
+	})
+	mux.HandleFunc("/down", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	})
+	svr := httptest.NewServer(mux)
+	defer svr.Close()
+
+	t.Run("summary is posted with every alert outcome", func(t *testing.T) {
+		w, err := NewWebhook(WebhookConfig{URL: svr.URL + "/ok", Headers: map[string]string{"Authorization": "Bearer secret"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := w.Report(summary); err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+
+		want := webhookRun{
+			RunID:    "run1",
+			Started:  started,
+			Finished: started.Add(2 * time.Second),
+			Matches:  2,
+			Notified: 1,
+			Failed:   1,
+			Alerts: []webhookAlert{
+				{Alert: "bills", Labels: map[string]string{"team": "billing"}, EvalID: "run1.0", Matches: 2, Notified: true},
+				{Alert: "orders", EvalID: "run1.1", Error: "quota exceeded"},
+			},
+		}
+		if !cmp.Equal(want, received) {
+			t.Error(cmp.Diff(want, received))
+		}
+		if auth != "Bearer secret" {
+			t.Errorf("want authorization header %q, got %q", "Bearer secret", auth)
+		}
+	})
+
+	t.Run("failed post is retried", func(t *testing.T) {
+		w, err := NewWebhook(WebhookConfig{URL: svr.URL + "/flaky", Retries: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.backoff = time.Millisecond
+
+		if err := w.Report(summary); err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+	})
+
+	t.Run("post failing every attempt returns an error", func(t *testing.T) {
+		w, err := NewWebhook(WebhookConfig{URL: svr.URL + "/down", Retries: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.backoff = time.Millisecond
+
+		if err := w.Report(summary); err == nil {
+			t.Error("expected an error but did not get one")
+		}
+	})
+}
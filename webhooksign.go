@@ -0,0 +1,57 @@
+package gmailalert
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// signWebhook returns the signature of a webhook request with the given
+// body signed with the given secret at the given time, in seconds since the
+// Unix epoch. The signature is "sha256=" followed by the hex-encoded
+// HMAC-SHA256, keyed with the secret, of the time, a ".", and the body.
+func signWebhook(secret string, ts int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(ts, 10) + "."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhook accepts the secret shared with gmailalert, the headers and
+// body of a webhook request received from gmailalert, the maximum age of a
+// request, and the current time, and returns an error if the request was
+// not signed with the secret, was changed after being signed, or was signed
+// more than maxAge before, or after, now. Rejecting old requests keeps a
+// captured request from being replayed later; receivers that need to reject
+// replays within maxAge as well can remember the "runid" of each request.
+func VerifyWebhook(secret string, header http.Header, body []byte, maxAge time.Duration, now time.Time) error {
+	if secret == "" {
+		return errors.New("webhook secret must not be empty")
+	}
+
+	tsHeader := header.Get(WebhookTimestampHeader)
+	ts, err := strconv.ParseInt(tsHeader, 10, 64)
+	if err != nil {
+		return fmt.Errorf("webhook timestamp header must be a unix time, got %q", tsHeader)
+	}
+	if age := now.Sub(time.Unix(ts, 0)); age > maxAge || age < -maxAge {
+		return fmt.Errorf("webhook request was signed at %s, not within %s of now", time.Unix(ts, 0).UTC().Format(time.RFC3339), maxAge)
+	}
+
+	sig := header.Get(WebhookSignatureHeader)
+	if !strings.HasPrefix(sig, "sha256=") {
+		return fmt.Errorf("webhook signature header must start with \"sha256=\", got %q", sig)
+	}
+	if !hmac.Equal([]byte(sig), []byte(signWebhook(secret, ts, body))) {
+		return errors.New("webhook signature does not match the request")
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package gmailalert_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aculclasure/gmailalert"
+)
+
+func TestSignedWebhookIsVerified(t *testing.T) {
+	t.Parallel()
+
+	verified := make(chan error, 1)
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		verified <- gmailalert.VerifyWebhook("s3cret", r.Header, body, 5*time.Minute, time.Now())
+	}))
+	defer svr.Close()
+
+	w, err := gmailalert.NewWebhook(gmailalert.WebhookConfig{URL: svr.URL, Secret: "s3cret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Report(gmailalert.Summary{RunID: "run1"}); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+
+	if err := <-verified; err != nil {
+		t.Errorf("want the request to be verified, got error: %v", err)
+	}
+}
+
+func TestVerifyWebhook(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	body := []byte(`{"runid":"run1"}`)
+	signed := func(secret string, at time.Time, body []byte) http.Header {
+		var captured http.Header
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			captured = r.Header.Clone()
+		}))
+		defer svr.Close()
+		w, err := gmailalert.NewWebhook(gmailalert.WebhookConfig{URL: svr.URL, Secret: secret})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Report(gmailalert.Summary{}); err != nil {
+			t.Fatal(err)
+		}
+		captured.Set(gmailalert.WebhookTimestampHeader, strconv.FormatInt(at.Unix(), 10))
+		return captured
+	}
+
+	testCases := map[string]struct {
+		secret      string
+		header      http.Header
+		body        []byte
+		errExpected bool
+	}{
+		"Missing headers return an error": {
+			secret:      "s3cret",
+			header:      http.Header{},
+			body:        body,
+			errExpected: true,
+		},
+		"Old timestamp returns an error": {
+			secret:      "s3cret",
+			header:      signed("s3cret", now.Add(-time.Hour), body),
+			body:        body,
+			errExpected: true,
+		},
+		"Future timestamp returns an error": {
+			secret:      "s3cret",
+			header:      signed("s3cret", now.Add(time.Hour), body),
+			body:        body,
+			errExpected: true,
+		},
+		"Changed timestamp returns an error": {
+			secret:      "s3cret",
+			header:      signed("s3cret", now, body),
+			body:        body,
+			errExpected: true,
+		},
+		"Empty secret returns an error": {
+			header:      signed("s3cret", now, body),
+			body:        body,
+			errExpected: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := gmailalert.VerifyWebhook(tc.secret, tc.header, tc.body, 5*time.Minute, now)
+			errReceived := err != nil
+
+			if tc.errExpected != errReceived {
+				t.Errorf("got unexpected error status, got error: %v", err)
+			}
+		})
+	}
+}